@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"golang.org/x/crypto/scrypt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Bundles                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// bundleFormat marks a sealed bundle, and is authenticated with it so a file
+// cache or other encrypted file is never mistaken for one.
+const bundleFormat = "kion-cli-cache-bundle"
+
+// Bundle holds the session and STAKs exported from a cache, to carry them to
+// a host without a browser to sign in with, such as a bastion.
+type Bundle struct {
+	KionURL  string               `json:"kion_url"`
+	Exported time.Time            `json:"exported"`
+	Session  kion.Session         `json:"session"`
+	STAKs    map[string]kion.STAK `json:"staks"`
+}
+
+// Empty reports whether the bundle holds neither a session nor STAKs.
+func (b Bundle) Empty() bool {
+	return b.Session == (kion.Session{}) && len(b.STAKs) == 0
+}
+
+// BundleImport describes what importing a bundle stored and what it skipped
+// as expired.
+type BundleImport struct {
+	Session        bool
+	SessionExpired bool
+	STAKs          int
+	STAKsExpired   int
+}
+
+// sealedBundle is the layout of a bundle on disk. Data holds the bundle
+// sealed with AES-GCM under a key derived from the passphrase and Salt, the
+// same way the file cache is.
+type sealedBundle struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// ExportBundle gathers the session and STAKs of c still usable at now, for the
+// Kion instance at kionURL.
+func ExportBundle(c Cache, kionURL string, now time.Time) (Bundle, error) {
+	bundle := Bundle{KionURL: kionURL, Exported: now, STAKs: make(map[string]kion.STAK)}
+
+	session, found, err := c.GetSession()
+	if err != nil {
+		return Bundle{}, err
+	}
+	if found && usableSession(session, now) {
+		bundle.Session = session
+	}
+
+	entries, err := c.ListCache()
+	if err != nil {
+		return Bundle{}, err
+	}
+	for _, entry := range entries {
+		if entry.Category != CategoryStak || entry.Expired(now) {
+			continue
+		}
+		stak, found, err := c.GetStak(entry.Key)
+		if err != nil {
+			return Bundle{}, err
+		}
+		if found {
+			bundle.STAKs[entry.Key] = stak
+		}
+	}
+	return bundle, nil
+}
+
+// ImportBundle stores the session and STAKs of a bundle in c, skipping those
+// expired at now. The session replaces any already cached.
+func ImportBundle(c Cache, bundle Bundle, now time.Time) (BundleImport, error) {
+	var imported BundleImport
+	if bundle.Session != (kion.Session{}) {
+		if usableSession(bundle.Session, now) {
+			err := c.SetSession(bundle.Session)
+			if err != nil {
+				return imported, err
+			}
+			imported.Session = true
+		} else {
+			imported.SessionExpired = true
+		}
+	}
+	for key, stak := range bundle.STAKs {
+		if !stak.Expiration.After(now) {
+			imported.STAKsExpired++
+			continue
+		}
+		err := c.SetStak(key, stak)
+		if err != nil {
+			return imported, err
+		}
+		imported.STAKs++
+	}
+	return imported, nil
+}
+
+// usableSession reports whether a session can still be used at now, its
+// access token unexpired or it refreshable. A session without a readable
+// expiry is kept, as the cache listing treats it as not expiring.
+func usableSession(session kion.Session, now time.Time) bool {
+	if session.Access.Token == "" {
+		return session.Refreshable(now)
+	}
+	expires, err := session.ExpiresAt()
+	return err != nil || expires.After(now) || session.Refreshable(now)
+}
+
+// SealBundle encrypts a bundle with a key derived from passphrase.
+func SealBundle(bundle Bundle, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("a passphrase is required to encrypt the bundle")
+	}
+	plain, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, fileCacheScryptN, fileCacheScryptR, fileCacheScryptP, fileCacheKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedBundle{
+		Format:  bundleFormat,
+		Version: 1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, []byte(bundleFormat)),
+	})
+}
+
+// CheckBundle returns an error if data isn't a sealed bundle this version can
+// open, so that is known before asking for a passphrase.
+func CheckBundle(data []byte) error {
+	_, err := parseBundle(data)
+	return err
+}
+
+// parseBundle reads the layout of a sealed bundle.
+func parseBundle(data []byte) (sealedBundle, error) {
+	var sealed sealedBundle
+	err := json.Unmarshal(data, &sealed)
+	if err != nil || sealed.Format != bundleFormat {
+		return sealed, errors.New("not a Kion CLI cache bundle, create one with kion cache export")
+	}
+	if sealed.Version != 1 {
+		return sealed, fmt.Errorf("unsupported bundle version %v, update Kion CLI to import it", sealed.Version)
+	}
+	return sealed, nil
+}
+
+// OpenBundle decrypts a bundle sealed with passphrase.
+func OpenBundle(data []byte, passphrase string) (Bundle, error) {
+	sealed, err := parseBundle(data)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), sealed.Salt, fileCacheScryptN, fileCacheScryptR, fileCacheScryptP, fileCacheKeyLen)
+	if err != nil {
+		return Bundle{}, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return Bundle{}, err
+	}
+	plain, err := gcm.Open(nil, sealed.Nonce, sealed.Data, []byte(bundleFormat))
+	if err != nil {
+		return Bundle{}, errors.New("unable to decrypt the bundle, check the passphrase")
+	}
+
+	var bundle Bundle
+	err = json.Unmarshal(plain, &bundle)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("unable to read the bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+// SameInstance reports whether two Kion URLs name the same instance, as
+// bundles only hold tokens that instance accepts.
+func SameInstance(a string, b string) bool {
+	return Namespace(a, "", "") == Namespace(b, "", "")
+}
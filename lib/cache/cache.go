@@ -1,7 +1,14 @@
 package cache
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
 	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/filesystem"
 	"github.com/kionsoftware/kion-cli/lib/kion"
 )
 
@@ -11,7 +18,15 @@ type Cache interface {
 	GetStak(key string) (kion.STAK, bool, error)
 	SetSession(value kion.Session) error
 	GetSession() (kion.Session, bool, error)
-	FlushCache() error
+	SetSelection(key string, value string) error
+	GetSelection(key string) (string, bool, error)
+	SetInventory(value kion.Inventory) error
+	GetInventory() (kion.Inventory, bool, error)
+	SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error
+	GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error)
+	FlushCache(categories ...string) error
+	ListCache() ([]Entry, error)
+	PurgeCache() ([]Entry, error)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -20,22 +35,214 @@ type Cache interface {
 //                                                                            //
 ////////////////////////////////////////////////////////////////////////////////
 
+// legacyCacheName is the keyring item used before caches were namespaced per
+// Kion instance and user.
+const legacyCacheName = "Kion-CLI Cache"
+
 // RealCache is our cache object for passing the keychain to receiver methods.
 type RealCache struct {
-	keyring keyring.Keyring
+	keyring  keyring.Keyring
+	name     string
+	readOnly bool
+
+	// perUser derives the namespace of STAKs, selections, and the inventory
+	// from the user of the cached session, see ScopeToSessionUser
+	perUser    func(user string) string
+	mu         sync.Mutex
+	user       string
+	userLoaded bool
 }
 
-// CacheData is a nested structure for storing kion-cli data.
+// CacheData is the structure of the combined cache item used before each
+// category was stored in its own keyring item, kept to migrate it.
 type CacheData struct {
-	STAK    map[string]kion.STAK
-	SESSION kion.Session
+	STAK      map[string]kion.STAK
+	SESSION   kion.Session
+	SELECTION map[string]string
+	INVENTORY kion.Inventory
 }
 
-// NewCache creates a new RealCache.
-func NewCache(keyring keyring.Keyring) *RealCache {
+// NewCache creates a new RealCache scoped to the given namespace.
+func NewCache(keyring keyring.Keyring, namespace string) *RealCache {
 	return &RealCache{
 		keyring: keyring,
+		name:    itemName(namespace),
+	}
+}
+
+// ScopeToSessionUser keeps STAKs, selections, and the inventory in the
+// namespace returned by namespace for the user the cached session belongs
+// to, rather than alongside the session, for sign ins where the user isn't
+// known until signed in. The session and SAML metadata stay in the cache's
+// own namespace. Without a session naming its user nothing else is cached.
+func (c *RealCache) ScopeToSessionUser(namespace func(user string) string) {
+	c.perUser = namespace
+}
+
+// dataName returns the name of the cache holding STAKs, selections, and the
+// inventory, or false if they aren't cached as the session's user is
+// unknown.
+func (c *RealCache) dataName() (string, bool) {
+	if c.perUser == nil {
+		return c.name, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.userLoaded {
+		session, _, err := getSession(c.keyring, c.name)
+		if err != nil {
+			return "", false
+		}
+		c.user, c.userLoaded = session.UserName, true
+	}
+	if c.user == "" {
+		return "", false
+	}
+	return itemName(c.perUser(c.user)), true
+}
+
+// setUser notes the user of a newly cached session.
+func (c *RealCache) setUser(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user, c.userLoaded = user, true
+}
+
+// names returns the names of every cache held, the session's first.
+func (c *RealCache) names() []string {
+	if name, ok := c.dataName(); ok && name != c.name {
+		return []string{c.name, name}
+	}
+	return []string{c.name}
+}
+
+// ReadOnly stops reads from writing back, such as pruning expired STAKs when
+// looking one up, for dry runs.
+func (c *RealCache) ReadOnly() {
+	c.readOnly = true
+}
+
+// Namespace derives a cache namespace from the Kion URL, username, and
+// configuration profile so that switching instances, users, or profiles never
+// serves a session or STAK cached for another. The default profile is given
+// as an empty profile.
+func Namespace(url string, username string, profile string) string {
+	namespace := strings.TrimRight(strings.ToLower(strings.TrimSpace(url)), "/")
+	if username != "" {
+		namespace = fmt.Sprintf("%v|%v", namespace, username)
+	}
+	if profile != "" {
+		namespace = fmt.Sprintf("%v#%v", namespace, profile)
+	}
+	return namespace
+}
+
+// itemName returns the keyring item name of a namespace's cache, which each
+// category's item name is derived from.
+func itemName(namespace string) string {
+	return fmt.Sprintf("%v (%v)", legacyCacheName, namespace)
+}
+
+// MigrateLegacy moves entries from the caches used by earlier versions into
+// this cache's per category items and removes the old entries: first the
+// namespace's combined item, then the un-namespaced cache. Cached STAKs and
+// selections from the un-namespaced cache are kept as it most likely belonged
+// to the instance in use. Its session and inventory are dropped as they can't
+// be attributed to an instance and are cheap to recreate.
+func (c *RealCache) MigrateLegacy() error {
+	err := c.migrateCombined(c.name, true)
+	if err != nil {
+		return err
+	}
+	return c.migrateCombined(legacyCacheName, false)
+}
+
+// migrateCombined splits a combined cache item into this cache's per category
+// items, filling gaps without replacing anything already stored, then removes
+// it. The session and inventory are only carried over from a namespaced item.
+func (c *RealCache) migrateCombined(name string, namespaced bool) error {
+	combined, err := c.keyring.Get(name)
+	if err != nil {
+		if err == keyring.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// unmarshal the combined data
+	var combinedData CacheData
+	if len(combined.Data) > 0 {
+		err = json.Unmarshal(combined.Data, &combinedData)
+		if err != nil {
+			return err
+		}
+	}
+
+	// carry over staks and selections not already stored
+	var staks map[string]kion.STAK
+	_, err = loadItem(c.keyring, c.name, CategoryStak, &staks)
+	if err != nil {
+		return err
+	}
+	if staks == nil {
+		staks = make(map[string]kion.STAK)
 	}
+	for key, stak := range combinedData.STAK {
+		if _, found := staks[key]; !found {
+			staks[key] = stak
+		}
+	}
+	err = storeItem(c.keyring, c.name, CategoryStak, staks)
+	if err != nil {
+		return err
+	}
+
+	var selections map[string]string
+	_, err = loadItem(c.keyring, c.name, CategorySelection, &selections)
+	if err != nil {
+		return err
+	}
+	if selections == nil {
+		selections = make(map[string]string)
+	}
+	for key, value := range combinedData.SELECTION {
+		if _, found := selections[key]; !found {
+			selections[key] = value
+		}
+	}
+	err = storeItem(c.keyring, c.name, CategorySelection, selections)
+	if err != nil {
+		return err
+	}
+
+	// carry over the session and inventory if there are none yet and they
+	// belong to this namespace
+	if namespaced && combinedData.SESSION != (kion.Session{}) {
+		_, found, err := getSession(c.keyring, c.name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			err = setSession(c.keyring, c.name, combinedData.SESSION)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if namespaced && !combinedData.INVENTORY.Empty() {
+		_, found, err := getInventory(c.keyring, c.name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			err = setInventory(c.keyring, c.name, combinedData.INVENTORY)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.keyring.Remove(name)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -47,11 +254,120 @@ func NewCache(keyring keyring.Keyring) *RealCache {
 // NullCache implements the Cache interface and does nothing.
 type NullCache struct {
 	keyring keyring.Keyring
+	name    string
 }
 
-// NewNullCache creates a new NullCache.
-func NewNullCache(keyring keyring.Keyring) *NullCache {
+// NewNullCache creates a new NullCache scoped to the given namespace.
+func NewNullCache(keyring keyring.Keyring, namespace string) *NullCache {
 	return &NullCache{
 		keyring: keyring,
+		name:    itemName(namespace),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DryRunCache implements the Cache interface by reading from a wrapped Cache
+// and reporting writes rather than performing them.
+type DryRunCache struct {
+	cache Cache
+	out   io.Writer
+}
+
+// NewDryRunCache creates a new DryRunCache that wraps the given Cache and
+// reports writes to out.
+func NewDryRunCache(cache Cache, out io.Writer) *DryRunCache {
+	return &DryRunCache{
+		cache: cache,
+		out:   out,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// TolerantCache implements the Cache interface by passing through to a wrapped
+// Cache, but treats writes that fail due to a read-only location as a warning
+// rather than an error so commands can continue uncached.
+type TolerantCache struct {
+	cache  Cache
+	out    io.Writer
+	warned bool
+}
+
+// NewTolerantCache creates a new TolerantCache that wraps the given Cache and
+// writes warnings to out.
+func NewTolerantCache(cache Cache, out io.Writer) *TolerantCache {
+	return &TolerantCache{
+		cache: cache,
+		out:   out,
+	}
+}
+
+// tolerate swallows read-only errors, warning once per run.
+func (c *TolerantCache) tolerate(err error) error {
+	if err == nil || !filesystem.IsReadOnly(err) {
+		return err
+	}
+	if !c.warned {
+		fmt.Fprintf(c.out, "Warning: unable to write to the cache, continuing without it: %v\n", err)
+		c.warned = true
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SelectiveCache implements the Cache interface by passing through to a
+// wrapped Cache, except for the categories disabled which are neither stored
+// nor served, such as when policy allows caching sessions but not STAKs.
+// Entries stored before a category was disabled are still listed, purged, and
+// flushed.
+type SelectiveCache struct {
+	cache    Cache
+	disabled map[string]bool
+}
+
+// NewSelectiveCache creates a new SelectiveCache that wraps the given Cache
+// with the given categories disabled.
+func NewSelectiveCache(cache Cache, disabled ...string) *SelectiveCache {
+	c := &SelectiveCache{
+		cache:    cache,
+		disabled: make(map[string]bool),
+	}
+	for _, category := range disabled {
+		c.disabled[category] = true
+	}
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// TimedCache implements the Cache interface by passing through to a wrapped
+// Cache, recording how long each call takes in kion.Timings for
+// --profile-perf.
+type TimedCache struct {
+	cache Cache
+}
+
+// NewTimedCache creates a new TimedCache that wraps the given Cache.
+func NewTimedCache(cache Cache) *TimedCache {
+	return &TimedCache{
+		cache: cache,
 	}
 }
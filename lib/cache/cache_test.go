@@ -0,0 +1,871 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		description string
+		url         string
+		username    string
+		profile     string
+		want        string
+	}{
+		{
+			"URL Only",
+			"https://kion.example",
+			"",
+			"",
+			"https://kion.example",
+		},
+		{
+			"With Username",
+			"https://kion.example",
+			"jdoe",
+			"",
+			"https://kion.example|jdoe",
+		},
+		{
+			"Normalized URL",
+			" HTTPS://Kion.Example/ ",
+			"jdoe",
+			"",
+			"https://kion.example|jdoe",
+		},
+		{
+			"With Profile",
+			"https://kion.example",
+			"",
+			"staging",
+			"https://kion.example#staging",
+		},
+		{
+			"With Username And Profile",
+			"https://kion.example",
+			"jdoe",
+			"staging",
+			"https://kion.example|jdoe#staging",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := Namespace(test.url, test.username, test.profile); got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	one := NewCache(ring, Namespace("https://one.example", "", ""))
+	two := NewCache(ring, Namespace("https://two.example", "", ""))
+
+	err := one.SetSession(kion.Session{UserName: "jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err := two.GetSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("session cached for one instance was served to another")
+	}
+}
+
+func TestScopeToSessionUser(t *testing.T) {
+	tests := []struct {
+		description string
+		first       string
+		second      string
+		wantShared  bool
+	}{
+		{"Same User", "jdoe", "jdoe", true},
+		{"Different Users", "jdoe", "asmith", false},
+		{"Unknown User", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			ring := keyring.NewArrayKeyring(nil)
+			newCache := func() *RealCache {
+				c := NewCache(ring, Namespace("https://kion.example", "", ""))
+				c.ScopeToSessionUser(func(user string) string {
+					return Namespace("https://kion.example", user, "")
+				})
+				return c
+			}
+			stak := kion.STAK{AccessKey: "AKIA", Expiration: time.Now().Add(time.Hour)}
+
+			// the first user signs in and caches keys
+			first := newCache()
+			err := first.SetSession(kion.Session{UserName: test.first})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = first.SetStak("Admin-111122223333", stak)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a later run signed in as the second user
+			second := newCache()
+			err = second.SetSession(kion.Session{UserName: test.second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, found, err := second.GetStak("Admin-111122223333")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != test.wantShared {
+				t.Errorf("got keys found %v, wanted %v", found, test.wantShared)
+			}
+
+			// a run reading the session from the cache sees the same keys
+			_, found, err = newCache().GetStak("Admin-111122223333")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != test.wantShared {
+				t.Errorf("got keys found %v from the cached session, wanted %v", found, test.wantShared)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Round(0)
+	legacy := CacheData{
+		STAK: map[string]kion.STAK{
+			"Admin-111111111111": {AccessKey: "legacy", Expiration: expiration},
+			"Dev-222222222222":   {AccessKey: "legacy", Expiration: expiration},
+		},
+		SESSION:   kion.Session{UserName: "jdoe"},
+		SELECTION: map[string]string{"favorite/sandbox": "12"},
+	}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := keyring.NewArrayKeyring([]keyring.Item{{Key: legacyCacheName, Data: data}})
+
+	c := NewCache(ring, Namespace("https://kion.example", "jdoe", ""))
+	err = c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "current", Expiration: expiration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.MigrateLegacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// legacy entries fill gaps without replacing current ones
+	stak, _, _ := c.GetStak("Admin-111111111111")
+	if stak.AccessKey != "current" {
+		t.Errorf("current STAK was replaced by %v", stak.AccessKey)
+	}
+	stak, found, _ := c.GetStak("Dev-222222222222")
+	if !found || stak.AccessKey != "legacy" {
+		t.Error("legacy STAK was not migrated")
+	}
+	selection, found, _ := c.GetSelection("favorite/sandbox")
+	if !found || selection != "12" {
+		t.Error("legacy selection was not migrated")
+	}
+
+	// sessions can't be attributed to an instance so are dropped
+	_, found, _ = c.GetSession()
+	if found {
+		t.Error("legacy session was migrated")
+	}
+
+	// the legacy entry is removed and migrating again is a no-op
+	_, err = ring.Get(legacyCacheName)
+	if err != keyring.ErrKeyNotFound {
+		t.Errorf("legacy cache was not removed: %v", err)
+	}
+	err = c.MigrateLegacy()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+
+	_, found, err := c.GetInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("found an inventory in an empty cache")
+	}
+
+	inventory := kion.Inventory{
+		Projects: []kion.Project{{ID: 1, Name: "Data"}},
+		CARs:     []kion.CAR{{Name: "Admin", AccountNumber: "111111111111", ProjectID: 1}},
+		Updated:  time.Now().UTC().Round(0),
+	}
+	err = c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "kept", Expiration: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetInventory(inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, found, err := c.GetInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !reflect.DeepEqual(got, inventory) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, inventory)
+	}
+	stak, _, err := c.GetStak("Admin-111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stak.AccessKey != "kept" {
+		t.Error("storing the inventory dropped a cached STAK")
+	}
+}
+
+func TestMigrateCombined(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Round(0)
+	namespace := Namespace("https://kion.example", "jdoe", "")
+	combined := CacheData{
+		STAK:      map[string]kion.STAK{"Admin-111111111111": {AccessKey: "combined", Expiration: expiration}},
+		SESSION:   kion.Session{UserName: "jdoe"},
+		SELECTION: map[string]string{"favorite/sandbox": "12"},
+		INVENTORY: kion.Inventory{CARs: []kion.CAR{{Name: "Admin", AccountNumber: "111111111111"}}},
+	}
+	data, err := json.Marshal(combined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := keyring.NewArrayKeyring([]keyring.Item{{Key: itemName(namespace), Data: data}})
+
+	c := NewCache(ring, namespace)
+	err = c.MigrateLegacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// everything in a namespaced item is carried over, including the session
+	stak, found, _ := c.GetStak("Admin-111111111111")
+	if !found || stak.AccessKey != "combined" {
+		t.Error("combined STAK was not migrated")
+	}
+	selection, found, _ := c.GetSelection("favorite/sandbox")
+	if !found || selection != "12" {
+		t.Error("combined selection was not migrated")
+	}
+	session, found, _ := c.GetSession()
+	if !found || session.UserName != "jdoe" {
+		t.Error("combined session was not migrated")
+	}
+	_, found, _ = c.GetInventory()
+	if !found {
+		t.Error("combined inventory was not migrated")
+	}
+
+	_, err = ring.Get(itemName(namespace))
+	if err != keyring.ErrKeyNotFound {
+		t.Errorf("combined cache was not removed: %v", err)
+	}
+}
+
+func TestFlushCache(t *testing.T) {
+	tests := []struct {
+		description string
+		categories  []string
+		wantSession bool
+		wantStak    bool
+		wantErr     bool
+	}{
+		{"All", nil, false, false, false},
+		{"STAKs Only", []string{CategoryStak}, true, false, false},
+		{"Session Only", []string{CategorySession}, false, true, false},
+		{"Unknown", []string{"staks"}, true, true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			c := NewCache(keyring.NewArrayKeyring(nil), Namespace("https://kion.example", "", ""))
+			err := c.SetSession(kion.Session{UserName: "jdoe"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "kept", Expiration: time.Now().Add(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.FlushCache(test.categories...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted an error: %v", err, test.wantErr)
+			}
+			_, foundSession, _ := c.GetSession()
+			_, foundStak, _ := c.GetStak("Admin-111111111111")
+			if foundSession != test.wantSession || foundStak != test.wantStak {
+				t.Errorf("got session %v and stak %v, wanted %v and %v", foundSession, foundStak, test.wantSession, test.wantStak)
+			}
+		})
+	}
+}
+
+func TestPruneExpiredStaks(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+	err := storeItem(ring, c.name, CategoryStak, map[string]kion.STAK{
+		"Admin-111111111111": {AccessKey: "expired", Expiration: time.Now().Add(-time.Minute)},
+		"Dev-222222222222":   {AccessKey: "valid", Expiration: time.Now().Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// expired staks are never served and are dropped once read
+	_, found, err := c.GetStak("Admin-111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("an expired STAK was served")
+	}
+	var staks map[string]kion.STAK
+	_, err = loadItem(ring, c.name, CategoryStak, &staks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staks) != 1 || staks["Dev-222222222222"].AccessKey != "valid" {
+		t.Errorf("got stored staks %v, wanted only the valid one", staks)
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	now := time.Now()
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+	err := storeItem(ring, c.name, CategoryStak, map[string]kion.STAK{
+		"Admin-111111111111": {AccessKey: "expired", Expiration: now.Add(-time.Minute)},
+		"Dev-222222222222":   {AccessKey: "valid", Expiration: now.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := kion.Session{UserName: "jdoe"}
+	session.Access.Expiry = now.Add(-time.Minute).Format(time.RFC3339)
+	err = c.SetSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetSelection("favorite/sandbox", "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.ListCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, entry := range entries {
+		listed = append(listed, entry.Category+" "+entry.Key)
+	}
+	want := []string{"stak Admin-111111111111", "stak Dev-222222222222", "session jdoe", "selection favorite/sandbox"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", listed, want)
+	}
+
+	purged, err := c.PurgeCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 2 {
+		t.Errorf("got purged %v, wanted the expired STAK and session", purged)
+	}
+	entries, err = c.ListCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed = nil
+	for _, entry := range entries {
+		listed = append(listed, entry.Category+" "+entry.Key)
+	}
+	want = []string{"stak Dev-222222222222", "selection favorite/sandbox"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", listed, want)
+	}
+}
+
+func TestFileKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileCacheName)
+	ring := NewFileKeyring(path, keyring.FixedStringPrompt("correct horse"), "v1.0.0", nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+	err := c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "AKIDSECRET", Expiration: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is readable at rest
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "AKIDSECRET") || strings.Contains(string(raw), "kion.example") {
+		t.Error("the file cache holds plain text")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, wanted 0600", info.Mode().Perm())
+	}
+
+	// a new run with the passphrase reads it back
+	ring = NewFileKeyring(path, keyring.FixedStringPrompt("correct horse"), "v1.0.0", nil)
+	stak, found, err := NewCache(ring, Namespace("https://kion.example", "", "")).GetStak("Admin-111111111111")
+	if err != nil || !found || stak.AccessKey != "AKIDSECRET" {
+		t.Errorf("got stak %v, found %v, and error %v, wanted the cached stak", stak, found, err)
+	}
+
+	// any other passphrase can't
+	ring = NewFileKeyring(path, keyring.FixedStringPrompt("battery staple"), "v1.0.0", nil)
+	_, _, err = NewCache(ring, Namespace("https://kion.example", "", "")).GetStak("Admin-111111111111")
+	if err == nil {
+		t.Error("read the file cache with the wrong passphrase")
+	}
+
+	// nor can an empty one, and the passphrase is only asked for once needed
+	var asked bool
+	ring = NewFileKeyring(path, func(string) (string, error) { asked = true; return "", nil }, "v1.0.0", nil)
+	if asked {
+		t.Error("asked for the passphrase before the file cache was used")
+	}
+	_, err = ring.Keys()
+	if err == nil || !asked {
+		t.Errorf("got %v having asked %v, wanted the file cache refused without a passphrase", err, asked)
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+
+	// the first version to use a cache marks it
+	err := c.CheckFormat("v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marker formatMarker
+	_, err = loadItem(ring, c.name, formatItem, &marker)
+	if err != nil || marker.Format != FormatVersion || marker.Version != "v1.0.0" {
+		t.Errorf("got marker %+v and error %v, wanted format %v by v1.0.0", marker, err, FormatVersion)
+	}
+
+	// flushing never removes the marker
+	err = c.FlushCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadItem(ring, c.name, formatItem, &marker)
+	if err != nil || marker.Format != FormatVersion {
+		t.Errorf("flushing the cache removed the format marker: %+v %v", marker, err)
+	}
+
+	// a newer format is refused and left alone
+	err = storeItem(ring, c.name, formatItem, formatMarker{Format: FormatVersion + 1, Version: "v9.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.CheckFormat("v1.0.0")
+	var newer *NewerFormatError
+	if !errors.As(err, &newer) || newer.Version != "v9.0.0" {
+		t.Errorf("got error %v, wanted a newer format error naming v9.0.0", err)
+	}
+	_, err = loadItem(ring, c.name, formatItem, &marker)
+	if err != nil || marker.Version != "v9.0.0" {
+		t.Errorf("the newer format marker was replaced: %+v %v", marker, err)
+	}
+}
+
+func TestPurgeKeepsRefreshableSession(t *testing.T) {
+	now := time.Now()
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+	session := kion.Session{UserName: "jdoe"}
+	session.Access.Expiry = now.Add(-time.Minute).Format(time.RFC3339)
+	session.Refresh.Token = "refresh"
+	session.Refresh.Expiry = now.Add(time.Hour).Format(time.RFC3339)
+	err := c.SetSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := c.PurgeCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 0 {
+		t.Errorf("got purged %v, wanted the refreshable session kept", purged)
+	}
+	_, found, _ := c.GetSession()
+	if !found {
+		t.Error("the refreshable session was removed")
+	}
+}
+
+func TestSelectiveCache(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	wrapped := NewCache(ring, Namespace("https://kion.example", "", ""))
+	expiration := time.Now().Add(time.Hour).Round(0)
+
+	// a STAK cached before STAKs were turned off is ignored but still listed
+	err := wrapped.SetStak("Admin-111111111111", kion.STAK{AccessKey: "old", Expiration: expiration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSelectiveCache(wrapped, CategoryStak)
+
+	_, found, err := c.GetStak("Admin-111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("served a STAK with STAKs not cached")
+	}
+	err = c.SetStak("Admin-222222222222", kion.STAK{AccessKey: "new", Expiration: expiration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err = wrapped.GetStak("Admin-222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("stored a STAK with STAKs not cached")
+	}
+	entries, err := c.ListCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "Admin-111111111111" {
+		t.Errorf("got entries %+v, wanted the STAK cached before", entries)
+	}
+
+	// sessions are still cached
+	session := kion.Session{UserName: "jdoe"}
+	session.Access.Token = "session"
+	err = c.SetSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := wrapped.GetSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || got != session {
+		t.Errorf("got session %+v, wanted %+v", got, session)
+	}
+}
+
+func TestTimedCache(t *testing.T) {
+	kion.Timings = kion.NewTimingRecorder(time.Now())
+	defer func() { kion.Timings = nil }()
+	c := NewTimedCache(NewCache(keyring.NewArrayKeyring(nil), Namespace("https://kion.example", "", "")))
+
+	err := c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "AKIA", Expiration: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stak, found, err := c.GetStak("Admin-111111111111")
+	if err != nil || !found || stak.AccessKey != "AKIA" {
+		t.Fatalf("got %+v %v %v, wanted the STAK stored", stak, found, err)
+	}
+	_, _, err = c.GetSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breakdown := kion.Timings.Breakdown(time.Now())
+	if len(breakdown.Phases) != 1 || breakdown.Phases[0].Phase != kion.PhaseCache || breakdown.Phases[0].Calls != 3 {
+		t.Errorf("got phases %+v, wanted 3 cache calls", breakdown.Phases)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	now := time.Now()
+	source := NewCache(keyring.NewArrayKeyring(nil), Namespace("https://kion.example", "", ""))
+	session := kion.Session{UserName: "jdoe"}
+	session.Access.Token = "access"
+	session.Access.Expiry = now.Add(time.Hour).Format(time.RFC3339)
+	err := source.SetSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = source.SetStak("Admin-111111111111", kion.STAK{AccessKey: "AKIDSECRET", Expiration: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := ExportBundle(source, "https://kion.example", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Session.Access.Token != "access" || len(bundle.STAKs) != 1 {
+		t.Fatalf("got bundle %+v, wanted the session and one stak", bundle)
+	}
+
+	// sealed bundles hold no plain text and need the passphrase
+	sealed, err := SealBundle(bundle, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), "AKIDSECRET") || strings.Contains(string(sealed), "kion.example") {
+		t.Error("the sealed bundle holds plain text")
+	}
+	_, err = OpenBundle(sealed, "battery staple")
+	if err == nil {
+		t.Error("opened the bundle with the wrong passphrase")
+	}
+	_, err = OpenBundle([]byte(`{"version":1,"salt":"","nonce":"","data":""}`), "correct horse")
+	if err == nil || !strings.Contains(err.Error(), "not a Kion CLI cache bundle") {
+		t.Errorf("got error %v, wanted a file cache refused as a bundle", err)
+	}
+	_, err = SealBundle(bundle, "")
+	if err == nil {
+		t.Error("sealed a bundle without a passphrase")
+	}
+	opened, err := OpenBundle(sealed, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// importing stores the session and staks under the target's namespace
+	target := NewCache(keyring.NewArrayKeyring(nil), Namespace("https://kion.example", "", ""))
+	imported, err := ImportBundle(target, opened, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != (BundleImport{Session: true, STAKs: 1}) {
+		t.Errorf("got import %+v, wanted the session and one stak", imported)
+	}
+	got, found, err := target.GetSession()
+	if err != nil || !found || got != session {
+		t.Errorf("got session %+v, found %v, and error %v, wanted the exported session", got, found, err)
+	}
+	stak, found, err := target.GetStak("Admin-111111111111")
+	if err != nil || !found || stak.AccessKey != "AKIDSECRET" {
+		t.Errorf("got stak %v, found %v, and error %v, wanted the exported stak", stak, found, err)
+	}
+}
+
+func TestImportBundleSkipsExpired(t *testing.T) {
+	now := time.Now()
+	session := kion.Session{UserName: "jdoe"}
+	session.Access.Token = "access"
+	session.Access.Expiry = now.Add(time.Minute).Format(time.RFC3339)
+	bundle := Bundle{
+		KionURL: "https://kion.example",
+		Session: session,
+		STAKs: map[string]kion.STAK{
+			"Admin-111111111111":    {AccessKey: "AKIDLIVE", Expiration: now.Add(2 * time.Hour)},
+			"ReadOnly-111111111111": {AccessKey: "AKIDSOON", Expiration: now.Add(30 * time.Minute)},
+		},
+	}
+
+	// carried over an hour later, only what is still valid is imported
+	later := now.Add(time.Hour)
+	c := NewCache(keyring.NewArrayKeyring(nil), Namespace("https://kion.example", "", ""))
+	imported, err := ImportBundle(c, bundle, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BundleImport{SessionExpired: true, STAKs: 1, STAKsExpired: 1}
+	if imported != want {
+		t.Errorf("got import %+v, wanted %+v", imported, want)
+	}
+	_, found, _ := c.GetSession()
+	if found {
+		t.Error("imported an expired session")
+	}
+
+	// a refreshable session outlives its access token
+	bundle.Session.Refresh.Token = "refresh"
+	bundle.Session.Refresh.Expiry = now.Add(12 * time.Hour).Format(time.RFC3339)
+	imported, err = ImportBundle(c, bundle, later)
+	if err != nil || !imported.Session {
+		t.Errorf("got import %+v and error %v, wanted the refreshable session imported", imported, err)
+	}
+}
+
+func TestSameInstance(t *testing.T) {
+	tests := []struct {
+		description string
+		a           string
+		b           string
+		want        bool
+	}{
+		{"Same", "https://kion.example", "https://kion.example", true},
+		{"Normalized", "https://kion.example/", " HTTPS://Kion.Example", true},
+		{"Different", "https://kion.example", "https://kion.other", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := SameInstance(test.a, test.b); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChunkedKeyring(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	chunked := NewChunkedKeyring(ring, 64)
+
+	tests := []struct {
+		description string
+		size        int
+		wantEntries int
+	}{
+		{"Fits", 64, 1},
+		{"Split", 200, 5},
+		{"Shrunk", 100, 3},
+		{"Fits Again", 10, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			data := []byte(strings.Repeat("abcdefghij", test.size/10+1)[:test.size])
+			err := chunked.Set(keyring.Item{Key: "cache", Label: "cache", Data: data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			item, err := chunked.Get("cache")
+			if err != nil || string(item.Data) != string(data) {
+				t.Errorf("got %q and error %v, wanted %q", item.Data, err, data)
+			}
+
+			// every entry fits and none are left over from a larger item
+			entries, _ := ring.Keys()
+			if len(entries) != test.wantEntries {
+				t.Errorf("got entries %v, wanted %v", entries, test.wantEntries)
+			}
+			for _, key := range entries {
+				entry, _ := ring.Get(key)
+				if len(entry.Data) > 64 {
+					t.Errorf("got %v bytes in %v", len(entry.Data), key)
+				}
+			}
+			if keys, _ := chunked.Keys(); len(keys) != 1 || keys[0] != "cache" {
+				t.Errorf("got keys %v", keys)
+			}
+		})
+	}
+
+	// removing an item removes all its entries
+	err := chunked.Set(keyring.Item{Key: "cache", Data: []byte(strings.Repeat("x", 200))})
+	if err == nil {
+		err = chunked.Remove("cache")
+	}
+	if entries, _ := ring.Keys(); err != nil || len(entries) != 0 {
+		t.Errorf("got entries %v and error %v after removing", entries, err)
+	}
+
+	// an item missing a part is not found
+	_ = chunked.Set(keyring.Item{Key: "cache", Data: []byte(strings.Repeat("x", 200))})
+	_ = ring.Remove(partKey("cache", 3))
+	if _, err := chunked.Get("cache"); !errors.Is(err, keyring.ErrKeyNotFound) {
+		t.Errorf("got %v for an item missing a part", err)
+	}
+}
+
+func TestDryRunCacheLeavesWrappedCache(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	c := NewCache(ring, Namespace("https://kion.example", "", ""))
+	err := c.SetSession(kion.Session{UserName: "jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetStak("Admin-111111111111", kion.STAK{AccessKey: "kept", Expiration: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetStak("Admin-222222222222", kion.STAK{AccessKey: "expired", Expiration: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := func() map[string]string {
+		keys, err := ring.Keys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := make(map[string]string, len(keys))
+		for _, key := range keys {
+			item, err := ring.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items[key] = string(item.Data)
+		}
+		return items
+	}
+	before := snapshot()
+
+	var out strings.Builder
+	dry := NewDryRunCache(c, &out)
+	writes := []struct {
+		description string
+		write       func() error
+	}{
+		{"Stak", func() error {
+			return dry.SetStak("Admin-333333333333", kion.STAK{AccessKey: "new", Expiration: time.Now().Add(time.Hour)})
+		}},
+		{"Session", func() error { return dry.SetSession(kion.Session{UserName: "other"}) }},
+		{"Selection", func() error { return dry.SetSelection("account", "111111111111") }},
+		{"Inventory", func() error { return dry.SetInventory(kion.Inventory{Updated: time.Now()}) }},
+		{"SAML Metadata", func() error {
+			return dry.SetSAMLMetadata("https://idp.example/metadata", kion.CachedSAMLMetadata{})
+		}},
+		{"Flush", func() error { return dry.FlushCache() }},
+		{"Purge", func() error {
+			_, err := dry.PurgeCache()
+			return err
+		}},
+	}
+
+	for _, test := range writes {
+		t.Run(test.description, func(t *testing.T) {
+			out.Reset()
+			if err := test.write(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), "[dry-run]") {
+				t.Errorf("write was not reported, got %q", out.String())
+			}
+			if after := snapshot(); !reflect.DeepEqual(after, before) {
+				t.Errorf("wrapped cache changed\ngot:\n  %v\nwanted:\n  %v", after, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/99designs/keyring"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Chunked Keyring                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// WinCredMaxSize is the most Windows Credential Manager holds in one entry,
+// far less than the inventory or a few short term access keys take.
+const WinCredMaxSize = 2560
+
+// chunkHeader starts the first entry of an item split into several, followed
+// by how many entries it was split into and a newline.
+const chunkHeader = "kion-cli-chunks:"
+
+// chunkPart matches the keys of the entries after the first of a split item.
+var chunkPart = regexp.MustCompile(` \(part \d+\)$`)
+
+// FitKeyring returns ring wrapped so items fit in the entries of backend,
+// splitting them across several entries of Windows Credential Manager. Other
+// backends hold items of any size so ring is returned as is.
+func FitKeyring(ring keyring.Keyring, backend keyring.BackendType) keyring.Keyring {
+	if backend != keyring.WinCredBackend {
+		return ring
+	}
+	return NewChunkedKeyring(ring, WinCredMaxSize)
+}
+
+// NewChunkedKeyring returns a keyring storing items larger than limit bytes in
+// ring as several entries of at most limit bytes each.
+func NewChunkedKeyring(ring keyring.Keyring, limit int) keyring.Keyring {
+	return &chunkedKeyring{ring: ring, limit: limit}
+}
+
+// chunkedKeyring implements keyring.Keyring over a keyring with small entries.
+// A split item's first entry, under its own key, holds the header and the
+// first chunk, the rest are stored under the key followed by their part.
+type chunkedKeyring struct {
+	ring  keyring.Keyring
+	limit int
+}
+
+// partKey returns the key of the nth entry of a split item.
+func partKey(key string, n int) string {
+	return fmt.Sprintf("%v (part %v)", key, n)
+}
+
+// parts returns how many entries the item stored in first was split into,
+// and its first chunk.
+func parts(first []byte) (int, []byte) {
+	rest, found := bytes.CutPrefix(first, []byte(chunkHeader))
+	if !found {
+		return 1, first
+	}
+	count, chunk, found := bytes.Cut(rest, []byte("\n"))
+	n, err := strconv.Atoi(string(count))
+	if !found || err != nil || n < 1 {
+		return 1, first
+	}
+	return n, chunk
+}
+
+// Get returns the item matching key, reassembled from its entries, or
+// keyring.ErrKeyNotFound. An item missing any of its entries is not found.
+func (k *chunkedKeyring) Get(key string) (keyring.Item, error) {
+	item, err := k.ring.Get(key)
+	if err != nil {
+		return item, err
+	}
+	n, chunk := parts(item.Data)
+	if n == 1 {
+		return item, nil
+	}
+	data := append([]byte{}, chunk...)
+	for i := 2; i <= n; i++ {
+		part, err := k.ring.Get(partKey(key, i))
+		if err != nil {
+			return keyring.Item{}, err
+		}
+		data = append(data, part.Data...)
+	}
+	item.Data = data
+	return item, nil
+}
+
+// GetMetadata returns the metadata of the first entry of the item matching
+// key.
+func (k *chunkedKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	return k.ring.GetMetadata(key)
+}
+
+// Set stores an item, split across entries when too large for one, and
+// removes any entries left over from a larger item with the same key.
+func (k *chunkedKeyring) Set(item keyring.Item) error {
+	previous := 1
+	if stored, err := k.ring.Get(item.Key); err == nil {
+		previous, _ = parts(stored.Data)
+	}
+
+	n := 1
+	if len(item.Data) > k.limit {
+		// leave room in the first entry for the header
+		size := k.limit - len(chunkHeader) - 8
+		var chunks [][]byte
+		for data := item.Data; len(data) > 0; {
+			end := min(size, len(data))
+			chunks = append(chunks, data[:end])
+			data = data[end:]
+		}
+		n = len(chunks)
+
+		// write the rest first so the first entry never names missing parts
+		for i := n; i >= 2; i-- {
+			part := item
+			part.Key, part.Label, part.Data = partKey(item.Key, i), partKey(item.Label, i), chunks[i-1]
+			err := k.ring.Set(part)
+			if err != nil {
+				return err
+			}
+		}
+		item.Data = append([]byte(fmt.Sprintf("%v%v\n", chunkHeader, n)), chunks[0]...)
+	}
+	err := k.ring.Set(item)
+	if err != nil {
+		return err
+	}
+	return k.removeParts(item.Key, n+1, previous)
+}
+
+// Remove removes the item matching key and all its entries, or returns
+// keyring.ErrKeyNotFound.
+func (k *chunkedKeyring) Remove(key string) error {
+	stored, err := k.ring.Get(key)
+	if err != nil {
+		return err
+	}
+	n, _ := parts(stored.Data)
+	err = k.ring.Remove(key)
+	if err != nil {
+		return err
+	}
+	return k.removeParts(key, 2, n)
+}
+
+// removeParts removes the entries holding parts from through to of a split
+// item, skipping those already gone.
+func (k *chunkedKeyring) removeParts(key string, from int, to int) error {
+	for i := from; i <= to; i++ {
+		err := k.ring.Remove(partKey(key, i))
+		if err != nil && err != keyring.ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys of every item, leaving out the entries holding the
+// later parts of split items.
+func (k *chunkedKeyring) Keys() ([]string, error) {
+	keys, err := k.ring.Keys()
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for _, key := range keys {
+		if !chunkPart.MatchString(key) {
+			items = append(items, key)
+		}
+	}
+	return items, nil
+}
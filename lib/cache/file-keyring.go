@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/filesystem"
+	"golang.org/x/crypto/scrypt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  File Keyring                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FileCacheName is the name of the file cache within its directory.
+const FileCacheName = "cache.enc"
+
+// File cache lock timings, writes take milliseconds so a lock held for long
+// was left behind.
+const (
+	fileCacheLockWait  = 10 * time.Second
+	fileCacheLockStale = 30 * time.Second
+)
+
+// NewFileKeyring returns a keyring kept in a single file encrypted with a
+// passphrase, for CI runners and minimal containers with no system keychain.
+// Any Cache can be backed by it. The passphrase is asked for the first time
+// the file is read or written. Writes are serialized with a lock file naming
+// the version holding it, and waiting on a different version is warned about
+// to out.
+func NewFileKeyring(path string, passphrase keyring.PromptFunc, version string, out io.Writer) keyring.Keyring {
+	return &encryptedFile{path: path, prompt: passphrase, version: version, out: out}
+}
+
+// scrypt parameters used to derive the file cache key from its passphrase.
+const (
+	fileCacheScryptN = 1 << 15
+	fileCacheScryptR = 8
+	fileCacheScryptP = 1
+	fileCacheKeyLen  = 32
+)
+
+// encryptedFileData is the layout of the file cache on disk. Data holds the
+// keyring items sealed with AES-GCM under a key derived from the passphrase
+// and Salt.
+type encryptedFileData struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// encryptedFile implements keyring.Keyring over a single encrypted file. The
+// key is derived once per run as doing so is deliberately slow. Writes
+// replace the whole file so are made under a lock.
+type encryptedFile struct {
+	path       string
+	prompt     keyring.PromptFunc
+	passphrase string
+	version    string
+	out        io.Writer
+	salt       []byte
+	key        []byte
+}
+
+// update applies fn to the items in the file and writes them back, holding
+// the lock throughout so concurrent runs never lose each other's writes.
+func (f *encryptedFile) update(fn func(items map[string]keyring.Item) error) error {
+	err := os.MkdirAll(filepath.Dir(f.path), 0700)
+	if err != nil {
+		return err
+	}
+	holder := filesystem.LockHolder{PID: os.Getpid(), Version: f.version, Acquired: time.Now()}
+	lock, err := filesystem.AcquireLock(f.path+".lock", holder, fileCacheLockWait, fileCacheLockStale, func(other filesystem.LockHolder) {
+		if other.Version != f.version && f.out != nil {
+			fmt.Fprintf(f.out, "Warning: kion-cli %v (pid %v) is also using the cache, running different versions at once may behave unexpectedly\n", other.Version, other.PID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	items, err := f.load()
+	if err != nil {
+		return err
+	}
+	err = fn(items)
+	if err != nil {
+		return err
+	}
+	return f.save(items)
+}
+
+// deriveKey derives the encryption key for salt, reusing the last one if the
+// salt is unchanged.
+func (f *encryptedFile) deriveKey(salt []byte) ([]byte, error) {
+	if f.key != nil && string(f.salt) == string(salt) {
+		return f.key, nil
+	}
+	if f.passphrase == "" {
+		passphrase, err := f.prompt("Passphrase for the Kion CLI cache")
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, errors.New("a passphrase is required to encrypt the file cache")
+		}
+		f.passphrase = passphrase
+	}
+	key, err := scrypt.Key([]byte(f.passphrase), salt, fileCacheScryptN, fileCacheScryptR, fileCacheScryptP, fileCacheKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	f.salt, f.key = salt, key
+	return key, nil
+}
+
+// load reads and decrypts every item in the file, none if it doesn't exist
+// yet.
+func (f *encryptedFile) load() (map[string]keyring.Item, error) {
+	items := make(map[string]keyring.Item)
+	raw, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data encryptedFileData
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the file cache %v: %w", f.path, err)
+	}
+	key, err := f.deriveKey(data.Salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, data.Nonce, data.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the file cache %v, check the passphrase", f.path)
+	}
+	err = json.Unmarshal(plain, &items)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the file cache %v: %w", f.path, err)
+	}
+	return items, nil
+}
+
+// save encrypts and writes every item to the file, replacing it atomically.
+func (f *encryptedFile) save(items map[string]keyring.Item) error {
+	plain, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	salt := f.salt
+	if salt == nil {
+		salt = make([]byte, 16)
+		_, err = rand.Read(salt)
+		if err != nil {
+			return err
+		}
+	}
+	key, err := f.deriveKey(salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(encryptedFileData{
+		Version: 1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file and rename so a partial write never corrupts it
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".kion-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// newGCM returns an AES-GCM cipher for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get returns the item matching key or keyring.ErrKeyNotFound.
+func (f *encryptedFile) Get(key string) (keyring.Item, error) {
+	items, err := f.load()
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	item, found := items[key]
+	if !found {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	}
+	return item, nil
+}
+
+// GetMetadata is not supported as nothing can be read without decrypting.
+func (f *encryptedFile) GetMetadata(key string) (keyring.Metadata, error) {
+	return keyring.Metadata{}, keyring.ErrMetadataNotSupported
+}
+
+// Set stores an item, replacing any with the same key.
+func (f *encryptedFile) Set(item keyring.Item) error {
+	return f.update(func(items map[string]keyring.Item) error {
+		items[item.Key] = item
+		return nil
+	})
+}
+
+// Remove removes the item matching key or returns keyring.ErrKeyNotFound.
+func (f *encryptedFile) Remove(key string) error {
+	return f.update(func(items map[string]keyring.Item) error {
+		if _, found := items[key]; !found {
+			return keyring.ErrKeyNotFound
+		}
+		delete(items, key)
+		return nil
+	})
+}
+
+// Keys returns the keys of every item, sorted.
+func (f *encryptedFile) Keys() ([]string, error) {
+	items, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatVersion is the layout of the cache written by this version, bumped
+// whenever an older version would misread or clobber what is written:
+//
+//  1. every category in a single item
+//  2. each category in its own item
+const FormatVersion = 2
+
+// formatItem is the keyring item suffix of the cache's format marker. It is
+// not a category so it is never flushed or listed.
+const formatItem = "format"
+
+// formatMarker records the newest format written to a cache and by which
+// version, the handshake between versions sharing a cache.
+type formatMarker struct {
+	Format  int       `json:"format"`
+	Version string    `json:"version"`
+	Updated time.Time `json:"updated"`
+}
+
+// NewerFormatError is returned when a cache was written by a version using a
+// newer format than this one understands.
+type NewerFormatError struct {
+	Format  int
+	Version string
+}
+
+func (e *NewerFormatError) Error() string {
+	return fmt.Sprintf("the cache was written by kion-cli %v in a newer format (%v) than this version understands (%v), upgrade kion-cli or run with --disable-cache", e.Version, e.Format, FormatVersion)
+}
+
+// CheckFormat is the handshake run before using the cache. A cache written in
+// a newer format is refused with a NewerFormatError rather than risk
+// corrupting it, otherwise the marker is updated to this version.
+func (c *RealCache) CheckFormat(version string) error {
+	var marker formatMarker
+	_, err := loadItem(c.keyring, c.name, formatItem, &marker)
+	if err != nil {
+		return err
+	}
+	if marker.Format > FormatVersion {
+		return &NewerFormatError{Format: marker.Format, Version: marker.Version}
+	}
+	if c.readOnly || (marker.Format == FormatVersion && marker.Version == version) {
+		return nil
+	}
+	return storeItem(c.keyring, c.name, formatItem, formatMarker{
+		Format:  FormatVersion,
+		Version: version,
+		Updated: time.Now(),
+	})
+}
@@ -2,33 +2,119 @@ package cache
 
 import (
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
 )
 
-// flushCache clears the Kion CLI cache.
-func flushCache(k keyring.Keyring) error {
-	// marshal an empty cache to json
-	var cacheData CacheData
-	data, err := json.Marshal(cacheData)
+// Cache categories, each stored in its own keyring item so writing one never
+// rewrites, races with, or flushes another.
+const (
+	CategoryStak      = "stak"
+	CategorySession   = "session"
+	CategorySelection = "selection"
+	CategoryInventory = "inventory"
+	CategoryMetadata  = "metadata"
+)
+
+// Categories lists every cache category.
+var Categories = []string{CategoryStak, CategorySession, CategorySelection, CategoryInventory, CategoryMetadata}
+
+// traceLookup logs whether looking up key in a category of the cache found
+// anything, the key left out for categories holding a single entry.
+func traceLookup(category string, key string, found bool) {
+	message := "cache miss"
+	if found {
+		message = "cache hit"
+	}
+	if key == "" {
+		kion.Log.Info(message, "category", category)
+		return
+	}
+	kion.Log.Info(message, "category", category, "key", key)
+}
+
+// categoryItem returns the keyring item name holding a category of a cache.
+func categoryItem(cacheName string, category string) string {
+	return fmt.Sprintf("%v %v", cacheName, category)
+}
+
+// loadItem unmarshals a category of the cache into value, returning false if
+// nothing has been stored for it yet.
+func loadItem(k keyring.Keyring, cacheName string, category string, value interface{}) (bool, error) {
+	cache, err := k.Get(categoryItem(cacheName, category))
+	if err != nil {
+		if err == keyring.ErrKeyNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(cache.Data) == 0 {
+		return false, nil
+	}
+	err = json.Unmarshal(cache.Data, value)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// storeItem marshals value and stores it as a category of the cache.
+func storeItem(k keyring.Keyring, cacheName string, category string, value interface{}) error {
+	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 
 	// build the keyring item
-	cacheName := "Kion-CLI Cache"
+	name := categoryItem(cacheName, category)
 	cache := keyring.Item{
-		Key:         cacheName,
+		Key:         name,
 		Data:        data,
-		Label:       cacheName,
-		Description: "Cache data for the Kion-CLI.",
+		Label:       name,
+		Description: fmt.Sprintf("Cache data for the Kion-CLI (%v).", category),
 	}
 
 	// store the cache
-	err = k.Set(cache)
+	return k.Set(cache)
+}
+
+// checkCategories returns an error naming any unknown cache categories.
+func checkCategories(categories []string) error {
+	for _, category := range categories {
+		if !slices.Contains(Categories, category) {
+			return fmt.Errorf("unknown cache category %q, expected one of %v", category, strings.Join(Categories, ", "))
+		}
+	}
+	return nil
+}
+
+// flushCache clears the given categories of the Kion CLI cache, or all of
+// them if none are given.
+func flushCache(k keyring.Keyring, cacheName string, categories []string) error {
+	err := checkCategories(categories)
 	if err != nil {
 		return err
 	}
+	if len(categories) == 0 {
+		categories = Categories
+	}
+
+	// store an empty item for each category
+	for _, category := range categories {
+		name := categoryItem(cacheName, category)
+		err = k.Set(keyring.Item{
+			Key:         name,
+			Label:       name,
+			Description: fmt.Sprintf("Cache data for the Kion-CLI (%v).", category),
+		})
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -40,8 +126,14 @@ func flushCache(k keyring.Keyring) error {
 ////////////////////////////////////////////////////////////////////////////////
 
 // FLushCache implements the FlushCache interface for RealCache.
-func (c *RealCache) FlushCache() error {
-	return flushCache(c.keyring)
+func (c *RealCache) FlushCache(categories ...string) error {
+	for _, name := range c.names() {
+		err := flushCache(c.keyring, name, categories)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -51,6 +143,61 @@ func (c *RealCache) FlushCache() error {
 ////////////////////////////////////////////////////////////////////////////////
 
 // FLushCache implements the FlushCache interface for NullCache.
-func (c *NullCache) FlushCache() error {
-	return flushCache(c.keyring)
+func (c *NullCache) FlushCache(categories ...string) error {
+	return flushCache(c.keyring, c.name, categories)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FlushCache reports that the cache would have been flushed.
+func (c *DryRunCache) FlushCache(categories ...string) error {
+	err := checkCategories(categories)
+	if err != nil {
+		return err
+	}
+	if len(categories) > 0 {
+		fmt.Fprintf(c.out, "[dry-run] would flush the %v entries of the Kion CLI cache\n", strings.Join(categories, ", "))
+		return nil
+	}
+	fmt.Fprintln(c.out, "[dry-run] would flush the Kion CLI cache")
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FlushCache flushes the wrapped cache.
+func (c *TolerantCache) FlushCache(categories ...string) error {
+	return c.tolerate(c.cache.FlushCache(categories...))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FlushCache flushes the wrapped cache, including categories no longer cached
+// so entries stored before they were disabled can be removed.
+func (c *SelectiveCache) FlushCache(categories ...string) error {
+	return c.cache.FlushCache(categories...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FlushCache flushes the wrapped cache.
+func (c *TimedCache) FlushCache(categories ...string) error {
+	defer kion.Timings.Time(kion.PhaseCache, "flush")()
+	return c.cache.FlushCache(categories...)
 }
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+// setInventory is a common func for Cache implementations and stores the
+// inventory of projects and cloud access roles in the cache.
+func setInventory(k keyring.Keyring, cacheName string, inventory kion.Inventory) error {
+	return storeItem(k, cacheName, CategoryInventory, inventory)
+}
+
+// getInventory is a common func for Cache implementations and retrieves the
+// inventory of projects and cloud access roles from the cache.
+func getInventory(k keyring.Keyring, cacheName string) (kion.Inventory, bool, error) {
+	var inventory kion.Inventory
+	_, err := loadItem(k, cacheName, CategoryInventory, &inventory)
+	if err != nil {
+		return kion.Inventory{}, false, err
+	}
+
+	// return the inventory if one was stored
+	traceLookup(CategoryInventory, "", !inventory.Empty())
+	if inventory.Empty() {
+		return kion.Inventory{}, false, nil
+	}
+	return inventory, true, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Real Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory implements the Cache interface for RealCache and wraps a
+// common function for storing the inventory.
+func (c *RealCache) SetInventory(value kion.Inventory) error {
+	name, ok := c.dataName()
+	if !ok {
+		return nil
+	}
+	return setInventory(c.keyring, name, value)
+}
+
+// GetInventory implements the Cache interface for RealCache and wraps a
+// common function for retrieving the inventory.
+func (c *RealCache) GetInventory() (kion.Inventory, bool, error) {
+	name, ok := c.dataName()
+	if !ok {
+		return kion.Inventory{}, false, nil
+	}
+	return getInventory(c.keyring, name)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Null Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory does nothing.
+func (c *NullCache) SetInventory(value kion.Inventory) error {
+	return nil
+}
+
+// GetInventory returns an empty inventory, false, and a nil error.
+func (c *NullCache) GetInventory() (kion.Inventory, bool, error) {
+	return kion.Inventory{}, false, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory reports the inventory that would have been stored.
+func (c *DryRunCache) SetInventory(value kion.Inventory) error {
+	fmt.Fprintf(c.out, "[dry-run] would cache an inventory of %v cloud access roles as of %v\n", len(value.CARs), value.Updated.Format(time.RFC3339))
+	return nil
+}
+
+// GetInventory retrieves the inventory from the wrapped cache.
+func (c *DryRunCache) GetInventory() (kion.Inventory, bool, error) {
+	return c.cache.GetInventory()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory stores the inventory in the wrapped cache.
+func (c *TolerantCache) SetInventory(value kion.Inventory) error {
+	return c.tolerate(c.cache.SetInventory(value))
+}
+
+// GetInventory retrieves the inventory from the wrapped cache.
+func (c *TolerantCache) GetInventory() (kion.Inventory, bool, error) {
+	return c.cache.GetInventory()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory stores the inventory in the wrapped cache unless the inventory
+// isn't cached.
+func (c *SelectiveCache) SetInventory(value kion.Inventory) error {
+	if c.disabled[CategoryInventory] {
+		return nil
+	}
+	return c.cache.SetInventory(value)
+}
+
+// GetInventory retrieves the inventory from the wrapped cache unless the
+// inventory isn't cached.
+func (c *SelectiveCache) GetInventory() (kion.Inventory, bool, error) {
+	if c.disabled[CategoryInventory] {
+		return kion.Inventory{}, false, nil
+	}
+	return c.cache.GetInventory()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetInventory stores the inventory in the wrapped cache.
+func (c *TimedCache) SetInventory(value kion.Inventory) error {
+	defer kion.Timings.Time(kion.PhaseCache, "set inventory")()
+	return c.cache.SetInventory(value)
+}
+
+// GetInventory retrieves the inventory from the wrapped cache.
+func (c *TimedCache) GetInventory() (kion.Inventory, bool, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "get inventory")()
+	return c.cache.GetInventory()
+}
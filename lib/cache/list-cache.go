@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+// Entry describes an item held in the cache.
+type Entry struct {
+	Category string
+	Key      string
+	// Expires is when the entry stops being usable, zero if it doesn't expire.
+	Expires time.Time
+	// Updated is when the entry was stored, zero if it isn't known.
+	Updated time.Time
+}
+
+// Expired reports whether the entry is no longer usable at now.
+func (e Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// listCache returns every entry of the cache, STAKs sorted by key first.
+func listCache(k keyring.Keyring, cacheName string) ([]Entry, error) {
+	var entries []Entry
+
+	var staks map[string]kion.STAK
+	_, err := loadItem(k, cacheName, CategoryStak, &staks)
+	if err != nil {
+		return nil, err
+	}
+	for key, stak := range staks {
+		entries = append(entries, Entry{Category: CategoryStak, Key: key, Expires: stak.Expiration})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	session, found, err := getSession(k, cacheName)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		// a session without a readable expiry is listed as not expiring, and
+		// one that can be refreshed lasts as long as its refresh token
+		expires, _ := session.ExpiresAt()
+		if refreshExpires, err := session.RefreshExpiresAt(); err == nil && session.Refresh.Token != "" && refreshExpires.After(expires) {
+			expires = refreshExpires
+		}
+		entries = append(entries, Entry{Category: CategorySession, Key: session.UserName, Expires: expires})
+	}
+
+	var selections map[string]string
+	_, err = loadItem(k, cacheName, CategorySelection, &selections)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(selections))
+	for key := range selections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entries = append(entries, Entry{Category: CategorySelection, Key: key})
+	}
+
+	inventory, found, err := getInventory(k, cacheName)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		key := fmt.Sprintf("%v projects, %v cloud access roles", len(inventory.Projects), len(inventory.CARs))
+		entries = append(entries, Entry{Category: CategoryInventory, Key: key, Updated: inventory.Updated})
+	}
+
+	var metadata map[string]kion.CachedSAMLMetadata
+	_, err = loadItem(k, cacheName, CategoryMetadata, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	keys = keys[:0]
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entries = append(entries, Entry{Category: CategoryMetadata, Key: key, Expires: metadata[key].ValidUntil, Updated: metadata[key].Fetched})
+	}
+
+	return entries, nil
+}
+
+// expiredEntries returns the entries of the cache expired at now.
+func expiredEntries(k keyring.Keyring, cacheName string, now time.Time) ([]Entry, error) {
+	entries, err := listCache(k, cacheName)
+	if err != nil {
+		return nil, err
+	}
+	var expired []Entry
+	for _, entry := range entries {
+		if entry.Expired(now) {
+			expired = append(expired, entry)
+		}
+	}
+	return expired, nil
+}
+
+// purgeCache removes expired STAKs, an expired session, and SAML metadata
+// past its validUntil from the cache, returning what was removed. Selections
+// and the inventory never expire.
+func purgeCache(k keyring.Keyring, cacheName string, now time.Time) ([]Entry, error) {
+	expired, err := expiredEntries(k, cacheName, now)
+	if err != nil || len(expired) == 0 {
+		return nil, err
+	}
+
+	var staks map[string]kion.STAK
+	_, err = loadItem(k, cacheName, CategoryStak, &staks)
+	if err != nil {
+		return nil, err
+	}
+	if pruneStaks(staks, now) {
+		err = storeItem(k, cacheName, CategoryStak, staks)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var metadata map[string]kion.CachedSAMLMetadata
+	_, err = loadItem(k, cacheName, CategoryMetadata, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range expired {
+		switch entry.Category {
+		case CategorySession:
+			err = flushCache(k, cacheName, []string{CategorySession})
+		case CategoryMetadata:
+			delete(metadata, entry.Key)
+			err = storeItem(k, cacheName, CategoryMetadata, metadata)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return expired, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Real Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache returns every entry of the cache.
+func (c *RealCache) ListCache() ([]Entry, error) {
+	var entries []Entry
+	for _, name := range c.names() {
+		listed, err := listCache(c.keyring, name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, listed...)
+	}
+	return entries, nil
+}
+
+// PurgeCache removes expired entries from the cache, returning them.
+func (c *RealCache) PurgeCache() ([]Entry, error) {
+	var expired []Entry
+	for _, name := range c.names() {
+		purged, err := purgeCache(c.keyring, name, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, purged...)
+	}
+	return expired, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Null Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache returns every entry of the cache, which is still listed when the
+// cache is disabled so it can be inspected.
+func (c *NullCache) ListCache() ([]Entry, error) {
+	return listCache(c.keyring, c.name)
+}
+
+// PurgeCache removes expired entries from the cache, returning them.
+func (c *NullCache) PurgeCache() ([]Entry, error) {
+	return purgeCache(c.keyring, c.name, time.Now())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache lists the entries of the wrapped cache.
+func (c *DryRunCache) ListCache() ([]Entry, error) {
+	return c.cache.ListCache()
+}
+
+// PurgeCache reports the expired entries that would have been removed.
+func (c *DryRunCache) PurgeCache() ([]Entry, error) {
+	entries, err := c.cache.ListCache()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var expired []Entry
+	for _, entry := range entries {
+		if entry.Expired(now) {
+			fmt.Fprintf(c.out, "[dry-run] would purge the expired %v entry %v\n", entry.Category, entry.Key)
+			expired = append(expired, entry)
+		}
+	}
+	return expired, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache lists the entries of the wrapped cache.
+func (c *TolerantCache) ListCache() ([]Entry, error) {
+	return c.cache.ListCache()
+}
+
+// PurgeCache removes expired entries from the wrapped cache.
+func (c *TolerantCache) PurgeCache() ([]Entry, error) {
+	entries, err := c.cache.PurgeCache()
+	return entries, c.tolerate(err)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache lists the entries of the wrapped cache.
+func (c *SelectiveCache) ListCache() ([]Entry, error) {
+	return c.cache.ListCache()
+}
+
+// PurgeCache removes expired entries from the wrapped cache.
+func (c *SelectiveCache) PurgeCache() ([]Entry, error) {
+	return c.cache.PurgeCache()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ListCache lists the entries of the wrapped cache.
+func (c *TimedCache) ListCache() ([]Entry, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "list")()
+	return c.cache.ListCache()
+}
+
+// PurgeCache removes expired entries from the wrapped cache.
+func (c *TimedCache) PurgeCache() ([]Entry, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "purge")()
+	return c.cache.PurgeCache()
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+// setSAMLMetadata is a common func for Cache implementations and stores
+// identity provider metadata downloaded from a url in the cache.
+func setSAMLMetadata(k keyring.Keyring, cacheName string, url string, value kion.CachedSAMLMetadata) error {
+	// pull our metadata
+	var metadata map[string]kion.CachedSAMLMetadata
+	_, err := loadItem(k, cacheName, CategoryMetadata, &metadata)
+	if err != nil {
+		return err
+	}
+
+	// initialize the map if it is still nil
+	if metadata == nil {
+		metadata = make(map[string]kion.CachedSAMLMetadata)
+	}
+
+	// store the metadata
+	metadata[url] = value
+	return storeItem(k, cacheName, CategoryMetadata, metadata)
+}
+
+// getSAMLMetadata is a common func for Cache implementations and retrieves
+// identity provider metadata downloaded from a url from the cache.
+func getSAMLMetadata(k keyring.Keyring, cacheName string, url string) (kion.CachedSAMLMetadata, bool, error) {
+	var metadata map[string]kion.CachedSAMLMetadata
+	_, err := loadItem(k, cacheName, CategoryMetadata, &metadata)
+	if err != nil {
+		return kion.CachedSAMLMetadata{}, false, err
+	}
+
+	// return the metadata if found
+	value, found := metadata[url]
+	traceLookup(CategoryMetadata, url, found)
+	return value, found, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Real Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata implements the Cache interface for RealCache and wraps a
+// common function for storing identity provider metadata.
+func (c *RealCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	return setSAMLMetadata(c.keyring, c.name, url, value)
+}
+
+// GetSAMLMetadata implements the Cache interface for RealCache and wraps a
+// common function for retrieving identity provider metadata.
+func (c *RealCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	return getSAMLMetadata(c.keyring, c.name, url)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Null Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata does nothing.
+func (c *NullCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	return nil
+}
+
+// GetSAMLMetadata returns empty metadata, false, and a nil error.
+func (c *NullCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	return kion.CachedSAMLMetadata{}, false, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata reports the metadata that would have been stored.
+func (c *DryRunCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	fmt.Fprintf(c.out, "[dry-run] would cache SAML metadata from %v\n", url)
+	return nil
+}
+
+// GetSAMLMetadata retrieves metadata from the wrapped cache.
+func (c *DryRunCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	return c.cache.GetSAMLMetadata(url)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata stores metadata in the wrapped cache.
+func (c *TolerantCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	return c.tolerate(c.cache.SetSAMLMetadata(url, value))
+}
+
+// GetSAMLMetadata retrieves metadata from the wrapped cache.
+func (c *TolerantCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	return c.cache.GetSAMLMetadata(url)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata stores SAML metadata in the wrapped cache unless metadata
+// isn't cached.
+func (c *SelectiveCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	if c.disabled[CategoryMetadata] {
+		return nil
+	}
+	return c.cache.SetSAMLMetadata(url, value)
+}
+
+// GetSAMLMetadata retrieves SAML metadata from the wrapped cache unless
+// metadata isn't cached.
+func (c *SelectiveCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	if c.disabled[CategoryMetadata] {
+		return kion.CachedSAMLMetadata{}, false, nil
+	}
+	return c.cache.GetSAMLMetadata(url)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSAMLMetadata stores SAML metadata in the wrapped cache.
+func (c *TimedCache) SetSAMLMetadata(url string, value kion.CachedSAMLMetadata) error {
+	defer kion.Timings.Time(kion.PhaseCache, "set saml metadata")()
+	return c.cache.SetSAMLMetadata(url, value)
+}
+
+// GetSAMLMetadata retrieves SAML metadata from the wrapped cache.
+func (c *TimedCache) GetSAMLMetadata(url string) (kion.CachedSAMLMetadata, bool, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "get saml metadata")()
+	return c.cache.GetSAMLMetadata(url)
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+// setSelection is a common func for Cache implementations and stores a
+// remembered prompt answer in the cache.
+func setSelection(k keyring.Keyring, cacheName string, key string, value string) error {
+	// pull our selections
+	var selections map[string]string
+	_, err := loadItem(k, cacheName, CategorySelection, &selections)
+	if err != nil {
+		return err
+	}
+
+	// initialize the map if it is still nil
+	if selections == nil {
+		selections = make(map[string]string)
+	}
+
+	// store the selection
+	selections[key] = value
+	return storeItem(k, cacheName, CategorySelection, selections)
+}
+
+// getSelection is a common func for Cache implementations and retrieves a
+// remembered prompt answer from the cache.
+func getSelection(k keyring.Keyring, cacheName string, key string) (string, bool, error) {
+	var selections map[string]string
+	_, err := loadItem(k, cacheName, CategorySelection, &selections)
+	if err != nil {
+		return "", false, err
+	}
+
+	// return the selection if found
+	value, found := selections[key]
+	return value, found, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Real Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection implements the Cache interface for RealCache and wraps a
+// common function for storing remembered selections.
+func (c *RealCache) SetSelection(key string, value string) error {
+	name, ok := c.dataName()
+	if !ok {
+		return nil
+	}
+	return setSelection(c.keyring, name, key, value)
+}
+
+// GetSelection implements the Cache interface for RealCache and wraps a
+// common function for retrieving remembered selections.
+func (c *RealCache) GetSelection(key string) (string, bool, error) {
+	name, ok := c.dataName()
+	if !ok {
+		return "", false, nil
+	}
+	return getSelection(c.keyring, name, key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Null Cacher                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection does nothing.
+func (c *NullCache) SetSelection(key string, value string) error {
+	return nil
+}
+
+// GetSelection returns an empty selection, false, and a nil error.
+func (c *NullCache) GetSelection(key string) (string, bool, error) {
+	return "", false, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection reports the selection that would have been stored.
+func (c *DryRunCache) SetSelection(key string, value string) error {
+	fmt.Fprintf(c.out, "[dry-run] would remember %v for %v\n", value, key)
+	return nil
+}
+
+// GetSelection retrieves a selection from the wrapped cache.
+func (c *DryRunCache) GetSelection(key string) (string, bool, error) {
+	return c.cache.GetSelection(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection stores a selection in the wrapped cache.
+func (c *TolerantCache) SetSelection(key string, value string) error {
+	return c.tolerate(c.cache.SetSelection(key, value))
+}
+
+// GetSelection retrieves a selection from the wrapped cache.
+func (c *TolerantCache) GetSelection(key string) (string, bool, error) {
+	return c.cache.GetSelection(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection stores a selection in the wrapped cache unless selections
+// aren't cached.
+func (c *SelectiveCache) SetSelection(key string, value string) error {
+	if c.disabled[CategorySelection] {
+		return nil
+	}
+	return c.cache.SetSelection(key, value)
+}
+
+// GetSelection retrieves a selection from the wrapped cache unless selections
+// aren't cached.
+func (c *SelectiveCache) GetSelection(key string) (string, bool, error) {
+	if c.disabled[CategorySelection] {
+		return "", false, nil
+	}
+	return c.cache.GetSelection(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSelection stores a selection in the wrapped cache.
+func (c *TimedCache) SetSelection(key string, value string) error {
+	defer kion.Timings.Time(kion.PhaseCache, "set selection")()
+	return c.cache.SetSelection(key, value)
+}
+
+// GetSelection retrieves a selection from the wrapped cache.
+func (c *TimedCache) GetSelection(key string) (string, bool, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "get selection")()
+	return c.cache.GetSelection(key)
+}
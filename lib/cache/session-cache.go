@@ -1,86 +1,33 @@
 package cache
 
 import (
-	"encoding/json"
+	"fmt"
 
 	"github.com/99designs/keyring"
 	"github.com/kionsoftware/kion-cli/lib/kion"
 )
 
-// SetSession is a common func for all Cache implementations and stores a
+// setSession is a common func for all Cache implementations and stores a
 // Session in the cache.
-func setSession(k keyring.Keyring, session kion.Session) error {
-	// pull our stak cache
-	cacheName := "Kion-CLI Cache"
-	cache, err := k.Get(cacheName)
-	if err != nil && err != keyring.ErrKeyNotFound {
-		return err
-	}
-
-	// unmarshal the json data
-	var cacheData CacheData
-	if len(cache.Data) > 0 {
-		err = json.Unmarshal(cache.Data, &cacheData)
-		if err != nil {
-			return err
-		}
-	}
-
-	// store the session
-	cacheData.SESSION = session
-
-	// marshal the stack cache to json
-	data, err := json.Marshal(cacheData)
-	if err != nil {
-		return err
-	}
-
-	// build the keyring item
-	cache = keyring.Item{
-		Key:         cacheName,
-		Data:        data,
-		Label:       cacheName,
-		Description: "Cache data for the Kion-CLI.",
-	}
-
-	// store the cache
-	err = k.Set(cache)
-	if err != nil {
-		return err
-	}
-
-	return nil
-
+func setSession(k keyring.Keyring, cacheName string, session kion.Session) error {
+	return storeItem(k, cacheName, CategorySession, session)
 }
 
-// GetSession is a common func for all Cache implementations and retrieves a
+// getSession is a common func for all Cache implementations and retrieves a
 // Session in the cache.
-func getSession(k keyring.Keyring) (kion.Session, bool, error) {
-	// pull our stak cache
-	cache, err := k.Get("Kion-CLI Cache")
+func getSession(k keyring.Keyring, cacheName string) (kion.Session, bool, error) {
+	var session kion.Session
+	_, err := loadItem(k, cacheName, CategorySession, &session)
 	if err != nil {
-		if err == keyring.ErrKeyNotFound {
-			return kion.Session{}, false, nil
-		}
 		return kion.Session{}, false, err
 	}
 
-	// unmarshal the json data
-	var cacheData CacheData
-	if len(cache.Data) > 0 {
-		err = json.Unmarshal(cache.Data, &cacheData)
-		if err != nil {
-			return kion.Session{}, false, err
-		}
-	}
-
-	// return the stak if found
-	session := cacheData.SESSION
-	if session != (kion.Session{}) {
+	// return the session if one was stored
+	found := session != (kion.Session{})
+	traceLookup(CategorySession, "", found)
+	if found {
 		return session, true, nil
 	}
-
-	// return empty stak if not found
 	return kion.Session{}, false, nil
 }
 
@@ -93,13 +40,18 @@ func getSession(k keyring.Keyring) (kion.Session, bool, error) {
 // SetSession implements the Cache interface for RealCache and wraps a common
 // function for storing session data.
 func (c *RealCache) SetSession(session kion.Session) error {
-	return setSession(c.keyring, session)
+	err := setSession(c.keyring, c.name, session)
+	if err != nil {
+		return err
+	}
+	c.setUser(session.UserName)
+	return nil
 }
 
 // GetSession implements the Cache interface for RealCache and wraps a common
 // function for retrieving session data.
 func (c *RealCache) GetSession() (kion.Session, bool, error) {
-	return getSession(c.keyring)
+	return getSession(c.keyring, c.name)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -111,11 +63,86 @@ func (c *RealCache) GetSession() (kion.Session, bool, error) {
 // SetSession implements the Cache interface for NullCache and wraps a common
 // function for storing session data.
 func (c *NullCache) SetSession(session kion.Session) error {
-	return setSession(c.keyring, session)
+	return setSession(c.keyring, c.name, session)
 }
 
 // GetSession implements the Cache interface for NullCache and wraps a common
 // function for retrieving session data.
 func (c *NullCache) GetSession() (kion.Session, bool, error) {
-	return getSession(c.keyring)
+	return getSession(c.keyring, c.name)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSession reports the session that would have been stored.
+func (c *DryRunCache) SetSession(session kion.Session) error {
+	fmt.Fprintf(c.out, "[dry-run] would cache Kion session expiring %v\n", session.Access.Expiry)
+	return nil
+}
+
+// GetSession retrieves the session from the wrapped cache.
+func (c *DryRunCache) GetSession() (kion.Session, bool, error) {
+	return c.cache.GetSession()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSession stores a session in the wrapped cache.
+func (c *TolerantCache) SetSession(value kion.Session) error {
+	return c.tolerate(c.cache.SetSession(value))
+}
+
+// GetSession retrieves a session from the wrapped cache.
+func (c *TolerantCache) GetSession() (kion.Session, bool, error) {
+	return c.cache.GetSession()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSession stores the session in the wrapped cache unless sessions aren't
+// cached.
+func (c *SelectiveCache) SetSession(value kion.Session) error {
+	if c.disabled[CategorySession] {
+		return nil
+	}
+	return c.cache.SetSession(value)
+}
+
+// GetSession retrieves the session from the wrapped cache unless sessions
+// aren't cached.
+func (c *SelectiveCache) GetSession() (kion.Session, bool, error) {
+	if c.disabled[CategorySession] {
+		return kion.Session{}, false, nil
+	}
+	return c.cache.GetSession()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetSession stores a session in the wrapped cache.
+func (c *TimedCache) SetSession(value kion.Session) error {
+	defer kion.Timings.Time(kion.PhaseCache, "set session")()
+	return c.cache.SetSession(value)
+}
+
+// GetSession retrieves a session from the wrapped cache.
+func (c *TimedCache) GetSession() (kion.Session, bool, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "get session")()
+	return c.cache.GetSession()
 }
@@ -1,13 +1,24 @@
 package cache
 
 import (
-	"encoding/json"
+	"fmt"
 	"time"
 
-	"github.com/99designs/keyring"
 	"github.com/kionsoftware/kion-cli/lib/kion"
 )
 
+// pruneStaks removes STAKs expired at now, reporting whether any were.
+func pruneStaks(staks map[string]kion.STAK, now time.Time) bool {
+	pruned := false
+	for key, stak := range staks {
+		if !stak.Expiration.After(now) {
+			delete(staks, key)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 //                                                                            //
 //  Real Cacher                                                               //
@@ -16,89 +27,58 @@ import (
 
 // SetStak stores a STAK in the cache.
 func (c *RealCache) SetStak(key string, value kion.STAK) error {
-	// pull our stak cache
-	cacheName := "Kion-CLI Cache"
-	cache, err := c.keyring.Get(cacheName)
-	if err != nil && err != keyring.ErrKeyNotFound {
-		return err
+	name, ok := c.dataName()
+	if !ok {
+		return nil
 	}
 
-	// unmarshal the json data
-	var cacheData CacheData
-	if len(cache.Data) > 0 {
-		err = json.Unmarshal(cache.Data, &cacheData)
-		if err != nil {
-			return err
-		}
+	// pull our stak cache
+	var staks map[string]kion.STAK
+	_, err := loadItem(c.keyring, name, CategoryStak, &staks)
+	if err != nil {
+		return err
 	}
 
 	// initialize the map if it is still nil
-	if cacheData.STAK == nil {
-		cacheData.STAK = make(map[string]kion.STAK)
+	if staks == nil {
+		staks = make(map[string]kion.STAK)
 	}
 
 	// clean expired entries
-	now := time.Now()
-	for key, stak := range cacheData.STAK {
-		if stak.Expiration.Before(now) {
-			delete(cacheData.STAK, key)
-		}
-	}
+	pruneStaks(staks, time.Now())
 
 	// create our entry
-	cacheData.STAK[key] = value
-
-	// marshal the stack cache to json
-	data, err := json.Marshal(cacheData)
-	if err != nil {
-		return err
-	}
-
-	// build the keyring item
-	cache = keyring.Item{
-		Key:         cacheName,
-		Data:        data,
-		Label:       cacheName,
-		Description: "Cache data for the Kion-CLI.",
-	}
-
-	// store the cache
-	err = c.keyring.Set(cache)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	staks[key] = value
+	return storeItem(c.keyring, name, CategoryStak, staks)
 }
 
 // GetStak retrieves a STAK from the cache.
 func (c *RealCache) GetStak(key string) (kion.STAK, bool, error) {
+	name, ok := c.dataName()
+	if !ok {
+		traceLookup(CategoryStak, key, false)
+		return kion.STAK{}, false, nil
+	}
+
 	// pull our stak cache
-	cache, err := c.keyring.Get("Kion-CLI Cache")
+	var staks map[string]kion.STAK
+	_, err := loadItem(c.keyring, name, CategoryStak, &staks)
 	if err != nil {
-		if err == keyring.ErrKeyNotFound {
-			return kion.STAK{}, false, nil
-		}
 		return kion.STAK{}, false, err
 	}
 
-	// unmarshal the json data
-	var cacheData CacheData
-	if len(cache.Data) > 0 {
-		err = json.Unmarshal(cache.Data, &cacheData)
+	// clean expired entries so they are never served
+	if pruneStaks(staks, time.Now()) && !c.readOnly {
+		err = storeItem(c.keyring, name, CategoryStak, staks)
 		if err != nil {
 			return kion.STAK{}, false, err
 		}
 	}
 
 	// return the stak if found
-	stak, found := cacheData.STAK[key]
-	if found {
-		return stak, true, nil
-	}
-
-	// return empty stak if not found
-	return kion.STAK{}, false, nil
+	stak, found := staks[key]
+	traceLookup(CategoryStak, key, found)
+	return stak, found, nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -116,3 +96,76 @@ func (c *NullCache) SetStak(key string, value kion.STAK) error {
 func (c *NullCache) GetStak(key string) (kion.STAK, bool, error) {
 	return kion.STAK{}, false, nil
 }
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dry Run Cacher                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetStak reports the STAK that would have been stored.
+func (c *DryRunCache) SetStak(key string, value kion.STAK) error {
+	fmt.Fprintf(c.out, "[dry-run] would cache STAK %v until %v\n", key, value.Expiration.Format(time.RFC3339))
+	return nil
+}
+
+// GetStak retrieves a STAK from the wrapped cache.
+func (c *DryRunCache) GetStak(key string) (kion.STAK, bool, error) {
+	return c.cache.GetStak(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tolerant Cacher                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetStak stores a STAK in the wrapped cache.
+func (c *TolerantCache) SetStak(key string, value kion.STAK) error {
+	return c.tolerate(c.cache.SetStak(key, value))
+}
+
+// GetStak retrieves a STAK from the wrapped cache.
+func (c *TolerantCache) GetStak(key string) (kion.STAK, bool, error) {
+	return c.cache.GetStak(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Selective Cacher                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetStak stores a STAK in the wrapped cache unless STAKs aren't cached.
+func (c *SelectiveCache) SetStak(key string, value kion.STAK) error {
+	if c.disabled[CategoryStak] {
+		return nil
+	}
+	return c.cache.SetStak(key, value)
+}
+
+// GetStak retrieves a STAK from the wrapped cache unless STAKs aren't cached.
+func (c *SelectiveCache) GetStak(key string) (kion.STAK, bool, error) {
+	if c.disabled[CategoryStak] {
+		return kion.STAK{}, false, nil
+	}
+	return c.cache.GetStak(key)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timed Cacher                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SetStak stores a STAK in the wrapped cache.
+func (c *TimedCache) SetStak(key string, value kion.STAK) error {
+	defer kion.Timings.Time(kion.PhaseCache, "set stak")()
+	return c.cache.SetStak(key, value)
+}
+
+// GetStak retrieves a STAK from the wrapped cache.
+func (c *TimedCache) GetStak(key string) (kion.STAK, bool, error) {
+	defer kion.Timings.Time(kion.PhaseCache, "get stak")()
+	return c.cache.GetStak(key)
+}
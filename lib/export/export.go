@@ -0,0 +1,77 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Exporters                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Exporter pushes short term access keys into a secret store, replacing any
+// keys exported to the same place before.
+type Exporter interface {
+	Export(ctx context.Context, stak kion.STAK, source Source) error
+}
+
+// Source is the account, cloud access role, and region short term access keys
+// were issued for, stored alongside them where the secret store allows.
+type Source struct {
+	Account string
+	CAR     string
+	Region  string
+}
+
+// Builder builds an exporter writing to path within its secret store, such
+// as secret/aws/prod for vault:secret/aws/prod.
+type Builder func(path string) (Exporter, error)
+
+// providers build exporters by the name that starts their destination.
+var providers = map[string]Builder{}
+
+// Register makes a provider available under name, such as vault. It panics
+// if name is empty, contains a colon, or is already registered.
+func Register(name string, build Builder) {
+	if name == "" || strings.Contains(name, ":") {
+		panic(fmt.Sprintf("export: invalid provider name %q", name))
+	}
+	if _, found := providers[name]; found {
+		panic(fmt.Sprintf("export: provider %v registered twice", name))
+	}
+	providers[name] = build
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New builds the exporter for a destination given as PROVIDER:PATH, such as
+// vault:secret/aws/prod or ssm:/team/aws/prod.
+func New(destination string) (Exporter, error) {
+	name, path, found := strings.Cut(destination, ":")
+	if !found || path == "" {
+		return nil, fmt.Errorf("invalid export destination %q, expected PROVIDER:PATH with a provider of %v", destination, strings.Join(Providers(), ", "))
+	}
+	build, found := providers[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("unknown export provider %q, expected one of %v", name, strings.Join(Providers(), ", "))
+	}
+	exporter, err := build(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v export destination: %w", name, err)
+	}
+	return exporter, nil
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		destination string
+		want        Exporter
+		wantErr     bool
+	}{
+		{"Vault", "vault:secret/aws/prod", &vaultExporter{path: "secret/aws/prod"}, false},
+		{"Vault Without Mount", "vault:prod", nil, true},
+		{"1Password", "1password:Engineering/AWS prod", &onePasswordExporter{vault: "Engineering", title: "AWS prod"}, false},
+		{"1Password Alias", "OP:Engineering/AWS/prod", &onePasswordExporter{vault: "Engineering", title: "AWS/prod"}, false},
+		{"1Password Without Item", "op:Engineering", nil, true},
+		{"SSM", "ssm:/team/aws/prod", &ssmExporter{name: "/team/aws/prod"}, false},
+		{"SSM Relative Path", "ssm:team/aws/prod", nil, true},
+		{"Unknown Provider", "keepass:aws", nil, true},
+		{"No Path", "vault:", nil, true},
+		{"No Provider", "secret/aws/prod", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := New(test.destination)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			switch want := test.want.(type) {
+			case *vaultExporter:
+				if g, ok := got.(*vaultExporter); !ok || *g != *want {
+					t.Errorf("got %#v, wanted %#v", got, want)
+				}
+			case *onePasswordExporter:
+				if g, ok := got.(*onePasswordExporter); !ok || *g != *want {
+					t.Errorf("got %#v, wanted %#v", got, want)
+				}
+			case *ssmExporter:
+				if g, ok := got.(*ssmExporter); !ok || *g != *want {
+					t.Errorf("got %#v, wanted %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a provider twice didn't panic")
+		}
+	}()
+	Register("vault", newVaultExporter)
+}
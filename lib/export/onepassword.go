@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  1Password                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Register("1password", newOnePasswordExporter)
+	Register("op", newOnePasswordExporter)
+}
+
+// runOP runs the 1Password CLI with stdin and returns what it prints,
+// replaced in tests.
+var runOP = func(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "op", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("op %v: %v", args[0], msg)
+		}
+		return nil, fmt.Errorf("op %v: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// onePasswordExporter writes keys as an API credential item in a 1Password
+// vault with the op CLI, signed in as it already is. The item is piped to op
+// rather than passed as arguments so the keys never show in process listings.
+type onePasswordExporter struct {
+	vault string
+	title string
+}
+
+// newOnePasswordExporter builds a 1Password exporter writing to the item
+// titled after the first slash of path in the vault before it, such as
+// Engineering/AWS prod.
+func newOnePasswordExporter(path string) (Exporter, error) {
+	vault, title, found := strings.Cut(path, "/")
+	if !found || vault == "" || title == "" {
+		return nil, fmt.Errorf("expected VAULT/ITEM, such as Engineering/AWS prod, not %q", path)
+	}
+	return &onePasswordExporter{vault: vault, title: title}, nil
+}
+
+// onePasswordField is a field of a 1Password item template.
+type onePasswordField struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Export creates the item, or edits the item of the same title in the vault.
+func (e *onePasswordExporter) Export(ctx context.Context, stak kion.STAK, source Source) error {
+	fields := []onePasswordField{
+		{"username", "STRING", "access key id", stak.AccessKey},
+		{"credential", "CONCEALED", "secret access key", stak.SecretAccessKey},
+		{"session_token", "CONCEALED", "session token", stak.SessionToken},
+		{"expiration", "STRING", "expiration", stak.Expiration.Format(time.RFC3339)},
+		{"account", "STRING", "account", source.Account},
+		{"cloud_access_role", "STRING", "cloud access role", source.CAR},
+	}
+	if source.Region != "" {
+		fields = append(fields, onePasswordField{"region", "STRING", "region", source.Region})
+	}
+	item, err := json.Marshal(map[string]any{"title": e.title, "category": "API_CREDENTIAL", "fields": fields})
+	if err != nil {
+		return err
+	}
+
+	id, err := e.find(ctx)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		_, err = runOP(ctx, item, "item", "create", "--vault", e.vault, "--format", "json")
+	} else {
+		_, err = runOP(ctx, item, "item", "edit", id, "--vault", e.vault, "--format", "json")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %v to the %v 1Password vault: %w", e.title, e.vault, err)
+	}
+	return nil
+}
+
+// find returns the ID of the item titled as the exported one in the vault, or
+// nothing if there isn't one. Several items of the title are refused rather
+// than guessing which to overwrite.
+func (e *onePasswordExporter) find(ctx context.Context) (string, error) {
+	out, err := runOP(ctx, nil, "item", "list", "--vault", e.vault, "--format", "json")
+	if err != nil {
+		return "", fmt.Errorf("unable to list the %v 1Password vault, is op signed in: %w", e.vault, err)
+	}
+	var items []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	err = json.Unmarshal(out, &items)
+	if err != nil {
+		return "", fmt.Errorf("unexpected item list from op: %w", err)
+	}
+	var id string
+	for _, item := range items {
+		if item.Title != e.title {
+			continue
+		}
+		if id != "" {
+			return "", fmt.Errorf("the %v 1Password vault has several items titled %v, rename all but one", e.vault, e.title)
+		}
+		id = item.ID
+	}
+	return id, nil
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestOnePasswordExport(t *testing.T) {
+	stak := kion.STAK{AccessKey: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+
+	tests := []struct {
+		description string
+		items       string
+		wantCommand string
+		wantErr     bool
+	}{
+		{"Create", `[{"id":"abc","title":"Other"}]`, "item create --vault Engineering --format json", false},
+		{"Edit", `[{"id":"abc","title":"AWS prod"},{"id":"def","title":"Other"}]`, "item edit abc --vault Engineering --format json", false},
+		{"Duplicate Titles", `[{"id":"abc","title":"AWS prod"},{"id":"def","title":"AWS prod"}]`, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var gotCommand string
+			var gotItem struct {
+				Title  string
+				Fields []onePasswordField
+			}
+			defer func(run func(context.Context, []byte, ...string) ([]byte, error)) { runOP = run }(runOP)
+			runOP = func(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+				if args[1] == "list" {
+					return []byte(test.items), nil
+				}
+				gotCommand = strings.Join(args, " ")
+				return nil, json.Unmarshal(stdin, &gotItem)
+			}
+
+			err := (&onePasswordExporter{vault: "Engineering", title: "AWS prod"}).Export(context.Background(), stak, Source{Account: "111122223333", CAR: "Admin", Region: "us-west-2"})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if gotCommand != test.wantCommand {
+				t.Errorf("ran op %q, wanted %q", gotCommand, test.wantCommand)
+			}
+			if test.wantErr {
+				return
+			}
+			if strings.Contains(gotCommand, "secret") || gotItem.Title != "AWS prod" || len(gotItem.Fields) != 7 || gotItem.Fields[1].Value != "secret" || gotItem.Fields[1].Type != "CONCEALED" {
+				t.Errorf("piped %+v", gotItem)
+			}
+		})
+	}
+}
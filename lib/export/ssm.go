@@ -0,0 +1,62 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/helper"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS SSM Parameter Store                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Register("ssm", newSSMExporter)
+}
+
+// defaultSSMRegion is where parameters are written when the keys have no
+// region.
+const defaultSSMRegion = "us-east-1"
+
+// putSSMParameter writes an SSM parameter, replaced in tests.
+var putSSMParameter = helper.PutSSMParameter
+
+// ssmExporter writes keys as a SecureString parameter in the credential
+// process format, in the account the keys are for and signed with the keys
+// themselves, so the cloud access role must allow ssm:PutParameter.
+type ssmExporter struct {
+	name string
+}
+
+// newSSMExporter builds an SSM exporter writing to the parameter named path,
+// such as /team/aws/prod.
+func newSSMExporter(path string) (Exporter, error) {
+	if strings.Contains(path, "/") && !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("parameter names with a path must start with /, such as /%v", path)
+	}
+	return &ssmExporter{name: path}, nil
+}
+
+// Export writes the parameter in the region the keys are for.
+func (e *ssmExporter) Export(ctx context.Context, stak kion.STAK, source Source) error {
+	var value bytes.Buffer
+	err := helper.PrintCredentialProcess(&value, stak)
+	if err != nil {
+		return err
+	}
+	region := source.Region
+	if region == "" {
+		region = defaultSSMRegion
+	}
+	err = putSSMParameter(stak, region, e.name, strings.TrimSpace(value.String()))
+	if err != nil {
+		return fmt.Errorf("unable to write ssm parameter %v in %v: %w", e.name, region, err)
+	}
+	return nil
+}
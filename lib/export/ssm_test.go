@@ -0,0 +1,52 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestSSMExport(t *testing.T) {
+	stak := kion.STAK{AccessKey: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+
+	tests := []struct {
+		description string
+		region      string
+		wantRegion  string
+	}{
+		{"Region", "eu-west-1", "eu-west-1"},
+		{"Default Region", "", "us-east-1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var gotKeys kion.STAK
+			var gotRegion, gotName, gotValue string
+			defer func(put func(kion.STAK, string, string, string) error) { putSSMParameter = put }(putSSMParameter)
+			putSSMParameter = func(stak kion.STAK, region string, name string, value string) error {
+				gotKeys, gotRegion, gotName, gotValue = stak, region, name, value
+				return nil
+			}
+
+			err := (&ssmExporter{name: "/team/aws/prod"}).Export(context.Background(), stak, Source{Region: test.region})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var credentials struct {
+				Version         int
+				AccessKeyId     string
+				SecretAccessKey string
+				SessionToken    string
+			}
+			err = json.Unmarshal([]byte(gotValue), &credentials)
+			if err != nil || credentials.Version != 1 || credentials.SecretAccessKey != "secret" || credentials.SessionToken != "token" {
+				t.Errorf("wrote %q", gotValue)
+			}
+			if gotKeys != stak || gotRegion != test.wantRegion || gotName != "/team/aws/prod" {
+				t.Errorf("wrote %v in %v signed by %v", gotName, gotRegion, gotKeys.AccessKey)
+			}
+		})
+	}
+}
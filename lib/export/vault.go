@@ -0,0 +1,171 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  HashiCorp Vault                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Register("vault", newVaultExporter)
+}
+
+// vaultExporter writes keys as a secret in a Vault KV secrets engine, found at
+// VAULT_ADDR and authorized by VAULT_TOKEN or the token the vault CLI saved
+// in ~/.vault-token, as the vault CLI is.
+type vaultExporter struct {
+	path string
+}
+
+// newVaultExporter builds a vault exporter writing to the secret at path,
+// mount included, such as secret/aws/prod.
+func newVaultExporter(path string) (Exporter, error) {
+	path = strings.Trim(path, "/")
+	if !strings.Contains(path, "/") {
+		return nil, fmt.Errorf("expected the path of a secret within a mount, such as secret/aws/prod, not %q", path)
+	}
+	return &vaultExporter{path: path}, nil
+}
+
+// vaultToken returns the token to authorize requests with.
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err == nil && len(bytes.TrimSpace(data)) > 0 {
+			return string(bytes.TrimSpace(data)), nil
+		}
+	}
+	return "", errors.New("no vault token found, set VAULT_TOKEN or sign in with vault login")
+}
+
+// Export writes the secret, to the data of the path under a version 2 KV
+// mount or to the path itself under a version 1 mount.
+func (e *vaultExporter) Export(ctx context.Context, stak kion.STAK, source Source) error {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return errors.New("set VAULT_ADDR to the address of the vault server")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return err
+	}
+
+	secret := map[string]string{
+		"access_key":        stak.AccessKey,
+		"secret_key":        stak.SecretAccessKey,
+		"security_token":    stak.SessionToken,
+		"expiration":        stak.Expiration.Format(time.RFC3339),
+		"account":           source.Account,
+		"cloud_access_role": source.CAR,
+	}
+	if source.Region != "" {
+		secret["region"] = source.Region
+	}
+
+	mount, version := e.mount(ctx, addr, token)
+	var body any = secret
+	path := e.path
+	if version == "2" {
+		body = map[string]any{"data": secret}
+		path = mount + "data/" + strings.TrimPrefix(e.path, mount)
+	}
+	_, err = vaultRequest(ctx, http.MethodPost, addr+"/v1/"+path, token, body)
+	if err != nil {
+		return fmt.Errorf("unable to write %v to vault: %w", e.path, err)
+	}
+	return nil
+}
+
+// mount returns the KV mount the path is under, with a trailing slash, and
+// its version. Tokens that can't look the mount up are assumed to be writing
+// to a version 2 mount named by the first part of the path, the default for
+// new KV mounts.
+func (e *vaultExporter) mount(ctx context.Context, addr string, token string) (string, string) {
+	fallback, _, _ := strings.Cut(e.path, "/")
+	body, err := vaultRequest(ctx, http.MethodGet, addr+"/v1/sys/internal/ui/mounts/"+e.path, token, nil)
+	if err != nil {
+		return fallback + "/", "2"
+	}
+	var response struct {
+		Data struct {
+			Path    string
+			Options struct {
+				Version string
+			}
+		}
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil || response.Data.Path == "" || !strings.HasPrefix(e.path, response.Data.Path) {
+		return fallback + "/", "2"
+	}
+	version := response.Data.Options.Version
+	if version == "" {
+		version = "1"
+	}
+	return response.Data.Path, version
+}
+
+// vaultRequest sends a request to the vault API, in the namespace named by
+// VAULT_NAMESPACE if set, returning the body of a successful response.
+func vaultRequest(ctx context.Context, method string, url string, token string, payload any) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := kion.ExternalClient(30 * time.Second).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string
+		}
+		if json.Unmarshal(body, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return nil, fmt.Errorf("vault responded %v: %v", resp.StatusCode, strings.Join(vaultErr.Errors, ", "))
+		}
+		return nil, fmt.Errorf("vault responded %v", resp.StatusCode)
+	}
+	return body, nil
+}
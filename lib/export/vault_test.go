@@ -0,0 +1,97 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestVaultExport(t *testing.T) {
+	stak := kion.STAK{AccessKey: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	source := Source{Account: "111122223333", CAR: "Admin"}
+
+	tests := []struct {
+		description string
+		mounts      string
+		wantPath    string
+		wantData    bool
+	}{
+		{"KV Version 2", `{"data":{"path":"kv/","type":"kv","options":{"version":"2"}}}`, "/v1/kv/data/team/aws", true},
+		{"KV Version 1", `{"data":{"path":"kv/team/","type":"kv","options":null}}`, "/v1/kv/team/aws", false},
+		{"Mount Lookup Denied", "", "/v1/kv/data/team/aws", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var gotPath, gotToken, gotNamespace string
+			var gotBody map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					if test.mounts == "" {
+						w.WriteHeader(http.StatusForbidden)
+						_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+						return
+					}
+					_, _ = w.Write([]byte(test.mounts))
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(body, &gotBody)
+				gotPath, gotToken, gotNamespace = r.URL.Path, r.Header.Get("X-Vault-Token"), r.Header.Get("X-Vault-Namespace")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+			t.Setenv("VAULT_ADDR", server.URL+"/")
+			t.Setenv("VAULT_TOKEN", "s.token")
+			t.Setenv("VAULT_NAMESPACE", "team")
+
+			err := (&vaultExporter{path: "kv/team/aws"}).Export(context.Background(), stak, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotPath != test.wantPath || gotToken != "s.token" || gotNamespace != "team" {
+				t.Errorf("wrote %v with token %q in namespace %q, wanted %v", gotPath, gotToken, gotNamespace, test.wantPath)
+			}
+			secret := gotBody
+			if test.wantData {
+				secret, _ = gotBody["data"].(map[string]any)
+			}
+			if secret["access_key"] != "ASIAEXAMPLE" || secret["security_token"] != "token" || secret["expiration"] != "2024-01-02T03:04:05Z" || secret["account"] != "111122223333" {
+				t.Errorf("wrote %v", gotBody)
+			}
+			if _, found := secret["region"]; found {
+				t.Errorf("wrote an empty region")
+			}
+		})
+	}
+}
+
+func TestVaultToken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("VAULT_TOKEN", "")
+
+	if _, err := vaultToken(); err == nil {
+		t.Error("got a token with none set")
+	}
+	err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte("s.saved\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := vaultToken(); err != nil || token != "s.saved" {
+		t.Errorf("got %q and %v, wanted the saved token", token, err)
+	}
+	t.Setenv("VAULT_TOKEN", "s.env")
+	if token, err := vaultToken(); err != nil || token != "s.env" {
+		t.Errorf("got %q and %v, wanted the token from the environment", token, err)
+	}
+}
@@ -0,0 +1,96 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Filesystem                                                                //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// IsReadOnly reports whether an error was caused by writing to a read-only
+// filesystem or a location the user lacks permission to write to.
+func IsReadOnly(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// StateDir returns a directory for transient state such as the encrypted file
+// cache. The preferred directory is used when it can be written to, otherwise
+// XDG_CACHE_HOME and then a directory of the user's own in the system temp
+// directory are tried, as is needed on managed machines and containers with
+// read-only home directories. The returned bool is true if a fallback was
+// used.
+func StateDir(preferred string) (string, bool) {
+	if IsWritableDir(preferred) {
+		return preferred, false
+	}
+
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		dir := filepath.Join(xdg, "kion-cli")
+		if IsWritableDir(dir) {
+			return dir, true
+		}
+	}
+	if dir, ok := privateTempDir(); ok {
+		return dir, true
+	}
+
+	// nothing better was found, let the caller surface any errors
+	return preferred, false
+}
+
+// privateTempDir returns a directory in the system temp directory only the
+// user can use, creating it if needed. The temp directory is shared with
+// other users on most systems, so a directory someone else created, or that
+// others can write to, is refused rather than trusted with the cache.
+func privateTempDir() (string, bool) {
+	dir := filepath.Join(os.TempDir(), tempDirName())
+	err := os.Mkdir(dir, 0700)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", false
+	}
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() || !isPrivate(info) || !IsWritableDir(dir) {
+		return "", false
+	}
+	return dir, true
+}
+
+// IsWritableDir reports whether files can be created in dir. If dir does not
+// exist yet its nearest existing parent is checked instead so nothing is
+// created as a side effect.
+func IsWritableDir(dir string) bool {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return false
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".kion-write-test-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return true
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package filesystem
+
+import "io/fs"
+
+// tempDirName names the user's directory in the temp directory.
+func tempDirName() string {
+	return "kion-cli"
+}
+
+// isPrivate reports whether a directory is the user's own. The temp
+// directory is already per user on Windows, within their profile.
+func isPrivate(info fs.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,99 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		want        bool
+	}{
+		{
+			"Permission Denied",
+			&fs.PathError{Op: "open", Path: "/home/user/.kion.yml", Err: syscall.EACCES},
+			true,
+		},
+		{
+			"Read-only Filesystem",
+			fmt.Errorf("saving cache: %w", &fs.PathError{Op: "open", Path: "/home/user/.kion", Err: syscall.EROFS}),
+			true,
+		},
+		{
+			"Other Error",
+			errors.New("connection refused"),
+			false,
+		},
+		{
+			"Nil",
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := IsReadOnly(test.err); got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	tmp := t.TempDir()
+	xdg := filepath.Join(tmp, "xdg")
+	t.Setenv("XDG_CACHE_HOME", xdg)
+
+	// a regular file standing in for the home directory can't hold state
+	blocked := filepath.Join(tmp, "home")
+	err := os.WriteFile(blocked, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description  string
+		preferred    string
+		want         string
+		wantFallback bool
+	}{
+		{
+			"Existing Directory",
+			tmp,
+			tmp,
+			false,
+		},
+		{
+			"Creatable Directory",
+			filepath.Join(tmp, "new", ".kion"),
+			filepath.Join(tmp, "new", ".kion"),
+			false,
+		},
+		{
+			"Unwritable Home",
+			filepath.Join(blocked, ".kion"),
+			filepath.Join(xdg, "kion-cli"),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, fallback := StateDir(test.preferred)
+			if got != test.want || fallback != test.wantFallback {
+				t.Errorf("\ngot:\n  %v %v\nwanted:\n  %v %v", got, fallback, test.want, test.wantFallback)
+			}
+			if _, err := os.Stat(filepath.Join(tmp, "new")); err == nil {
+				t.Errorf("checking %v created directories", test.preferred)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// tempDirName names the user's directory in the shared temp directory.
+func tempDirName() string {
+	return fmt.Sprintf("kion-cli-%v", os.Getuid())
+}
+
+// isPrivate reports whether a directory is owned by the user and closed to
+// everyone else.
+func isPrivate(info fs.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid() && info.Mode().Perm()&0077 == 0
+}
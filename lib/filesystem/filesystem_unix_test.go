@@ -0,0 +1,47 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivateTempDir(t *testing.T) {
+	tests := []struct {
+		description string
+		existing    os.FileMode
+		want        bool
+	}{
+		{"Created", 0, true},
+		{"Already Private", 0700, true},
+		{"Open To Others", 0777, false},
+		{"Group Writable", 0770, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			dir := filepath.Join(tmp, tempDirName())
+			if test.existing != 0 {
+				err := os.Mkdir(dir, 0700)
+				if err == nil {
+					err = os.Chmod(dir, test.existing)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, ok := privateTempDir()
+			if ok != test.want || (ok && got != dir) {
+				t.Fatalf("got %v %v, wanted %v", got, ok, test.want)
+			}
+			if info, err := os.Stat(dir); ok && (err != nil || info.Mode().Perm() != 0700) {
+				t.Errorf("created %v with %v", dir, info.Mode())
+			}
+		})
+	}
+}
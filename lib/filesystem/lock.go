@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Locks                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// LockHolder identifies the Kion CLI process holding a lock, so one waiting on
+// it can tell when a different version is sharing its state.
+type LockHolder struct {
+	PID      int       `json:"pid"`
+	Version  string    `json:"version"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// Lock is an advisory lock held by creating a file, which works the same on
+// every platform and filesystem.
+type Lock struct {
+	path string
+}
+
+// lockPoll is how often a held lock is checked while waiting on it.
+const lockPoll = 50 * time.Millisecond
+
+// AcquireLock creates the lock file at path recording holder, waiting up to
+// wait for another process to release it. Locks held for longer than stale
+// are assumed left behind by a process that died and are taken over. Each
+// different holder waited on is passed to waiting, such as to warn about
+// another version.
+func AcquireLock(path string, holder LockHolder, wait time.Duration, stale time.Duration, waiting func(LockHolder)) (*Lock, error) {
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	var seen LockHolder
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// see who holds it, a lock mid-write or just released reads empty
+		var current LockHolder
+		raw, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(raw, &current) == nil {
+			if time.Since(current.Acquired) > stale {
+				os.Remove(path)
+				continue
+			}
+			if current != seen {
+				seen = current
+				if waiting != nil {
+					waiting(current)
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for kion-cli %v (pid %v) to release %v", seen.Version, seen.PID, path)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// Release removes the lock file.
+func (l *Lock) Release() error {
+	return os.Remove(l.path)
+}
+
+// KeyLockPath returns the path in dir of the lock on fetching what is cached
+// under key in a cache namespace, one per namespace and key without naming
+// either.
+func KeyLockPath(dir string, namespace string, key string) string {
+	sum := sha256.Sum256([]byte(namespace + "\x00" + key))
+	return filepath.Join(dir, fmt.Sprintf("key-%x.lock", sum[:8]))
+}
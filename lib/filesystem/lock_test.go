@@ -0,0 +1,73 @@
+package filesystem
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.lock")
+	holder := LockHolder{PID: 1, Version: "v1.0.0", Acquired: time.Now()}
+
+	lock, err := AcquireLock(path, holder, time.Second, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another version waits on it, is told who holds it, and times out
+	var waitedOn []LockHolder
+	_, err = AcquireLock(path, LockHolder{PID: 2, Version: "v2.0.0", Acquired: time.Now()}, 100*time.Millisecond, time.Minute, func(other LockHolder) {
+		waitedOn = append(waitedOn, other)
+	})
+	if err == nil {
+		t.Error("acquired a held lock")
+	}
+	if len(waitedOn) != 1 || waitedOn[0].Version != "v1.0.0" || waitedOn[0].PID != 1 {
+		t.Errorf("got waited on %+v, wanted the holder once", waitedOn)
+	}
+
+	// released locks can be acquired again
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err = AcquireLock(path, holder, time.Second, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock left behind is taken over once stale
+	old := LockHolder{PID: 3, Version: "v1.0.0", Acquired: time.Now().Add(-time.Hour)}
+	_, err = AcquireLock(path, old, time.Second, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = AcquireLock(path, holder, 100*time.Millisecond, time.Minute, nil)
+	if err != nil {
+		t.Errorf("stale lock was not taken over: %v", err)
+	}
+}
+
+func TestKeyLockPath(t *testing.T) {
+	a := KeyLockPath("/cache", "kion.example.com/jane", "Admin-111122223333")
+	if filepath.Dir(a) != "/cache" || filepath.Ext(a) != ".lock" {
+		t.Errorf("got %v, wanted a lock file in /cache", a)
+	}
+	if a != KeyLockPath("/cache", "kion.example.com/jane", "Admin-111122223333") {
+		t.Error("got different paths for the same key")
+	}
+	for _, other := range []string{
+		KeyLockPath("/cache", "kion.example.com/jane", "ReadOnly-111122223333"),
+		KeyLockPath("/cache", "kion.example.com/john", "Admin-111122223333"),
+	} {
+		if other == a {
+			t.Errorf("got %v for a different key or namespace", other)
+		}
+	}
+}
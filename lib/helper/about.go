@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  About                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// PrintAbout prints the version and build provenance of the running binary.
+// If sbom is true the full dependency manifest embedded by the Go toolchain is
+// printed as well.
+func PrintAbout(w io.Writer, version string, info *debug.BuildInfo, sbom bool) error {
+	if version == "" {
+		version = "[unset]"
+	}
+	fmt.Fprintf(w, "Kion CLI %v\n", version)
+
+	if info == nil {
+		return fmt.Errorf("no build information embedded in this binary")
+	}
+
+	// print provenance from the build settings, sorted for stable output
+	fmt.Fprintf(w, "\nProvenance:\n")
+	fmt.Fprintf(w, "  %-20v %v\n", "module", info.Main.Path)
+	fmt.Fprintf(w, "  %-20v %v\n", "go", info.GoVersion)
+	settings := make(map[string]string)
+	var keys []string
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+		keys = append(keys, s.Key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %-20v %v\n", key, settings[key])
+	}
+
+	if !sbom {
+		return nil
+	}
+
+	// print the dependency manifest
+	fmt.Fprintf(w, "\nDependencies:\n")
+	for _, dep := range info.Deps {
+		// honor any replace directives that were in effect at build time
+		mod := dep
+		if dep.Replace != nil {
+			mod = dep.Replace
+		}
+		fmt.Fprintf(w, "  %v %v", mod.Path, mod.Version)
+		if mod.Sum != "" {
+			fmt.Fprintf(w, " %v", mod.Sum)
+		}
+		if dep.Replace != nil {
+			fmt.Fprintf(w, " (replaces %v %v)", dep.Path, dep.Version)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// UserAgent returns the User-Agent sent to Kion, identifying the CLI version
+// and platform followed by an optional organization specific suffix.
+func UserAgent(version string, suffix string) string {
+	if version == "" {
+		version = "unset"
+	}
+	agent := fmt.Sprintf("kion-cli/%v (%v; %v)", strings.TrimPrefix(version, "v"), runtime.GOOS, runtime.GOARCH)
+	if suffix = strings.TrimSpace(suffix); suffix != "" {
+		agent += " " + suffix
+	}
+	return agent
+}
@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	platform := fmt.Sprintf("(%v; %v)", runtime.GOOS, runtime.GOARCH)
+
+	tests := []struct {
+		description string
+		version     string
+		suffix      string
+		want        string
+	}{
+		{"Release", "v0.9.0", "", "kion-cli/0.9.0 " + platform},
+		{"Suffix", "0.9.0", " acme-platform/1 ", "kion-cli/0.9.0 " + platform + " acme-platform/1"},
+		{"Unset Version", "", "", "kion-cli/unset " + platform},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := UserAgent(test.version, test.suffix); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Access                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ExplainAccessDenied gathers what the authenticated user can see in Kion and
+// returns guidance on why access to the given cloud access role and account
+// was denied. The accessType should be either "cli" or "web".
+func ExplainAccessDenied(host string, token string, carName string, account string, accessType string) string {
+	// if we can't list our own cars the app role is the problem
+	cars, err := kion.GetCARS(host, token)
+	if err != nil {
+		if kion.IsStatus(err, 403) {
+			return "Your Kion application role does not allow you to list your cloud access roles. Ask a Kion administrator to review your app role permissions."
+		}
+		return ""
+	}
+
+	// see if we can view the project that owns the account
+	var projectName string
+	acc, _, err := kion.GetAccount(host, token, account)
+	if err == nil && acc != nil && acc.ProjectID != 0 {
+		project, err := kion.GetProjectByID(host, token, acc.ProjectID)
+		if err == nil {
+			projectName = project.Name
+		}
+	}
+
+	return DiagnoseAccess(cars, carName, account, accessType, projectName)
+}
+
+// DiagnoseAccess inspects the cloud access roles available to a user and
+// returns tailored guidance on why access to the given cloud access role and
+// account was denied. The projectName is optional and used to point users at
+// who can grant access.
+func DiagnoseAccess(cars []kion.CAR, carName string, account string, accessType string, projectName string) string {
+	// who to ask for access
+	owners := "the project owners"
+	if projectName != "" {
+		owners = fmt.Sprintf("the owners of the %q project", projectName)
+	}
+
+	var elsewhere []string
+	var onAccount []string
+	for _, car := range cars {
+		if car.AccountNumber == account {
+			if car.Name == carName {
+				return diagnoseHeldCAR(car, accessType, owners)
+			}
+			onAccount = append(onAccount, car.Name)
+		} else if car.Name == carName {
+			elsewhere = append(elsewhere, car.AccountNumber)
+		}
+	}
+	sort.Strings(onAccount)
+	sort.Strings(elsewhere)
+
+	switch {
+	case len(onAccount) > 0:
+		return fmt.Sprintf("You do not hold the %q cloud access role on account %v. Roles available to you on this account: %v. Use one of those or request %q from %v.", carName, account, strings.Join(onAccount, ", "), carName, owners)
+	case len(elsewhere) > 0:
+		return fmt.Sprintf("You hold the %q cloud access role on %v but not on account %v. Request access to the account from %v.", carName, strings.Join(elsewhere, ", "), account, owners)
+	default:
+		return fmt.Sprintf("You have no cloud access roles on account %v. Request access from %v or run 'kion stak' without flags to browse what you can access.", account, owners)
+	}
+}
+
+// RequireAccessLevel returns an error if a cloud access role does not offer
+// the given access level. Roles without reported access levels are let
+// through for Kion to decide.
+func RequireAccessLevel(car kion.CAR, level string) error {
+	levels := car.AccessLevels()
+	if len(levels) == 0 || slices.Contains(levels, level) {
+		return nil
+	}
+	return fmt.Errorf("the %q cloud access role on account %v offers %v access only, not %v", car.Name, car.AccountNumber, strings.Join(levels, ", "), level)
+}
+
+// RequireAWS returns an error if an account is known to belong to a cloud
+// other than AWS, for operations such as short term access keys that only
+// exist for AWS accounts. Accounts whose cloud is unknown are let through for
+// Kion to decide.
+func RequireAWS(cloud string, account string, operation string) error {
+	if cloud == "" || cloud == kion.CloudAWS {
+		return nil
+	}
+	return fmt.Errorf("account %v is a %v account, %v are only available for AWS accounts", account, CloudName(cloud), operation)
+}
+
+// CloudName returns the display name of a cloud provider.
+func CloudName(cloud string) string {
+	switch cloud {
+	case kion.CloudAWS:
+		return "AWS"
+	case kion.CloudAzure:
+		return "Azure"
+	case kion.CloudGCP:
+		return "GCP"
+	}
+	return cloud
+}
+
+// ValidateCloud returns an error if cloud is set and not a known cloud
+// provider.
+func ValidateCloud(cloud string) error {
+	if cloud == "" || slices.Contains(kion.Clouds(), cloud) {
+		return nil
+	}
+	return fmt.Errorf("unsupported cloud %q, expected one of %v", cloud, strings.Join(kion.Clouds(), ", "))
+}
+
+// diagnoseHeldCAR explains a denial for a cloud access role the user does
+// hold on the target account.
+func diagnoseHeldCAR(car kion.CAR, accessType string, owners string) string {
+	if accessType == "web" && !car.WebAccess {
+		return fmt.Sprintf("The %q cloud access role does not permit web console access. Ask %v to enable it or use 'kion stak' for CLI access.", car.Name, owners)
+	}
+	if accessType != "web" && !car.ShortTermAccessKeys {
+		return fmt.Sprintf("The %q cloud access role does not permit short-term access keys. Ask %v to enable them or use 'kion console' for web access.", car.Name, owners)
+	}
+	return fmt.Sprintf("You hold the %q cloud access role on account %v, so your Kion application role may not permit this action. Ask a Kion administrator to review your app role permissions.", car.Name, car.AccountNumber)
+}
@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestDiagnoseAccess(t *testing.T) {
+	noStak := kionTestCARs[0]
+	noStak.ShortTermAccessKeys = false
+
+	tests := []struct {
+		description string
+		cars        []kion.CAR
+		carName     string
+		account     string
+		accessType  string
+		project     string
+		want        string
+	}{
+		{
+			"No Roles On Account",
+			kionTestCARs[1:],
+			"car one",
+			"111111111111",
+			"cli",
+			"",
+			"You have no cloud access roles on account 111111111111",
+		},
+		{
+			"Role Held Elsewhere",
+			[]kion.CAR{kionTestCARs[1], {Name: "car one", AccountNumber: "999999999999"}},
+			"car one",
+			"131313131313",
+			"cli",
+			"project two",
+			"You hold the \"car one\" cloud access role on 999999999999 but not on account 131313131313. Request access to the account from the owners of the \"project two\" project.",
+		},
+		{
+			"Other Roles On Account",
+			kionTestCARs,
+			"car nine",
+			"111111111111",
+			"cli",
+			"",
+			"Roles available to you on this account: car one.",
+		},
+		{
+			"STAKs Disabled",
+			[]kion.CAR{noStak},
+			"car one",
+			"111111111111",
+			"cli",
+			"",
+			"does not permit short-term access keys",
+		},
+		{
+			"Held But Denied",
+			kionTestCARs,
+			"car one",
+			"111111111111",
+			"web",
+			"",
+			"your Kion application role may not permit this action",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := DiagnoseAccess(test.cars, test.carName, test.account, test.accessType, test.project)
+			if !strings.Contains(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted to contain:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequireAccessLevel(t *testing.T) {
+	tests := []struct {
+		description string
+		car         kion.CAR
+		level       string
+		wantErr     bool
+	}{
+		{
+			"Offered",
+			kion.CAR{Name: "Admin", ShortTermAccessKeys: true, WebAccess: true},
+			kion.AccessLevelWeb,
+			false,
+		},
+		{
+			"Not Offered",
+			kion.CAR{Name: "Admin", WebAccess: true},
+			kion.AccessLevelCLI,
+			true,
+		},
+		{
+			"Unreported",
+			kion.CAR{Name: "Admin"},
+			kion.AccessLevelCLI,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := RequireAccessLevel(test.car, test.level)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireAWS(t *testing.T) {
+	tests := []struct {
+		description string
+		cloud       string
+		wantErr     bool
+	}{
+		{"AWS", kion.CloudAWS, false},
+		{"Unknown", "", false},
+		{"Azure", kion.CloudAzure, true},
+		{"GCP", kion.CloudGCP, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := RequireAWS(test.cloud, "123", "short term access keys")
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
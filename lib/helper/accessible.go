@@ -0,0 +1,261 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Accessible Prompts                                                        //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// AccessibleOutput replaces the pickers with numbered plain text menus and
+// the progress spinner with a line per step, never moving the cursor or
+// redrawing, so screen readers can follow along. Set by the --accessible
+// flag.
+var AccessibleOutput bool
+
+// errNoAnswer is returned when input ends before a prompt is answered.
+var errNoAnswer = errors.New("no answer given, input ended")
+
+// accessibleInput is stdin, buffered once so answers typed ahead or piped in
+// aren't lost between prompts.
+var accessibleInput = sync.OnceValue(func() *bufio.Reader {
+	return bufio.NewReader(os.Stdin)
+})
+
+// accessiblePrompter asks questions one line at a time, reading answers from
+// r and writing everything else to w.
+type accessiblePrompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// newAccessiblePrompter returns a prompter reading stdin and writing stderr,
+// restricted to ASCII if ASCIIOutput is set.
+func newAccessiblePrompter() accessiblePrompter {
+	var w io.Writer = os.Stderr
+	if ASCIIOutput {
+		w = NewASCIIWriter(os.Stderr)
+	}
+	return accessiblePrompter{r: accessibleInput(), w: w}
+}
+
+// readLine reads the next answer without surrounding whitespace.
+func (p accessiblePrompter) readLine() (string, error) {
+	if NoInteractive {
+		return "", ErrNoInteractive
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errNoAnswer
+		}
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// list writes options as a numbered list, with descriptions and any selected
+// options marked.
+func (p accessiblePrompter) list(options []string, descriptions map[string]string, selected map[string]bool) {
+	for i, option := range options {
+		line := fmt.Sprintf("%v. %v", i+1, option)
+		if description := descriptions[option]; description != "" {
+			line += ", " + description
+		}
+		if selected[option] {
+			line += ", selected"
+		}
+		fmt.Fprintln(p.w, line)
+	}
+}
+
+// filter returns the options matching text as typing does in the pickers.
+func filter(options []string, terms map[string][]string, text string) []string {
+	var matches []string
+	for _, option := range options {
+		if matchesSearch(text, option, terms[option]) {
+			matches = append(matches, option)
+		}
+	}
+	return matches
+}
+
+// selectOne asks for one of options by its number. Anything else typed
+// filters the list, and an empty answer lists every option again.
+func (p accessiblePrompter) selectOne(message string, options []string, descriptions map[string]string, terms map[string][]string) (string, error) {
+	if len(options) == 0 {
+		return "", errors.New("nothing to choose from")
+	}
+	fmt.Fprintf(p.w, "%v %v options.\n", message, len(options))
+	shown := options
+	p.list(shown, descriptions, nil)
+	for {
+		fmt.Fprintf(p.w, "Enter a number from 1 to %v, or text to filter the list:\n", len(shown))
+		answer, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+
+		if answer == "" {
+			shown = options
+			fmt.Fprintf(p.w, "Showing all %v options.\n", len(shown))
+			p.list(shown, descriptions, nil)
+			continue
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n < 1 || n > len(shown) {
+				fmt.Fprintf(p.w, "%v is not in the list.\n", n)
+				continue
+			}
+			fmt.Fprintf(p.w, "Selected %v.\n", shown[n-1])
+			return shown[n-1], nil
+		}
+		matches := filter(options, terms, answer)
+		if len(matches) == 0 {
+			fmt.Fprintf(p.w, "No options match %v.\n", answer)
+			continue
+		}
+		shown = matches
+		fmt.Fprintf(p.w, "%v of %v options match %v.\n", len(shown), len(options), answer)
+		p.list(shown, descriptions, nil)
+	}
+}
+
+// selectMany asks for any number of options by their numbers, separated by
+// spaces or commas, with ranges such as 2-5 and the words all and none
+// understood. An empty answer keeps the defaults.
+func (p accessiblePrompter) selectMany(message string, options []string, defaults []string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, option := range defaults {
+		selected[option] = true
+	}
+	fmt.Fprintf(p.w, "%v %v options, %v selected.\n", message, len(options), len(defaults))
+	p.list(options, nil, selected)
+	for {
+		fmt.Fprintln(p.w, "Enter the numbers to select separated by spaces, such as 1 3 5-7, all, or none. Press enter to keep the selection:")
+		answer, err := p.readLine()
+		if err != nil {
+			return nil, err
+		}
+		chosen, err := parseSelection(answer, options, defaults)
+		if err != nil {
+			fmt.Fprintf(p.w, "%v.\n", err)
+			continue
+		}
+		if len(chosen) == 0 {
+			fmt.Fprintln(p.w, "Selected none.")
+		} else {
+			fmt.Fprintf(p.w, "Selected %v: %v.\n", len(chosen), strings.Join(chosen, ", "))
+		}
+		return chosen, nil
+	}
+}
+
+// parseSelection returns the options picked by an answer to selectMany, in
+// the order they are listed.
+func parseSelection(answer string, options []string, defaults []string) ([]string, error) {
+	picked := make(map[string]bool)
+	switch strings.ToLower(answer) {
+	case "":
+		for _, option := range defaults {
+			picked[option] = true
+		}
+	case "all":
+		for _, option := range options {
+			picked[option] = true
+		}
+	case "none":
+	default:
+		fields := strings.FieldsFunc(answer, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		for _, field := range fields {
+			first, last, isRange := strings.Cut(field, "-")
+			from, err := strconv.Atoi(first)
+			to := from
+			if err == nil && isRange {
+				to, err = strconv.Atoi(last)
+			}
+			if err != nil || from < 1 || to > len(options) || from > to {
+				return nil, fmt.Errorf("%v is not a number from 1 to %v", field, len(options))
+			}
+			for n := from; n <= to; n++ {
+				picked[options[n-1]] = true
+			}
+		}
+	}
+
+	chosen := []string{}
+	for _, option := range options {
+		if picked[option] {
+			chosen = append(chosen, option)
+		}
+	}
+	return chosen, nil
+}
+
+// input asks for a line of text, asking again until one is given.
+func (p accessiblePrompter) input(message string) (string, error) {
+	for {
+		fmt.Fprintln(p.w, message)
+		answer, err := p.readLine()
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(p.w, "An answer is required.")
+	}
+}
+
+// password asks for a secret, which isn't echoed when read from a terminal.
+func (p accessiblePrompter) password(message string) (string, error) {
+	if NoInteractive {
+		return "", ErrNoInteractive
+	}
+	for {
+		fmt.Fprintln(p.w, message)
+		var answer string
+		var err error
+		if term.IsTerminal(int(os.Stdin.Fd())) && p.r == accessibleInput() {
+			var secret []byte
+			secret, err = term.ReadPassword(int(os.Stdin.Fd()))
+			answer = strings.TrimSpace(string(secret))
+			fmt.Fprintln(p.w)
+		} else {
+			answer, err = p.readLine()
+		}
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(p.w, "An answer is required.")
+	}
+}
+
+// confirm asks a yes or no question, defaulting to no.
+func (p accessiblePrompter) confirm(message string) (bool, error) {
+	for {
+		fmt.Fprintf(p.w, "%v Enter yes or no, no if left empty:\n", message)
+		answer, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true, nil
+		case "", "n", "no":
+			return false, nil
+		}
+		fmt.Fprintf(p.w, "%v is not yes or no.\n", answer)
+	}
+}
@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPrompter returns a prompter answering with input and the buffer its
+// questions are written to.
+func testPrompter(input string) (accessiblePrompter, *bytes.Buffer) {
+	var b bytes.Buffer
+	return accessiblePrompter{r: bufio.NewReader(strings.NewReader(input)), w: &b}, &b
+}
+
+func TestAccessibleSelect(t *testing.T) {
+	options := []string{"Data Lake (Prod)", "Data Lake (Dev)", "Payments"}
+	descriptions := map[string]string{"Payments": "project 12"}
+
+	tests := []struct {
+		description string
+		input       string
+		want        string
+		wantOutput  []string
+		wantErr     bool
+	}{
+		{"By Number", "3\n", "Payments", []string{"Choose: 3 options.", "3. Payments, project 12", "Selected Payments."}, false},
+		{"Filtered", "dlprd\n1\n", "Data Lake (Prod)", []string{"1 of 3 options match dlprd.", "Selected Data Lake (Prod)."}, false},
+		{"Out Of Range", "4\n2\n", "Data Lake (Dev)", []string{"4 is not in the list."}, false},
+		{"No Matches", "zzz\n\n1\n", "Data Lake (Prod)", []string{"No options match zzz.", "Showing all 3 options."}, false},
+		{"Input Ends", "", "", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			p, b := testPrompter(test.input)
+			got, err := p.selectOne("Choose:", options, descriptions, nil)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+			for _, line := range test.wantOutput {
+				if !strings.Contains(b.String(), line+"\n") {
+					t.Errorf("output is missing %q:\n%v", line, b.String())
+				}
+			}
+			if strings.ContainsAny(b.String(), "\r\033") {
+				t.Errorf("output redraws the terminal:\n%q", b.String())
+			}
+		})
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	options := []string{"a", "b", "c", "d", "e"}
+	defaults := []string{"b"}
+
+	tests := []struct {
+		description string
+		answer      string
+		want        []string
+		wantErr     bool
+	}{
+		{"Keep Defaults", "", []string{"b"}, false},
+		{"All", "all", options, false},
+		{"None", "NONE", []string{}, false},
+		{"Numbers And Ranges", "5, 1 2-3", []string{"a", "b", "c", "e"}, false},
+		{"Out Of Range", "6", nil, true},
+		{"Backwards Range", "3-1", nil, true},
+		{"Not A Number", "b", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := parseSelection(test.answer, options, defaults)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccessibleConfirm(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        bool
+	}{
+		{"Yes", "yes\n", true},
+		{"Default", "\n", false},
+		{"Asked Again", "maybe\ny\n", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			p, _ := testPrompter(test.input)
+			got, err := p.confirm("Continue?")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccessibleInput(t *testing.T) {
+	p, b := testPrompter("\n  jane  \n")
+	got, err := p.input("Username:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "jane" {
+		t.Errorf("got %q, wanted jane", got)
+	}
+	if !strings.Contains(b.String(), "An answer is required.\n") {
+		t.Errorf("empty answer wasn't refused:\n%v", b.String())
+	}
+}
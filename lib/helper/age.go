@@ -0,0 +1,163 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Age                                                                       //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// The parts of the age format, age-encryption.org/v1, used to recognize files
+// and recipients. Only X25519 recipients are supported, those written age1...
+const (
+	ageIntro        = "age-encryption.org/v1"
+	ageRecipientHRP = "age"
+	ageChunkSize    = 64 * 1024
+)
+
+// ageScheme hands off credentials encrypted to age recipients.
+type ageScheme struct{}
+
+func (ageScheme) Name() string { return "age" }
+
+func (ageScheme) Accepts(recipient string) bool {
+	return strings.HasPrefix(recipient, ageRecipientHRP+"1")
+}
+
+func (ageScheme) Encrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(armor.Header)) || bytes.HasPrefix(data, []byte(ageIntro+"\n"))
+}
+
+// Encrypt encrypts plaintext to the age recipients, armored so it can be
+// pasted as text.
+func (ageScheme) Encrypt(recipients []string, plaintext []byte) ([]byte, error) {
+	keys := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		key, err := ParseAgeRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sealed, err := ageEncrypt(keys, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	w := armor.NewWriter(&out)
+	_, err = w.Write(sealed)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Decrypt decrypts data, armored or not, with the identities in the age
+// identity file named by identity.
+func (ageScheme) Decrypt(data []byte, identity string) ([]byte, error) {
+	if identity == "" {
+		return nil, errors.New("an age identity file is required to decrypt, pass --identity")
+	}
+	contents, err := os.ReadFile(identity)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseAgeIdentities(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the identity file %v: %w", identity, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		data, err = io.ReadAll(armor.NewReader(bytes.NewReader(bytes.TrimSpace(data))))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age armor: %w", err)
+		}
+	}
+	return ageDecrypt(keys, data)
+}
+
+// NewAgeIdentity returns a new age identity, written AGE-SECRET-KEY-1..., and
+// the recipient encrypting to it, written age1....
+func NewAgeIdentity() (string, string, error) {
+	key, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", err
+	}
+	return key.String(), key.Recipient().String(), nil
+}
+
+// ParseAgeRecipient reads an age X25519 recipient, age1....
+func ParseAgeRecipient(recipient string) (*age.X25519Recipient, error) {
+	key, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q", recipient)
+	}
+	return key, nil
+}
+
+// ParseAgeIdentities reads the identities of an age identity file, one
+// AGE-SECRET-KEY-1... per line with blank lines and # comments ignored.
+func ParseAgeIdentities(contents string) ([]age.Identity, error) {
+	keys, err := age.ParseIdentities(strings.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ageEncrypt encrypts plaintext to the recipients, unarmored.
+func ageEncrypt(recipients []age.Recipient, plaintext []byte) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients given")
+	}
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ageDecrypt decrypts unarmored data with whichever of the identities it was
+// encrypted to.
+func ageDecrypt(identities []age.Identity, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(ageIntro+"\n")) {
+		return nil, errors.New("not age encrypted")
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, errors.New("not encrypted to any of the given identities")
+		}
+		return nil, fmt.Errorf("the age header has been altered: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("the age payload has been altered or truncated: %w", err)
+	}
+	return plaintext, nil
+}
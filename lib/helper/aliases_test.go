@@ -0,0 +1,77 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		description string
+		line        string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			"Plain",
+			"stak --fav payments-admin  --print",
+			[]string{"stak", "--fav", "payments-admin", "--print"},
+			false,
+		},
+		{
+			"Quotes",
+			`run --car "Read Only" --account '111 222' -- echo "it's"`,
+			[]string{"run", "--car", "Read Only", "--account", "111 222", "--", "echo", "it's"},
+			false,
+		},
+		{
+			"Escapes",
+			`favorite data\ lake ""`,
+			[]string{"favorite", "data lake", ""},
+			false,
+		},
+		{
+			"Unterminated Quote",
+			`favorite "prod`,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SplitCommandLine(test.line)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJoinCommandLine(t *testing.T) {
+	tests := []struct {
+		description string
+		args        []string
+		want        string
+	}{
+		{"Plain", []string{"stak", "--account", "111122223333", "--car", "Admin"}, "stak --account 111122223333 --car Admin"},
+		{"Spaces", []string{"console", "111122223333/Payments Admin"}, "console '111122223333/Payments Admin'"},
+		{"Quotes", []string{"favorite", "it's", ""}, `favorite 'it'\''s' ''`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := JoinCommandLine(test.args)
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+			split, err := SplitCommandLine(got)
+			if err != nil || !reflect.DeepEqual(split, test.args) {
+				t.Errorf("split back into %q, %v", split, err)
+			}
+		})
+	}
+}
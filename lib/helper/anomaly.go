@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Unusual Access                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Kinds of unusual access, recorded in the audit log once warned about.
+const (
+	AnomalyDormantAccount = "dormant_account"
+	AnomalyLongDuration   = "long_duration"
+)
+
+// Defaults for the thresholds of unusual access warnings.
+const (
+	DefaultDormantDays  = 90
+	DefaultLongDuration = 12 * time.Hour
+)
+
+// AnomalyThresholds are the limits beyond which access is unusual.
+type AnomalyThresholds struct {
+	// DormantAfter is how long an account goes unused before using it again
+	// is warned about.
+	DormantAfter time.Duration
+	// LongDuration is how long short-term access keys may be issued for
+	// before they are warned about.
+	LongDuration time.Duration
+}
+
+// Anomaly is a warning about unusual access.
+type Anomaly struct {
+	Kind    string
+	Message string
+}
+
+// AccessAnomalies checks the use of a cloud access role on an account of the
+// given Kion against the history in the audit log, as a nudge against
+// reaching for the wrong account. Using an account unused for longer than
+// DormantAfter is unusual, as is a role issuing keys valid for longer than
+// LongDuration the first time it is seen to. An account never used is only
+// unusual once the audit log covers DormantAfter, so new installs are quiet.
+// A zero issued duration skips the duration check.
+func AccessAnomalies(entries []AuditEntry, kionURL string, account string, carName string, issued time.Duration, thresholds AnomalyThresholds, now time.Time) []Anomaly {
+	var anomalies []Anomaly
+	var earliest, lastUsed time.Time
+	var warnedDuration bool
+	key := UsageKey(account, carName)
+	for _, entry := range entries {
+		if entry.Kion != kionURL {
+			continue
+		}
+		if earliest.IsZero() || entry.Time.Before(earliest) {
+			earliest = entry.Time
+		}
+		if entry.Account == account && !entry.Failed() && entry.Time.After(lastUsed) {
+			lastUsed = entry.Time
+		}
+		if UsageKey(entry.Account, entry.CAR) == key && slices.Contains(entry.Anomalies, AnomalyLongDuration) {
+			warnedDuration = true
+		}
+	}
+
+	dormantDays := int(thresholds.DormantAfter.Hours() / 24)
+	switch {
+	case thresholds.DormantAfter <= 0:
+		// dormant account warnings are off
+	case !lastUsed.IsZero() && now.Sub(lastUsed) >= thresholds.DormantAfter:
+		anomalies = append(anomalies, Anomaly{
+			Kind:    AnomalyDormantAccount,
+			Message: fmt.Sprintf("account %v was last used from this machine %v days ago, check it is the account you meant", account, int(now.Sub(lastUsed).Hours()/24)),
+		})
+	case lastUsed.IsZero() && !earliest.IsZero() && now.Sub(earliest) >= thresholds.DormantAfter:
+		anomalies = append(anomalies, Anomaly{
+			Kind:    AnomalyDormantAccount,
+			Message: fmt.Sprintf("account %v has not been used from this machine in at least %v days, check it is the account you meant", account, dormantDays),
+		})
+	}
+
+	if thresholds.LongDuration > 0 && issued > thresholds.LongDuration && !warnedDuration {
+		anomalies = append(anomalies, Anomaly{
+			Kind:    AnomalyLongDuration,
+			Message: fmt.Sprintf("short-term access keys for %v on account %v are valid for %v, longer than the usual %v", carName, account, issued, thresholds.LongDuration),
+		})
+	}
+
+	return anomalies
+}
@@ -0,0 +1,122 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAccessAnomalies(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	kionURL := "https://kion.example"
+	thresholds := AnomalyThresholds{DormantAfter: 90 * 24 * time.Hour, LongDuration: 12 * time.Hour}
+	daysAgo := func(days int) time.Time { return now.Add(-time.Duration(days) * 24 * time.Hour) }
+
+	tests := []struct {
+		description string
+		entries     []AuditEntry
+		account     string
+		issued      time.Duration
+		thresholds  AnomalyThresholds
+		want        []string
+	}{
+		{
+			"Recently Used",
+			[]AuditEntry{{Time: daysAgo(5), Kion: kionURL, Account: "111", CAR: "Admin"}},
+			"111",
+			time.Hour,
+			thresholds,
+			nil,
+		},
+		{
+			"Dormant Account",
+			[]AuditEntry{{Time: daysAgo(120), Kion: kionURL, Account: "111", CAR: "Admin"}},
+			"111",
+			time.Hour,
+			thresholds,
+			[]string{AnomalyDormantAccount},
+		},
+		{
+			"Dormant Account Other Role",
+			[]AuditEntry{
+				{Time: daysAgo(120), Kion: kionURL, Account: "111", CAR: "Admin"},
+				{Time: daysAgo(1), Kion: kionURL, Account: "111", CAR: "ReadOnly"},
+			},
+			"111",
+			0,
+			thresholds,
+			nil,
+		},
+		{
+			"Only Failed Recently",
+			[]AuditEntry{
+				{Time: daysAgo(120), Kion: kionURL, Account: "111", CAR: "Admin"},
+				{Time: daysAgo(1), Kion: kionURL, Account: "111", CAR: "Admin", Result: AuditFailure},
+			},
+			"111",
+			0,
+			thresholds,
+			[]string{AnomalyDormantAccount},
+		},
+		{
+			"Never Used With Long History",
+			[]AuditEntry{{Time: daysAgo(200), Kion: kionURL, Account: "222", CAR: "Admin"}},
+			"111",
+			0,
+			thresholds,
+			[]string{AnomalyDormantAccount},
+		},
+		{
+			"Never Used With Short History",
+			[]AuditEntry{{Time: daysAgo(10), Kion: kionURL, Account: "222", CAR: "Admin"}},
+			"111",
+			0,
+			thresholds,
+			nil,
+		},
+		{
+			"Other Kion",
+			[]AuditEntry{{Time: daysAgo(200), Kion: "https://other.example", Account: "111", CAR: "Admin"}},
+			"111",
+			0,
+			thresholds,
+			nil,
+		},
+		{
+			"Long Duration",
+			[]AuditEntry{{Time: daysAgo(1), Kion: kionURL, Account: "111", CAR: "Admin"}},
+			"111",
+			36 * time.Hour,
+			thresholds,
+			[]string{AnomalyLongDuration},
+		},
+		{
+			"Long Duration Warned Before",
+			[]AuditEntry{{Time: daysAgo(1), Kion: kionURL, Account: "111", CAR: "Admin", Anomalies: []string{AnomalyLongDuration}}},
+			"111",
+			36 * time.Hour,
+			thresholds,
+			nil,
+		},
+		{
+			"Thresholds Off",
+			[]AuditEntry{{Time: daysAgo(120), Kion: kionURL, Account: "111", CAR: "Admin"}},
+			"111",
+			36 * time.Hour,
+			AnomalyThresholds{},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got []string
+			for _, anomaly := range AccessAnomalies(test.entries, kionURL, test.account, "Admin", test.issued, test.thresholds, now) {
+				got = append(got, anomaly.Kind)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  ASCII Output                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ASCIIOutput restricts prompts, progress, and text output to ASCII for
+// terminals, such as those behind some jump hosts, that corrupt UTF-8. Set by
+// the --ascii flag.
+var ASCIIOutput bool
+
+// asciiReplacements are ASCII stand ins for characters likely to turn up in
+// names from Kion or in terminal drawing. Anything else outside of ASCII is
+// shown as a question mark.
+var asciiReplacements = map[rune]string{
+	// punctuation and spaces
+	'‘': "'", '’': "'", '‚': "'", '“': `"`, '”': `"`, '„': `"`,
+	'–': "-", '—': "-", '‒': "-", '−': "-", '…': "...", '•': "*", '·': ".",
+	'«': "<<", '»': ">>", '‹': "<", '›': ">", '→': "->", '←': "<-",
+	'\u00a0': " ", '\u2009': " ", '\u200b': "", '\ufeff': "",
+	'©': "(c)", '®': "(R)", '™': "(TM)", '×': "x", '°': "o",
+
+	// box drawing
+	'─': "-", '━': "-", '│': "|", '┃': "|",
+	'┌': "+", '┐': "+", '└': "+", '┘': "+", '├': "+", '┤': "+", '┬': "+", '┴': "+", '┼': "+",
+	'╭': "+", '╮': "+", '╰': "+", '╯': "+",
+
+	// spinners and marks
+	'✓': "v", '✔': "v", '✗': "x", '✘': "x", '◯': "o", '◉': "*", '●': "*", '○': "o", '❯': ">", '▸': ">", '►': ">",
+
+	// latin letters with diacritics
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ý': "Y", 'Þ': "TH", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'þ': "th", 'ÿ': "y",
+	'Ł': "L", 'ł': "l", 'Œ': "OE", 'œ': "oe", 'Š': "S", 'š': "s", 'Ž': "Z", 'ž': "z",
+}
+
+// ToASCII replaces everything outside of ASCII in s with an ASCII stand in.
+// Control characters other than tabs, newlines, carriage returns, and the
+// escape starting terminal sequences are dropped.
+func ToASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r' || r == '\033':
+			b.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			// drop other control characters
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		default:
+			replacement, found := asciiReplacements[r]
+			if !found {
+				replacement = "?"
+			}
+			b.WriteString(replacement)
+		}
+	}
+	return b.String()
+}
+
+// ValidateASCII returns an error locating the first character of s that ToASCII
+// would not pass through, anything other than printable ASCII, tabs, newlines,
+// carriage returns, and escapes.
+func ValidateASCII(s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\t' || c == '\n' || c == '\r' || c == '\033' || (c >= ' ' && c < 0x7f) {
+			continue
+		}
+		return fmt.Errorf("output contains %q at byte %v, outside of ASCII", c, i)
+	}
+	return nil
+}
+
+// OutputWriter returns w restricted to ASCII if ASCIIOutput is set and format
+// is read by people. JSON, YAML, and env output are left as is since they are
+// parsed by other tools, which expect the names Kion returned.
+func OutputWriter(w io.Writer, format string) io.Writer {
+	if !ASCIIOutput || format == "json" || format == "yaml" || format == "env" {
+		return w
+	}
+	if _, ok := w.(*ASCIIWriter); ok {
+		return w
+	}
+	return NewASCIIWriter(w)
+}
+
+// ASCIIWriter passes everything written through ToASCII and ValidateASCII
+// before writing it on to the wrapped writer. Characters split across writes are held back until
+// they are complete.
+type ASCIIWriter struct {
+	w       io.Writer
+	mu      sync.Mutex
+	pending []byte
+}
+
+// NewASCIIWriter returns an ASCIIWriter writing to w.
+func NewASCIIWriter(w io.Writer) *ASCIIWriter {
+	return &ASCIIWriter{w: w}
+}
+
+// Write implements io.Writer, reporting all of p as written once it has been
+// converted and passed on.
+func (a *ASCIIWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data := append(a.pending, p...)
+	a.pending = nil
+
+	// hold back an incomplete character at the end for the next write
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				a.pending = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+
+	converted := ToASCII(string(data))
+	if err := ValidateASCII(converted); err != nil {
+		return 0, err
+	}
+	_, err := io.WriteString(a.w, converted)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ASCIIFile is an ASCIIWriter over a file that still exposes the file
+// descriptor, so terminal prompts can draw through it.
+type ASCIIFile struct {
+	*ASCIIWriter
+	fd uintptr
+}
+
+// NewASCIIFile returns an ASCIIFile writing to the file f.
+func NewASCIIFile(f interface {
+	io.Writer
+	Fd() uintptr
+}) *ASCIIFile {
+	return &ASCIIFile{ASCIIWriter: NewASCIIWriter(f), fd: f.Fd()}
+}
+
+// Fd returns the file descriptor of the wrapped file.
+func (a *ASCIIFile) Fd() uintptr {
+	return a.fd
+}
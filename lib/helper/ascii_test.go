@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        string
+	}{
+		{"Plain", "Admin - 111122223333", "Admin - 111122223333"},
+		{"Accents", "Équipe Données", "Equipe Donnees"},
+		{"Punctuation", "Prod — “legacy”…", `Prod - "legacy"...`},
+		{"Box Drawing", "┌─┐\n│x│", "+-+\n|x|"},
+		{"Unknown", "開発 Sandbox", "?? Sandbox"},
+		{"Escapes Kept", "\033[1mbold\033[0m\r\033[K", "\033[1mbold\033[0m\r\033[K"},
+		{"Controls Dropped", "a\x00b\x07c", "abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := ToASCII(test.input); got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestASCIIWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewASCIIWriter(&out)
+
+	// a character split across writes is converted once complete
+	data := []byte("café ok")
+	split := bytes.IndexByte(data, 0xc3) + 1
+	for _, chunk := range [][]byte{data[:split], data[split:]} {
+		n, err := w.Write(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(chunk) {
+			t.Errorf("wrote %v of %v bytes", n, len(chunk))
+		}
+	}
+	if got := out.String(); got != "cafe ok" {
+		t.Errorf("got %q, wanted %q", got, "cafe ok")
+	}
+}
+
+func TestValidateASCII(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		wantErr     bool
+	}{
+		{"Plain", "Admin - 111122223333\n", false},
+		{"Escapes", "\033[32mok\033[0m\r\t", false},
+		{"Accent", "Équipe", true},
+		{"Control", "a\x07b", true},
+		{"Delete", "a\x7fb", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := ValidateASCII(test.input)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutputWriter(t *testing.T) {
+	ASCIIOutput = true
+	defer func() { ASCIIOutput = false }()
+
+	names := []string{"Équipe Données", "開発 Sandbox", "Prod — “legacy”", "tab\tbell\x07"}
+	result := struct {
+		Name string `json:"name" yaml:"name"`
+	}{names[0]}
+
+	tests := []struct {
+		description string
+		format      string
+		wantASCII   bool
+	}{
+		{"Text", "text", true},
+		{"JSON", "json", false},
+		{"YAML", "yaml", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out bytes.Buffer
+			err := WriteOutput(&out, test.format, result, func(w io.Writer) error {
+				table := NewTable("NAME")
+				for _, name := range names {
+					table.AddRow(name)
+				}
+				return table.Write(w)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateASCII(out.String()); (err == nil) != test.wantASCII {
+				t.Errorf("got %q, wanted ASCII %v", out.String(), test.wantASCII)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SAML Assertions                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SAMLExpectations are what the configuration expects of a SAML response, used
+// to point out mismatches when printing one. Empty values aren't checked.
+type SAMLExpectations struct {
+	// Issuer is the entity id from the identity provider's metadata.
+	Issuer string
+	// Audience is the service provider issuer configured in Kion.
+	Audience string
+}
+
+// SAMLProblems returns likely causes of a failed sign in found in a SAML
+// response: an unsuccessful status, an invalid signature, being used outside
+// of its validity window, or an issuer or audience that doesn't match what
+// was expected.
+func SAMLProblems(a kion.SAMLAssertion, expect SAMLExpectations, now time.Time) []string {
+	var problems []string
+	if a.Status != "" && !strings.HasPrefix(a.Status, "Success") {
+		problems = append(problems, fmt.Sprintf("the identity provider reported %v", a.Status))
+	}
+	if a.Signature == kion.SignatureInvalid {
+		problems = append(problems, "the signature doesn't verify against the metadata certificates, the metadata may be out of date")
+	}
+	if a.Signature == kion.SignatureMissing && !a.Encrypted {
+		problems = append(problems, "neither the response nor the assertion is signed")
+	}
+	if !a.NotOnOrAfter.IsZero() && !now.Before(a.NotOnOrAfter) {
+		problems = append(problems, fmt.Sprintf("the assertion expired %v ago", now.Sub(a.NotOnOrAfter).Round(time.Second)))
+	}
+	if !a.NotBefore.IsZero() && now.Before(a.NotBefore) {
+		problems = append(problems, fmt.Sprintf("the assertion is not valid for another %v, check the clocks", a.NotBefore.Sub(now).Round(time.Second)))
+	}
+	if expect.Issuer != "" && a.Issuer != "" && a.Issuer != expect.Issuer {
+		problems = append(problems, fmt.Sprintf("issued by %v but the metadata is for %v", a.Issuer, expect.Issuer))
+	}
+	if expect.Audience != "" && len(a.Audiences) > 0 && !slices.Contains(a.Audiences, expect.Audience) {
+		problems = append(problems, fmt.Sprintf("the audience doesn't include the configured saml_sp_issuer %v", expect.Audience))
+	}
+	return problems
+}
+
+// PrintSAMLAssertion writes a summary of a SAML response followed by any
+// problems found with it. Times are shown relative to now.
+func PrintSAMLAssertion(w io.Writer, a kion.SAMLAssertion, expect SAMLExpectations, now time.Time) {
+	field := func(label string, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-16v%v\n", label+":", value)
+		}
+	}
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		if t.After(now) {
+			return fmt.Sprintf("%v (in %v)", t.UTC().Format(time.RFC3339), t.Sub(now).Round(time.Second))
+		}
+		return fmt.Sprintf("%v (%v ago)", t.UTC().Format(time.RFC3339), now.Sub(t).Round(time.Second))
+	}
+
+	field("Status", a.Status)
+	field("Destination", a.Destination)
+	field("Issuer", a.Issuer)
+	field("Issued", when(a.IssueInstant))
+	field("Subject", a.Subject)
+	field("Audience", strings.Join(a.Audiences, ", "))
+	field("NotBefore", when(a.NotBefore))
+	field("NotOnOrAfter", when(a.NotOnOrAfter))
+
+	signature := a.Signature
+	if a.SignedElement != "" {
+		signature += " on the " + a.SignedElement
+	}
+	if a.SignatureDetail != "" {
+		signature += ", " + a.SignatureDetail
+	}
+	field("Signature", signature)
+	if a.Encrypted {
+		field("Assertion", "encrypted, only the response can be inspected")
+	}
+
+	if len(a.Attributes) > 0 {
+		fmt.Fprintln(w, "Attributes:")
+		for _, attr := range a.Attributes {
+			fmt.Fprintf(w, "  %v: %v\n", attr.Name, strings.Join(attr.Values, ", "))
+		}
+	}
+
+	problems := SAMLProblems(a, expect, now)
+	if len(problems) > 0 {
+		fmt.Fprintln(w, "Problems:")
+		for _, problem := range problems {
+			fmt.Fprintf(w, "  - %v\n", problem)
+		}
+	}
+}
+
+// SAMLReplayHint explains the outcome of replaying a SAML response to Kion,
+// pointing at the identity provider or Kion as the likely culprit.
+func SAMLReplayHint(err error) string {
+	var exchangeErr *kion.SAMLExchangeError
+	switch {
+	case err == nil:
+		return "Kion accepted the response and issued a session, so the identity provider and Kion agree. Look at how the browser reaches the local callback instead."
+	case !errors.As(err, &exchangeErr):
+		return ""
+	case exchangeErr.Step == kion.SAMLStepCSRF || exchangeErr.Step == kion.SAMLStepCallback:
+		return "The response never reached Kion, check kion.url and run kion util connectivity."
+	case errors.Is(err, kion.ErrSAMLResponseFormat):
+		return "Kion replied in a format this version of the CLI doesn't recognize, which usually means Kion was upgraded. Update the CLI, and report the response above if the latest release fails too."
+	case exchangeErr.Step == kion.SAMLStepSSOCode:
+		return "Kion rejected the response. Expired or already used responses are always rejected, so capture a fresh one if the summary shows it expired. Otherwise compare the issuer, audience, and certificate in Kion's SAML settings with the identity provider's."
+	default:
+		return "Kion accepted the response but didn't exchange it for a session, which points at Kion rather than the identity provider."
+	}
+}
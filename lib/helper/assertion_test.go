@@ -0,0 +1,90 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestSAMLProblems(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	good := kion.SAMLAssertion{
+		Status:       "Success",
+		Issuer:       "https://idp.example",
+		Audiences:    []string{"https://kion.example/api/v1/saml/auth/1"},
+		NotBefore:    now.Add(-time.Minute),
+		NotOnOrAfter: now.Add(4 * time.Minute),
+		Signature:    kion.SignatureValid,
+	}
+	expect := SAMLExpectations{Issuer: "https://idp.example", Audience: "https://kion.example/api/v1/saml/auth/1"}
+
+	tests := []struct {
+		description string
+		change      func(a *kion.SAMLAssertion)
+		expect      SAMLExpectations
+		want        []string
+	}{
+		{"None", func(a *kion.SAMLAssertion) {}, expect, nil},
+		{
+			"Failed Status",
+			func(a *kion.SAMLAssertion) { a.Status = "Responder: user not assigned" },
+			expect,
+			[]string{"the identity provider reported Responder: user not assigned"},
+		},
+		{
+			"Invalid Signature",
+			func(a *kion.SAMLAssertion) { a.Signature = kion.SignatureInvalid },
+			expect,
+			[]string{"the signature doesn't verify against the metadata certificates, the metadata may be out of date"},
+		},
+		{
+			"Unsigned",
+			func(a *kion.SAMLAssertion) { a.Signature = kion.SignatureMissing },
+			expect,
+			[]string{"neither the response nor the assertion is signed"},
+		},
+		{
+			"Expired",
+			func(a *kion.SAMLAssertion) { a.NotOnOrAfter = now.Add(-90 * time.Second) },
+			expect,
+			[]string{"the assertion expired 1m30s ago"},
+		},
+		{
+			"Not Yet Valid",
+			func(a *kion.SAMLAssertion) { a.NotBefore = now.Add(2 * time.Minute) },
+			expect,
+			[]string{"the assertion is not valid for another 2m0s, check the clocks"},
+		},
+		{
+			"Mismatches",
+			func(a *kion.SAMLAssertion) {
+				a.Issuer = "https://old-idp.example"
+				a.Audiences = []string{"kion"}
+			},
+			expect,
+			[]string{
+				"issued by https://old-idp.example but the metadata is for https://idp.example",
+				"the audience doesn't include the configured saml_sp_issuer https://kion.example/api/v1/saml/auth/1",
+			},
+		},
+		{
+			"Nothing Expected",
+			func(a *kion.SAMLAssertion) { a.Audiences = []string{"kion"} },
+			SAMLExpectations{},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			a := good
+			test.change(&a)
+			got := SAMLProblems(a, test.expect, now)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Audit Log                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Results of the attempts recorded in the audit log.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEntry records a single use of a cloud access role, or a failed attempt
+// at one. Entries are kept one JSON object per line in a local audit log and
+// never include credentials.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Kion    string    `json:"kion_url"`
+	Action  string    `json:"action"`
+	Account string    `json:"account"`
+	CAR     string    `json:"cloud_access_role"`
+	// AccessLevel is how the role was used, either "cli" or "web".
+	AccessLevel string `json:"access_level,omitempty"`
+	// Result is AuditSuccess or AuditFailure. Entries written before results
+	// were recorded have none and were all successes.
+	Result string `json:"result,omitempty"`
+	// ErrorClass broadly categorizes why a failed attempt failed, see
+	// AuditErrorClass.
+	ErrorClass string `json:"error_class,omitempty"`
+	// DurationMS is how long the command took up to the point the role was
+	// used or the attempt failed, in milliseconds.
+	DurationMS int64 `json:"duration_ms,omitempty"`
+	// RequestIDs are the ids Kion assigned to the requests the command made,
+	// for matching up with Kion's server logs.
+	RequestIDs []string `json:"request_ids,omitempty"`
+	// DeviceID identifies the machine the role was used from, see DeviceID.
+	DeviceID string `json:"device_id,omitempty"`
+	// Anomalies are the kinds of unusual access the user was warned about,
+	// see AccessAnomalies.
+	Anomalies []string `json:"anomalies,omitempty"`
+	// PinOverride is set when the account is pinned on this workstation and
+	// --force was passed to use it anyway.
+	PinOverride bool `json:"pin_override,omitempty"`
+	// Reason and ElevatedUntil record why elevated access was taken with
+	// kion elevate and when it ends.
+	Reason        string     `json:"reason,omitempty"`
+	ElevatedUntil *time.Time `json:"elevated_until,omitempty"`
+}
+
+// Failed reports whether the entry records a failed attempt.
+func (e AuditEntry) Failed() bool {
+	return e.Result == AuditFailure
+}
+
+// AuditErrorClass broadly categorizes an error for the audit log so failures
+// can be counted without parsing messages: "unreachable" when Kion could not
+// be reached, "unauthorized", "forbidden", "not_found", "rate_limited", or
+// "api_error" for other responses from Kion, "canceled" when the user gave
+// up, and "other" for everything else.
+func AuditErrorClass(err error) string {
+	var apiErr *kion.APIError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case kion.IsUnreachable(err):
+		return "unreachable"
+	case errors.As(err, &apiErr):
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized:
+			return "unauthorized"
+		case http.StatusForbidden:
+			return "forbidden"
+		case http.StatusNotFound:
+			return "not_found"
+		case http.StatusTooManyRequests:
+			return "rate_limited"
+		}
+		return "api_error"
+	}
+	return "other"
+}
+
+// AppendAudit adds an entry to the audit log at path, creating it readable
+// only by the user if needed.
+func AppendAudit(path string, entry AuditEntry) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// ReadAudit returns the entries in the audit log at path. A missing log has
+// no entries and lines that can't be parsed are skipped.
+func ReadAudit(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// LastUsed returns the most recent successful use of each cloud access role
+// on the given Kion, keyed by account number and cloud access role name as
+// built by UsageKey.
+func LastUsed(entries []AuditEntry, kionURL string) map[string]time.Time {
+	lastUsed := make(map[string]time.Time)
+	for _, entry := range entries {
+		if entry.Kion != kionURL || entry.Failed() {
+			continue
+		}
+		key := UsageKey(entry.Account, entry.CAR)
+		if entry.Time.After(lastUsed[key]) {
+			lastUsed[key] = entry.Time
+		}
+	}
+	return lastUsed
+}
+
+// LastAccount returns the account most recently accessed on the given Kion,
+// or an empty string if there is none. Failed attempts are ignored.
+func LastAccount(entries []AuditEntry, kionURL string) string {
+	var account string
+	var last time.Time
+	for _, entry := range entries {
+		if entry.Kion == kionURL && !entry.Failed() && !entry.Time.Before(last) {
+			account = entry.Account
+			last = entry.Time
+		}
+	}
+	return account
+}
+
+// UsageKey identifies a cloud access role on an account in LastUsed.
+func UsageKey(account string, carName string) string {
+	return account + "/" + carName
+}
@@ -0,0 +1,116 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.log")
+	first := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := first.Add(time.Hour)
+
+	entries := []AuditEntry{
+		{Time: first, Kion: "https://kion.example", Action: "print", Account: "111111111111", CAR: "Admin"},
+		{Time: later, Kion: "https://kion.example", Action: "web", Account: "111111111111", CAR: "Admin"},
+		{Time: later, Kion: "https://other.example", Action: "print", Account: "222222222222", CAR: "Admin"},
+		{Time: later.Add(time.Hour), Kion: "https://kion.example", Action: "stak", Account: "111111111111", CAR: "Admin", Result: AuditFailure, ErrorClass: "forbidden", DurationMS: 1500, RequestIDs: []string{"req-1", "req-2"}},
+	}
+	for _, entry := range entries {
+		err := AppendAudit(path, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got permissions %v, wanted 0600", info.Mode().Perm())
+	}
+
+	got, err := ReadAudit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, entries)
+	}
+
+	wantLastUsed := map[string]time.Time{UsageKey("111111111111", "Admin"): later}
+	lastUsed := LastUsed(got, "https://kion.example")
+	if !reflect.DeepEqual(lastUsed, wantLastUsed) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", lastUsed, wantLastUsed)
+	}
+
+	// a missing log has no entries
+	missing, err := ReadAudit(filepath.Join(t.TempDir(), "missing.log"))
+	if err != nil || missing != nil {
+		t.Errorf("got %v and %v for a missing log", missing, err)
+	}
+}
+
+func TestLastAccount(t *testing.T) {
+	first := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{Time: first.Add(time.Hour), Kion: "https://kion.example", Account: "222222222222"},
+		{Time: first, Kion: "https://kion.example", Account: "111111111111"},
+		{Time: first.Add(2 * time.Hour), Kion: "https://other.example", Account: "333333333333"},
+	}
+
+	tests := []struct {
+		description string
+		kionURL     string
+		want        string
+	}{
+		{"Most Recent", "https://kion.example", "222222222222"},
+		{"Other Kion", "https://other.example", "333333333333"},
+		{"None", "https://new.example", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := LastAccount(entries, test.kionURL); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuditErrorClass(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		want        string
+	}{
+		{"No Error", nil, ""},
+		{"Canceled", fmt.Errorf("prompt: %w", context.Canceled), "canceled"},
+		{"Unreachable", &url.Error{Op: "Get", URL: "https://kion.example", Err: errors.New("connection refused")}, "unreachable"},
+		{"Gateway", &kion.APIError{StatusCode: 503}, "unreachable"},
+		{"Unauthorized", &kion.APIError{StatusCode: 401}, "unauthorized"},
+		{"Forbidden", fmt.Errorf("wrapped: %w", &kion.APIError{StatusCode: 403}), "forbidden"},
+		{"Not Found", &kion.APIError{StatusCode: 404}, "not_found"},
+		{"Rate Limited", &kion.APIError{StatusCode: 429}, "rate_limited"},
+		{"Other Status", &kion.APIError{StatusCode: 500}, "api_error"},
+		{"Other", errors.New("no favorite found"), "other"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := AuditErrorClass(test.err); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
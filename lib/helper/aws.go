@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS API                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// awsEndpoint returns the base url of an AWS service in a region. It is a
+// variable so tests can point requests at a local server.
+var awsEndpoint = func(service string, region string) string {
+	host := fmt.Sprintf("%v.%v.amazonaws.com", service, region)
+	if strings.HasPrefix(region, "cn-") {
+		host += ".cn"
+	}
+	return "https://" + host
+}
+
+// InvokeLambda synchronously invokes a Lambda function with the given payload
+// using short term access keys and returns the function's response. Errors
+// raised by the function itself are returned as errors.
+func InvokeLambda(stak kion.STAK, region string, function string, payload []byte) ([]byte, error) {
+	endpoint := fmt.Sprintf("%v/2015-03-31/functions/%v/invocations", awsEndpoint("lambda", region), awsURIEncode(function))
+	resp, body, err := awsRequest(stak, region, "lambda", endpoint, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	if functionError := resp.Header.Get("X-Amz-Function-Error"); functionError != "" {
+		return nil, fmt.Errorf("lambda %v failed (%v): %s", function, functionError, body)
+	}
+	return body, nil
+}
+
+// GetSSMParameter returns the decrypted value of an SSM parameter using short
+// term access keys.
+func GetSSMParameter(stak kion.STAK, region string, name string) (string, error) {
+	payload, err := json.Marshal(map[string]any{"Name": name, "WithDecryption": true})
+	if err != nil {
+		return "", err
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AmazonSSM.GetParameter",
+	}
+	_, body, err := awsRequest(stak, region, "ssm", awsEndpoint("ssm", region)+"/", headers, payload)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return "", fmt.Errorf("unexpected response for ssm parameter %v: %w", name, err)
+	}
+	return result.Parameter.Value, nil
+}
+
+// PutSSMParameter stores value as an encrypted SSM parameter using short term
+// access keys, replacing any earlier value.
+func PutSSMParameter(stak kion.STAK, region string, name string, value string) error {
+	payload, err := json.Marshal(map[string]any{"Name": name, "Value": value, "Type": "SecureString", "Overwrite": true})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AmazonSSM.PutParameter",
+	}
+	_, _, err = awsRequest(stak, region, "ssm", awsEndpoint("ssm", region)+"/", headers, payload)
+	return err
+}
+
+// awsRequest sends a signed POST request to an AWS service and returns the
+// response along with its body, or an error if the status is not a success.
+func awsRequest(stak kion.STAK, region string, service string, endpoint string, headers map[string]string, payload []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	signAWSRequest(req, payload, stak, region, service, time.Now())
+
+	resp, err := kion.ExternalClient(0).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("%v request failed with status %v: %s", service, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp, body, nil
+}
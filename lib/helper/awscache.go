@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS CLI Cache                                                             //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// awsCLICachePrefix marks files in the AWS CLI cache written by Kion CLI so
+// they can be cleaned up without touching entries written by the AWS CLI.
+const awsCLICachePrefix = "kion-"
+
+// AWSCLICacheEntry is the format the AWS CLI caches assumed role credentials
+// in, as read by tools that look for credentials in ~/.aws/cli/cache.
+type AWSCLICacheEntry struct {
+	Credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      string
+	}
+}
+
+// AWSCLICacheDir returns the directory the AWS CLI caches credentials in.
+func AWSCLICacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "cli", "cache"), nil
+}
+
+// awsCLICacheFile returns the file credentials for a cloud access role on an
+// account are mirrored to. Names are hashed as the AWS CLI does so that role
+// names never need escaping.
+func awsCLICacheFile(dir string, account string, carName string) string {
+	sum := sha1.Sum([]byte(account + "/" + carName))
+	return filepath.Join(dir, awsCLICachePrefix+hex.EncodeToString(sum[:])+".json")
+}
+
+// WriteAWSCLICache mirrors a STAK into the AWS CLI cache directory. Entries
+// written earlier that have since expired are removed.
+func WriteAWSCLICache(dir string, account string, carName string, stak kion.STAK) error {
+	var entry AWSCLICacheEntry
+	entry.Credentials.AccessKeyId = stak.AccessKey
+	entry.Credentials.SecretAccessKey = stak.SecretAccessKey
+	entry.Credentials.SessionToken = stak.SessionToken
+	entry.Credentials.Expiration = stak.Expiration.UTC().Format(time.RFC3339)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	err = removeAWSCLICache(dir, true)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so readers never see a partial entry
+	path := awsCLICacheFile(dir, account, carName)
+	tmp, err := os.CreateTemp(dir, ".kion-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RemoveAWSCLICache removes every entry Kion CLI mirrored into the AWS CLI
+// cache directory, leaving those written by the AWS CLI alone.
+func RemoveAWSCLICache(dir string) error {
+	return removeAWSCLICache(dir, false)
+}
+
+// removeAWSCLICache removes entries Kion CLI mirrored into the AWS CLI cache
+// directory, only those that have expired if expiredOnly is set.
+func removeAWSCLICache(dir string, expiredOnly bool) error {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), awsCLICachePrefix) || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if expiredOnly && !awsCLICacheExpired(path) {
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// awsCLICacheExpired reports whether a mirrored entry has expired, treating
+// entries that can't be read as expired.
+func awsCLICacheExpired(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return true
+	}
+	var entry AWSCLICacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return true
+	}
+	expiration, err := time.Parse(time.RFC3339, entry.Credentials.Expiration)
+	return err != nil || time.Now().After(expiration)
+}
@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestWriteAWSCLICache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cli", "cache")
+	expiration := time.Date(2099, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// an entry from the aws cli and an expired one from kion cli
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	awsEntry := filepath.Join(dir, "0123abcd.json")
+	err = os.WriteFile(awsEntry, []byte(`{}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := awsCLICacheFile(dir, "222222222222", "ReadOnly")
+	err = os.WriteFile(expired, []byte(`{"Credentials":{"Expiration":"2020-01-01T00:00:00Z"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stak := kion.STAK{AccessKey: "AKIA", SecretAccessKey: "secret", SessionToken: "token", Expiration: expiration}
+	err = WriteAWSCLICache(dir, "111111111111", "Admin", stak)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := awsCLICacheFile(dir, "111111111111", "Admin")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry AWSCLICacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Credentials.AccessKeyId != "AKIA" || entry.Credentials.SessionToken != "token" || entry.Credentials.Expiration != "2099-06-01T12:00:00Z" {
+		t.Errorf("unexpected entry: %s", data)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Error("expired entry was not removed")
+	}
+
+	err = RemoveAWSCLICache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("mirrored entry was not removed")
+	}
+	if _, err := os.Stat(awsEntry); err != nil {
+		t.Error("aws cli entry was removed")
+	}
+}
@@ -0,0 +1,157 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS Config                                                                //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// awsConfigBegin and awsConfigEnd mark the block of the AWS config file that
+// is managed by Kion CLI. Everything between them is replaced on each sync.
+const (
+	awsConfigBegin = "# BEGIN kion-cli managed block, changes will be overwritten"
+	awsConfigEnd   = "# END kion-cli managed block"
+)
+
+// AWSConfigPath returns the path of the AWS config file, honoring
+// AWS_CONFIG_FILE as the AWS CLI does.
+func AWSConfigPath() (string, error) {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "config"), nil
+}
+
+// AWSProfile is a profile in the AWS config file that sources credentials
+// from a Kion favorite.
+type AWSProfile struct {
+	Name     string
+	Favorite string
+	Region   string
+}
+
+// AWSProfiles returns a profile for every favorite that provides short term
+// access keys. Favorites that only open the web console or are on accounts
+// outside of AWS are skipped, as are any whose profile name is already
+// defined outside of the managed block. Favorites matching their account by
+// glob or alias are skipped and returned as dynamic, since resolving them
+// can prompt for an account where the AWS SDK running the credential
+// process has no terminal to answer it.
+func AWSProfiles(favorites []structs.Favorite, prefix string, existing []string) (profiles []AWSProfile, skipped []string, dynamic []string) {
+	for _, fav := range favorites {
+		if cloud := FavoriteCloud(fav); fav.AccessType == "web" || (cloud != "" && cloud != kion.CloudAWS) {
+			continue
+		}
+		if IsDynamicFavorite(fav) {
+			dynamic = append(dynamic, fav.Name)
+			continue
+		}
+		name := prefix + fav.Name
+		if slices.Contains(existing, name) {
+			skipped = append(skipped, name)
+			continue
+		}
+		profiles = append(profiles, AWSProfile{Name: name, Favorite: fav.Name, Region: fav.Region})
+	}
+	return profiles, skipped, dynamic
+}
+
+// AWSConfigBlock renders the managed block of profiles. Each profile sources
+// credentials with the credential process of the given Kion CLI executable,
+// adding the Kion CLI profile when one is in use.
+func AWSConfigBlock(profiles []AWSProfile, executable string, kionProfile string) string {
+	command := quoteCommandArg(executable)
+	if kionProfile != "" {
+		command += " --profile " + quoteCommandArg(kionProfile)
+	}
+
+	var b strings.Builder
+	b.WriteString(awsConfigBegin + "\n")
+	for _, profile := range profiles {
+		fmt.Fprintf(&b, "\n[profile %v]\n", profile.Name)
+		fmt.Fprintf(&b, "credential_process = %v favorite --credential-process %v\n", command, quoteCommandArg(profile.Favorite))
+		if profile.Region != "" {
+			fmt.Fprintf(&b, "region = %v\n", profile.Region)
+		}
+	}
+	b.WriteString("\n" + awsConfigEnd + "\n")
+	return b.String()
+}
+
+// quoteCommandArg wraps arguments containing spaces in double quotes, which
+// the AWS CLI and SDKs honor when splitting credential_process.
+func quoteCommandArg(arg string) string {
+	if strings.ContainsAny(arg, " \t") {
+		return `"` + arg + `"`
+	}
+	return arg
+}
+
+// UnmanagedAWSProfiles returns the names of profiles defined in an AWS config
+// file outside of the managed block.
+func UnmanagedAWSProfiles(contents string) []string {
+	var names []string
+	managed := false
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == awsConfigBegin:
+			managed = true
+		case line == awsConfigEnd:
+			managed = false
+		case !managed && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ReplaceAWSConfigBlock returns the AWS config file contents with the managed
+// block replaced by block, or with block appended if there is none yet.
+// Everything outside of the block is left untouched so repeated syncs only
+// ever change the block.
+func ReplaceAWSConfigBlock(contents string, block string) (string, error) {
+	begin := strings.Index(contents, awsConfigBegin)
+	end := strings.Index(contents, awsConfigEnd)
+	switch {
+	case begin == -1 && end == -1:
+		if contents != "" && !strings.HasSuffix(contents, "\n") {
+			contents += "\n"
+		}
+		if contents != "" {
+			contents += "\n"
+		}
+		return contents + block, nil
+	case begin == -1 || end < begin:
+		return "", errors.New("the kion-cli managed block markers are mismatched, remove them and try again")
+	}
+
+	// drop the end marker and its line ending
+	end += len(awsConfigEnd)
+	if strings.HasPrefix(contents[end:], "\r\n") {
+		end += 2
+	} else if strings.HasPrefix(contents[end:], "\n") {
+		end++
+	}
+	return contents[:begin] + block + contents[end:], nil
+}
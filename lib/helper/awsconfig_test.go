@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestAWSConfigBlock(t *testing.T) {
+	favorites := []structs.Favorite{
+		{Name: "sandbox", Region: "us-east-1"},
+		{Name: "prod"},
+		{Name: "console", AccessType: "web"},
+		{Name: "data lake"},
+		{Name: "azure", Account: "3f2504e0-4f89-11d3-9a0c-0305e82c3301"},
+		{Name: "gcp", Cloud: "gcp"},
+		{Name: "any sandbox", Account: "1111*"},
+		{Name: "staging", AccountAlias: "staging"},
+	}
+
+	profiles, skipped, dynamic := AWSProfiles(favorites, "kion-", []string{"default", "kion-prod"})
+	if !reflect.DeepEqual(skipped, []string{"kion-prod"}) {
+		t.Errorf("\ngot skipped:\n  %v\nwanted:\n  %v", skipped, []string{"kion-prod"})
+	}
+	if !reflect.DeepEqual(dynamic, []string{"any sandbox", "staging"}) {
+		t.Errorf("\ngot dynamic:\n  %v\nwanted:\n  %v", dynamic, []string{"any sandbox", "staging"})
+	}
+
+	want := `# BEGIN kion-cli managed block, changes will be overwritten
+
+[profile kion-sandbox]
+credential_process = "/opt/kion cli/kion" --profile dev favorite --credential-process sandbox
+region = us-east-1
+
+[profile kion-data lake]
+credential_process = "/opt/kion cli/kion" --profile dev favorite --credential-process "data lake"
+
+# END kion-cli managed block
+`
+	got := AWSConfigBlock(profiles, "/opt/kion cli/kion", "dev")
+	if got != want {
+		t.Errorf("\ngot:\n%v\nwanted:\n%v", got, want)
+	}
+}
+
+func TestReplaceAWSConfigBlock(t *testing.T) {
+	block := awsConfigBegin + "\n[profile new]\n" + awsConfigEnd + "\n"
+
+	tests := []struct {
+		description string
+		contents    string
+		want        string
+		wantErr     bool
+	}{
+		{
+			"Empty File",
+			"",
+			block,
+			false,
+		},
+		{
+			"Append",
+			"[default]\nregion = us-east-1",
+			"[default]\nregion = us-east-1\n\n" + block,
+			false,
+		},
+		{
+			"Replace",
+			"[default]\n\n" + awsConfigBegin + "\n[profile old]\n" + awsConfigEnd + "\n\n[profile mine]\n",
+			"[default]\n\n" + block + "\n[profile mine]\n",
+			false,
+		},
+		{
+			"Mismatched Markers",
+			"[default]\n" + awsConfigEnd + "\n" + awsConfigBegin + "\n",
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ReplaceAWSConfigBlock(test.contents, block)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n%q\nwanted:\n%q", got, test.want)
+			}
+
+			// syncing again must not change anything
+			if err == nil {
+				again, _ := ReplaceAWSConfigBlock(got, block)
+				if again != got {
+					t.Errorf("not idempotent:\n%q", again)
+				}
+			}
+		})
+	}
+}
+
+func TestUnmanagedAWSProfiles(t *testing.T) {
+	contents := "[default]\n[profile mine]\n" + awsConfigBegin + "\n[profile managed]\n" + awsConfigEnd + "\n[sso-session corp]\n"
+	want := []string{"default", "mine", "sso-session corp"}
+	got := UnmanagedAWSProfiles(contents)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS Console Federation                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// awsConsoleEndpoint is where an AWS partition signs in federated users and
+// serves its console.
+type awsConsoleEndpoint struct {
+	signin  string
+	console string
+}
+
+// awsConsoleEndpoints are the console endpoints of the Kion account types of
+// the AWS partitions, commercial when the type isn't known.
+var awsConsoleEndpoints = map[uint]awsConsoleEndpoint{
+	1: {"https://signin.aws.amazon.com", "https://console.aws.amazon.com"},
+	2: {"https://signin.amazonaws-us-gov.com", "https://console.amazonaws-us-gov.com"},
+	4: {"http://signin.c2shome.ic.gov", "http://console.c2shome.ic.gov"},
+	5: {"http://signin.sc2shome.sgov.gov", "http://console.sc2shome.sgov.gov"},
+}
+
+// consoleIssuer identifies Kion CLI to AWS as the issuer of sign in links.
+const consoleIssuer = "kion-cli"
+
+// consoleService matches the console path of an AWS service, such as ec2 or
+// cloudwatch.
+var consoleService = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// awsConsoleEndpointFor returns the console endpoints of an account type.
+func awsConsoleEndpointFor(typeID uint) awsConsoleEndpoint {
+	endpoint, found := awsConsoleEndpoints[typeID]
+	if !found {
+		return awsConsoleEndpoints[1]
+	}
+	return endpoint
+}
+
+// AWSConsoleDestination returns the console page of an AWS service in the
+// partition of an account type, the console home page if service is empty.
+func AWSConsoleDestination(typeID uint, service string) (string, error) {
+	if service == "" {
+		service = "console"
+	}
+	if !consoleService.MatchString(service) {
+		return "", fmt.Errorf("invalid AWS service %q, expected a console path such as ec2 or s3", service)
+	}
+	return fmt.Sprintf("%v/%v/home", awsConsoleEndpointFor(typeID).console, service), nil
+}
+
+// SetConsoleDestination points an AWS federation sign in link at a different
+// console page.
+func SetConsoleDestination(link string, destination string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	if query.Get("Destination") == "" {
+		return "", errors.New("the console link has no destination to deep link from")
+	}
+	query.Set("Destination", destination)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// AWSConsoleURL exchanges short term access keys for a link signing in to the
+// AWS console at destination, in the partition of an account type. The link
+// is good for 15 minutes and the session lasts until the keys expire.
+func AWSConsoleURL(stak kion.STAK, typeID uint, destination string) (string, error) {
+	return awsConsoleURL(awsConsoleEndpointFor(typeID).signin, stak, destination)
+}
+
+// awsConsoleURL asks the federation endpoint at signin for a sign in token
+// and builds the login link from it.
+func awsConsoleURL(signin string, stak kion.STAK, destination string) (string, error) {
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    stak.AccessKey,
+		"sessionKey":   stak.SecretAccessKey,
+		"sessionToken": stak.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(session))
+	client := kion.ExternalClient(30 * time.Second)
+	res, err := client.Get(fmt.Sprintf("%v/federation?%v", signin, query.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("unable to request a console sign in token: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to request a console sign in token: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to request a console sign in token: status %v", res.StatusCode)
+	}
+
+	var token struct {
+		SigninToken string
+	}
+	err = json.Unmarshal(body, &token)
+	if err != nil || token.SigninToken == "" {
+		return "", errors.New("unable to request a console sign in token: no token was returned")
+	}
+
+	query = url.Values{}
+	query.Set("Action", "login")
+	query.Set("Issuer", consoleIssuer)
+	query.Set("Destination", destination)
+	query.Set("SigninToken", token.SigninToken)
+	return fmt.Sprintf("%v/federation?%v", signin, query.Encode()), nil
+}
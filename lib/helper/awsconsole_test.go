@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestAWSConsoleDestination(t *testing.T) {
+	tests := []struct {
+		description string
+		typeID      uint
+		service     string
+		want        string
+		wantErr     bool
+	}{
+		{"Home", 1, "", "https://console.aws.amazon.com/console/home", false},
+		{"Service", 1, "ec2", "https://console.aws.amazon.com/ec2/home", false},
+		{"GovCloud", 2, "s3", "https://console.amazonaws-us-gov.com/s3/home", false},
+		{"Unknown Type", 0, "iam", "https://console.aws.amazon.com/iam/home", false},
+		{"Invalid Service", 1, "ec2/../iam", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := AWSConsoleDestination(test.typeID, test.service)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetConsoleDestination(t *testing.T) {
+	link := "https://signin.aws.amazon.com/federation?Action=login&Destination=https%3A%2F%2Fconsole.aws.amazon.com%2F&SigninToken=abc"
+	got, err := SetConsoleDestination(link, "https://console.aws.amazon.com/ec2/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("Destination") != "https://console.aws.amazon.com/ec2/home" || query.Get("SigninToken") != "abc" {
+		t.Errorf("got %v, wanted the destination replaced and the token kept", got)
+	}
+
+	_, err = SetConsoleDestination("https://portal.azure.com/", "https://console.aws.amazon.com/ec2/home")
+	if err == nil {
+		t.Error("got no error for a link without a destination")
+	}
+}
+
+func TestAWSConsoleURL(t *testing.T) {
+	stak := kion.STAK{AccessKey: "ASIA", SecretAccessKey: "secret", SessionToken: "token"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var session map[string]string
+		err := json.Unmarshal([]byte(r.URL.Query().Get("Session")), &session)
+		if r.URL.Path != "/federation" || r.URL.Query().Get("Action") != "getSigninToken" || err != nil ||
+			session["sessionId"] != "ASIA" || session["sessionKey"] != "secret" || session["sessionToken"] != "token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"SigninToken":"signin-token"}`))
+	}))
+	defer server.Close()
+
+	got, err := awsConsoleURL(server.URL, stak, "https://console.aws.amazon.com/ec2/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("Action") != "login" || query.Get("SigninToken") != "signin-token" ||
+		query.Get("Destination") != "https://console.aws.amazon.com/ec2/home" || query.Get("Issuer") != consoleIssuer {
+		t.Errorf("got unexpected sign in link %v", got)
+	}
+
+	_, err = awsConsoleURL(server.URL, kion.STAK{}, "https://console.aws.amazon.com/")
+	if err == nil {
+		t.Error("got no error when the sign in token was refused")
+	}
+}
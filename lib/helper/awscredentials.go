@@ -0,0 +1,246 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS Credentials                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// awsCredentialsMarker starts the comment above each profile Kion CLI writes
+// to the AWS credentials file, followed by when its keys expire, so expired
+// profiles can be cleaned up without touching any others.
+const awsCredentialsMarker = "# kion-cli managed profile"
+
+// awsCredentialKeys are the settings of a profile Kion CLI replaces, others
+// such as region are kept.
+var awsCredentialKeys = []string{"aws_access_key_id", "aws_secret_access_key", "aws_session_token"}
+
+// AWSCredentialsPath returns the path of the AWS shared credentials file,
+// honoring AWS_SHARED_CREDENTIALS_FILE as the AWS CLI does.
+func AWSCredentialsPath() (string, error) {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "credentials"), nil
+}
+
+// AWSProfileName returns the profile short term access keys for a cloud
+// access role are saved as when no name is given, ACCOUNT_ROLE.
+func AWSProfileName(car kion.CAR) string {
+	return fmt.Sprintf("%v_%v", car.AccountNumber, car.AwsIamRoleName)
+}
+
+// awsCredentialsSection is a profile in the AWS credentials file, spanning
+// lines start to end, including the marker above it when Kion CLI wrote it.
+type awsCredentialsSection struct {
+	name    string
+	start   int
+	end     int
+	managed bool
+	expires time.Time
+}
+
+// awsCredentialsSections returns the profiles in the lines of an AWS
+// credentials file.
+func awsCredentialsSections(lines []string) []awsCredentialsSection {
+	var sections []awsCredentialsSection
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+		section := awsCredentialsSection{name: strings.TrimSpace(line[1 : len(line)-1]), start: i}
+		if i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), awsCredentialsMarker) {
+			section.start, section.managed = i-1, true
+			_, expires, _ := strings.Cut(strings.TrimSpace(lines[i-1]), ", expires ")
+			section.expires, _ = time.Parse(time.RFC3339, expires)
+		}
+		if len(sections) > 0 {
+			sections[len(sections)-1].end = section.start
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) > 0 {
+		sections[len(sections)-1].end = len(lines)
+	}
+	return sections
+}
+
+// splitAWSCredentials splits the contents of an AWS credentials file into
+// lines, returning the line ending in use so it is kept when writing.
+func splitAWSCredentials(contents string) ([]string, string) {
+	eol := "\n"
+	if strings.Contains(contents, "\r\n") {
+		eol = "\r\n"
+	}
+	contents = strings.TrimSuffix(contents, eol)
+	if contents == "" {
+		return nil, eol
+	}
+	return strings.Split(contents, eol), eol
+}
+
+// joinAWSCredentials joins the lines of an AWS credentials file.
+func joinAWSCredentials(lines []string, eol string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, eol) + eol
+}
+
+// SetAWSCredentials returns the contents of an AWS credentials file with the
+// named profile holding stak, marked with when it expires. Other profiles are
+// left untouched, as are settings other than the keys in an existing
+// profile. A profile Kion CLI didn't write is only replaced if replace is
+// set, it may hold long term keys.
+func SetAWSCredentials(contents string, name string, stak kion.STAK, replace bool) (string, error) {
+	if name == "" || strings.ContainsAny(name, "[]\r\n") {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	lines, eol := splitAWSCredentials(contents)
+
+	marker := awsCredentialsMarker
+	if !stak.Expiration.IsZero() {
+		marker += ", expires " + stak.Expiration.UTC().Format(time.RFC3339)
+	}
+	profile := []string{
+		marker,
+		"[" + name + "]",
+		"aws_access_key_id=" + stak.AccessKey,
+		"aws_secret_access_key=" + stak.SecretAccessKey,
+		"aws_session_token=" + stak.SessionToken,
+	}
+
+	for _, section := range awsCredentialsSections(lines) {
+		if section.name != name {
+			continue
+		}
+		if !section.managed && !replace {
+			return "", fmt.Errorf("profile %v wasn't written by Kion CLI and may hold long term keys, remove it or choose another name", name)
+		}
+		// keep settings other than the keys, and the blank lines after them
+		var kept []string
+		for _, line := range lines[section.start:section.end] {
+			key, _, found := strings.Cut(line, "=")
+			trimmed := strings.TrimSpace(line)
+			if (found && isAWSCredentialKey(strings.TrimSpace(key))) || strings.HasPrefix(trimmed, awsCredentialsMarker) || trimmed == "["+name+"]" {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		updated := append(append(append([]string{}, lines[:section.start]...), profile...), kept...)
+		return joinAWSCredentials(append(updated, lines[section.end:]...), eol), nil
+	}
+
+	// append a new profile, separated from the last by a blank line
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+		lines = append(lines, "")
+	}
+	return joinAWSCredentials(append(lines, profile...), eol), nil
+}
+
+// isAWSCredentialKey reports whether key is one of the keys Kion CLI writes.
+func isAWSCredentialKey(key string) bool {
+	for _, credentialKey := range awsCredentialKeys {
+		if strings.EqualFold(key, credentialKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanAWSCredentials returns the contents of an AWS credentials file without
+// the profiles Kion CLI wrote whose keys have expired by now, or all of them
+// if all is set, along with the names of the profiles removed. Profiles
+// written by anything else are never removed.
+func CleanAWSCredentials(contents string, now time.Time, all bool) (string, []string) {
+	lines, eol := splitAWSCredentials(contents)
+	var removed []string
+	var kept []string
+	last := 0
+	for _, section := range awsCredentialsSections(lines) {
+		if !section.managed || (!all && (section.expires.IsZero() || section.expires.After(now))) {
+			continue
+		}
+		kept = append(kept, lines[last:section.start]...)
+		last = section.end
+		removed = append(removed, section.name)
+	}
+	kept = append(kept, lines[last:]...)
+
+	// drop blank lines left at the end
+	for len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+		kept = kept[:len(kept)-1]
+	}
+	return joinAWSCredentials(kept, eol), removed
+}
+
+// ReadAWSCredentials returns the contents of the AWS credentials file at
+// path, empty if there is none yet.
+func ReadAWSCredentials(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// WriteAWSCredentials replaces the AWS credentials file at path with
+// contents, readable only by the user. The file is written then renamed into
+// place so tools reading it never see a partial file.
+func WriteAWSCredentials(path string, contents string) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".kion-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(contents)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SaveAWSProfile writes stak to the named profile in the AWS credentials
+// file, see SetAWSCredentials, returning the path of the file.
+func SaveAWSProfile(name string, stak kion.STAK, replace bool) (string, error) {
+	path, err := AWSCredentialsPath()
+	if err != nil {
+		return "", err
+	}
+	contents, err := ReadAWSCredentials(path)
+	if err != nil {
+		return "", err
+	}
+	updated, err := SetAWSCredentials(contents, name, stak, replace)
+	if err != nil {
+		return "", fmt.Errorf("unable to update %v: %w", path, err)
+	}
+	return path, WriteAWSCredentials(path, updated)
+}
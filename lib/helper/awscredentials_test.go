@@ -0,0 +1,185 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestSetAWSCredentials(t *testing.T) {
+	expires := time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC)
+	stak := kion.STAK{AccessKey: "AKIANEW", SecretAccessKey: "new-secret", SessionToken: "new-token", Expiration: expires}
+	managed := "# kion-cli managed profile, expires 2026-10-16T13:00:00Z\n[audit]\naws_access_key_id=AKIANEW\naws_secret_access_key=new-secret\naws_session_token=new-token\n"
+
+	tests := []struct {
+		description string
+		contents    string
+		name        string
+		replace     bool
+		want        string
+		wantErr     string
+	}{
+		{
+			"New File",
+			"",
+			"audit",
+			false,
+			managed,
+			"",
+		},
+		{
+			"Appended",
+			"[default]\naws_access_key_id=AKIALONG\naws_secret_access_key=long\n",
+			"audit",
+			false,
+			"[default]\naws_access_key_id=AKIALONG\naws_secret_access_key=long\n\n" + managed,
+			"",
+		},
+		{
+			"Managed Updated",
+			"# kion-cli managed profile, expires 2026-10-16T12:00:00Z\n[audit]\naws_access_key_id=AKIAOLD\naws_secret_access_key=old\naws_session_token=old\nregion=us-west-2\n\n[default]\naws_access_key_id=AKIALONG\n",
+			"audit",
+			false,
+			"# kion-cli managed profile, expires 2026-10-16T13:00:00Z\n[audit]\naws_access_key_id=AKIANEW\naws_secret_access_key=new-secret\naws_session_token=new-token\nregion=us-west-2\n\n[default]\naws_access_key_id=AKIALONG\n",
+			"",
+		},
+		{
+			"Unmanaged Refused",
+			"[audit]\naws_access_key_id=AKIALONG\n",
+			"audit",
+			false,
+			"",
+			"profile audit wasn't written by Kion CLI",
+		},
+		{
+			"Unmanaged Replaced",
+			"[111122223333_admin]\naws_access_key_id = AKIAOLD\naws_secret_access_key = old\naws_session_token = old\n",
+			"111122223333_admin",
+			true,
+			"# kion-cli managed profile, expires 2026-10-16T13:00:00Z\n[111122223333_admin]\naws_access_key_id=AKIANEW\naws_secret_access_key=new-secret\naws_session_token=new-token\n",
+			"",
+		},
+		{
+			"Windows Line Endings",
+			"[default]\r\naws_access_key_id=AKIALONG\r\n",
+			"audit",
+			false,
+			"[default]\r\naws_access_key_id=AKIALONG\r\n\r\n" + strings.ReplaceAll(managed, "\n", "\r\n"),
+			"",
+		},
+		{
+			"Invalid Name",
+			"",
+			"audit]\n[default",
+			false,
+			"",
+			"invalid profile name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SetAWSCredentials(test.contents, test.name, stak, test.replace)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, wanted one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanAWSCredentials(t *testing.T) {
+	contents := strings.Join([]string{
+		"[default]",
+		"aws_access_key_id=AKIALONG",
+		"",
+		"# kion-cli managed profile, expires 2026-10-16T11:00:00Z",
+		"[expired]",
+		"aws_access_key_id=AKIAOLD",
+		"",
+		"# kion-cli managed profile, expires 2026-10-16T13:00:00Z",
+		"[current]",
+		"aws_access_key_id=AKIANEW",
+		"",
+		"[other]",
+		"aws_access_key_id=AKIAOTHER",
+		"",
+		"# kion-cli managed profile, expires 2026-10-16T10:00:00Z",
+		"[expired-last]",
+		"aws_access_key_id=AKIAOLD",
+		"",
+	}, "\n")
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		all         bool
+		want        string
+		wantRemoved []string
+	}{
+		{
+			"Expired",
+			false,
+			"[default]\naws_access_key_id=AKIALONG\n\n# kion-cli managed profile, expires 2026-10-16T13:00:00Z\n[current]\naws_access_key_id=AKIANEW\n\n[other]\naws_access_key_id=AKIAOTHER\n",
+			[]string{"expired", "expired-last"},
+		},
+		{
+			"All",
+			true,
+			"[default]\naws_access_key_id=AKIALONG\n\n[other]\naws_access_key_id=AKIAOTHER\n",
+			[]string{"expired", "current", "expired-last"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, removed := CleanAWSCredentials(contents, now, test.all)
+			if got != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", got, test.want)
+			}
+			if !reflect.DeepEqual(removed, test.wantRemoved) {
+				t.Errorf("got removed %v, wanted %v", removed, test.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestSaveAWSProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aws", "credentials")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+
+	written, err := SaveAWSProfile("audit", kion.STAK{AccessKey: "AKIANEW"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != path {
+		t.Errorf("got %v, wanted the credentials file from AWS_SHARED_CREDENTIALS_FILE", written)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, wanted the credentials file readable only by the user", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# kion-cli managed profile\n[audit]\naws_access_key_id=AKIANEW\n") {
+		t.Errorf("got credentials file:\n%s", data)
+	}
+}
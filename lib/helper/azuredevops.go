@@ -0,0 +1,77 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Azure DevOps                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// azureDevOpsToolkitVariables are the pipeline variables the AWS Toolkit for
+// Azure DevOps tasks read credentials from when no service connection is
+// given, by the environment variable holding the same value.
+var azureDevOpsToolkitVariables = map[string]string{
+	"AWS_ACCESS_KEY_ID":     "AWS.AccessKeyID",
+	"AWS_SECRET_ACCESS_KEY": "AWS.SecretAccessKey",
+	"AWS_SESSION_TOKEN":     "AWS.SessionToken",
+	"AWS_REGION":            "AWS.Region",
+}
+
+// azureDevOpsPublicVariables are not marked secret, so later steps also see
+// them as environment variables without mapping them.
+var azureDevOpsPublicVariables = map[string]bool{
+	"AWS_REGION":                 true,
+	"AWS_CREDENTIAL_EXPIRATION":  true,
+	"AZURE_TENANT_ID":            true,
+	"AZURE_CLIENT_ID":            true,
+	"AZURE_SUBSCRIPTION_ID":      true,
+	"ARM_TENANT_ID":              true,
+	"ARM_CLIENT_ID":              true,
+	"ARM_SUBSCRIPTION_ID":        true,
+	"ARM_USE_OIDC":               true,
+	"CLOUDSDK_COMPUTE_REGION":    true,
+	"GOOGLE_REGION":              true,
+	"CLOUDSDK_CORE_PROJECT":      true,
+	"GOOGLE_CLOUD_PROJECT":       true,
+	"KION_CREDENTIAL_EXPIRATION": true,
+}
+
+// AzureDevOpsVariables returns logging commands setting pipeline variables
+// from name=value pairs, for an Azure DevOps pipeline step to print. Each is
+// set under its own name for script steps and, for credentials and region,
+// under the name the AWS Toolkit for Azure DevOps tasks read. Secrets are
+// marked so they are masked in logs, and must be mapped into the environment
+// of script steps that need them.
+func AzureDevOpsVariables(vars []string) string {
+	var b strings.Builder
+	for _, v := range vars {
+		name, value, _ := strings.Cut(v, "=")
+		names := []string{name}
+		if toolkit, found := azureDevOpsToolkitVariables[name]; found {
+			names = append(names, toolkit)
+		}
+		secret := ""
+		if !azureDevOpsPublicVariables[name] {
+			secret = ";issecret=true"
+		}
+		for _, n := range names {
+			fmt.Fprintf(&b, "##vso[task.setvariable variable=%v%v]%v\n", escapeAzureDevOpsProperty(n), secret, escapeAzureDevOpsData(value))
+		}
+	}
+	return b.String()
+}
+
+// escapeAzureDevOpsData escapes a logging command's data so it can't end the
+// command early.
+func escapeAzureDevOpsData(value string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+// escapeAzureDevOpsProperty escapes a logging command's property value.
+func escapeAzureDevOpsProperty(value string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", "]", "%5D", ";", "%3B").Replace(value)
+}
@@ -0,0 +1,36 @@
+package helper
+
+import "testing"
+
+func TestAzureDevOpsVariables(t *testing.T) {
+	tests := []struct {
+		description string
+		vars        []string
+		want        string
+	}{
+		{
+			"Toolkit Variable",
+			[]string{"AWS_SESSION_TOKEN=token"},
+			"##vso[task.setvariable variable=AWS_SESSION_TOKEN;issecret=true]token\n##vso[task.setvariable variable=AWS.SessionToken;issecret=true]token\n",
+		},
+		{
+			"Public Variable",
+			[]string{"AWS_CREDENTIAL_EXPIRATION=2030-01-02T03:04:05Z"},
+			"##vso[task.setvariable variable=AWS_CREDENTIAL_EXPIRATION]2030-01-02T03:04:05Z\n",
+		},
+		{
+			"Escaped",
+			[]string{"KION_NOTE=100%\nnext]"},
+			"##vso[task.setvariable variable=KION_NOTE;issecret=true]100%AZP25%0Anext]\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := AzureDevOpsVariables(test.vars)
+			if got != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Benchmarks                                                                //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// BenchResult holds the latency samples gathered for an operation. Cold
+// samples are taken on a new connection, warm samples reuse the connection
+// left open by the preceding cold sample.
+type BenchResult struct {
+	Name string
+	Cold []time.Duration
+	Warm []time.Duration
+}
+
+// Bench times op for the given number of iterations. Each iteration calls
+// reset before taking a cold sample and then takes a warm sample immediately
+// after. The first error returned by op stops the benchmark.
+func Bench(iterations int, reset func(), op func() error) ([]time.Duration, []time.Duration, error) {
+	var cold []time.Duration
+	var warm []time.Duration
+	for i := 0; i < iterations; i++ {
+		reset()
+		elapsed, err := timeOp(op)
+		if err != nil {
+			return cold, warm, err
+		}
+		cold = append(cold, elapsed)
+
+		elapsed, err = timeOp(op)
+		if err != nil {
+			return cold, warm, err
+		}
+		warm = append(warm, elapsed)
+	}
+
+	return cold, warm, nil
+}
+
+// timeOp returns how long op took to run.
+func timeOp(op func() error) (time.Duration, error) {
+	start := time.Now()
+	err := op()
+	return time.Since(start), err
+}
+
+// Percentile returns the pth percentile of samples using the nearest rank
+// method. Zero is returned if there are no samples.
+func Percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = max(rank, 1)
+	rank = min(rank, len(sorted))
+
+	return sorted[rank-1]
+}
+
+// PrintBench prints a table of latency percentiles for each benchmarked
+// operation.
+func PrintBench(w io.Writer, results []BenchResult) error {
+	table := NewTable("OPERATION", "MODE", "N", "MIN", "P50", "P90", "P95", "P99", "MAX")
+	for _, result := range results {
+		for _, mode := range []struct {
+			name    string
+			samples []time.Duration
+		}{
+			{"cold", result.Cold},
+			{"warm", result.Warm},
+		} {
+			row := []any{result.Name, mode.name, len(mode.samples)}
+			for _, p := range []float64{0, 50, 90, 95, 99, 100} {
+				row = append(row, Percentile(mode.samples, p).Round(time.Millisecond))
+			}
+			table.AddRow(row...)
+		}
+	}
+
+	return table.Write(w)
+}
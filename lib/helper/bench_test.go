@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{5, 1, 4, 2, 3, 10, 9, 8, 7, 6}
+
+	tests := []struct {
+		description string
+		samples     []time.Duration
+		p           float64
+		want        time.Duration
+	}{
+		{
+			"No Samples",
+			nil,
+			50,
+			0,
+		},
+		{
+			"Min",
+			samples,
+			0,
+			1,
+		},
+		{
+			"Median",
+			samples,
+			50,
+			5,
+		},
+		{
+			"P90",
+			samples,
+			90,
+			9,
+		},
+		{
+			"P95",
+			samples,
+			95,
+			10,
+		},
+		{
+			"Max",
+			samples,
+			100,
+			10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := Percentile(test.samples, test.p)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+
+	// the samples must not be reordered
+	if samples[0] != 5 {
+		t.Error("samples were modified")
+	}
+}
+
+func TestBench(t *testing.T) {
+	resets := 0
+	calls := 0
+	cold, warm, err := Bench(3, func() { resets++ }, func() error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resets != 3 || calls != 6 || len(cold) != 3 || len(warm) != 3 {
+		t.Errorf("got %v resets, %v calls, %v cold, %v warm", resets, calls, len(cold), len(warm))
+	}
+
+	// errors stop the benchmark
+	failure := errors.New("failed")
+	_, _, err = Bench(3, func() {}, func() error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, wanted %v", err, failure)
+	}
+}
@@ -0,0 +1,119 @@
+package helper
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Bootstrap                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// BootstrapShells are the shells kion bootstrap can set up, those with both
+// completion and a shell-init wrapper.
+var BootstrapShells = []string{"bash", "zsh", "fish"}
+
+// rcBlockStart and rcBlockEnd surround the lines kion bootstrap manages in a
+// shell startup file, so running it again replaces them rather than adding
+// another copy.
+const (
+	rcBlockStart = "# >>> kion-cli >>>"
+	rcBlockEnd   = "# <<< kion-cli <<<"
+)
+
+// ShellRCPath returns the startup file of an interactive shell under home:
+// ~/.bashrc, .zshrc in $ZDOTDIR or home, or config.fish in the fish config
+// directory under $XDG_CONFIG_HOME or ~/.config.
+func ShellRCPath(shell string, home string, getenv func(string) string) (string, error) {
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".bashrc"), nil
+	case "zsh":
+		if zdotdir := getenv("ZDOTDIR"); zdotdir != "" {
+			return filepath.Join(zdotdir, ".zshrc"), nil
+		}
+		return filepath.Join(home, ".zshrc"), nil
+	case "fish":
+		configHome := getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, "fish", "config.fish"), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q, expected one of %v", shell, strings.Join(BootstrapShells, ", "))
+}
+
+// ShellIntegration returns the startup file lines that load completion and
+// the shell-init wrapper in shell, running Kion CLI as binary.
+func ShellIntegration(shell string, binary string) ([]string, error) {
+	if strings.ContainsAny(binary, " '\"\\$`") {
+		if shell == "fish" {
+			binary = "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(binary) + "'"
+		} else {
+			binary = "'" + strings.ReplaceAll(binary, "'", `'\''`) + "'"
+		}
+	}
+	switch shell {
+	case "bash":
+		return []string{
+			fmt.Sprintf("source <(%v completion bash)", binary),
+			fmt.Sprintf(`eval "$(%v shell-init bash)"`, binary),
+		}, nil
+	case "zsh":
+		return []string{
+			fmt.Sprintf("source <(%v completion --describe zsh)", binary),
+			fmt.Sprintf(`eval "$(%v shell-init zsh)"`, binary),
+		}, nil
+	case "fish":
+		return []string{
+			fmt.Sprintf("%v completion --describe fish | source", binary),
+			fmt.Sprintf("%v shell-init fish | source", binary),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported shell %q, expected one of %v", shell, strings.Join(BootstrapShells, ", "))
+}
+
+// SetRCBlock returns the contents of a shell startup file with the block kion
+// bootstrap manages set to lines, replacing an earlier block in place or else
+// appending one, and whether anything changed.
+func SetRCBlock(contents string, lines []string) (string, bool) {
+	block := rcBlockStart + "\n" + strings.Join(lines, "\n") + "\n" + rcBlockEnd + "\n"
+	start := strings.Index(contents, rcBlockStart)
+	end := strings.Index(contents, rcBlockEnd)
+	if start >= 0 && end > start {
+		end += len(rcBlockEnd)
+		if strings.HasPrefix(contents[end:], "\n") {
+			end++
+		}
+		updated := contents[:start] + block + contents[end:]
+		return updated, updated != contents
+	}
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	if contents != "" {
+		contents += "\n"
+	}
+	return contents + block, true
+}
+
+// StarterConfig returns the configuration kion bootstrap writes when there is
+// none, the Kion URL and sign in settings given to it. Passwords and API keys
+// are left out so they never land on disk unasked.
+func StarterConfig(settings structs.Kion) structs.Configuration {
+	return structs.Configuration{
+		Kion: structs.Kion{
+			Url:              settings.Url,
+			Username:         settings.Username,
+			IDMS:             settings.IDMS,
+			AuthMethod:       settings.AuthMethod,
+			SamlMetadataFile: settings.SamlMetadataFile,
+			SamlIssuer:       settings.SamlIssuer,
+		},
+	}
+}
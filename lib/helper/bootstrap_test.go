@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestShellRCPath(t *testing.T) {
+	tests := []struct {
+		description string
+		shell       string
+		env         map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{"Bash", "bash", nil, "/home/jane/.bashrc", false},
+		{"Zsh", "zsh", nil, "/home/jane/.zshrc", false},
+		{"Zsh ZDOTDIR", "zsh", map[string]string{"ZDOTDIR": "/home/jane/.config/zsh"}, "/home/jane/.config/zsh/.zshrc", false},
+		{"Fish", "fish", nil, "/home/jane/.config/fish/config.fish", false},
+		{"Fish XDG", "fish", map[string]string{"XDG_CONFIG_HOME": "/xdg"}, "/xdg/fish/config.fish", false},
+		{"Unsupported", "tcsh", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ShellRCPath(test.shell, "/home/jane", func(key string) string { return test.env[key] })
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted an error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShellIntegration(t *testing.T) {
+	tests := []struct {
+		description string
+		shell       string
+		binary      string
+		want        []string
+	}{
+		{
+			"Bash",
+			"bash",
+			"kion",
+			[]string{"source <(kion completion bash)", `eval "$(kion shell-init bash)"`},
+		},
+		{
+			"Zsh Quoted",
+			"zsh",
+			"/Users/jane/My Tools/kion",
+			[]string{"source <('/Users/jane/My Tools/kion' completion --describe zsh)", `eval "$('/Users/jane/My Tools/kion' shell-init zsh)"`},
+		},
+		{
+			"Fish Quoted",
+			"fish",
+			"/opt/jane's/kion",
+			[]string{`'/opt/jane\'s/kion' completion --describe fish | source`, `'/opt/jane\'s/kion' shell-init fish | source`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ShellIntegration(test.shell, test.binary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := ShellIntegration("tcsh", "kion"); err == nil {
+		t.Error("wanted an error for an unsupported shell")
+	}
+}
+
+func TestSetRCBlock(t *testing.T) {
+	block := "# >>> kion-cli >>>\neval \"$(kion shell-init bash)\"\n# <<< kion-cli <<<\n"
+	lines := []string{`eval "$(kion shell-init bash)"`}
+	tests := []struct {
+		description string
+		contents    string
+		want        string
+		wantChanged bool
+	}{
+		{"Empty", "", block, true},
+		{"Append", "export EDITOR=vim", "export EDITOR=vim\n\n" + block, true},
+		{
+			"Replace",
+			"export EDITOR=vim\n# >>> kion-cli >>>\nsource ~/old\n# <<< kion-cli <<<\nalias ll='ls -l'\n",
+			"export EDITOR=vim\n" + block + "alias ll='ls -l'\n",
+			true,
+		},
+		{"Unchanged", "export EDITOR=vim\n\n" + block, "export EDITOR=vim\n\n" + block, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, changed := SetRCBlock(test.contents, lines)
+			if got != test.want || changed != test.wantChanged {
+				t.Errorf("got %q, %v, wanted %q, %v", got, changed, test.want, test.wantChanged)
+			}
+		})
+	}
+}
+
+func TestStarterConfig(t *testing.T) {
+	settings := structs.Kion{
+		Url:      "https://kion.example.com",
+		Username: "jane",
+		Password: "secret",
+		ApiKey:   "app_123",
+		IDMS:     "2",
+	}
+	got := StarterConfig(settings)
+	want := structs.Kion{Url: "https://kion.example.com", Username: "jane", IDMS: "2"}
+	if !reflect.DeepEqual(got.Kion, want) {
+		t.Errorf("got %+v, wanted %+v", got.Kion, want)
+	}
+}
@@ -2,13 +2,16 @@ package helper
 
 import (
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"regexp"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,9 +21,10 @@ import (
 //                                                                            //
 ////////////////////////////////////////////////////////////////////////////////
 
-// redirectServer runs a temp go http server to handle logging out any existing
-// AWS sessions then redirecting to the federated console login.
-func redirectServer(url string, typeID uint) {
+// redirectServer returns a temp go http server to handle logging out any
+// existing AWS sessions then redirecting to the federated console login. done
+// is closed once the page reports the login complete.
+func redirectServer(url string, typeID uint, done chan<- struct{}) *http.Server {
 	// stub out a new mux
 	mux := http.NewServeMux()
 
@@ -140,19 +144,17 @@ func redirectServer(url string, typeID uint) {
 	})
 
 	// handles callback from client when login is complete
+	var once sync.Once
 	mux.HandleFunc("/done", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "ok")
-		os.Exit(0)
+		once.Do(func() { close(done) })
 	})
 
 	// define our server
-	server := http.Server{
+	return &http.Server{
 		Addr:    ":56092",
 		Handler: mux,
 	}
-
-	// start our server
-	log.Fatal(server.ListenAndServe())
 }
 
 // OpenBrowser opens up a URL in the users system default browser. It uses a
@@ -161,10 +163,17 @@ func redirectServer(url string, typeID uint) {
 //
 // Deprecated: Use OpenBrowserRedirect instead.
 func OpenBrowser(url string, typeID uint) error {
-	var err error
-
 	// start our server
-	go redirectServer(url, typeID)
+	done := make(chan struct{})
+	server := redirectServer(url, typeID, done)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to start the redirect server: %w", err)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
 
 	// define our open url
 	serverURL := "http://localhost:56092/"
@@ -180,17 +189,21 @@ func OpenBrowser(url string, typeID uint) error {
 		err = fmt.Errorf("unsupported platform")
 	}
 
-	// give ourselves up to 5 seconds to complete
-	time.Sleep(5 * time.Second)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// give ourselves up to 5 seconds to complete
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+	return nil
 }
 
-// OpenBrowserDirect opens up a URL in the users system default browser. It
-// uses the redirect_uri query parameter to handle the logout and redirect to
-// the federated login page.
-func OpenBrowserRedirect(target string, typeID uint) error {
-	var err error
+// federationLink returns a link that logs out of any existing console session
+// before redirecting to the federated login page.
+func federationLink(target string, typeID uint) string {
 	var logoutURL string
 	var replacement string
 
@@ -221,19 +234,161 @@ func OpenBrowserRedirect(target string, typeID uint) error {
 	encodedUrl := url.QueryEscape(target)
 
 	// generate the federation link
-	federationLink := fmt.Sprintf("%s%s", logoutURL, encodedUrl)
+	return fmt.Sprintf("%s%s", logoutURL, encodedUrl)
+}
 
-	// open the browser
-	switch runtime.GOOS {
+// OpenBrowserDirect opens up a URL in the users system default browser. It
+// uses the redirect_uri query parameter to handle the logout and redirect to
+// the federated login page.
+func OpenBrowserRedirect(target string, typeID uint) error {
+	return OpenURL(federationLink(target, typeID))
+}
+
+// OpenURL opens up a URL in the users system default browser.
+func OpenURL(link string) error {
+	cmd, err := defaultBrowserCommand(runtime.GOOS, link)
+	if err != nil {
+		return err
+	}
+	return cmd.Start()
+}
+
+// lookPath finds executables on the PATH, replaced in tests.
+var lookPath = exec.LookPath
+
+// windowsApp finds the executable of a browser on Windows, replaced in tests.
+var windowsApp = findWindowsApp
+
+// linuxOpeners are tried in order to open links in the default browser on
+// linux, not every distribution or container ships xdg-open.
+var linuxOpeners = []string{"xdg-open", "sensible-browser", "x-www-browser"}
+
+// defaultBrowserCommand returns the command that opens link in the users
+// system default browser on the given platform.
+func defaultBrowserCommand(goos string, link string) (*exec.Cmd, error) {
+	switch goos {
 	case "linux":
-		err = exec.Command("xdg-open", federationLink).Start()
+		for _, opener := range linuxOpeners {
+			if _, err := lookPath(opener); err == nil {
+				return exec.Command(opener, link), nil
+			}
+		}
+		return nil, fmt.Errorf("no browser found, looked for %v", strings.Join(linuxOpeners, ", "))
 	case "windows":
-		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", federationLink).Start()
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", link), nil
 	case "darwin":
-		err = exec.Command("open", federationLink).Start()
+		return exec.Command("open", link), nil
 	default:
-		err = fmt.Errorf("unsupported platform")
+		return nil, fmt.Errorf("unsupported platform")
+	}
+}
+
+// signInCommand returns the command that opens link in a new window of the
+// given browser on the given platform, or in the users system default
+// browser if no browser is given.
+func signInCommand(goos string, browser string, link string) (*exec.Cmd, error) {
+	if browser == "" {
+		return defaultBrowserCommand(goos, link)
+	}
+	app, found := browserApps[browser][goos]
+	if !found {
+		return nil, fmt.Errorf("unsupported browser %q, expected one of %v", browser, strings.Join(BrowserNames(), ", "))
+	}
+
+	switch goos {
+	case "linux":
+		return exec.Command(app, link), nil
+	case "darwin":
+		return exec.Command("open", "-a", app, link), nil
+	case "windows":
+		path, err := windowsApp(app)
+		if err != nil {
+			return nil, err
+		}
+		return exec.Command(path, link), nil
+	default:
+		return nil, fmt.Errorf("unsupported platform")
+	}
+}
+
+// OpenSignInURL opens the sign in page of an identity provider in the given
+// browser, or the users system default browser if no browser is given. On
+// linux an error is returned when there is no display to open it on, such as
+// over SSH or in a container, so the caller can show the link instead.
+func OpenSignInURL(link string, browser string) error {
+	if runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("no display to open a browser on")
+	}
+	cmd, err := signInCommand(runtime.GOOS, browser, link)
+	if err != nil {
+		return err
+	}
+	return cmd.Start()
+}
+
+// browserApps maps supported browsers to their executable on each platform.
+var browserApps = map[string]map[string]string{
+	"chrome":   {"linux": "google-chrome", "darwin": "Google Chrome", "windows": "chrome"},
+	"chromium": {"linux": "chromium", "darwin": "Chromium", "windows": "chromium"},
+	"edge":     {"linux": "microsoft-edge", "darwin": "Microsoft Edge", "windows": "msedge"},
+	"brave":    {"linux": "brave-browser", "darwin": "Brave Browser", "windows": "brave"},
+	"firefox":  {"linux": "firefox", "darwin": "Firefox", "windows": "firefox"},
+}
+
+// BrowserNames returns the browsers that consoles can be opened in with a
+// specific profile.
+func BrowserNames() []string {
+	names := make([]string, 0, len(browserApps))
+	for name := range browserApps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// browserCommand returns the command that opens link in a profile of the given
+// browser on the given platform.
+func browserCommand(goos string, browser string, profile string, link string) (*exec.Cmd, error) {
+	app, found := browserApps[browser][goos]
+	if !found {
+		return nil, fmt.Errorf("unsupported browser %q, expected one of %v", browser, strings.Join(BrowserNames(), ", "))
 	}
 
-	return err
+	// chromium based browsers select profiles by their directory name
+	args := []string{"--profile-directory=" + profile, link}
+	if browser == "firefox" {
+		args = []string{"-P", profile, "-new-tab", link}
+	}
+
+	switch goos {
+	case "linux":
+		return exec.Command(app, args...), nil
+	case "darwin":
+		return exec.Command("open", append([]string{"-na", app, "--args"}, args...)...), nil
+	case "windows":
+		// run the browser itself rather than through cmd's start builtin,
+		// which splits links at their ampersands
+		path, err := windowsApp(app)
+		if err != nil {
+			return nil, err
+		}
+		return exec.Command(path, args...), nil
+	default:
+		return nil, fmt.Errorf("unsupported platform")
+	}
+}
+
+// OpenBrowserProfile opens up a URL in a profile of the given browser, or the
+// users system default browser if no browser is given. Like
+// OpenBrowserRedirect any existing session in the profile is logged out
+// first.
+func OpenBrowserProfile(target string, typeID uint, browser string, profile string) error {
+	if browser == "" {
+		return OpenBrowserRedirect(target, typeID)
+	}
+	cmd, err := browserCommand(runtime.GOOS, browser, profile, federationLink(target, typeID))
+	if err != nil {
+		return err
+	}
+	return cmd.Start()
 }
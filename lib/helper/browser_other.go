@@ -0,0 +1,15 @@
+//go:build !windows
+
+package helper
+
+import "fmt"
+
+// findWindowsApp returns the path of the named executable as found on the
+// PATH, App Paths only being registered on Windows.
+func findWindowsApp(app string) (string, error) {
+	path, err := lookPath(app + ".exe")
+	if err != nil {
+		return "", fmt.Errorf("%v isn't installed, it isn't on the PATH", app)
+	}
+	return path, nil
+}
@@ -0,0 +1,103 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Browser Sessions                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultBrowserProfile names the profile of the system default browser used
+// when no browser profile is configured.
+const DefaultBrowserProfile = "default"
+
+// consoleSessionLength is the longest a federated console session lasts, after
+// which a browser profile is assumed to be signed out.
+const consoleSessionLength = 12 * time.Hour
+
+// BrowserSession records the account a browser profile was last federated
+// into.
+type BrowserSession struct {
+	Account     string    `json:"account"`
+	AccountName string    `json:"account_name,omitempty"`
+	CAR         string    `json:"cloud_access_role"`
+	Time        time.Time `json:"time"`
+}
+
+// Active reports whether the console session may still be signed in.
+func (s BrowserSession) Active(now time.Time) bool {
+	return !s.Time.IsZero() && now.Sub(s.Time) < consoleSessionLength
+}
+
+// Holds reports whether the session is for the given account and cloud access
+// role.
+func (s BrowserSession) Holds(account string, carName string) bool {
+	return s.Account == account && s.CAR == carName
+}
+
+// ReadBrowserSessions returns the browser sessions stored at path keyed by
+// browser profile. A missing file has no sessions.
+func ReadBrowserSessions(path string) (map[string]BrowserSession, error) {
+	sessions := make(map[string]BrowserSession)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &sessions)
+	return sessions, err
+}
+
+// WriteBrowserSessions stores browser sessions at path, readable only by the
+// user.
+func WriteBrowserSessions(path string, sessions map[string]BrowserSession) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// PickBrowserProfile chooses the browser profile to federate into. The
+// requested profile is used if it is signed out or already holds the account
+// and cloud access role. Otherwise the first of the alternate profiles that is
+// is returned with switched set. If none are free the requested profile is
+// returned along with the session it holds so the user can be warned before it
+// is signed out.
+func PickBrowserProfile(sessions map[string]BrowserSession, requested string, alternates []string, account string, carName string, now time.Time) (profile string, switched bool, conflict *BrowserSession) {
+	free := func(name string) bool {
+		session, found := sessions[name]
+		return !found || !session.Active(now) || session.Holds(account, carName)
+	}
+	if free(requested) {
+		return requested, false, nil
+	}
+
+	// prefer a profile already holding the account, then any signed out one
+	for _, name := range alternates {
+		if name != requested && sessions[name].Active(now) && sessions[name].Holds(account, carName) {
+			return name, true, nil
+		}
+	}
+	for _, name := range alternates {
+		if name != requested && free(name) {
+			return name, true, nil
+		}
+	}
+
+	session := sessions[requested]
+	return requested, false, &session
+}
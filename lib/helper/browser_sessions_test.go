@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPickBrowserProfile(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	sessions := map[string]BrowserSession{
+		"work":     {Account: "111111111111", CAR: "Admin", Time: now.Add(-time.Hour)},
+		"personal": {Account: "222222222222", CAR: "Admin", Time: now.Add(-time.Hour)},
+		"stale":    {Account: "333333333333", CAR: "Admin", Time: now.Add(-13 * time.Hour)},
+	}
+
+	tests := []struct {
+		description  string
+		requested    string
+		alternates   []string
+		account      string
+		car          string
+		wantProfile  string
+		wantSwitched bool
+		wantConflict bool
+	}{
+		{
+			"Signed Out",
+			"fresh",
+			nil,
+			"111111111111",
+			"Admin",
+			"fresh",
+			false,
+			false,
+		},
+		{
+			"Same Account",
+			"work",
+			nil,
+			"111111111111",
+			"Admin",
+			"work",
+			false,
+			false,
+		},
+		{
+			"Expired Session",
+			"stale",
+			nil,
+			"111111111111",
+			"Admin",
+			"stale",
+			false,
+			false,
+		},
+		{
+			"Different Role Conflicts",
+			"work",
+			nil,
+			"111111111111",
+			"ReadOnly",
+			"work",
+			false,
+			true,
+		},
+		{
+			"Switch To Holding Profile",
+			"work",
+			[]string{"work", "stale", "personal"},
+			"222222222222",
+			"Admin",
+			"personal",
+			true,
+			false,
+		},
+		{
+			"Switch To Signed Out Profile",
+			"work",
+			[]string{"work", "personal", "stale"},
+			"444444444444",
+			"Admin",
+			"stale",
+			true,
+			false,
+		},
+		{
+			"No Free Alternates",
+			"work",
+			[]string{"work", "personal"},
+			"444444444444",
+			"Admin",
+			"work",
+			false,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			profile, switched, conflict := PickBrowserProfile(sessions, test.requested, test.alternates, test.account, test.car, now)
+			if profile != test.wantProfile || switched != test.wantSwitched || (conflict != nil) != test.wantConflict {
+				t.Errorf("\ngot:\n  %v %v %v\nwanted:\n  %v %v %v", profile, switched, conflict, test.wantProfile, test.wantSwitched, test.wantConflict)
+			}
+			if conflict != nil && !reflect.DeepEqual(*conflict, sessions[test.requested]) {
+				t.Errorf("\ngot conflict:\n  %v\nwanted:\n  %v", *conflict, sessions[test.requested])
+			}
+		})
+	}
+}
+
+func TestBrowserSessionsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "browser-sessions.json")
+
+	// a missing file has no sessions
+	sessions, err := ReadBrowserSessions(path)
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("got %v, %v, wanted no sessions", sessions, err)
+	}
+
+	sessions["work"] = BrowserSession{Account: "111111111111", AccountName: "Prod", CAR: "Admin", Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	err = WriteBrowserSessions(path, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadBrowserSessions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sessions) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, sessions)
+	}
+}
@@ -0,0 +1,177 @@
+package helper
+
+import (
+	"os/exec"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// installedWindowsApp finds browsers as though installed under Program Files.
+func installedWindowsApp(app string) (string, error) {
+	return `C:\Program Files\` + app + `\` + app + ".exe", nil
+}
+
+func TestBrowserCommand(t *testing.T) {
+	link := "https://signin.aws.amazon.com/oauth?Action=logout&redirect_uri=x"
+
+	tests := []struct {
+		description string
+		goos        string
+		browser     string
+		profile     string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			"Chrome Linux",
+			"linux",
+			"chrome",
+			"Profile 1",
+			[]string{"google-chrome", "--profile-directory=Profile 1", link},
+			false,
+		},
+		{
+			"Firefox Mac",
+			"darwin",
+			"firefox",
+			"work",
+			[]string{"open", "-na", "Firefox", "--args", "-P", "work", "-new-tab", link},
+			false,
+		},
+		{
+			"Edge Windows",
+			"windows",
+			"edge",
+			"Default",
+			[]string{`C:\Program Files\msedge\msedge.exe`, "--profile-directory=Default", link},
+			false,
+		},
+		{
+			"Unsupported Browser",
+			"linux",
+			"netscape",
+			"work",
+			nil,
+			true,
+		},
+	}
+
+	defer func() { windowsApp = findWindowsApp }()
+	windowsApp = installedWindowsApp
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			cmd, err := browserCommand(test.goos, test.browser, test.profile, link)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(cmd.Args, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", cmd.Args, test.want)
+			}
+		})
+	}
+}
+
+func TestSignInCommand(t *testing.T) {
+	link := "https://idp.example/sso?SAMLRequest=abc&RelayState=x"
+
+	tests := []struct {
+		description string
+		goos        string
+		browser     string
+		installed   []string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			"Default Linux",
+			"linux",
+			"",
+			[]string{"xdg-open", "x-www-browser"},
+			[]string{"xdg-open", link},
+			false,
+		},
+		{
+			"Default Linux Without xdg-open",
+			"linux",
+			"",
+			[]string{"x-www-browser"},
+			[]string{"x-www-browser", link},
+			false,
+		},
+		{
+			"Default Linux Without Browsers",
+			"linux",
+			"",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Default Windows",
+			"windows",
+			"",
+			nil,
+			[]string{"rundll32", "url.dll,FileProtocolHandler", link},
+			false,
+		},
+		{
+			"Firefox Linux",
+			"linux",
+			"firefox",
+			nil,
+			[]string{"firefox", link},
+			false,
+		},
+		{
+			"Brave Mac",
+			"darwin",
+			"brave",
+			nil,
+			[]string{"open", "-a", "Brave Browser", link},
+			false,
+		},
+		{
+			"Chromium Windows",
+			"windows",
+			"chromium",
+			nil,
+			[]string{`C:\Program Files\chromium\chromium.exe`, link},
+			false,
+		},
+		{
+			"Unsupported Browser",
+			"linux",
+			"netscape",
+			nil,
+			nil,
+			true,
+		},
+	}
+
+	defer func() { lookPath, windowsApp = exec.LookPath, findWindowsApp }()
+	windowsApp = installedWindowsApp
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			lookPath = func(file string) (string, error) {
+				if slices.Contains(test.installed, file) {
+					return "/usr/bin/" + file, nil
+				}
+				return "", exec.ErrNotFound
+			}
+			cmd, err := signInCommand(test.goos, test.browser, link)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(cmd.Args, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", cmd.Args, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package helper
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// appPathsKey is where Windows registers installed programs by executable
+// name, the same place start and the Run dialog find them.
+const appPathsKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\App Paths\`
+
+// findWindowsApp returns the path of the named executable as registered in
+// App Paths for the user or the machine, or else as found on the PATH.
+func findWindowsApp(app string) (string, error) {
+	for _, root := range []registry.Key{registry.CURRENT_USER, registry.LOCAL_MACHINE} {
+		key, err := registry.OpenKey(root, appPathsKey+app+".exe", registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		path, _, err := key.GetStringValue("")
+		key.Close()
+		if err == nil && path != "" {
+			return path, nil
+		}
+	}
+	path, err := lookPath(app + ".exe")
+	if err != nil {
+		return "", fmt.Errorf("%v isn't installed, it isn't registered in App Paths or on the PATH", app)
+	}
+	return path, nil
+}
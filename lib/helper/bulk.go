@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Bulk Access                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// BulkFilter selects the accounts short term access keys are minted for in
+// bulk. Accounts must match every criteria given.
+type BulkFilter struct {
+	// Project is the name or ID of the project accounts belong to.
+	Project string
+
+	// OU is an AWS Organizations OU path, such as Root/Workloads, matching
+	// accounts in it and the OUs below it.
+	OU string
+
+	// Tags are AWS Organizations account tags that must all match.
+	Tags map[string]string
+
+	// AccountAlias is a glob the account name must match.
+	AccountAlias string
+}
+
+// ParseBulkTags parses tags given as key=value.
+func ParseBulkTags(values []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, value := range values {
+		key, tag, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", value)
+		}
+		tags[key] = tag
+	}
+	return tags, nil
+}
+
+// BulkTargets returns the cloud access role named carName in each account of
+// the inventory matching filter, one per account sorted by account number.
+// Pinned accounts are left out unless ForcePinned is set. Matching by OU or
+// tag needs the account metadata from AWS Organizations, see
+// kion.org_metadata.
+func BulkTargets(inventory kion.Inventory, carName string, filter BulkFilter) ([]kion.CAR, error) {
+	if filter.Project == "" && filter.OU == "" && len(filter.Tags) == 0 && filter.AccountAlias == "" {
+		return nil, errors.New("choose the accounts with --project, --ou, --tag, or --account-alias")
+	}
+	if (filter.OU != "" || len(filter.Tags) > 0) && len(inventory.Accounts) == 0 {
+		return nil, errors.New("matching accounts by OU or tag needs account tags from AWS Organizations, set kion.org_metadata.favorite")
+	}
+
+	projects := make(map[uint]kion.Project)
+	for _, project := range inventory.Projects {
+		projects[project.ID] = project
+	}
+
+	seen := make(map[string]bool)
+	var targets []kion.CAR
+	for _, car := range FilterPinnedCARs(inventory.CARs) {
+		if car.Name != carName || seen[car.AccountNumber] {
+			continue
+		}
+		if filter.Project != "" {
+			project := projects[car.ProjectID]
+			if !strings.EqualFold(project.Name, filter.Project) && fmt.Sprint(car.ProjectID) != filter.Project {
+				continue
+			}
+		}
+		if !matchPattern(filter.AccountAlias, car.AccountName) {
+			continue
+		}
+		metadata := inventory.Accounts[car.AccountNumber]
+		if filter.OU != "" {
+			ou := strings.TrimSuffix(filter.OU, "/")
+			if metadata.OUPath != ou && !strings.HasPrefix(metadata.OUPath, ou+"/") {
+				continue
+			}
+		}
+		if !matchesTags(metadata.Tags, filter.Tags) {
+			continue
+		}
+		seen[car.AccountNumber] = true
+		targets = append(targets, car)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].AccountNumber < targets[j].AccountNumber
+	})
+	return targets, nil
+}
+
+// matchesTags reports whether tags hold every one of want.
+func matchesTags(tags map[string]string, want map[string]string) bool {
+	for key, value := range want {
+		if tag, found := tags[key]; !found || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// BulkResult is the outcome of minting short term access keys for a single
+// account, with the statuses used when warming favorites.
+type BulkResult struct {
+	Account     string
+	AccountName string
+	Status      string
+	Detail      string
+}
+
+// PrintBulkResults writes the outcome of minting keys in bulk as a table.
+func PrintBulkResults(w io.Writer, results []BulkResult) error {
+	table := NewTable("ACCOUNT", "NAME", "STATUS", "DETAIL")
+	for _, result := range results {
+		table.AddRow(result.Account, result.AccountName, result.Status, strings.Join(strings.Fields(result.Detail), " "))
+	}
+	return table.Write(w)
+}
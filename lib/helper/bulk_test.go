@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestParseBulkTags(t *testing.T) {
+	tags, err := ParseBulkTags([]string{"env=prod", "team=", "owner=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"env": "prod", "team": "", "owner": "a=b"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("got %v, wanted %v", tags, want)
+	}
+	if _, err := ParseBulkTags([]string{"env"}); err == nil {
+		t.Error("got no error for a tag without a value")
+	}
+}
+
+func TestBulkTargets(t *testing.T) {
+	inventory := kion.Inventory{
+		Projects: []kion.Project{{ID: 1, Name: "Payments"}, {ID: 2, Name: "Data"}},
+		CARs: []kion.CAR{
+			{Name: "Auditor", AccountNumber: "333333333333", AccountName: "payments-prod", ProjectID: 1},
+			{Name: "Auditor", AccountNumber: "111111111111", AccountName: "payments-dev", ProjectID: 1},
+			{Name: "Auditor", AccountNumber: "111111111111", AccountName: "payments-dev", ProjectID: 1},
+			{Name: "Admin", AccountNumber: "111111111111", AccountName: "payments-dev", ProjectID: 1},
+			{Name: "Auditor", AccountNumber: "222222222222", AccountName: "data-prod", ProjectID: 2},
+			{Name: "Auditor", AccountNumber: "444444444444", AccountName: "data-held", ProjectID: 2},
+		},
+		Accounts: map[string]kion.AccountMetadata{
+			"111111111111": {OUPath: "Root/Workloads/Dev", Tags: map[string]string{"env": "dev"}},
+			"222222222222": {OUPath: "Root/Workloads/Prod", Tags: map[string]string{"env": "prod", "team": "data"}},
+			"333333333333": {OUPath: "Root/Workloads/Prod", Tags: map[string]string{"env": "prod"}},
+			"444444444444": {OUPath: "Root/Workloads/Prod", Tags: map[string]string{"env": "prod"}},
+		},
+	}
+	withPins(t, map[string]PinnedAccount{"444444444444": {}}, false)
+
+	tests := []struct {
+		description string
+		filter      BulkFilter
+		want        []string
+		wantErr     string
+	}{
+		{"No Criteria", BulkFilter{}, nil, "choose the accounts"},
+		{"Project Name", BulkFilter{Project: "payments"}, []string{"111111111111", "333333333333"}, ""},
+		{"Project ID", BulkFilter{Project: "2"}, []string{"222222222222"}, ""},
+		{"OU Subtree", BulkFilter{OU: "Root/Workloads/"}, []string{"111111111111", "222222222222", "333333333333"}, ""},
+		{"OU Prefix Only", BulkFilter{OU: "Root/Work"}, nil, ""},
+		{"Tags", BulkFilter{Tags: map[string]string{"env": "prod", "team": "data"}}, []string{"222222222222"}, ""},
+		{"Account Alias", BulkFilter{AccountAlias: "*-prod"}, []string{"222222222222", "333333333333"}, ""},
+		{"Combined", BulkFilter{Project: "Payments", Tags: map[string]string{"env": "prod"}}, []string{"333333333333"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			cars, err := BulkTargets(inventory, "Auditor", test.filter)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, wanted one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, car := range cars {
+				got = append(got, car.AccountNumber)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got accounts %v, wanted %v", got, test.want)
+			}
+		})
+	}
+
+	// tags and OUs can't be matched without the account metadata
+	_, err := BulkTargets(kion.Inventory{CARs: inventory.CARs}, "Auditor", BulkFilter{OU: "Root"})
+	if err == nil || !strings.Contains(err.Error(), "kion.org_metadata") {
+		t.Errorf("got error %v, wanted one pointing at kion.org_metadata", err)
+	}
+}
+
+func TestPrintBulkResults(t *testing.T) {
+	var b bytes.Buffer
+	err := PrintBulkResults(&b, []BulkResult{
+		{Account: "111111111111", AccountName: "payments-dev", Status: WarmMinted, Detail: "valid until 13:00"},
+		{Account: "222222222222", AccountName: "data-prod", Status: WarmFailed, Detail: "access\n  denied"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ACCOUNT") || !strings.Contains(lines[2], "failed") {
+		t.Errorf("got:\n%v", b.String())
+	}
+}
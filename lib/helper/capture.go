@@ -0,0 +1,242 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Federation Capture                                                        //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// captureRedacted replaces secret values in captured pages and requests.
+const captureRedacted = "[redacted]"
+
+// captureMaxHops limits how many redirects are followed when capturing.
+const captureMaxHops = 10
+
+// captureMaxBody limits how much of the final page is kept.
+const captureMaxBody = 1 << 20
+
+// captureTimeout limits how long capturing a federation link may take.
+const captureTimeout = 30 * time.Second
+
+// sensitiveParam matches query parameters and form fields holding secrets.
+var sensitiveParam = regexp.MustCompile(`(?i)token|secret|password|credential|session|key|code|saml|signature|assertion`)
+
+// sensitiveHeaders are response headers whose values are never kept.
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// scriptBlock matches script elements, which are dropped from captured pages.
+var scriptBlock = regexp.MustCompile(`(?is)<script\b.*?</script\s*>`)
+
+// hiddenInputValue matches the value of hidden form fields, which carry
+// tokens on sign in pages.
+var hiddenInputValue = regexp.MustCompile(`(?is)(<input\b[^>]*type=["']?hidden["']?[^>]*\bvalue=)("[^"]*"|'[^']*')`)
+
+// FederationCapture records a server side fetch of a console federation link
+// so a failed federation can be shared with support. Links, headers, and the
+// page are stripped of tokens, cookies, and scripts.
+type FederationCapture struct {
+	Captured    time.Time    `json:"captured"`
+	KionCLI     string       `json:"kion_cli"`
+	Account     string       `json:"account"`
+	AccountName string       `json:"account_name,omitempty"`
+	CAR         string       `json:"cloud_access_role"`
+	Hops        []CaptureHop `json:"hops"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// CaptureHop is one request made while following a federation link.
+type CaptureHop struct {
+	URL     string              `json:"url"`
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// Failed reports whether the federation ended on an error page or didn't
+// complete.
+func (c FederationCapture) Failed() bool {
+	if c.Error != "" || len(c.Hops) == 0 {
+		return true
+	}
+	return c.Hops[len(c.Hops)-1].Status >= http.StatusBadRequest
+}
+
+// CaptureFederation fetches a console federation link the way a browser
+// opening it would, following redirects and keeping cookies, recording each
+// request in capture. The final page is returned sanitized. Errors reaching
+// the link are recorded in capture rather than returned, as they are what
+// support needs to see.
+func CaptureFederation(target string, typeID uint, capture *FederationCapture) []byte {
+	jar, _ := cookiejar.New(nil)
+	client := kion.ExternalClient(captureTimeout)
+	client.Jar = jar
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	var secrets []string
+	link := federationLink(target, typeID)
+	if typeID != 1 && typeID != 2 && typeID != 4 && typeID != 5 {
+		// only aws federation links are wrapped in a logout redirect
+		link = target
+	}
+	for hop := 0; ; hop++ {
+		if hop == captureMaxHops {
+			capture.Error = fmt.Sprintf("stopped after %v redirects", captureMaxHops)
+			return nil
+		}
+
+		resp, err := client.Get(link)
+		if err != nil {
+			capture.Error = sanitizeCaptureText(err.Error(), append(secrets, link))
+			return nil
+		}
+		sanitized, found := sanitizeCaptureURL(link)
+		secrets = append(secrets, found...)
+		headers, found := sanitizeCaptureHeaders(resp.Header)
+		secrets = append(secrets, found...)
+		capture.Hops = append(capture.Hops, CaptureHop{URL: sanitized, Status: resp.StatusCode, Headers: headers})
+
+		// follow redirects ourselves so each one is recorded
+		location := resp.Header.Get("Location")
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			resp.Body.Close()
+			next, err := resp.Request.URL.Parse(location)
+			if err != nil {
+				capture.Error = fmt.Sprintf("invalid redirect: %v", sanitizeCaptureText(err.Error(), secrets))
+				return nil
+			}
+			link = next.String()
+			continue
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, captureMaxBody))
+		resp.Body.Close()
+		if err != nil {
+			capture.Error = fmt.Sprintf("error reading the page: %v", err)
+		}
+		return []byte(sanitizeCapturePage(string(body), secrets))
+	}
+}
+
+// sanitizeCaptureURL redacts the values of query parameters that look like
+// secrets, including those of links nested in other parameters, returning
+// the sanitized link and the values removed.
+func sanitizeCaptureURL(link string) (string, []string) {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link, nil
+	}
+
+	var secrets []string
+	query := u.Query()
+	for name, values := range query {
+		for i, value := range values {
+			switch {
+			case sensitiveParam.MatchString(name):
+				secrets = append(secrets, value)
+				values[i] = captureRedacted
+			case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+				var found []string
+				values[i], found = sanitizeCaptureURL(value)
+				secrets = append(secrets, found...)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), secrets
+}
+
+// sanitizeCaptureHeaders drops cookies and credentials from headers and
+// sanitizes redirect locations, returning the values removed.
+func sanitizeCaptureHeaders(header http.Header) (map[string][]string, []string) {
+	var secrets []string
+	headers := make(map[string][]string, len(header))
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			switch {
+			case sensitiveHeaders[name]:
+				secrets = append(secrets, value)
+				value = captureRedacted
+			case name == "Location":
+				var found []string
+				value, found = sanitizeCaptureURL(value)
+				secrets = append(secrets, found...)
+			}
+			headers[name] = append(headers[name], value)
+		}
+	}
+	return headers, secrets
+}
+
+// sanitizeCapturePage drops scripts and hidden form values from a page and
+// redacts any secrets seen while fetching it.
+func sanitizeCapturePage(page string, secrets []string) string {
+	page = scriptBlock.ReplaceAllString(page, "<script>/* removed */</script>")
+	page = hiddenInputValue.ReplaceAllString(page, `$1"`+captureRedacted+`"`)
+	return sanitizeCaptureText(page, secrets)
+}
+
+// sanitizeCaptureText redacts secrets, raw or query escaped, from text.
+func sanitizeCaptureText(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) < 8 {
+			// too short to replace without mangling the page
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, captureRedacted)
+		text = strings.ReplaceAll(text, url.QueryEscape(secret), captureRedacted)
+	}
+	return text
+}
+
+// WriteCaptureBundle saves a federation capture to a new directory under dir
+// for sharing with support, returning the directory. The request metadata is
+// written to request.json and the final page to page.html.
+func WriteCaptureBundle(dir string, capture FederationCapture, page []byte) (string, error) {
+	name := fmt.Sprintf("federation-%v-%v", capture.Account, capture.Captured.UTC().Format("20060102T150405Z"))
+	bundle := filepath.Join(dir, name)
+	err := os.MkdirAll(bundle, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := json.MarshalIndent(capture, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(bundle, "request.json"), append(metadata, '\n'), 0600)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(bundle, "page.html"), page, 0600)
+	if err != nil {
+		return "", err
+	}
+	return bundle, nil
+}
@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeCaptureURL(t *testing.T) {
+	nested := "https://signin.aws.amazon.com/federation?Action=login&SigninToken=tok-123456789&Destination=https%3A%2F%2Fconsole.aws.amazon.com"
+
+	tests := []struct {
+		description string
+		input       string
+		want        string
+		wantSecrets []string
+	}{
+		{
+			"No Query",
+			"https://console.aws.amazon.com/",
+			"https://console.aws.amazon.com/",
+			nil,
+		},
+		{
+			"Signin Token",
+			nested,
+			"https://signin.aws.amazon.com/federation?Action=login&Destination=https%3A%2F%2Fconsole.aws.amazon.com&SigninToken=%5Bredacted%5D",
+			[]string{"tok-123456789"},
+		},
+		{
+			"Nested Link",
+			"https://signin.aws.amazon.com/oauth?Action=logout&redirect_uri=" + url.QueryEscape(nested),
+			"https://signin.aws.amazon.com/oauth?Action=logout&redirect_uri=" + url.QueryEscape("https://signin.aws.amazon.com/federation?Action=login&Destination=https%3A%2F%2Fconsole.aws.amazon.com&SigninToken=%5Bredacted%5D"),
+			[]string{"tok-123456789"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, secrets := sanitizeCaptureURL(test.input)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+			if strings.Join(secrets, ",") != strings.Join(test.wantSecrets, ",") {
+				t.Errorf("got secrets %v, wanted %v", secrets, test.wantSecrets)
+			}
+		})
+	}
+}
+
+func TestCaptureFederation(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/federation", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "aws-creds", Value: "cookie-secret"})
+		http.Redirect(w, r, "/console?SigninToken="+r.URL.Query().Get("SigninToken"), http.StatusFound)
+	})
+	mux.HandleFunc("/console", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<html><script>var t = "tok-123456789";</script>
+<p>Your session expired for tok-123456789</p>
+<form><input type="hidden" name="csrf" value="csrf-value"></form></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	capture := FederationCapture{Captured: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Account: "111111111111", CAR: "Admin"}
+	page := CaptureFederation(server.URL+"/federation?SigninToken=tok-123456789", 3, &capture)
+
+	if !capture.Failed() || capture.Error != "" {
+		t.Errorf("got error %q and failed %v, wanted a failed capture without an error", capture.Error, capture.Failed())
+	}
+	if len(capture.Hops) != 2 || capture.Hops[0].Status != http.StatusFound || capture.Hops[1].Status != http.StatusForbidden {
+		t.Fatalf("got hops %+v, wanted a redirect then a forbidden page", capture.Hops)
+	}
+	if got := capture.Hops[0].Headers["Set-Cookie"]; len(got) != 1 || got[0] != captureRedacted {
+		t.Errorf("got cookies %v, wanted them redacted", got)
+	}
+
+	bundle, err := WriteCaptureBundle(t.TempDir(), capture, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(bundle) != "federation-111111111111-20240501T120000Z" {
+		t.Errorf("got bundle %v", bundle)
+	}
+	for _, name := range []string{"request.json", "page.html"} {
+		data, err := os.ReadFile(filepath.Join(bundle, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"tok-123456789", "cookie-secret", "csrf-value"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%v holds %v:\n%s", name, secret, data)
+			}
+		}
+		if name == "request.json" {
+			var saved FederationCapture
+			err = json.Unmarshal(data, &saved)
+			if err != nil || len(saved.Hops) != 2 {
+				t.Errorf("got %+v (%v), wanted the capture", saved, err)
+			}
+		}
+	}
+	if !strings.Contains(string(page), "Your session expired") {
+		t.Errorf("got page %s, wanted the error message kept", page)
+	}
+}
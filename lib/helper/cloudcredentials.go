@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Cloud Credentials                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// CloudCredentialsOutput is the structured form of the short-lived
+// credentials of an Azure or GCP account.
+type CloudCredentialsOutput struct {
+	Cloud          string `json:"cloud" yaml:"cloud"`
+	TenantID       string `json:"tenant_id,omitempty" yaml:"tenant_id,omitempty"`
+	ClientID       string `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ClientSecret   string `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	FederatedToken string `json:"federated_token,omitempty" yaml:"federated_token,omitempty"`
+	SubscriptionID string `json:"subscription_id,omitempty" yaml:"subscription_id,omitempty"`
+	AccessToken    string `json:"access_token,omitempty" yaml:"access_token,omitempty"`
+	ServiceAccount string `json:"service_account,omitempty" yaml:"service_account,omitempty"`
+	ProjectID      string `json:"project_id,omitempty" yaml:"project_id,omitempty"`
+	Expiration     string `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+	Region         string `json:"region,omitempty" yaml:"region,omitempty"`
+	Account        string `json:"account" yaml:"account"`
+	CAR            string `json:"cloud_access_role" yaml:"cloud_access_role"`
+}
+
+// NewCloudCredentialsOutput returns the structured form of credentials issued
+// for a cloud access role in an Azure or GCP account. The account stands in
+// for the subscription or project when Kion doesn't name it, and the region
+// is only kept for GCP, where tools take a default one.
+func NewCloudCredentialsOutput(creds kion.CloudCredentials, account string, car string, region string) CloudCredentialsOutput {
+	output := CloudCredentialsOutput{
+		Cloud:   creds.Cloud,
+		Account: account,
+		CAR:     car,
+	}
+	switch creds.Cloud {
+	case kion.CloudAzure:
+		output.TenantID = creds.TenantID
+		output.ClientID = creds.ClientID
+		output.ClientSecret = creds.ClientSecret
+		output.FederatedToken = creds.FederatedToken
+		output.SubscriptionID = creds.SubscriptionID
+		if output.SubscriptionID == "" {
+			output.SubscriptionID = account
+		}
+	case kion.CloudGCP:
+		output.AccessToken = creds.AccessToken
+		output.ServiceAccount = creds.ServiceAccount
+		output.ProjectID = creds.ProjectID
+		if output.ProjectID == "" {
+			output.ProjectID = account
+		}
+		output.Region = region
+	}
+	if !creds.Expiration.IsZero() {
+		output.Expiration = creds.Expiration.UTC().Format(time.RFC3339)
+	}
+	return output
+}
+
+// EnvVars returns the variables the cloud's CLI, SDKs, and Terraform provider
+// read credentials from. Azure service principals are set for the Azure SDKs'
+// environment credential and the azurerm provider, which alone reads a
+// federated token from the environment rather than a file. GCP access tokens
+// are set for gcloud and the google provider.
+func (o CloudCredentialsOutput) EnvVars() []string {
+	var vars []string
+	switch o.Cloud {
+	case kion.CloudAzure:
+		vars = append(vars,
+			"AZURE_TENANT_ID="+o.TenantID,
+			"AZURE_CLIENT_ID="+o.ClientID,
+			"AZURE_SUBSCRIPTION_ID="+o.SubscriptionID,
+			"ARM_TENANT_ID="+o.TenantID,
+			"ARM_CLIENT_ID="+o.ClientID,
+			"ARM_SUBSCRIPTION_ID="+o.SubscriptionID,
+		)
+		if o.ClientSecret != "" {
+			vars = append(vars, "AZURE_CLIENT_SECRET="+o.ClientSecret, "ARM_CLIENT_SECRET="+o.ClientSecret)
+		}
+		if o.FederatedToken != "" {
+			vars = append(vars, "ARM_USE_OIDC=true", "ARM_OIDC_TOKEN="+o.FederatedToken)
+		}
+	case kion.CloudGCP:
+		if o.Region != "" {
+			vars = append(vars, "CLOUDSDK_COMPUTE_REGION="+o.Region, "GOOGLE_REGION="+o.Region)
+		}
+		vars = append(vars,
+			"CLOUDSDK_CORE_PROJECT="+o.ProjectID,
+			"GOOGLE_CLOUD_PROJECT="+o.ProjectID,
+			"CLOUDSDK_AUTH_ACCESS_TOKEN="+o.AccessToken,
+			"GOOGLE_OAUTH_ACCESS_TOKEN="+o.AccessToken,
+		)
+	}
+	if o.Expiration != "" {
+		vars = append(vars, "KION_CREDENTIAL_EXPIRATION="+o.Expiration)
+	}
+	return vars
+}
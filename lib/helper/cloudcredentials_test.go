@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestCloudCredentialsEnvVars(t *testing.T) {
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		creds       kion.CloudCredentials
+		account     string
+		region      string
+		want        []string
+	}{
+		{
+			"Azure Client Secret",
+			kion.CloudCredentials{Cloud: kion.CloudAzure, TenantID: "tenant", ClientID: "client", ClientSecret: "secret", Expiration: expiration},
+			"3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+			"eastus",
+			[]string{
+				"AZURE_TENANT_ID=tenant",
+				"AZURE_CLIENT_ID=client",
+				"AZURE_SUBSCRIPTION_ID=3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+				"ARM_TENANT_ID=tenant",
+				"ARM_CLIENT_ID=client",
+				"ARM_SUBSCRIPTION_ID=3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+				"AZURE_CLIENT_SECRET=secret",
+				"ARM_CLIENT_SECRET=secret",
+				"KION_CREDENTIAL_EXPIRATION=2030-01-02T03:04:05Z",
+			},
+		},
+		{
+			"Azure Federated Token",
+			kion.CloudCredentials{Cloud: kion.CloudAzure, TenantID: "tenant", ClientID: "client", FederatedToken: "jwt", SubscriptionID: "sub"},
+			"3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+			"",
+			[]string{
+				"AZURE_TENANT_ID=tenant",
+				"AZURE_CLIENT_ID=client",
+				"AZURE_SUBSCRIPTION_ID=sub",
+				"ARM_TENANT_ID=tenant",
+				"ARM_CLIENT_ID=client",
+				"ARM_SUBSCRIPTION_ID=sub",
+				"ARM_USE_OIDC=true",
+				"ARM_OIDC_TOKEN=jwt",
+			},
+		},
+		{
+			"GCP",
+			kion.CloudCredentials{Cloud: kion.CloudGCP, AccessToken: "ya29", Expiration: expiration},
+			"payments-prod",
+			"us-central1",
+			[]string{
+				"CLOUDSDK_COMPUTE_REGION=us-central1",
+				"GOOGLE_REGION=us-central1",
+				"CLOUDSDK_CORE_PROJECT=payments-prod",
+				"GOOGLE_CLOUD_PROJECT=payments-prod",
+				"CLOUDSDK_AUTH_ACCESS_TOKEN=ya29",
+				"GOOGLE_OAUTH_ACCESS_TOKEN=ya29",
+				"KION_CREDENTIAL_EXPIRATION=2030-01-02T03:04:05Z",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := NewCloudCredentialsOutput(test.creds, test.account, "Contributor", test.region).EnvVars()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
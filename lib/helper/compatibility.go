@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"github.com/hashicorp/go-version"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/urfave/cli/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Compatibility                                                             //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// updatedCARAPIKey is the app metadata key remembering whether the targeted
+// Kion supports the updated cloud access role API.
+const updatedCARAPIKey = "useUpdatedCloudAccessRoleAPI"
+
+// updatedCARAPIConstraints are the Kion versions where api/v3/me/cloud-access-role
+// includes account details and works with minimal permissions.
+var updatedCARAPIConstraints = []string{
+	">=3.6.29, < 3.7.0",
+	">=3.7.17, < 3.8.0",
+	">=3.8.9, < 3.9.0",
+	">=3.9.0",
+}
+
+// UseUpdatedCARAPI reports whether the targeted Kion supports the updated
+// cloud access role API. The Kion version is only looked up the first time
+// this is needed and the answer is kept in the app metadata, so commands
+// served entirely from the cache never wait on it.
+func UseUpdatedCARAPI(cCtx *cli.Context) (bool, error) {
+	if supported, found := cCtx.App.Metadata[updatedCARAPIKey].(bool); found {
+		return supported, nil
+	}
+
+	kionVer, err := kion.GetVersion(cCtx.String("endpoint"))
+	if err != nil {
+		return false, err
+	}
+	supported, err := SupportsUpdatedCARAPI(kionVer)
+	if err != nil {
+		return false, err
+	}
+	cCtx.App.Metadata[updatedCARAPIKey] = supported
+
+	return supported, nil
+}
+
+// SupportsUpdatedCARAPI reports whether a Kion version includes the fixes to
+// the cloud access role API.
+func SupportsUpdatedCARAPI(kionVersion string) (bool, error) {
+	curVer, err := version.NewSemver(kionVersion)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range updatedCARAPIConstraints {
+		constraint, err := version.NewConstraint(c)
+		if err != nil {
+			return false, err
+		}
+		if constraint.Check(curVer) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
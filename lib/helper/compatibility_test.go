@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestSupportsUpdatedCARAPI(t *testing.T) {
+	tests := []struct {
+		description string
+		version     string
+		want        bool
+		wantErr     bool
+	}{
+		{
+			"Before Fix",
+			"3.6.28",
+			false,
+			false,
+		},
+		{
+			"Fixed Patch",
+			"3.6.29",
+			true,
+			false,
+		},
+		{
+			"Unfixed Minor",
+			"3.7.16",
+			false,
+			false,
+		},
+		{
+			"Fixed Minor",
+			"3.8.9",
+			true,
+			false,
+		},
+		{
+			"Later Release",
+			"3.10.1",
+			true,
+			false,
+		},
+		{
+			"Invalid Version",
+			"unknown",
+			false,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SupportsUpdatedCARAPI(test.version)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Shell Completion                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// CompletionShells are the shells completion scripts can be printed for.
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+// CompletionEnv is set by described completion scripts to the shell whose
+// format completions with descriptions should be printed in.
+const CompletionEnv = "KION_COMPLETE"
+
+// completionScripts ask kion for completions of the command line so far,
+// zsh and fish with descriptions when %[1]v sets CompletionEnv.
+var completionScripts = map[string]string{
+	"bash": `_kion_bash_autocomplete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( "${COMP_WORDS[@]:0:$COMP_CWORD}" "${cur}" --generate-bash-completion 2>/dev/null )
+  else
+    opts=$( "${COMP_WORDS[@]:0:$COMP_CWORD}" --generate-bash-completion 2>/dev/null )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- "${cur}") )
+  return 0
+}
+
+complete -o bashdefault -o default -F _kion_bash_autocomplete kion
+`,
+	"zsh": `#compdef kion
+
+_cli_zsh_autocomplete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(%[1]v${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(%[1]v${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _cli_zsh_autocomplete kion
+`,
+	"fish": `
+complete -c kion -n '__fish_seen_subcommand_from favorite fav f' -f -a '(%[1]vkion favorite --generate-bash-completion 2>/dev/null)'
+complete -c kion -s a -l account -l acc -x -a '(%[1]vkion (commandline -opc)[2..-1] --generate-bash-completion 2>/dev/null)'
+complete -c kion -s c -l car -l cloud-access-role -x -a '(%[1]vkion (commandline -opc)[2..-1] --generate-bash-completion 2>/dev/null)'
+complete -c kion -l project -x -a '(%[1]vkion (commandline -opc)[2..-1] --generate-bash-completion 2>/dev/null)'
+complete -c kion -l profile -x -a '(%[1]vkion (commandline -opc)[2..-1] --generate-bash-completion 2>/dev/null)'
+`,
+}
+
+// CompletionScript returns the completion script for shell. Described
+// scripts have kion print a description beside each favorite, such as its
+// account and project, in shells able to show them. Fish completions of
+// commands and flags are generated from the app and given as fishCommands.
+func CompletionScript(shell string, describe bool, fishCommands string) (string, error) {
+	var env string
+	if describe && shell != "bash" {
+		env = fmt.Sprintf("%v=%v ", CompletionEnv, shell)
+	}
+	switch shell {
+	case "bash", "zsh":
+		return fmt.Sprintf(completionScripts[shell], env), nil
+	case "fish":
+		return fishCommands + fmt.Sprintf(completionScripts[shell], env), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q, expected one of %v", shell, strings.Join(CompletionShells, ", "))
+	}
+}
+
+// FormatCompletion returns a completion line for value in the format of
+// shell, with description if the shell can show one.
+func FormatCompletion(shell string, value string, description string) string {
+	if description == "" {
+		return value
+	}
+	switch shell {
+	case "zsh":
+		return strings.ReplaceAll(value, ":", `\:`) + ":" + description
+	case "fish":
+		return value + "\t" + description
+	default:
+		return value
+	}
+}
+
+// CompletionAccount is what completions know about an account.
+type CompletionAccount struct {
+	Name    string `json:"name"`
+	Project string `json:"project,omitempty"`
+}
+
+// CompletionIndex holds account names and projects for describing
+// completions, along with the project and cloud access role names flags are
+// completed with, written whenever the inventory is fetched. Completion runs
+// before the cache is opened, and opening it may prompt, so the index is
+// kept in a plain file.
+type CompletionIndex struct {
+	Accounts map[string]CompletionAccount `json:"accounts"`
+	Projects []string                     `json:"projects,omitempty"`
+	CARs     []string                     `json:"cars,omitempty"`
+}
+
+// NewCompletionIndex builds the completion index of an inventory.
+func NewCompletionIndex(inventory kion.Inventory) CompletionIndex {
+	projects := make(map[uint]string)
+	for _, project := range inventory.Projects {
+		projects[project.ID] = project.Name
+	}
+	index := CompletionIndex{Accounts: make(map[string]CompletionAccount)}
+	cars := make(map[string]bool)
+	for _, car := range inventory.CARs {
+		index.Accounts[car.AccountNumber] = CompletionAccount{Name: car.AccountName, Project: projects[car.ProjectID]}
+		cars[car.Name] = true
+	}
+	for _, project := range projects {
+		index.Projects = append(index.Projects, project)
+	}
+	for car := range cars {
+		index.CARs = append(index.CARs, car)
+	}
+	sort.Strings(index.Projects)
+	sort.Strings(index.CARs)
+	return index
+}
+
+// completionFlags maps the names of flags whose values are completed to the
+// kind of value they take.
+var completionFlags = map[string]string{
+	"account":           "account",
+	"acc":               "account",
+	"a":                 "account",
+	"car":               "car",
+	"cloud-access-role": "car",
+	"c":                 "car",
+	"project":           "project",
+	"profile":           "profile",
+}
+
+// CompletionFlag returns the name of the flag whose value is being completed
+// given the words of the command line before the one being completed, empty
+// if the last is not a flag taking a completed value.
+func CompletionFlag(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	last := words[len(words)-1]
+	if !strings.HasPrefix(last, "-") || strings.Contains(last, "=") {
+		return ""
+	}
+	name := strings.TrimLeft(last, "-")
+	if _, found := completionFlags[name]; !found {
+		return ""
+	}
+	return name
+}
+
+// FlagCompletions returns the completion lines for the value of flag in the
+// format of shell: account numbers described by name and project, cloud
+// access role and project names from index, or the names of profiles.
+func FlagCompletions(flag string, shell string, index CompletionIndex, profiles []string) []string {
+	var values []string
+	switch completionFlags[flag] {
+	case "account":
+		numbers := make([]string, 0, len(index.Accounts))
+		for number := range index.Accounts {
+			numbers = append(numbers, number)
+		}
+		sort.Strings(numbers)
+		for _, number := range numbers {
+			account := index.Accounts[number]
+			description := account.Name
+			if account.Project != "" {
+				description += " in " + account.Project
+			}
+			values = append(values, FormatCompletion(shell, number, description))
+		}
+	case "car":
+		values = append(values, index.CARs...)
+	case "project":
+		values = append(values, index.Projects...)
+	case "profile":
+		values = append(values, profiles...)
+		sort.Strings(values)
+	}
+	return values
+}
+
+// WriteCompletionIndex writes the completion index to path.
+func WriteCompletionIndex(path string, index CompletionIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadCompletionIndex reads the completion index at path, empty if none has
+// been written.
+func ReadCompletionIndex(path string) (CompletionIndex, error) {
+	var index CompletionIndex
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
+
+// FavoriteDescription describes a favorite for completions: its cloud access
+// role, account name and number, and project when known, such as "Admin on
+// Sandbox (111122223333) in Data Platform".
+func FavoriteDescription(favorite structs.Favorite, index CompletionIndex) string {
+	account := index.Accounts[favorite.Account]
+	name := favorite.AccountAlias
+	if name == "" {
+		name = account.Name
+	}
+
+	var b strings.Builder
+	if favorite.CAR != "" {
+		fmt.Fprintf(&b, "%v on ", favorite.CAR)
+	}
+	switch {
+	case name != "" && favorite.Account != "":
+		fmt.Fprintf(&b, "%v (%v)", name, favorite.Account)
+	case name != "":
+		b.WriteString(name)
+	default:
+		b.WriteString(favorite.Account)
+	}
+	if account.Project != "" {
+		fmt.Fprintf(&b, " in %v", account.Project)
+	}
+	if favorite.AccessType == kion.AccessLevelWeb {
+		b.WriteString(", web")
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package helper
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range CompletionShells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := CompletionScript(shell, false, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(script, CompletionEnv) {
+				t.Errorf("undescribed script asks for descriptions:\n%v", script)
+			}
+			described, err := CompletionScript(shell, true, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := shell != "bash"; strings.Contains(described, CompletionEnv+"="+shell) != want {
+				t.Errorf("described script asks for descriptions %v, wanted %v:\n%v", !want, want, described)
+			}
+		})
+	}
+
+	_, err := CompletionScript("tcsh", false, "")
+	if err == nil {
+		t.Error("got no error for an unsupported shell")
+	}
+}
+
+func TestFormatCompletion(t *testing.T) {
+	tests := []struct {
+		description string
+		shell       string
+		value       string
+		desc        string
+		want        string
+	}{
+		{"Bash", "bash", "prod", "Admin on Prod (111122223333)", "prod"},
+		{"Zsh", "zsh", "prod", "Admin on Prod (111122223333)", "prod:Admin on Prod (111122223333)"},
+		{"Zsh Colon", "zsh", "team:prod", "Admin", `team\:prod:Admin`},
+		{"Fish", "fish", "prod", "Admin on Prod (111122223333)", "prod\tAdmin on Prod (111122223333)"},
+		{"No Description", "zsh", "team:prod", "", "team:prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := FormatCompletion(test.shell, test.value, test.desc)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFavoriteDescription(t *testing.T) {
+	inventory := kion.Inventory{
+		Projects: []kion.Project{{ID: 7, Name: "Data Platform"}},
+		CARs:     []kion.CAR{{AccountNumber: "111122223333", AccountName: "Sandbox", ProjectID: 7}},
+	}
+	path := filepath.Join(t.TempDir(), "completion.json")
+	err := WriteCompletionIndex(path, NewCompletionIndex(inventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := ReadCompletionIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		favorite    structs.Favorite
+		want        string
+	}{
+		{
+			"Indexed",
+			structs.Favorite{Account: "111122223333", CAR: "Admin"},
+			"Admin on Sandbox (111122223333) in Data Platform",
+		},
+		{
+			"Alias",
+			structs.Favorite{Account: "111122223333", AccountAlias: "sbx", CAR: "Admin", AccessType: "web"},
+			"Admin on sbx (111122223333) in Data Platform, web",
+		},
+		{
+			"Not Indexed",
+			structs.Favorite{Account: "444455556666", CAR: "ReadOnly"},
+			"ReadOnly on 444455556666",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := FavoriteDescription(test.favorite, index)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+
+	missing, err := ReadCompletionIndex(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(missing.Accounts) != 0 {
+		t.Errorf("got %v, %v for a missing index, wanted an empty index", missing, err)
+	}
+}
+
+func TestCompletionFlag(t *testing.T) {
+	tests := []struct {
+		description string
+		words       []string
+		want        string
+	}{
+		{"Long", []string{"kion", "stak", "--car"}, "car"},
+		{"Short", []string{"kion", "stak", "-a"}, "a"},
+		{"Global", []string{"kion", "--profile"}, "profile"},
+		{"Value Given", []string{"kion", "stak", "--car=Admin"}, ""},
+		{"Other Flag", []string{"kion", "stak", "--region"}, ""},
+		{"Argument", []string{"kion", "stak", "prod"}, ""},
+		{"Empty", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := CompletionFlag(test.words); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFlagCompletions(t *testing.T) {
+	index := NewCompletionIndex(kion.Inventory{
+		Projects: []kion.Project{{ID: 7, Name: "Data Platform"}, {ID: 3, Name: "Payments"}},
+		CARs: []kion.CAR{
+			{Name: "ReadOnly", AccountNumber: "444455556666", AccountName: "Prod", ProjectID: 3},
+			{Name: "Admin", AccountNumber: "111122223333", AccountName: "Sandbox", ProjectID: 7},
+			{Name: "ReadOnly", AccountNumber: "111122223333", AccountName: "Sandbox", ProjectID: 7},
+		},
+	})
+	profiles := []string{"work", "staging"}
+
+	tests := []struct {
+		description string
+		flag        string
+		shell       string
+		want        []string
+	}{
+		{"Accounts", "account", "", []string{"111122223333", "444455556666"}},
+		{"Accounts Described", "a", "zsh", []string{"111122223333:Sandbox in Data Platform", "444455556666:Prod in Payments"}},
+		{"Cloud Access Roles", "cloud-access-role", "", []string{"Admin", "ReadOnly"}},
+		{"Projects", "project", "", []string{"Data Platform", "Payments"}},
+		{"Profiles", "profile", "", []string{"staging", "work"}},
+		{"Unknown", "region", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := FlagCompletions(test.flag, test.shell, index, profiles)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
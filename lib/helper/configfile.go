@@ -0,0 +1,506 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Config Management                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ConfigSecretKeys are configuration keys holding secrets, which kion config
+// set prompts for rather than taking on the command line where they would be
+// saved to shell history.
+var ConfigSecretKeys = []string{"password", "api_key", "secret"}
+
+// IsConfigSecret reports whether the dotted configuration key holds a secret.
+func IsConfigSecret(key string) bool {
+	path := strings.Split(key, ".")
+	return slices.Contains(ConfigSecretKeys, path[len(path)-1])
+}
+
+// CheckConfigKey returns an error unless key is the dotted path of a setting
+// or section in the configuration file, such as kion.url or
+// profiles.work.favorites. Keys of maps such as profiles and aliases can be
+// anything.
+func CheckConfigKey(key string) error {
+	t := reflect.TypeOf(structs.Configuration{})
+	path := strings.Split(key, ".")
+	for i, name := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			field, found := configField(t, name)
+			if !found {
+				return fmt.Errorf("unknown setting %v, see kion config schema for those available", strings.Join(path[:i+1], "."))
+			}
+			t = field.Type
+		default:
+			return fmt.Errorf("%v is not a section", strings.Join(path[:i], "."))
+		}
+	}
+	return nil
+}
+
+// configField returns the field of a configuration struct with the yaml name
+// given.
+func configField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if yamlName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// yamlName returns the name of a struct field in yaml, or nothing if it isn't
+// written.
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// ConfigValue returns the value set for the dotted key in the configuration
+// file data, a scalar as it is and a section or list as yaml, and whether it
+// is set at all.
+func ConfigValue(data []byte, key string) (string, bool, error) {
+	err := CheckConfigKey(key)
+	if err != nil {
+		return "", false, err
+	}
+	var root yamlv3.Node
+	err = yamlv3.Unmarshal(data, &root)
+	if err != nil {
+		return "", false, err
+	}
+	if len(root.Content) == 0 {
+		return "", false, nil
+	}
+
+	node := root.Content[0]
+	for _, name := range strings.Split(key, ".") {
+		node = mappingValue(node, name)
+		if node == nil {
+			return "", false, nil
+		}
+	}
+	if node.Kind == yamlv3.ScalarNode {
+		return node.Value, node.Tag != "!!null", nil
+	}
+	var out bytes.Buffer
+	encoder := yamlv3.NewEncoder(&out)
+	encoder.SetIndent(2)
+	err = encoder.Encode(node)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true, nil
+}
+
+// SetConfigValue returns the configuration file data with the dotted key set
+// to value, parsed as yaml so lists can be given as [a, b] and an empty value
+// clears the setting. Sections along the way are added when missing. Comments
+// are kept, and a plain value replacing another is edited in place so the
+// rest of the file is left exactly as it was. The result must be a valid
+// configuration, so unknown keys and values of the wrong type are rejected.
+func SetConfigValue(data []byte, key string, value string) ([]byte, error) {
+	err := CheckConfigKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var parsed yamlv3.Node
+	err = yamlv3.Unmarshal([]byte(value), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %v: %w", key, err)
+	}
+	replacement := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!null"}
+	if len(parsed.Content) > 0 {
+		replacement = parsed.Content[0]
+	}
+
+	var root yamlv3.Node
+	err = yamlv3.Unmarshal(data, &root)
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		root = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode}}}
+	}
+
+	// walk to the setting, adding sections that are missing
+	node := root.Content[0]
+	path := strings.Split(key, ".")
+	for i, name := range path[:len(path)-1] {
+		if node.Kind != yamlv3.MappingNode {
+			return nil, fmt.Errorf("%v is not a section", strings.Join(path[:i], "."))
+		}
+		child := mappingValue(node, name)
+		if child == nil || (child.Kind == yamlv3.ScalarNode && child.Tag == "!!null") {
+			child = setMappingValue(node, name, &yamlv3.Node{Kind: yamlv3.MappingNode})
+		}
+		node = child
+	}
+	if node.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("%v is not a section", strings.Join(path[:len(path)-1], "."))
+	}
+
+	name := path[len(path)-1]
+	updated, edited := editScalarInPlace(data, mappingValue(node, name), replacement)
+	if !edited {
+		setMappingValue(node, name, replacement)
+		var out bytes.Buffer
+		encoder := yamlv3.NewEncoder(&out)
+		encoder.SetIndent(2)
+		err = encoder.Encode(&root)
+		if err != nil {
+			return nil, err
+		}
+		updated = out.Bytes()
+	}
+
+	// make sure the result still reads as a configuration
+	migrated, _, err := MigrateConfig(updated)
+	if err != nil {
+		return nil, err
+	}
+	var config structs.Configuration
+	err = yaml.UnmarshalStrict(migrated, &config)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return nil, fmt.Errorf("unable to set %v: %v", key, overrideErrors(typeErr))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to set %v: %w", key, err)
+	}
+	var invalid []string
+	checkConfigValues(reflect.ValueOf(config), "", func(path string, detail string) {
+		if path == key || strings.HasPrefix(path, key+".") || strings.HasPrefix(path, key+"[") {
+			invalid = append(invalid, detail)
+		}
+	})
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("unable to set %v: %v", key, strings.Join(invalid, ", "))
+	}
+	return updated, nil
+}
+
+// setMappingValue sets the value for a key in a mapping node, adding the key
+// if it isn't present, and returns the value.
+func setMappingValue(mapping *yamlv3.Node, key string, value *yamlv3.Node) *yamlv3.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			// keep any comment on the line of the old value
+			value.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = value
+			return value
+		}
+	}
+	mapping.Content = append(mapping.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: key}, value)
+	return value
+}
+
+// editScalarInPlace replaces the text of the plain scalar old in data with
+// the plain scalar replacement, reporting whether it could. Anything else is
+// left to re-encoding the document.
+func editScalarInPlace(data []byte, old *yamlv3.Node, replacement *yamlv3.Node) ([]byte, bool) {
+	plain := func(node *yamlv3.Node) bool {
+		return node != nil && node.Kind == yamlv3.ScalarNode && node.Style == 0 && node.Value != "" && !strings.Contains(node.Value, "\n")
+	}
+	if !plain(old) || !plain(replacement) {
+		return nil, false
+	}
+	lines := strings.Split(string(data), "\n")
+	if old.Line > len(lines) {
+		return nil, false
+	}
+	line := lines[old.Line-1]
+	start := old.Column - 1
+	if start > len(line) || !strings.HasPrefix(line[start:], old.Value) {
+		return nil, false
+	}
+	lines[old.Line-1] = line[:start] + replacement.Value + line[start+len(old.Value):]
+	return []byte(strings.Join(lines, "\n")), true
+}
+
+// configFieldError matches yaml's description of an unknown key, such as
+// "line 3: field endpoint not found in type structs.Kion".
+var configFieldError = regexp.MustCompile(`^line (\d+): field (\S+) not found in type structs\.(\w+)$`)
+
+// configTypeError matches yaml's description of a value of the wrong type,
+// such as "line 4: cannot unmarshal !!str `soon` into int".
+var configTypeError = regexp.MustCompile("^line (\\d+): cannot unmarshal !!\\w+ `(.*)` into (\\S+)$")
+
+// explainConfigError rewrites yaml's description of a problem with a setting
+// in terms of the configuration file rather than the structs it's read into.
+func explainConfigError(reason string) string {
+	if match := configFieldError.FindStringSubmatch(reason); match != nil {
+		return fmt.Sprintf("line %v: unknown setting %v in %v, check its spelling against kion config schema", match[1], match[2], strings.ToLower(match[3]))
+	}
+	if match := configTypeError.FindStringSubmatch(reason); match != nil {
+		expected := "a section"
+		switch {
+		case strings.HasPrefix(match[3], "[]"):
+			expected = "a list"
+		case strings.HasPrefix(match[3], "int"), strings.HasPrefix(match[3], "uint"):
+			expected = "a number"
+		case match[3] == "bool":
+			expected = "true or false"
+		case match[3] == "string":
+			expected = "text"
+		}
+		return fmt.Sprintf("line %v: %v is not valid here, expected %v", match[1], match[2], expected)
+	}
+	return reason
+}
+
+// ValidateConfig checks configuration file data without reaching anything:
+// that it is valid yaml, uses no outdated or unknown settings, has values of
+// the right types, formats, and choices, and that each profile's sign in
+// settings are consistent. Each problem is described with how to fix it.
+func ValidateConfig(data []byte) []URLCheck {
+	var checks []URLCheck
+	add := func(name string, status string, detail string, args ...any) {
+		checks = append(checks, URLCheck{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	var root yamlv3.Node
+	err := yamlv3.Unmarshal(data, &root)
+	if err != nil {
+		add("syntax", CheckFail, "%v", strings.TrimPrefix(err.Error(), "yaml: "))
+		return checks
+	}
+	add("syntax", CheckOK, "valid yaml")
+
+	// outdated settings still work but are worth updating
+	migrated, migrations, err := MigrateConfig(data)
+	if err != nil {
+		add("deprecations", CheckFail, "%v", err)
+		return checks
+	}
+	for _, migration := range migrations {
+		add("deprecations", CheckWarn, "line %v: %v, run kion config migrate to update it", migration.Line, migration.Description)
+	}
+	if len(migrations) == 0 {
+		add("deprecations", CheckOK, "no outdated settings")
+	}
+
+	// unknown keys and values of the wrong type
+	var config structs.Configuration
+	err = yaml.UnmarshalStrict(migrated, &config)
+	var typeErr *yaml.TypeError
+	switch {
+	case errors.As(err, &typeErr):
+		for _, reason := range typeErr.Errors {
+			add("schema", CheckFail, "%v", explainConfigError(reason))
+		}
+		_ = yaml.Unmarshal(migrated, &config)
+	case err != nil:
+		add("schema", CheckFail, "%v", err)
+		return checks
+	default:
+		add("schema", CheckOK, "all settings known with values of the right type")
+	}
+
+	// choices, required settings, and durations
+	before := len(checks)
+	checkConfigValues(reflect.ValueOf(config), "", func(_ string, detail string) {
+		add("values", CheckFail, "%v", detail)
+	})
+	if len(checks) == before {
+		add("values", CheckOK, "choices, required settings, and durations are valid")
+	}
+
+	// sign in settings of each profile
+	checks = append(checks, checkConfigProfile("kion", config.Kion, config.Favorites)...)
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		profile := config.Profiles[name]
+		checks = append(checks, checkConfigProfile("profiles."+name+".kion", profile.Kion, profile.Favorites)...)
+	}
+
+	return checks
+}
+
+// checkConfigValues calls fail with the path and a description of each
+// setting under v, found at path, that isn't one of its enum tag's choices, is
+// missing though its required tag is set, or isn't a duration though its
+// format tag is.
+func checkConfigValues(v reflect.Value, path string, fail func(string, string)) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			checkConfigValues(v.Elem(), path, fail)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			checkConfigValues(v.Index(i), fmt.Sprintf("%v[%v]", path, i), fail)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		for _, key := range keys {
+			checkConfigValues(v.MapIndex(key), join(key.String()), fail)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := yamlName(field)
+			if name == "" {
+				continue
+			}
+			value := v.Field(i)
+			if value.Kind() != reflect.String {
+				checkConfigValues(value, join(name), fail)
+				continue
+			}
+
+			setting := value.String()
+			switch {
+			case setting == "" && field.Tag.Get("required") == "true":
+				fail(join(name), fmt.Sprintf("%v is required", join(name)))
+			case setting == "":
+			case field.Tag.Get("enum") != "" && !slices.Contains(strings.Split(field.Tag.Get("enum"), ","), setting):
+				fail(join(name), fmt.Sprintf("%v is %q, expected one of %v", join(name), setting, strings.ReplaceAll(field.Tag.Get("enum"), ",", ", ")))
+			case field.Tag.Get("format") == "duration":
+				if _, err := time.ParseDuration(setting); err != nil {
+					fail(join(name), fmt.Sprintf("%v is %q, expected a duration such as 30s, 5m, or 1h30m", join(name), setting))
+				}
+			}
+		}
+	}
+}
+
+// checkConfigProfile checks that the sign in settings of a profile's kion
+// section, found at path, are consistent and that its favorites can be told
+// apart.
+func checkConfigProfile(path string, settings structs.Kion, favorites []structs.Favorite) []URLCheck {
+	var checks []URLCheck
+	add := func(status string, detail string, args ...any) {
+		checks = append(checks, URLCheck{Name: path, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	if settings.Url == "" {
+		add(CheckWarn, "no url, it will be asked for on every run, set %v.url", path)
+	}
+
+	// the settings each sign in method needs
+	missing := map[string][]string{
+		"api_key":  {},
+		"password": {},
+		"saml":     {},
+	}
+	need := func(method string, value string, name string) {
+		if value == "" {
+			missing[method] = append(missing[method], path+"."+name)
+		}
+	}
+	need("password", settings.Username, "username")
+	need("password", settings.IDMS, "idms_id")
+	need("saml", settings.SamlMetadataFile, "saml_metadata_file")
+	need("saml", settings.SamlIssuer, "saml_sp_issuer")
+
+	_, known := missing[settings.AuthMethod]
+	switch method := settings.AuthMethod; {
+	case method != "" && !known:
+		// reported with the other invalid choices
+	case method == "api_key" && settings.ApiKey == "":
+		add(CheckWarn, "auth_method is api_key but no api_key is set, KION_API_KEY must be set when running")
+	case method != "" && len(missing[method]) > 0:
+		add(CheckFail, "auth_method is %v but %v not set", method, describeMissing(missing[method]))
+	case method != "":
+		add(CheckOK, "signs in with %v", method)
+	default:
+		// without a method the first configured in this order is used
+		var configured []string
+		if settings.ApiKey != "" {
+			configured = append(configured, "api_key")
+		}
+		if settings.Username != "" || settings.Password != "" {
+			configured = append(configured, "password")
+			if settings.IDMS == "" {
+				add(CheckFail, "a username is set for password sign in but %v.idms_id is not, see kion try-url for the IDMS available", path)
+			}
+		}
+		if len(missing["saml"]) == 0 {
+			configured = append(configured, "saml")
+		} else if len(missing["saml"]) == 1 {
+			add(CheckFail, "saml sign in is partly configured, %v not set", describeMissing(missing["saml"]))
+		}
+		switch len(configured) {
+		case 0:
+			add(CheckWarn, "no sign in method is configured, one will be asked for on every run, set %v.auth_method", path)
+		case 1:
+			add(CheckOK, "signs in with %v", configured[0])
+		default:
+			add(CheckWarn, "%v are configured, %v is used, set %v.auth_method to choose", strings.Join(configured, " and "), configured[0], path)
+		}
+	}
+
+	if settings.Password != "" {
+		add(CheckWarn, "the password is stored in plain text, set KION_PASSWORD instead or sign in another way")
+	}
+	if (settings.SamlSPKeyFile == "") != (settings.SamlSPCertFile == "") {
+		add(CheckFail, "saml_sp_key_file and saml_sp_cert_file must be set together")
+	}
+	if (settings.SamlCallbackCert == "") != (settings.SamlCallbackKey == "") {
+		add(CheckFail, "saml_callback_cert_file and saml_callback_key_file must be set together")
+	}
+
+	// favorites are chosen by name
+	seen := make(map[string]bool)
+	for _, favorite := range favorites {
+		if seen[favorite.Name] && favorite.Name != "" {
+			add(CheckFail, "favorite %q is defined more than once, only the first is used", favorite.Name)
+		}
+		seen[favorite.Name] = true
+		if favorite.Account == "" && favorite.AccountAlias == "" {
+			add(CheckFail, "favorite %q needs an account or account_alias", favorite.Name)
+		}
+	}
+
+	return checks
+}
+
+// describeMissing lists settings that aren't set, such as "a and b are".
+func describeMissing(settings []string) string {
+	if len(settings) == 1 {
+		return settings[0] + " is"
+	}
+	return strings.Join(settings, " and ") + " are"
+}
@@ -0,0 +1,193 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConfigKey(t *testing.T) {
+	tests := []struct {
+		description string
+		key         string
+		wantErr     string
+	}{
+		{"Setting", "kion.url", ""},
+		{"Section", "kion.access_warnings", ""},
+		{"Profile Setting", "profiles.work.kion.url", ""},
+		{"Alias", "aliases.pa", ""},
+		{"Unknown", "kion.endpoint", "unknown setting kion.endpoint"},
+		{"Not A Section", "kion.url.host", "kion.url is not a section"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckConfigKey(test.key)
+			if test.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got error %v, wanted %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	data := []byte("kion:\n  url: https://kion.example.com # prod\n  browser:\nfavorites:\n  - name: prod\n    account: \"111122223333\"\n")
+
+	tests := []struct {
+		description string
+		key         string
+		want        string
+		wantFound   bool
+	}{
+		{"Scalar", "kion.url", "https://kion.example.com", true},
+		{"Empty", "kion.browser", "", false},
+		{"Missing", "kion.username", "", false},
+		{"List", "favorites", "- name: prod\n  account: \"111122223333\"", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, found, err := ConfigValue(data, test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want || found != test.wantFound {
+				t.Errorf("got %q, %v, wanted %q, %v", got, found, test.want, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestSetConfigValue(t *testing.T) {
+	data := "# my settings\nkion:\n  url: https://kion.example.com   # prod\n\n  username: jane\n"
+
+	tests := []struct {
+		description string
+		key         string
+		value       string
+		want        string
+		wantErr     string
+	}{
+		{
+			"In Place",
+			"kion.url",
+			"https://kion.other.example.com",
+			"# my settings\nkion:\n  url: https://kion.other.example.com   # prod\n\n  username: jane\n",
+			"",
+		},
+		{
+			"New Section",
+			"kion.access_warnings.dormant_days",
+			"30",
+			"# my settings\nkion:\n  url: https://kion.example.com # prod\n  username: jane\n  access_warnings:\n    dormant_days: 30\n",
+			"",
+		},
+		{
+			"List",
+			"kion.browser_profiles",
+			"[Work, Personal]",
+			"# my settings\nkion:\n  url: https://kion.example.com # prod\n  username: jane\n  browser_profiles: [Work, Personal]\n",
+			"",
+		},
+		{"Unknown Key", "kion.endpoint", "x", "", "unknown setting kion.endpoint"},
+		{"Wrong Type", "kion.access_warnings.dormant_days", "soon", "", "unable to set kion.access_warnings.dormant_days"},
+		{"Not A Section", "kion.url.host", "x", "", "kion.url is not a section"},
+		{"Invalid Duration", "kion.outage_retry", "soon", "", `kion.outage_retry is "soon", expected a duration`},
+		{"Invalid Choice", "kion.auth_method", "sso", "", `kion.auth_method is "sso", expected one of api_key, password, saml`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SetConfigValue([]byte(data), test.key, test.value)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, wanted %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", string(got), test.want)
+			}
+		})
+	}
+
+	// a missing file starts a new one
+	got, err := SetConfigValue(nil, "kion.url", "https://kion.example.com")
+	if err != nil || string(got) != "kion:\n  url: https://kion.example.com\n" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		description string
+		config      string
+		want        []URLCheck
+	}{
+		{
+			"Valid",
+			"kion:\n  url: https://kion.example.com\n  api_key: app_123\nfavorites:\n  - name: prod\n    account: \"111122223333\"\n",
+			[]URLCheck{
+				{"syntax", CheckOK, "valid yaml"},
+				{"deprecations", CheckOK, "no outdated settings"},
+				{"schema", CheckOK, "all settings known with values of the right type"},
+				{"values", CheckOK, "choices, required settings, and durations are valid"},
+				{"kion", CheckOK, "signs in with api_key"},
+			},
+		},
+		{
+			"Syntax",
+			"kion:\n  url: [\n",
+			[]URLCheck{{"syntax", CheckFail, "line 2: did not find expected node content"}},
+		},
+		{
+			"Problems",
+			"kion:\n  url: https://kion.example.com\n  endpoint: x\n  user: jane\n  auth_method: saml\n  saml_sp_issuer: kion\n  outage_retry: soon\n  access_warnings:\n    dormant_days: soon\nfavorites:\n  - account: \"111\"\n    access_type: portal\n",
+			[]URLCheck{
+				{"syntax", CheckOK, "valid yaml"},
+				{"deprecations", CheckWarn, "line 4: user is now username, run kion config migrate to update it"},
+				{"schema", CheckFail, "line 3: unknown setting endpoint in kion, check its spelling against kion config schema"},
+				{"schema", CheckFail, "line 9: soon is not valid here, expected a number"},
+				{"values", CheckFail, `kion.outage_retry is "soon", expected a duration such as 30s, 5m, or 1h30m`},
+				{"values", CheckFail, "favorites[0].name is required"},
+				{"values", CheckFail, `favorites[0].access_type is "portal", expected one of cli, web`},
+				{"kion", CheckFail, "auth_method is saml but kion.saml_metadata_file is not set"},
+			},
+		},
+		{
+			"Ambiguous Sign In",
+			"kion:\n  url: https://kion.example.com\n  username: jane\n  password: hunter2\n  saml_metadata_file: https://idp.example.com/metadata\n  saml_sp_issuer: kion\nprofiles:\n  work:\n    kion:\n      saml_sp_issuer: kion\n",
+			[]URLCheck{
+				{"syntax", CheckOK, "valid yaml"},
+				{"deprecations", CheckOK, "no outdated settings"},
+				{"schema", CheckOK, "all settings known with values of the right type"},
+				{"values", CheckOK, "choices, required settings, and durations are valid"},
+				{"kion", CheckFail, "a username is set for password sign in but kion.idms_id is not, see kion try-url for the IDMS available"},
+				{"kion", CheckWarn, "password and saml are configured, password is used, set kion.auth_method to choose"},
+				{"kion", CheckWarn, "the password is stored in plain text, set KION_PASSWORD instead or sign in another way"},
+				{"profiles.work.kion", CheckWarn, "no url, it will be asked for on every run, set profiles.work.kion.url"},
+				{"profiles.work.kion", CheckFail, "saml sign in is partly configured, profiles.work.kion.saml_metadata_file is not set"},
+				{"profiles.work.kion", CheckWarn, "no sign in method is configured, one will be asked for on every run, set profiles.work.kion.auth_method"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ValidateConfig([]byte(test.config))
+			if len(got) != len(test.want) {
+				t.Fatalf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
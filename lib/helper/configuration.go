@@ -1,8 +1,12 @@
 package helper
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/kionsoftware/kion-cli/lib/filesystem"
 	"github.com/kionsoftware/kion-cli/lib/structs"
 
 	"gopkg.in/yaml.v2"
@@ -22,8 +26,12 @@ func LoadConfig(filename string, config *structs.Configuration) error {
 		return err
 	}
 
-	// unmarshal to config struct
-	return yaml.Unmarshal(bytes, &config)
+	return ParseConfig(bytes, config)
+}
+
+// ParseConfig unmarshals configuration yaml into config.
+func ParseConfig(data []byte, config *structs.Configuration) error {
+	return yaml.Unmarshal(data, config)
 }
 
 // SaveConfig saves the entirety of the current config to the users config file.
@@ -34,6 +42,37 @@ func SaveConfig(filename string, config structs.Configuration) error {
 		return err
 	}
 
-	// write it out
-	return os.WriteFile(filename, bytes, 0644)
+	// write it out, creating the directory on first save
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err == nil {
+		err = os.WriteFile(filename, bytes, 0644)
+	}
+	if filesystem.IsReadOnly(err) {
+		return fmt.Errorf("unable to save %v as the location is read-only, make the change manually or set KION_CONFIG to a writable file: %w", filename, err)
+	}
+	return err
+}
+
+// SaveFavorites replaces the favorites of the named profile, or the default
+// profile if empty, in the configuration file. All other values are preserved
+// as they were read from disk.
+func SaveFavorites(filename string, profile string, favs []structs.Favorite) error {
+	var config structs.Configuration
+	err := LoadConfig(filename, &config)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if profile == "" {
+		config.Favorites = favs
+	} else {
+		p, found := config.Profiles[profile]
+		if !found {
+			return fmt.Errorf("profile not found: %s", profile)
+		}
+		p.Favorites = favs
+		config.Profiles[profile] = p
+	}
+
+	return SaveConfig(filename, config)
 }
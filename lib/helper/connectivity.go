@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Connectivity                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// CheckConnectivity diagnoses how the Kion URL is reached from here: what it
+// resolves to, whether that is one of the private CIDRs when given, whether
+// the certificate presented is trusted and issued for it, and whether Kion
+// answers. Later checks are skipped once one fails.
+func CheckConnectivity(host string, cidrs []string) []URLCheck {
+	var checks []URLCheck
+	add := func(name string, status string, detail string, args ...any) {
+		checks = append(checks, URLCheck{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+	ctx := context.Background()
+
+	hostname, addr, err := kion.HostAddress(host)
+	if err != nil {
+		add("url", CheckFail, "%v", err)
+		return checks
+	}
+
+	// dns
+	ips, err := kion.LookupHost(ctx, hostname)
+	if err != nil {
+		add("dns", CheckFail, "%v does not resolve: %v", hostname, err)
+		return checks
+	}
+	add("dns", CheckOK, "%v resolves to %v", hostname, ips)
+
+	// split horizon, private names resolving publicly mean we're off network
+	switch private, err := kion.InNetworks(ips, cidrs); {
+	case len(cidrs) == 0:
+		add("private address", CheckSkip, "no api.private_cidrs configured")
+	case err != nil:
+		add("private address", CheckFail, "%v", err)
+		return checks
+	case !private:
+		add("private address", CheckFail, "resolved outside of %v, the public address is in use", cidrs)
+		return checks
+	default:
+		add("private address", CheckOK, "resolved within %v", cidrs)
+	}
+
+	// tls
+	if u, _ := url.Parse(host); u.Scheme == "http" {
+		add("tls", CheckWarn, "not in use, credentials would be sent unencrypted")
+	} else {
+		err := kion.CheckTLS(ctx, addr, hostname)
+		switch {
+		case err == nil:
+			add("tls", CheckOK, "certificate valid for %v", hostname)
+		case kion.IsCertificateError(err):
+			add("tls", CheckFail, "certificate not valid for %v, this is likely a different endpoint: %v", hostname, err)
+			return checks
+		default:
+			add("tls", CheckFail, "handshake with %v failed: %v", addr, err)
+			return checks
+		}
+	}
+
+	// kion itself
+	kionVersion, err := kion.GetVersion(host)
+	if err != nil {
+		add("health", CheckFail, "unreachable: %v", err)
+		return checks
+	}
+	add("health", CheckOK, "Kion %v", kionVersion)
+
+	return checks
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package helper
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// anonymousFile returns an in-memory file, never written to disk. Opening
+// /dev/fd/N of it opens the file afresh, so each reader starts at the top.
+// Kernels without memfd_create get an unlinked temp file instead.
+func anonymousFile() (*os.File, error) {
+	fd, err := unix.MemfdCreate("kion-credentials", 0)
+	if err != nil {
+		return unlinkedTempFile()
+	}
+	return os.NewFile(uintptr(fd), "kion-credentials"), nil
+}
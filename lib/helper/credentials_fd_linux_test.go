@@ -0,0 +1,35 @@
+//go:build linux
+
+package helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestCredentialsFDRereadable(t *testing.T) {
+	stak := kion.STAK{AccessKey: "AKIA", SecretAccessKey: "secret", SessionToken: "token"}
+	want := "[default]\naws_access_key_id=AKIA\naws_secret_access_key=secret\naws_session_token=token\n"
+
+	credsFile, err := credentialsFD(stak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credsFile.Close()
+
+	// SDKs open the credentials file again for each session, such as one per
+	// terraform provider alias
+	path := fmt.Sprintf("/dev/fd/%d", credsFile.Fd())
+	for read := 1; read <= 2; read++ {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("read %v\ngot:\n  %q\nwanted:\n  %q", read, got, want)
+		}
+	}
+}
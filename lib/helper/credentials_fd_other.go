@@ -0,0 +1,15 @@
+//go:build !unix
+
+package helper
+
+import (
+	"errors"
+	"os"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+// credentialsFD is not supported without /dev/fd.
+func credentialsFD(stak kion.STAK) (*os.File, error) {
+	return nil, errors.New("passing credentials on a file descriptor is not supported on this platform")
+}
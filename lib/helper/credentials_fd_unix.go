@@ -0,0 +1,57 @@
+//go:build unix
+
+package helper
+
+import (
+	"io"
+	"os"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"golang.org/x/sys/unix"
+)
+
+// credentialsFD writes an AWS credentials file for the stak to a file that
+// exists only as a descriptor and returns it, left open across exec so a
+// command can read it from /dev/fd. SDKs read the credentials file again for
+// each session, so unlike a pipe the file is re-readable. The caller must keep
+// the file open until the command starts.
+func credentialsFD(stak kion.STAK) (*os.File, error) {
+	f, err := anonymousFile()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.WriteString(CredentialsFile(stak))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// files are opened close on exec, clear it so the command inherits it
+	_, err = unix.FcntlInt(f.Fd(), unix.F_SETFD, 0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// unlinkedTempFile returns a temp file, readable only by the user, that is
+// removed as soon as it is created so it lives only as long as its
+// descriptors.
+func unlinkedTempFile() (*os.File, error) {
+	f, err := os.CreateTemp("", "kion-credentials-*")
+	if err != nil {
+		return nil, err
+	}
+	err = os.Remove(f.Name())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
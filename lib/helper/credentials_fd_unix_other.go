@@ -0,0 +1,12 @@
+//go:build unix && !linux
+
+package helper
+
+import "os"
+
+// anonymousFile returns an unlinked temp file as there is no memfd_create.
+// Opening /dev/fd/N of it duplicates the descriptor on these systems, sharing
+// its offset, so readers after the first must rewind to see the credentials.
+func anonymousFile() (*os.File, error) {
+	return unlinkedTempFile()
+}
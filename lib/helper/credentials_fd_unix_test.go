@@ -0,0 +1,39 @@
+//go:build unix
+
+package helper
+
+import (
+	"io"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"golang.org/x/sys/unix"
+)
+
+func TestCredentialsFD(t *testing.T) {
+	stak := kion.STAK{AccessKey: "AKIA", SecretAccessKey: "secret", SessionToken: "token"}
+	want := "[default]\naws_access_key_id=AKIA\naws_secret_access_key=secret\naws_session_token=token\n"
+
+	credsFile, err := credentialsFD(stak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credsFile.Close()
+
+	// the descriptor must survive exec
+	flags, err := unix.FcntlInt(credsFile.Fd(), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.FD_CLOEXEC != 0 {
+		t.Error("descriptor is close on exec")
+	}
+
+	got, err := io.ReadAll(credsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Deprecations                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DeprecationKind is the kind of setting a deprecation applies to.
+type DeprecationKind string
+
+const (
+	// DeprecatedFlag is a command line flag, named without leading dashes.
+	DeprecatedFlag DeprecationKind = "flag"
+
+	// DeprecatedConfigKey is a configuration key, named by its path such as
+	// kion.endpoint, favorites being a list of mappings.
+	DeprecatedConfigKey DeprecationKind = "config key"
+
+	// DeprecatedConfigValue is a value of a configuration key, named as
+	// path=value such as favorites.access_type=console.
+	DeprecatedConfigValue DeprecationKind = "config value"
+)
+
+// Deprecation maps an outdated flag, configuration key, or value to the one
+// replacing it. The outdated one keeps working, with a warning, from the
+// Since release until the Removal release.
+type Deprecation struct {
+	Kind DeprecationKind
+	Old  string
+	New  string
+
+	// Command is the space separated path of the command a deprecated flag
+	// belongs to, such as "favorite add", empty for global flags.
+	Command string
+
+	Since   string
+	Removal string
+}
+
+// Deprecations lists every outdated flag, configuration key, and value Kion
+// CLI still understands. Renaming one adds an entry here rather than dropping
+// the old name, so existing scripts and configuration keep working with a
+// warning until the removal release.
+var Deprecations = []Deprecation{
+	{Kind: DeprecatedConfigKey, Old: "kion.endpoint", New: "kion.url", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "kion.user", New: "kion.username", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "kion.token", New: "kion.api_key", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "kion.app_api_key", New: "kion.api_key", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "kion.idms", New: "kion.idms_id", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "kion.saml_issuer", New: "kion.saml_sp_issuer", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "favorites.car", New: "favorites.cloud_access_role", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigKey, Old: "favorites.account_number", New: "favorites.account", Since: "v0.4.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigValue, Old: "favorites.access_type=console", New: "favorites.access_type=web", Since: "v0.1.0", Removal: "v1.0.0"},
+	{Kind: DeprecatedConfigValue, Old: "favorites.access_type=stak", New: "favorites.access_type=cli", Since: "v0.1.0", Removal: "v1.0.0"},
+}
+
+// LookupDeprecation returns the deprecation of an outdated flag,
+// configuration key, or value.
+func LookupDeprecation(deprecations []Deprecation, kind DeprecationKind, old string) (Deprecation, bool) {
+	for _, deprecation := range deprecations {
+		if deprecation.Kind == kind && deprecation.Old == old {
+			return deprecation, true
+		}
+	}
+	return Deprecation{}, false
+}
+
+// displayName returns how a flag, key, or value is written in a warning.
+func (d Deprecation) displayName(name string) string {
+	if d.Kind == DeprecatedFlag {
+		return "--" + name
+	}
+	return name
+}
+
+// DeprecationWarnings prints a warning the first time each deprecation is
+// used. Warnings are a single line of fixed text followed by key=value fields
+// so they can be found in the logs of automation, such as:
+//
+//	Warning: deprecated flag --old, use --new: since=v0.4.0 removal=v1.0.0
+type DeprecationWarnings struct {
+	w    io.Writer
+	seen map[Deprecation]bool
+}
+
+// NewDeprecationWarnings returns deprecation warnings printed to w.
+func NewDeprecationWarnings(w io.Writer) *DeprecationWarnings {
+	return &DeprecationWarnings{w: w, seen: make(map[Deprecation]bool)}
+}
+
+// Warn prints the warning for a deprecation unless it has already been
+// printed. Fields, such as where the outdated setting was found, are added
+// to the warning as given.
+func (w *DeprecationWarnings) Warn(deprecation Deprecation, fields ...string) {
+	if w.seen[deprecation] {
+		return
+	}
+	w.seen[deprecation] = true
+
+	line := fmt.Sprintf("Warning: deprecated %v %v, use %v: since=%v removal=%v",
+		deprecation.Kind, deprecation.displayName(deprecation.Old), deprecation.displayName(deprecation.New),
+		deprecation.Since, deprecation.Removal)
+	if deprecation.Command != "" {
+		line += fmt.Sprintf(" command=%q", deprecation.Command)
+	}
+	for _, field := range fields {
+		line += " " + field
+	}
+	fmt.Fprintln(w.w, line)
+}
+
+// RewriteDeprecatedFlags replaces deprecated flags in the flags of a single
+// command, args starting just after the command's name, with their current
+// names. Flags are rewritten up to a -- terminator or the first argument, as
+// flags after it are not parsed. takesValue reports whether a flag, by its
+// current name, is followed by a value to skip over. The deprecations used
+// are returned in the order they were found.
+func RewriteDeprecatedFlags(args []string, deprecations []Deprecation, command string, takesValue func(name string) bool) ([]string, []Deprecation) {
+	var rewritten []string
+	var used []Deprecation
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		dashes := "-"
+		if strings.HasPrefix(arg, "--") {
+			dashes = "--"
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, dashes), "=")
+		if deprecation, found := lookupFlag(deprecations, command, name); found {
+			name = deprecation.New
+			used = append(used, deprecation)
+			arg = dashes + name
+			if hasValue {
+				arg += "=" + value
+			}
+		}
+		rewritten = append(rewritten, arg)
+
+		if !hasValue && takesValue(name) && i+1 < len(args) {
+			i++
+			rewritten = append(rewritten, args[i])
+		}
+	}
+	return append(rewritten, args[i:]...), used
+}
+
+// lookupFlag returns the deprecation of a flag of a command.
+func lookupFlag(deprecations []Deprecation, command string, name string) (Deprecation, bool) {
+	for _, deprecation := range deprecations {
+		if deprecation.Kind == DeprecatedFlag && deprecation.Command == command && deprecation.Old == name {
+			return deprecation, true
+		}
+	}
+	return Deprecation{}, false
+}
@@ -0,0 +1,149 @@
+package helper
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// deprecation returns a deprecation from the registry, failing the test if
+// it isn't listed.
+func deprecation(t *testing.T, kind DeprecationKind, old string) Deprecation {
+	t.Helper()
+	d, found := LookupDeprecation(Deprecations, kind, old)
+	if !found {
+		t.Fatalf("no deprecation of %v %v", kind, old)
+	}
+	return d
+}
+
+func TestDeprecationsRegistry(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, d := range Deprecations {
+		id := string(d.Kind) + " " + d.Command + " " + d.Old
+		if seen[id] {
+			t.Errorf("%v is deprecated more than once", id)
+		}
+		seen[id] = true
+		if d.New == "" || d.New == d.Old {
+			t.Errorf("%v %v has no replacement", d.Kind, d.Old)
+		}
+		if !strings.HasPrefix(d.Since, "v") || !strings.HasPrefix(d.Removal, "v") {
+			t.Errorf("%v %v needs since and removal versions such as v1.0.0", d.Kind, d.Old)
+		}
+		if d.Command != "" && d.Kind != DeprecatedFlag {
+			t.Errorf("%v %v is a %v so can't belong to a command", d.Kind, d.Old, d.Kind)
+		}
+	}
+}
+
+func TestDeprecationWarnings(t *testing.T) {
+	flag := Deprecation{Kind: DeprecatedFlag, Old: "car", New: "cloud-access-role", Command: "favorite add", Since: "v0.4.0", Removal: "v1.0.0"}
+	key := deprecation(t, DeprecatedConfigKey, "kion.endpoint")
+
+	var b bytes.Buffer
+	warnings := NewDeprecationWarnings(&b)
+	warnings.Warn(flag)
+	warnings.Warn(key, "file=/home/jane/config.yml", "line=3")
+	warnings.Warn(flag)
+	warnings.Warn(key, "file=/home/jane/config.yml", "line=9")
+
+	want := "Warning: deprecated flag --car, use --cloud-access-role: since=v0.4.0 removal=v1.0.0 command=\"favorite add\"\n" +
+		"Warning: deprecated config key kion.endpoint, use kion.url: since=v0.4.0 removal=v1.0.0 file=/home/jane/config.yml line=3\n"
+	if b.String() != want {
+		t.Errorf("\ngot:\n%v\nwanted:\n%v", b.String(), want)
+	}
+}
+
+func TestRewriteDeprecatedFlags(t *testing.T) {
+	deprecations := []Deprecation{
+		{Kind: DeprecatedFlag, Old: "stak-mode", New: "mode", Command: "stak", Since: "v0.4.0", Removal: "v1.0.0"},
+		{Kind: DeprecatedFlag, Old: "raw", New: "quiet", Command: "stak", Since: "v0.4.0", Removal: "v1.0.0"},
+		{Kind: DeprecatedFlag, Old: "account-num", New: "account", Command: "run", Since: "v0.4.0", Removal: "v1.0.0"},
+	}
+	takesValue := func(name string) bool {
+		return name == "mode" || name == "account" || name == "region"
+	}
+
+	tests := []struct {
+		description string
+		command     string
+		args        []string
+		want        []string
+		wantUsed    []string
+	}{
+		{
+			"No Deprecated Flags",
+			"stak",
+			[]string{"--mode", "export", "prod"},
+			[]string{"--mode", "export", "prod"},
+			nil,
+		},
+		{
+			"Flag With Value",
+			"stak",
+			[]string{"--stak-mode", "export", "prod"},
+			[]string{"--mode", "export", "prod"},
+			[]string{"stak-mode"},
+		},
+		{
+			"Flag With Inline Value",
+			"stak",
+			[]string{"--stak-mode=export"},
+			[]string{"--mode=export"},
+			[]string{"stak-mode"},
+		},
+		{
+			"Single Dash",
+			"stak",
+			[]string{"-raw"},
+			[]string{"-quiet"},
+			[]string{"raw"},
+		},
+		{
+			"Value Looking Like A Flag",
+			"stak",
+			[]string{"--region", "--raw", "--raw"},
+			[]string{"--region", "--raw", "--quiet"},
+			[]string{"raw"},
+		},
+		{
+			"Stops At Terminator",
+			"stak",
+			[]string{"--raw", "--", "--raw"},
+			[]string{"--quiet", "--", "--raw"},
+			[]string{"raw"},
+		},
+		{
+			"Stops At First Argument",
+			"stak",
+			[]string{"prod", "--raw"},
+			[]string{"prod", "--raw"},
+			nil,
+		},
+		{
+			"Other Command",
+			"run",
+			[]string{"--raw", "--account-num", "111122223333"},
+			[]string{"--raw", "--account", "111122223333"},
+			[]string{"account-num"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, used := RewriteDeprecatedFlags(test.args, deprecations, test.command, takesValue)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+			var gotUsed []string
+			for _, d := range used {
+				gotUsed = append(gotUsed, d.Old)
+			}
+			if !reflect.DeepEqual(gotUsed, test.wantUsed) {
+				t.Errorf("\ngot used:\n  %v\nwanted used:\n  %v", gotUsed, test.wantUsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Device                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// deviceIDPattern matches the random UUIDs used as device identifiers.
+var deviceIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// DeviceID returns the identifier of this device stored at path, generating
+// and storing a random one the first time or if the stored one is unreadable.
+// It carries no information about the device itself, it only lets sessions
+// and audit entries from the same machine be correlated.
+func DeviceID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id := strings.TrimSpace(string(data))
+		if deviceIDPattern.MatchString(id) {
+			return id, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	id, err := newDeviceID()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(path, []byte(id+"\n"), 0600)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// newDeviceID returns a random version 4 UUID.
+func newDeviceID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
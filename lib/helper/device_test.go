@@ -0,0 +1,47 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "device-id")
+
+	// generated once and reused after
+	first, err := DeviceID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deviceIDPattern.MatchString(first) {
+		t.Errorf("generated a malformed device id %q", first)
+	}
+	second, err := DeviceID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("got %v after %v, wanted the stored id", second, first)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("stored with mode %v, wanted 0600", info.Mode().Perm())
+	}
+
+	// a damaged id is replaced
+	err = os.WriteFile(path, []byte("garbage"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := DeviceID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced == first || !deviceIDPattern.MatchString(replaced) {
+		t.Errorf("got %q, wanted a new device id", replaced)
+	}
+}
@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Doctor                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Clock skew thresholds, SAML assertions and short-term access keys are only
+// accepted within a few minutes of when they were issued.
+const (
+	clockSkewWarn = 30 * time.Second
+	clockSkewFail = 2 * time.Minute
+)
+
+// DoctorCheck is the result of a diagnostic check, with a hint at how to fix
+// it when it didn't pass.
+type DoctorCheck struct {
+	URLCheck
+	Hint string
+}
+
+// connectivityHints suggest fixes for the connectivity checks that fail.
+var connectivityHints = map[string]string{
+	"url":             "set kion.url to the address you open Kion at, such as https://kion.example.com",
+	"dns":             "check kion.url is spelled right and that you are on the network, or VPN, Kion is reached from",
+	"private address": "connect to your VPN, Kion resolves to its public address from here",
+	"tls":             "set api.ca_bundle to the certificate authority that issued Kion's certificate, or check for a proxy intercepting TLS",
+	"health":          "check api.proxy, api.socks5_proxy, or api.ssh_jump if Kion is only reachable through them, and that Kion is up",
+}
+
+// connectivityWarnHints suggest fixes for the connectivity checks that warn.
+var connectivityWarnHints = map[string]string{
+	"tls": "set kion.url to the https address of Kion",
+}
+
+// DoctorConnectivity turns connectivity checks, see CheckConnectivity, of the
+// Kion URL into doctor checks named with prefix.
+func DoctorConnectivity(prefix string, checks []URLCheck) []DoctorCheck {
+	var doctor []DoctorCheck
+	for _, check := range checks {
+		hint := ""
+		switch check.Status {
+		case CheckFail:
+			hint = connectivityHints[check.Name]
+		case CheckWarn:
+			hint = connectivityWarnHints[check.Name]
+		}
+		check.Name = prefix + " " + check.Name
+		doctor = append(doctor, DoctorCheck{URLCheck: check, Hint: hint})
+	}
+	return doctor
+}
+
+// DoctorConfig turns the checks of the configuration file at path, see
+// ValidateConfig, into doctor checks, passing ones summed up in one.
+func DoctorConfig(path string, checks []URLCheck) []DoctorCheck {
+	var doctor []DoctorCheck
+	for _, check := range checks {
+		if check.Status == CheckOK || check.Status == CheckSkip {
+			continue
+		}
+		check.Name = "config " + check.Name
+		doctor = append(doctor, DoctorCheck{URLCheck: check, Hint: "fix it in " + path + " or with kion config set, kion config validate explains each setting"})
+	}
+	if len(doctor) == 0 {
+		doctor = append(doctor, DoctorCheck{URLCheck: URLCheck{Name: "config", Status: CheckOK, Detail: path + " is valid"}})
+	}
+	return doctor
+}
+
+// DoctorClock checks the skew between the clock here and a server's, name
+// naming it, see kion.ClockSkew.
+func DoctorClock(name string, skew time.Duration, err error) DoctorCheck {
+	check := DoctorCheck{URLCheck: URLCheck{Name: name + " clock"}}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
+	}
+	switch {
+	case err != nil:
+		check.Status, check.Detail = CheckSkip, fmt.Sprintf("unable to compare: %v", err)
+		return check
+	case abs < clockSkewWarn:
+		check.Status, check.Detail = CheckOK, fmt.Sprintf("within %v of %v", clockSkewWarn, name)
+		return check
+	case abs < clockSkewFail:
+		check.Status = CheckWarn
+	default:
+		check.Status = CheckFail
+	}
+	check.Detail = fmt.Sprintf("this clock is %v %v %v", abs, direction, name)
+	check.Hint = "sync this machine's clock, such as by turning on network time, SAML responses are rejected when clocks disagree by more than a few minutes"
+	return check
+}
+
+// FailedDoctorChecks returns the number of checks that failed.
+func FailedDoctorChecks(checks []DoctorCheck) int {
+	failed := 0
+	for _, check := range checks {
+		if check.Status == CheckFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// PrintDoctorChecks writes the results of doctor checks as a table, followed
+// by the hints for those that didn't pass.
+func PrintDoctorChecks(w io.Writer, checks []DoctorCheck) error {
+	table := NewTable("CHECK", "STATUS", "DETAIL")
+	var hints []DoctorCheck
+	for _, check := range checks {
+		table.AddRow(check.Name, check.Status, check.Detail)
+		if check.Hint != "" && (check.Status == CheckFail || check.Status == CheckWarn) {
+			hints = append(hints, check)
+		}
+	}
+	err := table.Write(w)
+	if err != nil {
+		return err
+	}
+	if len(hints) == 0 {
+		return nil
+	}
+	_, err = fmt.Fprintln(w, "\nTo fix:")
+	if err != nil {
+		return err
+	}
+	for _, check := range hints {
+		_, err = fmt.Fprintf(w, "  %v: %v\n", check.Name, check.Hint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
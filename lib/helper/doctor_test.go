@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctorClock(t *testing.T) {
+	tests := []struct {
+		description string
+		skew        time.Duration
+		err         error
+		wantStatus  string
+		wantDetail  string
+	}{
+		{"In Sync", 2 * time.Second, nil, CheckOK, "within 30s of Kion"},
+		{"Slightly Behind", 45 * time.Second, nil, CheckWarn, "this clock is 45s behind Kion"},
+		{"Far Ahead", -10 * time.Minute, nil, CheckFail, "this clock is 10m0s ahead of Kion"},
+		{"Unreachable", 0, errors.New("connection refused"), CheckSkip, "unable to compare: connection refused"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			check := DoctorClock("Kion", test.skew, test.err)
+			if check.Status != test.wantStatus || check.Detail != test.wantDetail {
+				t.Errorf("got %v %q, wanted %v %q", check.Status, check.Detail, test.wantStatus, test.wantDetail)
+			}
+			if (check.Hint != "") != (test.wantStatus == CheckWarn || test.wantStatus == CheckFail) {
+				t.Errorf("got hint %q for %v", check.Hint, check.Status)
+			}
+		})
+	}
+}
+
+func TestDoctorConfig(t *testing.T) {
+	tests := []struct {
+		description string
+		checks      []URLCheck
+		wantNames   []string
+	}{
+		{"Valid", []URLCheck{{Name: "syntax", Status: CheckOK}, {Name: "profiles", Status: CheckSkip}}, []string{"config"}},
+		{"Invalid", []URLCheck{{Name: "syntax", Status: CheckOK}, {Name: "kion", Status: CheckFail}, {Name: "outdated", Status: CheckWarn}}, []string{"config kion", "config outdated"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var names []string
+			for _, check := range DoctorConfig("config.yml", test.checks) {
+				names = append(names, check.Name)
+				if check.Status != CheckOK && !strings.Contains(check.Hint, "config.yml") {
+					t.Errorf("got hint %q for %v", check.Hint, check.Name)
+				}
+			}
+			if strings.Join(names, ",") != strings.Join(test.wantNames, ",") {
+				t.Errorf("got %v, wanted %v", names, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestPrintDoctorChecks(t *testing.T) {
+	checks := DoctorConnectivity("kion", []URLCheck{
+		{Name: "dns", Status: CheckOK, Detail: "resolves"},
+		{Name: "tls", Status: CheckWarn, Detail: "not in use"},
+		{Name: "health", Status: CheckFail, Detail: "unreachable"},
+	})
+	if FailedDoctorChecks(checks) != 1 {
+		t.Errorf("got %v failed checks, wanted 1", FailedDoctorChecks(checks))
+	}
+
+	var out bytes.Buffer
+	err := PrintDoctorChecks(&out, checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"kion dns", "kion health  fail", "To fix:", "  kion tls: " + connectivityWarnHints["tls"], "  kion health: " + connectivityHints["health"]} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got %q, wanted it to contain %q", out.String(), want)
+		}
+	}
+	if strings.Contains(out.String(), "kion dns:") {
+		t.Errorf("got a hint for a passing check in %q", out.String())
+	}
+}
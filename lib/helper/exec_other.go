@@ -0,0 +1,37 @@
+//go:build !unix
+
+package helper
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// execCommand runs the command as a child where processes can't be replaced,
+// passing interrupts to it rather than exiting and exiting with its exit code
+// once it finishes.
+func execCommand(binary string, argv []string, env []string) error {
+	cmd := exec.Command(binary, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// the console delivers interrupts to the command as well, so wait for it
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
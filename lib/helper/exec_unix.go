@@ -0,0 +1,11 @@
+//go:build unix
+
+package helper
+
+import "syscall"
+
+// execCommand replaces Kion CLI with the command, so its exit code and any
+// signals sent to it are the command's own.
+func execCommand(binary string, argv []string, env []string) error {
+	return syscall.Exec(binary, argv, env)
+}
@@ -0,0 +1,360 @@
+package helper
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Favorites                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FavoriteIssue describes a favorite that no longer maps to an account and
+// cloud access role the user can use.
+type FavoriteIssue struct {
+	Favorite structs.Favorite
+	Problem  string
+	// Suggestions are cloud access role names available on the favorite's
+	// account, most likely replacements first.
+	Suggestions []string
+}
+
+// CheckFavorites compares favorites against the cloud access roles available
+// to the user and returns an issue for each favorite that can't be used.
+func CheckFavorites(favs []structs.Favorite, cars []kion.CAR) []FavoriteIssue {
+	var issues []FavoriteIssue
+	for _, fav := range favs {
+		// gather the cars available on the favorite's account
+		var onAccount []kion.CAR
+		var match *kion.CAR
+		for i, car := range cars {
+			if !MatchesAccount(car, fav.Account, fav.AccountAlias) {
+				continue
+			}
+			onAccount = append(onAccount, car)
+			if car.Name == fav.CAR {
+				match = &cars[i]
+			}
+		}
+
+		switch {
+		case len(onAccount) == 0:
+			issues = append(issues, FavoriteIssue{
+				Favorite: fav,
+				Problem:  fmt.Sprintf("account %v was not found or you no longer have access to it", describeAccount(fav)),
+			})
+		case fav.CAR == "":
+			// the cloud access role is chosen when the favorite is used
+		case match == nil:
+			issues = append(issues, FavoriteIssue{
+				Favorite:    fav,
+				Problem:     fmt.Sprintf("cloud access role %q was renamed, deleted, or removed from account %v", fav.CAR, describeAccount(fav)),
+				Suggestions: suggestCARs(fav.CAR, onAccount),
+			})
+		case fav.AccessType == "web" && !match.WebAccess:
+			issues = append(issues, FavoriteIssue{
+				Favorite:    fav,
+				Problem:     fmt.Sprintf("cloud access role %q does not permit web console access", fav.CAR),
+				Suggestions: suggestCARs(fav.CAR, onAccount),
+			})
+		case fav.AccessType != "web" && !match.ShortTermAccessKeys:
+			issues = append(issues, FavoriteIssue{
+				Favorite:    fav,
+				Problem:     fmt.Sprintf("cloud access role %q does not permit short-term access keys", fav.CAR),
+				Suggestions: suggestCARs(fav.CAR, onAccount),
+			})
+		}
+	}
+
+	return issues
+}
+
+// GenerateFavorites builds a favorite for each account where the named cloud
+// access role permits the given access type. Names are built from the prefix
+// and account name, made unique against existing favorites, and accounts
+// already covered by an equivalent favorite are skipped.
+func GenerateFavorites(cars []kion.CAR, carName string, accessType string, region string, prefix string, existing []structs.Favorite) []structs.Favorite {
+	names := make(map[string]bool)
+	for _, fav := range existing {
+		names[fav.Name] = true
+	}
+
+	var generated []structs.Favorite
+	for _, car := range cars {
+		if car.Name != carName {
+			continue
+		}
+		if accessType == "web" && !car.WebAccess || accessType != "web" && !car.ShortTermAccessKeys {
+			continue
+		}
+		covers := func(fav structs.Favorite) bool {
+			return fav.Account == car.AccountNumber && fav.CAR == car.Name && (fav.AccessType == "web") == (accessType == "web")
+		}
+		if slices.ContainsFunc(existing, covers) || slices.ContainsFunc(generated, covers) {
+			continue
+		}
+
+		name := FavoriteName(prefix, car.AccountName, car.AccountNumber)
+		if names[name] {
+			name = fmt.Sprintf("%v-%v", name, car.AccountNumber)
+		}
+		names[name] = true
+
+		generated = append(generated, structs.Favorite{
+			Name:       name,
+			Account:    car.AccountNumber,
+			CAR:        car.Name,
+			AccessType: accessType,
+			Region:     region,
+		})
+	}
+	sort.Slice(generated, func(i, j int) bool {
+		return generated[i].Name < generated[j].Name
+	})
+
+	return generated
+}
+
+// FavoriteName builds a lowercase, dash separated favorite name from a prefix
+// and account name, falling back to the account number if the account has no
+// name.
+func FavoriteName(prefix string, accountName string, accountNumber string) string {
+	base := accountName
+	if base == "" {
+		base = accountNumber
+	}
+	if prefix != "" {
+		base = prefix + "-" + base
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(base) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// FavoriteCloud returns the cloud provider of a favorite's account, as
+// configured or else inferred from its account number. An empty string is
+// returned for favorites matching accounts with globs or by alias alone.
+func FavoriteCloud(fav structs.Favorite) string {
+	if fav.Cloud != "" {
+		return fav.Cloud
+	}
+	if IsGlob(fav.Account) {
+		return ""
+	}
+	return kion.CloudForAccountNumber(fav.Account)
+}
+
+// FilterFavoritesByCloud returns the favorites on accounts in the given cloud,
+// or all favorites if cloud is empty. Favorites whose cloud is unknown are
+// kept.
+func FilterFavoritesByCloud(favs []structs.Favorite, cloud string) []structs.Favorite {
+	if cloud == "" {
+		return favs
+	}
+	var filtered []structs.Favorite
+	for _, fav := range favs {
+		if c := FavoriteCloud(fav); c == "" || c == cloud {
+			filtered = append(filtered, fav)
+		}
+	}
+	return filtered
+}
+
+// IsGlob reports whether a pattern contains glob metacharacters.
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// IsDynamicFavorite reports whether a favorite's account is resolved at
+// runtime, either from a glob or an account alias, rather than named outright.
+func IsDynamicFavorite(fav structs.Favorite) bool {
+	return IsGlob(fav.Account) || fav.AccountAlias != ""
+}
+
+// MatchesAccount reports whether a cloud access role's account matches the
+// given account number and account alias patterns. Patterns use shell glob
+// syntax and an empty pattern matches any account, though at least one must
+// be given. Malformed patterns only match exactly.
+func MatchesAccount(car kion.CAR, account string, alias string) bool {
+	if account == "" && alias == "" {
+		return false
+	}
+	return matchPattern(account, car.AccountNumber) && matchPattern(alias, car.AccountName)
+}
+
+// matchPattern reports whether value matches a glob pattern.
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	if err != nil {
+		return pattern == value
+	}
+	return matched
+}
+
+// describeAccount returns how a favorite refers to its account.
+func describeAccount(fav structs.Favorite) string {
+	switch {
+	case fav.AccountAlias != "" && fav.Account != "":
+		return fmt.Sprintf("%v (%v)", fav.AccountAlias, fav.Account)
+	case fav.AccountAlias != "":
+		return fav.AccountAlias
+	default:
+		return fav.Account
+	}
+}
+
+// suggestCARs returns the unique names of the given cars, excluding the
+// current name, with case-insensitive or partial matches sorted first as
+// those are most likely renames.
+func suggestCARs(current string, cars []kion.CAR) []string {
+	seen := make(map[string]bool)
+	var likely []string
+	var others []string
+	for _, car := range cars {
+		if car.Name == current || seen[car.Name] {
+			continue
+		}
+		seen[car.Name] = true
+		lower := strings.ToLower(car.Name)
+		target := strings.ToLower(current)
+		if lower == target || strings.Contains(lower, target) || strings.Contains(target, lower) {
+			likely = append(likely, car.Name)
+		} else {
+			others = append(others, car.Name)
+		}
+	}
+	sort.Strings(likely)
+	sort.Strings(others)
+
+	return append(likely, others...)
+}
+
+// AddFavorite returns favs with fav appended, or an error if it has no name,
+// its name is taken, or it names neither an account nor an account alias.
+func AddFavorite(favs []structs.Favorite, fav structs.Favorite) ([]structs.Favorite, error) {
+	if fav.Name == "" {
+		return nil, fmt.Errorf("a favorite needs a name")
+	}
+	if slices.ContainsFunc(favs, func(f structs.Favorite) bool { return f.Name == fav.Name }) {
+		return nil, fmt.Errorf("favorite %v already exists", fav.Name)
+	}
+	if fav.Account == "" && fav.AccountAlias == "" {
+		return nil, fmt.Errorf("favorite %v needs an account or account alias", fav.Name)
+	}
+	return append(slices.Clone(favs), fav), nil
+}
+
+// RemoveFavorites returns favs without the named favorites, or an error
+// naming any that aren't configured.
+func RemoveFavorites(favs []structs.Favorite, names []string) ([]structs.Favorite, error) {
+	var missing []string
+	for _, name := range names {
+		if !slices.ContainsFunc(favs, func(f structs.Favorite) bool { return f.Name == name }) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("favorite not found: %v", strings.Join(missing, ", "))
+	}
+	return slices.DeleteFunc(slices.Clone(favs), func(f structs.Favorite) bool {
+		return slices.Contains(names, f.Name)
+	}), nil
+}
+
+// FavoriteWorkspaces returns the names of the workspaces listing a favorite,
+// sorted.
+func FavoriteWorkspaces(workspaces map[string][]string, name string) []string {
+	var listed []string
+	for workspace, names := range workspaces {
+		if slices.Contains(names, name) {
+			listed = append(listed, workspace)
+		}
+	}
+	sort.Strings(listed)
+	return listed
+}
+
+// FavoriteParameters are the parameters a favorite can be given when used,
+// see structs.Favorite.Parameters.
+var FavoriteParameters = []string{"region", "duration", "service"}
+
+// favoriteParametersFor returns the parameters that apply to favorites with
+// an access type: the region and how long keys must stay valid for cli
+// access, and the service console opened for web access.
+func favoriteParametersFor(accessType string) []string {
+	if accessType == kion.AccessLevelWeb {
+		return []string{"service"}
+	}
+	return []string{"region", "duration"}
+}
+
+// FavoriteParameterValues returns the values of a favorite's parameters:
+// those passed as flags, else for the parameters the favorite declares the
+// answer to prompt, else the favorite's own region. prompt is given the name
+// of the parameter and its default, and is nil when prompting isn't possible.
+// Parameters without a value are left out, and passing one that doesn't
+// apply to the favorite's access type is an error.
+func FavoriteParameterValues(favorite structs.Favorite, passed map[string]string, prompt func(name string, value string) (string, error)) (map[string]string, error) {
+	for _, name := range favorite.Parameters {
+		if !slices.Contains(FavoriteParameters, name) {
+			return nil, fmt.Errorf("favorite %v has unknown parameter %q, expected one of %v", favorite.Name, name, strings.Join(FavoriteParameters, ", "))
+		}
+	}
+	applicable := favoriteParametersFor(favorite.AccessType)
+	for _, name := range FavoriteParameters {
+		if passed[name] != "" && !slices.Contains(applicable, name) {
+			level := kion.AccessLevelCLI
+			if favorite.AccessType == kion.AccessLevelWeb {
+				level = kion.AccessLevelWeb
+			}
+			return nil, fmt.Errorf("--%v doesn't apply to favorite %v, it uses %v access", name, favorite.Name, level)
+		}
+	}
+
+	values := make(map[string]string)
+	for _, name := range applicable {
+		value := passed[name]
+		defaultValue := ""
+		if name == "region" {
+			defaultValue = favorite.Region
+		}
+		if value == "" && prompt != nil && slices.Contains(favorite.Parameters, name) {
+			var err error
+			value, err = prompt(name, defaultValue)
+			if err != nil {
+				return nil, err
+			}
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			value = defaultValue
+		}
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,413 @@
+package helper
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestCheckFavorites(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Admin", AccountNumber: "111111111111", ShortTermAccessKeys: true, WebAccess: true},
+		{Name: "ReadOnly", AccountNumber: "111111111111", ShortTermAccessKeys: true, WebAccess: false},
+		{Name: "Developer", AccountNumber: "111111111111", ShortTermAccessKeys: false, WebAccess: true},
+		{Name: "Admin", AccountNumber: "222222222222", AccountName: "payments-east-prod", ShortTermAccessKeys: true},
+	}
+
+	tests := []struct {
+		description     string
+		fav             structs.Favorite
+		wantIssue       bool
+		wantSuggestions []string
+	}{
+		{
+			"Valid",
+			structs.Favorite{Name: "valid", Account: "111111111111", CAR: "Admin"},
+			false,
+			nil,
+		},
+		{
+			"No Role Given",
+			structs.Favorite{Name: "any", Account: "111111111111"},
+			false,
+			nil,
+		},
+		{
+			"Alias Glob",
+			structs.Favorite{Name: "payments", AccountAlias: "payments-*-prod", CAR: "Admin"},
+			false,
+			nil,
+		},
+		{
+			"Alias Glob No Match",
+			structs.Favorite{Name: "payments", AccountAlias: "payments-*-dev", CAR: "Admin"},
+			true,
+			nil,
+		},
+		{
+			"Missing Account",
+			structs.Favorite{Name: "gone", Account: "999999999999", CAR: "Admin"},
+			true,
+			nil,
+		},
+		{
+			"Renamed Role",
+			structs.Favorite{Name: "renamed", Account: "111111111111", CAR: "admin"},
+			true,
+			[]string{"Admin", "Developer", "ReadOnly"},
+		},
+		{
+			"No Web Access",
+			structs.Favorite{Name: "web", Account: "111111111111", CAR: "ReadOnly", AccessType: "web"},
+			true,
+			[]string{"Admin", "Developer"},
+		},
+		{
+			"No STAK Access",
+			structs.Favorite{Name: "cli", Account: "111111111111", CAR: "Developer"},
+			true,
+			[]string{"Admin", "ReadOnly"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			issues := CheckFavorites([]structs.Favorite{test.fav}, cars)
+			if (len(issues) > 0) != test.wantIssue {
+				t.Fatalf("got issues %v, wanted issue: %v", issues, test.wantIssue)
+			}
+			if test.wantIssue && !reflect.DeepEqual(issues[0].Suggestions, test.wantSuggestions) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", issues[0].Suggestions, test.wantSuggestions)
+			}
+		})
+	}
+}
+
+func TestMatchesAccount(t *testing.T) {
+	car := kion.CAR{AccountNumber: "111122223333", AccountName: "payments-east-prod"}
+
+	tests := []struct {
+		description string
+		account     string
+		alias       string
+		want        bool
+	}{
+		{
+			"Exact Account",
+			"111122223333",
+			"",
+			true,
+		},
+		{
+			"Account Glob",
+			"1111*",
+			"",
+			true,
+		},
+		{
+			"Alias Glob",
+			"",
+			"payments-*-prod",
+			true,
+		},
+		{
+			"Alias Mismatch",
+			"",
+			"payments-*-dev",
+			false,
+		},
+		{
+			"Both Must Match",
+			"9999*",
+			"payments-*-prod",
+			false,
+		},
+		{
+			"No Patterns",
+			"",
+			"",
+			false,
+		},
+		{
+			"Malformed Pattern",
+			"[1111",
+			"",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := MatchesAccount(car, test.account, test.alias); got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateFavorites(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Engineer", AccountName: "Data Lake (Prod)", AccountNumber: "111111111111", ShortTermAccessKeys: true, WebAccess: true},
+		{Name: "Engineer", AccountName: "Data Lake Prod", AccountNumber: "222222222222", ShortTermAccessKeys: true},
+		{Name: "Engineer", AccountName: "Sandbox", AccountNumber: "333333333333", ShortTermAccessKeys: true},
+		{Name: "Admin", AccountName: "Analytics", AccountNumber: "444444444444", ShortTermAccessKeys: true},
+	}
+	existing := []structs.Favorite{
+		{Name: "sandbox", Account: "333333333333", CAR: "Engineer"},
+	}
+
+	tests := []struct {
+		description string
+		accessType  string
+		prefix      string
+		want        []structs.Favorite
+	}{
+		{
+			"CLI Access",
+			"",
+			"",
+			[]structs.Favorite{
+				{Name: "data-lake-prod", Account: "111111111111", CAR: "Engineer"},
+				{Name: "data-lake-prod-222222222222", Account: "222222222222", CAR: "Engineer"},
+			},
+		},
+		{
+			"Web Access With Prefix",
+			"web",
+			"DP",
+			[]structs.Favorite{
+				{Name: "dp-data-lake-prod", Account: "111111111111", CAR: "Engineer", AccessType: "web"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := GenerateFavorites(cars, "Engineer", test.accessType, "", test.prefix, existing)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterFavoritesByCloud(t *testing.T) {
+	favorites := []structs.Favorite{
+		{Name: "aws", Account: "111111111111"},
+		{Name: "azure", Account: "3f2504e0-4f89-11d3-9a0c-0305e82c3301"},
+		{Name: "gcp", Account: "my-project", Cloud: "gcp"},
+		{Name: "glob", Account: "1111*"},
+	}
+
+	tests := []struct {
+		description string
+		cloud       string
+		want        []string
+	}{
+		{"All", "", []string{"aws", "azure", "gcp", "glob"}},
+		{"AWS", kion.CloudAWS, []string{"aws", "glob"}},
+		{"Azure", kion.CloudAzure, []string{"azure", "glob"}},
+		{"GCP", kion.CloudGCP, []string{"gcp", "glob"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got []string
+			for _, fav := range FilterFavoritesByCloud(favorites, test.cloud) {
+				got = append(got, fav.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddFavorite(t *testing.T) {
+	existing := []structs.Favorite{
+		{Name: "sandbox", Account: "111111111111", CAR: "Admin"},
+	}
+
+	tests := []struct {
+		description string
+		favorite    structs.Favorite
+		wantErr     bool
+	}{
+		{"Added", structs.Favorite{Name: "prod-admin", Account: "222222222222", CAR: "Admin"}, false},
+		{"Alias Only", structs.Favorite{Name: "payments", AccountAlias: "payments-*"}, false},
+		{"Taken Name", structs.Favorite{Name: "sandbox", Account: "222222222222"}, true},
+		{"No Name", structs.Favorite{Account: "222222222222"}, true},
+		{"No Account", structs.Favorite{Name: "prod-admin", CAR: "Admin"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := AddFavorite(existing, test.favorite)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if err == nil && (len(got) != 2 || !reflect.DeepEqual(got[1], test.favorite)) {
+				t.Errorf("got %+v, wanted the favorite appended", got)
+			}
+			if len(existing) != 1 {
+				t.Error("existing favorites were modified")
+			}
+		})
+	}
+}
+
+func TestRemoveFavorites(t *testing.T) {
+	existing := []structs.Favorite{
+		{Name: "sandbox", Account: "111111111111"},
+		{Name: "prod", Account: "222222222222"},
+		{Name: "dev", Account: "333333333333"},
+	}
+
+	got, err := RemoveFavorites(existing, []string{"sandbox", "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "prod" {
+		t.Errorf("got %+v, wanted only prod left", got)
+	}
+	if len(existing) != 3 || existing[0].Name != "sandbox" {
+		t.Error("existing favorites were modified")
+	}
+
+	_, err = RemoveFavorites(existing, []string{"prod", "missing"})
+	if err == nil {
+		t.Error("got no error removing a favorite that isn't configured")
+	}
+}
+
+func TestFavoriteWorkspaces(t *testing.T) {
+	workspaces := map[string][]string{
+		"payments": {"prod", "dev"},
+		"data":     {"dev"},
+		"ops":      {"prod"},
+	}
+	got := FavoriteWorkspaces(workspaces, "dev")
+	if !reflect.DeepEqual(got, []string{"data", "payments"}) {
+		t.Errorf("got %v, wanted [data payments]", got)
+	}
+}
+
+func TestFavoriteParameterValues(t *testing.T) {
+	answers := func(answers map[string]string) func(string, string) (string, error) {
+		return func(name string, value string) (string, error) {
+			return answers[name], nil
+		}
+	}
+
+	tests := []struct {
+		description string
+		favorite    structs.Favorite
+		passed      map[string]string
+		prompt      func(string, string) (string, error)
+		want        map[string]string
+		wantErr     string
+	}{
+		{
+			"No Parameters",
+			structs.Favorite{Name: "prod", Region: "us-east-1"},
+			nil,
+			answers(map[string]string{"region": "eu-west-1"}),
+			map[string]string{"region": "us-east-1"},
+			"",
+		},
+		{
+			"Passed",
+			structs.Favorite{Name: "prod", Region: "us-east-1"},
+			map[string]string{"region": "us-west-2", "duration": "2h"},
+			nil,
+			map[string]string{"region": "us-west-2", "duration": "2h"},
+			"",
+		},
+		{
+			"Prompted",
+			structs.Favorite{Name: "prod", Parameters: []string{"region", "duration"}},
+			nil,
+			answers(map[string]string{"region": " eu-west-1 ", "duration": "1h"}),
+			map[string]string{"region": "eu-west-1", "duration": "1h"},
+			"",
+		},
+		{
+			"Passed Skips Prompt",
+			structs.Favorite{Name: "prod", Parameters: []string{"region"}},
+			map[string]string{"region": "us-west-2"},
+			func(string, string) (string, error) { return "", errors.New("prompted") },
+			map[string]string{"region": "us-west-2"},
+			"",
+		},
+		{
+			"Empty Answer Defaults To Region",
+			structs.Favorite{Name: "prod", Region: "us-east-1", Parameters: []string{"region"}},
+			nil,
+			answers(nil),
+			map[string]string{"region": "us-east-1"},
+			"",
+		},
+		{
+			"Not Interactive",
+			structs.Favorite{Name: "prod", Region: "us-east-1", Parameters: []string{"region", "duration"}},
+			nil,
+			nil,
+			map[string]string{"region": "us-east-1"},
+			"",
+		},
+		{
+			"Web Service",
+			structs.Favorite{Name: "console", AccessType: "web", Region: "us-east-1", Parameters: []string{"region", "service"}},
+			nil,
+			answers(map[string]string{"region": "eu-west-1", "service": "ec2"}),
+			map[string]string{"service": "ec2"},
+			"",
+		},
+		{
+			"Unknown Parameter",
+			structs.Favorite{Name: "prod", Parameters: []string{"zone"}},
+			nil,
+			nil,
+			nil,
+			`unknown parameter "zone"`,
+		},
+		{
+			"Service On CLI Favorite",
+			structs.Favorite{Name: "prod"},
+			map[string]string{"service": "ec2"},
+			nil,
+			nil,
+			"--service doesn't apply to favorite prod, it uses cli access",
+		},
+		{
+			"Duration On Web Favorite",
+			structs.Favorite{Name: "console", AccessType: "web"},
+			map[string]string{"duration": "2h"},
+			nil,
+			nil,
+			"--duration doesn't apply to favorite console, it uses web access",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := FavoriteParameterValues(test.favorite, test.passed, test.prompt)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, wanted one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
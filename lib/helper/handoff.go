@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Hand-off                                                                  //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// HandoffScheme encrypts credentials to be handed to another person, such as
+// by pasting them into a ticket during break-glass work, and decrypts those
+// handed over on the receiving side.
+type HandoffScheme interface {
+	// Name names the scheme in messages.
+	Name() string
+	// Accepts reports whether recipient is written the way the scheme's
+	// recipients are.
+	Accepts(recipient string) bool
+	// Encrypted reports whether data looks to be encrypted with the scheme.
+	Encrypted(data []byte) bool
+	// Encrypt encrypts plaintext to the recipients as text safe to paste.
+	Encrypt(recipients []string, plaintext []byte) ([]byte, error)
+	// Decrypt decrypts data with the identity file named, which schemes
+	// keeping their own keys may ignore.
+	Decrypt(data []byte, identity string) ([]byte, error)
+}
+
+// HandoffSchemes are the schemes credentials can be handed off with, tried in
+// order.
+var HandoffSchemes = []HandoffScheme{ageScheme{}, pgpScheme{}}
+
+// EncryptHandoff encrypts plaintext to the recipients, which must all be of
+// one scheme.
+func EncryptHandoff(recipients []string, plaintext []byte) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients given to encrypt to")
+	}
+	var scheme HandoffScheme
+	for _, recipient := range recipients {
+		s, err := handoffSchemeFor(recipient)
+		if err != nil {
+			return nil, err
+		}
+		if scheme != nil && s.Name() != scheme.Name() {
+			return nil, fmt.Errorf("recipients must all be %v or all be %v, not a mix", scheme.Name(), s.Name())
+		}
+		scheme = s
+	}
+	return scheme.Encrypt(recipients, plaintext)
+}
+
+// DecryptHandoff decrypts credentials handed off with any of the schemes.
+func DecryptHandoff(data []byte, identity string) ([]byte, error) {
+	for _, scheme := range HandoffSchemes {
+		if scheme.Encrypted(data) {
+			return scheme.Decrypt(data, identity)
+		}
+	}
+	return nil, errors.New("not encrypted with age or PGP, create it with kion stak --encrypt-to")
+}
+
+// handoffSchemeFor returns the scheme a recipient belongs to.
+func handoffSchemeFor(recipient string) (HandoffScheme, error) {
+	for _, scheme := range HandoffSchemes {
+		if scheme.Accepts(recipient) {
+			return scheme, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported recipient %q, expected an age recipient (age1...) or a PGP key ID, fingerprint, or email", recipient)
+}
+
+// pgpKeyID matches PGP key IDs and fingerprints.
+var pgpKeyID = regexp.MustCompile(`^(0x)?([0-9A-Fa-f]{8}|[0-9A-Fa-f]{16}|[0-9A-Fa-f]{40})$`)
+
+// pgpArmorBegin starts armored PGP messages.
+const pgpArmorBegin = "-----BEGIN PGP MESSAGE-----"
+
+// pgpScheme hands off credentials encrypted to PGP keys with gpg, which keeps
+// the keys and asks for passphrases itself.
+type pgpScheme struct{}
+
+func (pgpScheme) Name() string { return "PGP" }
+
+func (pgpScheme) Accepts(recipient string) bool {
+	return pgpKeyID.MatchString(recipient) || strings.Contains(recipient, "@")
+}
+
+func (pgpScheme) Encrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(pgpArmorBegin))
+}
+
+func (pgpScheme) Encrypt(recipients []string, plaintext []byte) ([]byte, error) {
+	args := []string{"--batch", "--armor", "--encrypt"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	return runGPG(args, plaintext)
+}
+
+func (pgpScheme) Decrypt(data []byte, _ string) ([]byte, error) {
+	return runGPG([]string{"--decrypt", "--quiet"}, data)
+}
+
+// runGPG runs gpg with input on stdin, returning its output. Its messages
+// and passphrase prompts go to the terminal.
+func runGPG(args []string, input []byte) ([]byte, error) {
+	path, err := exec.LookPath("gpg")
+	if err != nil {
+		return nil, errors.New("PGP requires gpg, install it or use an age recipient")
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("gpg failed: %w", err)
+	}
+	return out.Bytes(), nil
+}
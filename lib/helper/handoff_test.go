@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func TestAgeHandoff(t *testing.T) {
+	dir := t.TempDir()
+	identity, recipient, err := NewAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(identity, "AGE-SECRET-KEY-1") || !strings.HasPrefix(recipient, "age1") {
+		t.Fatalf("got identity %v and recipient %v", identity, recipient)
+	}
+	other, otherRecipient, err := NewAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "identity.txt")
+	otherFile := filepath.Join(dir, "other.txt")
+	err = os.WriteFile(identityFile, []byte("# created: today\n# public key: "+recipient+"\n"+identity+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(otherFile, []byte(other+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		plaintext   []byte
+		recipients  []string
+		identity    string
+		wantErr     string
+	}{
+		{"Exports", []byte("export AWS_ACCESS_KEY_ID=AKIA\n"), []string{recipient}, identityFile, ""},
+		{"Empty", []byte{}, []string{recipient}, identityFile, ""},
+		{"Exactly One Chunk", bytes.Repeat([]byte("a"), ageChunkSize), []string{recipient}, identityFile, ""},
+		{"Several Chunks", bytes.Repeat([]byte("b"), ageChunkSize*2+10), []string{recipient}, identityFile, ""},
+		{"Several Recipients", []byte("keys"), []string{otherRecipient, recipient}, identityFile, ""},
+		{"Other Identity", []byte("keys"), []string{recipient}, otherFile, "not encrypted to any of the given identities"},
+		{"No Identity", []byte("keys"), []string{recipient}, "", "an age identity file is required"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			sealed, err := EncryptHandoff(test.recipients, test.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(sealed, []byte(armor.Header+"\n")) || bytes.Contains(sealed, test.plaintext) && len(test.plaintext) > 0 {
+				t.Fatalf("got %q, wanted armored ciphertext", sealed)
+			}
+			opened, err := DecryptHandoff(sealed, test.identity)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, wanted %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened, test.plaintext) {
+				t.Errorf("got %d bytes back, wanted %d", len(opened), len(test.plaintext))
+			}
+		})
+	}
+}
+
+func TestAgeTampering(t *testing.T) {
+	identity, recipient, err := NewAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseAgeIdentities(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseAgeRecipient(recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ageEncrypt([]age.Recipient{key}, []byte("export AWS_ACCESS_KEY_ID=AKIA\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := bytes.Index(sealed, []byte("\n---")) + 1
+
+	tests := []struct {
+		description string
+		tamper      func([]byte) []byte
+		wantErr     string
+	}{
+		{"Intact", func(b []byte) []byte { return b }, ""},
+		{"Share Altered", func(b []byte) []byte {
+			i := len(ageIntro + "\n-> X25519 ")
+			if b[i] == 'A' {
+				b[i] = 'B'
+			} else {
+				b[i] = 'A'
+			}
+			return b
+		}, "not encrypted to any of the given identities"},
+		{"Extra Stanza", func(b []byte) []byte {
+			return append(append(append([]byte{}, b[:headerEnd]...), "-> other\n\n"...), b[headerEnd:]...)
+		}, "the age header has been altered"},
+		{"Payload Altered", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, "the age payload has been altered or truncated"},
+		{"Payload Truncated", func(b []byte) []byte { return b[:len(b)-1] }, "the age payload has been altered or truncated"},
+		{"Not Age", func(b []byte) []byte { return []byte("hello") }, "not age encrypted"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := ageDecrypt(keys, test.tamper(bytes.Clone(sealed)))
+			if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got error %v, wanted %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptHandoffRecipients(t *testing.T) {
+	_, recipient, err := NewAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		recipients  []string
+		wantErr     string
+	}{
+		{"None", nil, "no recipients given"},
+		{"Unsupported", []string{"ssh-ed25519 AAAA"}, "unsupported recipient"},
+		{"Mixed", []string{recipient, "alice@example.com"}, "not a mix"},
+		{"Invalid Age", []string{"age1notarecipient"}, "invalid age recipient"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := EncryptHandoff(test.recipients, []byte("keys"))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, wanted %q", err, test.wantErr)
+			}
+		})
+	}
+
+	schemes := []struct {
+		description string
+		recipient   string
+		wantScheme  string
+	}{
+		{"Age", recipient, "age"},
+		{"Email", "alice@example.com", "PGP"},
+		{"Key ID", "0xDEADBEEFDEADBEEF", "PGP"},
+		{"Fingerprint", "0123456789ABCDEF0123456789ABCDEF01234567", "PGP"},
+	}
+	for _, test := range schemes {
+		t.Run(test.description, func(t *testing.T) {
+			scheme, err := handoffSchemeFor(test.recipient)
+			if err != nil || scheme.Name() != test.wantScheme {
+				t.Errorf("got %v %v, wanted %v", scheme, err, test.wantScheme)
+			}
+		})
+	}
+
+	_, err = DecryptHandoff([]byte("export AWS_ACCESS_KEY_ID=AKIA"), "")
+	if err == nil || !strings.Contains(err.Error(), "not encrypted with age or PGP") {
+		t.Errorf("got error %v decrypting plaintext", err)
+	}
+}
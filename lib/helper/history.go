@@ -0,0 +1,231 @@
+package helper
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  History                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// secretFlags maps global flags that carry secrets to the secret they carry.
+var secretFlags = map[string]string{
+	"password": "password",
+	"p":        "password",
+	"token":    "token",
+	"t":        "token",
+}
+
+// secretEnvVars are environment variables that carry secrets.
+var secretEnvVars = []string{"KION_PASSWORD", "KION_API_KEY", "CTKEY_PASSWORD", "CTKEY_APPAPIKEY", "KION_BUNDLE_PASSPHRASE"}
+
+// boolFlags returns the names of the flags that do not take a value.
+func boolFlags(flags []cli.Flag) []string {
+	var names []string
+	for _, flag := range flags {
+		if _, ok := flag.(*cli.BoolFlag); ok {
+			names = append(names, flag.Names()...)
+		}
+	}
+	return names
+}
+
+// redacted replaces secret values when reporting commands.
+const redacted = "*****"
+
+// HistoryFinding is a shell history entry that exposes a secret.
+type HistoryFinding struct {
+	File string
+	Line int
+	// Secret is the flag or environment variable that exposed the secret.
+	Secret string
+	// Command is the entry with secret values redacted.
+	Command string
+}
+
+// secretArg is the position of a flag within a set of arguments that carries
+// a secret.
+type secretArg struct {
+	index  int
+	flag   string
+	inline bool
+}
+
+// findSecretArgs walks global flags, the app's flags given, stopping at the
+// first command, and returns those that carry secrets.
+func findSecretArgs(args []string, flags []cli.Flag) []secretArg {
+	var found []secretArg
+	bools := boolFlags(flags)
+	expectValue := false
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if expectValue {
+				expectValue = false
+				continue
+			}
+			break
+		}
+
+		flag, _, inline := strings.Cut(arg, "=")
+		name := strings.TrimLeft(flag, "-")
+		if _, ok := secretFlags[name]; ok {
+			found = append(found, secretArg{index: i, flag: flag, inline: inline})
+		}
+		expectValue = !inline && !slices.Contains(bools, name)
+	}
+
+	return found
+}
+
+// ArgvSecrets returns the global flags in args, such as --password, that pass
+// a secret on the command line where it is saved to shell history and visible
+// in process listings. The app's global flags tell those taking a value from
+// those that don't.
+func ArgvSecrets(args []string, globalFlags []cli.Flag) []string {
+	var flags []string
+	for _, arg := range findSecretArgs(args, globalFlags) {
+		flags = append(flags, arg.flag)
+	}
+	return flags
+}
+
+// SecretKind returns the kind of secret a flag returned by ArgvSecrets
+// carries, either "password" or "token".
+func SecretKind(flag string) string {
+	return secretFlags[strings.TrimLeft(flag, "-")]
+}
+
+// HistoryFiles returns the shell history files commonly found for the given
+// home directory, including HISTFILE if set. Files are not checked for
+// existence.
+func HistoryFiles(home string) []string {
+	var files []string
+	if histfile := os.Getenv("HISTFILE"); histfile != "" {
+		files = append(files, histfile)
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	files = append(files,
+		filepath.Join(home, ".bash_history"),
+		filepath.Join(home, ".zsh_history"),
+		filepath.Join(home, ".sh_history"),
+		filepath.Join(dataHome, "fish", "fish_history"),
+	)
+
+	// powershell keeps history with PSReadLine
+	if runtime.GOOS == "windows" {
+		files = append(files, filepath.Join(os.Getenv("APPDATA"), "Microsoft", "Windows", "PowerShell", "PSReadLine", "ConsoleHost_history.txt"))
+	} else {
+		files = append(files, filepath.Join(dataHome, "powershell", "PSReadLine", "ConsoleHost_history.txt"))
+	}
+
+	// drop duplicates, HISTFILE usually points at one of the defaults
+	var unique []string
+	for _, file := range files {
+		if !slices.Contains(unique, file) {
+			unique = append(unique, file)
+		}
+	}
+
+	return unique
+}
+
+// ScanHistory reads a shell history file and returns entries that pass a
+// secret to Kion CLI as one of its global flags or set one in an environment
+// variable. The file is never modified.
+func ScanHistory(path string, globalFlags []cli.Flag) ([]HistoryFinding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var findings []HistoryFinding
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		secrets, command := inspectCommand(historyCommand(scanner.Text()), globalFlags)
+		for _, secret := range secrets {
+			findings = append(findings, HistoryFinding{
+				File:    path,
+				Line:    line,
+				Secret:  secret,
+				Command: command,
+			})
+		}
+	}
+
+	return findings, scanner.Err()
+}
+
+// historyCommand strips shell specific metadata from a history entry, such as
+// zsh extended history timestamps and the fish history prefix.
+func historyCommand(entry string) string {
+	if strings.HasPrefix(entry, ": ") {
+		if _, command, found := strings.Cut(entry, ";"); found {
+			return command
+		}
+	}
+	if command, found := strings.CutPrefix(entry, "- cmd: "); found {
+		return command
+	}
+	return entry
+}
+
+// inspectCommand returns the secrets exposed by a command and the command with
+// their values redacted.
+func inspectCommand(command string, globalFlags []cli.Flag) ([]string, string) {
+	var secrets []string
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		// inline or exported environment variables
+		if name, _, found := strings.Cut(field, "="); found && slices.Contains(secretEnvVars, name) {
+			secrets = append(secrets, name)
+			fields[i] = name + "=" + redacted
+			continue
+		}
+
+		// global flags following the kion binary
+		if !isKionBinary(field) {
+			continue
+		}
+		args := fields[i+1:]
+		for _, arg := range findSecretArgs(args, globalFlags) {
+			secrets = append(secrets, arg.flag)
+			if arg.inline {
+				args[arg.index] = arg.flag + "=" + redacted
+			} else if arg.index+1 < len(args) {
+				args[arg.index+1] = redacted
+			}
+		}
+	}
+
+	if len(secrets) == 0 {
+		return nil, command
+	}
+	return secrets, strings.Join(fields, " ")
+}
+
+// isKionBinary reports whether a command word invokes Kion CLI or the ctkey
+// utility it replaces.
+func isKionBinary(word string) bool {
+	name := strings.TrimSuffix(filepath.Base(word), ".exe")
+	return name == "kion" || name == "ctkey"
+}
@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// historyFlags are global flags as the app defines them.
+var historyFlags = []cli.Flag{
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}},
+	&cli.StringFlag{Name: "password", Aliases: []string{"p"}},
+	&cli.StringFlag{Name: "token", Aliases: []string{"t"}},
+	&cli.BoolFlag{Name: "password-stdin"},
+	&cli.BoolFlag{Name: "disable-cache"},
+	&cli.BoolFlag{Name: "verbose"},
+	&cli.BoolFlag{Name: "no-browser"},
+	cli.HelpFlag,
+}
+
+func TestArgvSecrets(t *testing.T) {
+	tests := []struct {
+		description string
+		args        []string
+		want        []string
+	}{
+		{
+			"None",
+			[]string{"--user", "jane", "stak"},
+			nil,
+		},
+		{
+			"Password",
+			[]string{"--user", "jane", "--password", "hunter2", "stak"},
+			[]string{"--password"},
+		},
+		{
+			"Inline Token",
+			[]string{"-t=app_123", "stak"},
+			[]string{"-t"},
+		},
+		{
+			"After Bool Flag",
+			[]string{"--disable-cache", "-p", "hunter2", "stak"},
+			[]string{"-p"},
+		},
+		{
+			"After Other Bool Flags",
+			[]string{"--verbose", "--no-browser", "--password", "hunter2", "stak"},
+			[]string{"--password"},
+		},
+		{
+			"After Help",
+			[]string{"-h", "-t", "app_123"},
+			[]string{"-t"},
+		},
+		{
+			"Subcommand Flags Ignored",
+			[]string{"stak", "-p"},
+			nil,
+		},
+		{
+			"Password Stdin",
+			[]string{"--password-stdin", "stak"},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ArgvSecrets(test.args, historyFlags)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScanHistory(t *testing.T) {
+	history := `ls -la
+kion --password hunter2 stak
+: 1700000000:0;kion -t=app_123 fav prod
+- cmd: KION_PASSWORD=hunter2 kion stak
+kion stak -p
+export KION_API_KEY=app_123
+KION_BUNDLE_PASSPHRASE=s3cret kion cache export --out bundle.enc
+`
+	path := filepath.Join(t.TempDir(), ".zsh_history")
+	err := os.WriteFile(path, []byte(history), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []HistoryFinding{
+		{path, 2, "--password", "kion --password ***** stak"},
+		{path, 3, "-t", "kion -t=***** fav prod"},
+		{path, 4, "KION_PASSWORD", "KION_PASSWORD=***** kion stak"},
+		{path, 6, "KION_API_KEY", "export KION_API_KEY=*****"},
+		{path, 7, "KION_BUNDLE_PASSPHRASE", "KION_BUNDLE_PASSPHRASE=***** kion cache export --out bundle.enc"},
+	}
+
+	got, err := ScanHistory(path, historyFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+
+	// the file must be left untouched
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != history {
+		t.Error("history file was modified")
+	}
+}
@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/urfave/cli/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Inventory                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// FetchInventory retrieves the projects and cloud access roles available to
+// the user. It relies on the updated cloud access role API, see
+// UseUpdatedCARAPI.
+func FetchInventory(cCtx *cli.Context) (kion.Inventory, error) {
+	var inventory kion.Inventory
+	err := WithProgress(cCtx.Context, "Fetching projects", func(p *Progress) error {
+		var err error
+		inventory.Projects, err = kion.GetProjects(cCtx.String("endpoint"), cCtx.String("token"))
+		return err
+	})
+	if err != nil {
+		return inventory, err
+	}
+	err = WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *Progress) error {
+		var err error
+		inventory.CARs, err = kion.GetCARS(cCtx.String("endpoint"), cCtx.String("token"))
+		return err
+	})
+	if err != nil {
+		return inventory, err
+	}
+	inventory.Updated = time.Now()
+	return inventory, nil
+}
+
+// StaleLabel marks choices made from a cached inventory along with when it
+// was taken.
+func StaleLabel(updated time.Time) string {
+	return fmt.Sprintf("[stale data from %v]", updated.Local().Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Session Keepalive                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// sessions are refreshed this long before their access token expires, but no
+// sooner than keepaliveMinWait after the last refresh
+var (
+	keepaliveLead    = time.Minute
+	keepaliveMinWait = 30 * time.Second
+)
+
+// NextSessionRefresh returns how long to wait before refreshing a session
+// whose access token expires at accessExpires, to keep it alive without a
+// gap. False is returned if the refresh token, expiring at refreshExpires,
+// won't last until then, as the session can't be kept alive any longer.
+func NextSessionRefresh(accessExpires time.Time, refreshExpires time.Time, now time.Time) (time.Duration, bool) {
+	wait := accessExpires.Sub(now) - keepaliveLead
+	if wait < keepaliveMinWait {
+		wait = keepaliveMinWait
+	}
+	if !now.Add(wait).Before(refreshExpires) {
+		return 0, false
+	}
+	return wait, true
+}
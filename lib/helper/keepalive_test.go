@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSessionRefresh(t *testing.T) {
+	now := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description    string
+		accessExpires  time.Time
+		refreshExpires time.Time
+		wantWait       time.Duration
+		wantOK         bool
+	}{
+		{"Before Expiry", now.Add(10 * time.Minute), now.Add(8 * time.Hour), 9 * time.Minute, true},
+		{"About To Expire", now.Add(45 * time.Second), now.Add(8 * time.Hour), 30 * time.Second, true},
+		{"Already Expired", now.Add(-time.Minute), now.Add(8 * time.Hour), 30 * time.Second, true},
+		{"Refresh Token Runs Out", now.Add(10 * time.Minute), now.Add(5 * time.Minute), 0, false},
+		{"Refresh Token Runs Out At Refresh", now.Add(10 * time.Minute), now.Add(9 * time.Minute), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			wait, ok := NextSessionRefresh(test.accessExpires, test.refreshExpires, now)
+			if wait != test.wantWait || ok != test.wantOK {
+				t.Errorf("got %v %v, wanted %v %v", wait, ok, test.wantWait, test.wantOK)
+			}
+		})
+	}
+}
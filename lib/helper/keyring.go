@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Keyring                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// KeyringBackends are the keyring backends the cache can be kept in, in the
+// order keyring tries them when none is chosen.
+var KeyringBackends = []keyring.BackendType{
+	keyring.WinCredBackend,
+	keyring.KeychainBackend,
+	keyring.SecretServiceBackend,
+	keyring.KWalletBackend,
+	keyring.KeyCtlBackend,
+	keyring.PassBackend,
+	keyring.FileBackend,
+}
+
+// When the passphrase of the file keyring backend is prompted for.
+const (
+	PassphrasePromptAuto   = "auto"
+	PassphrasePromptAlways = "always"
+	PassphrasePromptNever  = "never"
+)
+
+// keyringName names the cache within each keyring backend.
+const keyringName = "kion-cli"
+
+// KeyringConfig returns the configuration the keyring is opened with from
+// settings, its encrypted files kept in cacheDir unless set otherwise. When a
+// backend is chosen only it is allowed, otherwise any available is.
+func KeyringConfig(settings structs.Keyring, cacheDir string, passphrase keyring.PromptFunc) (keyring.Config, error) {
+	cfg := keyring.Config{
+		ServiceName: keyringName,
+		KeyCtlScope: "session",
+
+		// osx
+		KeychainName:             "login",
+		KeychainTrustApplication: true,
+		KeychainSynchronizable:   false,
+
+		// kde wallet
+		KWalletAppID:  keyringName,
+		KWalletFolder: keyringName,
+
+		// windows
+		WinCredPrefix: keyringName,
+
+		// password store
+		PassDir:    settings.PassDir,
+		PassCmd:    settings.PassCmd,
+		PassPrefix: keyringName,
+
+		// encrypted file
+		FileDir:          cacheDir,
+		FilePasswordFunc: passphrase,
+	}
+	if settings.PassPrefix != "" {
+		cfg.PassPrefix = settings.PassPrefix
+	}
+	if settings.FileDir != "" {
+		cfg.FileDir = settings.FileDir
+	}
+
+	switch settings.PassphrasePrompt {
+	case "", PassphrasePromptAuto, PassphrasePromptAlways, PassphrasePromptNever:
+	default:
+		return cfg, fmt.Errorf("unknown kion.keyring.passphrase_prompt %q, expected auto, always, or never", settings.PassphrasePrompt)
+	}
+
+	if settings.Backend != "" {
+		backend := keyring.BackendType(settings.Backend)
+		if !slices.Contains(KeyringBackends, backend) {
+			return cfg, fmt.Errorf("unknown keyring backend %q, expected one of %v", settings.Backend, keyringBackendNames(KeyringBackends))
+		}
+		cfg.AllowedBackends = []keyring.BackendType{backend}
+	}
+	return cfg, nil
+}
+
+// KeyringPassphrase returns the function the file keyring backend asks for
+// its passphrase with. The passphrase is taken from env when set, otherwise
+// prompt is used as mode allows, auto prompting only when interactive.
+func KeyringPassphrase(mode string, env string, interactive bool, prompt keyring.PromptFunc) keyring.PromptFunc {
+	return func(message string) (string, error) {
+		switch {
+		case env != "":
+			return env, nil
+		case mode == PassphrasePromptNever:
+			return "", errors.New("the file keyring backend needs a passphrase, set KION_KEYRING_PASSPHRASE")
+		case mode != PassphrasePromptAlways && !interactive:
+			return "", errors.New("the file keyring backend needs a passphrase and this isn't a terminal to prompt for it on, set KION_KEYRING_PASSPHRASE")
+		}
+		return prompt(message)
+	}
+}
+
+// UnavailableKeyringBackend returns an error when backend can't be used on
+// this platform, naming those that can from available.
+func UnavailableKeyringBackend(backend keyring.BackendType, available []keyring.BackendType) error {
+	if slices.Contains(available, backend) {
+		return nil
+	}
+	return fmt.Errorf("the %v keyring backend isn't available here, try one of %v", backend, keyringBackendNames(available))
+}
+
+// keyringBackendNames lists backends for messages.
+func keyringBackendNames(backends []keyring.BackendType) string {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = string(backend)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestKeyringConfig(t *testing.T) {
+	tests := []struct {
+		description    string
+		settings       structs.Keyring
+		wantBackends   []keyring.BackendType
+		wantFileDir    string
+		wantPassPrefix string
+		wantErr        bool
+	}{
+		{"Defaults", structs.Keyring{}, nil, "/cache", "kion-cli", false},
+		{"Pass", structs.Keyring{Backend: "pass", PassPrefix: "work/kion"}, []keyring.BackendType{keyring.PassBackend}, "/cache", "work/kion", false},
+		{"File", structs.Keyring{Backend: "file", FileDir: "/secure"}, []keyring.BackendType{keyring.FileBackend}, "/secure", "kion-cli", false},
+		{"Unknown Backend", structs.Keyring{Backend: "vault"}, nil, "", "", true},
+		{"Unknown Prompt", structs.Keyring{PassphrasePrompt: "sometimes"}, nil, "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			cfg, err := KeyringConfig(test.settings, "/cache", nil)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if len(cfg.AllowedBackends) != len(test.wantBackends) || (len(cfg.AllowedBackends) == 1 && cfg.AllowedBackends[0] != test.wantBackends[0]) {
+				t.Errorf("got backends %v, wanted %v", cfg.AllowedBackends, test.wantBackends)
+			}
+			if cfg.FileDir != test.wantFileDir || cfg.PassPrefix != test.wantPassPrefix {
+				t.Errorf("got file dir %q and pass prefix %q, wanted %q and %q", cfg.FileDir, cfg.PassPrefix, test.wantFileDir, test.wantPassPrefix)
+			}
+		})
+	}
+}
+
+func TestKeyringPassphrase(t *testing.T) {
+	prompt := func(string) (string, error) { return "prompted", nil }
+	tests := []struct {
+		description string
+		mode        string
+		env         string
+		interactive bool
+		want        string
+		wantErr     bool
+	}{
+		{"Environment", PassphrasePromptNever, "secret", false, "secret", false},
+		{"Auto On A Terminal", PassphrasePromptAuto, "", true, "prompted", false},
+		{"Auto Headless", "", "", false, "", true},
+		{"Always Headless", PassphrasePromptAlways, "", false, "prompted", false},
+		{"Never", PassphrasePromptNever, "", true, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := KeyringPassphrase(test.mode, test.env, test.interactive, prompt)("Passphrase:")
+			if (err != nil) != test.wantErr || got != test.want {
+				t.Errorf("got %q and error %v, wanted %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestUnavailableKeyringBackend(t *testing.T) {
+	available := []keyring.BackendType{keyring.SecretServiceBackend, keyring.FileBackend}
+	if err := UnavailableKeyringBackend(keyring.FileBackend, available); err != nil {
+		t.Errorf("got %v for an available backend", err)
+	}
+	err := UnavailableKeyringBackend(keyring.KeychainBackend, available)
+	if err == nil || errors.Unwrap(err) != nil || err.Error() != "the keychain keyring backend isn't available here, try one of secret-service, file" {
+		t.Errorf("got %v for an unavailable backend", err)
+	}
+}
@@ -0,0 +1,97 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Kion UI                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// kionUIPage is a page of the Kion web UI for a project or account.
+type kionUIPage struct {
+	resource string
+	path     string
+}
+
+// kionUIPages maps the pages that can be opened to the resource they show and
+// their path, formatted with the resource's ID.
+var kionUIPages = map[string]kionUIPage{
+	"project":    {"project", "/portfolio/project/%v"},
+	"account":    {"account", "/portfolio/account/%v"},
+	"compliance": {"project", "/portfolio/project/%v/compliance"},
+	"budget":     {"project", "/portfolio/project/%v/financials/budget"},
+}
+
+// KionUIPages returns the names of the pages that can be opened.
+func KionUIPages() []string {
+	var pages []string
+	for page := range kionUIPages {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// KionUIResource returns the kind of resource, project or account, shown by
+// a page.
+func KionUIResource(page string) (string, error) {
+	p, found := kionUIPages[page]
+	if !found {
+		return "", fmt.Errorf("unknown page %v, expected one of %v", page, strings.Join(KionUIPages(), ", "))
+	}
+	return p.resource, nil
+}
+
+// KionUIURL returns the link to a page of the Kion web UI for the resource
+// with the given ID.
+func KionUIURL(host string, page string, id uint) (string, error) {
+	p, found := kionUIPages[page]
+	if !found {
+		return "", fmt.Errorf("unknown page %v, expected one of %v", page, strings.Join(KionUIPages(), ", "))
+	}
+	return strings.TrimRight(host, "/") + fmt.Sprintf(p.path, id), nil
+}
+
+// UIResource is a project or account that can be opened in the Kion web UI.
+// Accounts also carry their account number.
+type UIResource struct {
+	ID     uint
+	Name   string
+	Number string
+}
+
+// FindUIResource returns the resource identified by query, which may be its
+// Kion ID, account number, or name ignoring case. It is an error for a name
+// to match more than one resource.
+func FindUIResource(resources []UIResource, query string) (UIResource, error) {
+	id, _ := strconv.ParseUint(query, 10, 0)
+	var matches []UIResource
+	for _, r := range resources {
+		switch {
+		case r.Number != "" && r.Number == query:
+			return r, nil
+		case id != 0 && uint64(r.ID) == id:
+			return r, nil
+		case strings.EqualFold(r.Name, query):
+			matches = append(matches, r)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return UIResource{}, fmt.Errorf("nothing named %v found", query)
+	case 1:
+		return matches[0], nil
+	}
+	var found []string
+	for _, m := range matches {
+		found = append(found, fmt.Sprintf("%v (%v)", m.Name, m.ID))
+	}
+	return UIResource{}, fmt.Errorf("%v is ambiguous, use the ID of one of: %v", query, strings.Join(found, ", "))
+}
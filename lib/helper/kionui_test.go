@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestKionUIURL(t *testing.T) {
+	tests := []struct {
+		description string
+		page        string
+		want        string
+		wantErr     bool
+	}{
+		{"Project", "project", "https://kion.example/portfolio/project/12", false},
+		{"Account", "account", "https://kion.example/portfolio/account/12", false},
+		{"Compliance", "compliance", "https://kion.example/portfolio/project/12/compliance", false},
+		{"Budget", "budget", "https://kion.example/portfolio/project/12/financials/budget", false},
+		{"Unknown", "billing", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := KionUIURL("https://kion.example/", test.page, 12)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindUIResource(t *testing.T) {
+	resources := []UIResource{
+		{ID: 1, Name: "Payments", Number: "111111111111"},
+		{ID: 2, Name: "Sandbox", Number: "222222222222"},
+		{ID: 3, Name: "sandbox", Number: "333333333333"},
+		{ID: 4, Name: "Data"},
+	}
+
+	tests := []struct {
+		description string
+		query       string
+		wantID      uint
+		wantErr     bool
+	}{
+		{"Name", "payments", 1, false},
+		{"Account Number", "222222222222", 2, false},
+		{"ID", "4", 4, false},
+		{"Ambiguous Name", "Sandbox", 0, true},
+		{"Missing", "billing", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := FindUIResource(resources, test.query)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if got.ID != test.wantID {
+				t.Errorf("got %v, wanted %v", got.ID, test.wantID)
+			}
+		})
+	}
+}
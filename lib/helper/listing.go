@@ -0,0 +1,205 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Listing                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ProjectOutput is the structured form of a project.
+type ProjectOutput struct {
+	ID          uint   `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Archived    bool   `json:"archived" yaml:"archived"`
+}
+
+// NewProjectOutputs returns the structured form of projects, sorted by name.
+func NewProjectOutputs(projects []kion.Project) []ProjectOutput {
+	outputs := []ProjectOutput{}
+	for _, project := range projects {
+		outputs = append(outputs, ProjectOutput{
+			ID:          project.ID,
+			Name:        project.Name,
+			Description: project.Description,
+			Archived:    project.Archived,
+		})
+	}
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return strings.ToLower(outputs[i].Name) < strings.ToLower(outputs[j].Name)
+	})
+	return outputs
+}
+
+// PrintProjects prints projects as a table.
+func PrintProjects(w io.Writer, projects []ProjectOutput) error {
+	if len(projects) == 0 {
+		_, err := fmt.Fprintln(w, "No projects found.")
+		return err
+	}
+	table := NewTable("ID", "NAME", "DESCRIPTION")
+	for _, project := range projects {
+		name := project.Name
+		if project.Archived {
+			name += " (archived)"
+		}
+		table.AddRow(project.ID, name, project.Description)
+	}
+	return table.Write(w)
+}
+
+// FindProject returns the project with the given name, compared without
+// regard to case, or ID.
+func FindProject(projects []kion.Project, nameOrID string) (kion.Project, error) {
+	for _, project := range projects {
+		if strings.EqualFold(project.Name, nameOrID) || fmt.Sprint(project.ID) == nameOrID {
+			return project, nil
+		}
+	}
+	return kion.Project{}, fmt.Errorf("project not found: %v", nameOrID)
+}
+
+// AccountOutput is the structured form of an account.
+type AccountOutput struct {
+	Account   string `json:"account" yaml:"account"`
+	Name      string `json:"name" yaml:"name"`
+	Cloud     string `json:"cloud,omitempty" yaml:"cloud,omitempty"`
+	ID        uint   `json:"id" yaml:"id"`
+	ProjectID uint   `json:"project_id" yaml:"project_id"`
+	Project   string `json:"project,omitempty" yaml:"project,omitempty"`
+}
+
+// NewAccountOutputs returns the structured form of accounts, sorted by name
+// and then account number, with the names of their projects filled in from
+// projects.
+func NewAccountOutputs(accounts []kion.Account, projects []kion.Project) []AccountOutput {
+	names := projectNames(projects)
+	outputs := []AccountOutput{}
+	for _, account := range accounts {
+		outputs = append(outputs, AccountOutput{
+			Account:   account.Number,
+			Name:      account.Name,
+			Cloud:     account.Cloud(),
+			ID:        account.ID,
+			ProjectID: account.ProjectID,
+			Project:   names[account.ProjectID],
+		})
+	}
+	sort.SliceStable(outputs, func(i, j int) bool {
+		if !strings.EqualFold(outputs[i].Name, outputs[j].Name) {
+			return strings.ToLower(outputs[i].Name) < strings.ToLower(outputs[j].Name)
+		}
+		return outputs[i].Account < outputs[j].Account
+	})
+	return outputs
+}
+
+// PrintAccounts prints accounts as a table.
+func PrintAccounts(w io.Writer, accounts []AccountOutput) error {
+	if len(accounts) == 0 {
+		_, err := fmt.Fprintln(w, "No accounts found.")
+		return err
+	}
+	table := NewTable("ACCOUNT", "NAME", "CLOUD", "PROJECT")
+	for _, account := range accounts {
+		table.AddRow(account.Account, account.Name, CloudName(account.Cloud), account.Project)
+	}
+	return table.Write(w)
+}
+
+// AccountsFromCARs returns the accounts cloud access roles are on, once each
+// in the order first seen. It stands in for the accounts API for users who
+// may only see their cloud access roles, and relies on the updated cloud
+// access role API, see UseUpdatedCARAPI.
+func AccountsFromCARs(cars []kion.CAR) []kion.Account {
+	var accounts []kion.Account
+	seen := make(map[string]bool)
+	for _, car := range cars {
+		if car.AccountNumber == "" || seen[car.AccountNumber] {
+			continue
+		}
+		seen[car.AccountNumber] = true
+		accounts = append(accounts, kion.Account{
+			ID:        car.AccountID,
+			Name:      car.AccountName,
+			Number:    car.AccountNumber,
+			TypeID:    car.AccountTypeID,
+			ProjectID: car.ProjectID,
+		})
+	}
+	return accounts
+}
+
+// CAROutput is the structured form of a cloud access role on an account.
+type CAROutput struct {
+	CAR          string   `json:"cloud_access_role" yaml:"cloud_access_role"`
+	Account      string   `json:"account" yaml:"account"`
+	AccountName  string   `json:"account_name,omitempty" yaml:"account_name,omitempty"`
+	Cloud        string   `json:"cloud,omitempty" yaml:"cloud,omitempty"`
+	ID           uint     `json:"id" yaml:"id"`
+	ProjectID    uint     `json:"project_id" yaml:"project_id"`
+	Project      string   `json:"project,omitempty" yaml:"project,omitempty"`
+	AccessLevels []string `json:"access_levels,omitempty" yaml:"access_levels,omitempty"`
+}
+
+// NewCAROutputs returns the structured form of cloud access roles, sorted by
+// account name, account number, and then name, with the names of their
+// projects filled in from projects.
+func NewCAROutputs(cars []kion.CAR, projects []kion.Project) []CAROutput {
+	names := projectNames(projects)
+	outputs := []CAROutput{}
+	for _, car := range cars {
+		outputs = append(outputs, CAROutput{
+			CAR:          car.Name,
+			Account:      car.AccountNumber,
+			AccountName:  car.AccountName,
+			Cloud:        car.Cloud(),
+			ID:           car.ID,
+			ProjectID:    car.ProjectID,
+			Project:      names[car.ProjectID],
+			AccessLevels: car.AccessLevels(),
+		})
+	}
+	sort.SliceStable(outputs, func(i, j int) bool {
+		a, b := outputs[i], outputs[j]
+		switch {
+		case !strings.EqualFold(a.AccountName, b.AccountName):
+			return strings.ToLower(a.AccountName) < strings.ToLower(b.AccountName)
+		case a.Account != b.Account:
+			return a.Account < b.Account
+		}
+		return a.CAR < b.CAR
+	})
+	return outputs
+}
+
+// PrintCARs prints cloud access roles as a table.
+func PrintCARs(w io.Writer, cars []CAROutput) error {
+	if len(cars) == 0 {
+		_, err := fmt.Fprintln(w, "No cloud access roles found.")
+		return err
+	}
+	table := NewTable("ACCOUNT", "NAME", "CLOUD ACCESS ROLE", "ACCESS")
+	for _, car := range cars {
+		table.AddRow(car.Account, car.AccountName, car.CAR, strings.Join(car.AccessLevels, ", "))
+	}
+	return table.Write(w)
+}
+
+// projectNames maps project IDs to their names.
+func projectNames(projects []kion.Project) map[uint]string {
+	names := make(map[uint]string, len(projects))
+	for _, project := range projects {
+		names[project.ID] = project.Name
+	}
+	return names
+}
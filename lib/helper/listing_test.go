@@ -0,0 +1,109 @@
+package helper
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+var listingProjects = []kion.Project{
+	{ID: 7, Name: "Payments", Description: "card processing"},
+	{ID: 3, Name: "analytics", Archived: true},
+}
+
+func TestNewProjectOutputs(t *testing.T) {
+	got := NewProjectOutputs(listingProjects)
+	want := []ProjectOutput{
+		{ID: 3, Name: "analytics", Archived: true},
+		{ID: 7, Name: "Payments", Description: "card processing"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+
+	var out bytes.Buffer
+	if err := PrintProjects(&out, got); err != nil {
+		t.Fatal(err)
+	}
+	wantText := "ID  NAME                  DESCRIPTION\n" +
+		"3   analytics (archived)  \n" +
+		"7   Payments              card processing\n"
+	if out.String() != wantText {
+		t.Errorf("\ngot:\n%v\nwanted:\n%v", out.String(), wantText)
+	}
+}
+
+func TestFindProject(t *testing.T) {
+	tests := []struct {
+		description string
+		nameOrID    string
+		wantID      uint
+		wantErr     bool
+	}{
+		{"Name", "Payments", 7, false},
+		{"Name Any Case", "ANALYTICS", 3, false},
+		{"ID", "7", 7, false},
+		{"Missing", "Marketing", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := FindProject(listingProjects, test.nameOrID)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got.ID != test.wantID {
+				t.Errorf("got project %v, wanted %v", got.ID, test.wantID)
+			}
+		})
+	}
+}
+
+func TestNewAccountOutputs(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Admin", AccountID: 12, AccountNumber: "444455556666", AccountName: "payments-prod", AccountTypeID: 1, ProjectID: 7},
+		{Name: "ReadOnly", AccountID: 12, AccountNumber: "444455556666", AccountName: "payments-prod", AccountTypeID: 1, ProjectID: 7},
+		{Name: "Viewer", AccountID: 14, AccountNumber: "analytics-dev", AccountName: "Analytics Dev", AccountType: "Google Cloud", ProjectID: 3},
+		{Name: "Admin", AccountID: 11, AccountNumber: "111122223333", AccountName: "payments-prod", AccountTypeID: 1, ProjectID: 9},
+	}
+	accounts := AccountsFromCARs(cars)
+	if len(accounts) != 3 {
+		t.Fatalf("got %v accounts, wanted 3: %+v", len(accounts), accounts)
+	}
+
+	got := NewAccountOutputs(accounts, listingProjects)
+	want := []AccountOutput{
+		{Account: "analytics-dev", Name: "Analytics Dev", Cloud: kion.CloudGCP, ID: 14, ProjectID: 3, Project: "analytics"},
+		{Account: "111122223333", Name: "payments-prod", Cloud: kion.CloudAWS, ID: 11, ProjectID: 9},
+		{Account: "444455556666", Name: "payments-prod", Cloud: kion.CloudAWS, ID: 12, ProjectID: 7, Project: "Payments"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
+
+func TestNewCAROutputs(t *testing.T) {
+	cars := []kion.CAR{
+		{ID: 2, Name: "ReadOnly", AccountNumber: "444455556666", AccountName: "payments-prod", ProjectID: 7, WebAccess: true},
+		{ID: 1, Name: "Admin", AccountNumber: "444455556666", AccountName: "payments-prod", ProjectID: 7, ShortTermAccessKeys: true, WebAccess: true},
+	}
+
+	got := NewCAROutputs(cars, listingProjects)
+	want := []CAROutput{
+		{CAR: "Admin", Account: "444455556666", AccountName: "payments-prod", Cloud: kion.CloudAWS, ID: 1, ProjectID: 7, Project: "Payments", AccessLevels: []string{kion.AccessLevelCLI, kion.AccessLevelWeb}},
+		{CAR: "ReadOnly", Account: "444455556666", AccountName: "payments-prod", Cloud: kion.CloudAWS, ID: 2, ProjectID: 7, Project: "Payments", AccessLevels: []string{kion.AccessLevelWeb}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+
+	var out bytes.Buffer
+	if err := PrintCARs(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "No cloud access roles found.\n" {
+		t.Errorf("got %q for no cloud access roles", out.String())
+	}
+}
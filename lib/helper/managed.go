@@ -0,0 +1,231 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+
+	"gopkg.in/yaml.v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Managed Configuration                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ManagedConfigPath returns where the managed configuration is deployed on
+// the given platform, such as by MDM. It is read only and outside the home
+// directory so users can't move or change it.
+func ManagedConfigPath(goos string, getenv func(string) string) string {
+	if goos == "windows" {
+		programData := getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "Kion", "managed.yml")
+	}
+	return "/etc/kion/managed.yml"
+}
+
+// ManagedConfig is configuration deployed by an organization whose settings
+// are locked, taking precedence over the user's configuration file, profiles,
+// flags, environment variables, and overrides. A nil ManagedConfig locks
+// nothing.
+type ManagedConfig struct {
+	// Path is the file the managed configuration was read from.
+	Path string
+
+	// settings are the locked values by the dotted path of the setting, such
+	// as kion.url. Lists are locked as a whole.
+	settings map[string]interface{}
+}
+
+// ReadManagedConfig reads the managed configuration at path, returning nil if
+// there is none. Unknown settings and values of the wrong type are rejected
+// so mistakes in a deployed file don't go unnoticed.
+func ReadManagedConfig(path string) (*ManagedConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the managed configuration: %w", err)
+	}
+	return ParseManagedConfig(path, data)
+}
+
+// ParseManagedConfig parses managed configuration yaml read from path.
+func ParseManagedConfig(path string, data []byte) (*ManagedConfig, error) {
+	var check structs.Configuration
+	err := yaml.UnmarshalStrict(data, &check)
+	if err != nil {
+		return nil, fmt.Errorf("invalid managed configuration %v: %w", path, err)
+	}
+	tree := make(map[interface{}]interface{})
+	err = yaml.Unmarshal(data, &tree)
+	if err != nil {
+		return nil, fmt.Errorf("invalid managed configuration %v: %w", path, err)
+	}
+	managed := &ManagedConfig{Path: path, settings: make(map[string]interface{})}
+	flattenSettings(tree, "", managed.settings)
+	return managed, nil
+}
+
+// flattenSettings adds the values in a tree of yaml maps to settings by their
+// dotted path.
+func flattenSettings(tree map[interface{}]interface{}, prefix string, settings map[string]interface{}) {
+	for name, value := range tree {
+		key := prefix + fmt.Sprint(name)
+		if child, ok := value.(map[interface{}]interface{}); ok {
+			flattenSettings(child, key+".", settings)
+			continue
+		}
+		settings[key] = value
+	}
+}
+
+// Keys returns the dotted paths of the locked settings, sorted.
+func (m *ManagedConfig) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(m.settings))
+	for key := range m.settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Apply sets the locked settings in config.
+func (m *ManagedConfig) Apply(config *structs.Configuration) error {
+	if m == nil || len(m.settings) == 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tree := make(map[interface{}]interface{})
+	err = yaml.Unmarshal(data, &tree)
+	if err != nil {
+		return err
+	}
+	for key, value := range m.settings {
+		err = setConfigKey(tree, strings.Split(key, "."), value)
+		if err != nil {
+			return fmt.Errorf("unable to apply managed setting %v: %w", key, err)
+		}
+	}
+	data, err = yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	var updated structs.Configuration
+	err = yaml.Unmarshal(data, &updated)
+	if err != nil {
+		return err
+	}
+	*config = updated
+	return nil
+}
+
+// Check returns an error if value given for the setting at key by source,
+// such as a flag, differs from the value it is locked to. Settings whose
+// section is locked, such as kion when kion.url is, are refused outright. An
+// empty value leaves the locked value in place so is allowed.
+func (m *ManagedConfig) Check(key string, value interface{}, source string) error {
+	if m == nil || value == nil {
+		return nil
+	}
+
+	// profiles carry the same settings as the top level
+	path := strings.Split(key, ".")
+	if len(path) > 2 && path[0] == "profiles" {
+		key = strings.Join(path[2:], ".")
+	}
+
+	if locked, found := m.settings[key]; found {
+		if fmt.Sprint(locked) == fmt.Sprint(value) {
+			return nil
+		}
+		return m.lockedError(key, source)
+	}
+	for _, locked := range m.Keys() {
+		if strings.HasPrefix(locked, key+".") {
+			return m.lockedError(locked, source)
+		}
+	}
+	return nil
+}
+
+// CheckOverrides returns an error if any of the key=value overrides given
+// with --set changes a locked setting, see ApplyConfigOverrides.
+func (m *ManagedConfig) CheckOverrides(overrides []string) error {
+	for _, override := range overrides {
+		key, value, _ := strings.Cut(override, "=")
+		err := m.CheckValue(key, value, "--set "+key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckValue returns an error if setting key to value, given as yaml, changes
+// a locked setting, see Check.
+func (m *ManagedConfig) CheckValue(key string, value string, source string) error {
+	var parsed interface{}
+	err := yaml.Unmarshal([]byte(value), &parsed)
+	if err != nil {
+		return fmt.Errorf("invalid value for %v: %w", key, err)
+	}
+	return m.Check(key, parsed, source)
+}
+
+// CheckFile returns an error if the configuration file at path, or any of its
+// profiles, sets a locked setting to another value.
+func (m *ManagedConfig) CheckFile(path string) error {
+	if m == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tree := make(map[interface{}]interface{})
+	err = yaml.Unmarshal(data, &tree)
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]interface{})
+	flattenSettings(tree, "", settings)
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err = m.Check(key, settings[key], "your configuration file "+path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedError explains that key is locked and can't be set by source. The
+// locked value isn't shown as it may be a secret.
+func (m *ManagedConfig) lockedError(key string, source string) error {
+	return fmt.Errorf("%v is managed by your organization in %v and can't be changed by %v, remove it or ask your administrator", key, m.Path, source)
+}
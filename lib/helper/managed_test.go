@@ -0,0 +1,164 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+const testManagedConfig = `
+kion:
+  url: https://kion.example.com
+  auth_method: saml
+  saml_callback_port: 8400
+api:
+  ssh_jump: bastion.example.com
+`
+
+func TestParseManagedConfig(t *testing.T) {
+	managed, err := ParseManagedConfig("/etc/kion/managed.yml", []byte(testManagedConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "api.ssh_jump kion.auth_method kion.saml_callback_port kion.url"
+	if got := strings.Join(managed.Keys(), " "); got != want {
+		t.Errorf("got keys %v, wanted %v", got, want)
+	}
+
+	_, err = ParseManagedConfig("/etc/kion/managed.yml", []byte("kion:\n  ulr: https://kion.example.com\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid managed configuration /etc/kion/managed.yml") {
+		t.Errorf("got error %v for an unknown setting, wanted it rejected", err)
+	}
+}
+
+func TestManagedConfigApply(t *testing.T) {
+	managed, err := ParseManagedConfig("/etc/kion/managed.yml", []byte(testManagedConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := structs.Configuration{Kion: structs.Kion{Url: "https://other.example.com", Browser: "firefox"}}
+	err = managed.Apply(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Kion.Url != "https://kion.example.com" || config.Kion.AuthMethod != "saml" || config.Kion.SamlCallbackPort != "8400" || config.API.SSHJump != "bastion.example.com" {
+		t.Errorf("locked settings not applied, got %+v", config)
+	}
+	if config.Kion.Browser != "firefox" {
+		t.Errorf("got browser %q, wanted unlocked settings left alone", config.Kion.Browser)
+	}
+
+	var none *ManagedConfig
+	if err := none.Apply(&config); err != nil {
+		t.Errorf("got error %v applying no managed configuration", err)
+	}
+}
+
+func TestManagedConfigCheck(t *testing.T) {
+	managed, err := ParseManagedConfig("/etc/kion/managed.yml", []byte(testManagedConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		key         string
+		value       interface{}
+		wantLocked  string
+	}{
+		{"Unlocked", "kion.browser", "firefox", ""},
+		{"Same Value", "kion.url", "https://kion.example.com", ""},
+		{"Same Value Other Type", "kion.saml_callback_port", "8400", ""},
+		{"Different Value", "kion.url", "https://other.example.com", "kion.url"},
+		{"Empty Value", "kion.url", nil, ""},
+		{"Profile", "profiles.work.kion.auth_method", "password", "kion.auth_method"},
+		{"Profile Unlocked", "profiles.work.kion.browser", "firefox", ""},
+		{"Locked Section", "api", map[interface{}]interface{}{}, "api.ssh_jump"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := managed.Check(test.key, test.value, "--endpoint")
+			if test.wantLocked == "" {
+				if err != nil {
+					t.Errorf("got error %v, wanted none", err)
+				}
+				return
+			}
+			want := test.wantLocked + " is managed by your organization in /etc/kion/managed.yml and can't be changed by --endpoint"
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v, wanted one containing %q", err, want)
+			}
+		})
+	}
+}
+
+func TestManagedConfigCheckOverrides(t *testing.T) {
+	managed, err := ParseManagedConfig("/etc/kion/managed.yml", []byte(testManagedConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = managed.CheckOverrides([]string{"kion.browser=firefox", "kion.saml_callback_port=8400"})
+	if err != nil {
+		t.Errorf("got error %v, wanted none", err)
+	}
+	err = managed.CheckOverrides([]string{"kion.auth_method=password"})
+	if err == nil || !strings.Contains(err.Error(), "changed by --set kion.auth_method") {
+		t.Errorf("got error %v, wanted the override refused", err)
+	}
+}
+
+func TestManagedConfigCheckFile(t *testing.T) {
+	managed, err := ParseManagedConfig("/etc/kion/managed.yml", []byte(testManagedConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		config      string
+		wantLocked  string
+	}{
+		{"Missing", "", ""},
+		{"Unlocked Settings", "kion:\n  url: https://kion.example.com\n  browser: firefox\n", ""},
+		{"Locked Setting", "kion:\n  url: https://other.example.com\n", "kion.url"},
+		{"Locked In Profile", "profiles:\n  work:\n    kion:\n      auth_method: api_key\n", "kion.auth_method"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if test.config != "" {
+				err := os.WriteFile(path, []byte(test.config), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := managed.CheckFile(path)
+			if test.wantLocked == "" {
+				if err != nil {
+					t.Errorf("got error %v, wanted none", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.wantLocked+" is managed") || !strings.Contains(err.Error(), path) {
+				t.Errorf("got error %v, wanted %v refused in %v", err, test.wantLocked, path)
+			}
+		})
+	}
+}
+
+func TestManagedConfigPath(t *testing.T) {
+	getenv := func(key string) string {
+		return map[string]string{"ProgramData": `D:\ProgramData`}[key]
+	}
+	if got := ManagedConfigPath("linux", getenv); got != "/etc/kion/managed.yml" {
+		t.Errorf("got %v on linux", got)
+	}
+	if got := ManagedConfigPath("windows", getenv); got != filepath.Join(`D:\ProgramData`, "Kion", "managed.yml") {
+		t.Errorf("got %v on windows", got)
+	}
+}
@@ -0,0 +1,265 @@
+package helper
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Metadata Server                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ContainerCredentialsPath is where the metadata server answers as the ECS
+// container credentials endpoint, the path of AWS_CONTAINER_CREDENTIALS_FULL_URI.
+const ContainerCredentialsPath = "/v2/credentials"
+
+// imdsTokenMaxTTL is the longest an IMDSv2 session token may be asked to
+// last, six hours as on EC2.
+const imdsTokenMaxTTL = 6 * time.Hour
+
+// MetadataOptions configure the metadata server.
+type MetadataOptions struct {
+	// Role is the name credentials are listed under in the instance metadata.
+	Role string
+	// Region is answered as the placement of the instance, left unanswered
+	// when empty.
+	Region string
+	// Token must be sent as the Authorization header to the container
+	// credentials endpoint, AWS_CONTAINER_AUTHORIZATION_TOKEN.
+	Token string
+	// AllowIMDSv1 answers instance metadata requests without an IMDSv2
+	// session token.
+	AllowIMDSv1 bool
+	// Credentials returns the short term access keys to hand out, expected to
+	// return new ones before those cached expire.
+	Credentials func() (kion.STAK, error)
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// metadataServer answers credential requests the way the EC2 instance
+// metadata service and the ECS container credentials endpoint do. Keys are
+// fetched one request at a time so concurrent clients share them.
+type metadataServer struct {
+	options MetadataOptions
+	fetch   sync.Mutex
+	mu      sync.Mutex
+	tokens  map[string]time.Time
+}
+
+// NewMetadataServer returns a handler emulating the credential endpoints of
+// the EC2 instance metadata service and the ECS container credentials
+// endpoint, so SDKs and tools that only read credentials from those work
+// with Kion's short term access keys. Requests must address the server as a
+// loopback or link-local host.
+func NewMetadataServer(options MetadataOptions) http.Handler {
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	m := &metadataServer{options: options, tokens: make(map[string]time.Time)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /latest/api/token", m.imdsToken)
+	mux.Handle("GET /latest/meta-data/iam/security-credentials", m.imds(m.imdsRoles))
+	mux.Handle("GET /latest/meta-data/iam/security-credentials/{$}", m.imds(m.imdsRoles))
+	mux.Handle("GET /latest/meta-data/iam/security-credentials/{role}", m.imds(m.imdsCredentials))
+	mux.Handle("GET /latest/meta-data/placement/region", m.imds(m.imdsRegion))
+	mux.Handle("GET /latest/dynamic/instance-identity/document", m.imds(m.imdsIdentity))
+	mux.HandleFunc("GET "+ContainerCredentialsPath, m.containerCredentials)
+	return m.guard(mux)
+}
+
+// MetadataRoleName returns a cloud access role name as an instance profile
+// role name, replacing characters IAM doesn't allow in one with dashes.
+func MetadataRoleName(car string) string {
+	name := metadataRoleInvalid.ReplaceAllString(car, "-")
+	if name == "" {
+		return "kion"
+	}
+	return name
+}
+
+// metadataRoleInvalid matches characters IAM doesn't allow in role names.
+var metadataRoleInvalid = regexp.MustCompile(`[^\w+=,.@-]+`)
+
+// guard rejects requests for a host other than loopback or link-local, the
+// addresses the real services answer on, preventing DNS rebinding from
+// reaching the server. Like the instance metadata service, forwarded requests
+// are refused too.
+func (m *metadataServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		ip := net.ParseIP(host)
+		if host != "localhost" && (ip == nil || (!ip.IsLoopback() && !ip.IsLinkLocalUnicast())) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Forwarded-For") != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// imdsToken issues an IMDSv2 session token for the requested number of
+// seconds.
+func (m *metadataServer) imdsToken(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil || ttl < time.Second || ttl > imdsTokenMaxTTL {
+		http.Error(w, "invalid X-aws-ec2-metadata-token-ttl-seconds", http.StatusBadRequest)
+		return
+	}
+	token, err := NewWebUIToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := m.options.Now()
+	m.mu.Lock()
+	for t, expires := range m.tokens {
+		if !expires.After(now) {
+			delete(m.tokens, t)
+		}
+	}
+	m.tokens[token] = now.Add(ttl)
+	m.mu.Unlock()
+
+	w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(token))
+}
+
+// imds wraps an instance metadata handler, requiring an unexpired IMDSv2
+// session token unless IMDSv1 is allowed. A token sent is always checked.
+func (m *metadataServer) imds(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-aws-ec2-metadata-token")
+		if token != "" || !m.options.AllowIMDSv1 {
+			m.mu.Lock()
+			expires, found := m.tokens[token]
+			m.mu.Unlock()
+			if !found || !expires.After(m.options.Now()) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	})
+}
+
+// imdsRoles lists the role credentials are available for.
+func (m *metadataServer) imdsRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(m.options.Role))
+}
+
+// imdsCredentials returns the keys for the role in the layout of the instance
+// metadata service.
+func (m *metadataServer) imdsCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("role") != m.options.Role {
+		http.NotFound(w, r)
+		return
+	}
+	stak, ok := m.credentials(w)
+	if !ok {
+		return
+	}
+	writeMetadataJSON(w, struct {
+		Code            string
+		LastUpdated     string
+		Type            string
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      string
+	}{
+		Code:            "Success",
+		LastUpdated:     m.options.Now().UTC().Format(time.RFC3339),
+		Type:            "AWS-HMAC",
+		AccessKeyID:     stak.AccessKey,
+		SecretAccessKey: stak.SecretAccessKey,
+		Token:           stak.SessionToken,
+		Expiration:      stak.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+// imdsRegion returns the region of the instance.
+func (m *metadataServer) imdsRegion(w http.ResponseWriter, r *http.Request) {
+	if m.options.Region == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(m.options.Region))
+}
+
+// imdsIdentity returns an instance identity document holding the region, the
+// only part of it SDKs read.
+func (m *metadataServer) imdsIdentity(w http.ResponseWriter, r *http.Request) {
+	if m.options.Region == "" {
+		http.NotFound(w, r)
+		return
+	}
+	writeMetadataJSON(w, map[string]string{"region": m.options.Region})
+}
+
+// containerCredentials returns the keys in the layout of the ECS container
+// credentials endpoint, requiring the authorization token.
+func (m *metadataServer) containerCredentials(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(m.options.Token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	stak, ok := m.credentials(w)
+	if !ok {
+		return
+	}
+	writeMetadataJSON(w, struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      string
+	}{
+		AccessKeyID:     stak.AccessKey,
+		SecretAccessKey: stak.SecretAccessKey,
+		Token:           stak.SessionToken,
+		Expiration:      stak.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+// credentials fetches the keys to hand out, responding with an error if that
+// fails.
+func (m *metadataServer) credentials(w http.ResponseWriter) (kion.STAK, bool) {
+	m.fetch.Lock()
+	defer m.fetch.Unlock()
+	stak, err := m.options.Credentials()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Code": "Error", "Message": err.Error()})
+		return kion.STAK{}, false
+	}
+	return stak, true
+}
+
+// writeMetadataJSON responds with v as json.
+func writeMetadataJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,255 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestMetadataServer(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stak := kion.STAK{AccessKey: "AKIA", SecretAccessKey: "secret", SessionToken: "session", Expiration: now.Add(time.Hour)}
+	var fetches int
+	options := MetadataOptions{
+		Role:   "Admin",
+		Region: "us-east-1",
+		Token:  "container-token",
+		Credentials: func() (kion.STAK, error) {
+			fetches++
+			return stak, nil
+		},
+		Now: func() time.Time { return now },
+	}
+	handler := NewMetadataServer(options)
+
+	// issue an IMDSv2 session token to use below
+	r := httptest.NewRequest("PUT", "/latest/api/token", nil)
+	r.Host = "127.0.0.1:8080"
+	r.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("got %v %q issuing a session token", w.Code, w.Body.String())
+	}
+	session := w.Body.String()
+
+	tests := []struct {
+		description string
+		method      string
+		target      string
+		host        string
+		headers     map[string]string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			"List Roles",
+			"GET",
+			"/latest/meta-data/iam/security-credentials/",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token": session},
+			http.StatusOK,
+			"Admin",
+		},
+		{
+			"Instance Credentials",
+			"GET",
+			"/latest/meta-data/iam/security-credentials/Admin",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token": session},
+			http.StatusOK,
+			`"Code":"Success","LastUpdated":"2026-01-02T03:04:05Z","Type":"AWS-HMAC","AccessKeyId":"AKIA","SecretAccessKey":"secret","Token":"session","Expiration":"2026-01-02T04:04:05Z"`,
+		},
+		{
+			"Unknown Role",
+			"GET",
+			"/latest/meta-data/iam/security-credentials/ReadOnly",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token": session},
+			http.StatusNotFound,
+			"not found",
+		},
+		{
+			"Region",
+			"GET",
+			"/latest/meta-data/placement/region",
+			"169.254.169.254",
+			map[string]string{"X-aws-ec2-metadata-token": session},
+			http.StatusOK,
+			"us-east-1",
+		},
+		{
+			"Identity Document",
+			"GET",
+			"/latest/dynamic/instance-identity/document",
+			"localhost:8080",
+			map[string]string{"X-aws-ec2-metadata-token": session},
+			http.StatusOK,
+			`"region":"us-east-1"`,
+		},
+		{
+			"IMDSv1 Refused",
+			"GET",
+			"/latest/meta-data/iam/security-credentials/Admin",
+			"127.0.0.1:8080",
+			nil,
+			http.StatusUnauthorized,
+			"unauthorized",
+		},
+		{
+			"Unknown Session Token",
+			"GET",
+			"/latest/meta-data/iam/security-credentials/Admin",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token": "forged"},
+			http.StatusUnauthorized,
+			"unauthorized",
+		},
+		{
+			"Token TTL Too Long",
+			"PUT",
+			"/latest/api/token",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "21601"},
+			http.StatusBadRequest,
+			"invalid",
+		},
+		{
+			"Container Credentials",
+			"GET",
+			ContainerCredentialsPath,
+			"127.0.0.1:8080",
+			map[string]string{"Authorization": "container-token"},
+			http.StatusOK,
+			`{"AccessKeyId":"AKIA","SecretAccessKey":"secret","Token":"session","Expiration":"2026-01-02T04:04:05Z"}`,
+		},
+		{
+			"Container Credentials Without Token",
+			"GET",
+			ContainerCredentialsPath,
+			"127.0.0.1:8080",
+			nil,
+			http.StatusUnauthorized,
+			"unauthorized",
+		},
+		{
+			"Foreign Host",
+			"GET",
+			ContainerCredentialsPath,
+			"attacker.example:8080",
+			map[string]string{"Authorization": "container-token"},
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Forwarded Request",
+			"PUT",
+			"/latest/api/token",
+			"127.0.0.1:8080",
+			map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60", "X-Forwarded-For": "10.0.0.1"},
+			http.StatusForbidden,
+			"forbidden",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.target, nil)
+			r.Host = test.host
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.wantStatus || !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("\ngot:\n  %v %q\nwanted:\n  %v %q", w.Code, w.Body.String(), test.wantStatus, test.wantBody)
+			}
+		})
+	}
+
+	if fetches != 2 {
+		t.Errorf("got %v credential fetches, wanted 2", fetches)
+	}
+
+	// session tokens expire
+	now = now.Add(2 * time.Minute)
+	r = httptest.NewRequest("GET", "/latest/meta-data/iam/security-credentials/", nil)
+	r.Host = "127.0.0.1:8080"
+	r.Header.Set("X-aws-ec2-metadata-token", session)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got %v with an expired session token, wanted %v", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestMetadataServerIMDSv1(t *testing.T) {
+	handler := NewMetadataServer(MetadataOptions{
+		Role:        "Admin",
+		AllowIMDSv1: true,
+		Credentials: func() (kion.STAK, error) {
+			return kion.STAK{}, errors.New("unable to reach Kion")
+		},
+	})
+
+	tests := []struct {
+		description string
+		target      string
+		token       string
+		wantStatus  int
+	}{
+		{"Without Token", "/latest/meta-data/iam/security-credentials", "", http.StatusOK},
+		{"With Unknown Token", "/latest/meta-data/iam/security-credentials", "forged", http.StatusUnauthorized},
+		{"No Region", "/latest/meta-data/placement/region", "", http.StatusNotFound},
+		{"Credential Error", "/latest/meta-data/iam/security-credentials/Admin", "", http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.target, nil)
+			r.Host = "localhost"
+			if test.token != "" {
+				r.Header.Set("X-aws-ec2-metadata-token", test.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.wantStatus {
+				t.Errorf("got %v %q, wanted %v", w.Code, w.Body.String(), test.wantStatus)
+			}
+			if w.Code == http.StatusBadGateway {
+				var body map[string]string
+				err := json.Unmarshal(w.Body.Bytes(), &body)
+				if err != nil || body["Message"] != "unable to reach Kion" {
+					t.Errorf("got error body %q, wanted the credential error", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataRoleName(t *testing.T) {
+	tests := []struct {
+		description string
+		car         string
+		want        string
+	}{
+		{"Valid", "Admin_Role-1", "Admin_Role-1"},
+		{"Spaces", "Read Only (Audit)", "Read-Only-Audit-"},
+		{"Empty", "", "kion"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := MetadataRoleName(test.car)
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Config Migrations                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ConfigMigration describes a single change made to bring a configuration
+// file up to date and the deprecation it resolves.
+type ConfigMigration struct {
+	Line        int
+	Description string
+	Deprecation Deprecation
+}
+
+// configEdit replaces text at a position within a configuration file.
+type configEdit struct {
+	line   int
+	column int
+	old    string
+	new    string
+
+	deprecation Deprecation
+}
+
+// MigrateConfig rewrites outdated keys and values in a configuration file.
+// Changes are made in place on the original text so comments and formatting
+// are preserved. The updated file and a description of each change are
+// returned, no changes are needed if the description is empty.
+func MigrateConfig(data []byte) ([]byte, []ConfigMigration, error) {
+	var root yamlv3.Node
+	err := yamlv3.Unmarshal(data, &root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yamlv3.MappingNode {
+		return data, nil, nil
+	}
+
+	// gather the edits for the default and any alternate profiles
+	var edits []configEdit
+	top := root.Content[0]
+	edits = append(edits, migrateProfile(top)...)
+	if profiles := mappingValue(top, "profiles"); profiles != nil && profiles.Kind == yamlv3.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			edits = append(edits, migrateProfile(profiles.Content[i])...)
+		}
+	}
+	if len(edits) == 0 {
+		return data, nil, nil
+	}
+
+	// apply edits right to left so earlier columns stay valid
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line < edits[j].line
+		}
+		return edits[i].column > edits[j].column
+	})
+	lines := strings.Split(string(data), "\n")
+	var migrations []ConfigMigration
+	for _, edit := range edits {
+		line := lines[edit.line-1]
+		start := edit.column - 1
+		offset := strings.Index(line[start:], edit.old)
+		if offset == -1 {
+			continue
+		}
+		start += offset
+		lines[edit.line-1] = line[:start] + edit.new + line[start+len(edit.old):]
+		migrations = append(migrations, ConfigMigration{
+			Line:        edit.line,
+			Description: fmt.Sprintf("%v is now %v", edit.old, edit.new),
+			Deprecation: edit.deprecation,
+		})
+	}
+
+	return []byte(strings.Join(lines, "\n")), migrations, nil
+}
+
+// migrateProfile returns the edits needed for a profile's kion section and
+// favorites. Outdated keys, including ones in the kion section written after
+// the matching flag names, are found in Deprecations and otherwise silently
+// ignored.
+func migrateProfile(profile *yamlv3.Node) []configEdit {
+	if profile.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	var edits []configEdit
+	if kion := mappingValue(profile, "kion"); kion != nil {
+		edits = append(edits, renameKeys(kion, "kion.")...)
+	}
+	if favorites := mappingValue(profile, "favorites"); favorites != nil && favorites.Kind == yamlv3.SequenceNode {
+		for _, fav := range favorites.Content {
+			edits = append(edits, renameKeys(fav, "favorites.")...)
+			accessType := mappingValue(fav, "access_type")
+			if accessType == nil || accessType.Kind != yamlv3.ScalarNode {
+				continue
+			}
+			setting := "favorites.access_type="
+			if deprecation, found := LookupDeprecation(Deprecations, DeprecatedConfigValue, setting+accessType.Value); found {
+				renamed := strings.TrimPrefix(deprecation.New, setting)
+				edits = append(edits, configEdit{accessType.Line, accessType.Column, accessType.Value, renamed, deprecation})
+			}
+		}
+	}
+
+	return edits
+}
+
+// renameKeys returns edits renaming outdated keys in a mapping found at path,
+// such as "kion.", skipping any whose current name is already present.
+func renameKeys(mapping *yamlv3.Node, path string) []configEdit {
+	if mapping.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	var edits []configEdit
+	for i := 0; i < len(mapping.Content); i += 2 {
+		key := mapping.Content[i]
+		deprecation, found := LookupDeprecation(Deprecations, DeprecatedConfigKey, path+key.Value)
+		if !found {
+			continue
+		}
+		current := strings.TrimPrefix(deprecation.New, path)
+		if mappingValue(mapping, current) != nil {
+			continue
+		}
+		edits = append(edits, configEdit{key.Line, key.Column, key.Value, current, deprecation})
+	}
+
+	return edits
+}
+
+// mappingValue returns the value for a key in a mapping node or nil if the
+// key is not present.
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	if mapping.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// PrintConfigDiff prints the lines that differ between two versions of a
+// configuration file, which must have the same number of lines as produced by
+// MigrateConfig.
+func PrintConfigDiff(w io.Writer, filename string, old []byte, new []byte) {
+	oldLines := strings.Split(string(old), "\n")
+	newLines := strings.Split(string(new), "\n")
+	for i := range oldLines {
+		if i >= len(newLines) || oldLines[i] == newLines[i] {
+			continue
+		}
+		fmt.Fprintf(w, "%v line %v\n", filename, i+1)
+		color.New(color.FgRed).Fprintf(w, "- %v\n", oldLines[i])
+		color.New(color.FgGreen).Fprintf(w, "+ %v\n", newLines[i])
+	}
+}
@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		description    string
+		config         string
+		want           string
+		wantMigrations []ConfigMigration
+	}{
+		{
+			"Current Config",
+			"kion:\n  url: https://kion.example\n",
+			"kion:\n  url: https://kion.example\n",
+			nil,
+		},
+		{
+			"Renamed Keys Keep Comments",
+			"kion:\n  # where kion lives\n  endpoint: https://kion.example # prod\n  user: jane\nfavorites:\n  - name: prod\n    car: Admin\n    access_type: \"console\"\n",
+			"kion:\n  # where kion lives\n  url: https://kion.example # prod\n  username: jane\nfavorites:\n  - name: prod\n    cloud_access_role: Admin\n    access_type: \"web\"\n",
+			[]ConfigMigration{
+				{3, "endpoint is now url", deprecation(t, DeprecatedConfigKey, "kion.endpoint")},
+				{4, "user is now username", deprecation(t, DeprecatedConfigKey, "kion.user")},
+				{7, "car is now cloud_access_role", deprecation(t, DeprecatedConfigKey, "favorites.car")},
+				{8, "console is now web", deprecation(t, DeprecatedConfigValue, "favorites.access_type=console")},
+			},
+		},
+		{
+			"Profiles",
+			"profiles:\n  dev:\n    kion:\n      token: abc\n",
+			"profiles:\n  dev:\n    kion:\n      api_key: abc\n",
+			[]ConfigMigration{
+				{4, "token is now api_key", deprecation(t, DeprecatedConfigKey, "kion.token")},
+			},
+		},
+		{
+			"Current Key Already Set",
+			"kion:\n  user: jane\n  username: john\n",
+			"kion:\n  user: jane\n  username: john\n",
+			nil,
+		},
+		{
+			"Two Edits On One Line",
+			"favorites:\n  - {name: prod, car: Admin, access_type: console}\n",
+			"favorites:\n  - {name: prod, cloud_access_role: Admin, access_type: web}\n",
+			[]ConfigMigration{
+				{2, "console is now web", deprecation(t, DeprecatedConfigValue, "favorites.access_type=console")},
+				{2, "car is now cloud_access_role", deprecation(t, DeprecatedConfigKey, "favorites.car")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, migrations, err := MigrateConfig([]byte(test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", string(got), test.want)
+			}
+			if !reflect.DeepEqual(migrations, test.wantMigrations) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", migrations, test.wantMigrations)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  AWS Organizations                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultOrganizationsRegion is where the AWS Organizations API is reached,
+// it is only served from one region per partition.
+const DefaultOrganizationsRegion = "us-east-1"
+
+// organizationsRequest calls an AWS Organizations API action, following
+// pagination and handing each page to fn.
+func organizationsRequest(stak kion.STAK, region string, action string, params map[string]any, fn func(body []byte) error) error {
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AWSOrganizationsV20161128." + action,
+	}
+	for {
+		payload, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		_, body, err := awsRequest(stak, region, "organizations", awsEndpoint("organizations", region)+"/", headers, payload)
+		if err != nil {
+			return err
+		}
+		err = fn(body)
+		if err != nil {
+			return fmt.Errorf("unexpected response to %v: %w", action, err)
+		}
+
+		var page struct {
+			NextToken string
+		}
+		err = json.Unmarshal(body, &page)
+		if err != nil || page.NextToken == "" {
+			return err
+		}
+		params["NextToken"] = page.NextToken
+	}
+}
+
+// OrganizationAccounts returns the tags and organizational unit path of every
+// account in an AWS Organization, keyed by account number, using short-term
+// access keys for the management account or a delegated administrator. OU
+// paths are the names of the units from the root down joined with slashes,
+// such as Workloads/Prod, and empty for accounts directly under the root.
+func OrganizationAccounts(stak kion.STAK, region string) (map[string]kion.AccountMetadata, error) {
+	var ids []string
+	err := organizationsRequest(stak, region, "ListAccounts", map[string]any{}, func(body []byte) error {
+		var page struct {
+			Accounts []struct {
+				ID string `json:"Id"`
+			}
+		}
+		err := json.Unmarshal(body, &page)
+		for _, account := range page.Accounts {
+			ids = append(ids, account.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ou names and parents are shared between accounts, look each up once
+	names := make(map[string]string)
+	parents := make(map[string]string)
+	parentOf := func(child string) (string, error) {
+		if parent, found := parents[child]; found {
+			return parent, nil
+		}
+		var parent string
+		err := organizationsRequest(stak, region, "ListParents", map[string]any{"ChildId": child}, func(body []byte) error {
+			var page struct {
+				Parents []struct {
+					ID   string `json:"Id"`
+					Type string
+				}
+			}
+			err := json.Unmarshal(body, &page)
+			for _, p := range page.Parents {
+				if p.Type == "ORGANIZATIONAL_UNIT" {
+					parent = p.ID
+				}
+			}
+			return err
+		})
+		parents[child] = parent
+		return parent, err
+	}
+	nameOf := func(ou string) (string, error) {
+		if name, found := names[ou]; found {
+			return name, nil
+		}
+		var unit struct {
+			OrganizationalUnit struct {
+				Name string
+			}
+		}
+		err := organizationsRequest(stak, region, "DescribeOrganizationalUnit", map[string]any{"OrganizationalUnitId": ou}, func(body []byte) error {
+			return json.Unmarshal(body, &unit)
+		})
+		names[ou] = unit.OrganizationalUnit.Name
+		return unit.OrganizationalUnit.Name, err
+	}
+
+	accounts := make(map[string]kion.AccountMetadata, len(ids))
+	for _, id := range ids {
+		var metadata kion.AccountMetadata
+		err := organizationsRequest(stak, region, "ListTagsForResource", map[string]any{"ResourceId": id}, func(body []byte) error {
+			var page struct {
+				Tags []struct {
+					Key   string
+					Value string
+				}
+			}
+			err := json.Unmarshal(body, &page)
+			for _, tag := range page.Tags {
+				if metadata.Tags == nil {
+					metadata.Tags = make(map[string]string)
+				}
+				metadata.Tags[tag.Key] = tag.Value
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var path []string
+		parent, err := parentOf(id)
+		for err == nil && parent != "" {
+			var name string
+			name, err = nameOf(parent)
+			path = append([]string{name}, path...)
+			if err == nil {
+				parent, err = parentOf(parent)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata.OUPath = strings.Join(path, "/")
+		accounts[id] = metadata
+	}
+
+	return accounts, nil
+}
+
+// AccountSearchTerms returns text an account can be searched for by in the
+// pickers besides its name and number: its OU path and tags, as key=value.
+func AccountSearchTerms(metadata kion.AccountMetadata) []string {
+	var terms []string
+	if metadata.OUPath != "" {
+		terms = append(terms, metadata.OUPath)
+	}
+	keys := make([]string, 0, len(metadata.Tags))
+	for key := range metadata.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		terms = append(terms, fmt.Sprintf("%v=%v", key, metadata.Tags[key]))
+	}
+	return terms
+}
@@ -0,0 +1,81 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestOrganizationAccounts(t *testing.T) {
+	// root r-1 holds ou-workloads which holds ou-prod, 111 is in ou-prod and
+	// 222 directly under the root
+	parents := map[string]string{"111111111111": "ou-prod", "222222222222": "r-1", "ou-prod": "ou-workloads", "ou-workloads": "r-1"}
+	names := map[string]string{"ou-prod": "Prod", "ou-workloads": "Workloads"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		var req map[string]string
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSOrganizationsV20161128.") {
+		case "ListAccounts":
+			// paginated, one account per page
+			if req["NextToken"] == "" {
+				fmt.Fprint(w, `{"Accounts": [{"Id": "111111111111"}], "NextToken": "page2"}`)
+				return
+			}
+			fmt.Fprint(w, `{"Accounts": [{"Id": "222222222222"}]}`)
+		case "ListTagsForResource":
+			if req["ResourceId"] == "111111111111" {
+				fmt.Fprint(w, `{"Tags": [{"Key": "team", "Value": "payments"}, {"Key": "env", "Value": "prod"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"Tags": []}`)
+		case "ListParents":
+			parent := parents[req["ChildId"]]
+			kind := "ORGANIZATIONAL_UNIT"
+			if strings.HasPrefix(parent, "r-") {
+				kind = "ROOT"
+			}
+			fmt.Fprintf(w, `{"Parents": [{"Id": %q, "Type": %q}]}`, parent, kind)
+		case "DescribeOrganizationalUnit":
+			fmt.Fprintf(w, `{"OrganizationalUnit": {"Id": %q, "Name": %q}}`, req["OrganizationalUnitId"], names[req["OrganizationalUnitId"]])
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	original := awsEndpoint
+	defer func() { awsEndpoint = original }()
+	awsEndpoint = func(service string, region string) string {
+		return server.URL
+	}
+
+	got, err := OrganizationAccounts(kion.STAK{AccessKey: "AKID", SecretAccessKey: "secret"}, DefaultOrganizationsRegion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]kion.AccountMetadata{
+		"111111111111": {Tags: map[string]string{"team": "payments", "env": "prod"}, OUPath: "Workloads/Prod"},
+		"222222222222": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+	wantTerms := []string{"Workloads/Prod", "env=prod", "team=payments"}
+	if terms := AccountSearchTerms(got["111111111111"]); !reflect.DeepEqual(terms, wantTerms) {
+		t.Errorf("got search terms %v, wanted %v", terms, wantTerms)
+	}
+}
@@ -1,16 +1,10 @@
 package helper
 
 import (
-	"bufio"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/user"
-	"path/filepath"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/kionsoftware/kion-cli/lib/kion"
@@ -22,14 +16,27 @@ import (
 //                                                                            //
 ////////////////////////////////////////////////////////////////////////////////
 
-// PrintSTAK prints out the short term access keys for AWS auth.
+// PrintSTAK prints out the short term access keys for AWS auth as statements
+// setting them in the shell, PowerShell on windows.
 func PrintSTAK(w io.Writer, stak kion.STAK, region string) error {
-	// handle windows vs linux for exports
-	var export string
-	if runtime.GOOS == "windows" {
-		export = "SET"
-	} else {
-		export = "export"
+	return printSTAKFor(w, runtime.GOOS, stak, region)
+}
+
+// printSTAKFor prints short term access keys for the shell of goos.
+func printSTAKFor(w io.Writer, goos string, stak kion.STAK, region string) error {
+	// powershell is the default shell on windows
+	if goos == "windows" {
+		var vars []string
+		if region != "" {
+			vars = append(vars, "AWS_REGION="+region)
+		}
+		vars = append(vars, "AWS_ACCESS_KEY_ID="+stak.AccessKey, "AWS_SECRET_ACCESS_KEY="+stak.SecretAccessKey, "AWS_SESSION_TOKEN="+stak.SessionToken)
+		exports, err := ShellExports("powershell", vars)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, exports)
+		return err
 	}
 
 	// conditionally print region
@@ -38,22 +45,66 @@ func PrintSTAK(w io.Writer, stak kion.STAK, region string) error {
 	}
 
 	// print the stak
-	fmt.Fprintf(w, "%v AWS_ACCESS_KEY_ID=%v\nexport AWS_SECRET_ACCESS_KEY=%v\nexport AWS_SESSION_TOKEN=%v\n", export, stak.AccessKey, stak.SecretAccessKey, stak.SessionToken)
+	fmt.Fprintf(w, "export AWS_ACCESS_KEY_ID=%v\nexport AWS_SECRET_ACCESS_KEY=%v\nexport AWS_SESSION_TOKEN=%v\n", stak.AccessKey, stak.SecretAccessKey, stak.SessionToken)
 
 	return nil
 }
 
+// Preflight describes what a stak or console request will use, shown before
+// the request is made so users can confirm favorites and defaults resolved as
+// expected.
+type Preflight struct {
+	Account     string
+	AccountName string
+	CAR         string
+	Access      string
+	Duration    string
+	Region      string
+	Cache       string
+	Data        string
+}
+
+// PrintPreflight prints the resolved details of a request.
+func PrintPreflight(w io.Writer, p Preflight) {
+	account := p.Account
+	if p.AccountName != "" {
+		account = fmt.Sprintf("%v (%v)", p.AccountName, p.Account)
+	}
+	region := p.Region
+	if region == "" {
+		region = "not set"
+	}
+
+	fmt.Fprintf(w, "Account:   %v\n", account)
+	fmt.Fprintf(w, "Role:      %v\n", p.CAR)
+	fmt.Fprintf(w, "Access:    %v\n", p.Access)
+	if p.Duration != "" {
+		fmt.Fprintf(w, "Duration:  %v\n", p.Duration)
+	}
+	fmt.Fprintf(w, "Region:    %v\n", region)
+	if p.Cache != "" {
+		fmt.Fprintf(w, "Cache:     %v\n", p.Cache)
+	}
+	if p.Data != "" {
+		fmt.Fprintf(w, "Data:      %v\n", p.Data)
+	}
+}
+
+// CredentialProcessOutput is the credential process format AWS defines. It is
+// versioned by AWS with Version rather than schema_version.
+type CredentialProcessOutput struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
 // PrintCredentialProcess prints out the short term access keys for use with
 // AWS profiles as a credential process subsystem.
 func PrintCredentialProcess(w io.Writer, stak kion.STAK) error {
 	// create the credentials struct
-	credentials := struct {
-		Version         int
-		AccessKeyId     string
-		SecretAccessKey string
-		SessionToken    string
-		Expiration      string
-	}{
+	credentials := CredentialProcessOutput{
 		1,
 		stak.AccessKey,
 		stak.SecretAccessKey,
@@ -73,125 +124,30 @@ func PrintCredentialProcess(w io.Writer, stak kion.STAK) error {
 	return nil
 }
 
-// SaveAWSCreds saves the short term access keys for AWS auth to the users AWS
-// configuration file.
-func SaveAWSCreds(stak kion.STAK, car kion.CAR) error {
-	// get the current user home directory.
-	user, err := user.Current()
-	if err != nil {
-		return err
-	}
-
-	// derive aws creds paths
-	awsCredsDir := filepath.Join(user.HomeDir, ".aws")
-	awsCredsFile := filepath.Join(user.HomeDir, ".aws/credentials")
-
-	// if the folder or file does not exist, create them
-	if _, err := os.Stat(awsCredsDir); os.IsNotExist(err) {
-		// create directory
-		errDir := os.MkdirAll(awsCredsDir, 0755)
-		if errDir != nil {
-			return err
-		}
-	}
-	if _, err := os.Stat(awsCredsFile); os.IsNotExist(err) {
-		err = os.WriteFile(awsCredsFile, []byte(""), 0600)
-		if err != nil {
-			return err
-		}
-	}
+// CredentialsFile returns an AWS shared credentials file with the short term
+// access keys set on the default profile.
+func CredentialsFile(stak kion.STAK) string {
+	return fmt.Sprintf("[default]\naws_access_key_id=%v\naws_secret_access_key=%v\naws_session_token=%v\n", stak.AccessKey, stak.SecretAccessKey, stak.SessionToken)
+}
 
-	// read in the creds file
-	contents, err := os.ReadFile(awsCredsFile)
+// SaveAWSCreds saves the short term access keys for AWS auth to the named
+// profile in the users AWS credentials file, telling the user how to use it on
+// w. A profile not written by Kion CLI is only replaced if replace is set.
+func SaveAWSCreds(w io.Writer, stak kion.STAK, profile string, replace bool) error {
+	awsCredsFile, err := SaveAWSProfile(profile, stak, replace)
 	if err != nil {
 		return err
 	}
 
-	// determine if the profile already exists
-	profileName := fmt.Sprintf("[%v_%v]", car.AccountNumber, car.AwsIamRoleName)
-	index := strings.Index(string(contents), profileName)
-
-	// append the profile if it does not exist, else update it
-	if index == -1 {
-		f, err := os.OpenFile(awsCredsFile, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-
-		linebreak := "\n"
-		if runtime.GOOS == "windows" {
-			linebreak = "\r\n"
-		}
-
-		text := ""
-		text += fmt.Sprintf(linebreak+"[%v_%v]"+linebreak, car.AccountNumber, car.AwsIamRoleName)
-		text += fmt.Sprintf("aws_access_key_id=%v"+linebreak, stak.AccessKey)
-		text += fmt.Sprintf("aws_secret_access_key=%v"+linebreak, stak.SecretAccessKey)
-		text += fmt.Sprintf("aws_session_token=%v"+linebreak, stak.SessionToken)
-
-		_, err = f.WriteString(text)
-		if err != nil {
-			return err
-		}
-
-		err = f.Close()
-		if err != nil {
-			return err
-		}
-	} else {
-		f, err := os.Open(awsCredsFile)
-		if err != nil {
-			return err
-		}
-
-		started := false
-
-		buf := ""
-
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			t := scanner.Text()
-			if strings.Contains(t, profileName) {
-				started = true
-				buf += fmt.Sprintln(t)
-				continue
-			}
-
-			if started {
-				if !strings.Contains(t, "=") {
-					started = false
-					buf += fmt.Sprintln(t)
-					continue
-				}
-
-				switch true {
-				case strings.Contains(t, "aws_access_key_id"):
-					buf += fmt.Sprintln("aws_access_key_id=" + stak.AccessKey)
-				case strings.Contains(t, "aws_secret_access_key"):
-					buf += fmt.Sprintln("aws_secret_access_key=" + stak.SecretAccessKey)
-				case strings.Contains(t, "aws_session_token"):
-					buf += fmt.Sprintln("aws_session_token=" + stak.SessionToken)
-				default:
-					return errors.New("there is a problem with the aws credentials file")
-				}
-				continue
-			}
-			buf += fmt.Sprintln(t)
-		}
-
-		if err := scanner.Err(); err != nil {
-			return err
-		}
-
-		err = os.WriteFile(awsCredsFile, []byte(buf), 0600)
-		if err != nil {
-			return err
-		}
-	}
-
-	fmt.Println("Credentials updated in the file:", awsCredsFile)
-	fmt.Printf("You can reference this profile using this flag: --profile %v_%v\n", car.AccountNumber, car.AwsIamRoleName)
-	fmt.Printf("Example command: aws s3 ls --profile %v_%v\n", car.AccountNumber, car.AwsIamRoleName)
+	fmt.Fprintln(w, "Credentials updated in the file:", awsCredsFile)
+	fmt.Fprintf(w, "You can reference this profile using this flag: --profile %v\n", profile)
+	fmt.Fprintf(w, "Example command: aws s3 ls --profile %v\n", profile)
 
 	return nil
 }
+
+// WriteAWSProfile writes the short term access keys to a profile named for
+// the account and role in the users AWS credentials file, returning its path.
+func WriteAWSProfile(stak kion.STAK, car kion.CAR) (string, error) {
+	return SaveAWSProfile(AWSProfileName(car), stak, true)
+}
@@ -58,7 +58,6 @@ func TestPrintSTAK(t *testing.T) {
 			"us-gov-west-1",
 			"export AWS_REGION=us-gov-west-1\nexport AWS_ACCESS_KEY_ID=ASIAABCDEFGHIJ1K23LM\nexport AWS_SECRET_ACCESS_KEY=aBCDeFg1hijkl2m3NOPqr4StUvWxY56z7abc8DEf\nexport AWS_SESSION_TOKEN=AbcDEFghIJKlMNoPQrStuVwXYZabcDEfGhI1JklmNoPQRStu2VWXYZaBcd34ef+GH+IJKLmNOPQRSTU5VwxyzABcdeFGHIj6KlMNoPQ7rSTUvW8X9yZAbCD0ef+gHIJkLMnoPqrstUVwxyzAb1CD2e34fgHiJKlMnOPqr56STuvwXyzABcdEfgh7IJK+8LM91No2pqrSTuvWxyz3ABCdEFGH4ijklMNOP5qrs6TUvWxyz789abcDefgH12iJKlM3no4pQRs+5t6UVw7/xy+ZaBcdE+FGhIj8kLmnOpqrstuvw9xyzab1cD/ef23GhIjkLMNoPQrstuv=\n",
 		},
-		// TODO: add test that would print SETs for windows
 	}
 
 	for _, test := range tests {
@@ -84,6 +83,17 @@ func TestPrintSTAK(t *testing.T) {
 	}
 }
 
+func TestPrintSTAKWindows(t *testing.T) {
+	stak := kion.STAK{AccessKey: "ASIAABCDEFGHIJ1K23LM", SecretAccessKey: "aBCDeFg1hijkl2m3", SessionToken: "AbcD+EF/gh="}
+	want := "$env:AWS_REGION = 'us-east-1'\n$env:AWS_ACCESS_KEY_ID = 'ASIAABCDEFGHIJ1K23LM'\n$env:AWS_SECRET_ACCESS_KEY = 'aBCDeFg1hijkl2m3'\n$env:AWS_SESSION_TOKEN = 'AbcD+EF/gh='\n"
+
+	var output bytes.Buffer
+	err := printSTAKFor(&output, "windows", stak, "us-east-1")
+	if err != nil || output.String() != want {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", output.String(), want)
+	}
+}
+
 func TestPrintCredentialProcess(t *testing.T) {
 	tests := []struct {
 		description string
@@ -152,3 +162,54 @@ func TestPrintCredentialProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintPreflight(t *testing.T) {
+	tests := []struct {
+		description string
+		preflight   Preflight
+		want        string
+	}{
+		{
+			"New STAK",
+			Preflight{
+				Account:     "111111111111",
+				AccountName: "Sandbox",
+				CAR:         "Admin",
+				Access:      "short-term access keys, printed to stdout",
+				Duration:    "set by Kion when issued",
+				Region:      "us-east-1",
+				Cache:       "no cached STAK, a new one will be requested",
+			},
+			"Account:   Sandbox (111111111111)\nRole:      Admin\nAccess:    short-term access keys, printed to stdout\nDuration:  set by Kion when issued\nRegion:    us-east-1\nCache:     no cached STAK, a new one will be requested\n",
+		},
+		{
+			"Web Console",
+			Preflight{
+				Account: "111111111111",
+				CAR:     "ReadOnly",
+				Access:  "web console",
+			},
+			"Account:   111111111111\nRole:      ReadOnly\nAccess:    web console\nRegion:    not set\n",
+		},
+		{
+			"Stale Data",
+			Preflight{
+				Account: "111111111111",
+				CAR:     "ReadOnly",
+				Access:  "web console",
+				Data:    "[stale data from 2024-06-01 12:00], Kion is unreachable",
+			},
+			"Account:   111111111111\nRole:      ReadOnly\nAccess:    web console\nRegion:    not set\nData:      [stale data from 2024-06-01 12:00], Kion is unreachable\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var output bytes.Buffer
+			PrintPreflight(&output, test.preflight)
+			if output.String() != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", output.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+
+	"gopkg.in/yaml.v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Configuration Overrides                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// overrideSecrets are configuration keys that can't be overridden on the
+// command line as they would be saved to shell history, mapped to the
+// environment variable to use instead.
+var overrideSecrets = map[string]string{
+	"password": "KION_PASSWORD",
+	"api_key":  "KION_API_KEY",
+}
+
+// ApplyConfigOverrides sets configuration keys for a single run from
+// overrides given as key=value, where the key is the dotted path of the
+// setting in the configuration file such as kion.browser or
+// profiles.work.kion.url. Values are parsed as yaml, so lists can be given
+// as [a, b] and an empty value clears the setting. Unknown keys and values of
+// the wrong type are rejected without changing the configuration.
+func ApplyConfigOverrides(config *structs.Configuration, overrides []string) error {
+	for _, override := range overrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found || key == "" {
+			return fmt.Errorf("invalid override %q, expected key=value", override)
+		}
+		path := strings.Split(key, ".")
+		if env, secret := overrideSecrets[path[len(path)-1]]; secret {
+			return fmt.Errorf("%v can't be overridden on the command line as it would be saved to shell history, use %v instead", key, env)
+		}
+
+		var parsed interface{}
+		err := yaml.Unmarshal([]byte(value), &parsed)
+		if err != nil {
+			return fmt.Errorf("invalid value for %v: %w", key, err)
+		}
+
+		// set the key in a generic copy of the configuration
+		data, err := yaml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		tree := make(map[interface{}]interface{})
+		err = yaml.Unmarshal(data, &tree)
+		if err != nil {
+			return err
+		}
+		err = setConfigKey(tree, path, parsed)
+		if err != nil {
+			return fmt.Errorf("unable to override %v: %w", key, err)
+		}
+
+		// decode it back strictly so unknown keys and bad types are caught
+		data, err = yaml.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		var updated structs.Configuration
+		err = yaml.UnmarshalStrict(data, &updated)
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("unable to override %v: %v", key, overrideErrors(typeErr))
+		}
+		if err != nil {
+			return fmt.Errorf("unable to override %v: %w", key, err)
+		}
+		*config = updated
+	}
+	return nil
+}
+
+// SplitProfileOverrides separates overrides of profile settings from the
+// rest, keeping their order. Profile overrides are applied before a profile
+// is switched to so they reach the profile in use, the rest after so they
+// win over it.
+func SplitProfileOverrides(overrides []string) (profiles []string, rest []string) {
+	for _, override := range overrides {
+		if strings.HasPrefix(override, "profiles.") {
+			profiles = append(profiles, override)
+		} else {
+			rest = append(rest, override)
+		}
+	}
+	return profiles, rest
+}
+
+// overrideErrors describes why an override was rejected, dropping the line
+// numbers yaml reports as they refer to the generated document rather than
+// anything the user wrote.
+func overrideErrors(err *yaml.TypeError) string {
+	var reasons []string
+	for _, reason := range err.Errors {
+		if _, rest, found := strings.Cut(reason, ": "); found && strings.HasPrefix(reason, "line ") {
+			reason = rest
+		}
+		reasons = append(reasons, reason)
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// setConfigKey sets the value at path in a tree of yaml maps, adding any
+// sections along the way that are missing.
+func setConfigKey(tree map[interface{}]interface{}, path []string, value interface{}) error {
+	for i, name := range path[:len(path)-1] {
+		switch child := tree[name].(type) {
+		case map[interface{}]interface{}:
+			tree = child
+		case nil:
+			section := make(map[interface{}]interface{})
+			tree[name] = section
+			tree = section
+		default:
+			return fmt.Errorf("%v is not a section", strings.Join(path[:i+1], "."))
+		}
+	}
+	tree[path[len(path)-1]] = value
+	return nil
+}
@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestApplyConfigOverrides(t *testing.T) {
+	base := func() structs.Configuration {
+		return structs.Configuration{
+			Kion: structs.Kion{Url: "https://kion.example", Password: "hunter2"},
+			Profiles: map[string]structs.Profile{
+				"work": {Kion: structs.Kion{Url: "https://work.example"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		description string
+		overrides   []string
+		want        func(*structs.Configuration)
+		wantErr     string
+	}{
+		{
+			"String",
+			[]string{"kion.browser=firefox"},
+			func(c *structs.Configuration) { c.Kion.Browser = "firefox" },
+			"",
+		},
+		{
+			"Bool and List",
+			[]string{"kion.disable_cache=true", "api.private_cidrs=[10.0.0.0/8, 172.16.0.0/12]"},
+			func(c *structs.Configuration) {
+				c.Kion.DisableCache = true
+				c.API.PrivateCIDRs = []string{"10.0.0.0/8", "172.16.0.0/12"}
+			},
+			"",
+		},
+		{
+			"Numeric String",
+			[]string{"kion.idms_id=2"},
+			func(c *structs.Configuration) { c.Kion.IDMS = "2" },
+			"",
+		},
+		{
+			"Value With Equals",
+			[]string{"kion.user_agent_suffix=team=platform"},
+			func(c *structs.Configuration) { c.Kion.UserAgentSuffix = "team=platform" },
+			"",
+		},
+		{
+			"Clear",
+			[]string{"kion.url="},
+			func(c *structs.Configuration) { c.Kion.Url = "" },
+			"",
+		},
+		{
+			"Profile",
+			[]string{"profiles.work.kion.url=https://other.example"},
+			func(c *structs.Configuration) {
+				c.Profiles["work"] = structs.Profile{Kion: structs.Kion{Url: "https://other.example"}}
+			},
+			"",
+		},
+		{"Unknown Key", []string{"kion.nope=1"}, nil, "field nope not found"},
+		{"Wrong Type", []string{"kion.disable_cache=sometimes"}, nil, "unable to override kion.disable_cache"},
+		{"Not A Section", []string{"kion.url.host=x"}, nil, "kion.url is not a section"},
+		{"Missing Value", []string{"kion.url"}, nil, "expected key=value"},
+		{"Secret", []string{"kion.password=hunter3"}, nil, "use KION_PASSWORD instead"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			config := base()
+			err := ApplyConfigOverrides(&config, test.overrides)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, wanted one containing %q", err, test.wantErr)
+				}
+				if !reflect.DeepEqual(config.Kion, base().Kion) {
+					t.Errorf("configuration changed despite the error: %+v", config.Kion)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// overriding round trips through yaml, leaving empty lists and maps
+			// rather than nil ones
+			want := base()
+			test.want(&want)
+			data, err := yaml.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = structs.Configuration{}
+			err = yaml.Unmarshal(data, &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, want) {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", config, want)
+			}
+		})
+	}
+}
+
+func TestSplitProfileOverrides(t *testing.T) {
+	tests := []struct {
+		description  string
+		overrides    []string
+		wantProfiles []string
+		wantRest     []string
+	}{
+		{"None", nil, nil, nil},
+		{
+			"Mixed",
+			[]string{"kion.browser=firefox", "profiles.work.kion.url=https://work.example", "api.insecure=true", "profiles.home.kion.browser=safari"},
+			[]string{"profiles.work.kion.url=https://work.example", "profiles.home.kion.browser=safari"},
+			[]string{"kion.browser=firefox", "api.insecure=true"},
+		},
+		{"Not A Profile", []string{"kion.profiles_dir=/tmp"}, nil, []string{"kion.profiles_dir=/tmp"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			profiles, rest := SplitProfileOverrides(test.overrides)
+			if !reflect.DeepEqual(profiles, test.wantProfiles) || !reflect.DeepEqual(rest, test.wantRest) {
+				t.Errorf("\ngot:\n  %v %v\nwanted:\n  %v %v", profiles, rest, test.wantProfiles, test.wantRest)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package helper
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	"github.com/urfave/cli/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Palette                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// PaletteRecentLimit is how many recently used cloud access roles the
+// palette offers.
+const PaletteRecentLimit = 10
+
+// PaletteAction is something kion palette can run, the command line it
+// stands for without the program name or global flags.
+type PaletteAction struct {
+	Label       string
+	Description string
+	Terms       []string
+	Args        []string
+}
+
+// PaletteFavorites returns an action using each favorite, described as for
+// completions with index.
+func PaletteFavorites(favorites []structs.Favorite, index CompletionIndex) []PaletteAction {
+	var actions []PaletteAction
+	for _, favorite := range favorites {
+		actions = append(actions, PaletteAction{
+			Label:       paletteLabel("favorite", favorite.Name),
+			Description: FavoriteDescription(favorite, index),
+			Terms:       []string{favorite.Account, favorite.AccountAlias, favorite.CAR},
+			Args:        []string{"favorite", favorite.Name},
+		})
+	}
+	return actions
+}
+
+// PaletteRecent returns actions repeating the most recent successful uses of
+// cloud access roles on the given Kion found in the audit log, newest first
+// and at most limit of them. Console access opens the console again and
+// anything else issues short-term access keys.
+func PaletteRecent(entries []AuditEntry, kionURL string, limit int, now time.Time) []PaletteAction {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b AuditEntry) int {
+		return b.Time.Compare(a.Time)
+	})
+
+	var actions []PaletteAction
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if len(actions) >= limit {
+			break
+		}
+		if entry.Kion != kionURL || entry.Failed() || entry.Account == "" || entry.CAR == "" {
+			continue
+		}
+		access := kion.AccessLevelCLI
+		if entry.AccessLevel == kion.AccessLevelWeb {
+			access = kion.AccessLevelWeb
+		}
+		action := paletteRole("recent", access, entry.Account, entry.CAR)
+		if seen[action.Label] {
+			continue
+		}
+		seen[action.Label] = true
+		action.Description = fmt.Sprintf("%v, used %v ago", action.Description, now.Sub(entry.Time).Round(time.Minute))
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// PaletteAccounts returns actions issuing short-term access keys for, and
+// opening the console of, each cloud access role on each account.
+func PaletteAccounts(cars []kion.CAR) []PaletteAction {
+	var actions []PaletteAction
+	for _, car := range cars {
+		for _, access := range []string{kion.AccessLevelCLI, kion.AccessLevelWeb} {
+			action := paletteRole("", access, car.AccountNumber, car.Name)
+			if car.AccountName != "" {
+				action.Description = fmt.Sprintf("%v on %v", action.Description, car.AccountName)
+				action.Terms = append(action.Terms, car.AccountName)
+			}
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// paletteRole returns an action issuing short-term access keys for, or with
+// web access opening the console of, a cloud access role on an account. Its
+// label starts with kind if given, such as recent.
+func paletteRole(kind string, access string, account string, carName string) PaletteAction {
+	verb, description := "keys", "short-term access keys"
+	args := []string{"stak", "--account", account, "--car", carName}
+	if access == kion.AccessLevelWeb {
+		verb, description = "console", "web console"
+		args = []string{"console", account + "/" + carName}
+	}
+
+	target := fmt.Sprintf("%v %v", account, carName)
+	label := paletteLabel(verb, target)
+	if kind != "" {
+		label = paletteLabel(kind, verb+" "+target)
+	}
+	return PaletteAction{Label: label, Description: description, Args: args}
+}
+
+// paletteLabel returns the label of an action of a kind, such as favorite or
+// command, with the kinds lined up in a column.
+func paletteLabel(kind string, text string) string {
+	return fmt.Sprintf("%-9v %v", kind, text)
+}
+
+// PaletteCommands returns an action running each command that does something
+// on its own, subcommands included, leaving out hidden commands and those
+// named in skip.
+func PaletteCommands(commands []*cli.Command, skip ...string) []PaletteAction {
+	var actions []PaletteAction
+	var walk func(commands []*cli.Command, parents []string)
+	walk = func(commands []*cli.Command, parents []string) {
+		for _, command := range commands {
+			if command.Hidden || slices.Contains(skip, command.Name) {
+				continue
+			}
+			path := append(slices.Clone(parents), command.Name)
+			if command.Action != nil {
+				actions = append(actions, PaletteAction{
+					Label:       paletteLabel("command", strings.Join(path, " ")),
+					Description: command.Usage,
+					Terms:       command.Aliases,
+					Args:        path,
+				})
+			}
+			walk(command.Subcommands, path)
+		}
+	}
+	walk(commands, nil)
+	return actions
+}
+
+// PromptPalette prompts the user to choose one of actions, typing to search
+// their labels, descriptions, and search terms. Actions sharing a label with
+// an earlier one are left out.
+func PromptPalette(actions []PaletteAction) (PaletteAction, error) {
+	var options []string
+	byLabel := make(map[string]PaletteAction)
+	descriptions := make(map[string]string)
+	terms := make(map[string][]string)
+	for _, action := range actions {
+		if _, found := byLabel[action.Label]; found {
+			continue
+		}
+		options = append(options, action.Label)
+		byLabel[action.Label] = action
+		descriptions[action.Label] = action.Description
+		terms[action.Label] = append([]string{action.Description}, action.Terms...)
+	}
+	if len(options) == 0 {
+		return PaletteAction{}, fmt.Errorf("nothing to choose from")
+	}
+
+	selection, err := PromptSelectSearch("What would you like to do?", options, descriptions, terms)
+	if err != nil {
+		return PaletteAction{}, err
+	}
+	return byLabel[selection], nil
+}
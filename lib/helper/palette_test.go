@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	"github.com/urfave/cli/v2"
+)
+
+// paletteLabels returns the labels of actions.
+func paletteLabels(actions []PaletteAction) []string {
+	var labels []string
+	for _, action := range actions {
+		labels = append(labels, action.Label)
+	}
+	return labels
+}
+
+func TestPaletteFavorites(t *testing.T) {
+	favorites := []structs.Favorite{{Name: "prod", Account: "111122223333", CAR: "Admin"}}
+	got := PaletteFavorites(favorites, CompletionIndex{})
+	want := []PaletteAction{{
+		Label:       "favorite  prod",
+		Description: "Admin on 111122223333",
+		Terms:       []string{"111122223333", "", "Admin"},
+		Args:        []string{"favorite", "prod"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
+
+func TestPaletteRecent(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	kionURL := "https://kion.example.com"
+	entries := []AuditEntry{
+		{Time: now.Add(-3 * time.Hour), Kion: kionURL, Account: "111", CAR: "Admin", AccessLevel: kion.AccessLevelCLI},
+		{Time: now.Add(-2 * time.Hour), Kion: kionURL, Account: "222", CAR: "ReadOnly", AccessLevel: kion.AccessLevelWeb},
+		{Time: now.Add(-time.Hour), Kion: kionURL, Account: "111", CAR: "Admin", AccessLevel: kion.AccessLevelCLI},
+		{Time: now.Add(-time.Hour), Kion: "https://other.example.com", Account: "333", CAR: "Admin"},
+		{Time: now.Add(-time.Minute), Kion: kionURL, Account: "444", CAR: "Admin", Result: AuditFailure},
+	}
+
+	tests := []struct {
+		description string
+		limit       int
+		want        []string
+	}{
+		{"All", 10, []string{"recent    keys 111 Admin", "recent    console 222 ReadOnly"}},
+		{"Limited", 1, []string{"recent    keys 111 Admin"}},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := PaletteRecent(entries, kionURL, test.limit, now)
+			if labels := paletteLabels(got); !reflect.DeepEqual(labels, test.want) {
+				t.Errorf("got %q, wanted %q", labels, test.want)
+			}
+		})
+	}
+
+	got := PaletteRecent(entries, kionURL, 10, now)
+	if want := []string{"console", "222/ReadOnly"}; !reflect.DeepEqual(got[1].Args, want) {
+		t.Errorf("got args %q, wanted %q", got[1].Args, want)
+	}
+	if want := "short-term access keys, used 1h0m0s ago"; got[0].Description != want {
+		t.Errorf("got description %q, wanted %q", got[0].Description, want)
+	}
+}
+
+func TestPaletteAccounts(t *testing.T) {
+	got := PaletteAccounts([]kion.CAR{{Name: "Payments Admin", AccountNumber: "111", AccountName: "payments"}})
+	want := []PaletteAction{
+		{
+			Label:       "keys      111 Payments Admin",
+			Description: "short-term access keys on payments",
+			Terms:       []string{"payments"},
+			Args:        []string{"stak", "--account", "111", "--car", "Payments Admin"},
+		},
+		{
+			Label:       "console   111 Payments Admin",
+			Description: "web console on payments",
+			Terms:       []string{"payments"},
+			Args:        []string{"console", "111/Payments Admin"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
+
+func TestPaletteCommands(t *testing.T) {
+	action := func(*cli.Context) error { return nil }
+	commands := []*cli.Command{
+		{Name: "stak", Aliases: []string{"s"}, Usage: "Get keys", Action: action},
+		{Name: "aws-config", Subcommands: []*cli.Command{
+			{Name: "sync", Usage: "Sync profiles", Action: action},
+		}},
+		{Name: "secret", Hidden: true, Action: action},
+		{Name: "palette", Action: action},
+	}
+
+	got := PaletteCommands(commands, "palette")
+	want := []PaletteAction{
+		{Label: "command   stak", Description: "Get keys", Terms: []string{"s"}, Args: []string{"stak"}},
+		{Label: "command   aws-config sync", Description: "Sync profiles", Args: []string{"aws-config", "sync"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
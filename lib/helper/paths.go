@@ -0,0 +1,225 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Paths                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Paths are where Kion CLI keeps its files.
+type Paths struct {
+	// Config is the configuration file.
+	Config string
+	// State is the directory of files that should outlive the cache, such as
+	// the audit log, device id, and SAML signing key.
+	State string
+	// Cache is the directory of the encrypted file cache, used when there is
+	// no system keychain.
+	Cache string
+}
+
+// LegacyPaths are where files were kept before following each platform's
+// conventions, a single configuration file and directory in the home
+// directory.
+func LegacyPaths(home string) Paths {
+	dir := filepath.Join(home, ".kion")
+	return Paths{
+		Config: filepath.Join(home, ".kion.yml"),
+		State:  dir,
+		Cache:  dir,
+	}
+}
+
+// DefaultPaths returns where files are kept on the given platform. Linux and
+// other unix systems follow the XDG base directory specification. macOS uses
+// Application Support and Caches under Library and Windows uses AppData,
+// though the XDG variables are honored on macOS when set.
+func DefaultPaths(goos string, home string, getenv func(string) string) Paths {
+	dir := func(env string, fallback ...string) string {
+		if value := getenv(env); value != "" && filepath.IsAbs(value) {
+			return filepath.Join(value, "kion")
+		}
+		return filepath.Join(append([]string{home}, append(fallback, "kion")...)...)
+	}
+
+	var configDir string
+	var paths Paths
+	switch goos {
+	case "windows":
+		appData := getenv("APPDATA")
+		if appData == "" {
+			appData = filepath.Join(home, "AppData", "Roaming")
+		}
+		localAppData := getenv("LOCALAPPDATA")
+		if localAppData == "" {
+			localAppData = filepath.Join(home, "AppData", "Local")
+		}
+		configDir = filepath.Join(appData, "kion")
+		paths.State = filepath.Join(localAppData, "kion")
+		paths.Cache = filepath.Join(localAppData, "kion", "cache")
+	case "darwin":
+		configDir = dir("XDG_CONFIG_HOME", "Library", "Application Support")
+		paths.State = dir("XDG_STATE_HOME", "Library", "Application Support")
+		paths.Cache = dir("XDG_CACHE_HOME", "Library", "Caches")
+	default:
+		configDir = dir("XDG_CONFIG_HOME", ".config")
+		paths.State = dir("XDG_STATE_HOME", ".local", "state")
+		paths.Cache = dir("XDG_CACHE_HOME", ".cache")
+	}
+	paths.Config = filepath.Join(configDir, "config.yml")
+
+	return paths
+}
+
+// envReference matches a %NAME% reference to an environment variable, as
+// cmd expands them.
+var envReference = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%`)
+
+// ExpandPath expands a leading ~ in path to home and, on windows, references
+// such as %USERPROFILE% to the environment variables they name. Shells don't
+// expand either in configuration files, nor Windows in variables set with
+// setx. References to unset variables are left as they are.
+func ExpandPath(goos string, path string, home string, getenv func(string) string) string {
+	if goos == "windows" {
+		path = envReference.ReplaceAllStringFunc(path, func(reference string) string {
+			if value := getenv(strings.Trim(reference, "%")); value != "" {
+				return value
+			}
+			return reference
+		})
+	}
+	if path == "~" {
+		return home
+	}
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		return filepath.Join(home, rest)
+	}
+	if rest, found := strings.CutPrefix(path, `~\`); found && goos == "windows" {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// ExpandConfigPaths expands the files and directories named in config, see
+// ExpandPath. The SAML metadata file is left alone when it is a URL.
+func ExpandConfigPaths(config *structs.Configuration, goos string, home string, getenv func(string) string) {
+	expand := func(paths ...*string) {
+		for _, path := range paths {
+			*path = ExpandPath(goos, *path, home, getenv)
+		}
+	}
+	if !strings.HasPrefix(config.Kion.SamlMetadataFile, "http") {
+		expand(&config.Kion.SamlMetadataFile)
+	}
+	expand(
+		&config.Kion.SamlSPKeyFile, &config.Kion.SamlSPCertFile,
+		&config.Kion.SamlCallbackCert, &config.Kion.SamlCallbackKey,
+		&config.Kion.Keyring.FileDir, &config.Kion.Keyring.PassDir,
+		&config.API.CABundle, &config.API.ClientCert, &config.API.ClientKey, &config.API.SSHIdentityFile,
+	)
+	for i := range config.Favorites {
+		expand(&config.Favorites[i].SessionPolicy)
+	}
+	for i := range config.Processors {
+		expand(&config.Processors[i].PolicyFile)
+	}
+}
+
+// legacyStateFiles are the files in the legacy directory that move to the
+// state directory, everything else there belongs to the encrypted file cache.
+var legacyStateFiles = []string{
+	"audit.log",
+	"device-id",
+	"browser-sessions.json",
+	"support",
+	"saml-sp-key.pem",
+	"saml-sp-cert.pem",
+}
+
+// PathMove records a file moved from a legacy location.
+type PathMove struct {
+	From string
+	To   string
+}
+
+// MigrateLegacyPaths moves files from their legacy locations to paths, so
+// upgrading is transparent. Nothing is replaced at the destination and
+// symlinks, such as a configuration file managed with other dotfiles, are
+// left alone, in which case the legacy location stays in use. The legacy
+// directory is removed once empty. The moves made are returned, along with
+// errors for any that could not be.
+func MigrateLegacyPaths(legacy Paths, paths Paths) ([]PathMove, error) {
+	var moves []PathMove
+	var errs []error
+	move := func(from string, to string) {
+		info, err := os.Lstat(from)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return
+		}
+		_, err = os.Lstat(to)
+		if err == nil {
+			return
+		}
+		err = os.MkdirAll(filepath.Dir(to), 0700)
+		if err == nil {
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to move %v to %v: %w", from, to, err))
+			return
+		}
+		moves = append(moves, PathMove{From: from, To: to})
+	}
+
+	move(legacy.Config, paths.Config)
+
+	info, err := os.Lstat(legacy.State)
+	if err == nil && info.IsDir() {
+		entries, err := os.ReadDir(legacy.State)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, entry := range entries {
+			to := filepath.Join(paths.Cache, entry.Name())
+			if slices.Contains(legacyStateFiles, entry.Name()) {
+				to = filepath.Join(paths.State, entry.Name())
+			}
+			move(filepath.Join(legacy.State, entry.Name()), to)
+		}
+
+		// only succeeds once everything has moved out
+		_ = os.Remove(legacy.State)
+	}
+
+	return moves, errors.Join(errs...)
+}
+
+// ActivePaths returns the paths to use after MigrateLegacyPaths. Legacy
+// locations still in place, such as symlinks or files that could not be
+// moved, keep being used so nothing is lost.
+func ActivePaths(legacy Paths, paths Paths) Paths {
+	active := paths
+	_, err := os.Stat(paths.Config)
+	if err != nil {
+		if _, err := os.Stat(legacy.Config); err == nil {
+			active.Config = legacy.Config
+		}
+	}
+	if _, err := os.Stat(legacy.State); err == nil {
+		active.State = legacy.State
+		active.Cache = legacy.Cache
+	}
+	return active
+}
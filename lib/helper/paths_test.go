@@ -0,0 +1,161 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	tests := []struct {
+		description string
+		goos        string
+		env         map[string]string
+		want        Paths
+	}{
+		{
+			"Linux",
+			"linux",
+			nil,
+			Paths{
+				Config: filepath.Join("/home/jane", ".config", "kion", "config.yml"),
+				State:  filepath.Join("/home/jane", ".local", "state", "kion"),
+				Cache:  filepath.Join("/home/jane", ".cache", "kion"),
+			},
+		},
+		{
+			"Linux XDG",
+			"linux",
+			map[string]string{"XDG_CONFIG_HOME": "/xdg/config", "XDG_STATE_HOME": "/xdg/state", "XDG_CACHE_HOME": "relative"},
+			Paths{
+				Config: filepath.Join("/xdg/config", "kion", "config.yml"),
+				State:  filepath.Join("/xdg/state", "kion"),
+				Cache:  filepath.Join("/home/jane", ".cache", "kion"),
+			},
+		},
+		{
+			"macOS",
+			"darwin",
+			nil,
+			Paths{
+				Config: filepath.Join("/home/jane", "Library", "Application Support", "kion", "config.yml"),
+				State:  filepath.Join("/home/jane", "Library", "Application Support", "kion"),
+				Cache:  filepath.Join("/home/jane", "Library", "Caches", "kion"),
+			},
+		},
+		{
+			"Windows",
+			"windows",
+			map[string]string{"APPDATA": "/appdata/roaming", "LOCALAPPDATA": "/appdata/local"},
+			Paths{
+				Config: filepath.Join("/appdata/roaming", "kion", "config.yml"),
+				State:  filepath.Join("/appdata/local", "kion"),
+				Cache:  filepath.Join("/appdata/local", "kion", "cache"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := DefaultPaths(test.goos, "/home/jane", func(name string) string { return test.env[name] })
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	env := map[string]string{"USERPROFILE": `C:\Users\jane`, "APPDATA": `C:\Users\jane\AppData\Roaming`}
+	tests := []struct {
+		description string
+		goos        string
+		path        string
+		want        string
+	}{
+		{"Home", "linux", "~/.kion/metadata.xml", filepath.Join("/home/jane", ".kion", "metadata.xml")},
+		{"Unix Leaves References", "linux", "%USERPROFILE%/ca.pem", "%USERPROFILE%/ca.pem"},
+		{"User Profile", "windows", `%USERPROFILE%\.kion.yml`, `C:\Users\jane\.kion.yml`},
+		{"App Data", "windows", `%APPDATA%\kion\ca.pem`, `C:\Users\jane\AppData\Roaming\kion\ca.pem`},
+		{"Unset Variable", "windows", `%KION_NOPE%\ca.pem`, `%KION_NOPE%\ca.pem`},
+		{"Windows Home", "windows", `~\ca.pem`, filepath.Join("/home/jane", "ca.pem")},
+		{"Absolute", "linux", "/etc/kion/ca.pem", "/etc/kion/ca.pem"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ExpandPath(test.goos, test.path, "/home/jane", func(name string) string { return env[name] })
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyPaths(t *testing.T) {
+	home := t.TempDir()
+	legacy := LegacyPaths(home)
+	paths := DefaultPaths("linux", home, func(string) string { return "" })
+
+	write := func(path string, content string) {
+		t.Helper()
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(legacy.Config, "kion: {}\n")
+	write(filepath.Join(legacy.State, "audit.log"), "{}\n")
+	write(filepath.Join(legacy.State, "support", "federation-1", "page.html"), "<html/>")
+	write(filepath.Join(legacy.State, "Kion-CLI Cache"), "encrypted")
+
+	moves, err := MigrateLegacyPaths(legacy, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 4 {
+		t.Errorf("got moves %+v, wanted 4", moves)
+	}
+	for _, path := range []string{
+		paths.Config,
+		filepath.Join(paths.State, "audit.log"),
+		filepath.Join(paths.State, "support", "federation-1", "page.html"),
+		filepath.Join(paths.Cache, "Kion-CLI Cache"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %v to exist: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(legacy.State); !os.IsNotExist(err) {
+		t.Errorf("expected the legacy directory to be removed: %v", err)
+	}
+	if got := ActivePaths(legacy, paths); !reflect.DeepEqual(got, paths) {
+		t.Errorf("got active paths %+v, wanted %+v", got, paths)
+	}
+
+	// a symlinked configuration and anything already moved are left alone
+	target := filepath.Join(home, "dotfiles", "kion.yml")
+	write(target, "kion: {}\n")
+	err = os.Remove(paths.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(target, legacy.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(legacy.State, "audit.log"), "{}\n")
+	moves, err = MigrateLegacyPaths(legacy, paths)
+	if err != nil || len(moves) != 0 {
+		t.Errorf("got moves %+v and error %v, wanted none", moves, err)
+	}
+	got := ActivePaths(legacy, paths)
+	want := Paths{Config: legacy.Config, State: legacy.State, Cache: legacy.Cache}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got active paths %+v, wanted %+v", got, want)
+	}
+}
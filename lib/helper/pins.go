@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Pinned Accounts                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// PinnedAccounts are the accounts pinned on this workstation, by account
+	// number. They are left out of the pickers and favorites using them are
+	// refused unless ForcePinned is set.
+	PinnedAccounts map[string]PinnedAccount
+
+	// ForcePinned lets pinned accounts be selected anyway. Set by the --force
+	// flag.
+	ForcePinned bool
+)
+
+// PinnedAccount is an account blocked from selection on this workstation with
+// kion pin, such as one under legal hold.
+type PinnedAccount struct {
+	Reason string    `json:"reason,omitempty"`
+	Pinned time.Time `json:"pinned"`
+}
+
+// ReadPins returns the pinned accounts in the file at path, by account number.
+// A missing file pins none.
+func ReadPins(path string) (map[string]PinnedAccount, error) {
+	pins := make(map[string]PinnedAccount)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &pins)
+	return pins, err
+}
+
+// WritePins stores the pinned accounts at path, readable only by the user.
+func WritePins(path string, pins map[string]PinnedAccount) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// IsPinned reports whether an account is pinned, whether or not ForcePinned
+// is set.
+func IsPinned(account string) bool {
+	_, found := PinnedAccounts[account]
+	return found
+}
+
+// CheckPinned returns an error if an account is pinned, unless ForcePinned is
+// set. name is what was selected, such as a favorite, for the message.
+func CheckPinned(account string, name string) error {
+	pin, found := PinnedAccounts[account]
+	if !found || ForcePinned {
+		return nil
+	}
+	reason := ""
+	if pin.Reason != "" {
+		reason = fmt.Sprintf(" (%v)", pin.Reason)
+	}
+	return fmt.Errorf("%v uses account %v, which is pinned on this workstation%v, pass --force to use it anyway or run kion unpin %v", name, account, reason, account)
+}
+
+// FilterPinnedAccounts returns the accounts that aren't pinned, or all of them
+// if ForcePinned is set.
+func FilterPinnedAccounts(accounts []kion.Account) []kion.Account {
+	if len(PinnedAccounts) == 0 || ForcePinned {
+		return accounts
+	}
+	var filtered []kion.Account
+	for _, account := range accounts {
+		if !IsPinned(account.Number) {
+			filtered = append(filtered, account)
+		}
+	}
+	return filtered
+}
+
+// FilterPinnedCARs returns the cloud access roles on accounts that aren't
+// pinned, or all of them if ForcePinned is set.
+func FilterPinnedCARs(cars []kion.CAR) []kion.CAR {
+	if len(PinnedAccounts) == 0 || ForcePinned {
+		return cars
+	}
+	var filtered []kion.CAR
+	for _, car := range cars {
+		if !IsPinned(car.AccountNumber) {
+			filtered = append(filtered, car)
+		}
+	}
+	return filtered
+}
+
+// FilterPinnedFavorites returns the favorites that don't name a pinned
+// account, or all of them if ForcePinned is set. Favorites matching accounts
+// by glob or alias are kept as their account isn't known until resolved.
+func FilterPinnedFavorites(favorites []structs.Favorite) []structs.Favorite {
+	if len(PinnedAccounts) == 0 || ForcePinned {
+		return favorites
+	}
+	var filtered []structs.Favorite
+	for _, favorite := range favorites {
+		if !IsPinned(favorite.Account) {
+			filtered = append(filtered, favorite)
+		}
+	}
+	return filtered
+}
+
+// PinOutput is the structured form of a pinned account.
+type PinOutput struct {
+	Account string `json:"account" yaml:"account"`
+	Pinned  string `json:"pinned" yaml:"pinned"`
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// NewPinOutputs returns the structured form of pinned accounts, sorted by
+// account number.
+func NewPinOutputs(pins map[string]PinnedAccount) []PinOutput {
+	outputs := []PinOutput{}
+	for account, pin := range pins {
+		outputs = append(outputs, PinOutput{
+			Account: account,
+			Pinned:  pin.Pinned.UTC().Format(time.RFC3339),
+			Reason:  pin.Reason,
+		})
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Account < outputs[j].Account
+	})
+	return outputs
+}
+
+// PrintPins prints pinned accounts as a table.
+func PrintPins(w io.Writer, pins []PinOutput) error {
+	if len(pins) == 0 {
+		_, err := fmt.Fprintln(w, "No accounts are pinned.")
+		return err
+	}
+	table := NewTable("ACCOUNT", "PINNED", "REASON")
+	for _, pin := range pins {
+		table.AddRow(pin.Account, pin.Pinned, pin.Reason)
+	}
+	return table.Write(w)
+}
@@ -0,0 +1,116 @@
+package helper
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+// withPins pins accounts for the duration of a test.
+func withPins(t *testing.T, pins map[string]PinnedAccount, force bool) {
+	t.Helper()
+	original, originalForce := PinnedAccounts, ForcePinned
+	t.Cleanup(func() {
+		PinnedAccounts, ForcePinned = original, originalForce
+	})
+	PinnedAccounts, ForcePinned = pins, force
+}
+
+func TestPinsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "pinned-accounts.json")
+	pins, err := ReadPins(path)
+	if err != nil || len(pins) != 0 {
+		t.Fatalf("got %v, %v reading a missing file, wanted no pins", pins, err)
+	}
+
+	pinned := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	want := map[string]PinnedAccount{"111122223333": {Reason: "legal hold", Pinned: pinned}}
+	err = WritePins(path, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins, err = ReadPins(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pins, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", pins, want)
+	}
+}
+
+func TestCheckPinned(t *testing.T) {
+	pins := map[string]PinnedAccount{
+		"111122223333": {Reason: "legal hold"},
+		"444455556666": {},
+	}
+
+	tests := []struct {
+		description string
+		account     string
+		force       bool
+		wantErr     string
+	}{
+		{"Not Pinned", "777788889999", false, ""},
+		{"Pinned With Reason", "111122223333", false, "pinned on this workstation (legal hold)"},
+		{"Pinned", "444455556666", false, "pinned on this workstation, pass --force"},
+		{"Forced", "111122223333", true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			withPins(t, pins, test.force)
+			err := CheckPinned(test.account, "favorite prod")
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v, wanted none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, wanted one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterPinned(t *testing.T) {
+	pins := map[string]PinnedAccount{"111122223333": {}}
+	accounts := []kion.Account{{Number: "111122223333"}, {Number: "444455556666"}}
+	cars := []kion.CAR{{Name: "Admin", AccountNumber: "111122223333"}, {Name: "Admin", AccountNumber: "444455556666"}}
+	favorites := []structs.Favorite{{Name: "held", Account: "111122223333"}, {Name: "dev", Account: "444455556666"}, {Name: "any", Account: "1111*"}}
+
+	tests := []struct {
+		description   string
+		force         bool
+		wantAccounts  int
+		wantCARs      int
+		wantFavorites []string
+	}{
+		{"Pinned Left Out", false, 1, 1, []string{"dev", "any"}},
+		{"Forced", true, 2, 2, []string{"held", "dev", "any"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			withPins(t, pins, test.force)
+			if got := FilterPinnedAccounts(accounts); len(got) != test.wantAccounts {
+				t.Errorf("got %v accounts, wanted %v", len(got), test.wantAccounts)
+			}
+			if got := FilterPinnedCARs(cars); len(got) != test.wantCARs {
+				t.Errorf("got %v cloud access roles, wanted %v", len(got), test.wantCARs)
+			}
+			var names []string
+			for _, favorite := range FilterPinnedFavorites(favorites) {
+				names = append(names, favorite.Name)
+			}
+			if !reflect.DeepEqual(names, test.wantFavorites) {
+				t.Errorf("got favorites %v, wanted %v", names, test.wantFavorites)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Progress                                                                  //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ErrCanceled is returned by WithProgress when the user interrupts the
+// operation.
+var ErrCanceled = errors.New("operation canceled")
+
+// spinnerFrames are drawn in turn while an operation is running.
+var spinnerFrames = []string{"-", "\\", "|", "/"}
+
+// spinnerInterval is how often the spinner is redrawn. Operations finishing
+// before the first redraw never draw anything.
+const spinnerInterval = 100 * time.Millisecond
+
+// Progress reports the status of a long running operation. On a terminal a
+// spinner is drawn with the current message and a percentage when a total is
+// known, otherwise each message is logged on its own line so milestones still
+// show up in logs.
+type Progress struct {
+	w        io.Writer
+	tty      bool
+	mu       sync.Mutex
+	message  string
+	total    int
+	current  int
+	deadline time.Time
+	drawn    bool
+	ctx      context.Context
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewProgress starts reporting progress to w, drawing a spinner if tty is
+// true. Stop must be called when the operation finishes.
+func NewProgress(w io.Writer, tty bool, message string) *Progress {
+	p := &Progress{
+		w:    w,
+		tty:  tty,
+		ctx:  context.Background(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	p.Update(message)
+	go p.run()
+	return p
+}
+
+// StartProgress starts reporting progress on stderr, restricted to ASCII if
+// ASCIIOutput is set. With AccessibleOutput each step is written on its own
+// line rather than redrawing a spinner.
+func StartProgress(message string) *Progress {
+	var w io.Writer = os.Stderr
+	if ASCIIOutput {
+		w = NewASCIIWriter(os.Stderr)
+	}
+	return NewProgress(w, term.IsTerminal(int(os.Stderr.Fd())) && !AccessibleOutput, message)
+}
+
+// Update changes the message describing the current step.
+func (p *Progress) Update(message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.message = message
+	if !p.tty {
+		fmt.Fprintf(p.w, "%v...\n", message)
+	}
+}
+
+// SetTotal sets the number of steps the operation will take so a percentage
+// can be shown.
+func (p *Progress) SetTotal(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// SetDeadline shows the time left until deadline alongside the spinner, such
+// as while waiting on the user. Without a terminal it is noted once.
+func (p *Progress) SetDeadline(deadline time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadline = deadline
+	if !p.tty {
+		fmt.Fprintf(p.w, "Giving up at %v\n", deadline.Local().Format(time.Kitchen))
+	}
+}
+
+// Increment marks a step as complete.
+func (p *Progress) Increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current++
+}
+
+// Context is done once the operation should give up, such as when the user
+// interrupts WithProgress.
+func (p *Progress) Context() context.Context {
+	return p.ctx
+}
+
+// Writer returns a writer for messages shown while the operation runs, such
+// as a URL to visit. On a terminal the spinner is cleared before each write
+// and redrawn below it, so it never draws over the message.
+func (p *Progress) Writer() io.Writer {
+	return progressWriter{p}
+}
+
+// progressWriter writes messages around the spinner of a Progress.
+type progressWriter struct {
+	p *Progress
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	if w.p.drawn {
+		fmt.Fprint(w.p.w, "\r\033[K")
+		w.p.drawn = false
+	}
+	return w.p.w.Write(b)
+}
+
+// Stop stops reporting progress and clears the spinner. It is safe to call
+// more than once.
+func (p *Progress) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+}
+
+// run redraws the spinner until stopped.
+func (p *Progress) run() {
+	defer close(p.done)
+	if !p.tty {
+		<-p.stop
+		return
+	}
+
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		select {
+		case <-p.stop:
+			p.mu.Lock()
+			if p.drawn {
+				fmt.Fprint(p.w, "\r\033[K")
+				p.drawn = false
+			}
+			p.mu.Unlock()
+			return
+		case <-ticker.C:
+			p.draw(spinnerFrames[frame%len(spinnerFrames)])
+		}
+	}
+}
+
+// draw renders a single spinner frame over the current line.
+func (p *Progress) draw(frame string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line := fmt.Sprintf("%v %v", frame, p.message)
+	if p.total > 0 {
+		line += fmt.Sprintf(" %v/%v (%v%%)", p.current, p.total, p.current*100/p.total)
+	}
+	if !p.deadline.IsZero() {
+		line += fmt.Sprintf(" (%v left)", max(time.Until(p.deadline), 0).Round(time.Second))
+	}
+	fmt.Fprintf(p.w, "\r\033[K%v", line)
+	p.drawn = true
+}
+
+// WithProgress runs fn while reporting progress on stderr. If ctx is done or
+// the user interrupts before fn returns, the spinner is stopped and
+// p.Context() is canceled, then fn is still waited on so it never outlives
+// the call; a second interrupt exits as usual. Never call prompts from fn.
+func WithProgress(ctx context.Context, message string, fn func(p *Progress) error) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	p := StartProgress(message)
+	p.ctx = ctx
+	defer p.Stop()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- fn(p)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		stop()
+		p.Stop()
+		<-result
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return ErrCanceled
+		}
+		return ctx.Err()
+	}
+}
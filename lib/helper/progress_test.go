@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the spinner goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		description string
+		tty         bool
+		wait        time.Duration
+		want        []string
+		notWant     []string
+	}{
+		{
+			"Logs Milestones Without Terminal",
+			false,
+			3 * spinnerInterval,
+			[]string{"Fetching...\n", "Checking...\n"},
+			[]string{"\r"},
+		},
+		{
+			"Quick Operation Draws Nothing",
+			true,
+			0,
+			nil,
+			[]string{"Fetching", "Checking"},
+		},
+		{
+			"Spinner With Percentage",
+			true,
+			3 * spinnerInterval,
+			[]string{"Checking 1/4 (25%)", "\r\033[K"},
+			[]string{"Fetching...\n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out syncBuffer
+			p := NewProgress(&out, test.tty, "Fetching")
+			p.SetTotal(4)
+			p.Increment()
+			p.Update("Checking")
+			time.Sleep(test.wait)
+			p.Stop()
+			p.Stop()
+
+			got := out.String()
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output %q does not contain %q", got, want)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("output %q should not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressDeadline(t *testing.T) {
+	var out syncBuffer
+	p := NewProgress(&out, true, "Waiting")
+	p.SetDeadline(time.Now().Add(2 * time.Minute))
+	time.Sleep(3 * spinnerInterval)
+	p.Stop()
+	if got := out.String(); !strings.Contains(got, "Waiting (2m0s left)") && !strings.Contains(got, "Waiting (1m59s left)") {
+		t.Errorf("output %q does not show the time left", got)
+	}
+
+	out = syncBuffer{}
+	p = NewProgress(&out, false, "Waiting")
+	p.SetDeadline(time.Now().Add(2 * time.Minute))
+	p.Stop()
+	if got := out.String(); !strings.Contains(got, "Giving up at ") {
+		t.Errorf("output %q does not note the deadline", got)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	failure := errors.New("failed")
+	err := WithProgress(context.Background(), "Working", func(p *Progress) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, wanted %v", err, failure)
+	}
+
+	// canceling tells the operation to give up and waits for it to
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	finished := false
+	err = WithProgress(ctx, "Working", func(p *Progress) error {
+		<-p.Context().Done()
+		time.Sleep(spinnerInterval)
+		finished = true
+		return nil
+	})
+	if !errors.Is(err, ErrCanceled) {
+		t.Errorf("got %v, wanted %v", err, ErrCanceled)
+	}
+	if !finished {
+		t.Error("returned before the operation finished")
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var out syncBuffer
+	p := NewProgress(&out, true, "Waiting")
+	time.Sleep(3 * spinnerInterval)
+	fmt.Fprintf(p.Writer(), "Visit this URL to authenticate:\n%v\n", "https://idp.example.com")
+	p.Stop()
+
+	// the spinner line is cleared before the message and redrawn after it
+	got := out.String()
+	i := strings.Index(got, "Visit this URL")
+	if i < 0 || !strings.HasSuffix(got[:i], "Waiting\r\033[K") {
+		t.Errorf("output %q does not clear the spinner before the message", got)
+	}
+}
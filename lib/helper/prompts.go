@@ -1,6 +1,16 @@
 package helper
 
-import "github.com/AlecAivazis/survey/v2"
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"golang.org/x/term"
+)
 
 ////////////////////////////////////////////////////////////////////////////////
 //                                                                            //
@@ -14,34 +24,205 @@ var surveyFormat = survey.WithIcons(func(icons *survey.IconSet) {
 	icons.Question.Format = "default+hb"
 })
 
+// NoInteractive stops the user from ever being prompted, as though there were
+// no terminal, so runs in CI fail rather than wait on input or a browser. Set
+// by the --no-interactive flag.
+var NoInteractive bool
+
+// ErrNoInteractive is returned in place of prompting when NoInteractive is
+// set.
+var ErrNoInteractive = errors.New("input is needed but --no-interactive is set")
+
+// askOne asks a single survey question, drawing it through an ASCIIFile when
+// ASCIIOutput is set.
+func askOne(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+	if NoInteractive {
+		return ErrNoInteractive
+	}
+	opts = append(opts, surveyFormat)
+	if ASCIIOutput {
+		opts = append(opts, survey.WithStdio(os.Stdin, NewASCIIFile(os.Stdout), NewASCIIWriter(os.Stderr)))
+	}
+	return survey.AskOne(prompt, response, opts...)
+}
+
 // PromptSelect prompts the user to select from a slice of options. It requires
-// that the selection made be one of the options provided.
+// that the selection made be one of the options provided. Typing filters the
+// options fuzzily, see fuzzyMatch. With AccessibleOutput the options are a
+// numbered list instead.
 func PromptSelect(message string, options []string) (string, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().selectOne(message, options, nil, nil)
+	}
+	selection := ""
+	prompt := &survey.Select{
+		Message:  message,
+		Options:  options,
+		PageSize: selectPageSize(len(options)),
+		Filter: func(filter string, value string, index int) bool {
+			return matchesSearch(filter, value, nil)
+		},
+	}
+	err := askOne(prompt, &selection)
+	return selection, err
+}
+
+// PromptSelectSearch prompts the user to select from a slice of options like
+// PromptSelect, but typing to filter also matches each option's search terms,
+// and its description, if any, is shown alongside it.
+func PromptSelectSearch(message string, options []string, descriptions map[string]string, terms map[string][]string) (string, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().selectOne(message, options, descriptions, terms)
+	}
 	selection := ""
 	prompt := &survey.Select{
+		Message:  message,
+		Options:  options,
+		PageSize: selectPageSize(len(options)),
+		Description: func(value string, index int) string {
+			return descriptions[value]
+		},
+		Filter: func(filter string, value string, index int) bool {
+			return matchesSearch(filter, value, terms[value])
+		},
+	}
+	err := askOne(prompt, &selection)
+	return selection, err
+}
+
+// matchesSearch reports whether each word of filter fuzzily matches an option
+// or any of its search terms, see fuzzyMatch.
+func matchesSearch(filter string, option string, terms []string) bool {
+	texts := append([]string{option}, terms...)
+	for _, word := range strings.Fields(filter) {
+		matched := false
+		for _, text := range texts {
+			if fuzzyMatch(word, text) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzyMatch reports whether the characters of word appear in text in order,
+// though not necessarily together, ignoring case, so "dlprd" matches "Data
+// Lake (Prod)".
+func fuzzyMatch(word string, text string) bool {
+	remaining := []rune(strings.ToLower(word))
+	for _, r := range strings.ToLower(text) {
+		if len(remaining) == 0 {
+			break
+		}
+		if r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
+
+// minPageSize is the fewest options a select prompt shows at once, survey's
+// default.
+const minPageSize = 7
+
+// selectPageSize returns how many of count options a select prompt shows at
+// once, as many as fit the terminal so long lists need less scrolling.
+func selectPageSize(count int) int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return minPageSize
+	}
+	// leave room for the question, the filter help, and the prompt before it
+	size := min(count, height-4)
+	return max(size, minPageSize)
+}
+
+// PromptMultiSelect prompts the user to select any number of options, with
+// those in defaults selected to start. Space toggles an option, the right and
+// left arrows select all or none of the options shown, and typing filters
+// them.
+func PromptMultiSelect(message string, options []string, defaults []string) ([]string, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().selectMany(message, options, defaults)
+	}
+	var selection []string
+	prompt := &survey.MultiSelect{
 		Message: message,
 		Options: options,
+		Default: defaults,
+		Help:    "space to toggle, right arrow to select all, left arrow to select none, type to filter",
 	}
-	err := survey.AskOne(prompt, &selection, surveyFormat)
+	err := askOne(prompt, &selection)
 	return selection, err
 }
 
 // PromptInput prompts the user to provide dynamic input.
 func PromptInput(message string) (string, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().input(message)
+	}
 	var input string
 	pi := &survey.Input{
 		Message: message,
 	}
-	err := survey.AskOne(pi, &input, surveyFormat, survey.WithValidator(survey.Required))
+	err := askOne(pi, &input, survey.WithValidator(survey.Required))
 	return input, err
 }
 
 // PromptPassword prompts the user to provide sensitive dynamic input.
 func PromptPassword(message string) (string, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().password(message)
+	}
 	var input string
 	pi := &survey.Password{
 		Message: message,
 	}
-	err := survey.AskOne(pi, &input, surveyFormat, survey.WithValidator(survey.Required))
+	err := askOne(pi, &input, survey.WithValidator(survey.Required))
 	return input, err
 }
+
+// PromptConfirm prompts the user to answer yes or no, defaulting to no.
+func PromptConfirm(message string) (bool, error) {
+	defer kion.Timings.Time(kion.PhaseInput, message)()
+	if AccessibleOutput {
+		return newAccessiblePrompter().confirm(message)
+	}
+	confirmed := false
+	prompt := &survey.Confirm{
+		Message: message,
+	}
+	err := askOne(prompt, &confirmed)
+	return confirmed, err
+}
+
+// IsInteractive reports whether the user can be prompted for input. Prompts
+// require both stdin and stdout be attached to a terminal, and NoInteractive
+// be unset.
+func IsInteractive() bool {
+	return !NoInteractive && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// ReadPassword reads a password from the first line of r, as when piped to
+// stdin or passed on a file descriptor, so it never appears in process
+// listings. Trailing line endings are removed.
+func ReadPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password provided on input")
+	}
+	return password, nil
+}
@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPassword(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        string
+		wantErr     bool
+	}{
+		{
+			"Newline Terminated",
+			"hunter2\n",
+			"hunter2",
+			false,
+		},
+		{
+			"CRLF Terminated",
+			"hunter2\r\n",
+			"hunter2",
+			false,
+		},
+		{
+			"No Newline",
+			"hunter2",
+			"hunter2",
+			false,
+		},
+		{
+			"Only First Line",
+			"hunter2\nextra\n",
+			"hunter2",
+			false,
+		},
+		{
+			"Keeps Spaces",
+			" pass word \n",
+			" pass word ",
+			false,
+		},
+		{
+			"Empty",
+			"",
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ReadPassword(strings.NewReader(test.input))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchesSearch(t *testing.T) {
+	terms := []string{"Workloads/Prod", "team=payments"}
+	tests := []struct {
+		description string
+		filter      string
+		want        bool
+	}{
+		{"Option", "sandbox", true},
+		{"Ignores Case", "SANDBOX", true},
+		{"Tag", "payments", true},
+		{"Tag Key And Value", "team=pay", true},
+		{"OU Path", "workloads/", true},
+		{"No Match", "billing", false},
+		{"Fuzzy", "sndbx", true},
+		{"Words Across Terms", "sand pay", true},
+		{"Every Word Must Match", "sand billing", false},
+		{"Out Of Order", "xodbnas", false},
+		{"Empty", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := matchesSearch(test.filter, "Sandbox (111111111111)", terms); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
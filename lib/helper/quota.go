@@ -0,0 +1,189 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Quota                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// quotaRetries is how many times a request turned away for exceeding the
+// rate limit is tried again once the quota resets.
+const quotaRetries = 3
+
+// QuotaPacer spaces out the requests of a bulk operation so they stay within
+// the rate limit Kion reports instead of failing part way through. Requests
+// are let through at once until Kion reports its quota running low.
+type QuotaPacer struct {
+	mu   sync.Mutex
+	next time.Time
+
+	// quota returns the latest quota Kion reported, kion.LastQuota if unset
+	quota func() (kion.Quota, bool)
+
+	// notify is called with the wait before a paced request, if set
+	notify func(wait time.Duration)
+}
+
+// NewQuotaPacer returns a pacer following the quota Kion reports, calling
+// notify before each request it holds back.
+func NewQuotaPacer(notify func(wait time.Duration)) *QuotaPacer {
+	return &QuotaPacer{quota: kion.LastQuota, notify: notify}
+}
+
+// Wait blocks until the next request may be sent, returning early with the
+// context's error if it is canceled. It is safe to call from several
+// goroutines, each being given its own slot.
+func (p *QuotaPacer) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	start := now
+	if p.next.After(start) {
+		start = p.next
+	}
+	var pace time.Duration
+	if quota, found := p.quota(); found {
+		// nothing is left until the reset, after which the quota is whole
+		if quota.Remaining <= 0 && quota.Reset.After(start) {
+			start = quota.Reset
+		} else {
+			pace = quota.Pace(now)
+		}
+	}
+	p.next = start.Add(pace)
+	p.mu.Unlock()
+
+	wait := start.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+	if p.notify != nil {
+		p.notify(wait)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Do calls fn once the pacer lets it through, calling it again after the
+// quota resets if Kion turns it away for exceeding the rate limit, up to
+// three more times. Kion not saying when the quota resets waits five seconds.
+func (p *QuotaPacer) Do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := p.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn()
+		if attempt == quotaRetries || !kion.IsStatus(err, http.StatusTooManyRequests) {
+			return err
+		}
+		if quota, found := p.quota(); !found || !quota.Reset.After(time.Now()) {
+			p.mu.Lock()
+			p.next = time.Now().Add(retryFirstWait)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// ReadQuotas returns the quota last reported by each Kion instance, by URL,
+// from the file at path. A missing file holds none.
+func ReadQuotas(path string) (map[string]kion.Quota, error) {
+	quotas := make(map[string]kion.Quota)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return quotas, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &quotas)
+	return quotas, err
+}
+
+// WriteQuotas stores the quota last reported by each Kion instance at path,
+// readable only by the user.
+func WriteQuotas(path string, quotas map[string]kion.Quota) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(quotas, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// QuotaOutput is the structured form of the quota Kion last reported.
+type QuotaOutput struct {
+	Limit     *int   `json:"limit,omitempty" yaml:"limit,omitempty"`
+	Remaining int    `json:"remaining" yaml:"remaining"`
+	Reset     string `json:"reset,omitempty" yaml:"reset,omitempty"`
+	Observed  string `json:"observed" yaml:"observed"`
+}
+
+// NewQuotaOutput returns the structured form of a quota.
+func NewQuotaOutput(quota kion.Quota) *QuotaOutput {
+	output := &QuotaOutput{
+		Remaining: quota.Remaining,
+		Observed:  quota.Observed.UTC().Format(time.RFC3339),
+	}
+	if quota.Limit >= 0 {
+		output.Limit = &quota.Limit
+	}
+	if !quota.Reset.IsZero() {
+		output.Reset = quota.Reset.UTC().Format(time.RFC3339)
+	}
+	return output
+}
+
+// Status is the identity Kion CLI acts as along with the request quota Kion
+// last reported.
+type Status struct {
+	Identity `yaml:",inline"`
+	Quota    *QuotaOutput `json:"quota,omitempty" yaml:"quota,omitempty"`
+}
+
+// PrintStatus prints the identity and quota of a status. A quota whose reset
+// has passed is shown as restored.
+func PrintStatus(w io.Writer, status Status, now time.Time) error {
+	quota := "not reported by Kion"
+	if q := status.Quota; q != nil {
+		reset, _ := time.Parse(time.RFC3339, q.Reset)
+		observed, _ := time.Parse(time.RFC3339, q.Observed)
+		seen := now.Sub(observed).Round(time.Second)
+		if q.Reset != "" && !reset.After(now) {
+			quota = fmt.Sprintf("restored, reset since last seen %v ago", seen)
+		} else {
+			quota = fmt.Sprintf("%v remaining", q.Remaining)
+			if q.Limit != nil {
+				quota = fmt.Sprintf("%v of %v remaining", q.Remaining, *q.Limit)
+			}
+			if q.Reset != "" {
+				quota += fmt.Sprintf(", resets in %v", reset.Sub(now).Round(time.Second))
+			}
+			quota += fmt.Sprintf(", seen %v ago", seen)
+		}
+	}
+	table := identityTable(status.Identity, now)
+	table.AddRow("Quota:", quota)
+	return table.Write(w)
+}
@@ -0,0 +1,206 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestQuotaPacerWait(t *testing.T) {
+	tests := []struct {
+		description string
+		quota       func() kion.Quota
+		wantAtLeast time.Duration
+		wantWaits   int
+	}{
+		{
+			"No Quota Reported",
+			nil,
+			0,
+			0,
+		},
+		{
+			"Plenty Remaining",
+			func() kion.Quota {
+				return kion.Quota{Limit: 100, Remaining: 90, Reset: time.Now().Add(time.Minute)}
+			},
+			0,
+			0,
+		},
+		{
+			"Running Low",
+			func() kion.Quota {
+				return kion.Quota{Limit: 100, Remaining: 1, Reset: time.Now().Add(40 * time.Millisecond)}
+			},
+			30 * time.Millisecond,
+			2,
+		},
+		{
+			"Exhausted",
+			func() kion.Quota {
+				return kion.Quota{Limit: 100, Remaining: 0, Reset: time.Now().Add(30 * time.Millisecond)}
+			},
+			25 * time.Millisecond,
+			3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			waits := 0
+			pacer := NewQuotaPacer(func(wait time.Duration) { waits++ })
+			pacer.quota = func() (kion.Quota, bool) {
+				if test.quota == nil {
+					return kion.Quota{}, false
+				}
+				return test.quota(), true
+			}
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				err := pacer.Wait(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < test.wantAtLeast {
+				t.Errorf("three requests took %v, wanted at least %v", elapsed, test.wantAtLeast)
+			}
+			if waits != test.wantWaits {
+				t.Errorf("held back %v requests, wanted %v", waits, test.wantWaits)
+			}
+		})
+	}
+}
+
+func TestQuotaPacerWaitCanceled(t *testing.T) {
+	pacer := NewQuotaPacer(nil)
+	pacer.quota = func() (kion.Quota, bool) {
+		return kion.Quota{Limit: 100, Remaining: 0, Reset: time.Now().Add(time.Hour)}, true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := pacer.Wait(ctx)
+	if err != context.Canceled {
+		t.Errorf("got error %v, wanted %v", err, context.Canceled)
+	}
+}
+
+func TestQuotaPacerDo(t *testing.T) {
+	retryFirstWait = time.Millisecond
+	defer func() { retryFirstWait = 5 * time.Second }()
+
+	limited := &kion.APIError{StatusCode: http.StatusTooManyRequests}
+	denied := &kion.APIError{StatusCode: http.StatusForbidden}
+
+	tests := []struct {
+		description  string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"Succeeds", []error{nil}, nil, 1},
+		{"Succeeds After Reset", []error{limited, limited, nil}, nil, 3},
+		{"Other Errors Returned", []error{denied}, denied, 1},
+		{"Gives Up", []error{limited, limited, limited, limited, nil}, limited, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			pacer := NewQuotaPacer(nil)
+			pacer.quota = func() (kion.Quota, bool) { return kion.Quota{}, false }
+			attempts := 0
+			err := pacer.Do(context.Background(), func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if err != test.wantErr {
+				t.Errorf("got error %v, wanted %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("got %v attempts, wanted %v", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestQuotasRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "quota.json")
+	quotas, err := ReadQuotas(path)
+	if err != nil || len(quotas) != 0 {
+		t.Fatalf("got %v, %v reading a missing file, wanted no quotas", quotas, err)
+	}
+
+	reset := time.Date(2026, 10, 16, 12, 1, 0, 0, time.UTC)
+	want := kion.Quota{Limit: 100, Remaining: 40, Reset: reset, Observed: reset.Add(-time.Minute)}
+	err = WriteQuotas(path, map[string]kion.Quota{"https://kion.example.com": want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, err = ReadQuotas(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := quotas["https://kion.example.com"]
+	if got.Limit != want.Limit || got.Remaining != want.Remaining || !got.Reset.Equal(want.Reset) || !got.Observed.Equal(want.Observed) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	identity := Identity{URL: "https://kion.example.com", Auth: "api_key"}
+
+	tests := []struct {
+		description string
+		quota       *kion.Quota
+		want        string
+	}{
+		{
+			"Not Reported",
+			nil,
+			"Quota: not reported by Kion",
+		},
+		{
+			"Remaining",
+			&kion.Quota{Limit: 100, Remaining: 40, Reset: now.Add(30 * time.Second), Observed: now.Add(-5 * time.Second)},
+			"Quota: 40 of 100 remaining, resets in 30s, seen 5s ago",
+		},
+		{
+			"No Limit",
+			&kion.Quota{Limit: -1, Remaining: 40, Observed: now.Add(-5 * time.Second)},
+			"Quota: 40 remaining, seen 5s ago",
+		},
+		{
+			"Reset Since",
+			&kion.Quota{Limit: 100, Remaining: 0, Reset: now.Add(-time.Minute), Observed: now.Add(-2 * time.Minute)},
+			"Quota: restored, reset since last seen 2m0s ago",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status := Status{Identity: identity}
+			if test.quota != nil {
+				status.Quota = NewQuotaOutput(*test.quota)
+			}
+			var b bytes.Buffer
+			err := PrintStatus(&b, status, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+			got := strings.Join(strings.Fields(lines[len(lines)-1]), " ")
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
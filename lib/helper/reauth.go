@@ -0,0 +1,52 @@
+package helper
+
+import (
+	"fmt"
+	"slices"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Reauth                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Reauth strategies, the ways to sign in again once the cached session can't
+// be used.
+const (
+	ReauthSAML     = "saml"
+	ReauthPassword = "password"
+	ReauthAPIKey   = "api_key"
+	ReauthPrompt   = "prompt"
+)
+
+// reauthStrategies are the known strategies, and whether each needs a person
+// at a terminal or browser to sign in.
+var reauthStrategies = map[string]bool{
+	ReauthSAML:     true,
+	ReauthPassword: true,
+	ReauthAPIKey:   false,
+	ReauthPrompt:   true,
+}
+
+// ReauthStrategies returns the strategies that can be tried, in the order
+// given. Without interactive those needing a person are left out, though a
+// stored password lets the password strategy run unattended. Unknown and
+// repeated strategies are errors.
+func ReauthStrategies(strategies []string, interactive bool, passwordStored bool) ([]string, error) {
+	var usable []string
+	for i, strategy := range strategies {
+		attended, found := reauthStrategies[strategy]
+		if !found {
+			return nil, fmt.Errorf("unknown kion.reauth strategy %q, expected saml, password, api_key, or prompt", strategy)
+		}
+		if slices.Contains(strategies[:i], strategy) {
+			return nil, fmt.Errorf("kion.reauth strategy %q is listed more than once", strategy)
+		}
+		if attended && !interactive && !(strategy == ReauthPassword && passwordStored) {
+			continue
+		}
+		usable = append(usable, strategy)
+	}
+	return usable, nil
+}
@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReauthStrategies(t *testing.T) {
+	tests := []struct {
+		description    string
+		strategies     []string
+		interactive    bool
+		passwordStored bool
+		want           []string
+		wantErr        bool
+	}{
+		{"Interactive", []string{"saml", "api_key"}, true, false, []string{"saml", "api_key"}, false},
+		{"Unattended", []string{"saml", "prompt", "api_key"}, false, false, []string{"api_key"}, false},
+		{"Stored Password", []string{"saml", "password"}, false, true, []string{"password"}, false},
+		{"Password Needing Input", []string{"password"}, false, false, nil, false},
+		{"Unknown", []string{"saml", "kerberos"}, true, false, nil, true},
+		{"Repeated", []string{"saml", "api_key", "saml"}, true, false, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ReauthStrategies(test.strategies, test.interactive, test.passwordStored)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
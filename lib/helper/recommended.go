@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Recommended Favorites                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultRecommendedLabel is the key of the Kion account label admins use to
+// recommend favorites unless kion.recommended_favorites_label is set.
+const DefaultRecommendedLabel = "kion-cli-favorite"
+
+// ParseRecommendation parses the value of a recommended favorites label, a
+// comma separated list of cloud access roles each optionally followed by
+// :web or :cli, such as "Admin:web, ReadOnly". Favorites are left without an
+// access type for cli access, its default.
+func ParseRecommendation(value string) []structs.Favorite {
+	var recommended []structs.Favorite
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		var accessType string
+		if car, level, found := strings.Cut(entry, ":"); found && (level == kion.AccessLevelWeb || level == kion.AccessLevelCLI) {
+			entry = strings.TrimSpace(car)
+			if level == kion.AccessLevelWeb {
+				accessType = level
+			}
+		}
+		if entry == "" {
+			continue
+		}
+		recommended = append(recommended, structs.Favorite{CAR: entry, AccessType: accessType})
+	}
+	return recommended
+}
+
+// RecommendedFavorites builds a favorite for each cloud access role admins
+// recommend on an account through the label key, among the roles the user
+// has, given with the labels of each account by ID. Names are built from the
+// account name and made unique against existing favorites, and accounts
+// already covered by an equivalent favorite are skipped.
+func RecommendedFavorites(cars []kion.CAR, labels map[uint][]kion.Label, key string, existing []structs.Favorite) []structs.Favorite {
+	names := make(map[string]bool)
+	for _, fav := range existing {
+		names[fav.Name] = true
+	}
+
+	var recommended []structs.Favorite
+	for _, car := range cars {
+		for _, label := range labels[car.AccountID] {
+			if label.Key != key {
+				continue
+			}
+			for _, rec := range ParseRecommendation(label.Value) {
+				level := kion.AccessLevelCLI
+				if rec.AccessType == kion.AccessLevelWeb {
+					level = kion.AccessLevelWeb
+				}
+				if rec.CAR != car.Name || RequireAccessLevel(car, level) != nil {
+					continue
+				}
+				covers := func(fav structs.Favorite) bool {
+					return fav.Account == car.AccountNumber && fav.CAR == car.Name && (fav.AccessType == "web") == (rec.AccessType == "web")
+				}
+				if slices.ContainsFunc(existing, covers) || slices.ContainsFunc(recommended, covers) {
+					continue
+				}
+
+				name := FavoriteName("", car.AccountName, car.AccountNumber)
+				if names[name] {
+					name = fmt.Sprintf("%v-%v", name, strings.ToLower(car.Name))
+				}
+				if names[name] {
+					name = fmt.Sprintf("%v-%v", name, car.AccountNumber)
+				}
+				names[name] = true
+
+				recommended = append(recommended, structs.Favorite{
+					Name:       name,
+					Account:    car.AccountNumber,
+					CAR:        car.Name,
+					AccessType: rec.AccessType,
+				})
+			}
+		}
+	}
+	sort.Slice(recommended, func(i, j int) bool {
+		return recommended[i].Name < recommended[j].Name
+	})
+
+	return recommended
+}
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestParseRecommendation(t *testing.T) {
+	tests := []struct {
+		description string
+		value       string
+		want        []structs.Favorite
+	}{
+		{"Single", "Admin", []structs.Favorite{{CAR: "Admin"}}},
+		{"Access Types", "Admin:web, ReadOnly:cli", []structs.Favorite{{CAR: "Admin", AccessType: "web"}, {CAR: "ReadOnly"}}},
+		{"Colon In Name", "Team:Admin", []structs.Favorite{{CAR: "Team:Admin"}}},
+		{"Empty Entries", " , Admin,", []structs.Favorite{{CAR: "Admin"}}},
+		{"Empty", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ParseRecommendation(test.value)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecommendedFavorites(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Admin", AccountID: 1, AccountName: "Sandbox", AccountNumber: "111111111111", ShortTermAccessKeys: true, WebAccess: true},
+		{Name: "ReadOnly", AccountID: 1, AccountName: "Sandbox", AccountNumber: "111111111111", ShortTermAccessKeys: true},
+		{Name: "Admin", AccountID: 2, AccountName: "Prod", AccountNumber: "222222222222", ShortTermAccessKeys: true},
+		{Name: "Admin", AccountID: 3, AccountName: "Shared", AccountNumber: "333333333333", WebAccess: true},
+		{Name: "Admin", AccountID: 4, AccountName: "Unlabeled", AccountNumber: "444444444444", WebAccess: true},
+	}
+	labels := map[uint][]kion.Label{
+		1: {{Key: DefaultRecommendedLabel, Value: "Admin:web, ReadOnly"}, {Key: "env", Value: "dev"}},
+		// only cli access to the recommended role
+		2: {{Key: DefaultRecommendedLabel, Value: "Admin:web"}},
+		3: {{Key: DefaultRecommendedLabel, Value: "Admin:web"}},
+		4: {{Key: "env", Value: "Admin"}},
+	}
+	existing := []structs.Favorite{
+		{Name: "shared", Account: "333333333333", CAR: "Admin", AccessType: "web"},
+	}
+
+	want := []structs.Favorite{
+		{Name: "sandbox", Account: "111111111111", CAR: "Admin", AccessType: "web"},
+		{Name: "sandbox-readonly", Account: "111111111111", CAR: "ReadOnly"},
+	}
+	got := RecommendedFavorites(cars, labels, DefaultRecommendedLabel, existing)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
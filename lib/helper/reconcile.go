@@ -0,0 +1,301 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Reconcile                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Kinds of drift between the configuration and live Kion access.
+const (
+	DriftBrokenFavorite   = "broken favorite"
+	DriftRenamedAccount   = "renamed account"
+	DriftRenamedRole      = "renamed role"
+	DriftRenamedProject   = "renamed project"
+	DriftMissingProject   = "missing project"
+	DriftMissingFavorite  = "missing favorite"
+	DriftUncoveredAccount = "uncovered account"
+)
+
+// Drift is a difference between the configuration and what the user can
+// access in Kion. Fix describes the update kion reconcile --fix makes for it,
+// and is empty when there is no safe one.
+type Drift struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Subject string `json:"subject" yaml:"subject"`
+	Detail  string `json:"detail" yaml:"detail"`
+	Fix     string `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// Reconciliation holds the drift found between the configuration and live
+// Kion access, and the favorites, workspaces, and defaults with every safe
+// fix applied.
+type Reconciliation struct {
+	Drift      []Drift
+	Favorites  []structs.Favorite
+	Workspaces map[string][]string
+	Defaults   []structs.Default
+}
+
+// Fixes returns how many of the drift found have a safe fix.
+func (r Reconciliation) Fixes() int {
+	var fixes int
+	for _, drift := range r.Drift {
+		if drift.Fix != "" {
+			fixes++
+		}
+	}
+	return fixes
+}
+
+// Reconcile compares favorites, workspaces, and defaults against live, the
+// projects and cloud access roles the user can access now. Kion keeps the IDs
+// of renamed projects, accounts, and roles, so previous, the last cached
+// inventory, is used to tell a rename from a removal. Only renames found that
+// way and workspaces listing favorites that don't exist are fixed, anything
+// else is reported for the user to decide on.
+func Reconcile(favs []structs.Favorite, workspaces map[string][]string, defaults []structs.Default, previous kion.Inventory, live kion.Inventory) Reconciliation {
+	r := Reconciliation{
+		Favorites:  slices.Clone(favs),
+		Workspaces: make(map[string][]string, len(workspaces)),
+		Defaults:   slices.Clone(defaults),
+	}
+	for name, listed := range workspaces {
+		r.Workspaces[name] = slices.Clone(listed)
+	}
+
+	// follow renamed accounts and roles, reporting favorites still unusable
+	for i, fav := range r.Favorites {
+		if alias, found := renamedAccount(fav, previous.CARs, live.CARs); found {
+			r.Drift = append(r.Drift, Drift{
+				Kind:    DriftRenamedAccount,
+				Subject: fav.Name,
+				Detail:  fmt.Sprintf("account %v is now named %v", describeAccount(fav), alias),
+				Fix:     fmt.Sprintf("set account_alias to %v", alias),
+			})
+			r.Favorites[i].AccountAlias = alias
+		}
+		if car, found := renamedRole(r.Favorites[i], previous.CARs, live.CARs); found {
+			r.Drift = append(r.Drift, Drift{
+				Kind:    DriftRenamedRole,
+				Subject: fav.Name,
+				Detail:  fmt.Sprintf("cloud access role %q is now named %q", fav.CAR, car),
+				Fix:     fmt.Sprintf("set cloud_access_role to %v", car),
+			})
+			r.Favorites[i].CAR = car
+		}
+		for _, issue := range CheckFavorites(r.Favorites[i:i+1], live.CARs) {
+			detail := issue.Problem
+			if len(issue.Suggestions) > 0 {
+				detail += fmt.Sprintf(", available roles: %v", strings.Join(issue.Suggestions, ", "))
+			}
+			r.Drift = append(r.Drift, Drift{Kind: DriftBrokenFavorite, Subject: fav.Name, Detail: detail})
+		}
+	}
+
+	// drop favorites workspaces list that aren't configured
+	names := make([]string, 0, len(r.Workspaces))
+	for name := range r.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	configured := func(name string) bool {
+		return slices.ContainsFunc(r.Favorites, func(f structs.Favorite) bool { return f.Name == name })
+	}
+	for _, workspace := range names {
+		for _, name := range r.Workspaces[workspace] {
+			if !configured(name) {
+				r.Drift = append(r.Drift, Drift{
+					Kind:    DriftMissingFavorite,
+					Subject: "workspace " + workspace,
+					Detail:  fmt.Sprintf("lists favorite %v which is not configured", name),
+					Fix:     fmt.Sprintf("remove %v from the workspace", name),
+				})
+			}
+		}
+		r.Workspaces[workspace] = slices.DeleteFunc(r.Workspaces[workspace], func(name string) bool { return !configured(name) })
+	}
+
+	// follow renamed projects, reporting defaults for projects now missing
+	for _, project := range previous.Projects {
+		idx := slices.IndexFunc(live.Projects, func(p kion.Project) bool { return p.ID == project.ID })
+		if idx == -1 || live.Projects[idx].Name == project.Name {
+			continue
+		}
+		renamed := live.Projects[idx].Name
+		drift := Drift{
+			Kind:    DriftRenamedProject,
+			Subject: "project " + project.Name,
+			Detail:  fmt.Sprintf("project %v is now named %v", project.Name, renamed),
+		}
+		for i, d := range r.Defaults {
+			if d.Project == project.Name {
+				r.Defaults[i].Project = renamed
+				drift.Fix = fmt.Sprintf("set the project of its defaults to %v", renamed)
+			}
+		}
+		r.Drift = append(r.Drift, drift)
+	}
+	for _, d := range r.Defaults {
+		if d.Project == "" || slices.ContainsFunc(live.Projects, func(p kion.Project) bool { return p.Name == d.Project }) {
+			continue
+		}
+		r.Drift = append(r.Drift, Drift{
+			Kind:    DriftMissingProject,
+			Subject: "default for project " + d.Project,
+			Detail:  fmt.Sprintf("project %v was not found or you no longer have access to it", d.Project),
+		})
+	}
+
+	r.Drift = append(r.Drift, uncoveredAccounts(r.Favorites, previous, live)...)
+	return r
+}
+
+// renamedAccount returns the new name of the account a favorite names by
+// alias when the alias no longer matches it. The account is found by number,
+// or for favorites with only an alias by the account ID it had in previous.
+func renamedAccount(fav structs.Favorite, previous []kion.CAR, live []kion.CAR) (string, bool) {
+	if fav.AccountAlias == "" || IsGlob(fav.AccountAlias) || IsGlob(fav.Account) {
+		return "", false
+	}
+	if slices.ContainsFunc(live, func(car kion.CAR) bool { return MatchesAccount(car, fav.Account, fav.AccountAlias) }) {
+		return "", false
+	}
+
+	var ids []uint
+	if fav.Account == "" {
+		for _, car := range previous {
+			if car.AccountName == fav.AccountAlias && !slices.Contains(ids, car.AccountID) {
+				ids = append(ids, car.AccountID)
+			}
+		}
+		if len(ids) != 1 {
+			return "", false
+		}
+	}
+	for _, car := range live {
+		if fav.Account != "" && car.AccountNumber == fav.Account || fav.Account == "" && car.AccountID == ids[0] {
+			return car.AccountName, car.AccountName != ""
+		}
+	}
+	return "", false
+}
+
+// renamedRole returns the new name of a favorite's cloud access role when a
+// role on its account with the same ID as it had in previous has another
+// name now.
+func renamedRole(fav structs.Favorite, previous []kion.CAR, live []kion.CAR) (string, bool) {
+	if fav.CAR == "" {
+		return "", false
+	}
+	var onAccount []kion.CAR
+	var accounts []uint
+	for _, car := range live {
+		if !MatchesAccount(car, fav.Account, fav.AccountAlias) {
+			continue
+		}
+		if car.Name == fav.CAR {
+			return "", false
+		}
+		onAccount = append(onAccount, car)
+		accounts = append(accounts, car.AccountID)
+	}
+
+	var ids []uint
+	for _, car := range previous {
+		if car.Name == fav.CAR && slices.Contains(accounts, car.AccountID) {
+			ids = append(ids, car.ID)
+		}
+	}
+	var renamed []string
+	for _, car := range onAccount {
+		if slices.Contains(ids, car.ID) && !slices.Contains(renamed, car.Name) {
+			renamed = append(renamed, car.Name)
+		}
+	}
+	if len(renamed) != 1 {
+		return "", false
+	}
+	return renamed[0], true
+}
+
+// uncoveredAccounts returns drift for each live account no favorite matches,
+// sorted by account name, noting those missing from previous as new.
+func uncoveredAccounts(favs []structs.Favorite, previous kion.Inventory, live kion.Inventory) []Drift {
+	var order []string
+	accounts := make(map[string]kion.CAR)
+	roles := make(map[string][]string)
+	for _, car := range live.CARs {
+		if slices.ContainsFunc(favs, func(f structs.Favorite) bool { return MatchesAccount(car, f.Account, f.AccountAlias) }) {
+			continue
+		}
+		if _, found := accounts[car.AccountNumber]; !found {
+			order = append(order, car.AccountNumber)
+			accounts[car.AccountNumber] = car
+		}
+		if !slices.Contains(roles[car.AccountNumber], car.Name) {
+			roles[car.AccountNumber] = append(roles[car.AccountNumber], car.Name)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return accounts[order[i]].AccountName < accounts[order[j]].AccountName
+	})
+
+	var drift []Drift
+	for _, number := range order {
+		account := accounts[number]
+		sort.Strings(roles[number])
+		detail := fmt.Sprintf("no favorite covers it, available roles: %v", strings.Join(roles[number], ", "))
+		known := slices.ContainsFunc(previous.CARs, func(car kion.CAR) bool { return car.AccountID == account.AccountID })
+		if !previous.Empty() && !known {
+			detail = "new since " + previous.Updated.Local().Format("2006-01-02 15:04") + ", " + detail
+		}
+		subject := number
+		if account.AccountName != "" {
+			subject = fmt.Sprintf("%v (%v)", account.AccountName, number)
+		}
+		drift = append(drift, Drift{Kind: DriftUncoveredAccount, Subject: subject, Detail: detail})
+	}
+	return drift
+}
+
+// SaveReconciliation replaces the favorites, workspaces, and defaults of the
+// named profile, or the default profile if empty, in the configuration file
+// with those of a reconciliation. All other values are preserved as they were
+// read from disk.
+func SaveReconciliation(filename string, profile string, r Reconciliation) error {
+	var config structs.Configuration
+	err := LoadConfig(filename, &config)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if profile == "" {
+		config.Favorites = r.Favorites
+		config.Workspaces = r.Workspaces
+		config.Defaults = r.Defaults
+	} else {
+		p, found := config.Profiles[profile]
+		if !found {
+			return fmt.Errorf("profile not found: %s", profile)
+		}
+		p.Favorites = r.Favorites
+		p.Workspaces = r.Workspaces
+		p.Defaults = r.Defaults
+		config.Profiles[profile] = p
+	}
+
+	return SaveConfig(filename, config)
+}
@@ -0,0 +1,263 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestReconcile(t *testing.T) {
+	previous := kion.Inventory{
+		CARs: []kion.CAR{
+			{ID: 10, Name: "Admin", AccountID: 100, AccountNumber: "111111111111", AccountName: "payments-prod", ShortTermAccessKeys: true},
+			{ID: 11, Name: "ReadOnly", AccountID: 100, AccountNumber: "111111111111", AccountName: "payments-prod", ShortTermAccessKeys: true},
+			{ID: 10, Name: "Admin", AccountID: 200, AccountNumber: "222222222222", AccountName: "data-dev", ShortTermAccessKeys: true},
+		},
+		Updated: time.Date(2026, 1, 2, 3, 4, 0, 0, time.Local),
+	}
+	withProjects := previous
+	withProjects.Projects = []kion.Project{{ID: 1, Name: "Payments"}, {ID: 2, Name: "Data"}}
+	live := kion.Inventory{
+		Projects: []kion.Project{{ID: 1, Name: "Payments Platform"}, {ID: 2, Name: "Data"}},
+		CARs: []kion.CAR{
+			{ID: 10, Name: "Admin", AccountID: 100, AccountNumber: "111111111111", AccountName: "payments-production", ShortTermAccessKeys: true},
+			{ID: 11, Name: "Auditor", AccountID: 100, AccountNumber: "111111111111", AccountName: "payments-production", ShortTermAccessKeys: true},
+			{ID: 10, Name: "Admin", AccountID: 200, AccountNumber: "222222222222", AccountName: "data-dev", ShortTermAccessKeys: true},
+			{ID: 10, Name: "Admin", AccountID: 300, AccountNumber: "333333333333", AccountName: "sandbox", ShortTermAccessKeys: true},
+		},
+	}
+
+	tests := []struct {
+		description    string
+		favs           []structs.Favorite
+		workspaces     map[string][]string
+		defaults       []structs.Default
+		previous       kion.Inventory
+		wantDrift      []Drift
+		wantFavorites  []structs.Favorite
+		wantWorkspaces map[string][]string
+		wantDefaults   []structs.Default
+	}{
+		{
+			"Renamed Role",
+			[]structs.Favorite{
+				{Name: "audit", Account: "111111111111", CAR: "ReadOnly"},
+				{Name: "data", Account: "222222222222", CAR: "Admin"},
+				{Name: "sandbox", Account: "333333333333"},
+			},
+			nil,
+			nil,
+			previous,
+			[]Drift{
+				{Kind: DriftRenamedRole, Subject: "audit", Detail: `cloud access role "ReadOnly" is now named "Auditor"`, Fix: "set cloud_access_role to Auditor"},
+			},
+			[]structs.Favorite{
+				{Name: "audit", Account: "111111111111", CAR: "Auditor"},
+				{Name: "data", Account: "222222222222", CAR: "Admin"},
+				{Name: "sandbox", Account: "333333333333"},
+			},
+			map[string][]string{},
+			nil,
+		},
+		{
+			"Renamed Account By Alias",
+			[]structs.Favorite{
+				{Name: "payments", AccountAlias: "payments-prod", CAR: "Admin"},
+				{Name: "rest", Account: "2*"},
+				{Name: "sandbox", AccountAlias: "sand*"},
+			},
+			nil,
+			nil,
+			previous,
+			[]Drift{
+				{Kind: DriftRenamedAccount, Subject: "payments", Detail: "account payments-prod is now named payments-production", Fix: "set account_alias to payments-production"},
+			},
+			[]structs.Favorite{
+				{Name: "payments", AccountAlias: "payments-production", CAR: "Admin"},
+				{Name: "rest", Account: "2*"},
+				{Name: "sandbox", AccountAlias: "sand*"},
+			},
+			map[string][]string{},
+			nil,
+		},
+		{
+			"Renamed Account And Role",
+			[]structs.Favorite{
+				{Name: "payments", Account: "111111111111", AccountAlias: "payments-prod", CAR: "ReadOnly"},
+				{Name: "rest", Account: "[23]*"},
+			},
+			nil,
+			nil,
+			previous,
+			[]Drift{
+				{Kind: DriftRenamedAccount, Subject: "payments", Detail: "account payments-prod (111111111111) is now named payments-production", Fix: "set account_alias to payments-production"},
+				{Kind: DriftRenamedRole, Subject: "payments", Detail: `cloud access role "ReadOnly" is now named "Auditor"`, Fix: "set cloud_access_role to Auditor"},
+			},
+			[]structs.Favorite{
+				{Name: "payments", Account: "111111111111", AccountAlias: "payments-production", CAR: "Auditor"},
+				{Name: "rest", Account: "[23]*"},
+			},
+			map[string][]string{},
+			nil,
+		},
+		{
+			"Removals Without Previous Inventory",
+			[]structs.Favorite{
+				{Name: "audit", Account: "111111111111", CAR: "ReadOnly"},
+				{Name: "gone", Account: "999999999999", CAR: "Admin"},
+				{Name: "rest", Account: "[23]*"},
+			},
+			nil,
+			nil,
+			kion.Inventory{},
+			[]Drift{
+				{Kind: DriftBrokenFavorite, Subject: "audit", Detail: `cloud access role "ReadOnly" was renamed, deleted, or removed from account 111111111111, available roles: Admin, Auditor`},
+				{Kind: DriftBrokenFavorite, Subject: "gone", Detail: "account 999999999999 was not found or you no longer have access to it"},
+			},
+			[]structs.Favorite{
+				{Name: "audit", Account: "111111111111", CAR: "ReadOnly"},
+				{Name: "gone", Account: "999999999999", CAR: "Admin"},
+				{Name: "rest", Account: "[23]*"},
+			},
+			map[string][]string{},
+			nil,
+		},
+		{
+			"Workspace Lists Missing Favorite",
+			[]structs.Favorite{{Name: "all", Account: "*"}},
+			map[string][]string{"daily": {"all", "gone"}, "empty": {}},
+			nil,
+			previous,
+			[]Drift{
+				{Kind: DriftMissingFavorite, Subject: "workspace daily", Detail: "lists favorite gone which is not configured", Fix: "remove gone from the workspace"},
+			},
+			[]structs.Favorite{{Name: "all", Account: "*"}},
+			map[string][]string{"daily": {"all"}, "empty": {}},
+			nil,
+		},
+		{
+			"Renamed And Missing Projects",
+			[]structs.Favorite{{Name: "all", Account: "*"}},
+			nil,
+			[]structs.Default{
+				{Project: "Payments", CAR: "Admin"},
+				{Project: "Retired", CAR: "Admin"},
+				{Account: "222222222222", CAR: "Admin"},
+			},
+			withProjects,
+			[]Drift{
+				{Kind: DriftRenamedProject, Subject: "project Payments", Detail: "project Payments is now named Payments Platform", Fix: "set the project of its defaults to Payments Platform"},
+				{Kind: DriftMissingProject, Subject: "default for project Retired", Detail: "project Retired was not found or you no longer have access to it"},
+			},
+			[]structs.Favorite{{Name: "all", Account: "*"}},
+			map[string][]string{},
+			[]structs.Default{
+				{Project: "Payments Platform", CAR: "Admin"},
+				{Project: "Retired", CAR: "Admin"},
+				{Account: "222222222222", CAR: "Admin"},
+			},
+		},
+		{
+			"Uncovered Accounts",
+			[]structs.Favorite{{Name: "data", Account: "222222222222"}},
+			nil,
+			nil,
+			previous,
+			[]Drift{
+				{Kind: DriftUncoveredAccount, Subject: "payments-production (111111111111)", Detail: "no favorite covers it, available roles: Admin, Auditor"},
+				{Kind: DriftUncoveredAccount, Subject: "sandbox (333333333333)", Detail: "new since 2026-01-02 03:04, no favorite covers it, available roles: Admin"},
+			},
+			[]structs.Favorite{{Name: "data", Account: "222222222222"}},
+			map[string][]string{},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			r := Reconcile(test.favs, test.workspaces, test.defaults, test.previous, live)
+			if !reflect.DeepEqual(r.Drift, test.wantDrift) {
+				t.Errorf("got drift %+v, wanted %+v", r.Drift, test.wantDrift)
+			}
+			if !reflect.DeepEqual(r.Favorites, test.wantFavorites) {
+				t.Errorf("got favorites %+v, wanted %+v", r.Favorites, test.wantFavorites)
+			}
+			if !reflect.DeepEqual(r.Workspaces, test.wantWorkspaces) {
+				t.Errorf("got workspaces %v, wanted %v", r.Workspaces, test.wantWorkspaces)
+			}
+			if !reflect.DeepEqual(r.Defaults, test.wantDefaults) {
+				t.Errorf("got defaults %+v, wanted %+v", r.Defaults, test.wantDefaults)
+			}
+		})
+	}
+}
+
+func TestReconcileLeavesInputs(t *testing.T) {
+	favs := []structs.Favorite{{Name: "audit", Account: "111111111111", CAR: "ReadOnly"}}
+	workspaces := map[string][]string{"daily": {"audit", "gone"}}
+	previous := kion.Inventory{CARs: []kion.CAR{{ID: 11, Name: "ReadOnly", AccountID: 100, AccountNumber: "111111111111"}}}
+	live := kion.Inventory{CARs: []kion.CAR{{ID: 11, Name: "Auditor", AccountID: 100, AccountNumber: "111111111111", ShortTermAccessKeys: true}}}
+
+	r := Reconcile(favs, workspaces, nil, previous, live)
+	if r.Fixes() != 2 {
+		t.Errorf("got %v fixes, wanted 2: %+v", r.Fixes(), r.Drift)
+	}
+	if favs[0].CAR != "ReadOnly" || len(workspaces["daily"]) != 2 {
+		t.Errorf("the given favorites and workspaces were changed: %+v %v", favs, workspaces)
+	}
+}
+
+func TestSaveReconciliation(t *testing.T) {
+	tests := []struct {
+		description string
+		profile     string
+		wantErr     bool
+	}{
+		{"Default Profile", "", false},
+		{"Named Profile", "dev", false},
+		{"Unknown Profile", "missing", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			err := os.WriteFile(path, []byte("kion:\n  url: https://kion.example.com\nprofiles:\n  dev:\n    kion:\n      url: https://dev.example.com\n"), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := Reconciliation{
+				Favorites:  []structs.Favorite{{Name: "audit", Account: "111111111111", CAR: "Auditor"}},
+				Workspaces: map[string][]string{"daily": {"audit"}},
+				Defaults:   []structs.Default{{Project: "Payments Platform", CAR: "Admin"}},
+			}
+			err = SaveReconciliation(path, test.profile, r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted one: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var config structs.Configuration
+			err = LoadConfig(path, &config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			favs, workspaces, defaults := config.Favorites, config.Workspaces, config.Defaults
+			if test.profile != "" {
+				favs, workspaces, defaults = config.Profiles[test.profile].Favorites, config.Profiles[test.profile].Workspaces, config.Profiles[test.profile].Defaults
+			}
+			if len(favs) != 1 || favs[0].CAR != "Auditor" || !reflect.DeepEqual(workspaces, r.Workspaces) || !reflect.DeepEqual(defaults, r.Defaults) {
+				t.Errorf("got %+v %v %+v, wanted %+v %v %+v", favs, workspaces, defaults, r.Favorites, r.Workspaces, r.Defaults)
+			}
+			if config.Kion.Url != "https://kion.example.com" {
+				t.Errorf("got url %v, wanted it kept", config.Kion.Url)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Account Regions                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultRegionLabel is the key of the Kion account label holding an
+// account's default AWS region unless kion.region_label is set.
+const DefaultRegionLabel = "default-region"
+
+// awsRegion matches AWS region names such as us-east-1 or us-gov-west-1.
+var awsRegion = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// AccountRegion is the default region read from an account's labels, empty
+// if it has none, and when it was read.
+type AccountRegion struct {
+	Region  string    `json:"region,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// RegionFromLabels returns the region held by the label key, or an empty
+// string if there is no such label or it doesn't hold a region name.
+func RegionFromLabels(labels []kion.Label, key string) string {
+	for _, label := range labels {
+		if label.Key != key {
+			continue
+		}
+		region := strings.ToLower(strings.TrimSpace(label.Value))
+		if awsRegion.MatchString(region) {
+			return region
+		}
+	}
+	return ""
+}
+
+// ReadAccountRegions reads the account regions at path, keyed by account
+// number, empty if none have been written.
+func ReadAccountRegions(path string) (map[string]AccountRegion, error) {
+	regions := make(map[string]AccountRegion)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return regions, nil
+	}
+	if err != nil {
+		return regions, err
+	}
+	err = json.Unmarshal(data, &regions)
+	return regions, err
+}
+
+// WriteAccountRegions writes the account regions to path.
+func WriteAccountRegions(path string, regions map[string]AccountRegion) error {
+	data, err := json.Marshal(regions)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestRegionFromLabels(t *testing.T) {
+	tests := []struct {
+		description string
+		labels      []kion.Label
+		want        string
+	}{
+		{"Labeled", []kion.Label{{Key: "env", Value: "prod"}, {Key: DefaultRegionLabel, Value: "us-west-2"}}, "us-west-2"},
+		{"GovCloud", []kion.Label{{Key: DefaultRegionLabel, Value: " US-GOV-WEST-1 "}}, "us-gov-west-1"},
+		{"Not A Region", []kion.Label{{Key: DefaultRegionLabel, Value: "west"}}, ""},
+		{"Unlabeled", []kion.Label{{Key: "env", Value: "us-east-1"}}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := RegionFromLabels(test.labels, DefaultRegionLabel)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountRegions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "account-regions.json")
+	regions, err := ReadAccountRegions(path)
+	if err != nil || len(regions) != 0 {
+		t.Fatalf("got %v, %v before any were written, wanted none", regions, err)
+	}
+
+	checked := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	regions["111122223333"] = AccountRegion{Region: "eu-west-1", Checked: checked}
+	regions["444455556666"] = AccountRegion{Checked: checked}
+	err = WriteAccountRegions(path, regions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadAccountRegions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["111122223333"].Region != "eu-west-1" || !got["444455556666"].Checked.Equal(checked) {
+		t.Errorf("got %+v, wanted the written regions", got)
+	}
+}
@@ -0,0 +1,142 @@
+package helper
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Reports                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// AccessReport lists every cloud access role a user can reach, for attaching
+// to access review attestations.
+type AccessReport struct {
+	Generated time.Time
+	Kion      string
+	User      string
+	Rows      []AccessReportRow
+}
+
+// AccessReportRow is a cloud access role on an account.
+type AccessReportRow struct {
+	AccountName   string
+	AccountNumber string
+	Cloud         string
+	CAR           string
+	Access        string
+	LastUsed      time.Time
+}
+
+// LastUsedText returns when the role was last used or "never" if there is no
+// record of it in the local audit log.
+func (r AccessReportRow) LastUsedText() string {
+	if r.LastUsed.IsZero() {
+		return "never"
+	}
+	return r.LastUsed.Local().Format("2006-01-02 15:04")
+}
+
+// BuildAccessReport builds an access report from the user's cloud access
+// roles, sorted by account then role, with last used times from lastUsed.
+func BuildAccessReport(cars []kion.CAR, lastUsed map[string]time.Time) []AccessReportRow {
+	var rows []AccessReportRow
+	for _, car := range cars {
+		access := car.AccessLevels()
+		if len(access) == 0 {
+			access = append(access, "none")
+		}
+		rows = append(rows, AccessReportRow{
+			AccountName:   car.AccountName,
+			AccountNumber: car.AccountNumber,
+			Cloud:         CloudName(car.Cloud()),
+			CAR:           car.Name,
+			Access:        strings.Join(access, ", "),
+			LastUsed:      lastUsed[UsageKey(car.AccountNumber, car.Name)],
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].AccountName != rows[j].AccountName {
+			return rows[i].AccountName < rows[j].AccountName
+		}
+		if rows[i].AccountNumber != rows[j].AccountNumber {
+			return rows[i].AccountNumber < rows[j].AccountNumber
+		}
+		return rows[i].CAR < rows[j].CAR
+	})
+
+	return rows
+}
+
+// WriteAccessReport writes the report as markdown ("md") or html.
+func WriteAccessReport(w io.Writer, report AccessReport, format string) error {
+	switch format {
+	case "md":
+		return writeAccessReportMarkdown(w, report)
+	case "html":
+		return accessReportHTML.Execute(w, report)
+	default:
+		return fmt.Errorf("unsupported report format: %v", format)
+	}
+}
+
+// writeAccessReportMarkdown writes the report as a markdown table.
+func writeAccessReportMarkdown(w io.Writer, report AccessReport) error {
+	fmt.Fprintf(w, "# Access Review\n\n")
+	fmt.Fprintf(w, "- User: %v\n", mdEscape(report.User))
+	fmt.Fprintf(w, "- Kion: %v\n", mdEscape(report.Kion))
+	fmt.Fprintf(w, "- Generated: %v\n\n", report.Generated.Format(time.RFC3339))
+	fmt.Fprintf(w, "| Account | Account Number | Cloud | Cloud Access Role | Access | Last Used |\n")
+	fmt.Fprintf(w, "| --- | --- | --- | --- | --- | --- |\n")
+	for _, row := range report.Rows {
+		_, err := fmt.Fprintf(w, "| %v | %v | %v | %v | %v | %v |\n", mdEscape(row.AccountName), mdEscape(row.AccountNumber), row.Cloud, mdEscape(row.CAR), row.Access, row.LastUsedText())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mdEscape keeps values from breaking out of a markdown table cell.
+func mdEscape(value string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(value)
+}
+
+// accessReportHTML renders a standalone html access report.
+var accessReportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Access Review</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; }
+th { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Access Review</h1>
+<ul>
+<li>User: {{.User}}</li>
+<li>Kion: {{.Kion}}</li>
+<li>Generated: {{.Generated.Format "2006-01-02T15:04:05Z07:00"}}</li>
+</ul>
+<table>
+<tr><th>Account</th><th>Account Number</th><th>Cloud</th><th>Cloud Access Role</th><th>Access</th><th>Last Used</th></tr>
+{{- range .Rows}}
+<tr><td>{{.AccountName}}</td><td>{{.AccountNumber}}</td><td>{{.Cloud}}</td><td>{{.CAR}}</td><td>{{.Access}}</td><td>{{.LastUsedText}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestAccessReport(t *testing.T) {
+	used := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cars := []kion.CAR{
+		{Name: "ReadOnly", AccountName: "prod", AccountNumber: "222222222222", WebAccess: true},
+		{Name: "Admin", AccountName: "prod", AccountNumber: "222222222222", ShortTermAccessKeys: true, WebAccess: true},
+		{Name: "Dev|Ops", AccountName: "dev", AccountNumber: "111111111111", ShortTermAccessKeys: true},
+	}
+	lastUsed := map[string]time.Time{UsageKey("222222222222", "Admin"): used}
+
+	report := AccessReport{
+		Generated: used,
+		Kion:      "https://kion.example",
+		User:      "jane",
+		Rows:      BuildAccessReport(cars, lastUsed),
+	}
+
+	tests := []struct {
+		description string
+		format      string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			"Markdown",
+			"md",
+			[]string{
+				"| dev | 111111111111 | AWS | Dev\\|Ops | cli | never |\n| prod | 222222222222 | AWS | Admin | cli, web | " + used.Local().Format("2006-01-02 15:04") + " |\n| prod | 222222222222 | AWS | ReadOnly | web | never |",
+				"- User: jane",
+			},
+			false,
+		},
+		{
+			"HTML",
+			"html",
+			[]string{"<td>Dev|Ops</td>", "<li>User: jane</li>"},
+			false,
+		},
+		{
+			"Unsupported",
+			"pdf",
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out bytes.Buffer
+			err := WriteAccessReport(&out, report, test.format)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output:\n%v\ndoes not contain:\n%v", out.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Retries                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// waits between retries while Kion is unreachable, doubling from the first up
+// to the last
+var (
+	retryFirstWait = 5 * time.Second
+	retryMaxWait   = 30 * time.Second
+)
+
+// RetryWhileUnreachable calls fn until it succeeds, fails for a reason other
+// than Kion being unreachable, or the window has passed. Waits between
+// attempts back off up to thirty seconds and notify is called before each.
+// While Kion is in maintenance with a known end the next attempt waits for
+// it, giving up right away when it ends after the window. The last error is
+// returned if the window passes or ctx is canceled.
+func RetryWhileUnreachable(ctx context.Context, window time.Duration, fn func() error, notify func(err error, wait time.Duration)) error {
+	deadline := time.Now().Add(window)
+	wait := retryFirstWait
+	for {
+		err := fn()
+		if err == nil || !kion.IsUnreachable(err) {
+			return err
+		}
+
+		// give up once the next attempt would fall outside the window
+		delay := wait
+		if maintenance, ok := kion.AsMaintenance(err); ok && maintenance.Until.After(time.Now()) {
+			delay = time.Until(maintenance.Until).Round(time.Second)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		notify(err, delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		wait = min(wait*2, retryMaxWait)
+	}
+}
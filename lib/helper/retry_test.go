@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestRetryWhileUnreachable(t *testing.T) {
+	retryFirstWait = time.Millisecond
+	retryMaxWait = 2 * time.Millisecond
+	defer func() {
+		retryFirstWait = 5 * time.Second
+		retryMaxWait = 30 * time.Second
+	}()
+
+	unreachable := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	denied := &kion.APIError{StatusCode: 403}
+	unavailable := &kion.APIError{StatusCode: 503}
+	maintenance := &kion.MaintenanceError{Err: unavailable}
+	longMaintenance := &kion.MaintenanceError{Err: unavailable, Until: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		description  string
+		window       time.Duration
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{
+			"Recovers",
+			time.Minute,
+			[]error{unreachable, unreachable, nil},
+			nil,
+			3,
+		},
+		{
+			"Other Error",
+			time.Minute,
+			[]error{unreachable, denied},
+			denied,
+			2,
+		},
+		{
+			"No Window",
+			0,
+			[]error{unreachable, nil},
+			unreachable,
+			1,
+		},
+		{
+			"Maintenance Without End",
+			time.Minute,
+			[]error{maintenance, nil},
+			nil,
+			2,
+		},
+		{
+			"Maintenance Past Window",
+			time.Minute,
+			[]error{longMaintenance, nil},
+			longMaintenance,
+			1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			attempts := 0
+			notified := 0
+			err := RetryWhileUnreachable(context.Background(), test.window, func() error {
+				attempts++
+				return test.errs[attempts-1]
+			}, func(err error, wait time.Duration) {
+				notified++
+			})
+			if err != test.wantErr {
+				t.Errorf("got error %v, wanted %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts || notified != attempts-1 {
+				t.Errorf("got %v attempts and %v notices, wanted %v attempts", attempts, notified, test.wantAttempts)
+			}
+		})
+	}
+}
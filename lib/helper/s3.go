@@ -0,0 +1,254 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  S3                                                                        //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// s3MaxObjectSize is the largest object a single CopyObject or PutObject
+// request can write, 5 GiB.
+const s3MaxObjectSize = 5 << 30
+
+// S3Location is an object in S3 given as s3://bucket/key.
+type S3Location struct {
+	Bucket string
+	Key    string
+}
+
+// String returns the location as an s3:// url.
+func (l S3Location) String() string {
+	return "s3://" + l.Bucket + "/" + l.Key
+}
+
+// ParseS3URL parses an s3://bucket/key url. A key ending in a slash, or a
+// bucket alone, names a prefix the source object is copied into by its base
+// name, see S3Location.Into.
+func ParseS3URL(s3url string) (S3Location, error) {
+	rest, found := strings.CutPrefix(s3url, "s3://")
+	if !found {
+		return S3Location{}, fmt.Errorf("expected an s3://bucket/key url, got %q", s3url)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return S3Location{}, fmt.Errorf("no bucket in %q", s3url)
+	}
+	return S3Location{Bucket: bucket, Key: key}, nil
+}
+
+// Into returns the location src is copied to when copied to l, l itself
+// unless it names a prefix, in which case the base name of src is added.
+func (l S3Location) Into(src S3Location) S3Location {
+	if l.Key == "" || strings.HasSuffix(l.Key, "/") {
+		l.Key += path.Base(src.Key)
+	}
+	return l
+}
+
+// S3Copy describes a finished copy between accounts.
+type S3Copy struct {
+	// ServerSide is set when S3 copied the object itself, rather than it
+	// being streamed through Kion CLI.
+	ServerSide bool
+	Bytes      int64
+}
+
+// CopyS3Object copies an object between buckets that may be in different
+// accounts, src read with srcSTAK and dst written with dstSTAK, each in its
+// bucket's region. S3 is first asked to copy it server-side with the
+// destination's keys, which works when the destination role can read the
+// source, such as through a bucket policy. When it can't the object is
+// streamed from the source to the destination without touching disk.
+func CopyS3Object(src S3Location, srcSTAK kion.STAK, srcRegion string, dst S3Location, dstSTAK kion.STAK, dstRegion string) (S3Copy, error) {
+	if src.Key == "" || strings.HasSuffix(src.Key, "/") {
+		return S3Copy{}, fmt.Errorf("%v is not an object, copy one object at a time", src)
+	}
+
+	// server side, s3 reads the source with the destination's keys
+	size, err := copyS3ServerSide(src, dst, dstSTAK, dstRegion)
+	if err == nil {
+		return S3Copy{ServerSide: true, Bytes: size}, nil
+	}
+	if !isS3AccessDenied(err) {
+		return S3Copy{}, err
+	}
+
+	// relay, reading with the source's keys and writing with the
+	// destination's
+	resp, err := s3Request(srcSTAK, srcRegion, http.MethodGet, src, nil, nil, 0)
+	if err != nil {
+		return S3Copy{}, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > s3MaxObjectSize {
+		return S3Copy{}, fmt.Errorf("%v is larger than the 5 GiB that can be copied between accounts at once", src)
+	}
+	headers := map[string]string{}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	put, err := s3Request(dstSTAK, dstRegion, http.MethodPut, dst, headers, resp.Body, resp.ContentLength)
+	if err != nil {
+		return S3Copy{}, err
+	}
+	put.Body.Close()
+	return S3Copy{Bytes: resp.ContentLength}, nil
+}
+
+// copyS3ServerSide asks S3 to copy an object with a CopyObject request signed
+// with the destination's keys, returning its size.
+func copyS3ServerSide(src S3Location, dst S3Location, dstSTAK kion.STAK, dstRegion string) (int64, error) {
+	head, err := s3Request(dstSTAK, dstRegion, http.MethodHead, src, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	head.Body.Close()
+	if head.ContentLength > s3MaxObjectSize {
+		return 0, fmt.Errorf("%v is larger than the 5 GiB that can be copied between accounts at once", src)
+	}
+
+	headers := map[string]string{"X-Amz-Copy-Source": s3EscapePath(src.Bucket + "/" + src.Key)}
+	resp, err := s3Request(dstSTAK, dstRegion, http.MethodPut, dst, headers, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// copies failing part way still answer 200, with an error in the body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if bytes.Contains(body, []byte("<Error>")) {
+		return 0, s3ResponseError(http.MethodPut, resp.StatusCode, body)
+	}
+	return head.ContentLength, nil
+}
+
+// S3BucketRegion returns the region of a bucket as S3 reports it to anyone
+// asking, whether or not they may read it, or fallback if it isn't reported.
+func S3BucketRegion(stak kion.STAK, fallback string, bucket string) string {
+	resp, err := s3Request(stak, fallback, http.MethodHead, S3Location{Bucket: bucket}, nil, nil, 0)
+	var s3Err *S3Error
+	switch {
+	case err == nil:
+		resp.Body.Close()
+		if region := resp.Header.Get("X-Amz-Bucket-Region"); region != "" {
+			return region
+		}
+	case errors.As(err, &s3Err) && s3Err.Region != "":
+		return s3Err.Region
+	}
+	return fallback
+}
+
+// S3Error is an error response from S3.
+type S3Error struct {
+	Method  string
+	Status  int
+	Code    string
+	Message string
+
+	// Region is the bucket's region when S3 reports it, such as when the
+	// request went to another.
+	Region string
+}
+
+// Error describes the failed request and why S3 refused it.
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 %v request failed with status %v", e.Method, e.Status)
+	}
+	return fmt.Sprintf("s3 %v request failed with status %v: %v: %v", e.Method, e.Status, e.Code, e.Message)
+}
+
+// isS3AccessDenied reports whether S3 refused a request for lack of access.
+func isS3AccessDenied(err error) bool {
+	var s3Err *S3Error
+	return errors.As(err, &s3Err) && (s3Err.Status == http.StatusForbidden || s3Err.Code == "AccessDenied")
+}
+
+// s3ResponseError returns the error an S3 response body describes.
+func s3ResponseError(method string, status int, body []byte) *S3Error {
+	var response struct {
+		Code    string
+		Message string
+	}
+	_ = xml.Unmarshal(body, &response)
+	return &S3Error{Method: method, Status: status, Code: response.Code, Message: response.Message}
+}
+
+// s3Request sends a signed path style request for an object, or a bucket when
+// the key is empty, returning the response when it succeeds. Bodies are
+// streamed unsigned with their length given, as S3 allows over https.
+func s3Request(stak kion.STAK, region string, method string, loc S3Location, headers map[string]string, body io.Reader, length int64) (*http.Response, error) {
+	endpoint := awsEndpoint("s3", region) + "/" + s3EscapePath(loc.Bucket+"/"+loc.Key)
+	if length == 0 {
+		// an empty body would otherwise be sent chunked, which s3 refuses
+		body = nil
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signAWSRequest(req, nil, stak, region, "s3", time.Now())
+
+	resp, err := kion.ExternalClient(0).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// head responses have no body, so the error is told by the status
+	respBody, _ := io.ReadAll(resp.Body)
+	s3Err := s3ResponseError(method, resp.StatusCode, respBody)
+	s3Err.Region = resp.Header.Get("X-Amz-Bucket-Region")
+	if s3Err.Code == "" {
+		switch resp.StatusCode {
+		case http.StatusForbidden:
+			s3Err.Code, s3Err.Message = "AccessDenied", "Access Denied"
+		case http.StatusNotFound:
+			s3Err.Code, s3Err.Message = "NotFound", loc.String()+" does not exist"
+		case http.StatusMovedPermanently:
+			s3Err.Code, s3Err.Message = "PermanentRedirect", "the bucket is in "+s3Err.Region
+		}
+	}
+	return nil, s3Err
+}
+
+// s3EscapePath escapes a bucket and key as S3 signs them, every byte but
+// unreserved characters and slashes.
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("-_.~/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
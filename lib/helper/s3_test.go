@@ -0,0 +1,194 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestParseS3URL(t *testing.T) {
+	src := S3Location{Bucket: "source", Key: "reports/2030/q1.csv"}
+
+	tests := []struct {
+		description string
+		url         string
+		want        S3Location
+		wantErr     bool
+	}{
+		{"Object", "s3://dest/archive/q1.csv", S3Location{Bucket: "dest", Key: "archive/q1.csv"}, false},
+		{"Prefix", "s3://dest/archive/", S3Location{Bucket: "dest", Key: "archive/q1.csv"}, false},
+		{"Bucket", "s3://dest", S3Location{Bucket: "dest", Key: "q1.csv"}, false},
+		{"Not S3", "https://dest/archive", S3Location{}, true},
+		{"No Bucket", "s3:///archive", S3Location{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseS3URL(test.url)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if err == nil && got.Into(src) != test.want {
+				t.Errorf("got %v, wanted %v", got.Into(src), test.want)
+			}
+		})
+	}
+}
+
+// fakeS3 serves path style S3 requests, letting each access key read and
+// write the buckets it's given.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	access  map[string][]string
+	copies  int
+	relays  int
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, key, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	key, _, _ = strings.Cut(key, "/")
+	allowed := func(p string) bool {
+		bucket, _, _ := strings.Cut(p, "/")
+		for _, b := range s.access[key] {
+			if b == bucket {
+				return true
+			}
+		}
+		return false
+	}
+	denied := func() {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+	}
+
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasSuffix(p, "/") {
+		w.Header().Set("X-Amz-Bucket-Region", "eu-west-1")
+		return
+	}
+	if !allowed(p) {
+		denied()
+		return
+	}
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		body, found := s.objects[p]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, body)
+		}
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			if !allowed(source) {
+				denied()
+				return
+			}
+			s.objects[p] = s.objects[source]
+			s.copies++
+			fmt.Fprint(w, "<CopyObjectResult></CopyObjectResult>")
+			return
+		}
+		if r.Header.Get("X-Amz-Content-Sha256") != "UNSIGNED-PAYLOAD" || r.ContentLength < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.objects[p] = string(body)
+		s.relays++
+	}
+}
+
+func TestCopyS3Object(t *testing.T) {
+	src := S3Location{Bucket: "source", Key: "reports/q1 2030.csv"}
+	dst := S3Location{Bucket: "dest", Key: "archive/q1 2030.csv"}
+	srcSTAK := kion.STAK{AccessKey: "ASIASOURCE", SecretAccessKey: "secret"}
+	dstSTAK := kion.STAK{AccessKey: "ASIADEST", SecretAccessKey: "secret"}
+
+	tests := []struct {
+		description    string
+		dstAccess      []string
+		src            S3Location
+		wantServerSide bool
+		wantErr        string
+	}{
+		{"Server Side", []string{"source", "dest"}, src, true, ""},
+		{"Relay", []string{"dest"}, src, false, ""},
+		{"Missing Object", []string{"source", "dest"}, S3Location{Bucket: "source", Key: "missing.csv"}, false, "NotFound"},
+		{"Prefix", []string{"dest"}, S3Location{Bucket: "source", Key: "reports/"}, false, "not an object"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			s3 := &fakeS3{
+				objects: map[string]string{"source/reports/q1 2030.csv": "revenue,100\n"},
+				access:  map[string][]string{"ASIASOURCE": {"source"}, "ASIADEST": test.dstAccess},
+			}
+			server := httptest.NewServer(s3)
+			defer server.Close()
+			original := awsEndpoint
+			defer func() { awsEndpoint = original }()
+			awsEndpoint = func(service string, region string) string {
+				return server.URL
+			}
+
+			got, err := CopyS3Object(test.src, srcSTAK, "us-east-1", dst, dstSTAK, "us-west-2")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, wanted %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ServerSide != test.wantServerSide || got.Bytes != 12 {
+				t.Errorf("got %+v, wanted server side %v of 12 bytes", got, test.wantServerSide)
+			}
+			if s3.objects["dest/archive/q1 2030.csv"] != "revenue,100\n" {
+				t.Errorf("got objects %v", s3.objects)
+			}
+			if test.wantServerSide && s3.relays != 0 || !test.wantServerSide && s3.copies != 0 {
+				t.Errorf("got %v copies and %v relays", s3.copies, s3.relays)
+			}
+		})
+	}
+}
+
+func TestS3BucketRegion(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+	original := awsEndpoint
+	defer func() { awsEndpoint = original }()
+	awsEndpoint = func(service string, region string) string {
+		return server.URL
+	}
+
+	stak := kion.STAK{AccessKey: "ASIADEST", SecretAccessKey: "secret"}
+	if got := S3BucketRegion(stak, "us-east-1", "dest"); got != "eu-west-1" {
+		t.Errorf("got %v, wanted eu-west-1", got)
+	}
+}
+
+func TestS3EscapePath(t *testing.T) {
+	got := s3EscapePath("bucket/reports/q1 2030+final(1)~.csv")
+	want := "bucket/reports/q1%202030%2Bfinal%281%29~.csv"
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package helper
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SAML Callback Certificate                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// CallbackCertValidity is how long generated SAML callback certificates
+	// are valid for, the most macOS accepts for a trusted TLS certificate.
+	CallbackCertValidity = 825 * 24 * time.Hour
+
+	// callbackCertRenewal is how long before it expires a generated SAML
+	// callback certificate is replaced.
+	callbackCertRenewal = 24 * time.Hour
+
+	// callbackCertName is what the certificate is called in trust stores.
+	callbackCertName = "kion-cli-saml-callback"
+)
+
+// CallbackCertCurrent reports whether the PEM certificate at path exists,
+// stays valid for at least another day, and is issued for any hosts given.
+func CallbackCertCurrent(path string, now time.Time, hosts ...string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return cert.NotAfter.After(now.Add(callbackCertRenewal))
+}
+
+// TrustCertInstructions explains how to have browsers on the given platform
+// trust the SAML callback certificate at certFile, so the identity provider's
+// post back to https://localhost isn't blocked.
+func TrustCertInstructions(goos string, certFile string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The SAML callback is served over HTTPS with the certificate in %v.\n", certFile)
+	b.WriteString("Browsers block the identity provider's post back until it is trusted.\n\n")
+	switch goos {
+	case "darwin":
+		b.WriteString("Trust it for Safari, Chrome, Edge, and Brave in the login keychain:\n")
+		fmt.Fprintf(&b, "  security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain-db %q\n", certFile)
+	case "windows":
+		b.WriteString("Trust it for Chrome, Edge, and Brave in the current user's root store:\n")
+		fmt.Fprintf(&b, "  certutil -user -addstore Root %q\n", certFile)
+	default:
+		b.WriteString("Trust it for Chrome, Chromium, and Brave in the NSS database, certutil is in libnss3-tools or nss-tools:\n")
+		fmt.Fprintf(&b, "  certutil -d sql:$HOME/.pki/nssdb -A -t \"P,,\" -n %v -i %q\n", callbackCertName, certFile)
+		b.WriteString("\nOr trust it system wide on Debian and Ubuntu:\n")
+		fmt.Fprintf(&b, "  sudo cp %q /usr/local/share/ca-certificates/%v.crt && sudo update-ca-certificates\n", certFile, callbackCertName)
+	}
+	b.WriteString("\nFirefox keeps its own trust store, import the certificate under Settings, Privacy & Security,\n")
+	b.WriteString("View Certificates, Servers.\n")
+	return b.String()
+}
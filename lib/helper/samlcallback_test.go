@@ -0,0 +1,78 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestCallbackCertCurrent(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, validFor time.Duration, hosts ...string) string {
+		_, certPEM, err := kion.GenerateLocalhostCertificate(validFor, hosts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		err = os.WriteFile(path, certPEM, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	invalid := filepath.Join(dir, "invalid.pem")
+	err := os.WriteFile(invalid, []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		path        string
+		hosts       []string
+		want        bool
+	}{
+		{"Current", write("current.pem", 30*24*time.Hour), nil, true},
+		{"Expiring", write("expiring.pem", time.Hour), nil, false},
+		{"Missing", filepath.Join(dir, "missing.pem"), nil, false},
+		{"Not A Certificate", invalid, nil, false},
+		{"Issued For Host", write("host.pem", 30*24*time.Hour, "kion-cli.local"), []string{"kion-cli.local"}, true},
+		{"Not Issued For Host", write("localhost.pem", 30*24*time.Hour), []string{"kion-cli.local"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := CallbackCertCurrent(test.path, time.Now(), test.hosts...); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrustCertInstructions(t *testing.T) {
+	tests := []struct {
+		description string
+		goos        string
+		want        string
+	}{
+		{"macOS", "darwin", `security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain-db "/state/cert.pem"`},
+		{"Windows", "windows", `certutil -user -addstore Root "/state/cert.pem"`},
+		{"Linux", "linux", `certutil -d sql:$HOME/.pki/nssdb -A -t "P,," -n kion-cli-saml-callback -i "/state/cert.pem"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := TrustCertInstructions(test.goos, "/state/cert.pem")
+			if !strings.Contains(got, test.want) {
+				t.Errorf("got:\n%v\nwanted it to contain:\n%v", got, test.want)
+			}
+			if !strings.Contains(got, "Firefox") {
+				t.Error("Firefox's own trust store is not mentioned")
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package helper
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Schema                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ConfigSchema returns a JSON Schema describing the configuration file. It is
+// derived from the configuration structs so it can't drift from what the tool
+// actually reads.
+func ConfigSchema() ([]byte, error) {
+	defs := make(map[string]any)
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "Kion CLI Configuration",
+	}
+	for key, value := range objectSchema(reflect.TypeOf(structs.Configuration{}), defs) {
+		schema[key] = value
+	}
+	schema["$defs"] = defs
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema for a type, registering named structs in defs
+// and referencing them so they are only described once.
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.Struct:
+		if _, found := defs[t.Name()]; !found {
+			defs[t.Name()] = nil
+			defs[t.Name()] = objectSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), defs),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), defs),
+		}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// durationPattern matches the durations accepted by time.ParseDuration, such
+// as 30s or 1h30m, or nothing for the default, for fields with a format tag
+// of duration.
+const durationPattern = `^([-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+))?$`
+
+// objectSchema describes a struct using its yaml, desc, enum, types, format,
+// and required field tags. The types tag lists the JSON types a field accepts
+// when yaml leniently converts them, such as unquoted account numbers.
+func objectSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		property := typeSchema(field.Type, defs)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			property["description"] = desc
+		}
+		if types := field.Tag.Get("types"); types != "" {
+			property["type"] = strings.Split(types, ",")
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		if field.Tag.Get("format") == "duration" {
+			property["pattern"] = durationPattern
+		}
+		if field.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+		properties[name] = property
+	}
+
+	object := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+
+	return object
+}
+
+// OutputSchema returns a JSON Schema describing the JSON a command writes when
+// its result is shaped like result: a struct, or a list or map of them. When
+// versioned, each record requires schema_version as WriteOutput sets it.
+// Records allow properties beyond those described, as fields may be added
+// within a schema version.
+func OutputSchema(title string, result any, versioned bool) ([]byte, error) {
+	defs := make(map[string]any)
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   title,
+	}
+
+	record := reflect.TypeOf(result)
+	container := record.Kind()
+	if container == reflect.Slice || container == reflect.Map {
+		record = record.Elem()
+	}
+	object := outputObjectSchema(record, defs)
+	if versioned {
+		properties := object["properties"].(map[string]any)
+		properties["schema_version"] = map[string]any{
+			"type":  "integer",
+			"const": OutputSchemaVersion,
+		}
+		object["required"] = append([]string{"schema_version"}, object["required"].([]string)...)
+	}
+	defs[record.Name()] = object
+	ref := map[string]any{"$ref": "#/$defs/" + record.Name()}
+
+	switch container {
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = ref
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = ref
+	default:
+		for key, value := range ref {
+			schema[key] = value
+		}
+	}
+	schema["$defs"] = defs
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// outputTypeSchema returns the schema for a type in command output,
+// registering named structs in defs as typeSchema does.
+func outputTypeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return outputTypeSchema(t.Elem(), defs)
+	case reflect.Struct:
+		if _, found := defs[t.Name()]; !found {
+			defs[t.Name()] = nil
+			defs[t.Name()] = outputObjectSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{
+			"type":  "array",
+			"items": outputTypeSchema(t.Elem(), defs),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": outputTypeSchema(t.Elem(), defs),
+		}
+	default:
+		return typeSchema(t, defs)
+	}
+}
+
+// outputObjectSchema describes a struct as encoding/json writes it, requiring
+// the fields it always writes, those without omitempty, and flattening
+// embedded structs into it.
+func outputObjectSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := outputObjectSchema(field.Type, defs)
+			for key, value := range embedded["properties"].(map[string]any) {
+				properties[key] = value
+			}
+			required = append(required, embedded["required"].([]string)...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = outputTypeSchema(field.Type, defs)
+		if !slices.Contains(tag[1:], "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
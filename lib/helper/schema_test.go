@@ -0,0 +1,196 @@
+package helper
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	out, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema map[string]any
+	err = json.Unmarshal(out, &schema)
+	if err != nil {
+		t.Fatalf("schema is not valid json: %v", err)
+	}
+
+	tests := []struct {
+		description string
+		path        []string
+		want        any
+	}{
+		{
+			"Root Is Object",
+			[]string{"type"},
+			"object",
+		},
+		{
+			"Favorites Reference",
+			[]string{"properties", "favorites", "items", "$ref"},
+			"#/$defs/Favorite",
+		},
+		{
+			"Profiles Are Keyed",
+			[]string{"properties", "profiles", "additionalProperties", "$ref"},
+			"#/$defs/Profile",
+		},
+		{
+			"Favorite Required",
+			[]string{"$defs", "Favorite", "required"},
+			[]any{"name"},
+		},
+		{
+			"Access Type Enum",
+			[]string{"$defs", "Favorite", "properties", "access_type", "enum"},
+			[]any{"cli", "web"},
+		},
+		{
+			"Unquoted Account Numbers",
+			[]string{"$defs", "Favorite", "properties", "account", "type"},
+			[]any{"string", "integer"},
+		},
+		{
+			"Duration Pattern",
+			[]string{"$defs", "Kion", "properties", "outage_retry", "pattern"},
+			durationPattern,
+		},
+		{
+			"Cache Flag Type",
+			[]string{"$defs", "Kion", "properties", "disable_cache", "type"},
+			"boolean",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got any = schema
+			for _, key := range test.path {
+				obj, ok := got.(map[string]any)
+				if !ok {
+					t.Fatalf("%v is not an object", key)
+				}
+				got = obj[key]
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOutputSchema(t *testing.T) {
+	tests := []struct {
+		description string
+		result      any
+		versioned   bool
+		path        []string
+		want        any
+	}{
+		{
+			"Record",
+			STAKOutput{},
+			true,
+			[]string{"$ref"},
+			"#/$defs/STAKOutput",
+		},
+		{
+			"Version Required",
+			STAKOutput{},
+			true,
+			[]string{"$defs", "STAKOutput", "required"},
+			[]any{"schema_version", "access_key_id", "secret_access_key", "session_token", "account", "cloud_access_role"},
+		},
+		{
+			"Version Const",
+			STAKOutput{},
+			true,
+			[]string{"$defs", "STAKOutput", "properties", "schema_version", "const"},
+			float64(OutputSchemaVersion),
+		},
+		{
+			"List",
+			[]PinOutput{},
+			true,
+			[]string{"items", "$ref"},
+			"#/$defs/PinOutput",
+		},
+		{
+			"Map",
+			map[string]STAKOutput{},
+			true,
+			[]string{"additionalProperties", "$ref"},
+			"#/$defs/STAKOutput",
+		},
+		{
+			"Embedded Fields",
+			Status{},
+			true,
+			[]string{"$defs", "Status", "properties", "auth", "type"},
+			"string",
+		},
+		{
+			"Nested Records Are Unversioned",
+			Status{},
+			true,
+			[]string{"$defs", "QuotaOutput", "properties", "schema_version"},
+			nil,
+		},
+		{
+			"Pointer",
+			Status{},
+			true,
+			[]string{"$defs", "QuotaOutput", "properties", "limit", "type"},
+			"integer",
+		},
+		{
+			"Unversioned",
+			CredentialProcessOutput{},
+			false,
+			[]string{"$defs", "CredentialProcessOutput", "required"},
+			[]any{"Version", "AccessKeyId", "SecretAccessKey", "SessionToken", "Expiration"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			out, err := OutputSchema("test", test.result, test.versioned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got any
+			err = json.Unmarshal(out, &got)
+			if err != nil {
+				t.Fatalf("schema is not valid json: %v", err)
+			}
+			for _, key := range test.path {
+				obj, ok := got.(map[string]any)
+				if !ok {
+					t.Fatalf("%v is not an object", key)
+				}
+				got = obj[key]
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDurationPattern(t *testing.T) {
+	pattern := regexp.MustCompile(durationPattern)
+	for _, value := range []string{"", "0", "30s", "1h30m", "1.5h", "500ms"} {
+		if !pattern.MatchString(value) {
+			t.Errorf("%q didn't match", value)
+		}
+	}
+	for _, value := range []string{"5", "s", "5 minutes", "1d"} {
+		if pattern.MatchString(value) {
+			t.Errorf("%q matched", value)
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/kionsoftware/kion-cli/lib/kion"
@@ -20,8 +22,52 @@ import (
 
 // CreateSubShell creates a sub-shell containing set variables for AWS short
 // term access keys. It attempts to use the users configured shell and rc file
-// while overriding the prompt to indicate the authed AWS account.
+// while overriding the prompt to indicate the authed AWS account. When run
+// through the wrapper printed by shell-init the variables are handed to it to
+// set in the current shell instead.
 func CreateSubShell(accountNumber string, accountAlias string, carName string, stak kion.STAK, region string) error {
+	return createSubShell(accountNumber, accountAlias, carName, stak, region, time.Time{})
+}
+
+// CreateElevatedSubShell creates a sub-shell as CreateSubShell does for
+// elevated access ending at deadline, set in it as KION_ELEVATED_UNTIL. The
+// user is warned shortly before the deadline, see ElevationWarning, and the
+// sub-shell is hung up once it passes.
+func CreateElevatedSubShell(accountNumber string, accountAlias string, carName string, stak kion.STAK, region string, deadline time.Time) error {
+	return createSubShell(accountNumber, accountAlias, carName, stak, region, deadline)
+}
+
+// ElevationWarning returns how long before elevated access granted for
+// duration ends the user is warned, five minutes or a fifth of shorter
+// grants.
+func ElevationWarning(duration time.Duration) time.Duration {
+	return min(5*time.Minute, duration/5)
+}
+
+// CreateCloudSubShell creates a sub-shell as CreateSubShell does with vars
+// set in it, the credentials of an Azure or GCP account given as name=value
+// pairs.
+func CreateCloudSubShell(accountNumber string, accountAlias string, carName string, vars []string) error {
+	return subShell(accountNumber, accountAlias, carName, vars, time.Time{})
+}
+
+// createSubShell creates a sub-shell as described on CreateSubShell, ended at
+// deadline unless it is zero.
+func createSubShell(accountNumber string, accountAlias string, carName string, stak kion.STAK, region string, deadline time.Time) error {
+	vars := []string{
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", stak.AccessKey),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", stak.SecretAccessKey),
+		fmt.Sprintf("AWS_SESSION_TOKEN=%s", stak.SessionToken),
+	}
+	if region != "" {
+		vars = append(vars, fmt.Sprintf("AWS_REGION=%s", region))
+	}
+	return subShell(accountNumber, accountAlias, carName, vars, deadline)
+}
+
+// subShell creates a sub-shell with the credential variables vars and the
+// account set in it, ended at deadline unless it is zero.
+func subShell(accountNumber string, accountAlias string, carName string, credentials []string, deadline time.Time) error {
 	// check if we know the account name
 	var accountMeta string
 	var accountMetaSentence string
@@ -33,6 +79,29 @@ func CreateSubShell(accountNumber string, accountAlias string, carName string, s
 		accountMetaSentence = fmt.Sprintf("%v (%v)", accountAlias, accountNumber)
 	}
 
+	// credential and account variables
+	vars := append(slices.Clip(credentials),
+		fmt.Sprintf("KION_ACCOUNT_NUM=%s", accountNumber),
+		fmt.Sprintf("KION_ACCOUNT_ALIAS=%s", accountAlias),
+		fmt.Sprintf("KION_CAR=%s", carName),
+	)
+	if !deadline.IsZero() {
+		vars = append(vars, fmt.Sprintf("KION_ELEVATED_UNTIL=%s", deadline.UTC().Format(time.RFC3339)))
+	}
+
+	// hand the variables to the shell-init wrapper if running under it
+	if initShell, initFile, found := shellInitTarget(); found {
+		err := writeShellInit(initShell, initFile, vars)
+		if err != nil {
+			return err
+		}
+		color.Green("Set short-term credentials for %v in the current shell", accountMetaSentence)
+		if !deadline.IsZero() {
+			color.Yellow("Elevated access ends at %v, the current shell can't be closed then so unset the keys yourself", deadline.Local().Format(time.Kitchen))
+		}
+		return nil
+	}
+
 	// get users shell information
 	usrShellPath := os.Getenv("SHELL")
 	usrShellName := filepath.Base(usrShellPath)
@@ -66,18 +135,7 @@ func CreateSubShell(accountNumber string, accountAlias string, carName string, s
 	shell := exec.Command("bash", "-c", cmd)
 
 	// replicate current env vars and add stak
-	shell.Env = os.Environ()
-	shell.Env = append(shell.Env, fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", stak.AccessKey))
-	shell.Env = append(shell.Env, fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", stak.SecretAccessKey))
-	shell.Env = append(shell.Env, fmt.Sprintf("AWS_SESSION_TOKEN=%s", stak.SessionToken))
-	shell.Env = append(shell.Env, fmt.Sprintf("KION_ACCOUNT_NUM=%s", accountNumber))
-	shell.Env = append(shell.Env, fmt.Sprintf("KION_ACCOUNT_ALIAS=%s", accountAlias))
-	shell.Env = append(shell.Env, fmt.Sprintf("KION_CAR=%s", carName))
-
-	// set region if one was passed
-	if region != "" {
-		shell.Env = append(shell.Env, fmt.Sprintf("AWS_REGION=%s", region))
-	}
+	shell.Env = append(os.Environ(), vars...)
 
 	// configure file handlers
 	shell.Stdin = os.Stdin
@@ -86,15 +144,91 @@ func CreateSubShell(accountNumber string, accountAlias string, carName string, s
 
 	// run the shell
 	color.Green("Starting session for %v", accountMetaSentence)
-	err := shell.Run()
+	err := shell.Start()
+	if err != nil {
+		return err
+	}
+	if !deadline.IsZero() {
+		stop := watchDeadline(shell.Process, accountMetaSentence, deadline)
+		defer stop()
+	}
+	err = shell.Wait()
 	color.Green("Shutting down session for %v", accountMetaSentence)
 
 	return err
 }
 
+// watchDeadline warns shortly before elevated access in the sub-shell
+// process ends at deadline, then hangs it up. The returned function stops
+// watching.
+func watchDeadline(process *os.Process, account string, deadline time.Time) func() {
+	remaining := time.Until(deadline)
+	warning := ElevationWarning(remaining)
+	warn := time.AfterFunc(remaining-warning, func() {
+		fmt.Fprintln(os.Stderr, color.YellowString("\nElevated access to %v ends in %v, at %v", account, warning.Round(time.Second), deadline.Local().Format(time.Kitchen)))
+	})
+	end := time.AfterFunc(remaining, func() {
+		fmt.Fprintln(os.Stderr, color.RedString("\nElevated access to %v has ended, closing the session", account))
+		if process.Signal(syscall.SIGHUP) != nil {
+			_ = process.Kill()
+		}
+	})
+	return func() {
+		warn.Stop()
+		end.Stop()
+	}
+}
+
 // RunCommand executes a one time command with AWS credentials set within the
-// environment. Command output is sent directly to stdout / stderr.
-func RunCommand(stak kion.STAK, region string, cmd string, args ...string) error {
+// environment, or when credsFD is true in a credentials file read from an
+// inherited file descriptor. Command output is sent directly to stdout /
+// stderr.
+func RunCommand(stak kion.STAK, region string, credsFD bool, cmd string, args ...string) error {
+	newCmd, err := commandLine(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	// replicate current env vars and add stak
+	env := os.Environ()
+	if credsFD {
+		// pass a credentials file on an inherited descriptor, keeping keys out
+		// of the environment where they're easily dumped
+		credsFile, err := credentialsFD(stak)
+		if err != nil {
+			return err
+		}
+		defer credsFile.Close()
+		env = withoutEnv(env, credentialEnvVars)
+		env = append(env, fmt.Sprintf("AWS_SHARED_CREDENTIALS_FILE=/dev/fd/%d", credsFile.Fd()))
+	} else {
+		env = append(env, fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", stak.AccessKey))
+		env = append(env, fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", stak.SecretAccessKey))
+		env = append(env, fmt.Sprintf("AWS_SESSION_TOKEN=%s", stak.SessionToken))
+	}
+
+	// set region if one was passed
+	if region != "" {
+		env = append(env, fmt.Sprintf("AWS_REGION=%s", region))
+	}
+
+	return execCommand(newCmd[0], newCmd, env)
+}
+
+// RunCloudCommand executes a one time command as RunCommand does with vars
+// set in its environment, the credentials of an Azure or GCP account given as
+// name=value pairs.
+func RunCloudCommand(vars []string, cmd string, args ...string) error {
+	newCmd, err := commandLine(cmd, args)
+	if err != nil {
+		return err
+	}
+	return execCommand(newCmd[0], newCmd, append(os.Environ(), vars...))
+}
+
+// commandLine returns the arguments running cmd with args, through the users
+// shell when cmd isn't a binary on the path, assuming it's a shell alias.
+func commandLine(cmd string, args []string) ([]string, error) {
 	// stub out an empty command stack
 	newCmd := make([]string, 0)
 
@@ -104,25 +238,37 @@ func RunCommand(stak kion.STAK, region string, cmd string, args ...string) error
 		sh := os.Getenv("SHELL")
 		if strings.HasSuffix(sh, "/bash") || strings.HasSuffix(sh, "/fish") || strings.HasSuffix(sh, "/zsh") || strings.HasSuffix(sh, "/ksh") {
 			newCmd = append(newCmd, sh, "-i", "-c", cmd)
+		} else {
+			return nil, fmt.Errorf("command not found: %v", cmd)
 		}
 	} else {
 		newCmd = append(newCmd, binary)
 	}
 
-	// replicate current env vars and add stak
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", stak.AccessKey))
-	env = append(env, fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", stak.SecretAccessKey))
-	env = append(env, fmt.Sprintf("AWS_SESSION_TOKEN=%s", stak.SessionToken))
-
-	// set region if one was passed
-	if region != "" {
-		env = append(env, fmt.Sprintf("AWS_REGION=%s", region))
-	}
-
 	// moosh it all together
-	newCmd = append(newCmd, args...)
+	return append(newCmd, args...), nil
+}
 
-	err = syscall.Exec(newCmd[0], newCmd[0:], env)
-	return err
+// credentialEnvVars take precedence over the shared credentials file or point
+// at another profile, so they are removed when passing credentials on a file
+// descriptor.
+var credentialEnvVars = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_SHARED_CREDENTIALS_FILE",
+}
+
+// withoutEnv returns env without the named variables.
+func withoutEnv(env []string, names []string) []string {
+	var filtered []string
+	for _, v := range env {
+		name, _, _ := strings.Cut(v, "=")
+		if !slices.Contains(names, name) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
 }
@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestRunCommandNotFound(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	err := RunCommand(kion.STAK{}, "", false, "kion-cli-missing-command")
+	if err == nil || err.Error() != "command not found: kion-cli-missing-command" {
+		t.Errorf("got %v, wanted a command not found error", err)
+	}
+}
+
+func TestElevationWarning(t *testing.T) {
+	tests := []struct {
+		description string
+		duration    time.Duration
+		want        time.Duration
+	}{
+		{"Long", time.Hour, 5 * time.Minute},
+		{"Short", 10 * time.Minute, 2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := ElevationWarning(test.duration); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWatchDeadline(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep command to watch")
+	}
+	cmd := exec.Command(sleep, "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := watchDeadline(cmd.Process, "sandbox", time.Now().Add(100*time.Millisecond))
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("process exited cleanly, wanted it hung up")
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Error("process still running after the deadline")
+	}
+}
@@ -0,0 +1,120 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Shell Integration                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ShellInitShells are the shells shell-init can print a wrapper for.
+var ShellInitShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// shellInitScripts wrap kion in a function that passes it a file to write
+// environment variables to, then sets them in the current shell. Nothing is
+// written to the file unless a command would otherwise start a sub-shell.
+var shellInitScripts = map[string]string{
+	"bash": `kion() {
+  local kion_init_file kion_status
+  kion_init_file="$(mktemp "${TMPDIR:-/tmp}/kion-shell-init.XXXXXX")" || return
+  KION_SHELL_INIT=%[1]v KION_SHELL_INIT_FILE="$kion_init_file" command kion "$@"
+  kion_status=$?
+  if [ -s "$kion_init_file" ]; then
+    . "$kion_init_file"
+  fi
+  rm -f "$kion_init_file"
+  return $kion_status
+}
+`,
+	"fish": `function kion --wraps kion --description 'Kion CLI setting short-term access keys in the current shell'
+    set -l kion_init_file (mktemp)
+    or return
+    KION_SHELL_INIT=fish KION_SHELL_INIT_FILE=$kion_init_file command kion $argv
+    set -l kion_status $status
+    if test -s $kion_init_file
+        source $kion_init_file
+    end
+    rm -f $kion_init_file
+    return $kion_status
+end
+`,
+	"powershell": `function kion {
+    $kionInitFile = [System.IO.Path]::GetTempFileName()
+    $kionCommand = Get-Command kion -CommandType Application | Select-Object -First 1
+    $env:KION_SHELL_INIT = 'powershell'
+    $env:KION_SHELL_INIT_FILE = $kionInitFile
+    try {
+        & $kionCommand @args
+    } finally {
+        Remove-Item Env:KION_SHELL_INIT, Env:KION_SHELL_INIT_FILE -ErrorAction SilentlyContinue
+    }
+    if ((Get-Item $kionInitFile).Length -gt 0) {
+        Invoke-Expression (Get-Content -Raw $kionInitFile)
+    }
+    Remove-Item $kionInitFile -ErrorAction SilentlyContinue
+}
+`,
+}
+
+// ShellInit returns the wrapper function for shell, defaulting to the shell
+// in $SHELL if none is given.
+func ShellInit(shell string) (string, error) {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	switch shell {
+	case "bash", "zsh":
+		return fmt.Sprintf(shellInitScripts["bash"], shell), nil
+	case "fish", "powershell":
+		return shellInitScripts[shell], nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q, expected one of %v", shell, strings.Join(ShellInitShells, ", "))
+	}
+}
+
+// ShellExports returns statements setting the given variables, as name=value
+// pairs, in shell.
+func ShellExports(shell string, vars []string) (string, error) {
+	var b strings.Builder
+	for _, v := range vars {
+		name, value, _ := strings.Cut(v, "=")
+		switch shell {
+		case "bash", "zsh":
+			fmt.Fprintf(&b, "export %v='%v'\n", name, strings.ReplaceAll(value, "'", `'\''`))
+		case "fish":
+			value = strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+			fmt.Fprintf(&b, "set -gx %v '%v'\n", name, value)
+		case "powershell":
+			fmt.Fprintf(&b, "$env:%v = '%v'\n", name, strings.ReplaceAll(value, "'", "''"))
+		case "cmd":
+			fmt.Fprintf(&b, "set \"%v=%v\"\n", name, value)
+		default:
+			return "", fmt.Errorf("unsupported shell %q, expected one of %v", shell, strings.Join(ShellInitShells, ", "))
+		}
+	}
+	return b.String(), nil
+}
+
+// shellInitTarget returns the shell and file the wrapper printed by
+// shell-init asked for variables to be written to, if running under it.
+func shellInitTarget() (string, string, bool) {
+	shell := os.Getenv("KION_SHELL_INIT")
+	file := os.Getenv("KION_SHELL_INIT_FILE")
+	return shell, file, shell != "" && file != ""
+}
+
+// writeShellInit writes statements setting vars to the file given by the
+// wrapper, readable only by the user as they hold credentials.
+func writeShellInit(shell string, file string, vars []string) error {
+	exports, err := ShellExports(shell, vars)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(exports), 0600)
+}
@@ -0,0 +1,86 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestShellInit(t *testing.T) {
+	for _, shell := range ShellInitShells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := ShellInit(shell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(script, "KION_SHELL_INIT_FILE") || !strings.Contains(script, "KION_SHELL_INIT") {
+				t.Errorf("wrapper doesn't pass a file to write to:\n%v", script)
+			}
+		})
+	}
+
+	t.Setenv("SHELL", "/usr/bin/zsh")
+	script, err := ShellInit("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "KION_SHELL_INIT=zsh") {
+		t.Errorf("wrapper didn't default to $SHELL:\n%v", script)
+	}
+
+	_, err = ShellInit("tcsh")
+	if err == nil {
+		t.Error("got no error for an unsupported shell")
+	}
+}
+
+func TestShellExports(t *testing.T) {
+	vars := []string{"AWS_ACCESS_KEY_ID=AKIA", `KION_ACCOUNT_ALIAS=it's a\b`}
+
+	tests := []struct {
+		description string
+		shell       string
+		want        string
+	}{
+		{"Bash", "bash", "export AWS_ACCESS_KEY_ID='AKIA'\nexport KION_ACCOUNT_ALIAS='it'\\''s a\\b'\n"},
+		{"Fish", "fish", "set -gx AWS_ACCESS_KEY_ID 'AKIA'\nset -gx KION_ACCOUNT_ALIAS 'it\\'s a\\\\b'\n"},
+		{"PowerShell", "powershell", "$env:AWS_ACCESS_KEY_ID = 'AKIA'\n$env:KION_ACCOUNT_ALIAS = 'it''s a\\b'\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ShellExports(test.shell, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCreateSubShellInit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "init")
+	t.Setenv("KION_SHELL_INIT", "bash")
+	t.Setenv("KION_SHELL_INIT_FILE", file)
+
+	stak := kion.STAK{AccessKey: "AKIA", SecretAccessKey: "secret", SessionToken: "token"}
+	err := CreateSubShell("111122223333", "payments", "Admin", stak, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"export AWS_ACCESS_KEY_ID='AKIA'", "export KION_CAR='Admin'", "export AWS_REGION='us-east-1'"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("missing %v in:\n%s", want, got)
+		}
+	}
+}
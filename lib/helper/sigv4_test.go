@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// the get-vanilla case from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stak := kion.STAK{AccessKey: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	signAWSRequest(req, nil, stak, "us-east-1", "service", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+}
+
+func TestSignAWSRequestFunctionARN(t *testing.T) {
+	// the credentials and date of the AWS Signature Version 4 test suite,
+	// invoking a function by ARN whose colons are encoded twice when signed
+	function := "arn:aws:lambda:us-east-1:123456789012:function:my-function"
+	endpoint := "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/" + awsURIEncode(function) + "/invocations"
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stak := kion.STAK{AccessKey: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	signAWSRequest(req, nil, stak, "us-east-1", "lambda", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/lambda/aws4_request, SignedHeaders=host;x-amz-date, Signature=9fce1ea73921e24bf102ac71426c42a7fd6d8543b859355608e5fbc0219597ca"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+	if req.URL.EscapedPath() != "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-east-1%3A123456789012%3Afunction%3Amy-function/invocations" {
+		t.Errorf("sent %v", req.URL.EscapedPath())
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	tests := []struct {
+		description string
+		url         string
+		service     string
+		want        string
+	}{
+		{"Root", "https://sts.us-east-1.amazonaws.com", "sts", "/"},
+		{"Function ARN", "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-east-1%3A123456789012%3Afunction%3Ajob/invocations", "lambda", "/2015-03-31/functions/arn%253Aaws%253Alambda%253Aus-east-1%253A123456789012%253Afunction%253Ajob/invocations"},
+		{"Function Name", "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/my-function/invocations", "lambda", "/2015-03-31/functions/my-function/invocations"},
+		{"S3 Encoded Once", "https://s3.us-east-1.amazonaws.com/bucket/my%20key", "s3", "/bucket/my%20key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := canonicalURI(u, test.service); got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
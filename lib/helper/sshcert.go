@@ -0,0 +1,248 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SSH Certificates                                                          //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Defaults for SSH certificate vending.
+const (
+	defaultSSHCertRegion   = "us-east-1"
+	defaultSSHCertField    = "certificate"
+	defaultSSHCertValidity = time.Hour
+	defaultSSHCertPayload  = `{"public_key": {{json .PublicKey}}, "principals": {{json .Principals}}, "account": {{json .Account}}, "cloud_access_role": {{json .CAR}}}`
+)
+
+// SSHCertVars are the values available to SSH certificate templates.
+type SSHCertVars struct {
+	Account    string
+	CAR        string
+	Region     string
+	Principals []string
+	PublicKey  string
+}
+
+// SSHCertKey is a freshly generated key pair to be certified. The private
+// key only ever lives in memory and the SSH agent.
+type SSHCertKey struct {
+	Private ed25519.PrivateKey
+	Public  ssh.PublicKey
+}
+
+// NewSSHCertKey generates an ed25519 key pair to be certified.
+func NewSSHCertKey() (SSHCertKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SSHCertKey{}, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return SSHCertKey{}, err
+	}
+	return SSHCertKey{Private: priv, Public: sshPub}, nil
+}
+
+// AuthorizedKey returns the public key in authorized_keys format.
+func (k SSHCertKey) AuthorizedKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.Public)))
+}
+
+// SSHCertRegion returns the region of the signing service.
+func SSHCertRegion(config structs.SSHCert) string {
+	if config.Region != "" {
+		return config.Region
+	}
+	return defaultSSHCertRegion
+}
+
+// RenderSSHCertTemplate executes a certificate template with the given values.
+// A json function is available to quote values for JSON payloads.
+func RenderSSHCertTemplate(text string, vars SSHCertVars) (string, error) {
+	tmpl, err := template.New("ssh_cert").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid ssh_cert template: %w", err)
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, vars)
+	if err != nil {
+		return "", fmt.Errorf("invalid ssh_cert template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// RequestSSHCert certifies key with the signing service configured for the
+// account, either by invoking a Lambda function that returns a certificate or
+// by signing locally with a CA key held in an SSM parameter.
+func RequestSSHCert(config structs.SSHCert, stak kion.STAK, vars SSHCertVars, key SSHCertKey) (*ssh.Certificate, error) {
+	if config.Target == "" {
+		return nil, errors.New("no ssh_cert target configured")
+	}
+	target, err := RenderSSHCertTemplate(config.Target, vars)
+	if err != nil {
+		return nil, err
+	}
+	region := SSHCertRegion(config)
+
+	switch config.Method {
+	case "", "lambda":
+		payloadTemplate := config.Payload
+		if payloadTemplate == "" {
+			payloadTemplate = defaultSSHCertPayload
+		}
+		payload, err := RenderSSHCertTemplate(payloadTemplate, vars)
+		if err != nil {
+			return nil, err
+		}
+		response, err := InvokeLambda(stak, region, target, []byte(payload))
+		if err != nil {
+			return nil, err
+		}
+		return ParseSSHCertResponse(response, config.CertificateField)
+	case "ssm":
+		caKey, err := GetSSMParameter(stak, region, target)
+		if err != nil {
+			return nil, err
+		}
+		validity := defaultSSHCertValidity
+		if config.Validity != "" {
+			validity, err = time.ParseDuration(config.Validity)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ssh_cert validity: %w", err)
+			}
+		}
+		keyID := fmt.Sprintf("kion-cli %v %v", vars.Account, vars.CAR)
+		return SignSSHCert([]byte(caKey), key.Public, vars.Principals, keyID, validity, time.Now())
+	default:
+		return nil, fmt.Errorf("unsupported ssh_cert method %v", config.Method)
+	}
+}
+
+// ParseSSHCertResponse extracts a certificate from a signing service response.
+// The response may be the certificate in authorized_keys format, a JSON
+// string holding it, or a JSON object holding it in the given field.
+func ParseSSHCertResponse(response []byte, field string) (*ssh.Certificate, error) {
+	if field == "" {
+		field = defaultSSHCertField
+	}
+
+	text := strings.TrimSpace(string(response))
+	var str string
+	var obj map[string]any
+	if json.Unmarshal(response, &str) == nil {
+		text = str
+	} else if json.Unmarshal(response, &obj) == nil {
+		value, ok := obj[field].(string)
+		if !ok {
+			return nil, fmt.Errorf("signing response has no %v field", field)
+		}
+		text = value
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate from signing response: %w", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("signing response holds a public key, not a certificate")
+	}
+	return cert, nil
+}
+
+// SignSSHCert signs a user certificate for pub with a PEM encoded CA private
+// key, valid for the given principals from a minute before now to allow for
+// clock skew until validity has passed.
+func SignSSHCert(caKey []byte, pub ssh.PublicKey, principals []string, keyID string, validity time.Duration, now time.Time) (*ssh.Certificate, error) {
+	signer, err := ssh.ParsePrivateKey(caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ca key: %w", err)
+	}
+	serial := make([]byte, 8)
+	_, err = rand.Read(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(validity).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":              "",
+				"permit-port-forwarding":  "",
+				"permit-agent-forwarding": "",
+			},
+		},
+	}
+	err = cert.SignCert(rand.Reader, signer)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// AddSSHCertToAgent adds a certified key to the SSH agent at SSH_AUTH_SOCK.
+func AddSSHCertToAgent(key SSHCertKey, cert *ssh.Certificate, comment string, now time.Time) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return errors.New("no ssh agent found, SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("unable to reach the ssh agent: %w", err)
+	}
+	defer conn.Close()
+	return addSSHCert(agent.NewClient(conn), key, cert, comment, now)
+}
+
+// addSSHCert adds a certified key to an agent, to be dropped by the agent when
+// the certificate expires.
+func addSSHCert(a agent.Agent, key SSHCertKey, cert *ssh.Certificate, comment string, now time.Time) error {
+	if cert.ValidBefore != ssh.CertTimeInfinity && int64(cert.ValidBefore) <= now.Unix() {
+		return errors.New("the certificate has already expired")
+	}
+	if !bytes.Equal(cert.Key.Marshal(), key.Public.Marshal()) {
+		return errors.New("the certificate was issued for a different key")
+	}
+
+	added := agent.AddedKey{
+		PrivateKey:  key.Private,
+		Certificate: cert,
+		Comment:     comment,
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		added.LifetimeSecs = uint32(int64(cert.ValidBefore) - now.Unix())
+	}
+	return a.Add(added)
+}
@@ -0,0 +1,298 @@
+package helper
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testSSHCA returns a PEM encoded CA private key and its public key.
+func testSSHCA(t *testing.T) ([]byte, ssh.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), sshPub
+}
+
+// testSSHCert returns a key and a certificate for it signed by a test CA.
+func testSSHCert(t *testing.T, validity time.Duration) (SSHCertKey, *ssh.Certificate) {
+	caKey, _ := testSSHCA(t)
+	key, err := NewSSHCertKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := SignSSHCert(caKey, key.Public, []string{"ec2-user"}, "test", validity, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestRenderSSHCertTemplate(t *testing.T) {
+	vars := SSHCertVars{Account: "111111111111", CAR: "Admin", Region: "us-east-1", Principals: []string{"ec2-user", `odd"name`}, PublicKey: "ssh-ed25519 AAAA"}
+
+	tests := []struct {
+		description string
+		template    string
+		want        string
+	}{
+		{"Parameter Name", "/ssh/ca/{{.Account}}", "/ssh/ca/111111111111"},
+		{"JSON Quoting", `{"principals": {{json .Principals}}}`, `{"principals": ["ec2-user","odd\"name"]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := RenderSSHCertTemplate(test.template, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+
+	// the default payload must be valid json
+	payload, err := RenderSSHCertTemplate(defaultSSHCertPayload, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid([]byte(payload)) {
+		t.Errorf("default payload is not valid json: %v", payload)
+	}
+}
+
+func TestParseSSHCertResponse(t *testing.T) {
+	key, cert := testSSHCert(t, time.Hour)
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert)))
+	quoted, _ := json.Marshal(line)
+
+	tests := []struct {
+		description string
+		response    string
+		field       string
+		wantErr     bool
+	}{
+		{"Raw", line + "\n", "", false},
+		{"JSON String", string(quoted), "", false},
+		{"JSON Object", fmt.Sprintf(`{"certificate": %s}`, quoted), "", false},
+		{"Custom Field", fmt.Sprintf(`{"signed_key": %s}`, quoted), "signed_key", false},
+		{"Missing Field", fmt.Sprintf(`{"signed_key": %s}`, quoted), "", true},
+		{"Public Key", key.AuthorizedKey(), "", true},
+		{"Garbage", "not a certificate", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseSSHCertResponse([]byte(test.response), test.field)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Serial != cert.Serial {
+				t.Errorf("got serial %v, wanted %v", got.Serial, cert.Serial)
+			}
+		})
+	}
+}
+
+func TestSignSSHCert(t *testing.T) {
+	caKey, caPub := testSSHCA(t)
+	key, err := NewSSHCertKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	cert, err := SignSSHCert(caKey, key.Public, []string{"ec2-user"}, "kion-cli test", 30*time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(caPub.Marshal())
+		},
+	}
+	_, err = checker.Authenticate(fakeConnMetadata("ec2-user"), cert)
+	if err != nil {
+		t.Errorf("certificate rejected: %v", err)
+	}
+	_, err = checker.Authenticate(fakeConnMetadata("root"), cert)
+	if err == nil {
+		t.Errorf("certificate accepted for a principal it was not issued for")
+	}
+	if got := time.Unix(int64(cert.ValidBefore), 0); got.Sub(now.Truncate(time.Second)) != 30*time.Minute {
+		t.Errorf("got valid before %v, wanted 30m after %v", got, now)
+	}
+}
+
+// fakeConnMetadata is the connection metadata needed to check certificates.
+type fakeConnMetadata string
+
+func (u fakeConnMetadata) User() string        { return string(u) }
+func (fakeConnMetadata) SessionID() []byte     { return nil }
+func (fakeConnMetadata) ClientVersion() []byte { return nil }
+func (fakeConnMetadata) ServerVersion() []byte { return nil }
+func (fakeConnMetadata) RemoteAddr() net.Addr  { return nil }
+func (fakeConnMetadata) LocalAddr() net.Addr   { return nil }
+
+func TestAddSSHCert(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Added", func(t *testing.T) {
+		key, cert := testSSHCert(t, time.Hour)
+		keyring := agent.NewKeyring()
+		err := addSSHCert(keyring, key, cert, "kion-cli test", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := keyring.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0].Format != cert.Type() || keys[0].Comment != "kion-cli test" {
+			t.Errorf("unexpected agent keys: %v", keys)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		key, cert := testSSHCert(t, time.Hour)
+		err := addSSHCert(agent.NewKeyring(), key, cert, "", now.Add(2*time.Hour))
+		if err == nil {
+			t.Errorf("expected an error adding an expired certificate")
+		}
+	})
+
+	t.Run("Other Key", func(t *testing.T) {
+		_, cert := testSSHCert(t, time.Hour)
+		other, err := NewSSHCertKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = addSSHCert(agent.NewKeyring(), other, cert, "", now)
+		if err == nil {
+			t.Errorf("expected an error adding a certificate for another key")
+		}
+	})
+}
+
+func TestRequestSSHCert(t *testing.T) {
+	caKey, _ := testSSHCA(t)
+	key, err := NewSSHCertKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lambdaCert, err := SignSSHCert(caKey, key.Public, []string{"ec2-user"}, "lambda", time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stak := kion.STAK{AccessKey: "AKID", SecretAccessKey: "secret", SessionToken: "token"}
+
+	// a fake lambda and ssm, checking requests are signed with the stak
+	var gotPayload string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lambda/2015-03-31/functions/ssh-signer-111111111111/invocations", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPayload = string(body)
+		fmt.Fprintf(w, `{"certificate": %q}`, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(lambdaCert))))
+	})
+	mux.HandleFunc("/ssm/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name           string
+			WithDecryption bool
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParameter" || req.Name != "/ssh/ca/111111111111" || !req.WithDecryption {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		value, _ := json.Marshal(string(caKey))
+		fmt.Fprintf(w, `{"Parameter": {"Name": %q, "Value": %s}}`, req.Name, value)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Security-Token") != "token" || !strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	original := awsEndpoint
+	defer func() { awsEndpoint = original }()
+	awsEndpoint = func(service string, region string) string {
+		return server.URL + "/" + service
+	}
+
+	vars := SSHCertVars{Account: "111111111111", CAR: "Admin", Principals: []string{"ec2-user"}, PublicKey: key.AuthorizedKey()}
+
+	t.Run("Lambda", func(t *testing.T) {
+		cert, err := RequestSSHCert(structs.SSHCert{Target: "ssh-signer-{{.Account}}"}, stak, vars, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.KeyId != "lambda" {
+			t.Errorf("got certificate %v, wanted the lambda's", cert.KeyId)
+		}
+		if !strings.Contains(gotPayload, key.AuthorizedKey()) {
+			t.Errorf("payload is missing the public key: %v", gotPayload)
+		}
+	})
+
+	t.Run("SSM", func(t *testing.T) {
+		cert, err := RequestSSHCert(structs.SSHCert{Method: "ssm", Target: "/ssh/ca/{{.Account}}", Validity: "15m"}, stak, vars, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.KeyId != "kion-cli 111111111111 Admin" {
+			t.Errorf("got key id %v", cert.KeyId)
+		}
+		if validity := cert.ValidBefore - cert.ValidAfter; validity != uint64((16 * time.Minute).Seconds()) {
+			t.Errorf("got validity %vs, wanted 15m plus a minute of skew", validity)
+		}
+	})
+
+	t.Run("Lambda Error", func(t *testing.T) {
+		_, err := RequestSSHCert(structs.SSHCert{Target: "missing"}, stak, vars, key)
+		if err == nil {
+			t.Errorf("expected an error from a missing lambda")
+		}
+	})
+
+	t.Run("No Target", func(t *testing.T) {
+		_, err := RequestSSHCert(structs.SSHCert{}, stak, vars, key)
+		if err == nil {
+			t.Errorf("expected an error without a target")
+		}
+	})
+}
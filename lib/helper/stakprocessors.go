@@ -0,0 +1,337 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  STAK Processors                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// defaultSessionPolicyDuration is how long downscoped keys last unless a
+	// duration is configured, the most AWS allows when chaining roles.
+	defaultSessionPolicyDuration = time.Hour
+
+	// defaultSTSRegion is where STS is called unless a region is configured.
+	defaultSTSRegion = "us-east-1"
+)
+
+// STAKTarget is the account and cloud access role short term access keys were
+// issued for.
+type STAKTarget struct {
+	Account string
+	CAR     string
+}
+
+// STAKProcessor transforms short term access keys after Kion issues them and
+// before they are cached or output, such as to limit what they can do.
+type STAKProcessor interface {
+	Process(stak kion.STAK, target STAKTarget) (kion.STAK, error)
+}
+
+// stakProcessorTypes build a processor from its configuration, by type.
+var stakProcessorTypes = map[string]func(settings structs.STAKProcessor) (STAKProcessor, error){
+	"session_policy": newSessionPolicyProcessor,
+	"command":        newCommandProcessor,
+}
+
+// NewSTAKProcessors builds the configured processors, in order.
+func NewSTAKProcessors(settings []structs.STAKProcessor) ([]STAKProcessor, error) {
+	var processors []STAKProcessor
+	for i, setting := range settings {
+		build, found := stakProcessorTypes[setting.Type]
+		if !found {
+			return nil, fmt.Errorf("invalid stak_processors[%v] type %q, expected session_policy or command", i, setting.Type)
+		}
+		processor, err := build(setting)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stak_processors[%v]: %w", i, err)
+		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
+
+// ProcessSTAK passes short term access keys through each processor in turn.
+func ProcessSTAK(processors []STAKProcessor, stak kion.STAK, target STAKTarget) (kion.STAK, error) {
+	for i, processor := range processors {
+		var err error
+		stak, err = processor.Process(stak, target)
+		if err != nil {
+			return kion.STAK{}, fmt.Errorf("stak_processors[%v] failed: %w", i, err)
+		}
+	}
+	return stak, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Session Policy                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// sessionPolicyProcessor downscopes keys by assuming a role with them while
+// passing a session policy, the resulting keys only allowed what both the
+// role and the policy allow. The role, the one the keys were issued for by
+// default, must trust itself to be assumed.
+type sessionPolicyProcessor struct {
+	policy   string
+	roleARN  *template.Template
+	duration time.Duration
+	region   string
+}
+
+// newSessionPolicyProcessor builds a session policy processor, reading the
+// policy document from its file if one is given.
+func newSessionPolicyProcessor(settings structs.STAKProcessor) (STAKProcessor, error) {
+	if settings.Policy != "" && settings.PolicyFile != "" {
+		return nil, errors.New("only one of policy and policy_file may be set")
+	}
+	policy, err := CompactSessionPolicy(settings.Policy)
+	if settings.PolicyFile != "" {
+		policy, err = ReadSessionPolicy(settings.PolicyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		return nil, errors.New("a session_policy needs a policy or policy_file")
+	}
+
+	processor := &sessionPolicyProcessor{policy: policy, duration: defaultSessionPolicyDuration, region: settings.Region}
+	if processor.region == "" {
+		processor.region = defaultSTSRegion
+	}
+	if settings.RoleARN != "" {
+		processor.roleARN, err = template.New("role_arn").Parse(settings.RoleARN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role_arn template: %w", err)
+		}
+	}
+	if settings.Duration != "" {
+		processor.duration, err = time.ParseDuration(settings.Duration)
+		if err != nil || processor.duration < 15*time.Minute {
+			return nil, fmt.Errorf("invalid duration %q, expected at least 15m", settings.Duration)
+		}
+	}
+	return processor, nil
+}
+
+// ReadSessionPolicy reads the IAM policy document in a file, compacted as it
+// is sent to AWS.
+func ReadSessionPolicy(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the session policy: %w", err)
+	}
+	policy, err := CompactSessionPolicy(string(data))
+	if err == nil && policy == "" {
+		err = fmt.Errorf("the session policy in %v is empty", path)
+	}
+	return policy, err
+}
+
+// CompactSessionPolicy checks an IAM policy document is JSON and removes its
+// whitespace, as AWS counts it against the size limit of session policies.
+func CompactSessionPolicy(policy string) (string, error) {
+	if strings.TrimSpace(policy) == "" {
+		return "", nil
+	}
+	var compact bytes.Buffer
+	err := json.Compact(&compact, []byte(policy))
+	if err != nil {
+		return "", fmt.Errorf("the session policy is not valid JSON: %w", err)
+	}
+	return compact.String(), nil
+}
+
+// SessionPolicyID identifies a compacted session policy in cache keys, so
+// downscoped keys are never served in place of full ones or keys downscoped
+// with a different policy.
+func SessionPolicyID(policy string) string {
+	sum := sha256.Sum256([]byte(policy))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Process assumes the role with the session policy.
+func (p *sessionPolicyProcessor) Process(stak kion.STAK, target STAKTarget) (kion.STAK, error) {
+	// the role and session name default to those the keys were issued under
+	caller, err := stsCallerARN(stak, p.region)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+	roleARN, session := assumedRole(caller)
+	if p.roleARN != nil {
+		var b strings.Builder
+		err = p.roleARN.Execute(&b, target)
+		if err != nil {
+			return kion.STAK{}, fmt.Errorf("invalid role_arn template: %w", err)
+		}
+		roleARN = b.String()
+	}
+	if roleARN == "" {
+		return kion.STAK{}, fmt.Errorf("unable to tell the role of %v, set role_arn", caller)
+	}
+	if session == "" {
+		session = "kion-cli"
+	}
+
+	params := url.Values{}
+	params.Set("Action", "AssumeRole")
+	params.Set("RoleArn", roleARN)
+	params.Set("RoleSessionName", session)
+	params.Set("Policy", p.policy)
+	params.Set("DurationSeconds", fmt.Sprint(int64(p.duration.Seconds())))
+	var response struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	err = stsRequest(stak, p.region, params, &response)
+	if err != nil {
+		return kion.STAK{}, fmt.Errorf("unable to assume %v with the session policy: %w", roleARN, err)
+	}
+
+	credentials := response.Credentials
+	return kion.STAK{
+		AccessKey:       credentials.AccessKeyId,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Duration:        int64(p.duration.Seconds()),
+		Expiration:      credentials.Expiration,
+	}, nil
+}
+
+// assumedRole returns the IAM role ARN and session name of an assumed role
+// ARN such as arn:aws:sts::111122223333:assumed-role/Admin/jane, both empty
+// if it isn't one. Paths are not part of assumed role ARNs so roles with a
+// path can't be told.
+func assumedRole(arn string) (string, string) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" {
+		return "", ""
+	}
+	resource := strings.Split(parts[5], "/")
+	if len(resource) != 3 || resource[0] != "assumed-role" {
+		return "", ""
+	}
+	return fmt.Sprintf("arn:%v:iam::%v:role/%v", parts[1], parts[4], resource[1]), resource[2]
+}
+
+// stsCallerARN returns the ARN the keys belong to.
+func stsCallerARN(stak kion.STAK, region string) (string, error) {
+	params := url.Values{}
+	params.Set("Action", "GetCallerIdentity")
+	var response struct {
+		Arn string `xml:"GetCallerIdentityResult>Arn"`
+	}
+	err := stsRequest(stak, region, params, &response)
+	if err != nil {
+		return "", fmt.Errorf("unable to identify the short term access keys: %w", err)
+	}
+	return response.Arn, nil
+}
+
+// stsRequest calls an STS query API action and decodes its XML response.
+func stsRequest(stak kion.STAK, region string, params url.Values, response any) error {
+	params.Set("Version", "2011-06-15")
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"}
+	_, body, err := awsRequest(stak, region, "sts", awsEndpoint("sts", region)+"/", headers, []byte(params.Encode()))
+	if err != nil {
+		return err
+	}
+	err = xml.Unmarshal(body, response)
+	if err != nil {
+		return fmt.Errorf("unexpected response to %v: %w", params.Get("Action"), err)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Command                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// commandProcessor hands keys to a program in the credential_process format
+// on stdin and uses the keys it prints in the same format, so organizations
+// can apply their own guardrails. KION_ACCOUNT_NUM and KION_CAR describe
+// where the keys are for.
+type commandProcessor struct {
+	command []string
+}
+
+// newCommandProcessor builds a command processor.
+func newCommandProcessor(settings structs.STAKProcessor) (STAKProcessor, error) {
+	if len(settings.Command) == 0 {
+		return nil, errors.New("a command processor needs a command")
+	}
+	return &commandProcessor{command: settings.Command}, nil
+}
+
+// Process runs the command.
+func (p *commandProcessor) Process(stak kion.STAK, target STAKTarget) (kion.STAK, error) {
+	var stdin, stdout bytes.Buffer
+	err := PrintCredentialProcess(&stdin, stak)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stdin = &stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("KION_ACCOUNT_NUM=%v", target.Account),
+		fmt.Sprintf("KION_CAR=%v", target.CAR),
+	)
+	err = cmd.Run()
+	if err != nil {
+		return kion.STAK{}, fmt.Errorf("%v: %w", p.command[0], err)
+	}
+
+	var credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	}
+	err = json.Unmarshal(stdout.Bytes(), &credentials)
+	if err != nil || credentials.AccessKeyId == "" || credentials.SecretAccessKey == "" {
+		return kion.STAK{}, fmt.Errorf("%v did not print credentials in the credential_process format", p.command[0])
+	}
+
+	processed := kion.STAK{
+		AccessKey:       credentials.AccessKeyId,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Duration:        stak.Duration,
+		Expiration:      stak.Expiration,
+	}
+	if !credentials.Expiration.IsZero() && (stak.Expiration.IsZero() || credentials.Expiration.Before(stak.Expiration)) {
+		processed.Expiration = credentials.Expiration
+		processed.Duration = int64(time.Until(credentials.Expiration).Seconds())
+	}
+	return processed, nil
+}
@@ -0,0 +1,246 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestNewSTAKProcessors(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(policyFile, []byte(`{"Version": "2012-10-17", "Statement": []}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		settings    structs.STAKProcessor
+		wantErr     bool
+	}{
+		{"Inline Policy", structs.STAKProcessor{Type: "session_policy", Policy: `{"Version": "2012-10-17"}`}, false},
+		{"Policy File", structs.STAKProcessor{Type: "session_policy", PolicyFile: policyFile}, false},
+		{"Both Policies", structs.STAKProcessor{Type: "session_policy", Policy: "{}", PolicyFile: policyFile}, true},
+		{"No Policy", structs.STAKProcessor{Type: "session_policy"}, true},
+		{"Invalid Policy", structs.STAKProcessor{Type: "session_policy", Policy: "Allow: *"}, true},
+		{"Short Duration", structs.STAKProcessor{Type: "session_policy", Policy: "{}", Duration: "5m"}, true},
+		{"Invalid Role Template", structs.STAKProcessor{Type: "session_policy", Policy: "{}", RoleARN: "{{.Account"}, true},
+		{"Command", structs.STAKProcessor{Type: "command", Command: []string{"guard"}}, false},
+		{"No Command", structs.STAKProcessor{Type: "command"}, true},
+		{"Unknown Type", structs.STAKProcessor{Type: "federation_token"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := NewSTAKProcessors([]structs.STAKProcessor{test.settings})
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadSessionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		description string
+		path        string
+		want        string
+		wantErr     bool
+	}{
+		{"Compacted", write("policy.json", "{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": []\n}\n"), `{"Version":"2012-10-17","Statement":[]}`, false},
+		{"Empty", write("empty.json", "\n"), "", true},
+		{"Invalid", write("invalid.json", "Allow: *"), "", true},
+		{"Missing", filepath.Join(dir, "missing.json"), "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ReadSessionPolicy(test.path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSessionPolicyID(t *testing.T) {
+	read := SessionPolicyID(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`)
+	write := SessionPolicyID(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Put*","Resource":"*"}]}`)
+	if len(read) != 12 {
+		t.Errorf("got id %q, wanted 12 hex characters", read)
+	}
+	if read == write {
+		t.Errorf("different policies share the id %q", read)
+	}
+	if read != SessionPolicyID(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`) {
+		t.Error("the same policy got a different id")
+	}
+}
+
+func TestAssumedRole(t *testing.T) {
+	tests := []struct {
+		description string
+		arn         string
+		wantRole    string
+		wantSession string
+	}{
+		{"Assumed Role", "arn:aws:sts::111122223333:assumed-role/Admin/jane", "arn:aws:iam::111122223333:role/Admin", "jane"},
+		{"GovCloud", "arn:aws-us-gov:sts::111122223333:assumed-role/Admin/jane", "arn:aws-us-gov:iam::111122223333:role/Admin", "jane"},
+		{"IAM User", "arn:aws:iam::111122223333:user/jane", "", ""},
+		{"Not An ARN", "jane", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			role, session := assumedRole(test.arn)
+			if role != test.wantRole || session != test.wantSession {
+				t.Errorf("got %q %q, wanted %q %q", role, session, test.wantRole, test.wantSession)
+			}
+		})
+	}
+}
+
+func TestSessionPolicyProcessor(t *testing.T) {
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.PostForm.Get("Action") {
+		case "GetCallerIdentity":
+			fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Arn>arn:aws:sts::111122223333:assumed-role/Admin/jane</Arn></GetCallerIdentityResult></GetCallerIdentityResponse>`)
+		case "AssumeRole":
+			got = map[string]string{
+				"RoleArn":         r.PostForm.Get("RoleArn"),
+				"RoleSessionName": r.PostForm.Get("RoleSessionName"),
+				"Policy":          r.PostForm.Get("Policy"),
+				"DurationSeconds": r.PostForm.Get("DurationSeconds"),
+			}
+			fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>ASIADOWN</AccessKeyId><SecretAccessKey>down</SecretAccessKey><SessionToken>token</SessionToken><Expiration>%v</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`, expiration.Format(time.RFC3339))
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	original := awsEndpoint
+	defer func() { awsEndpoint = original }()
+	awsEndpoint = func(service string, region string) string {
+		return server.URL
+	}
+
+	tests := []struct {
+		description string
+		roleARN     string
+		wantRole    string
+	}{
+		{"Issued Role", "", "arn:aws:iam::111122223333:role/Admin"},
+		{"Role Template", "arn:aws:iam::{{.Account}}:role/guarded/{{.CAR}}", "arn:aws:iam::111122223333:role/guarded/Admin"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			processors, err := NewSTAKProcessors([]structs.STAKProcessor{{
+				Type:     "session_policy",
+				Policy:   "{\n  \"Version\": \"2012-10-17\"\n}",
+				RoleARN:  test.roleARN,
+				Duration: "30m",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stak, err := ProcessSTAK(processors, kion.STAK{AccessKey: "ASIAKION", SecretAccessKey: "secret"}, STAKTarget{Account: "111122223333", CAR: "Admin"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := kion.STAK{AccessKey: "ASIADOWN", SecretAccessKey: "down", SessionToken: "token", Duration: 1800, Expiration: expiration}
+			if stak != want {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", stak, want)
+			}
+			wantRequest := map[string]string{
+				"RoleArn":         test.wantRole,
+				"RoleSessionName": "jane",
+				"Policy":          `{"Version":"2012-10-17"}`,
+				"DurationSeconds": "1800",
+			}
+			if fmt.Sprint(got) != fmt.Sprint(wantRequest) {
+				t.Errorf("\ngot request:\n  %v\nwanted:\n  %v", got, wantRequest)
+			}
+		})
+	}
+}
+
+func TestCommandProcessor(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	stak := kion.STAK{AccessKey: "ASIAKION", SecretAccessKey: "secret", SessionToken: "token", Duration: 3600, Expiration: expiration}
+	target := STAKTarget{Account: "111122223333", CAR: "Admin"}
+
+	tests := []struct {
+		description string
+		script      string
+		want        kion.STAK
+		wantErr     bool
+	}{
+		{
+			"Transformed",
+			`sed "s/ASIAKION/ASIA$KION_CAR$KION_ACCOUNT_NUM/"`,
+			kion.STAK{AccessKey: "ASIAAdmin111122223333", SecretAccessKey: "secret", SessionToken: "token", Duration: 3600, Expiration: expiration},
+			false,
+		},
+		{
+			"Failed",
+			"exit 3",
+			kion.STAK{},
+			true,
+		},
+		{
+			"Not Credentials",
+			"echo denied",
+			kion.STAK{},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			processors, err := NewSTAKProcessors([]structs.STAKProcessor{{Type: "command", Command: []string{"/bin/sh", "-c", test.script}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ProcessSTAK(processors, stak, target)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Structured Output                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// OutputFormats are the formats commands can write their results in, text
+// being the human readable default.
+var OutputFormats = []string{"text", "json", "yaml", "env", "powershell", "cmd", "azure-devops"}
+
+// ValidateOutputFormat returns an error if format isn't one of OutputFormats.
+func ValidateOutputFormat(format string) error {
+	if !slices.Contains(OutputFormats, format) {
+		return fmt.Errorf("unsupported output format %q, expected one of %v", format, strings.Join(OutputFormats, ", "))
+	}
+	return nil
+}
+
+// EnvOutput is a result that can also be written as environment variables,
+// such as credentials.
+type EnvOutput interface {
+	// EnvVars returns the variables to set as name=value pairs.
+	EnvVars() []string
+}
+
+// WriteOutput writes a result to w in format. JSON and YAML are written from
+// the result's fields, env, powershell, and cmd as statements setting each
+// variable in that shell and azure-devops as pipeline logging commands for
+// results that are an EnvOutput, and text by calling text. Other than JSON,
+// YAML, and env, output is restricted to ASCII if ASCIIOutput is set.
+func WriteOutput(w io.Writer, format string, result any, text func(w io.Writer) error) error {
+	w = OutputWriter(w, format)
+	switch format {
+	case "", "text":
+		return text(w)
+	case "json":
+		data, err := versionedJSON(result)
+		if err != nil {
+			return err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, indented.String())
+		return err
+	case "yaml":
+		data, err := yamlv3.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "env", "powershell", "cmd":
+		env, ok := result.(EnvOutput)
+		if !ok {
+			return fmt.Errorf("%v output is only available for credentials, use json or yaml", format)
+		}
+		shell := format
+		if format == "env" {
+			shell = "bash"
+		}
+		exports, err := ShellExports(shell, env.EnvVars())
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, exports)
+		return err
+	case "azure-devops":
+		env, ok := result.(EnvOutput)
+		if !ok {
+			return fmt.Errorf("azure-devops output is only available for credentials, use json or yaml")
+		}
+		_, err := io.WriteString(w, AzureDevOpsVariables(env.EnvVars()))
+		return err
+	default:
+		return ValidateOutputFormat(format)
+	}
+}
+
+// OutputSchemaVersion is the version of the JSON results commands write, set
+// as schema_version on every record. Fields are only ever added within a
+// version, removing a field or changing its meaning bumps it.
+const OutputSchemaVersion = 1
+
+// versionedJSON marshals result with schema_version set on its records, the
+// result itself when it is a struct, or its elements or values when it is a
+// list or map of them.
+func versionedJSON(result any) ([]byte, error) {
+	v := reflect.ValueOf(result)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			break
+		}
+		records := make([]json.RawMessage, v.Len())
+		for i := range records {
+			record, err := versionedJSON(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			records[i] = record
+		}
+		return json.Marshal(records)
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		records := make(map[string]json.RawMessage, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			record, err := versionedJSON(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			records[iter.Key().String()] = record
+		}
+		return json.Marshal(records)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil || v.Kind() != reflect.Struct || !bytes.HasPrefix(data, []byte("{")) {
+		return data, err
+	}
+	version := fmt.Sprintf(`{"schema_version":%d`, OutputSchemaVersion)
+	if bytes.Equal(data, []byte("{}")) {
+		return []byte(version + "}"), nil
+	}
+	return append([]byte(version+","), data[1:]...), nil
+}
+
+// STAKOutput is the structured form of short term access keys.
+type STAKOutput struct {
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" yaml:"secret_access_key"`
+	SessionToken    string `json:"session_token" yaml:"session_token"`
+	Expiration      string `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+	Region          string `json:"region,omitempty" yaml:"region,omitempty"`
+	Account         string `json:"account" yaml:"account"`
+	CAR             string `json:"cloud_access_role" yaml:"cloud_access_role"`
+}
+
+// NewSTAKOutput returns the structured form of short term access keys issued
+// for a cloud access role in an account.
+func NewSTAKOutput(stak kion.STAK, account string, car string, region string) STAKOutput {
+	output := STAKOutput{
+		AccessKeyID:     stak.AccessKey,
+		SecretAccessKey: stak.SecretAccessKey,
+		SessionToken:    stak.SessionToken,
+		Region:          region,
+		Account:         account,
+		CAR:             car,
+	}
+	if !stak.Expiration.IsZero() {
+		output.Expiration = stak.Expiration.UTC().Format(time.RFC3339)
+	}
+	return output
+}
+
+// EnvVars returns the variables the AWS CLI and SDKs read credentials from.
+func (s STAKOutput) EnvVars() []string {
+	var vars []string
+	if s.Region != "" {
+		vars = append(vars, "AWS_REGION="+s.Region)
+	}
+	vars = append(vars,
+		"AWS_ACCESS_KEY_ID="+s.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY="+s.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+s.SessionToken,
+	)
+	if s.Expiration != "" {
+		vars = append(vars, "AWS_CREDENTIAL_EXPIRATION="+s.Expiration)
+	}
+	return vars
+}
+
+// Identity describes who Kion CLI acts as, without signing in.
+type Identity struct {
+	URL            string `json:"url" yaml:"url"`
+	Profile        string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Username       string `json:"username,omitempty" yaml:"username,omitempty"`
+	IDMS           string `json:"idms_id,omitempty" yaml:"idms_id,omitempty"`
+	Auth           string `json:"auth" yaml:"auth"`
+	SessionExpires string `json:"session_expires,omitempty" yaml:"session_expires,omitempty"`
+	RefreshExpires string `json:"refresh_expires,omitempty" yaml:"refresh_expires,omitempty"`
+	DeviceID       string `json:"device_id,omitempty" yaml:"device_id,omitempty"`
+	Cache          string `json:"cache,omitempty" yaml:"cache,omitempty"`
+}
+
+// PrintIdentity prints who Kion CLI acts as.
+func PrintIdentity(w io.Writer, identity Identity, now time.Time) error {
+	return identityTable(identity, now).Write(w)
+}
+
+// identityTable lays out who Kion CLI acts as, one row per detail.
+func identityTable(identity Identity, now time.Time) *Table {
+	table := NewTable("URL:", identity.URL)
+	if identity.Profile != "" {
+		table.AddRow("Profile:", identity.Profile)
+	}
+	if identity.Username != "" {
+		user := identity.Username
+		if identity.IDMS != "" {
+			user = fmt.Sprintf("%v (IDMS %v)", user, identity.IDMS)
+		}
+		table.AddRow("User:", user)
+	}
+	auth := identity.Auth
+	if expires, err := time.Parse(time.RFC3339, identity.SessionExpires); err == nil {
+		auth = fmt.Sprintf("%v, %v", auth, describeExpiry(expires, now))
+	}
+	table.AddRow("Auth:", auth)
+	if expires, err := time.Parse(time.RFC3339, identity.RefreshExpires); err == nil {
+		table.AddRow("Refresh:", describeExpiry(expires, now))
+	}
+	if identity.DeviceID != "" {
+		table.AddRow("Device:", identity.DeviceID)
+	}
+	if identity.Cache != "" {
+		table.AddRow("Cache:", identity.Cache)
+	}
+	return table
+}
+
+// describeExpiry describes when something expires or expired relative to now.
+func describeExpiry(expires time.Time, now time.Time) string {
+	if !expires.After(now) {
+		return fmt.Sprintf("expired %v (%v ago)", expires.Local().Format(time.RFC3339), now.Sub(expires).Round(time.Second))
+	}
+	return fmt.Sprintf("expires %v (%v left)", expires.Local().Format(time.RFC3339), expires.Sub(now).Round(time.Second))
+}
+
+// FavoriteOutput is the structured form of a favorite.
+type FavoriteOutput struct {
+	Name           string `json:"name" yaml:"name"`
+	Account        string `json:"account,omitempty" yaml:"account,omitempty"`
+	AccountAlias   string `json:"account_alias,omitempty" yaml:"account_alias,omitempty"`
+	CAR            string `json:"cloud_access_role,omitempty" yaml:"cloud_access_role,omitempty"`
+	AccessType     string `json:"access_type" yaml:"access_type"`
+	Region         string `json:"region,omitempty" yaml:"region,omitempty"`
+	Cloud          string `json:"cloud,omitempty" yaml:"cloud,omitempty"`
+	BrowserProfile string `json:"browser_profile,omitempty" yaml:"browser_profile,omitempty"`
+	SessionPolicy  string `json:"session_policy,omitempty" yaml:"session_policy,omitempty"`
+}
+
+// NewFavoriteOutputs returns the structured form of favorites, sorted by
+// name, with the access type and cloud filled in where defaulted.
+func NewFavoriteOutputs(favorites []structs.Favorite) []FavoriteOutput {
+	outputs := []FavoriteOutput{}
+	for _, favorite := range favorites {
+		accessType := favorite.AccessType
+		if accessType == "" {
+			accessType = kion.AccessLevelCLI
+		}
+		outputs = append(outputs, FavoriteOutput{
+			Name:           favorite.Name,
+			Account:        favorite.Account,
+			AccountAlias:   favorite.AccountAlias,
+			CAR:            favorite.CAR,
+			AccessType:     accessType,
+			Region:         favorite.Region,
+			Cloud:          FavoriteCloud(favorite),
+			BrowserProfile: favorite.BrowserProfile,
+			SessionPolicy:  favorite.SessionPolicy,
+		})
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Name < outputs[j].Name
+	})
+	return outputs
+}
+
+// CacheEntryOutput is the structured form of a cache entry.
+type CacheEntryOutput struct {
+	Category string `json:"category" yaml:"category"`
+	Key      string `json:"key" yaml:"key"`
+	Expires  string `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Expired  bool   `json:"expired" yaml:"expired"`
+}
+
+// PathOutput is the structured form of a file Kion CLI keeps.
+type PathOutput struct {
+	File string `json:"file" yaml:"file"`
+	Path string `json:"path" yaml:"path"`
+}
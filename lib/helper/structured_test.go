@@ -0,0 +1,252 @@
+package helper
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestWriteOutput(t *testing.T) {
+	stak := kion.STAK{
+		AccessKey:       "ASIAKION",
+		SecretAccessKey: "it's secret",
+		SessionToken:    "token",
+		Expiration:      time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	output := NewSTAKOutput(stak, "111122223333", "Admin", "us-east-1")
+	text := func(w io.Writer) error {
+		_, err := io.WriteString(w, "text\n")
+		return err
+	}
+
+	tests := []struct {
+		description string
+		format      string
+		result      any
+		want        string
+		wantErr     bool
+	}{
+		{
+			"Text",
+			"text",
+			output,
+			"text\n",
+			false,
+		},
+		{
+			"JSON",
+			"json",
+			output,
+			`{
+  "schema_version": 1,
+  "access_key_id": "ASIAKION",
+  "secret_access_key": "it's secret",
+  "session_token": "token",
+  "expiration": "2030-01-02T03:04:05Z",
+  "region": "us-east-1",
+  "account": "111122223333",
+  "cloud_access_role": "Admin"
+}
+`,
+			false,
+		},
+		{
+			"YAML",
+			"yaml",
+			output,
+			`access_key_id: ASIAKION
+secret_access_key: it's secret
+session_token: token
+expiration: "2030-01-02T03:04:05Z"
+region: us-east-1
+account: "111122223333"
+cloud_access_role: Admin
+`,
+			false,
+		},
+		{
+			"Env",
+			"env",
+			output,
+			`export AWS_REGION='us-east-1'
+export AWS_ACCESS_KEY_ID='ASIAKION'
+export AWS_SECRET_ACCESS_KEY='it'\''s secret'
+export AWS_SESSION_TOKEN='token'
+export AWS_CREDENTIAL_EXPIRATION='2030-01-02T03:04:05Z'
+`,
+			false,
+		},
+		{
+			"Env Without Credentials",
+			"env",
+			[]PathOutput{{File: "state", Path: "/tmp"}},
+			"",
+			true,
+		},
+		{
+			"Azure DevOps",
+			"azure-devops",
+			output,
+			`##vso[task.setvariable variable=AWS_REGION]us-east-1
+##vso[task.setvariable variable=AWS.Region]us-east-1
+##vso[task.setvariable variable=AWS_ACCESS_KEY_ID;issecret=true]ASIAKION
+##vso[task.setvariable variable=AWS.AccessKeyID;issecret=true]ASIAKION
+##vso[task.setvariable variable=AWS_SECRET_ACCESS_KEY;issecret=true]it's secret
+##vso[task.setvariable variable=AWS.SecretAccessKey;issecret=true]it's secret
+##vso[task.setvariable variable=AWS_SESSION_TOKEN;issecret=true]token
+##vso[task.setvariable variable=AWS.SessionToken;issecret=true]token
+##vso[task.setvariable variable=AWS_CREDENTIAL_EXPIRATION]2030-01-02T03:04:05Z
+`,
+			false,
+		},
+		{
+			"Azure DevOps Without Credentials",
+			"azure-devops",
+			[]PathOutput{{File: "state", Path: "/tmp"}},
+			"",
+			true,
+		},
+		{
+			"Empty List",
+			"json",
+			[]PathOutput{},
+			"[]\n",
+			false,
+		},
+		{
+			"Versioned List",
+			"json",
+			[]PathOutput{{File: "state", Path: "/tmp"}},
+			`[
+  {
+    "schema_version": 1,
+    "file": "state",
+    "path": "/tmp"
+  }
+]
+`,
+			false,
+		},
+		{
+			"Versioned Map",
+			"json",
+			map[string]PinOutput{"111122223333": {Account: "111122223333", Pinned: "2030-01-02T03:04:05Z"}},
+			`{
+  "111122223333": {
+    "schema_version": 1,
+    "account": "111122223333",
+    "pinned": "2030-01-02T03:04:05Z"
+  }
+}
+`,
+			false,
+		},
+		{
+			"Nil List",
+			"json",
+			[]PathOutput(nil),
+			"null\n",
+			false,
+		},
+		{
+			"Unknown Format",
+			"xml",
+			output,
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var b bytes.Buffer
+			err := WriteOutput(&b, test.format, test.result, text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if b.String() != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestNewFavoriteOutputs(t *testing.T) {
+	favorites := []structs.Favorite{
+		{Name: "sandbox", Account: "111122223333", CAR: "Admin", AccessType: "web"},
+		{Name: "prod", AccountAlias: "payments-*-prod", CAR: "ReadOnly", Region: "us-west-2", Cloud: "aws"},
+	}
+	want := []FavoriteOutput{
+		{Name: "prod", AccountAlias: "payments-*-prod", CAR: "ReadOnly", AccessType: "cli", Region: "us-west-2", Cloud: "aws"},
+		{Name: "sandbox", Account: "111122223333", CAR: "Admin", AccessType: "web", Cloud: "aws"},
+	}
+	if got := NewFavoriteOutputs(favorites); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+	}
+}
+
+func TestPrintIdentity(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		identity    Identity
+		want        []string
+	}{
+		{
+			"API Key",
+			Identity{URL: "https://kion.example.com", Auth: "api_key", Cache: "keyring (keyctl)"},
+			[]string{"URL: https://kion.example.com", "Auth: api_key", "Cache: keyring (keyctl)"},
+		},
+		{
+			"Session",
+			Identity{
+				URL:            "https://kion.example.com",
+				Username:       "jane",
+				IDMS:           "2",
+				Auth:           "session",
+				SessionExpires: "2026-10-16T12:30:00Z",
+				RefreshExpires: "2026-10-16T20:00:00Z",
+				Cache:          "disabled",
+			},
+			[]string{
+				"URL: https://kion.example.com",
+				"User: jane (IDMS 2)",
+				"Auth: session, expires " + now.Add(30*time.Minute).Local().Format(time.RFC3339) + " (30m0s left)",
+				"Refresh: expires " + now.Add(8*time.Hour).Local().Format(time.RFC3339) + " (8h0m0s left)",
+				"Cache: disabled",
+			},
+		},
+		{
+			"Expired Session",
+			Identity{URL: "https://kion.example.com", Auth: "expired session", SessionExpires: "2026-10-16T11:55:00Z"},
+			[]string{
+				"URL: https://kion.example.com",
+				"Auth: expired session, expired " + now.Add(-5*time.Minute).Local().Format(time.RFC3339) + " (5m0s ago)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var b bytes.Buffer
+			err := PrintIdentity(&b, test.identity, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+				got = append(got, strings.Join(strings.Fields(line), " "))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", strings.Join(got, "\n  "), strings.Join(test.want, "\n  "))
+			}
+		})
+	}
+}
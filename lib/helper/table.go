@@ -0,0 +1,84 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tables                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Table collects rows of cells and writes them as columns aligned by display
+// width. Unlike text/tabwriter, which counts runes, wide characters such as
+// CJK and emoji are counted as the two terminal cells they occupy so names
+// containing them don't push later columns out of line. Characters of
+// ambiguous width follow the locale.
+type Table struct {
+	rows [][]string
+}
+
+// NewTable returns a table starting with the given header row.
+func NewTable(header ...string) *Table {
+	return &Table{rows: [][]string{header}}
+}
+
+// AddRow adds a row of cells to the table, formatting each with %v. Cells are
+// converted with ToASCII if ASCIIOutput is set so columns are aligned on the
+// text that is shown.
+func (t *Table) AddRow(cells ...any) {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = fmt.Sprint(cell)
+		if ASCIIOutput {
+			row[i] = ToASCII(row[i])
+		}
+	}
+	t.rows = append(t.rows, row)
+}
+
+// Write writes the table to w with two spaces between columns.
+func (t *Table) Write(w io.Writer) error {
+	for _, line := range alignColumns(t.rows, 2) {
+		_, err := fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alignColumns joins the cells of each row, padding every cell but the last
+// to the display width of the widest cell in its column and separating
+// columns by gap spaces.
+func alignColumns(rows [][]string, gap int) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], runewidth.StringWidth(cell))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for r, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(runewidth.FillRight(cell, widths[i]))
+			b.WriteString(strings.Repeat(" ", gap))
+		}
+		lines[r] = b.String()
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTableWrite(t *testing.T) {
+	tests := []struct {
+		description string
+		header      []string
+		rows        [][]any
+		want        string
+	}{
+		{
+			"ascii",
+			[]string{"NAME", "STATUS"},
+			[][]any{{"health", "ok"}, {"saml metadata", "skip"}},
+			"NAME           STATUS\n" +
+				"health         ok\n" +
+				"saml metadata  skip\n",
+		},
+		{
+			"cjk and emoji",
+			[]string{"ACCOUNT", "NUMBER", "NOTE"},
+			[][]any{{"支付生产", 111111111111, "prod"}, {"🚀 launch", 222222222222, "dev"}, {"billing", 333333333333, "ops"}},
+			"ACCOUNT    NUMBER        NOTE\n" +
+				"支付生产   111111111111  prod\n" +
+				"🚀 launch  222222222222  dev\n" +
+				"billing    333333333333  ops\n",
+		},
+		{
+			"combining marks",
+			[]string{"NAME", "ID"},
+			[][]any{{"café", 1}, {"tea", 2}},
+			"NAME  ID\n" +
+				"café  1\n" +
+				"tea   2\n",
+		},
+		{
+			"ragged rows",
+			[]string{"A", "B", "C"},
+			[][]any{{"x"}, {"long", "y", "z"}},
+			"A     B  C\n" +
+				"x\n" +
+				"long  y  z\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			table := NewTable(test.header...)
+			for _, row := range test.rows {
+				table.AddRow(row...)
+			}
+			var b bytes.Buffer
+			err := table.Write(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Errorf("\ngot:\n%v\nwanted:\n%v", b.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timing                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// PrintTimings writes a breakdown of where a run spent its time, the phase
+// it spent the most in first, followed by the time spent in the CLI itself
+// and the run's total.
+func PrintTimings(w io.Writer, breakdown kion.TimingBreakdown) error {
+	table := NewTable("PHASE", "CALLS", "TOTAL", "SHARE", "SLOWEST", "SLOWEST CALL")
+	for _, phase := range breakdown.Phases {
+		table.AddRow(phase.Phase, phase.Calls, roundTiming(phase.Total), share(phase.Total, breakdown.Total), roundTiming(phase.Slowest), phase.SlowestDetail)
+	}
+	table.AddRow("Kion CLI", "-", roundTiming(breakdown.Other), share(breakdown.Other, breakdown.Total), "-", "")
+	table.AddRow("total", "-", roundTiming(breakdown.Total), "", "-", "")
+	return table.Write(w)
+}
+
+// roundTiming rounds d to the millisecond, or to the microsecond when under
+// one so quick calls such as cache lookups don't show as taking nothing.
+func roundTiming(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// share returns part as a percentage of total.
+func share(part time.Duration, total time.Duration) string {
+	if total <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)/float64(total)*100)
+}
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+func TestPrintTimings(t *testing.T) {
+	breakdown := kion.TimingBreakdown{
+		Total: 4 * time.Second,
+		Phases: []kion.PhaseTiming{
+			{Phase: kion.PhaseIdP, Calls: 3, Total: 3 * time.Second, Slowest: 2 * time.Second, SlowestDetail: "POST idp.example/sso"},
+			{Phase: kion.PhaseKion, Calls: 1, Total: 500 * time.Millisecond, Slowest: 500 * time.Millisecond, SlowestDetail: "GET kion.example/api/v3/me"},
+		},
+		Other: 500 * time.Millisecond,
+	}
+
+	var out bytes.Buffer
+	err := PrintTimings(&out, breakdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		"PHASE              CALLS  TOTAL  SHARE  SLOWEST  SLOWEST CALL",
+		"identity provider  3      3s     75%    2s       POST idp.example/sso",
+		"Kion API           1      500ms  12%    500ms    GET kion.example/api/v3/me",
+		"Kion CLI           -      500ms  12%    -",
+		"total              -      4s            -",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got:\n%v\nwanted:\n%v", out.String(), strings.Join(want, "\n"))
+	}
+	for i := range want {
+		if strings.TrimRight(lines[i], " ") != want[i] {
+			t.Errorf("\ngot:\n  %q\nwanted:\n  %q", lines[i], want[i])
+		}
+	}
+}
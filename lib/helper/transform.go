@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"slices"
 	"sort"
+	"strings"
 
 	"github.com/kionsoftware/kion-cli/lib/kion"
 	"github.com/kionsoftware/kion-cli/lib/structs"
@@ -31,12 +32,19 @@ func MapProjects(projects []kion.Project) ([]string, map[string]kion.Project) {
 }
 
 // MapAccounts transforms a slice of Accounts into a slice of their names and a
-// map indexed by their names.
+// map indexed by their names. Names are tagged with the cloud provider when
+// the accounts span more than one.
 func MapAccounts(accounts []kion.Account) ([]string, map[string]kion.Account) {
+	var clouds []string
+	for _, account := range accounts {
+		clouds = append(clouds, account.Cloud())
+	}
+	mixed := mixedClouds(clouds)
+
 	var aNames []string
 	aMap := make(map[string]kion.Account)
 	for _, account := range accounts {
-		name := fmt.Sprintf("%v (%v)", account.Name, account.Number)
+		name := fmt.Sprintf("%v (%v)%v", account.Name, account.Number, cloudLabel(account.Cloud(), mixed))
 		aNames = append(aNames, name)
 		aMap[name] = account
 	}
@@ -49,13 +57,22 @@ func MapAccounts(accounts []kion.Account) ([]string, map[string]kion.Account) {
 // and a map of account numbers indexed by their names. If a project ID is
 // passed it will only return accounts in the given project. Note that some
 // versions of Kion will not populate account metadata in CAR objects so use
-// carefully (see useUpdatedCloudAccessRoleAPI bool).
+// carefully (see UseUpdatedCARAPI). Names are tagged with the cloud provider
+// when the accounts span more than one.
 func MapAccountsFromCARS(cars []kion.CAR, pid uint) ([]string, map[string]string) {
+	var clouds []string
+	for _, car := range cars {
+		if pid == 0 || car.ProjectID == pid {
+			clouds = append(clouds, car.Cloud())
+		}
+	}
+	mixed := mixedClouds(clouds)
+
 	var aNames []string
 	aMap := make(map[string]string)
 	for _, car := range cars {
 		if pid == 0 || car.ProjectID == pid {
-			name := fmt.Sprintf("%v (%v)", car.AccountName, car.AccountNumber)
+			name := fmt.Sprintf("%v (%v)%v", car.AccountName, car.AccountNumber, cloudLabel(car.Cloud(), mixed))
 			if slices.Contains(aNames, name) {
 				continue
 			}
@@ -74,7 +91,7 @@ func MapCAR(cars []kion.CAR) ([]string, map[string]kion.CAR) {
 	var cNames []string
 	cMap := make(map[string]kion.CAR)
 	for _, car := range cars {
-		name := fmt.Sprintf("%v (%v)", car.Name, car.ID)
+		name := fmt.Sprintf("%v (%v)%v", car.Name, car.ID, accessLevelsLabel(car))
 		cNames = append(cNames, name)
 		cMap[name] = car
 	}
@@ -83,6 +100,94 @@ func MapCAR(cars []kion.CAR) ([]string, map[string]kion.CAR) {
 	return cNames, cMap
 }
 
+// MapCARWithAccounts transforms a slice of CARs spanning multiple accounts
+// into a slice of names that include the account and a map indexed by those
+// names. Accounts are aligned in a column by display width so they line up
+// even when role names contain wide characters.
+func MapCARWithAccounts(cars []kion.CAR) ([]string, map[string]kion.CAR) {
+	var rows [][]string
+	for _, car := range cars {
+		rows = append(rows, []string{
+			fmt.Sprintf("%v (%v)", car.Name, car.ID),
+			fmt.Sprintf("on %v (%v)%v", car.AccountName, car.AccountNumber, accessLevelsLabel(car)),
+		})
+	}
+
+	var cNames []string
+	cMap := make(map[string]kion.CAR)
+	for i, name := range alignColumns(rows, 1) {
+		cNames = append(cNames, name)
+		cMap[name] = cars[i]
+	}
+	sort.Strings(cNames)
+
+	return cNames, cMap
+}
+
+// accessLevelsLabel returns the access levels a CAR offers for display after
+// its name, so roles offering different access can be told apart.
+func accessLevelsLabel(car kion.CAR) string {
+	levels := car.AccessLevels()
+	if len(levels) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%v]", strings.Join(levels, ", "))
+}
+
+// mixedClouds reports whether more than one cloud provider is among clouds.
+func mixedClouds(clouds []string) bool {
+	var first string
+	for _, cloud := range clouds {
+		switch {
+		case cloud == "":
+		case first == "":
+			first = cloud
+		case cloud != first:
+			return true
+		}
+	}
+	return false
+}
+
+// cloudLabel returns the cloud provider for display after an account name
+// when accounts from several clouds are listed together.
+func cloudLabel(cloud string, mixed bool) string {
+	if !mixed || cloud == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%v]", CloudName(cloud))
+}
+
+// FilterCARsByCloud returns the CARs on accounts in the given cloud, or all of
+// them if cloud is empty. CARs whose cloud is unknown are kept.
+func FilterCARsByCloud(cars []kion.CAR, cloud string) []kion.CAR {
+	if cloud == "" {
+		return cars
+	}
+	var filtered []kion.CAR
+	for _, car := range cars {
+		if c := car.Cloud(); c == "" || c == cloud {
+			filtered = append(filtered, car)
+		}
+	}
+	return filtered
+}
+
+// FilterAccountsByCloud returns the accounts in the given cloud, or all of
+// them if cloud is empty. Accounts whose cloud is unknown are kept.
+func FilterAccountsByCloud(accounts []kion.Account, cloud string) []kion.Account {
+	if cloud == "" {
+		return accounts
+	}
+	var filtered []kion.Account
+	for _, account := range accounts {
+		if c := account.Cloud(); c == "" || c == cloud {
+			filtered = append(filtered, account)
+		}
+	}
+	return filtered
+}
+
 // MapIDMSs transforms a slice of IDMSs into a slice of their names and a map
 // indexed by their names.
 func MapIDMSs(idmss []kion.IDMS) ([]string, map[string]kion.IDMS) {
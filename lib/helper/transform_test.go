@@ -75,6 +75,21 @@ func TestMapAccounts(t *testing.T) {
 				fmt.Sprintf("%v (%v)", kionTestAccountsNames[5], kionTestAccounts[5].Number): kionTestAccounts[5],
 			},
 		},
+		{
+			"Mixed Clouds",
+			[]kion.Account{
+				{Name: "prod", Number: "111111111111", TypeID: 1},
+				{Name: "data", Number: "3f2504e0-4f89-11d3-9a0c-0305e82c3301"},
+			},
+			[]string{
+				"data (3f2504e0-4f89-11d3-9a0c-0305e82c3301) [Azure]",
+				"prod (111111111111) [AWS]",
+			},
+			map[string]kion.Account{
+				"prod (111111111111) [AWS]":                           {Name: "prod", Number: "111111111111", TypeID: 1},
+				"data (3f2504e0-4f89-11d3-9a0c-0305e82c3301) [Azure]": {Name: "data", Number: "3f2504e0-4f89-11d3-9a0c-0305e82c3301"},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -98,20 +113,20 @@ func TestMapCAR(t *testing.T) {
 			"Basic",
 			kionTestCARs,
 			[]string{
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[4], kionTestCARs[4].ID),
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[3], kionTestCARs[3].ID),
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[0], kionTestCARs[0].ID),
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[5], kionTestCARs[5].ID),
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[2], kionTestCARs[2].ID),
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[1], kionTestCARs[1].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[4], kionTestCARs[4].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[3], kionTestCARs[3].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[0], kionTestCARs[0].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[5], kionTestCARs[5].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[2], kionTestCARs[2].ID),
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[1], kionTestCARs[1].ID),
 			},
 			map[string]kion.CAR{
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[0], kionTestCARs[0].ID): kionTestCARs[0],
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[1], kionTestCARs[1].ID): kionTestCARs[1],
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[2], kionTestCARs[2].ID): kionTestCARs[2],
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[3], kionTestCARs[3].ID): kionTestCARs[3],
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[4], kionTestCARs[4].ID): kionTestCARs[4],
-				fmt.Sprintf("%v (%v)", kionTestCARsNames[5], kionTestCARs[5].ID): kionTestCARs[5],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[0], kionTestCARs[0].ID): kionTestCARs[0],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[1], kionTestCARs[1].ID): kionTestCARs[1],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[2], kionTestCARs[2].ID): kionTestCARs[2],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[3], kionTestCARs[3].ID): kionTestCARs[3],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[4], kionTestCARs[4].ID): kionTestCARs[4],
+				fmt.Sprintf("%v (%v) [cli, web]", kionTestCARsNames[5], kionTestCARs[5].ID): kionTestCARs[5],
 			},
 		},
 	}
@@ -126,6 +141,58 @@ func TestMapCAR(t *testing.T) {
 	}
 }
 
+func TestMapCARWithAccounts(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Admin", ID: 2, AccountName: "payments-west-prod", AccountNumber: "222222222222"},
+		{Name: "Admin", ID: 1, AccountName: "payments-east-prod", AccountNumber: "111111111111"},
+	}
+	wantOne := []string{
+		"Admin (1) on payments-east-prod (111111111111)",
+		"Admin (2) on payments-west-prod (222222222222)",
+	}
+	wantTwo := map[string]kion.CAR{
+		"Admin (1) on payments-east-prod (111111111111)": cars[1],
+		"Admin (2) on payments-west-prod (222222222222)": cars[0],
+	}
+
+	one, two := MapCARWithAccounts(cars)
+	if !reflect.DeepEqual(wantOne, one) || !reflect.DeepEqual(wantTwo, two) {
+		t.Errorf("\ngot:\n  %v\n  %v\nwanted:\n  %v\n  %v", one, two, wantOne, wantTwo)
+	}
+}
+
+func TestMapCARWithAccountsWideCharacters(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "管理者", ID: 1, AccountName: "payments", AccountNumber: "111111111111"},
+		{Name: "Admin", ID: 2, AccountName: "支付", AccountNumber: "222222222222"},
+		{Name: "🚀 Deploy", ID: 3, AccountName: "launch", AccountNumber: "333333333333"},
+	}
+	want := []string{
+		"Admin (2)     on 支付 (222222222222)",
+		"管理者 (1)    on payments (111111111111)",
+		"🚀 Deploy (3) on launch (333333333333)",
+	}
+
+	got, _ := MapCARWithAccounts(cars)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, want)
+	}
+}
+
+func TestMapCARAccessLevels(t *testing.T) {
+	cars := []kion.CAR{
+		{Name: "Admin", ID: 1, ShortTermAccessKeys: true},
+		{Name: "Admin", ID: 2, WebAccess: true},
+		{Name: "Admin", ID: 3},
+	}
+	want := []string{"Admin (1) [cli]", "Admin (2) [web]", "Admin (3)"}
+
+	got, _ := MapCAR(cars)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+}
+
 func TestMapIDMSs(t *testing.T) {
 	tests := []struct {
 		name    string
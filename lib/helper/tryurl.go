@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  URL Checks                                                                //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Statuses reported by URL checks.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// URLCandidate describes a Kion URL to validate before switching to it, along
+// with the settings from the current configuration it will be used with.
+type URLCandidate struct {
+	URL              string
+	CurrentURL       string
+	IDMS             string
+	SamlMetadataFile string
+}
+
+// URLCheck is the result of a single validation of a candidate URL.
+type URLCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// CheckKionURL runs read-only checks against a candidate Kion URL: that it is
+// reachable and serves a supported version of Kion, that the configured IDMS
+// exists there, and that the SAML metadata in use can be loaded. Nothing is
+// authenticated or changed. Later checks are skipped once the candidate is
+// found unreachable.
+func CheckKionURL(candidate URLCandidate) []URLCheck {
+	var checks []URLCheck
+	add := func(name string, status string, detail string, args ...any) {
+		checks = append(checks, URLCheck{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	// the url itself
+	u, err := url.Parse(candidate.URL)
+	switch {
+	case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+		add("url", CheckFail, "%v is not an http or https url", candidate.URL)
+		return checks
+	case u.Scheme == "http":
+		add("url", CheckWarn, "credentials would be sent unencrypted, use https")
+	default:
+		add("url", CheckOK, "%v", candidate.URL)
+	}
+
+	// reachability, the version endpoint needs no authentication
+	kionVersion, err := kion.GetVersion(candidate.URL)
+	if err != nil {
+		if kion.IsStatus(err, 404) {
+			add("health", CheckFail, "no version endpoint found, is this a Kion instance?")
+		} else {
+			add("health", CheckFail, "unreachable: %v", err)
+		}
+		return checks
+	}
+	add("health", CheckOK, "reachable")
+
+	// version support
+	candidateVersion, err := version.NewSemver(kionVersion)
+	if err != nil {
+		add("version", CheckFail, "unrecognized Kion version %q", kionVersion)
+	} else if supported, _ := SupportsUpdatedCARAPI(kionVersion); !supported {
+		add("version", CheckWarn, "Kion %v predates the updated cloud access role api, listing roles may need extra permissions", kionVersion)
+	} else if current := currentVersion(candidate); current != nil && candidateVersion.LessThan(current) {
+		add("version", CheckWarn, "Kion %v is older than the current instance (%v)", kionVersion, current)
+	} else {
+		add("version", CheckOK, "Kion %v", kionVersion)
+	}
+
+	// identity management systems
+	idmss, err := kion.GetIDMSs(candidate.URL)
+	switch {
+	case err != nil:
+		add("idms", CheckFail, "unable to list identity management systems: %v", err)
+	case candidate.IDMS != "":
+		id, _ := strconv.ParseUint(candidate.IDMS, 10, 0)
+		var names []string
+		var found string
+		for _, idms := range idmss {
+			names = append(names, fmt.Sprintf("%v (%v)", idms.Name, idms.ID))
+			if uint64(idms.ID) == id {
+				found = idms.Name
+			}
+		}
+		if found != "" {
+			add("idms", CheckOK, "configured idms_id %v is %v", candidate.IDMS, found)
+		} else {
+			add("idms", CheckFail, "configured idms_id %v not found, available: %v", candidate.IDMS, strings.Join(names, ", "))
+		}
+	default:
+		add("idms", CheckOK, "%v available for username and password sign in", len(idmss))
+	}
+
+	// saml metadata used to sign in through the browser
+	switch {
+	case candidate.SamlMetadataFile == "":
+		add("saml metadata", CheckSkip, "no saml_metadata_file configured")
+	default:
+		var err error
+		if strings.HasPrefix(candidate.SamlMetadataFile, "http") {
+			_, err = kion.DownloadSAMLMetadata(candidate.SamlMetadataFile)
+		} else {
+			_, err = kion.ReadSAMLMetadataFile(candidate.SamlMetadataFile)
+		}
+		if err != nil {
+			add("saml metadata", CheckFail, "unable to load %v: %v", candidate.SamlMetadataFile, err)
+		} else {
+			add("saml metadata", CheckOK, "loaded %v", candidate.SamlMetadataFile)
+		}
+	}
+
+	return checks
+}
+
+// currentVersion returns the version of the Kion instance currently in use, or
+// nil if there isn't one or it can't be reached.
+func currentVersion(candidate URLCandidate) *version.Version {
+	if candidate.CurrentURL == "" || candidate.CurrentURL == candidate.URL {
+		return nil
+	}
+	kionVersion, err := kion.GetVersion(candidate.CurrentURL)
+	if err != nil {
+		return nil
+	}
+	current, err := version.NewSemver(kionVersion)
+	if err != nil {
+		return nil
+	}
+	return current
+}
+
+// FailedChecks returns the number of checks that failed.
+func FailedChecks(checks []URLCheck) int {
+	failed := 0
+	for _, check := range checks {
+		if check.Status == CheckFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// PrintURLChecks writes the results of URL checks as a table.
+func PrintURLChecks(w io.Writer, checks []URLCheck) error {
+	table := NewTable("CHECK", "STATUS", "DETAIL")
+	for _, check := range checks {
+		table.AddRow(check.Name, check.Status, check.Detail)
+	}
+	return table.Write(w)
+}
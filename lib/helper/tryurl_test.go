@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeKion serves the unauthenticated endpoints used by CheckKionURL.
+func fakeKion(t *testing.T, kionVersion string) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status": 200, "data": %q}`, kionVersion)
+	})
+	mux.HandleFunc("/api/v2/idms", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": 200, "data": [{"id": 1, "idms_type_id": 1, "name": "Kion"}, {"id": 4, "idms_type_id": 2, "name": "Corp LDAP"}, {"id": 5, "idms_type_id": 3, "name": "Corp SAML"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCheckKionURL(t *testing.T) {
+	current := fakeKion(t, "3.10.2")
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	tests := []struct {
+		description string
+		candidate   func() URLCandidate
+		want        []string
+	}{
+		{
+			"Compatible",
+			func() URLCandidate {
+				return URLCandidate{URL: fakeKion(t, "3.10.4"), CurrentURL: current, IDMS: "4"}
+			},
+			[]string{CheckWarn, CheckOK, CheckOK, CheckOK, CheckSkip},
+		},
+		{
+			"Older Than Current",
+			func() URLCandidate {
+				return URLCandidate{URL: fakeKion(t, "3.9.1"), CurrentURL: current}
+			},
+			[]string{CheckWarn, CheckOK, CheckWarn, CheckOK, CheckSkip},
+		},
+		{
+			"Old Version",
+			func() URLCandidate {
+				return URLCandidate{URL: fakeKion(t, "3.7.2")}
+			},
+			[]string{CheckWarn, CheckOK, CheckWarn, CheckOK, CheckSkip},
+		},
+		{
+			"IDMS Missing",
+			func() URLCandidate {
+				return URLCandidate{URL: fakeKion(t, "3.10.4"), IDMS: "5"}
+			},
+			[]string{CheckWarn, CheckOK, CheckOK, CheckFail, CheckSkip},
+		},
+		{
+			"Metadata Missing",
+			func() URLCandidate {
+				return URLCandidate{URL: fakeKion(t, "3.10.4"), SamlMetadataFile: "/nonexistent/metadata.xml"}
+			},
+			[]string{CheckWarn, CheckOK, CheckOK, CheckOK, CheckFail},
+		},
+		{
+			"Not Kion",
+			func() URLCandidate {
+				return URLCandidate{URL: missing.URL}
+			},
+			[]string{CheckWarn, CheckFail},
+		},
+		{
+			"Not A URL",
+			func() URLCandidate {
+				return URLCandidate{URL: "kion.example"}
+			},
+			[]string{CheckFail},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			checks := CheckKionURL(test.candidate())
+			var got []string
+			for _, check := range checks {
+				got = append(got, check.Status)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", checks, test.want)
+			}
+		})
+	}
+}
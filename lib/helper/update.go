@@ -0,0 +1,238 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Update                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultReleasesURL is where the latest Kion CLI release is looked up, the
+// GitHub releases API of the upstream repository.
+const DefaultReleasesURL = "https://api.github.com/repos/kionsoftware/kion-cli/releases/latest"
+
+// Release files published alongside the binaries, the checksums of every
+// binary and a detached signature over them.
+const (
+	ReleaseChecksums = "SHA256SUMS"
+	ReleaseSignature = "SHA256SUMS.sig"
+)
+
+// UpdateCheckInterval is how often the latest release is looked up, and a
+// newer one noted, on normal runs.
+const UpdateCheckInterval = 24 * time.Hour
+
+// Release is a published Kion CLI release, as described by the GitHub
+// releases API.
+type Release struct {
+	Tag    string         `json:"tag_name"`
+	URL    string         `json:"html_url"`
+	Assets []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file published with a release.
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Asset returns the file of a release with the given name.
+func (r Release) Asset(name string) (ReleaseAsset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return ReleaseAsset{}, false
+}
+
+// ReleaseAssetName returns the name of the release binary for a platform,
+// such as kion-darwin-arm64 or kion-windows-amd64.exe.
+func ReleaseAssetName(goos string, goarch string) string {
+	name := fmt.Sprintf("kion-%v-%v", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// LatestRelease looks up the latest release at url with client.
+func LatestRelease(client *http.Client, url string) (Release, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return Release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to look up the latest release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Release{}, fmt.Errorf("unable to look up the latest release: %v", resp.Status)
+	}
+
+	var release Release
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to read the latest release: %w", err)
+	}
+	if release.Tag == "" {
+		return Release{}, errors.New("the latest release has no version")
+	}
+	return release, nil
+}
+
+// NewerVersion reports whether latest is a later version than current. An
+// error is returned when either isn't a version, such as for a build without
+// one.
+func NewerVersion(current string, latest string) (bool, error) {
+	currentVer, err := version.NewVersion(current)
+	if err != nil {
+		return false, fmt.Errorf("unable to compare versions, %q isn't one", current)
+	}
+	latestVer, err := version.NewVersion(latest)
+	if err != nil {
+		return false, fmt.Errorf("unable to compare versions, %q isn't one", latest)
+	}
+	return latestVer.GreaterThan(currentVer), nil
+}
+
+// DownloadFile saves what is at url to path with client.
+func DownloadFile(client *http.Client, url string, path string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("unable to download %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download %v: %v", url, resp.Status)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	closeErr := f.Close()
+	if err != nil {
+		return fmt.Errorf("unable to download %v: %w", url, err)
+	}
+	return closeErr
+}
+
+// ReplaceExecutable moves the verified binary at replacement over the
+// executable at exe. replacement must be on the same filesystem, such as in
+// the same directory, so the move is atomic and exe is never left half
+// written. Windows can't replace a running executable, so there it is moved
+// aside to exe.old first.
+func ReplaceExecutable(exe string, replacement string, goos string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(replacement, info.Mode().Perm()|0100)
+	if err != nil {
+		return err
+	}
+
+	if goos == "windows" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		err = os.Rename(exe, old)
+		if err != nil {
+			return fmt.Errorf("unable to move the current executable aside: %w", err)
+		}
+		err = os.Rename(replacement, exe)
+		if err != nil {
+			_ = os.Rename(old, exe)
+			return fmt.Errorf("unable to replace the executable: %w", err)
+		}
+		return nil
+	}
+
+	err = os.Rename(replacement, exe)
+	if err != nil {
+		return fmt.Errorf("unable to replace the executable: %w", err)
+	}
+	return nil
+}
+
+// UpdateCheck remembers when the latest release was last looked up and a
+// newer one noted, so normal runs do either at most once per
+// UpdateCheckInterval.
+type UpdateCheck struct {
+	Checked  time.Time `json:"checked"`
+	Latest   string    `json:"latest,omitempty"`
+	Notified time.Time `json:"notified,omitempty"`
+}
+
+// Due reports whether the latest release should be looked up again at now.
+func (u UpdateCheck) Due(now time.Time) bool {
+	return now.Sub(u.Checked) >= UpdateCheckInterval
+}
+
+// Notice returns the notice of a newer release for a build of version
+// current at now, or nothing if there is none or it was noted too recently.
+func (u UpdateCheck) Notice(current string, now time.Time) string {
+	if u.Latest == "" || now.Sub(u.Notified) < UpdateCheckInterval {
+		return ""
+	}
+	newer, err := NewerVersion(current, u.Latest)
+	if err != nil || !newer {
+		return ""
+	}
+	return fmt.Sprintf("Kion CLI %v is available, you have %v. Run kion update to install it.", u.Latest, current)
+}
+
+// ReadUpdateCheck returns the update check kept at path. A missing or
+// unreadable file holds none, so the check is simply done again.
+func ReadUpdateCheck(path string) UpdateCheck {
+	var check UpdateCheck
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &check) != nil {
+		return UpdateCheck{}
+	}
+	return check
+}
+
+// WriteUpdateCheck keeps the update check at path, writing it to a temporary
+// file moved into place so an interrupted write never leaves it corrupt.
+func WriteUpdateCheck(path string, check UpdateCheck) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(check, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
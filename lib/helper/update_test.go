@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleaseAssetName(t *testing.T) {
+	tests := []struct {
+		description string
+		goos        string
+		goarch      string
+		want        string
+	}{
+		{"macOS", "darwin", "arm64", "kion-darwin-arm64"},
+		{"Linux", "linux", "amd64", "kion-linux-amd64"},
+		{"Windows", "windows", "amd64", "kion-windows-amd64.exe"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := ReleaseAssetName(test.goos, test.goarch); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"tag_name": "v0.4.0", "html_url": "https://example.com/v0.4.0", "assets": [{"name": "SHA256SUMS", "browser_download_url": "https://example.com/SHA256SUMS"}]}`))
+	}))
+	defer server.Close()
+
+	release, err := LatestRelease(server.Client(), server.URL+"/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Tag != "v0.4.0" {
+		t.Errorf("got tag %q", release.Tag)
+	}
+	if asset, found := release.Asset(ReleaseChecksums); !found || asset.URL != "https://example.com/SHA256SUMS" {
+		t.Errorf("got asset %+v, found: %v", asset, found)
+	}
+	if _, found := release.Asset("kion-plan9-386"); found {
+		t.Error("found an asset the release doesn't have")
+	}
+
+	_, err = LatestRelease(server.Client(), server.URL+"/missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v for a missing release", err)
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		description string
+		current     string
+		latest      string
+		want        bool
+		wantErr     bool
+	}{
+		{"Newer", "v0.3.0", "v0.4.0", true, false},
+		{"Same", "v0.3.0", "0.3.0", false, false},
+		{"Older", "v0.4.0", "v0.3.2", false, false},
+		{"Prerelease", "v0.4.0-rc.1", "v0.4.0", true, false},
+		{"No Version", "", "v0.4.0", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := NewerVersion(test.current, test.latest)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted an error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateCheckNotice(t *testing.T) {
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		check       UpdateCheck
+		wantDue     bool
+		wantNotice  bool
+	}{
+		{"Never Checked", UpdateCheck{}, true, false},
+		{"Newer", UpdateCheck{Checked: now.Add(-time.Hour), Latest: "v0.4.0"}, false, true},
+		{"Noted Recently", UpdateCheck{Checked: now.Add(-time.Hour), Latest: "v0.4.0", Notified: now.Add(-time.Hour)}, false, false},
+		{"Noted Yesterday", UpdateCheck{Checked: now.Add(-25 * time.Hour), Latest: "v0.4.0", Notified: now.Add(-25 * time.Hour)}, true, true},
+		{"Up To Date", UpdateCheck{Checked: now.Add(-time.Hour), Latest: "v0.3.0"}, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := test.check.Due(now); got != test.wantDue {
+				t.Errorf("got due %v, wanted %v", got, test.wantDue)
+			}
+			if got := test.check.Notice("v0.3.0", now); (got != "") != test.wantNotice {
+				t.Errorf("got notice %q, wanted one: %v", got, test.wantNotice)
+			}
+		})
+	}
+}
+
+func TestUpdateCheckRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "update-check.json")
+	if got := ReadUpdateCheck(path); got != (UpdateCheck{}) {
+		t.Errorf("got %+v from a missing file", got)
+	}
+
+	check := UpdateCheck{Checked: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Latest: "v0.4.0"}
+	err := WriteUpdateCheck(path, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ReadUpdateCheck(path); !got.Checked.Equal(check.Checked) || got.Latest != check.Latest {
+		t.Errorf("got %+v, wanted %+v", got, check)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %v files, wanted the temporary file moved into place", len(entries))
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	for _, goos := range []string{"linux", "windows"} {
+		t.Run(goos, func(t *testing.T) {
+			dir := t.TempDir()
+			exe := filepath.Join(dir, "kion")
+			replacement := filepath.Join(dir, ".kion-update")
+			if err := os.WriteFile(exe, []byte("old"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(replacement, []byte("new"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := ReplaceExecutable(exe, replacement, goos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "new" {
+				t.Errorf("got %q, wanted the replacement", data)
+			}
+			info, err := os.Stat(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm()&0100 == 0 {
+				t.Errorf("got mode %v, wanted it executable", info.Mode())
+			}
+		})
+	}
+}
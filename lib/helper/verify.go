@@ -0,0 +1,266 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Verify                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// ReleaseArtifacts holds the paths needed to verify a Kion CLI release binary.
+type ReleaseArtifacts struct {
+	Binary    string
+	AssetName string
+	Checksums string
+	Signature string
+	PublicKey string
+}
+
+// VerifyRelease validates that the checksums file was signed by the holder of
+// the given public key and that the binary matches its entry in the checksums
+// file. Both cosign (PEM encoded keys) and minisign keys are supported.
+func VerifyRelease(artifacts ReleaseArtifacts) error {
+	// verify the checksums file has not been tampered with
+	err := VerifySignature(artifacts.Checksums, artifacts.Signature, artifacts.PublicKey)
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	// verify the binary matches the signed checksum
+	name := artifacts.AssetName
+	if name == "" {
+		name = filepath.Base(artifacts.Binary)
+	}
+	err = VerifyChecksum(artifacts.Binary, artifacts.Checksums, name)
+	if err != nil {
+		return fmt.Errorf("checksum verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyChecksum computes the sha256 sum of the file at path and compares it
+// against the entry for name within a SHA256SUMS formatted file.
+func VerifyChecksum(path string, sumsFile string, name string) error {
+	// find the expected sum
+	f, err := os.Open(sumsFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	expected, err := findChecksum(f, name)
+	if err != nil {
+		return err
+	}
+
+	// compute the actual sum
+	actual, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("sha256 mismatch for %v: expected %v, got %v", name, expected, actual)
+	}
+
+	return nil
+}
+
+// FileSHA256 returns the hex encoded sha256 sum of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySignature validates a detached signature over the file at path. The
+// key may either be a PEM encoded public key as used by cosign or a minisign
+// public key, and may be passed as file contents or a path to a file.
+func VerifySignature(path string, sigFile string, key string) error {
+	if key == "" {
+		return errors.New("no public key provided")
+	}
+
+	// read in the key from disk if we were given a path
+	if _, err := os.Stat(key); err == nil {
+		raw, err := os.ReadFile(key)
+		if err != nil {
+			return err
+		}
+		key = string(raw)
+	}
+
+	message, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(key, "-----BEGIN") {
+		return verifyCosign(message, sig, []byte(key))
+	}
+	return verifyMinisign(message, sig, key)
+}
+
+// findChecksum returns the hex sum for name from SHA256SUMS formatted input.
+func findChecksum(r io.Reader, name string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		// binary mode entries are prefixed with an asterisk
+		if strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no checksum found for %v", name)
+}
+
+// verifyCosign validates a base64 encoded cosign blob signature using a PEM
+// encoded ECDSA or Ed25519 public key.
+func verifyCosign(message []byte, sig []byte, key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return errors.New("unable to decode PEM public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	rawSig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return fmt.Errorf("unable to decode signature: %w", err)
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(pub, digest[:], rawSig) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, message, rawSig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return nil
+}
+
+// verifyMinisign validates a minisign signature file. Only the legacy Ed25519
+// algorithm is supported as prehashed signatures require BLAKE2b.
+func verifyMinisign(message []byte, sig []byte, key string) error {
+	// parse the public key, skipping any untrusted comment
+	keyBytes, err := decodeMinisignLine(key)
+	if err != nil {
+		return fmt.Errorf("unable to decode minisign public key: %w", err)
+	}
+	if len(keyBytes) != 42 || string(keyBytes[:2]) != "Ed" {
+		return errors.New("invalid minisign public key")
+	}
+	keyID := keyBytes[2:10]
+	pub := ed25519.PublicKey(keyBytes[10:])
+
+	// parse the signature and trusted comment
+	sigBytes, err := decodeMinisignLine(string(sig))
+	if err != nil {
+		return fmt.Errorf("unable to decode minisign signature: %w", err)
+	}
+	if len(sigBytes) != 74 {
+		return errors.New("invalid minisign signature")
+	}
+	if string(sigBytes[:2]) == "ED" {
+		return errors.New("prehashed minisign signatures are not supported, sign with 'minisign -l'")
+	}
+	if string(sigBytes[:2]) != "Ed" {
+		return errors.New("unsupported minisign signature algorithm")
+	}
+	if !bytes.Equal(sigBytes[2:10], keyID) {
+		return errors.New("signature was not created by the provided public key")
+	}
+	if !ed25519.Verify(pub, message, sigBytes[10:]) {
+		return errors.New("invalid signature")
+	}
+
+	// validate the trusted comment if one is present
+	trusted, globalSig := minisignTrustedComment(string(sig))
+	if trusted != "" {
+		globalBytes, err := base64.StdEncoding.DecodeString(globalSig)
+		if err != nil {
+			return fmt.Errorf("unable to decode minisign global signature: %w", err)
+		}
+		signed := make([]byte, 0, 64+len(trusted))
+		signed = append(signed, sigBytes[10:]...)
+		signed = append(signed, trusted...)
+		if !ed25519.Verify(pub, signed, globalBytes) {
+			return errors.New("invalid trusted comment signature")
+		}
+	}
+
+	return nil
+}
+
+// decodeMinisignLine base64 decodes the first non-comment line of a minisign
+// key or signature file.
+func decodeMinisignLine(data string) ([]byte, error) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") || strings.HasPrefix(line, "trusted comment:") {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(line)
+	}
+	return nil, errors.New("no data found")
+}
+
+// minisignTrustedComment returns the trusted comment and its base64 encoded
+// global signature from a minisign signature file.
+func minisignTrustedComment(data string) (string, string) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "trusted comment: ") && i+1 < len(lines) {
+			return strings.TrimPrefix(strings.TrimSpace(line), "trusted comment: "), strings.TrimSpace(lines[i+1])
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,163 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRelease stages a fake binary and checksums file in a temp directory and
+// returns their paths.
+func writeRelease(t *testing.T, binary string, sums string) (string, string) {
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "kion_linux_amd64")
+	sumsPath := filepath.Join(dir, "SHA256SUMS")
+	if err := os.WriteFile(binPath, []byte(binary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sumsPath, []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return binPath, sumsPath
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	binary := "kion binary contents"
+	sum := sha256.Sum256([]byte(binary))
+	hexSum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		description string
+		sums        string
+		name        string
+		wantErr     bool
+	}{
+		{"Match", fmt.Sprintf("%v  kion_linux_amd64\n", hexSum), "kion_linux_amd64", false},
+		{"Binary Mode Match", fmt.Sprintf("%v *kion_linux_amd64\n", hexSum), "kion_linux_amd64", false},
+		{"Mismatch", fmt.Sprintf("%v  kion_linux_amd64\n", strings.Repeat("0", 64)), "kion_linux_amd64", true},
+		{"Missing Entry", fmt.Sprintf("%v  kion_darwin_arm64\n", hexSum), "kion_linux_amd64", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			binPath, sumsPath := writeRelease(t, binary, test.sums)
+			err := VerifyChecksum(binPath, sumsPath, test.name)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReleaseCosign(t *testing.T) {
+	binary := "kion binary contents"
+	sum := sha256.Sum256([]byte(binary))
+	sums := fmt.Sprintf("%v  kion_linux_amd64\n", hex.EncodeToString(sum[:]))
+
+	// generate a signing key and pem encode the public half
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	tests := []struct {
+		description string
+		signed      string
+		wantErr     bool
+	}{
+		{"Valid", sums, false},
+		{"Tampered Checksums", strings.Repeat("0", 64) + "  kion_linux_amd64\n", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			binPath, sumsPath := writeRelease(t, binary, sums)
+
+			digest := sha256.Sum256([]byte(test.signed))
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigPath := sumsPath + ".sig"
+			if err := os.WriteFile(sigPath, []byte(base64.StdEncoding.EncodeToString(sig)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = VerifyRelease(ReleaseArtifacts{
+				Binary:    binPath,
+				Checksums: sumsPath,
+				Signature: sigPath,
+				PublicKey: pubPEM,
+			})
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureMinisign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	pubKey := "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)) + "\n"
+
+	message := []byte("SHA256SUMS contents")
+	trusted := "timestamp:1717000000"
+
+	tests := []struct {
+		description string
+		algorithm   string
+		signed      []byte
+		wantErr     bool
+	}{
+		{"Valid", "Ed", message, false},
+		{"Wrong Message", "Ed", []byte("other contents"), true},
+		{"Prehashed", "ED", message, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			sig := ed25519.Sign(priv, test.signed)
+			global := ed25519.Sign(priv, append(append([]byte{}, sig...), trusted...))
+			sigFile := "untrusted comment: signature from minisign secret key\n" +
+				base64.StdEncoding.EncodeToString(append(append([]byte(test.algorithm), keyID...), sig...)) + "\n" +
+				"trusted comment: " + trusted + "\n" +
+				base64.StdEncoding.EncodeToString(global) + "\n"
+
+			dir := t.TempDir()
+			msgPath := filepath.Join(dir, "SHA256SUMS")
+			sigPath := filepath.Join(dir, "SHA256SUMS.minisig")
+			if err := os.WriteFile(msgPath, message, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(sigPath, []byte(sigFile), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := VerifySignature(msgPath, sigPath, pubKey)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Warming                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Statuses reported when warming favorites.
+const (
+	WarmMinted  = "minted"
+	WarmCached  = "cached"
+	WarmSkipped = "skipped"
+	WarmFailed  = "failed"
+)
+
+// WarmResult is the outcome of warming a single favorite.
+type WarmResult struct {
+	Favorite string
+	Status   string
+	Detail   string
+}
+
+// PrintWarmResults writes the outcome of warming favorites as a table. Details
+// are folded onto one line as errors from Kion often span several.
+func PrintWarmResults(w io.Writer, results []WarmResult) error {
+	table := NewTable("FAVORITE", "STATUS", "DETAIL")
+	for _, result := range results {
+		table.AddRow(result.Favorite, result.Status, strings.Join(strings.Fields(result.Detail), " "))
+	}
+	return table.Write(w)
+}
+
+// WorkspaceFavorites returns the favorites named by a workspace, in the order
+// listed. An error is returned if the workspace or any of its favorites are
+// not configured.
+func WorkspaceFavorites(workspaces map[string][]string, workspace string, favorites []structs.Favorite) ([]structs.Favorite, error) {
+	names, found := workspaces[workspace]
+	if !found {
+		return nil, fmt.Errorf("workspace not found: %v", workspace)
+	}
+	_, fMap := MapFavs(favorites)
+	var selected []structs.Favorite
+	for _, name := range names {
+		fav, found := fMap[name]
+		if !found {
+			return nil, fmt.Errorf("workspace %v lists favorite %v which is not configured", workspace, name)
+		}
+		selected = append(selected, fav)
+	}
+	return selected, nil
+}
+
+// RunParallel calls fn for each index below count, running at most limit at
+// once, and returns once all have finished.
+func RunParallel(count int, limit int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
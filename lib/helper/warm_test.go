@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestWorkspaceFavorites(t *testing.T) {
+	favorites := []structs.Favorite{{Name: "ingest"}, {Name: "warehouse"}, {Name: "sandbox"}}
+	workspaces := map[string][]string{
+		"data-platform": {"warehouse", "ingest"},
+		"stale":         {"ingest", "removed"},
+	}
+
+	tests := []struct {
+		description string
+		workspace   string
+		want        []string
+		wantErr     bool
+	}{
+		{"Found", "data-platform", []string{"warehouse", "ingest"}, false},
+		{"Missing Favorite", "stale", nil, true},
+		{"Missing Workspace", "payments", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			favs, err := WorkspaceFavorites(workspaces, test.workspace, favorites)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			var got []string
+			for _, fav := range favs {
+				got = append(got, fav.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	done := make([]bool, 10)
+
+	RunParallel(len(done), 3, func(i int) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		done[i] = true
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("index %v was not run", i)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("ran %v at once, wanted at most 3", peak)
+	}
+}
+
+func TestPrintWarmResults(t *testing.T) {
+	var out bytes.Buffer
+	err := PrintWarmResults(&out, []WarmResult{
+		{Favorite: "ingest", Status: WarmMinted, Detail: "valid until 09:15"},
+		{Favorite: "warehouse", Status: WarmFailed, Detail: "received 403\n forbidden"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "received 403 forbidden") {
+		t.Errorf("details were not folded onto one line:\n%v", out.String())
+	}
+}
@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Watch                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// WatchKeys are the keys pressed to renew the leases shown by kion watch, in
+// the order the leases are listed. q is left out as it quits.
+const WatchKeys = "123456789abcdefghijklmnoprstuvwxyz"
+
+// Kinds of leases shown by kion watch.
+const (
+	WatchKeysLease    = "keys"
+	WatchSessionLease = "session"
+)
+
+// WatchLease is a credential with an expiry shown by kion watch, cached
+// short-term access keys or the Kion session.
+type WatchLease struct {
+	Kind  string
+	Label string
+	// Key is the cache key of short-term access keys.
+	Key     string
+	Expires time.Time
+	// Renewable is set when the lease can be renewed from the watch, keys
+	// downscoped by a session policy only being renewable through the
+	// favorite that names it.
+	Renewable bool
+}
+
+// stakCacheKeyPattern matches the cache keys of short-term access keys, the
+// cloud access role and account followed by the ID of a session policy when
+// downscoped with one. Keys are only cached for AWS accounts, whose twelve
+// digit numbers never end a role name followed by a dash.
+var stakCacheKeyPattern = regexp.MustCompile(`^(.+)-(\d{12})(?:-policy-(.+))?$`)
+
+// ParseSTAKCacheKey splits the cache key of short-term access keys into the
+// cloud access role, account, and ID of the session policy they were
+// downscoped with if any.
+func ParseSTAKCacheKey(key string) (car string, account string, policyID string, ok bool) {
+	match := stakCacheKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return "", "", "", false
+	}
+	return match[1], match[2], match[3], true
+}
+
+// RenderWatch writes the table of leases kion watch shows with the time each
+// has left at now, keyed by WatchKeys. Leases expiring within warn are shown
+// in red, and in reverse video too when flash is set so alternate frames
+// flash them. message is shown below the table, such as the outcome of the
+// last renewal.
+func RenderWatch(w io.Writer, leases []WatchLease, now time.Time, warn time.Duration, flash bool, message string) error {
+	if len(leases) == 0 {
+		_, err := fmt.Fprintln(w, "No short-term access keys or Kion session are cached.")
+		if err != nil {
+			return err
+		}
+	} else {
+		table := NewTable("KEY", "LEASE", "TYPE", "EXPIRES", "REMAINING")
+		for i, lease := range leases {
+			key := "-"
+			if lease.Renewable && i < len(WatchKeys) {
+				key = WatchKeys[i : i+1]
+			}
+			expires, remaining := "-", "-"
+			switch {
+			case lease.Expires.IsZero():
+			case !lease.Expires.After(now):
+				expires, remaining = lease.Expires.Local().Format("15:04:05"), "expired"
+			default:
+				expires, remaining = lease.Expires.Local().Format("15:04:05"), lease.Expires.Sub(now).Truncate(time.Second).String()
+			}
+			table.AddRow(key, lease.Label, lease.Kind, expires, remaining)
+		}
+		var buf bytes.Buffer
+		err := table.Write(&buf)
+		if err != nil {
+			return err
+		}
+
+		// highlight whole lines as escape codes in cells would throw off
+		// the column widths
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		fmt.Fprintln(w, lines[0])
+		for i, line := range lines[1:] {
+			expires := leases[i].Expires
+			if !expires.IsZero() && expires.Sub(now) <= warn {
+				highlight := color.New(color.FgRed, color.Bold)
+				if flash {
+					highlight.Add(color.ReverseVideo)
+				}
+				line = highlight.Sprint(line)
+			}
+			_, err = fmt.Fprintln(w, line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if message != "" {
+		fmt.Fprintf(w, "\n%v\n", message)
+	}
+	_, err := fmt.Fprintln(w, "\nPress a lease's key to renew it, q to quit.")
+	return err
+}
+
+// RawTerminal puts the terminal on stdin in raw mode so keys are read as they
+// are pressed, returning a function that restores it. Output in raw mode must
+// end lines with \r\n, and Ctrl-C arrives as a key rather than a signal.
+func RawTerminal() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = term.Restore(fd, state) }, nil
+}
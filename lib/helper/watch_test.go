@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSTAKCacheKey(t *testing.T) {
+	tests := []struct {
+		description  string
+		key          string
+		wantCAR      string
+		wantAccount  string
+		wantPolicyID string
+		wantOK       bool
+	}{
+		{"Keys", "Admin-111122223333", "Admin", "111122223333", "", true},
+		{"Dashed Role", "read-only-111122223333", "read-only", "111122223333", "", true},
+		{"Session Policy", "Admin-111122223333-policy-3f2a9c", "Admin", "111122223333", "3f2a9c", true},
+		{"Not Keys", "Admin", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			car, account, policyID, ok := ParseSTAKCacheKey(test.key)
+			if car != test.wantCAR || account != test.wantAccount || policyID != test.wantPolicyID || ok != test.wantOK {
+				t.Errorf("got %q, %q, %q, %v", car, account, policyID, ok)
+			}
+		})
+	}
+}
+
+func TestRenderWatch(t *testing.T) {
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.Local)
+	leases := []WatchLease{
+		{Kind: WatchKeysLease, Label: "prod", Key: "Admin-111122223333", Expires: now.Add(45*time.Minute + 500*time.Millisecond), Renewable: true},
+		{Kind: WatchKeysLease, Label: "111122223333/Admin", Key: "Admin-111122223333-policy-3f2a9c", Expires: now.Add(-time.Minute)},
+		{Kind: WatchSessionLease, Label: "Kion session", Expires: now.Add(2 * time.Hour), Renewable: true},
+	}
+
+	var out bytes.Buffer
+	err := RenderWatch(&out, leases, now, 10*time.Minute, true, "Renewed prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"KEY  LEASE               TYPE     EXPIRES   REMAINING",
+		"1    prod                keys     03:49:05  45m0s",
+		"-    111122223333/Admin  keys     03:03:05  expired",
+		"3    Kion session        session  05:04:05  2h0m0s",
+		"",
+		"Renewed prod",
+		"",
+		"Press a lease's key to renew it, q to quit.",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("\ngot:\n%v\nwanted:\n%v", out.String(), strings.Join(want, "\n"))
+	}
+
+	out.Reset()
+	err = RenderWatch(&out, nil, now, 10*time.Minute, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "No short-term access keys or Kion session are cached.") {
+		t.Errorf("got %q with nothing cached", out.String())
+	}
+}
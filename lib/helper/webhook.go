@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Webhooks                                                                  //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// EventSTAKIssued names the event posted to the on_stak webhook.
+const EventSTAKIssued = "stak.issued"
+
+// Headers the webhook signature is sent in. The signature is an HMAC-SHA256,
+// keyed with the webhook secret, of the timestamp, a period, and the body.
+const (
+	WebhookSignatureHeader = "X-Kion-CLI-Signature"
+	WebhookTimestampHeader = "X-Kion-CLI-Timestamp"
+)
+
+// DefaultWebhookTimeout is how long a webhook is waited on when no timeout is
+// configured.
+const DefaultWebhookTimeout = 5 * time.Second
+
+// IssuanceEvent is posted to the on_stak webhook whenever credentials are
+// issued. It carries no secrets, only what identifies the credentials and
+// who they were issued to, such as the access key ID to match against
+// CloudTrail.
+type IssuanceEvent struct {
+	Event       string     `json:"event"`
+	Time        time.Time  `json:"time"`
+	Kion        string     `json:"kion_url"`
+	Cloud       string     `json:"cloud"`
+	Account     string     `json:"account"`
+	CAR         string     `json:"cloud_access_role"`
+	AccessKeyID string     `json:"access_key_id,omitempty"`
+	Expiration  *time.Time `json:"expiration,omitempty"`
+	Downscoped  bool       `json:"downscoped,omitempty"`
+	User        string     `json:"user,omitempty"`
+	Host        string     `json:"host,omitempty"`
+	DeviceID    string     `json:"device_id,omitempty"`
+	RequestIDs  []string   `json:"request_ids,omitempty"`
+	Version     string     `json:"cli_version,omitempty"`
+}
+
+// SignWebhook returns the signature of a webhook body sent at timestamp, as
+// the value of WebhookSignatureHeader.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PostWebhook posts event as JSON to url with client, signed with secret
+// when one is given. Any response other than a 2xx is an error.
+func PostWebhook(client *http.Client, url string, secret string, event interface{}, now time.Time) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post to the webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	got := SignWebhook("secret", "1700000000", []byte(`{"event":"stak.issued"}`))
+	if !strings.HasPrefix(got, "sha256=") || len(got) != len("sha256=")+64 {
+		t.Fatalf("got malformed signature %q", got)
+	}
+	tests := []struct {
+		description string
+		secret      string
+		timestamp   string
+		body        string
+	}{
+		{"Other Secret", "other", "1700000000", `{"event":"stak.issued"}`},
+		{"Other Timestamp", "secret", "1700000001", `{"event":"stak.issued"}`},
+		{"Other Body", "secret", "1700000000", `{"event":"stak.revoked"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if SignWebhook(test.secret, test.timestamp, []byte(test.body)) == got {
+				t.Errorf("got the same signature for a different message")
+			}
+		})
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := IssuanceEvent{Event: EventSTAKIssued, Time: now, Cloud: "aws", Account: "111122223333", CAR: "Admin", AccessKeyID: "ASIAEXAMPLE"}
+
+	tests := []struct {
+		description string
+		secret      string
+		status      int
+		wantErr     bool
+	}{
+		{"Signed", "secret", 200, false},
+		{"Unsigned", "", 204, false},
+		{"Rejected", "secret", 401, true},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var body []byte
+			var header http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				header = r.Header
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			err := PostWebhook(server.Client(), server.URL, test.secret, event, now)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted one: %v", err, test.wantErr)
+			}
+
+			var got IssuanceEvent
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.AccessKeyID != event.AccessKeyID || got.Account != event.Account {
+				t.Errorf("got event %+v, wanted %+v", got, event)
+			}
+
+			signature := header.Get(WebhookSignatureHeader)
+			if test.secret == "" {
+				if signature != "" {
+					t.Errorf("got signature %q on an unsigned webhook", signature)
+				}
+				return
+			}
+			timestamp := header.Get(WebhookTimestampHeader)
+			if timestamp != strconv.FormatInt(now.Unix(), 10) {
+				t.Errorf("got timestamp %q", timestamp)
+			}
+			if want := SignWebhook(test.secret, timestamp, body); !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("got signature %q, wanted %q", signature, want)
+			}
+		})
+	}
+}
+
+func TestIssuanceEventExpiration(t *testing.T) {
+	expiration := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		expiration  *time.Time
+		want        string
+	}{
+		{"Known", &expiration, `"expiration":"2024-05-01T13:00:00Z"`},
+		{"Unknown", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			body, err := json.Marshal(IssuanceEvent{Event: EventSTAKIssued, Account: "111122223333", Expiration: test.expiration})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want == "" && strings.Contains(string(body), `"expiration"`) || !strings.Contains(string(body), test.want) {
+				t.Errorf("got %s, wanted expiration %v", body, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Web UI                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// WebUIActions are the operations offered by the web UI. They are expected to
+// run through the same code as the equivalent commands so access is resolved,
+// cached, and audited the same way.
+type WebUIActions struct {
+	// Console federates into the web console for the named favorite.
+	Console func(name string) error
+	// Exports returns shell exports of short term access keys for the named
+	// favorite.
+	Exports func(name string) (string, error)
+}
+
+// webUICookie names the cookie holding the session token, suffixed with the
+// port served on as cookies are shared by every port of a host.
+const webUICookie = "kion_webui_"
+
+// webUI serves a page listing favorites and runs actions for it. Actions are
+// run one at a time as they may prompt in the terminal serving the page.
+type webUI struct {
+	favorites []structs.Favorite
+	actions   WebUIActions
+	launch    string
+	session   string
+	launched  atomic.Bool
+	mu        sync.Mutex
+}
+
+// NewWebUIToken returns a random token authorizing requests to the web UI,
+// keeping other local users and websites from driving it.
+func NewWebUIToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewWebUI returns a handler serving the web UI for the given favorites.
+// Requests must address the server as a loopback host. The launch token is
+// accepted once, in the query of the page opened in the browser, and traded
+// for a cookie holding the session token, so the token passed to the browser
+// on its command line is spent before other local users could read it.
+func NewWebUI(favorites []structs.Favorite, actions WebUIActions, launch string, session string) http.Handler {
+	ui := &webUI{favorites: favorites, actions: actions, launch: launch, session: session}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ui.index)
+	mux.HandleFunc("POST /console", ui.console)
+	mux.HandleFunc("POST /exports", ui.exports)
+	return ui.guard(mux)
+}
+
+// guard rejects requests without the session cookie or for a host other than
+// loopback, the latter preventing DNS rebinding from reaching the server.
+// Actions must also carry the session token in a header, which pages on other
+// sites can't send.
+func (ui *webUI) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.Host)
+		if err != nil || (host != "localhost" && !net.ParseIP(host).IsLoopback()) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		if r.Method == http.MethodGet && r.URL.Query().Has("token") {
+			ui.start(w, r, port)
+			return
+		}
+		cookie, err := r.Cookie(webUICookie + port)
+		if err != nil || !ui.valid(cookie.Value) || (r.Method != http.MethodGet && !ui.valid(r.Header.Get("X-Kion-Token"))) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// start trades the launch token for the session cookie the first time it is
+// presented and redirects to the page without it.
+func (ui *webUI) start(w http.ResponseWriter, r *http.Request, port string) {
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ui.launch)) != 1 || !ui.launched.CompareAndSwap(false, true) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     webUICookie + port,
+		Value:    ui.session,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// valid reports whether token is the session token.
+func (ui *webUI) valid(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(ui.session)) == 1
+}
+
+// index lists the favorites.
+func (ui *webUI) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := webUIPage.Execute(w, struct {
+		Favorites []structs.Favorite
+		Token     string
+	}{ui.favorites, ui.session})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// console opens the web console for a favorite.
+func (ui *webUI) console(w http.ResponseWriter, r *http.Request) {
+	name, ok := ui.favorite(w, r)
+	if !ok {
+		return
+	}
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	err := ui.actions.Console(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exports returns shell exports for a favorite to be copied to the clipboard.
+func (ui *webUI) exports(w http.ResponseWriter, r *http.Request) {
+	name, ok := ui.favorite(w, r)
+	if !ok {
+		return
+	}
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	exports, err := ui.actions.Exports(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(exports))
+}
+
+// favorite returns the requested favorite name, responding with an error if
+// it is not one of the listed favorites.
+func (ui *webUI) favorite(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.URL.Query().Get("name")
+	for _, fav := range ui.favorites {
+		if fav.Name == name {
+			return name, true
+		}
+	}
+	http.Error(w, "favorite not found", http.StatusNotFound)
+	return "", false
+}
+
+// webUIPage renders the list of favorites.
+var webUIPage = template.Must(template.New("webui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Kion CLI</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; }
+#status { margin-top: 1em; min-height: 1.2em; }
+</style>
+</head>
+<body>
+<h1>Favorites</h1>
+<table>
+<tr><th>Name</th><th>Account</th><th>Cloud Access Role</th><th></th></tr>
+{{- range .Favorites}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if .Account}}{{.Account}}{{else}}{{.AccountAlias}}{{end}}</td>
+<td>{{.CAR}}</td>
+<td>
+<button data-action="console" data-name="{{.Name}}">Open console</button>
+{{- if ne .AccessType "web"}}
+<button data-action="exports" data-name="{{.Name}}">Copy exports</button>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+<div id="status"></div>
+<script>
+const token = {{.Token}};
+const status = document.getElementById("status");
+document.querySelectorAll("button").forEach((button) => {
+  button.addEventListener("click", async () => {
+    const action = button.dataset.action;
+    const name = button.dataset.name;
+    status.textContent = "Working on " + name + "...";
+    const response = await fetch("/" + action + "?name=" + encodeURIComponent(name), {
+      method: "POST",
+      headers: { "X-Kion-Token": token },
+    });
+    if (!response.ok) {
+      status.textContent = "Error: " + await response.text();
+      return;
+    }
+    if (action === "exports") {
+      await navigator.clipboard.writeText(await response.text());
+      status.textContent = "Copied exports for " + name + " to the clipboard";
+    } else {
+      status.textContent = "Opened the console for " + name;
+    }
+  });
+});
+</script>
+</body>
+</html>
+`))
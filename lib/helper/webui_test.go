@@ -0,0 +1,207 @@
+package helper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestWebUI(t *testing.T) {
+	favorites := []structs.Favorite{
+		{Name: "sandbox", Account: "111111111111", CAR: "Admin"},
+		{Name: "prod", Account: "222222222222", CAR: "ReadOnly", AccessType: "web"},
+	}
+	var opened []string
+	actions := WebUIActions{
+		Console: func(name string) error {
+			opened = append(opened, name)
+			return nil
+		},
+		Exports: func(name string) (string, error) {
+			if name == "prod" {
+				return "", errors.New("no short term access keys")
+			}
+			return "export AWS_ACCESS_KEY_ID=abc\n", nil
+		},
+	}
+	handler := NewWebUI(favorites, actions, "launch", "session")
+	cookie := &http.Cookie{Name: "kion_webui_8080", Value: "session"}
+
+	// cases run in order as the launch token is spent by the first to use it
+	tests := []struct {
+		description string
+		method      string
+		target      string
+		host        string
+		cookie      *http.Cookie
+		token       string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			"Missing Cookie",
+			"GET",
+			"/",
+			"127.0.0.1:8080",
+			nil,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Foreign Host",
+			"GET",
+			"/?token=launch",
+			"attacker.example:8080",
+			nil,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Session Token In Query",
+			"GET",
+			"/?token=session",
+			"127.0.0.1:8080",
+			nil,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Launch",
+			"GET",
+			"/?token=launch",
+			"127.0.0.1:8080",
+			nil,
+			"",
+			http.StatusSeeOther,
+			"",
+		},
+		{
+			"Launch Token Spent",
+			"GET",
+			"/?token=launch",
+			"127.0.0.1:8080",
+			nil,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Index",
+			"GET",
+			"/",
+			"127.0.0.1:8080",
+			cookie,
+			"",
+			http.StatusOK,
+			`data-name="sandbox"`,
+		},
+		{
+			"Cookie Of Another Port",
+			"GET",
+			"/",
+			"127.0.0.1:9090",
+			cookie,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Token In Query Not Accepted For Actions",
+			"POST",
+			"/console?name=sandbox&token=session",
+			"localhost:8080",
+			cookie,
+			"",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Header Without Cookie",
+			"POST",
+			"/console?name=sandbox",
+			"localhost:8080",
+			nil,
+			"session",
+			http.StatusForbidden,
+			"forbidden",
+		},
+		{
+			"Console",
+			"POST",
+			"/console?name=sandbox",
+			"localhost:8080",
+			cookie,
+			"session",
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"Exports",
+			"POST",
+			"/exports?name=sandbox",
+			"localhost:8080",
+			cookie,
+			"session",
+			http.StatusOK,
+			"export AWS_ACCESS_KEY_ID=abc",
+		},
+		{
+			"Action Error",
+			"POST",
+			"/exports?name=prod",
+			"localhost:8080",
+			cookie,
+			"session",
+			http.StatusBadGateway,
+			"no short term access keys",
+		},
+		{
+			"Unknown Favorite",
+			"POST",
+			"/console?name=missing",
+			"localhost:8080",
+			cookie,
+			"session",
+			http.StatusNotFound,
+			"favorite not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.target, nil)
+			r.Host = test.host
+			if test.cookie != nil {
+				r.AddCookie(test.cookie)
+			}
+			if test.token != "" {
+				r.Header.Set("X-Kion-Token", test.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.wantStatus || !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("\ngot:\n  %v %q\nwanted:\n  %v %q", w.Code, w.Body.String(), test.wantStatus, test.wantBody)
+			}
+			if test.wantStatus == http.StatusSeeOther {
+				set := w.Result().Cookies()
+				if len(set) != 1 || set[0].Name != cookie.Name || set[0].Value != cookie.Value || !set[0].HttpOnly {
+					t.Errorf("got cookies %v, wanted an http only %v cookie", set, cookie.Name)
+				}
+				if location := w.Header().Get("Location"); location != "/" {
+					t.Errorf("got redirected to %v, wanted /", location)
+				}
+			}
+		})
+	}
+
+	if len(opened) != 1 || opened[0] != "sandbox" {
+		t.Errorf("got consoles opened %v, wanted [sandbox]", opened)
+	}
+}
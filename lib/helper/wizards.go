@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
 	"github.com/urfave/cli/v2"
 )
 
@@ -17,10 +18,34 @@ import (
 // Project, then associated Accounts, then available Cloud Access Roles, to set
 // the user selected Cloud Access Role. Optional account number and or car name
 // can be passed via an existing car struct, the flow will dynamically ask what
-// is needed to be able to find the full car.
-func CARSelector(cCtx *cli.Context, car *kion.CAR) error {
+// is needed to be able to find the full car. If a default applies to the
+// chosen account the cloud access role prompt is skipped. Accounts are limited
+// to those in the cloud given by the cloud flag, if any, and pinned accounts
+// are left out.
+func CARSelector(cCtx *cli.Context, car *kion.CAR, defaults []structs.Default) error {
+	useUpdated, err := UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return err
+	}
+	if useUpdated {
+		// TODO: consolidate on this logic when support for 3.9 drops, that will
+		// give us one full support line of buffer
+
+		// get all projects and cars for authed user, works with min permission set
+		inventory, err := FetchInventory(cCtx)
+		if err != nil {
+			return err
+		}
+		return InventorySelector(cCtx, inventory, car, defaults, false)
+	}
+
 	// get list of projects, then build list of names and lookup map
-	projects, err := kion.GetProjects(cCtx.String("endpoint"), cCtx.String("token"))
+	var projects []kion.Project
+	err = WithProgress(cCtx.Context, "Fetching projects", func(p *Progress) error {
+		var err error
+		projects, err = kion.GetProjects(cCtx.String("endpoint"), cCtx.String("token"))
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -35,120 +60,153 @@ func CARSelector(cCtx *cli.Context, car *kion.CAR) error {
 		return err
 	}
 
-	if cCtx.App.Metadata["useUpdatedCloudAccessRoleAPI"] == true {
-		// TODO: consolidate on this logic when support for 3.9 drops, that will
-		// give us one full support line of buffer
-
-		// get all cars for authed user, works with min permission set
-		cars, err := kion.GetCARS(cCtx.String("endpoint"), cCtx.String("token"))
-		if err != nil {
+	// get list of accounts on project, then build a list of names and lookup map
+	accounts, statusCode, err := kion.GetAccountsOnProject(cCtx.String("endpoint"), cCtx.String("token"), pMap[project].ID)
+	if err != nil {
+		if statusCode == 403 {
+			// if we're getting a 403 work around permissions bug by temp using private api
+			return carSelectorPrivateAPI(cCtx, pMap, project, car, defaults)
+		} else {
 			return err
 		}
-		aNames, aMap := MapAccountsFromCARS(cars, pMap[project].ID)
-		if len(aNames) == 0 {
-			return fmt.Errorf("no accounts found")
-		}
+	}
+	accounts = FilterPinnedAccounts(FilterAccountsByCloud(accounts, cCtx.String("cloud")))
+	aNames, aMap := MapAccounts(accounts)
+	if len(aNames) == 0 {
+		return fmt.Errorf("no accounts found")
+	}
 
-		// prompt user to select an account
-		account, err := PromptSelect("Choose an Account:", aNames)
-		if err != nil {
-			return err
-		}
+	// prompt user to select an account
+	account, err := PromptSelect("Choose an Account:", aNames)
+	if err != nil {
+		return err
+	}
 
-		// narrow it down to just cars associated with the account
-		var carsFiltered []kion.CAR
-		for _, carObj := range cars {
-			if carObj.AccountNumber == aMap[account] {
-				carsFiltered = append(carsFiltered, carObj)
-			}
-		}
-		cNames, cMap := MapCAR(carsFiltered)
-		if len(cNames) == 0 {
-			return fmt.Errorf("you have no cloud access roles assigned")
-		}
+	// get a list of cloud access roles, then build a list of names and lookup map
+	cars, err := kion.GetCARSOnProject(cCtx.String("endpoint"), cCtx.String("token"), pMap[project].ID, aMap[account].ID)
+	if err != nil {
+		return err
+	}
+	cNames, cMap := MapCAR(cars)
+	if len(cNames) == 0 {
+		return fmt.Errorf("no cloud access roles found")
+	}
 
-		// prompt user to select a car
-		carname, err := PromptSelect("Choose a Cloud Access Role:", cNames)
+	// use a configured default if available, else prompt user to select a car
+	carname, found := defaultCARChoice(defaults, pMap[project].Name, aMap[account].Number, cNames, cMap)
+	if !found {
+		carname, err = PromptSelect("Choose a Cloud Access Role:", cNames)
 		if err != nil {
 			return err
 		}
+	}
 
-		// inject the metadata into the car
-		car.Name = cMap[carname].Name
-		car.AccountName = cMap[carname].AccountName
-		car.AccountNumber = aMap[account]
-		car.AccountTypeID = cMap[carname].AccountTypeID
-		car.AccountID = cMap[carname].AccountID
-		car.AwsIamRoleName = cMap[carname].AwsIamRoleName
-		car.ID = cMap[carname].ID
-		car.CloudAccessRoleType = cMap[carname].CloudAccessRoleType
-
-		// return nil
-		return nil
-	} else {
-		// get list of accounts on project, then build a list of names and lookup map
-		accounts, statusCode, err := kion.GetAccountsOnProject(cCtx.String("endpoint"), cCtx.String("token"), pMap[project].ID)
-		if err != nil {
-			if statusCode == 403 {
-				// if we're getting a 403 work around permissions bug by temp using private api
-				return carSelectorPrivateAPI(cCtx, pMap, project, car)
-			} else {
-				return err
-			}
-		}
-		aNames, aMap := MapAccounts(accounts)
-		if len(aNames) == 0 {
-			return fmt.Errorf("no accounts found")
-		}
+	// inject the metadata into the car
+	car.Name = cMap[carname].Name
+	car.AccountName = cMap[carname].AccountName
+	car.AccountNumber = aMap[account].Number
+	car.AccountTypeID = aMap[account].TypeID
+	car.AccountID = aMap[account].ID
+	car.AwsIamRoleName = cMap[carname].AwsIamRoleName
+	car.ID = cMap[carname].ID
+	car.CloudAccessRoleType = cMap[carname].CloudAccessRoleType
+	car.ShortTermAccessKeys = cMap[carname].ShortTermAccessKeys
+	car.WebAccess = cMap[carname].WebAccess
 
-		// prompt user to select an account
-		account, err := PromptSelect("Choose an Account:", aNames)
-		if err != nil {
-			return err
-		}
+	// return nil
+	return nil
+}
 
-		// get a list of cloud access roles, then build a list of names and lookup map
-		cars, err := kion.GetCARSOnProject(cCtx.String("endpoint"), cCtx.String("token"), pMap[project].ID, aMap[account].ID)
-		if err != nil {
-			return err
-		}
-		cNames, cMap := MapCAR(cars)
-		if len(cNames) == 0 {
-			return fmt.Errorf("no cloud access roles found")
+// InventorySelector is a wizard that walks a user through the selection of a
+// Project, Account, and Cloud Access Role from an inventory, as CARSelector
+// does with the updated cloud access role API. When stale is set the prompts
+// note the inventory came from the cache and when it was taken.
+func InventorySelector(cCtx *cli.Context, inventory kion.Inventory, car *kion.CAR, defaults []structs.Default, stale bool) error {
+	var label string
+	if stale {
+		label = " " + StaleLabel(inventory.Updated)
+	}
+
+	// build list of project names and lookup map
+	pNames, pMap := MapProjects(inventory.Projects)
+	if len(pNames) == 0 {
+		return fmt.Errorf("no projects found")
+	}
+
+	// prompt user to select a project
+	project, err := PromptSelect("Choose a project"+label+":", pNames)
+	if err != nil {
+		return err
+	}
+
+	cars := FilterPinnedCARs(FilterCARsByCloud(inventory.CARs, cCtx.String("cloud")))
+	aNames, aMap := MapAccountsFromCARS(cars, pMap[project].ID)
+	if len(aNames) == 0 {
+		return fmt.Errorf("no accounts found")
+	}
+
+	// prompt user to select an account, searchable by any metadata from
+	// outside of kion such as organizations tags
+	descriptions := make(map[string]string)
+	terms := make(map[string][]string)
+	for name, number := range aMap {
+		metadata := inventory.Accounts[number]
+		descriptions[name] = metadata.OUPath
+		terms[name] = AccountSearchTerms(metadata)
+	}
+	account, err := PromptSelectSearch("Choose an Account"+label+":", aNames, descriptions, terms)
+	if err != nil {
+		return err
+	}
+
+	// narrow it down to just cars associated with the account
+	var carsFiltered []kion.CAR
+	for _, carObj := range cars {
+		if carObj.AccountNumber == aMap[account] {
+			carsFiltered = append(carsFiltered, carObj)
 		}
+	}
+	cNames, cMap := MapCAR(carsFiltered)
+	if len(cNames) == 0 {
+		return fmt.Errorf("you have no cloud access roles assigned")
+	}
 
-		// prompt user to select a car
-		carname, err := PromptSelect("Choose a Cloud Access Role:", cNames)
+	// use a configured default if available, else prompt user to select a car
+	carname, found := defaultCARChoice(defaults, pMap[project].Name, aMap[account], cNames, cMap)
+	if !found {
+		carname, err = PromptSelect("Choose a Cloud Access Role"+label+":", cNames)
 		if err != nil {
 			return err
 		}
+	}
 
-		// inject the metadata into the car
-		car.Name = cMap[carname].Name
-		car.AccountName = cMap[carname].AccountName
-		car.AccountNumber = aMap[account].Number
-		car.AccountTypeID = aMap[account].TypeID
-		car.AccountID = aMap[account].ID
-		car.AwsIamRoleName = cMap[carname].AwsIamRoleName
-		car.ID = cMap[carname].ID
-		car.CloudAccessRoleType = cMap[carname].CloudAccessRoleType
+	// inject the metadata into the car
+	car.Name = cMap[carname].Name
+	car.AccountName = cMap[carname].AccountName
+	car.AccountNumber = aMap[account]
+	car.AccountTypeID = cMap[carname].AccountTypeID
+	car.AccountID = cMap[carname].AccountID
+	car.AwsIamRoleName = cMap[carname].AwsIamRoleName
+	car.ID = cMap[carname].ID
+	car.CloudAccessRoleType = cMap[carname].CloudAccessRoleType
+	car.ShortTermAccessKeys = cMap[carname].ShortTermAccessKeys
+	car.WebAccess = cMap[carname].WebAccess
 
-		// return nil
-		return nil
-	}
+	return nil
 }
 
 // carSelectorPrivateAPI is a temp shim workaround to address a public API
 // permissions issue. CARSelector should be called directly which will the
 // forward to this function if needed.
-func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, project string, car *kion.CAR) error {
+func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, project string, car *kion.CAR, defaults []structs.Default) error {
 	// hit private api endpoint to gather all users cars and their associated accounts
 	caCARs, err := kion.GetConsoleAccessCARS(cCtx.String("endpoint"), cCtx.String("token"), pMap[project].ID)
 	if err != nil {
 		return err
 	}
 
-	// build a consolidated list of accounts from all available CARS and slice of cars per account
+	// build a consolidated list of accounts from all available CARS and slice
+	// of cars per account number
 	var accounts []kion.Account
 	cMap := make(map[string]kion.ConsoleAccessCAR)
 	aToCMap := make(map[string][]string)
@@ -156,8 +214,7 @@ func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, proj
 		cname := fmt.Sprintf("%v (%v)", car.CARName, car.CARID)
 		cMap[cname] = car
 		for _, account := range car.Accounts {
-			name := fmt.Sprintf("%v (%v)", account.Name, account.Number)
-			aToCMap[name] = append(aToCMap[account.Name], cname)
+			aToCMap[account.Number] = append(aToCMap[account.Number], cname)
 			found := false
 			for _, a := range accounts {
 				if a.ID == account.ID {
@@ -171,6 +228,7 @@ func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, proj
 	}
 
 	// build a list of names and lookup map
+	accounts = FilterPinnedAccounts(FilterAccountsByCloud(accounts, cCtx.String("cloud")))
 	aNames, aMap := MapAccounts(accounts)
 	if len(aNames) == 0 {
 		return fmt.Errorf("no accounts found")
@@ -182,10 +240,21 @@ func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, proj
 		return err
 	}
 
-	// prompt user to select car
-	carname, err := PromptSelect("Choose a Cloud Access Role:", aToCMap[account])
-	if err != nil {
-		return err
+	// use a configured default if available, else prompt user to select car
+	var carname string
+	if name := DefaultCARName(defaults, pMap[project].Name, aMap[account].Number); name != "" {
+		for _, choice := range aToCMap[aMap[account].Number] {
+			if cMap[choice].CARName == name {
+				carname = choice
+				break
+			}
+		}
+	}
+	if carname == "" {
+		carname, err = PromptSelect("Choose a Cloud Access Role:", aToCMap[aMap[account].Number])
+		if err != nil {
+			return err
+		}
 	}
 
 	// build enough of a car and return it
@@ -200,3 +269,34 @@ func carSelectorPrivateAPI(cCtx *cli.Context, pMap map[string]kion.Project, proj
 
 	return nil
 }
+
+// DefaultCARName returns the name of the cloud access role configured as the
+// default for an account, falling back to the default for its project. An
+// empty string is returned if no default applies.
+func DefaultCARName(defaults []structs.Default, projectName string, accountNumber string) string {
+	var projectDefault string
+	for _, d := range defaults {
+		if d.Account != "" && d.Account == accountNumber {
+			return d.CAR
+		}
+		if projectDefault == "" && d.Account == "" && d.Project != "" && d.Project == projectName {
+			projectDefault = d.CAR
+		}
+	}
+	return projectDefault
+}
+
+// defaultCARChoice finds the first option in cNames matching the default cloud
+// access role for an account, if one is configured and available.
+func defaultCARChoice(defaults []structs.Default, projectName string, accountNumber string, cNames []string, cMap map[string]kion.CAR) (string, bool) {
+	name := DefaultCARName(defaults, projectName, accountNumber)
+	if name == "" {
+		return "", false
+	}
+	for _, choice := range cNames {
+		if cMap[choice].Name == name {
+			return choice, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/kionsoftware/kion-cli/lib/structs"
+)
+
+func TestDefaultCARName(t *testing.T) {
+	defaults := []structs.Default{
+		{Project: "Payments", CAR: "Engineer"},
+		{Account: "111111111111", CAR: "Admin"},
+		{Project: "Payments", CAR: "ReadOnly"},
+	}
+
+	tests := []struct {
+		description string
+		project     string
+		account     string
+		want        string
+	}{
+		{
+			"Account Default",
+			"Payments",
+			"111111111111",
+			"Admin",
+		},
+		{
+			"First Project Default",
+			"Payments",
+			"222222222222",
+			"Engineer",
+		},
+		{
+			"No Default",
+			"Research",
+			"333333333333",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := DefaultCARName(defaults, test.project, test.account)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
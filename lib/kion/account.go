@@ -39,6 +39,29 @@ type Account struct {
 	UseOrgAccountInfo         bool   `json:"use_org_account_info"`
 }
 
+// GetAccounts returns every account in Kion the user may see. Users with access
+// to cloud access roles alone are refused with a 403, the accounts of their
+// roles can be found with GetCARS instead.
+func GetAccounts(host string, token string) ([]Account, int, error) {
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/account", host)
+	query := map[string]string{}
+	var data interface{}
+	resp, statusCode, err := runQuery("GET", url, token, query, data)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	// unmarshal response body
+	accResp := AccountsResponse{}
+	err = json.Unmarshal(resp, &accResp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return accResp.Accounts, accResp.Status, nil
+}
+
 // GetAccountsOnProject returns a list of Accounts associated with a given Kion
 // project.
 func GetAccountsOnProject(host string, token string, id uint) ([]Account, int, error) {
@@ -0,0 +1,63 @@
+package kion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  API Passthrough                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// APIMethods are the methods requests can be passed through to the Kion API
+// with.
+var APIMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// APIURL returns the URL of path within the Kion API at host. The path may
+// be given with or without its leading /api, such as v3/project.
+func APIURL(host string, path string) string {
+	path = "/" + strings.TrimLeft(path, "/")
+	if path != "/api" && !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/api?") {
+		path = "/api" + path
+	}
+	return strings.TrimRight(host, "/") + path
+}
+
+// CallAPI sends a request to url in the Kion API authorized with token, data
+// being the raw JSON body if any. The body and status of any 2xx response are
+// returned, other statuses return an APIError holding the body. Only GET
+// requests are sent when DryRun is set, others return ErrDryRun.
+func CallAPI(ctx context.Context, method string, url string, token string, data []byte) ([]byte, int, error) {
+	method = strings.ToUpper(method)
+	if !slices.Contains(APIMethods, method) {
+		return nil, 0, fmt.Errorf("unsupported method %q, expected one of %v", method, strings.Join(APIMethods, ", "))
+	}
+	if DryRun && method != http.MethodGet {
+		fmt.Fprintf(DryRunOutput, "[dry-run] would %v %v\n", method, url)
+		return nil, 0, ErrDryRun
+	}
+
+	var payload interface{}
+	if data != nil {
+		if !json.Valid(data) {
+			return nil, 0, errors.New("the request body isn't valid JSON")
+		}
+		payload = json.RawMessage(data)
+	}
+
+	body, status, err := DefaultClient.query(ctx, method, url, token, nil, payload, annotate)
+
+	// kion answers creates and deletes with other successful statuses
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 200 && apiErr.StatusCode < 300 {
+		return []byte(apiErr.Body), apiErr.StatusCode, nil
+	}
+	return body, status, err
+}
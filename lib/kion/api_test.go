@@ -0,0 +1,96 @@
+package kion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIURL(t *testing.T) {
+	tests := []struct {
+		description string
+		host        string
+		path        string
+		want        string
+	}{
+		{"Relative", "https://kion.example.com", "v3/project", "https://kion.example.com/api/v3/project"},
+		{"Leading Slash", "https://kion.example.com/", "/v3/project?page=2", "https://kion.example.com/api/v3/project?page=2"},
+		{"Full Path", "https://kion.example.com", "/api/v3/project", "https://kion.example.com/api/v3/project"},
+		{"Version", "https://kion.example.com", "api/version", "https://kion.example.com/api/version"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := APIURL(test.host, test.path); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCallAPI(t *testing.T) {
+	var gotMethod, gotBody, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotBody, gotAuth = r.Method, string(body), r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/api/v3/project":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":201,"record_id":7}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status":404,"message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		data        []byte
+		dryRun      bool
+		wantStatus  int
+		wantBody    string
+		wantErr     error
+	}{
+		{"Created", "post", "v3/project", []byte(`{"name": "web"}`), false, http.StatusCreated, `{"status":201,"record_id":7}`, nil},
+		{"Not Found", "GET", "v3/nothing", nil, false, http.StatusNotFound, "", &APIError{}},
+		{"Dry Run", "DELETE", "v3/project", nil, true, 0, "", ErrDryRun},
+		{"Unsupported Method", "TRACE", "v3/project", nil, false, 0, "", errors.New("")},
+		{"Invalid Body", "POST", "v3/project", []byte(`{"name":`), false, 0, "", errors.New("")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			gotMethod = ""
+			DryRun, DryRunOutput = test.dryRun, io.Discard
+			defer func() { DryRun = false }()
+
+			body, status, err := CallAPI(context.Background(), test.method, APIURL(server.URL, test.path), "token", test.data)
+			switch want := test.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if gotMethod != "POST" || gotBody != `{"name":"web"}` || gotAuth != "Bearer token" {
+					t.Errorf("sent %v %q with %q", gotMethod, gotBody, gotAuth)
+				}
+			case *APIError:
+				if !IsStatus(err, test.wantStatus) {
+					t.Errorf("got %v, wanted a %v", err, test.wantStatus)
+				}
+			default:
+				if err == nil || (want == ErrDryRun) != errors.Is(err, ErrDryRun) || gotMethod != "" {
+					t.Errorf("got %v having sent %q", err, gotMethod)
+				}
+			}
+			if err == nil && (status != test.wantStatus || string(body) != test.wantBody) {
+				t.Errorf("got %v %s, wanted %v %s", status, body, test.wantStatus, test.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package kion
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	saml2 "github.com/russellhaering/gosaml2"
+	samlTypes "github.com/russellhaering/gosaml2/types"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SAML Assertions                                                           //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SAMLDebug is called with the SAML response posted back by the identity
+// provider during SAML authentication when set, before it is forwarded to
+// Kion.
+var SAMLDebug func(samlResponse []byte)
+
+// Results of checking the signature of a SAML response.
+const (
+	SignatureValid      = "valid"
+	SignatureInvalid    = "invalid"
+	SignatureUnverified = "unverified"
+	SignatureMissing    = "missing"
+)
+
+// samlClockTolerance is how far the clock here may disagree with the
+// identity provider's before a SAML assertion is held to its validity window.
+const samlClockTolerance = 3 * time.Minute
+
+// Errors validating a SAML response before it is forwarded to Kion.
+var (
+	// ErrSAMLSignature is returned when a SAML response isn't signed by the
+	// identity provider the metadata describes.
+	ErrSAMLSignature = errors.New("the SAML response signature is not valid")
+
+	// ErrSAMLIssuer is returned when a SAML response is issued by another
+	// identity provider than the metadata describes.
+	ErrSAMLIssuer = errors.New("the SAML response is from a different identity provider")
+
+	// ErrSAMLAudience is returned when a SAML assertion is meant for another
+	// service provider than the one signed in to.
+	ErrSAMLAudience = errors.New("the SAML assertion is for a different audience")
+
+	// ErrSAMLExpired is returned when a SAML assertion is used after it
+	// expires.
+	ErrSAMLExpired = errors.New("the SAML assertion has expired")
+
+	// ErrSAMLClockSkew is returned when a SAML assertion is outside its
+	// validity window because the clock here disagrees with the identity
+	// provider's.
+	ErrSAMLClockSkew = errors.New("this clock disagrees with the identity provider's")
+)
+
+// redacted replaces the values of attributes that look like secrets.
+const redacted = "[redacted]"
+
+// sensitiveAttribute matches the names of attributes whose values are redacted
+// when inspecting a SAML response.
+var sensitiveAttribute = regexp.MustCompile(`(?i)token|secret|password|credential|session|key`)
+
+// SAMLAssertion summarizes a SAML response for troubleshooting identity
+// provider configuration. It never holds signature values, certificates, or
+// the values of attributes that look like secrets.
+type SAMLAssertion struct {
+	Destination  string
+	Status       string
+	IssueInstant time.Time
+	Issuer       string
+	Subject      string
+	Audiences    []string
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+	Attributes   []SAMLAttribute
+	// Encrypted is true if the assertion is encrypted, in which case only the
+	// response around it can be inspected.
+	Encrypted bool
+	// Signature is one of the Signature constants, SignedElement names what
+	// was signed, and SignatureDetail explains an invalid or unverified one.
+	Signature       string
+	SignedElement   string
+	SignatureDetail string
+}
+
+// SAMLAttribute is an attribute asserted about the user.
+type SAMLAttribute struct {
+	Name   string
+	Values []string
+}
+
+// samlResponseXML holds the parts of a SAML response that are inspected.
+type samlResponseXML struct {
+	XMLName      xml.Name
+	Destination  string `xml:"Destination,attr"`
+	IssueInstant string `xml:"IssueInstant,attr"`
+	Issuer       string `xml:"Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"StatusCode"`
+		StatusMessage string `xml:"StatusMessage"`
+	} `xml:"Status"`
+	Assertion *struct {
+		IssueInstant string `xml:"IssueInstant,attr"`
+		Issuer       string `xml:"Issuer"`
+		Subject      struct {
+			NameID              string `xml:"NameID"`
+			SubjectConfirmation struct {
+				SubjectConfirmationData struct {
+					NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+					Recipient    string `xml:"Recipient,attr"`
+				} `xml:"SubjectConfirmationData"`
+			} `xml:"SubjectConfirmation"`
+		} `xml:"Subject"`
+		Conditions struct {
+			NotBefore           string `xml:"NotBefore,attr"`
+			NotOnOrAfter        string `xml:"NotOnOrAfter,attr"`
+			AudienceRestriction []struct {
+				Audience []string `xml:"Audience"`
+			} `xml:"AudienceRestriction"`
+		} `xml:"Conditions"`
+		AttributeStatement struct {
+			Attribute []struct {
+				Name           string   `xml:"Name,attr"`
+				FriendlyName   string   `xml:"FriendlyName,attr"`
+				AttributeValue []string `xml:"AttributeValue"`
+			} `xml:"Attribute"`
+		} `xml:"AttributeStatement"`
+	} `xml:"Assertion"`
+	EncryptedAssertion *struct{} `xml:"EncryptedAssertion"`
+}
+
+// DecodeSAMLResponse returns the XML of a SAML response given as XML, as the
+// base64 encoded value posted by the identity provider, or as the whole form
+// body of that post.
+func DecodeSAMLResponse(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("<")) {
+		return data, nil
+	}
+
+	encoded := string(data)
+	if strings.Contains(encoded, "SAMLResponse=") {
+		form, err := url.ParseQuery(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the SAML form post: %w", err)
+		}
+		encoded = form.Get("SAMLResponse")
+	}
+	encoded = strings.Join(strings.Fields(encoded), "")
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("not a SAML response, expected XML, base64 encoded XML, or a SAMLResponse form post")
+	}
+	return bytes.TrimSpace(decoded), nil
+}
+
+// SAMLFormPost returns the form body an identity provider posts to the
+// callback for a SAML response in any form handled by DecodeSAMLResponse. A
+// captured form post is returned as is so its relay state is kept.
+func SAMLFormPost(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Contains(data, []byte("SAMLResponse=")) {
+		return data, nil
+	}
+	raw, err := DecodeSAMLResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(raw)}}
+	return []byte(form.Encode()), nil
+}
+
+// InspectSAMLResponse summarizes a SAML response, accepting any form handled
+// by DecodeSAMLResponse. Signatures are verified against the certificates in
+// the identity provider's metadata if given, as of when the response was
+// issued so saved responses can be inspected after they expire.
+func InspectSAMLResponse(data []byte, metadata *samlTypes.EntityDescriptor) (SAMLAssertion, error) {
+	var assertion SAMLAssertion
+	raw, err := DecodeSAMLResponse(data)
+	if err != nil {
+		return assertion, err
+	}
+
+	var resp samlResponseXML
+	err = xml.Unmarshal(raw, &resp)
+	if err != nil {
+		return assertion, fmt.Errorf("unable to parse the SAML response: %w", err)
+	}
+	if resp.XMLName.Local != "Response" {
+		return assertion, fmt.Errorf("expected a SAML Response, found %v", resp.XMLName.Local)
+	}
+
+	assertion.Destination = resp.Destination
+	assertion.Status = strings.TrimPrefix(resp.Status.StatusCode.Value, "urn:oasis:names:tc:SAML:2.0:status:")
+	if resp.Status.StatusMessage != "" {
+		assertion.Status += ": " + strings.TrimSpace(resp.Status.StatusMessage)
+	}
+	assertion.Issuer = strings.TrimSpace(resp.Issuer)
+	assertion.IssueInstant = parseSAMLTime(resp.IssueInstant)
+	assertion.Encrypted = resp.EncryptedAssertion != nil
+
+	if a := resp.Assertion; a != nil {
+		if issuer := strings.TrimSpace(a.Issuer); issuer != "" {
+			assertion.Issuer = issuer
+		}
+		if issued := parseSAMLTime(a.IssueInstant); !issued.IsZero() {
+			assertion.IssueInstant = issued
+		}
+		assertion.Subject = strings.TrimSpace(a.Subject.NameID)
+		for _, restriction := range a.Conditions.AudienceRestriction {
+			for _, audience := range restriction.Audience {
+				assertion.Audiences = append(assertion.Audiences, strings.TrimSpace(audience))
+			}
+		}
+		assertion.NotBefore = parseSAMLTime(a.Conditions.NotBefore)
+		assertion.NotOnOrAfter = parseSAMLTime(a.Conditions.NotOnOrAfter)
+		if assertion.NotOnOrAfter.IsZero() {
+			assertion.NotOnOrAfter = parseSAMLTime(a.Subject.SubjectConfirmation.SubjectConfirmationData.NotOnOrAfter)
+		}
+		for _, attr := range a.AttributeStatement.Attribute {
+			name := attr.Name
+			if attr.FriendlyName != "" {
+				name = attr.FriendlyName
+			}
+			var values []string
+			for _, value := range attr.AttributeValue {
+				if sensitiveAttribute.MatchString(name) {
+					value = redacted
+				}
+				values = append(values, strings.TrimSpace(value))
+			}
+			assertion.Attributes = append(assertion.Attributes, SAMLAttribute{Name: name, Values: values})
+		}
+	}
+
+	checkSAMLSignature(&assertion, raw, metadata)
+	return assertion, nil
+}
+
+// checkSAMLSignature notes whether the response or its assertion is signed
+// and, given metadata, whether the signature is valid. A valid signature on
+// either is enough, as it is for Kion.
+func checkSAMLSignature(assertion *SAMLAssertion, raw []byte, metadata *samlTypes.EntityDescriptor) {
+	assertion.Signature = SignatureMissing
+
+	doc := etree.NewDocument()
+	err := doc.ReadFromBytes(raw)
+	if err != nil || doc.Root() == nil {
+		return
+	}
+	response := doc.Root()
+	signed := map[string]*etree.Element{}
+	if response.SelectElement("Signature") != nil {
+		signed["response"] = response
+	}
+	if a := response.SelectElement("Assertion"); a != nil && a.SelectElement("Signature") != nil {
+		signed["assertion"] = a
+	}
+	if len(signed) == 0 {
+		return
+	}
+
+	if metadata == nil {
+		assertion.Signature = SignatureUnverified
+		assertion.SignedElement = signedNames(signed)
+		assertion.SignatureDetail = "no saml metadata to verify against"
+		return
+	}
+	certStore, err := samlCertStore(metadata)
+	if err != nil {
+		assertion.Signature = SignatureUnverified
+		assertion.SignedElement = signedNames(signed)
+		assertion.SignatureDetail = fmt.Sprintf("unable to read the metadata certificates: %v", err)
+		return
+	}
+
+	ctx := dsig.NewDefaultValidationContext(certStore)
+	if !assertion.IssueInstant.IsZero() {
+		ctx.Clock = dsig.NewFakeClockAt(assertion.IssueInstant)
+	}
+	var failures []string
+	for _, name := range []string{"response", "assertion"} {
+		el, found := signed[name]
+		if !found {
+			continue
+		}
+
+		// carry namespaces declared on the response over to the assertion
+		nsCtx, err := etreeutils.NSBuildParentContext(el)
+		if err == nil {
+			el, err = etreeutils.NSDetatch(nsCtx, el)
+		}
+		if err == nil {
+			_, err = ctx.Validate(el)
+		}
+		if err == nil {
+			assertion.Signature = SignatureValid
+			assertion.SignedElement = name
+			assertion.SignatureDetail = ""
+			return
+		}
+		failures = append(failures, fmt.Sprintf("%v: %v", name, err))
+	}
+	assertion.Signature = SignatureInvalid
+	assertion.SignedElement = signedNames(signed)
+	assertion.SignatureDetail = strings.Join(failures, ", ")
+}
+
+// signedNames lists what was found signed in a response.
+func signedNames(signed map[string]*etree.Element) string {
+	if len(signed) == 2 {
+		return "response and assertion"
+	}
+	for name := range signed {
+		return name
+	}
+	return ""
+}
+
+// samlCertStore returns the signing certificates of an identity provider from
+// its metadata.
+func samlCertStore(metadata *samlTypes.EntityDescriptor) (*dsig.MemoryX509CertificateStore, error) {
+	certStore := &dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{},
+	}
+
+	for _, kd := range metadata.IDPSSODescriptor.KeyDescriptors {
+		for idx, xcert := range kd.KeyInfo.X509Data.X509Certificates {
+			if xcert.Data == "" {
+				return nil, fmt.Errorf("%w: certificate %d is empty", ErrMetadataInvalid, idx)
+			}
+			certData, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(xcert.Data), ""))
+			if err != nil {
+				return nil, fmt.Errorf("%w: certificate %d: %w", ErrMetadataInvalid, idx, err)
+			}
+
+			idpCert, err := x509.ParseCertificate(certData)
+			if err != nil {
+				return nil, fmt.Errorf("%w: certificate %d: %w", ErrMetadataInvalid, idx, err)
+			}
+
+			certStore.Roots = append(certStore.Roots, idpCert)
+		}
+	}
+
+	return certStore, nil
+}
+
+// SAMLCertificates returns the identity provider certificates listed in
+// metadata that SAML responses are verified against.
+func SAMLCertificates(metadata *samlTypes.EntityDescriptor) ([]*x509.Certificate, error) {
+	if metadata.IDPSSODescriptor == nil {
+		return nil, fmt.Errorf("%w: it doesn't describe an identity provider", ErrMetadataInvalid)
+	}
+	certStore, err := samlCertStore(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return certStore.Roots, nil
+}
+
+// CheckSAMLStatus returns ErrIDPRejected, with the status and any message
+// given, if a SAML response in any form handled by DecodeSAMLResponse
+// reports the identity provider refused the sign in. Responses that can't be
+// parsed are left for Kion to judge.
+func CheckSAMLStatus(data []byte) error {
+	raw, err := DecodeSAMLResponse(data)
+	if err != nil {
+		return nil
+	}
+	var resp samlResponseXML
+	if xml.Unmarshal(raw, &resp) != nil || resp.Status.StatusCode.Value == "" {
+		return nil
+	}
+	status := strings.TrimPrefix(resp.Status.StatusCode.Value, "urn:oasis:names:tc:SAML:2.0:status:")
+	if status == "Success" {
+		return nil
+	}
+	if message := strings.TrimSpace(resp.Status.StatusMessage); message != "" {
+		status += ": " + message
+	}
+	return fmt.Errorf("%w (%v)", ErrIDPRejected, status)
+}
+
+// parseSAMLTime parses a SAML timestamp, returning the zero time if it is
+// missing or malformed.
+func parseSAMLTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// validateSAMLResponse checks the SAML response in a form posted to the
+// callback as Kion will, so a response Kion would refuse is reported for what
+// is wrong with it: its signature against the identity provider's metadata,
+// its issuer, its audience, and its validity window. What can't be judged
+// here is left for Kion, such as encrypted assertions, missing elements, a
+// recipient other than the callback, or an expired signing certificate.
+func validateSAMLResponse(signIn *saml2.SAMLServiceProvider, form []byte, now time.Time) error {
+	values, err := url.ParseQuery(string(form))
+	if err != nil {
+		return nil
+	}
+	encoded := values.Get("SAMLResponse")
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	var resp samlResponseXML
+	if xml.Unmarshal(raw, &resp) != nil || resp.Assertion == nil {
+		return nil
+	}
+	a := resp.Assertion
+
+	// the response is checked as addressed, Kion judges where it was sent,
+	// and the validity window allowing for clocks to disagree a little
+	sp := &saml2.SAMLServiceProvider{
+		IdentityProviderIssuer:      signIn.IdentityProviderIssuer,
+		ServiceProviderIssuer:       signIn.ServiceProviderIssuer,
+		AssertionConsumerServiceURL: strings.TrimSpace(a.Subject.SubjectConfirmation.SubjectConfirmationData.Recipient),
+		AudienceURI:                 signIn.ServiceProviderIssuer,
+		IDPCertificateStore:         signIn.IDPCertificateStore,
+		SPKeyStore:                  signIn.SPKeyStore,
+		AllowMissingAttributes:      true,
+		Clock:                       dsig.NewFakeClockAt(now.Add(-samlClockTolerance)),
+	}
+
+	issued := parseSAMLTime(a.IssueInstant)
+	notBefore := parseSAMLTime(a.Conditions.NotBefore)
+	notOnOrAfter := parseSAMLTime(a.Conditions.NotOnOrAfter)
+	if expires := parseSAMLTime(a.Subject.SubjectConfirmation.SubjectConfirmationData.NotOnOrAfter); notOnOrAfter.IsZero() || !expires.IsZero() && expires.Before(notOnOrAfter) {
+		notOnOrAfter = expires
+	}
+
+	info, err := sp.RetrieveAssertionInfo(encoded)
+	var verification saml2.ErrVerification
+	if errors.As(err, &verification) {
+		err = verification.Cause
+	}
+	var invalid saml2.ErrInvalidValue
+	var missing saml2.ErrMissingElement
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid) && invalid.Reason == saml2.ReasonExpired:
+		return checkSAMLWindow(issued, notBefore, notOnOrAfter, now)
+	case errors.As(err, &invalid) && invalid.Key == saml2.IssuerTag:
+		return fmt.Errorf("%w: it was issued by %v, the metadata is for %v", ErrSAMLIssuer, invalid.Actual, invalid.Expected)
+	case strings.Contains(err.Error(), "not valid at this time"):
+		Log.Info("saml response signed with a certificate not valid now, left for kion to validate", "reason", err)
+		return checkSAMLWindow(issued, notBefore, notOnOrAfter, now)
+	case errors.As(err, &invalid), errors.As(err, &missing):
+		Log.Info("saml response left for kion to validate", "reason", err)
+		return nil
+	default:
+		return fmt.Errorf("%w: %v, check kion.saml_metadata_file is current with the identity provider's signing certificate", ErrSAMLSignature, err)
+	}
+
+	if info.WarningInfo.NotInAudience && sp.AudienceURI != "" {
+		var audiences []string
+		for _, restriction := range a.Conditions.AudienceRestriction {
+			for _, audience := range restriction.Audience {
+				audiences = append(audiences, strings.TrimSpace(audience))
+			}
+		}
+		return fmt.Errorf("%w: it is for %v, kion.saml_sp_issuer is %v", ErrSAMLAudience, strings.Join(audiences, ", "), sp.AudienceURI)
+	}
+	return checkSAMLWindow(issued, notBefore, notOnOrAfter, now)
+}
+
+// checkSAMLWindow checks now falls within the validity window of an
+// assertion issued at issued, allowing for samlClockTolerance. A response is
+// posted to the callback moments after it is issued, so one issued long ago
+// by the identity provider's clock means this clock is ahead of it.
+func checkSAMLWindow(issued time.Time, notBefore time.Time, notOnOrAfter time.Time, now time.Time) error {
+	switch {
+	case !notBefore.IsZero() && now.Add(samlClockTolerance).Before(notBefore):
+		return fmt.Errorf("%w: the assertion is valid from %v, this clock is at least %v behind, sync it with network time", ErrSAMLClockSkew, notBefore.Local().Format(time.RFC3339), notBefore.Sub(now).Round(time.Second))
+	case notOnOrAfter.IsZero() || now.Add(-samlClockTolerance).Before(notOnOrAfter):
+		return nil
+	case !issued.IsZero() && now.Sub(issued) > samlClockTolerance:
+		return fmt.Errorf("%w and %w: it was valid until %v, and issued %v ago by the identity provider's clock, this clock is likely ahead, sync it with network time", ErrSAMLExpired, ErrSAMLClockSkew, notOnOrAfter.Local().Format(time.RFC3339), now.Sub(issued).Round(time.Second))
+	default:
+		return fmt.Errorf("%w: it was only valid until %v, sign in again", ErrSAMLExpired, notOnOrAfter.Local().Format(time.RFC3339))
+	}
+}
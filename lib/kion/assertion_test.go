@@ -0,0 +1,354 @@
+package kion
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	saml2 "github.com/russellhaering/gosaml2"
+	samlTypes "github.com/russellhaering/gosaml2/types"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	dsigTypes "github.com/russellhaering/goxmldsig/types"
+)
+
+// testSAMLResponse returns a SAML response issued at the given time with its
+// assertion signed by ks, or unsigned if ks is nil.
+func testSAMLResponse(t *testing.T, ks dsig.X509KeyStore, issued time.Time) []byte {
+	t.Helper()
+	instant := issued.UTC().Format(time.RFC3339)
+	expires := issued.Add(5 * time.Minute).UTC().Format(time.RFC3339)
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="r1" Version="2.0" IssueInstant="%[1]v" Destination="http://localhost:8400/callback">
+<saml:Issuer>https://idp.example</saml:Issuer>
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+<saml:Assertion ID="a1" Version="2.0" IssueInstant="%[1]v">
+<saml:Issuer>https://idp.example</saml:Issuer>
+<saml:Subject><saml:NameID>jane@example.com</saml:NameID><saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData NotOnOrAfter="%[2]v" Recipient="http://localhost:8400/callback"/></saml:SubjectConfirmation></saml:Subject>
+<saml:Conditions NotBefore="%[1]v" NotOnOrAfter="%[2]v"><saml:AudienceRestriction><saml:Audience>https://kion.example/api/v1/saml/auth/1</saml:Audience></saml:AudienceRestriction></saml:Conditions>
+<saml:AttributeStatement>
+<saml:Attribute Name="email"><saml:AttributeValue>jane@example.com</saml:AttributeValue></saml:Attribute>
+<saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>developers</saml:AttributeValue></saml:Attribute>
+<saml:Attribute Name="session_token"><saml:AttributeValue>s3cr3t</saml:AttributeValue></saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`, instant, expires))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ks != nil {
+		response := doc.Root()
+		assertion := response.SelectElement("Assertion")
+		ctx, err := etreeutils.NSBuildParentContext(assertion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		detached, err := etreeutils.NSDetatch(ctx, assertion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := dsig.NewDefaultSigningContext(ks).SignEnveloped(detached)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.RemoveChild(assertion)
+		response.AddChild(signed)
+	}
+
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testSAMLMetadata returns identity provider metadata holding the certificate
+// of ks.
+func testSAMLMetadata(t *testing.T, ks dsig.X509KeyStore) *samlTypes.EntityDescriptor {
+	t.Helper()
+	_, cert, err := ks.GetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &samlTypes.EntityDescriptor{
+		EntityID: "https://idp.example",
+		IDPSSODescriptor: &samlTypes.IDPSSODescriptor{
+			KeyDescriptors: []samlTypes.KeyDescriptor{{
+				KeyInfo: dsigTypes.KeyInfo{X509Data: dsigTypes.X509Data{
+					X509Certificates: []dsigTypes.X509Certificate{{Data: base64.StdEncoding.EncodeToString(cert)}},
+				}},
+			}},
+		},
+	}
+}
+
+func TestDecodeSAMLResponse(t *testing.T) {
+	raw := []byte(`<samlp:Response/>`)
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		description string
+		input       string
+		wantErr     bool
+	}{
+		{"XML", "\n" + string(raw) + "\n", false},
+		{"Base64", encoded, false},
+		{"Wrapped Base64", encoded[:8] + "\n" + encoded[8:], false},
+		{"Form Post", "RelayState=&SAMLResponse=" + url.QueryEscape(encoded), false},
+		{"Garbage", "not a response!", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := DecodeSAMLResponse([]byte(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %q, wanted an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(raw) {
+				t.Errorf("got %q, wanted %q", got, raw)
+			}
+		})
+	}
+}
+
+func TestSAMLFormPost(t *testing.T) {
+	raw := `<samlp:Response/>`
+	encoded := base64.StdEncoding.EncodeToString([]byte(raw))
+	form := "SAMLResponse=" + url.QueryEscape(encoded)
+
+	tests := []struct {
+		description string
+		input       string
+		want        string
+	}{
+		{"XML", raw, form},
+		{"Base64", encoded + "\n", form},
+		{"Form Post Kept", "SAMLResponse=" + url.QueryEscape(encoded) + "&RelayState=abc\n", form + "&RelayState=abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SAMLFormPost([]byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckSAMLStatus(t *testing.T) {
+	response := func(status string) []byte {
+		return []byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><samlp:Status>` + status + `</samlp:Status></samlp:Response>`)
+	}
+
+	tests := []struct {
+		description string
+		data        []byte
+		want        string
+	}{
+		{
+			"Success",
+			testSAMLResponse(t, nil, time.Now()),
+			"",
+		},
+		{
+			"Rejected",
+			response(`<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Responder"/><samlp:StatusMessage> User is not assigned to this application </samlp:StatusMessage>`),
+			"the identity provider rejected the sign in (Responder: User is not assigned to this application)",
+		},
+		{
+			"Form Post",
+			[]byte(url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(response(`<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"/>`))}}.Encode()),
+			"the identity provider rejected the sign in (AuthnFailed)",
+		},
+		{
+			"No Status",
+			[]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"/>`),
+			"",
+		},
+		{
+			"Unparsable",
+			[]byte("SAMLResponse=abc"),
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckSAMLStatus(test.data)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got %v, wanted no error", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIDPRejected) || err.Error() != test.want {
+				t.Errorf("got %v, wanted %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestInspectSAMLResponse(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	other := dsig.RandomKeyStoreForTest()
+	issued := time.Now().Add(-time.Minute).Truncate(time.Second)
+	signed := testSAMLResponse(t, ks, issued)
+
+	tests := []struct {
+		description   string
+		response      []byte
+		metadata      *samlTypes.EntityDescriptor
+		wantSignature string
+		wantElement   string
+	}{
+		{"Valid", signed, testSAMLMetadata(t, ks), SignatureValid, "assertion"},
+		{"Other Certificate", signed, testSAMLMetadata(t, other), SignatureInvalid, "assertion"},
+		{"No Metadata", signed, nil, SignatureUnverified, "assertion"},
+		{"Unsigned", testSAMLResponse(t, nil, issued), testSAMLMetadata(t, ks), SignatureMissing, ""},
+		{"Tampered", []byte(strings.Replace(string(signed), "developers", "everyone", 1)), testSAMLMetadata(t, ks), SignatureInvalid, "assertion"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := InspectSAMLResponse(test.response, test.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Signature != test.wantSignature || got.SignedElement != test.wantElement {
+				t.Errorf("got signature %v on %q (%v), wanted %v on %q", got.Signature, got.SignedElement, got.SignatureDetail, test.wantSignature, test.wantElement)
+			}
+
+			want := SAMLAssertion{
+				Destination:  "http://localhost:8400/callback",
+				Status:       "Success",
+				IssueInstant: issued.UTC(),
+				Issuer:       "https://idp.example",
+				Subject:      "jane@example.com",
+				Audiences:    []string{"https://kion.example/api/v1/saml/auth/1"},
+				NotBefore:    issued.UTC(),
+				NotOnOrAfter: issued.Add(5 * time.Minute).UTC(),
+				Attributes: []SAMLAttribute{
+					{Name: "email", Values: []string{"jane@example.com"}},
+					{Name: "groups", Values: []string{"admins", "developers"}},
+					{Name: "session_token", Values: []string{redacted}},
+				},
+			}
+			if test.description == "Tampered" {
+				want.Attributes[1].Values[1] = "everyone"
+			}
+			got.Signature, got.SignedElement, got.SignatureDetail = "", "", ""
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, want)
+			}
+		})
+	}
+
+	// anything but a response is rejected
+	_, err := InspectSAMLResponse([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"/>`), nil)
+	if err == nil {
+		t.Error("got no error inspecting metadata")
+	}
+}
+
+func TestValidateSAMLResponse(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	other := dsig.RandomKeyStoreForTest()
+	issued := time.Now().Truncate(time.Second)
+	signed := testSAMLResponse(t, ks, issued)
+	form := func(response []byte) []byte {
+		return []byte(url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(response)}}.Encode())
+	}
+
+	tests := []struct {
+		description string
+		form        []byte
+		signer      dsig.X509KeyStore
+		issuer      string
+		audience    string
+		now         time.Time
+		wantErr     error
+	}{
+		{"Valid", form(signed), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued.Add(time.Minute), nil},
+		{"No Audience Configured", form(signed), ks, "https://idp.example", "", issued.Add(time.Minute), nil},
+		{"Slightly Skewed", form(signed), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued.Add(-2 * time.Minute), nil},
+		{"Other Certificate", form(signed), other, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued, ErrSAMLSignature},
+		{"Tampered", form([]byte(strings.Replace(string(signed), "developers", "everyone", 1))), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued, ErrSAMLSignature},
+		{"Unsigned", form(testSAMLResponse(t, nil, issued)), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued, ErrSAMLSignature},
+		{"Other Issuer", form(signed), ks, "https://other-idp.example", "https://kion.example/api/v1/saml/auth/1", issued, ErrSAMLIssuer},
+		{"Wrong Audience", form(signed), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/2", issued, ErrSAMLAudience},
+		{"Clock Behind", form(signed), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued.Add(-10 * time.Minute), ErrSAMLClockSkew},
+		{"Clock Ahead", form(signed), ks, "https://idp.example", "https://kion.example/api/v1/saml/auth/1", issued.Add(time.Hour), ErrSAMLClockSkew},
+		{"Not A Form", []byte("%zz"), ks, "https://idp.example", "", issued, nil},
+		{"Encrypted", form([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><EncryptedAssertion/></samlp:Response>`)), ks, "https://idp.example", "", issued, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			metadata := testSAMLMetadata(t, test.signer)
+			certStore, err := samlCertStore(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sp := &saml2.SAMLServiceProvider{
+				IdentityProviderIssuer: test.issuer,
+				ServiceProviderIssuer:  test.audience,
+				IDPCertificateStore:    certStore,
+				SPKeyStore:             dsig.RandomKeyStoreForTest(),
+			}
+			err = validateSAMLResponse(sp, test.form, test.now)
+			if test.wantErr == nil && err != nil || test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("got error %v, wanted %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSAMLWindow(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description  string
+		issued       time.Time
+		notOnOrAfter time.Time
+		now          time.Time
+		wantErrs     []error
+	}{
+		{"Within", issued, issued.Add(5 * time.Minute), issued.Add(time.Minute), nil},
+		{"Within Tolerance", issued, issued.Add(5 * time.Minute), issued.Add(7 * time.Minute), nil},
+		{"Expired", time.Time{}, issued.Add(5 * time.Minute), issued.Add(10 * time.Minute), []error{ErrSAMLExpired}},
+		{"Ahead", issued, issued.Add(5 * time.Minute), issued.Add(20 * time.Minute), []error{ErrSAMLExpired, ErrSAMLClockSkew}},
+		{"Behind", issued, issued.Add(5 * time.Minute), issued.Add(-5 * time.Minute), []error{ErrSAMLClockSkew}},
+		{"No Window", issued, time.Time{}, issued.Add(time.Hour), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := checkSAMLWindow(test.issued, issued, test.notOnOrAfter, test.now)
+			if (err != nil) != (len(test.wantErrs) > 0) {
+				t.Fatalf("got error %v, wanted %v", err, test.wantErrs)
+			}
+			for _, want := range test.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("got error %v, wanted %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package kion
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -50,6 +52,12 @@ type AuthRequest struct {
 	Password string `json:"password"`
 }
 
+// RefreshRequest maps to the required post body when refreshing a session
+// with the Kion API.
+type RefreshRequest struct {
+	Token string `json:"token"`
+}
+
 // AuthResponse maps to the Kion API response.
 type AuthResponse struct {
 	Status  int     `json:"status"`
@@ -97,8 +105,14 @@ func Authenticate(host string, idmsID uint, un string, pw string) (Session, erro
 		Username: un,
 		Password: pw,
 	}
-	resp, _, err := runQuery("POST", url, "", query, data)
+	resp, _, err := runAuthQuery("POST", url, query, data)
 	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			if challenge, found := parseMFAChallenge(apiErr.Body); found {
+				return Session{}, &MFARequiredError{Challenge: challenge}
+			}
+		}
 		return Session{}, err
 	}
 
@@ -109,5 +123,58 @@ func Authenticate(host string, idmsID uint, un string, pw string) (Session, erro
 		return Session{}, err
 	}
 
+	// a challenge in place of a token means a second factor is needed
+	if challenge, found := parseMFAChallenge(string(resp)); found && authResp.Session.Access.Token == "" {
+		return Session{}, &MFARequiredError{Challenge: challenge}
+	}
+
 	return authResp.Session, nil
 }
+
+// RefreshSession queries the Kion API to trade the refresh token of a session
+// for a new one, without the user signing in again. The user of the session
+// is carried over, as is its refresh token if Kion doesn't issue a new one.
+func RefreshSession(host string, session Session) (Session, error) {
+	if session.Refresh.Token == "" {
+		return Session{}, errors.New("the session has no refresh token")
+	}
+
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/token/refresh", host)
+	query := map[string]string{}
+	data := RefreshRequest{Token: session.Refresh.Token}
+	resp, _, err := runAuthQuery("POST", url, query, data)
+	if err != nil {
+		return Session{}, err
+	}
+
+	// unmarshal response body
+	authResp := AuthResponse{}
+	err = json.Unmarshal(resp, &authResp)
+	if err != nil {
+		return Session{}, err
+	}
+	refreshed := authResp.Session
+	if refreshed.Access.Token == "" {
+		return Session{}, errors.New("kion returned no token for the refreshed session")
+	}
+	if refreshed.Refresh.Token == "" {
+		refreshed.Refresh = session.Refresh
+	}
+	refreshed.IDMSID = session.IDMSID
+	refreshed.UserName = session.UserName
+
+	return refreshed, nil
+}
+
+// apiMessage returns the message of a Kion API error body, or the body itself
+// if it has none.
+func apiMessage(body string) string {
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal([]byte(body), &parsed) == nil && parsed.Message != "" {
+		return parsed.Message
+	}
+	return strings.TrimSpace(body)
+}
@@ -0,0 +1,75 @@
+package kion
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRefreshSession(t *testing.T) {
+	tests := []struct {
+		description string
+		response    string
+		wantAccess  string
+		wantRefresh string
+		wantErr     bool
+	}{
+		{
+			"New Refresh Token",
+			`{"status": 200, "data": {"access": {"token": "access-2", "expiry": "2030-01-02T10:00:00Z"}, "refresh": {"token": "refresh-2", "expiry": "2030-01-03T09:00:00Z"}}}`,
+			"access-2",
+			"refresh-2",
+			false,
+		},
+		{
+			"Refresh Token Kept",
+			`{"status": 200, "data": {"access": {"token": "access-2", "expiry": "2030-01-02T10:00:00Z"}}}`,
+			"access-2",
+			"refresh-1",
+			false,
+		},
+		{
+			"No Access Token",
+			`{"status": 200, "data": {}}`,
+			"",
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got RefreshRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/token/refresh" {
+					http.NotFound(w, r)
+					return
+				}
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				_, _ = w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			session := Session{IDMSID: 2, UserName: "jane"}
+			session.Refresh.Token = "refresh-1"
+			session.Refresh.Expiry = "2030-01-02T17:00:00Z"
+			refreshed, err := RefreshSession(server.URL, session)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if got.Token != "refresh-1" {
+				t.Errorf("sent refresh token %q, wanted refresh-1", got.Token)
+			}
+			if test.wantErr {
+				return
+			}
+			if refreshed.Access.Token != test.wantAccess || refreshed.Refresh.Token != test.wantRefresh {
+				t.Errorf("got tokens %q %q, wanted %q %q", refreshed.Access.Token, refreshed.Refresh.Token, test.wantAccess, test.wantRefresh)
+			}
+			if refreshed.IDMSID != 2 || refreshed.UserName != "jane" {
+				t.Errorf("got user %v %v, wanted the user of the session", refreshed.IDMSID, refreshed.UserName)
+			}
+		})
+	}
+}
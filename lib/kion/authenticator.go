@@ -0,0 +1,60 @@
+package kion
+
+import (
+	"fmt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Authenticators                                                            //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Authenticator exchanges credentials for a Kion session. Sessions without an
+// access expiry, such as those built from a user provided API key, are
+// treated as long lived tokens rather than sessions.
+type Authenticator interface {
+	Authenticate(host string) (Session, error)
+}
+
+// AuthenticatorFunc adapts an ordinary function to an Authenticator.
+type AuthenticatorFunc func(host string) (Session, error)
+
+// Authenticate calls f.
+func (f AuthenticatorFunc) Authenticate(host string) (Session, error) {
+	return f(host)
+}
+
+var (
+	// authenticators holds registered authenticators by name.
+	authenticators = make(map[string]Authenticator)
+
+	// authenticatorNames preserves registration order for prompting.
+	authenticatorNames []string
+)
+
+// RegisterAuthenticator makes an authenticator available by name. Names must
+// be unique.
+func RegisterAuthenticator(name string, authenticator Authenticator) error {
+	if name == "" || authenticator == nil {
+		return fmt.Errorf("an authenticator requires a name and implementation")
+	}
+	if _, found := authenticators[name]; found {
+		return fmt.Errorf("authenticator already registered: %v", name)
+	}
+	authenticators[name] = authenticator
+	authenticatorNames = append(authenticatorNames, name)
+	return nil
+}
+
+// LookupAuthenticator returns the authenticator registered with name.
+func LookupAuthenticator(name string) (Authenticator, bool) {
+	authenticator, found := authenticators[name]
+	return authenticator, found
+}
+
+// AuthenticatorNames returns the names of all registered authenticators in
+// the order they were registered.
+func AuthenticatorNames() []string {
+	return append([]string(nil), authenticatorNames...)
+}
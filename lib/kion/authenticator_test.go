@@ -0,0 +1,83 @@
+package kion
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRegisterAuthenticator(t *testing.T) {
+	failure := errors.New("failed")
+	fake := AuthenticatorFunc(func(host string) (Session, error) {
+		if host == "" {
+			return Session{}, failure
+		}
+		var session Session
+		session.Access.Token = "token-for-" + host
+		return session, nil
+	})
+
+	err := RegisterAuthenticator("Test Fake", fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		name        string
+		auth        Authenticator
+		wantErr     bool
+	}{
+		{
+			"Duplicate Name",
+			"Test Fake",
+			fake,
+			true,
+		},
+		{
+			"Empty Name",
+			"",
+			fake,
+			true,
+		},
+		{
+			"Nil Authenticator",
+			"Test Nil",
+			nil,
+			true,
+		},
+		{
+			"Unique Name",
+			"Test Other",
+			fake,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := RegisterAuthenticator(test.name, test.auth)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+		})
+	}
+
+	// registered authenticators are found by name and listed in order
+	auth, found := LookupAuthenticator("Test Fake")
+	if !found {
+		t.Fatal("registered authenticator not found")
+	}
+	session, err := auth.Authenticate("kion.example")
+	if err != nil || session.Access.Token != "token-for-kion.example" {
+		t.Errorf("got session %v and error %v", session, err)
+	}
+	_, err = auth.Authenticate("")
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, wanted %v", err, failure)
+	}
+	names := AuthenticatorNames()
+	if slices.Index(names, "Test Fake") > slices.Index(names, "Test Other") || slices.Contains(names, "Test Nil") {
+		t.Errorf("unexpected authenticator names: %v", names)
+	}
+}
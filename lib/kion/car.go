@@ -50,6 +50,27 @@ type CAR struct {
 	WebAccess bool `json:"web_access"`
 }
 
+// Access levels a cloud access role can offer.
+const (
+	// AccessLevelCLI is access with short term access keys.
+	AccessLevelCLI = "cli"
+	// AccessLevelWeb is access to the web console.
+	AccessLevelWeb = "web"
+)
+
+// AccessLevels returns the kinds of access the cloud access role offers. It is
+// empty when Kion didn't report them, as with some older APIs.
+func (c CAR) AccessLevels() []string {
+	var levels []string
+	if c.ShortTermAccessKeys {
+		levels = append(levels, AccessLevelCLI)
+	}
+	if c.WebAccess {
+		levels = append(levels, AccessLevelWeb)
+	}
+	return levels
+}
+
 // GetCARS queries the Kion API for all cloud access roles to which the
 // authenticated user has access. Deleted CARs will be excluded.
 func GetCARS(host string, token string) ([]CAR, error) {
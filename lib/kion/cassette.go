@@ -0,0 +1,220 @@
+package kion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Cassettes                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Cassette modes, whether requests to Kion are recorded to a cassette or
+// answered from one.
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// ErrCassetteMiss is returned when replaying a cassette that holds no
+// response for a request.
+var ErrCassetteMiss = errors.New("no recorded response")
+
+// cassetteHeaders are the response headers kept when recording, others such
+// as Set-Cookie are dropped.
+var cassetteHeaders = []string{
+	"Content-Type", "Location", "Retry-After", "X-Request-Id",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+}
+
+// cassette, when set, records or replays every request to Kion.
+var cassette *Cassette
+
+// Cassette holds requests made to Kion and the responses to them, so commands
+// can be run offline against a recording of a real instance. Secrets are
+// redacted as interactions are recorded, and hosts are left out so a
+// cassette recorded against one instance replays against any URL.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	path   string
+	mode   string
+	mu     sync.Mutex
+	played []bool
+}
+
+// Interaction is a single request to Kion and its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a recorded request, its URL holding only the path and
+// query.
+type CassetteRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// CassetteResponse is a recorded response.
+type CassetteResponse struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+}
+
+// LoadCassette opens the cassette at path in the given mode. Recording starts
+// a new cassette, replaying reads an existing one.
+func LoadCassette(path string, mode string) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode}
+	switch mode {
+	case CassetteRecord:
+		return c, nil
+	case CassetteReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the cassette: %w", err)
+		}
+		err = json.Unmarshal(data, c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cassette %v: %w", path, err)
+		}
+		c.played = make([]bool, len(c.Interactions))
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unsupported cassette mode %q, expected %v or %v", mode, CassetteRecord, CassetteReplay)
+	}
+}
+
+// UseCassette records or replays every request to Kion with c, or stops
+// doing so when c is nil.
+func UseCassette(c *Cassette) {
+	cassette = c
+}
+
+// Save writes a recorded cassette to its file, readable only by the user.
+// Replayed cassettes are left as they were.
+func (c *Cassette) Save() error {
+	if c.mode != CassetteRecord {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(c.path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0600)
+}
+
+// httpTransport returns the transport requests to Kion are sent with, going
+// through the cassette in use if any, traced when Log is enabled, and timed
+// when Timings is set.
+func httpTransport() http.RoundTripper {
+	if cassette == nil {
+		return timed(PhaseKion, traced(transport))
+	}
+	return timed(PhaseKion, traced(cassetteTransport{cassette: cassette, next: transport}))
+}
+
+// cassetteTransport records requests to a cassette or answers them from it.
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := CassetteRequest{
+		Method: req.Method,
+		URL:    redactURL(req.URL),
+		Body:   redactBody(body),
+	}
+
+	if t.cassette.mode == CassetteReplay {
+		return t.cassette.replay(req, recorded)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	headers := make(map[string][]string)
+	for _, name := range cassetteHeaders {
+		for _, value := range resp.Header.Values(name) {
+			headers[name] = append(headers[name], secretCodeParam.ReplaceAllString(value, "${1}"+url.QueryEscape(redactedValue)))
+		}
+	}
+	t.cassette.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request:  recorded,
+		Response: CassetteResponse{Status: resp.StatusCode, Headers: headers, Body: redactBody(respBody)},
+	})
+	t.cassette.mu.Unlock()
+	return resp, nil
+}
+
+// replay answers a request with the first response recorded for the same
+// method and URL that hasn't been played yet, so repeated requests get their
+// responses in the order recorded.
+func (c *Cassette) replay(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.Interactions {
+		if c.played[i] || interaction.Request.Method != recorded.Method || interaction.Request.URL != recorded.URL {
+			continue
+		}
+		c.played[i] = true
+		header := make(http.Header)
+		for name, values := range interaction.Response.Headers {
+			for _, value := range values {
+				header.Add(name, value)
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%v %v", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for %v %v in %v", ErrCassetteMiss, recorded.Method, recorded.URL, c.path)
+}
@@ -0,0 +1,211 @@
+package kion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// useCassette replays the named cassette in testdata/cassettes for the
+// duration of a test, returning the Kion URL to use. With KION_RECORD_CASSETTES
+// and KION_SANDBOX_URL set the cassette is recorded against that sandbox
+// instead, replacing the one in testdata.
+func useCassette(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join("testdata", "cassettes", name+".json")
+	host, mode := "https://kion.invalid", CassetteReplay
+	if sandbox := os.Getenv("KION_SANDBOX_URL"); sandbox != "" && os.Getenv("KION_RECORD_CASSETTES") != "" {
+		host, mode = strings.TrimSuffix(sandbox, "/"), CassetteRecord
+	}
+	c, err := LoadCassette(path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCassette(c)
+	t.Cleanup(func() {
+		UseCassette(nil)
+		if err := c.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return host
+}
+
+// sandboxEnv returns the environment variable describing the sandbox
+// cassettes are recorded against, or fallback when replaying.
+func sandboxEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" && os.Getenv("KION_RECORD_CASSETTES") != "" {
+		return value
+	}
+	return fallback
+}
+
+func TestCassetteAPIKeySTAK(t *testing.T) {
+	host := useCassette(t, "api-key-stak")
+	token := sandboxEnv("KION_SANDBOX_API_KEY", "app-api-key")
+	account := sandboxEnv("KION_SANDBOX_ACCOUNT", "111122223333")
+	carName := sandboxEnv("KION_SANDBOX_CAR", "Admin")
+
+	version, err := GetVersion(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version == "" {
+		t.Error("got no Kion version")
+	}
+	cars, err := GetCARS(host, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, car := range cars {
+		found = found || (car.Name == carName && car.AccountNumber == account)
+	}
+	if !found {
+		t.Errorf("cloud access role %v on account %v not among %v listed", carName, account, len(cars))
+	}
+	stak, err := GetSTAK(host, token, carName, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stak.AccessKey == "" || stak.SecretAccessKey == "" || stak.SessionToken == "" || stak.Expiration.IsZero() {
+		t.Errorf("got incomplete short term access keys %+v", stak)
+	}
+}
+
+func TestCassettePasswordAuth(t *testing.T) {
+	host := useCassette(t, "password-auth")
+	idms, err := strconv.ParseUint(sandboxEnv("KION_SANDBOX_IDMS", "1"), 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := Authenticate(host, uint(idms), sandboxEnv("KION_SANDBOX_USER", "jane"), sandboxEnv("KION_SANDBOX_PASSWORD", "hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Access.Token == "" || session.Access.Expiry == "" {
+		t.Fatalf("got incomplete session %+v", session)
+	}
+	refreshed, err := RefreshSession(host, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Access.Token == "" {
+		t.Errorf("got incomplete refreshed session %+v", refreshed)
+	}
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/token", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "hunter2") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-secret"})
+		fmt.Fprint(w, `{"status":200,"data":{"access":{"token":"access-secret","expiry":"2026-10-16T12:00:00Z"},"refresh":{"token":"refresh-secret"}}}`)
+	})
+	mux.HandleFunc("/api/v3/temporary-credentials/cloud-access-role", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"status":200,"data":{"access_key":"AKIASECRET","secret_access_key":"key-secret","session_token":"token-secret","duration":3600}}`)
+	})
+	mux.HandleFunc("/api/v2/login/sso-provider", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/portal/#/login?code=code-secret")
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// record against the server
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := LoadCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCassette(recorder)
+	defer UseCassette(nil)
+	session, err := Authenticate(server.URL, 1, "jane", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetSTAK(server.URL, session.Access.Token, "Admin", "111122223333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = runQuery("GET", server.URL+"/api/v2/login/sso-provider", "", map[string]string{"code": "code-secret"}, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusCreated {
+		t.Fatalf("got %v, wanted the link recorded", err)
+	}
+	err = recorder.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// secrets never reach the cassette
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "access-secret", "refresh-secret", "cookie-secret", "AKIASECRET", "key-secret", "token-secret", "code-secret", "127.0.0.1"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette holds %q:\n%s", secret, data)
+		}
+	}
+	var recorded Cassette
+	err = json.Unmarshal(data, &recorded)
+	if err != nil || len(recorded.Interactions) != 3 {
+		t.Fatalf("got %v interactions, %v, wanted 3", len(recorded.Interactions), err)
+	}
+
+	// replay against another host with the server gone
+	server.Close()
+	player, err := LoadCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCassette(player)
+	session, err = Authenticate("https://kion.invalid", 1, "jane", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Access.Token != redactedValue || session.Access.Expiry != "2026-10-16T12:00:00Z" {
+		t.Errorf("got session %+v", session)
+	}
+	stak, err := GetSTAK("https://kion.invalid", session.Access.Token, "Admin", "111122223333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stak.AccessKey != redactedValue || stak.Duration != 3600 {
+		t.Errorf("got short term access keys %+v", stak)
+	}
+
+	// every recorded response is played once
+	_, err = GetSTAK("https://kion.invalid", session.Access.Token, "Admin", "111122223333")
+	if !errors.Is(err, ErrCassetteMiss) || !strings.Contains(err.Error(), "POST /api/v3/temporary-credentials/cloud-access-role") {
+		t.Errorf("got %v, wanted a miss naming the request", err)
+	}
+}
+
+func TestLoadCassette(t *testing.T) {
+	_, err := LoadCassette(filepath.Join(t.TempDir(), "missing.json"), CassetteReplay)
+	if err == nil {
+		t.Error("got no error replaying a missing cassette")
+	}
+	_, err = LoadCassette("cassette.json", "rewind")
+	if err == nil || !strings.Contains(err.Error(), `unsupported cassette mode "rewind"`) {
+		t.Errorf("got %v for an unknown mode", err)
+	}
+}
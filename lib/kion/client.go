@@ -0,0 +1,304 @@
+package kion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Client                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// DefaultTimeout bounds each attempt at a request to Kion.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultRetries is how many more times idempotent requests are tried.
+	DefaultRetries = 3
+
+	// defaultBackoff is the wait before the first retry, defaultMaxBackoff the
+	// longest wait between any two.
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+
+	// defaultMaintenanceHold is how long requests are held off after a
+	// maintenance response that doesn't say when the window ends.
+	defaultMaintenanceHold = time.Minute
+)
+
+// DefaultClient sends the requests made by this package's functions.
+var DefaultClient = NewClient()
+
+// Client sends requests to Kion. Each attempt is bounded by Timeout, and
+// idempotent requests are retried with exponential backoff after a 429 or 5xx
+// response, or after getting no response at all, so a flaky proxy or a
+// briefly overloaded Kion doesn't fail the command outright. Requests are
+// annotated with the headers identifying the CLI, see UserAgent and
+// Invocation, and sent through the dialer and cassette in use.
+type Client struct {
+	// Timeout bounds each attempt, including reading the response. Zero
+	// means no limit.
+	Timeout time.Duration
+
+	// Retries is how many more times an idempotent request is tried.
+	Retries int
+
+	// Backoff is the wait before the first retry, doubling for each one after
+	// up to MaxBackoff. A Retry-After header from Kion is honored up to
+	// MaxBackoff too.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// MaintenanceHold is how long queries are held off after Kion responds
+	// that it is in maintenance without saying until when. Otherwise they are
+	// held off until the window ends. Held queries return the maintenance
+	// error without being sent, so long running commands don't keep asking.
+	MaintenanceHold time.Duration
+
+	// Jar and CheckRedirect are used as by http.Client.
+	Jar           http.CookieJar
+	CheckRedirect func(req *http.Request, via []*http.Request) error
+
+	// hold is shared by copies of the client, nil for clients not made with
+	// NewClient, which never hold off
+	hold *maintenanceHold
+}
+
+// maintenanceHold is the maintenance error queries are held off with until a
+// time.
+type maintenanceHold struct {
+	mu    sync.Mutex
+	err   *MaintenanceError
+	until time.Time
+}
+
+// NewClient returns a client with the default timeout and retries.
+func NewClient() *Client {
+	return &Client{
+		Timeout:         DefaultTimeout,
+		Retries:         DefaultRetries,
+		Backoff:         defaultBackoff,
+		MaxBackoff:      defaultMaxBackoff,
+		MaintenanceHold: defaultMaintenanceHold,
+		hold:            &maintenanceHold{},
+	}
+}
+
+// Do sends req, retrying it as described on Client until ctx is done. The
+// body of the response returned has already been read, so it remains
+// readable once the attempt's timeout passes.
+func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	annotate(req)
+
+	// keep the body to send it again with each attempt
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	retries := c.Retries
+	if !idempotent(req.Method) {
+		retries = 0
+	}
+	wait := c.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, req, body)
+		if attempt >= retries || !retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := min(wait, c.MaxBackoff)
+		if resp != nil {
+			if after := headerInt(resp.Header, "Retry-After"); after >= 0 {
+				delay = min(time.Duration(after)*time.Second, c.MaxBackoff)
+			}
+		}
+		wait *= 2
+		reason := fmt.Sprint(err)
+		if resp != nil {
+			reason = resp.Status
+		}
+		fmt.Fprintf(WarningOutput, "Retrying %v %v in %v after %v\n", req.Method, req.URL.Path, delay, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once with body, reading the whole response before the
+// attempt's timeout is released.
+func (c *Client) attempt(ctx context.Context, req *http.Request, body []byte) (*http.Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	r := req.Clone(ctx)
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	client := &http.Client{Transport: httpTransport(), Jar: c.Jar, CheckRedirect: c.CheckRedirect}
+	resp, err := client.Do(r)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			return nil, fmt.Errorf("no response from Kion within %v: %w", c.Timeout, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	noteRequestID(resp)
+	noteQuota(resp)
+	return resp, nil
+}
+
+// idempotent reports whether sending a request with method twice has the same
+// effect as sending it once, so it is safe to retry.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether an attempt failed in a way that may pass when
+// tried again: Kion was rate limiting or failing, or no response came back.
+// Certificates that fail verification will fail again so are not retried,
+// nor is Kion in maintenance, which outlasts the retries.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrCassetteMiss) && !IsCertificateError(err)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 && !underMaintenance(resp)
+}
+
+// Query sends a request to the Kion API with payload as JSON and query added
+// to the url, authorized with token when given. The body of a 200 response
+// is returned, other statuses return an APIError.
+func (c *Client) Query(ctx context.Context, method string, url string, token string, query map[string]string, payload interface{}) ([]byte, int, error) {
+	return c.query(ctx, method, url, token, query, payload, annotate)
+}
+
+// query sends a query as Query does, annotating the request with annotator
+// before it is sent.
+func (c *Client) query(ctx context.Context, method string, url string, token string, query map[string]string, payload interface{}, annotator func(*http.Request)) ([]byte, int, error) {
+	body, _, status, err := c.queryHeader(ctx, method, url, token, query, payload, annotator)
+	return body, status, err
+}
+
+// queryHeader sends a query as query does, also returning the headers of the
+// response.
+func (c *Client) queryHeader(ctx context.Context, method string, url string, token string, query map[string]string, payload interface{}, annotator func(*http.Request)) ([]byte, http.Header, int, error) {
+	// prepare the request body
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// start our request
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// append on our parameters to the req.URL.String(), only active milestones
+	q := req.URL.Query()
+	for key, value := range query {
+		q.Add(key, value)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	// note the request when dry running
+	if DryRun {
+		fmt.Fprintf(DryRunOutput, "[dry-run] %v %v\n", method, req.URL.String())
+	}
+
+	// hold off while kion is known to be in maintenance
+	if held := c.heldMaintenance(time.Now()); held != nil {
+		return nil, nil, held.Err.StatusCode, held
+	}
+
+	// add authorization header to the req
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	annotator(req)
+
+	// send the request
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// handle non 200's, describing maintenance rather than its banner page
+	if resp.StatusCode != 200 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		if maintenance := maintenanceFromResponse(apiErr, resp.Header, time.Now()); maintenance != nil {
+			c.holdForMaintenance(maintenance, time.Now())
+			return nil, resp.Header, resp.StatusCode, maintenance
+		}
+		return nil, resp.Header, resp.StatusCode, apiErr
+	}
+
+	// return the response
+	return respBody, resp.Header, resp.StatusCode, nil
+}
+
+// holdForMaintenance holds off queries after maintenance until its window
+// ends, or for MaintenanceHold from now when it doesn't say.
+func (c *Client) holdForMaintenance(maintenance *MaintenanceError, now time.Time) {
+	if c.hold == nil {
+		return
+	}
+	until := maintenance.Until
+	if until.IsZero() {
+		until = now.Add(c.MaintenanceHold)
+	}
+	c.hold.mu.Lock()
+	defer c.hold.mu.Unlock()
+	c.hold.err, c.hold.until = maintenance, until
+}
+
+// heldMaintenance returns the maintenance error queries are held off with at
+// now, if any.
+func (c *Client) heldMaintenance(now time.Time) *MaintenanceError {
+	if c.hold == nil {
+		return nil
+	}
+	c.hold.mu.Lock()
+	defer c.hold.mu.Unlock()
+	if c.hold.err == nil || !now.Before(c.hold.until) {
+		return nil
+	}
+	return c.hold.err
+}
@@ -0,0 +1,89 @@
+package kion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientQuery(t *testing.T) {
+	tests := []struct {
+		description  string
+		method       string
+		failures     int
+		failStatus   int
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{"Succeeds", "GET", 0, 0, 1, 200},
+		{"Retried After Server Error", "GET", 2, http.StatusBadGateway, 3, 200},
+		{"Retried After Rate Limit", "GET", 1, http.StatusTooManyRequests, 2, 200},
+		{"Gives Up", "GET", 5, http.StatusServiceUnavailable, 3, http.StatusServiceUnavailable},
+		{"Client Error Not Retried", "GET", 1, http.StatusNotFound, 1, http.StatusNotFound},
+		{"POST Not Retried", "POST", 1, http.StatusServiceUnavailable, 1, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"name":"x"}` || r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("got body %s and authorization %q", body, r.Header.Get("Authorization"))
+				}
+				if int(attempts.Add(1)) <= test.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(test.failStatus)
+					return
+				}
+				fmt.Fprint(w, `{"status":200}`)
+			}))
+			defer server.Close()
+
+			client := &Client{Retries: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			_, status, err := client.Query(context.Background(), test.method, server.URL, "token", nil, map[string]string{"name": "x"})
+			if status != test.wantStatus || attempts.Load() != test.wantAttempts {
+				t.Errorf("got status %v after %v attempts, %v, wanted %v after %v", status, attempts.Load(), err, test.wantStatus, test.wantAttempts)
+			}
+			if (err == nil) != (test.wantStatus == 200) {
+				t.Errorf("got error %v for status %v", err, status)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// each attempt times out, then the request is retried
+	client := &Client{Timeout: 20 * time.Millisecond, Retries: 1, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	_, _, err := client.Query(context.Background(), "GET", server.URL, "", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "no response from Kion within 20ms") || !IsUnreachable(err) {
+		t.Errorf("got %v, wanted an unreachable error naming the timeout", err)
+	}
+
+	// canceling the context stops the request and its retries
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	client = &Client{Retries: 5, Backoff: time.Hour, MaxBackoff: time.Hour}
+	start := time.Now()
+	_, _, err = client.Query(ctx, "GET", server.URL, "", nil, nil)
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Errorf("got %v after %v, wanted the request canceled", err, time.Since(start))
+	}
+}
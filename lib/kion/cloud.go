@@ -0,0 +1,79 @@
+package kion
+
+import (
+	"regexp"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Clouds                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Cloud providers an account can belong to.
+const (
+	CloudAWS   = "aws"
+	CloudAzure = "azure"
+	CloudGCP   = "gcp"
+)
+
+// Clouds returns the cloud providers accounts can belong to.
+func Clouds() []string {
+	return []string{CloudAWS, CloudAzure, CloudGCP}
+}
+
+// awsAccountTypes are the Kion account types of the AWS partitions:
+// commercial, GovCloud, C2S, and SC2S.
+var awsAccountTypes = map[uint]bool{1: true, 2: true, 4: true, 5: true}
+
+// account number formats of each cloud, AWS account IDs, Azure subscription
+// IDs, and GCP project IDs
+var (
+	awsAccountNumber   = regexp.MustCompile(`^\d{12}$`)
+	azureAccountNumber = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	gcpAccountNumber   = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+)
+
+// CloudForAccount returns the cloud provider of an account from its Kion
+// account type name when given, its account type ID when it is one of the
+// AWS partitions, or else the format of its account number. An empty string
+// is returned if it can't be determined.
+func CloudForAccount(typeID uint, typeName string, number string) string {
+	name := strings.ToLower(typeName)
+	switch {
+	case strings.Contains(name, "azure"):
+		return CloudAzure
+	case strings.Contains(name, "google"), strings.Contains(name, "gcp"):
+		return CloudGCP
+	case strings.Contains(name, "aws"):
+		return CloudAWS
+	case awsAccountTypes[typeID]:
+		return CloudAWS
+	}
+	return CloudForAccountNumber(number)
+}
+
+// CloudForAccountNumber returns the cloud provider an account number belongs
+// to by its format, or an empty string if it can't be determined.
+func CloudForAccountNumber(number string) string {
+	switch {
+	case awsAccountNumber.MatchString(number):
+		return CloudAWS
+	case azureAccountNumber.MatchString(number):
+		return CloudAzure
+	case gcpAccountNumber.MatchString(number):
+		return CloudGCP
+	}
+	return ""
+}
+
+// Cloud returns the cloud provider of the account the CAR is on.
+func (c CAR) Cloud() string {
+	return CloudForAccount(c.AccountTypeID, c.AccountType, c.AccountNumber)
+}
+
+// Cloud returns the cloud provider of the account.
+func (a Account) Cloud() string {
+	return CloudForAccount(a.TypeID, "", a.Number)
+}
@@ -0,0 +1,31 @@
+package kion
+
+import "testing"
+
+func TestCloudForAccount(t *testing.T) {
+	tests := []struct {
+		description string
+		typeID      uint
+		typeName    string
+		number      string
+		want        string
+	}{
+		{"AWS Type", 2, "", "", CloudAWS},
+		{"AWS Number", 0, "", "111111111111", CloudAWS},
+		{"Azure Type Name", 0, "Azure CSP", "my-subscription", CloudAzure},
+		{"Azure Subscription", 0, "", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", CloudAzure},
+		{"GCP Type Name", 0, "Google Cloud", "", CloudGCP},
+		{"GCP Project", 0, "", "my-project-123", CloudGCP},
+		{"Type Name Over Number", 0, "aws-commercial", "my-project-123", CloudAWS},
+		{"Unknown", 0, "", "12345", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := CloudForAccount(test.typeID, test.typeName, test.number)
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
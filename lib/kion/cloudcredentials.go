@@ -0,0 +1,108 @@
+package kion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Cloud Credentials                                                         //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// CloudCredentialsResponse maps to the Kion API response.
+type CloudCredentialsResponse struct {
+	Status      int              `json:"status"`
+	Credentials CloudCredentials `json:"data"`
+}
+
+// CloudCredentials are the short-lived credentials Kion issues for a cloud
+// access role on an Azure or GCP account. Azure roles are backed by a service
+// principal signed in to with a client secret or a federated token, GCP roles
+// by a service account whose OAuth access token is issued.
+type CloudCredentials struct {
+	Cloud string `json:"-"`
+
+	// Azure service principal
+	TenantID       string `json:"tenant_id"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	FederatedToken string `json:"federated_token"`
+	SubscriptionID string `json:"subscription_id"`
+
+	// GCP service account
+	AccessToken    string `json:"access_token"`
+	ServiceAccount string `json:"service_account"`
+	ProjectID      string `json:"project_id"`
+
+	Duration   int64     `json:"duration"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// GetCloudCredentials queries the Kion API to generate short-lived
+// credentials for a cloud access role on an Azure or GCP account. Kion issues
+// them from the same endpoint as AWS short term access keys, answering with
+// the credentials of the account's cloud.
+func GetCloudCredentials(host string, token string, carName string, accNum string, cloud string) (CloudCredentials, error) {
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/temporary-credentials/cloud-access-role", host)
+	if DryRun {
+		fmt.Fprintf(DryRunOutput, "[dry-run] would POST %v for %v on account %v\n", url, carName, accNum)
+		return CloudCredentials{Cloud: cloud}, ErrDryRun
+	}
+	query := map[string]string{}
+	data := STAKRequest{
+		AccountNumber: accNum,
+		CARName:       carName,
+	}
+	resp, _, err := runQuery("POST", url, token, query, data)
+	if err != nil {
+		return CloudCredentials{}, err
+	}
+
+	// unmarshal response body
+	credsResp := CloudCredentialsResponse{}
+	err = json.Unmarshal(resp, &credsResp)
+	if err != nil {
+		return CloudCredentials{}, err
+	}
+	creds := credsResp.Credentials
+	creds.Cloud = cloud
+	err = creds.validate()
+	if err != nil {
+		return CloudCredentials{}, fmt.Errorf("%w for %v on account %v", err, carName, accNum)
+	}
+
+	// buffer the expiration by 30 seconds as with short term access keys
+	if creds.Expiration.IsZero() {
+		duration := creds.Duration
+		if duration == 0 {
+			duration = 3600
+		}
+		creds.Expiration = time.Now().Add(time.Duration(duration) * time.Second)
+	}
+	creds.Expiration = creds.Expiration.Add(-30 * time.Second)
+
+	return creds, nil
+}
+
+// validate returns an error if the credentials lack what their cloud needs to
+// sign in, such as when Kion answered with AWS keys.
+func (c CloudCredentials) validate() error {
+	switch c.Cloud {
+	case CloudAzure:
+		if c.TenantID == "" || c.ClientID == "" || (c.ClientSecret == "" && c.FederatedToken == "") {
+			return errors.New("kion returned no Azure service principal credentials")
+		}
+	case CloudGCP:
+		if c.AccessToken == "" {
+			return errors.New("kion returned no GCP access token")
+		}
+	default:
+		return fmt.Errorf("unsupported cloud for cloud credentials: %v", c.Cloud)
+	}
+	return nil
+}
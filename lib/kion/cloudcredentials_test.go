@@ -0,0 +1,100 @@
+package kion
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCloudCredentials(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		description string
+		cloud       string
+		data        string
+		want        CloudCredentials
+		wantErr     string
+	}{
+		{
+			"Azure Client Secret",
+			CloudAzure,
+			fmt.Sprintf(`{"tenant_id":"tenant","client_id":"client","client_secret":"secret","expiration":%q}`, expiration.Format(time.RFC3339)),
+			CloudCredentials{Cloud: CloudAzure, TenantID: "tenant", ClientID: "client", ClientSecret: "secret", Expiration: expiration.Add(-30 * time.Second)},
+			"",
+		},
+		{
+			"Azure Federated Token",
+			CloudAzure,
+			fmt.Sprintf(`{"tenant_id":"tenant","client_id":"client","federated_token":"jwt","expiration":%q}`, expiration.Format(time.RFC3339)),
+			CloudCredentials{Cloud: CloudAzure, TenantID: "tenant", ClientID: "client", FederatedToken: "jwt", Expiration: expiration.Add(-30 * time.Second)},
+			"",
+		},
+		{
+			"GCP Access Token",
+			CloudGCP,
+			fmt.Sprintf(`{"access_token":"ya29","project_id":"payments-prod","expiration":%q}`, expiration.Format(time.RFC3339)),
+			CloudCredentials{Cloud: CloudGCP, AccessToken: "ya29", ProjectID: "payments-prod", Expiration: expiration.Add(-30 * time.Second)},
+			"",
+		},
+		{
+			"AWS Keys For Azure",
+			CloudAzure,
+			`{"access_key":"AKIA","secret_access_key":"secret","session_token":"token"}`,
+			CloudCredentials{},
+			"no Azure service principal credentials for Contributor on account",
+		},
+		{
+			"GCP Without Token",
+			CloudGCP,
+			`{"project_id":"payments-prod"}`,
+			CloudCredentials{},
+			"no GCP access token",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"status":200,"data":%v}`, test.data)
+			}))
+			defer server.Close()
+
+			got, err := GetCloudCredentials(server.URL, "token", "Contributor", "payments-prod", test.cloud)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, wanted %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Expiration.Equal(test.want.Expiration) {
+				got.Expiration = test.want.Expiration
+			}
+			if got != test.want {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetCloudCredentialsDefaultExpiry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":200,"data":{"access_token":"ya29","duration":600}}`)
+	}))
+	defer server.Close()
+
+	before := time.Now()
+	creds, err := GetCloudCredentials(server.URL, "token", "Viewer", "payments-prod", CloudGCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := before.Add(570 * time.Second); creds.Expiration.Before(want) || creds.Expiration.After(want.Add(time.Minute)) {
+		t.Errorf("got expiration %v, wanted about %v", creds.Expiration, want)
+	}
+}
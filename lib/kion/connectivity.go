@@ -0,0 +1,209 @@
+package kion
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Connectivity                                                              //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultPrivateLinkHint is shown when Kion can't be reached privately and no
+// hint specific to the organization is configured.
+const DefaultPrivateLinkHint = "connect to your VPN and try again"
+
+// connectivityTimeout bounds each step of a connectivity check so being off
+// the private network fails quickly rather than hanging.
+const connectivityTimeout = 5 * time.Second
+
+// tlsRootCAs are the roots used to verify certificates during connectivity
+// checks, nil for the system roots. Tests replace it.
+var tlsRootCAs *x509.CertPool
+
+// PrivateLinkError is returned when Kion, reached over private link, resolves
+// or answers in a way that suggests the user is off the private network.
+type PrivateLinkError struct {
+	Reason string
+	Hint   string
+}
+
+// Error implements the error interface for PrivateLinkError.
+func (e *PrivateLinkError) Error() string {
+	return fmt.Sprintf("%v, %v", e.Reason, e.Hint)
+}
+
+// HostAddress returns the hostname and host:port of a Kion URL, defaulting to
+// the standard port for its scheme.
+func HostAddress(host string) (string, string, error) {
+	u, err := url.Parse(host)
+	if err != nil || u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid kion url %v", host)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return u.Hostname(), net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// LookupHost resolves a hostname to its addresses.
+func LookupHost(ctx context.Context, hostname string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+// InNetworks reports whether any of the addresses fall within the given
+// CIDRs.
+func InNetworks(ips []net.IP, cidrs []string) (bool, error) {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, fmt.Errorf("invalid private cidr %v", cidr)
+		}
+		for _, ip := range ips {
+			if network.Contains(ip) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// CheckTLS completes a TLS handshake with addr, verifying the certificate is
+// trusted and issued for serverName.
+func CheckTLS(ctx context.Context, addr string, serverName string) error {
+	config := &tls.Config{}
+	if tlsConfig != nil {
+		config = tlsConfig.Clone()
+	}
+	config.ServerName = serverName
+	if tlsRootCAs != nil {
+		config.RootCAs = tlsRootCAs
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: connectivityTimeout},
+		Config:    config,
+	}
+	ctx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// IsCertificateError reports whether err is due to a certificate that isn't
+// trusted or wasn't issued for the host, as happens when a public endpoint
+// answers for a name meant to resolve privately.
+func IsCertificateError(err error) bool {
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var verifyErr *tls.CertificateVerificationError
+	return errors.As(err, &hostnameErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) || errors.As(err, &verifyErr)
+}
+
+// CheckPrivateLink checks that a Kion instance reached over private link
+// resolves to a private address, when private CIDRs are given, and presents
+// the right certificate. Failures that suggest the user is off the private
+// network are returned as a PrivateLinkError carrying the hint.
+func CheckPrivateLink(host string, cidrs []string, hint string) error {
+	if hint == "" {
+		hint = DefaultPrivateLinkHint
+	}
+	hostname, addr, err := HostAddress(host)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	ips, err := LookupHost(ctx, hostname)
+	if err != nil {
+		return &PrivateLinkError{Reason: fmt.Sprintf("%v does not resolve", hostname), Hint: hint}
+	}
+	if len(cidrs) > 0 {
+		private, err := InNetworks(ips, cidrs)
+		if err != nil {
+			return err
+		}
+		if !private {
+			return &PrivateLinkError{Reason: fmt.Sprintf("%v resolves to %v rather than a private address", hostname, ips[0]), Hint: hint}
+		}
+	}
+
+	u, _ := url.Parse(host)
+	if u.Scheme == "http" {
+		return nil
+	}
+	err = CheckTLS(ctx, addr, hostname)
+	switch {
+	case err == nil:
+		return nil
+	case IsCertificateError(err):
+		return &PrivateLinkError{Reason: fmt.Sprintf("%v answered with a certificate for another host", hostname), Hint: hint}
+	default:
+		return &PrivateLinkError{Reason: fmt.Sprintf("%v is not reachable", hostname), Hint: hint}
+	}
+}
+
+// ClockSkew returns how far the clock here is behind Kion's, negative when
+// ahead, read from the Date header of its version endpoint. The header only
+// has whole seconds so the skew is only good to about a second.
+func ClockSkew(host string) (time.Duration, error) {
+	return clockSkew(host+"/api/version", func(req *http.Request) (*http.Response, error) {
+		return DefaultClient.Do(req.Context(), req)
+	})
+}
+
+// IdPClockSkew returns how far the clock here is behind an identity
+// provider's, as ClockSkew does for Kion, from a request to url. Any response
+// will do, so it also confirms the identity provider is reachable.
+func IdPClockSkew(url string) (time.Duration, error) {
+	return clockSkew(url, idpClient().Do)
+}
+
+// clockSkew sends a GET of url with do and compares the Date header of the
+// response with the time here midway through the request.
+func clockSkew(url string, do func(*http.Request) (*http.Response, error)) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+	resp, err := do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	received := time.Now()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("%v sent no Date header to compare clocks with", req.URL.Host)
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return date.Sub(local).Round(time.Second), nil
+}
@@ -0,0 +1,130 @@
+package kion
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInNetworks(t *testing.T) {
+	tests := []struct {
+		description string
+		ips         []string
+		cidrs       []string
+		want        bool
+		wantErr     bool
+	}{
+		{"Private", []string{"10.1.2.3"}, []string{"10.0.0.0/8"}, true, false},
+		{"Any Address", []string{"52.1.2.3", "172.16.4.5"}, []string{"10.0.0.0/8", "172.16.0.0/12"}, true, false},
+		{"Public", []string{"52.1.2.3"}, []string{"10.0.0.0/8"}, false, false},
+		{"Invalid CIDR", []string{"10.1.2.3"}, []string{"10.0.0.0"}, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var ips []net.IP
+			for _, ip := range test.ips {
+				ips = append(ips, net.ParseIP(ip))
+			}
+			got, err := InNetworks(ips, test.cidrs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPrivateLink(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	_, addr, err := HostAddress(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Untrusted Certificate", func(t *testing.T) {
+		err := CheckTLS(context.Background(), addr, "127.0.0.1")
+		if !IsCertificateError(err) {
+			t.Errorf("got %v, wanted a certificate error", err)
+		}
+	})
+
+	// trust the test server from here on
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(server.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	t.Run("Wrong Host", func(t *testing.T) {
+		err := CheckTLS(context.Background(), addr, "kion.internal.example")
+		if !IsCertificateError(err) {
+			t.Errorf("got %v, wanted a certificate error", err)
+		}
+	})
+
+	tests := []struct {
+		description string
+		cidrs       []string
+		wantReason  string
+	}{
+		{"On Network", []string{"127.0.0.0/8"}, ""},
+		{"No CIDRs", nil, ""},
+		{"Public Address", []string{"10.0.0.0/8"}, "rather than a private address"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckPrivateLink(server.URL, test.cidrs, "")
+			if test.wantReason == "" {
+				if err != nil {
+					t.Errorf("got %v, wanted no error", err)
+				}
+				return
+			}
+			var linkErr *PrivateLinkError
+			if !errors.As(err, &linkErr) || !strings.Contains(linkErr.Reason, test.wantReason) || linkErr.Hint != DefaultPrivateLinkHint {
+				t.Errorf("got %v, wanted a private link error about %q", err, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	tests := []struct {
+		description string
+		date        func() string
+		want        time.Duration
+		wantErr     bool
+	}{
+		{"In Sync", func() string { return time.Now().UTC().Format(http.TimeFormat) }, 0, false},
+		{"Behind", func() string { return time.Now().Add(5 * time.Minute).UTC().Format(http.TimeFormat) }, 5 * time.Minute, false},
+		{"Ahead", func() string { return time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat) }, -time.Hour, false},
+		{"No Date", func() string { return "" }, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Date"] = []string{test.date()}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer server.Close()
+
+			got, err := clockSkew(server.URL, server.Client().Do)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error %v", err, test.wantErr)
+			}
+			if diff := got - test.want; diff < -time.Second || diff > time.Second {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
@@ -33,6 +33,10 @@ type URLRequest struct {
 func GetFederationURL(host string, token string, car CAR) (string, error) {
 	// build our query and get response
 	url := fmt.Sprintf("%v/api/v1/console-access", host)
+	if DryRun {
+		fmt.Fprintf(DryRunOutput, "[dry-run] would POST %v for %v on account %v\n", url, car.Name, car.AccountNumber)
+		return "", ErrDryRun
+	}
 	query := map[string]string{}
 	data := URLRequest{
 		AccountID:      car.AccountID,
@@ -0,0 +1,391 @@
+package kion
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Dialers                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// transport is used for every request to Kion. It is the default
+	// transport unless a proxy or bastion is configured with SetDialer or
+	// SetProxy, or TLS settings with SetTLSConfig.
+	transport = http.DefaultTransport.(*http.Transport)
+
+	// idpTransport is used for requests outside Kion, such as to identity
+	// providers for SAML metadata, or to AWS. It shares the proxy and TLS
+	// settings of transport but not its dialer, as a bastion in front of
+	// Kion may not reach the identity provider.
+	idpTransport = http.DefaultTransport.(*http.Transport)
+
+	// dialer and tlsConfig are what transport was built with.
+	dialer    DialFunc
+	tlsConfig *tls.Config
+)
+
+// DialFunc opens a connection to an address, as used by net/http transports.
+type DialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// SetDialer routes all requests to Kion through the given dial function.
+// Environment proxy settings are ignored once a dialer is set.
+func SetDialer(dial DialFunc) {
+	dialer = dial
+	buildTransports()
+}
+
+// buildTransports builds the transports requests are sent with from the
+// dialer and TLS settings in use.
+func buildTransports() {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	t.Proxy = proxyFunc
+	idpTransport = t
+	transport = t
+	if dialer != nil {
+		transport = t.Clone()
+		transport.Proxy = nil
+		transport.DialContext = dialer
+	}
+}
+
+// idpClient returns the client requests to identity providers are sent with.
+func idpClient() *http.Client {
+	return externalClient(DefaultTimeout, PhaseIdP)
+}
+
+// ExternalClient returns a client for requests outside Kion, such as to AWS,
+// sent with the proxy and TLS settings in use but not the dialer. Each
+// request is bounded by timeout, zero means no limit. Requests are traced
+// when Log is enabled.
+func ExternalClient(timeout time.Duration) *http.Client {
+	return externalClient(timeout, PhaseExternal)
+}
+
+// externalClient returns a client for requests outside Kion as
+// ExternalClient does, timing them as phase.
+func externalClient(timeout time.Duration, phase string) *http.Client {
+	return &http.Client{Transport: timed(phase, traced(idpTransport)), Timeout: timeout}
+}
+
+// SOCKS5Dialer returns a dial function connecting through a SOCKS5 proxy. The
+// proxy is given as host:port or a socks5:// url, optionally with a username
+// and password. Hostnames are resolved by the proxy.
+func SOCKS5Dialer(proxy string) (DialFunc, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "socks5://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socks5 proxy: %w", err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("invalid socks5 proxy: unsupported scheme %v", u.Scheme)
+	}
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = net.JoinHostPort(u.Hostname(), "1080")
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reach socks5 proxy %v: %w", proxyAddr, err)
+		}
+
+		// abandon the handshake if the request is canceled
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		err = socks5Connect(conn, u.User, addr)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("socks5 proxy %v: %w", proxyAddr, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return conn, nil
+	}, nil
+}
+
+// socks5Connect performs the SOCKS5 handshake on conn asking the proxy to
+// connect to addr, authenticating with a username and password if given.
+func socks5Connect(conn io.ReadWriter, user *url.Userinfo, addr string) error {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %v", portText)
+	}
+	if len(host) > 255 {
+		return errors.New("hostname too long")
+	}
+
+	// offer no authentication, or username and password if we have them
+	method := byte(0x00)
+	if user != nil {
+		method = 0x02
+	}
+	_, err = conn.Write([]byte{0x05, 0x01, method})
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != 0x05 || reply[1] != method {
+		return errors.New("proxy rejected the authentication method")
+	}
+
+	// authenticate as described in RFC 1929
+	if method == 0x02 {
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return errors.New("username or password too long")
+		}
+		auth := []byte{0x01, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		_, err = conn.Write(auth)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("authentication failed")
+		}
+	}
+
+	// ask the proxy to connect, leaving name resolution to it
+	request := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		request = append(append(request, 0x01), ip.To4()...)
+	} else if ip != nil {
+		request = append(append(request, 0x04), ip.To16()...)
+	} else {
+		request = append(append(request, 0x03, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+
+	// read the reply, discarding the bound address
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("connect to %v failed with code %v", addr, header[1])
+	}
+	var skip int
+	switch header[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		length := make([]byte, 1)
+		_, err = io.ReadFull(conn, length)
+		if err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return errors.New("malformed reply")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// SSHJumpDialer returns a dial function that tunnels connections through an
+// SSH bastion given as [user@]host[:port]. Authentication uses the SSH agent
+// and the identity file if one is given, otherwise the default keys in
+// ~/.ssh. The bastion's host key must be in ~/.ssh/known_hosts. The SSH
+// connection is established on first use and reused afterwards, reconnecting
+// if the bastion drops it.
+func SSHJumpDialer(jump string, identityFile string) (DialFunc, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if rest, found := strings.CutPrefix(identityFile, "~/"); found {
+		identityFile = filepath.Join(home, rest)
+	}
+
+	// parse the bastion address
+	username, hostport, found := strings.Cut(jump, "@")
+	if !found {
+		hostport = username
+		username = os.Getenv("USER")
+		if username == "" {
+			username = os.Getenv("USERNAME")
+		}
+	}
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(hostport, "22")
+	}
+
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known hosts for ssh jump: %w", err)
+	}
+	config := &ssh.ClientConfig{
+		User:            username,
+		HostKeyCallback: hostKeys,
+	}
+
+	var client *ssh.Client
+	var mu sync.Mutex
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// a connection the bastion dropped is only noticed when dialing
+		// through it, so one reused connection failing is retried on a new one
+		reused := client != nil
+		for {
+			if client == nil {
+				var err error
+				client, err = dialSSHJump(ctx, hostport, config, home, identityFile)
+				if err != nil {
+					return nil, err
+				}
+			}
+			conn, err := client.Dial(network, addr)
+			if err == nil {
+				return conn, nil
+			}
+			client.Close()
+			client = nil
+			if !reused {
+				return nil, err
+			}
+			reused = false
+		}
+	}, nil
+}
+
+// sshHandshakeTimeout bounds connecting and authenticating to an SSH bastion
+// when the request has no deadline of its own.
+const sshHandshakeTimeout = 30 * time.Second
+
+// dialSSHJump connects and authenticates to the SSH bastion at hostport.
+func dialSSHJump(ctx context.Context, hostport string, config *ssh.ClientConfig, home string, identityFile string) (*ssh.Client, error) {
+	if _, found := ctx.Deadline(); !found {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sshHandshakeTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", hostport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach ssh jump %v: %w", hostport, err)
+	}
+
+	// the handshake ignores ctx, so it's bounded by the connection's deadline
+	// instead or a bastion that never answers would hang every request
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	// the agent is only needed to sign during the handshake
+	var agentClient agent.Agent
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if agentConn, err := net.Dial("unix", socket); err == nil {
+			defer agentConn.Close()
+			agentClient = agent.NewClient(agentConn)
+		}
+	}
+	handshake := *config
+	handshake.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(sshSigners(home, identityFile, agentClient))}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, hostport, &handshake)
+	if !stop() && err == nil {
+		c.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ssh jump %v: %w", hostport, ctx.Err())
+		}
+		return nil, fmt.Errorf("ssh jump %v: %w", hostport, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshSigners returns a callback providing keys from the SSH agent, if there
+// is one, followed by the identity file, or the default keys if no identity
+// file is given. Keys that are missing or passphrase protected are skipped,
+// use the agent for those.
+func sshSigners(home string, identityFile string, agentClient agent.Agent) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		if agentClient != nil {
+			if agentSigners, err := agentClient.Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+
+		files := []string{identityFile}
+		if identityFile == "" {
+			files = []string{
+				filepath.Join(home, ".ssh", "id_ed25519"),
+				filepath.Join(home, ".ssh", "id_ecdsa"),
+				filepath.Join(home, ".ssh", "id_rsa"),
+			}
+		}
+		for _, file := range files {
+			key, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			signer, err := ssh.ParsePrivateKey(key)
+			if err != nil {
+				continue
+			}
+			signers = append(signers, signer)
+		}
+
+		if len(signers) == 0 {
+			return nil, errors.New("no ssh keys found, add one to your ssh agent")
+		}
+		return signers, nil
+	}
+}
@@ -0,0 +1,388 @@
+package kion
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// fakeSOCKS5 serves a minimal SOCKS5 proxy on loopback that requires the
+// given password when one is set, returning its address.
+func fakeSOCKS5(t *testing.T, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, password)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// serveSOCKS5 handles a single proxied connection.
+func serveSOCKS5(conn net.Conn, password string) {
+	defer conn.Close()
+
+	// greeting, expecting a single offered method
+	greeting := make([]byte, 3)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return
+	}
+	method := byte(0x00)
+	if password != "" {
+		method = 0x02
+	}
+	if greeting[2] != method {
+		_, _ = conn.Write([]byte{0x05, 0xff})
+		return
+	}
+	_, _ = conn.Write([]byte{0x05, method})
+
+	// username and password
+	if method == 0x02 {
+		header := make([]byte, 2)
+		_, _ = io.ReadFull(conn, header)
+		username := make([]byte, header[1])
+		_, _ = io.ReadFull(conn, username)
+		length := make([]byte, 1)
+		_, _ = io.ReadFull(conn, length)
+		given := make([]byte, length[0])
+		_, _ = io.ReadFull(conn, given)
+		if string(given) != password {
+			_, _ = conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		_, _ = conn.Write([]byte{0x01, 0x00})
+	}
+
+	// connect request, only domain names are expected from the tests
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil || request[3] != 0x03 {
+		return
+	}
+	host := make([]byte, request[4])
+	_, _ = io.ReadFull(conn, host)
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(conn, port)
+
+	// the tests address the target as kion.test, which only the proxy resolves
+	if string(host) != "kion.test" {
+		_, _ = conn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	target, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", binary.BigEndian.Uint16(port)))
+	if err != nil {
+		_, _ = conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	_, _ = conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+
+	go func() { _, _ = io.Copy(target, conn) }()
+	_, _ = io.Copy(conn, target)
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	target := strings.Replace(server.Listener.Addr().String(), "127.0.0.1", "kion.test", 1)
+
+	tests := []struct {
+		description string
+		password    string
+		proxy       func(addr string) string
+		wantErr     bool
+	}{
+		{
+			"No Authentication",
+			"",
+			func(addr string) string { return addr },
+			false,
+		},
+		{
+			"Password",
+			"hunter2",
+			func(addr string) string { return "socks5://jane:hunter2@" + addr },
+			false,
+		},
+		{
+			"Wrong Password",
+			"hunter2",
+			func(addr string) string { return "socks5://jane:wrong@" + addr },
+			true,
+		},
+		{
+			"Missing Password",
+			"hunter2",
+			func(addr string) string { return addr },
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			dial, err := SOCKS5Dialer(test.proxy(fakeSOCKS5(t, test.password)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := dial(context.Background(), "tcp", target)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			// make a request over the proxied connection
+			fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: %v\r\n\r\n", target)
+			response, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(string(response), "ok") {
+				t.Errorf("unexpected response through proxy:\n%v", string(response))
+			}
+		})
+	}
+}
+
+func TestSOCKS5DialerInvalid(t *testing.T) {
+	_, err := SOCKS5Dialer("http://proxy.example:8080")
+	if err == nil {
+		t.Error("expected an error for a non socks5 proxy")
+	}
+}
+
+// fakeSSHJump serves an SSH bastion on loopback accepting any key and
+// forwarding direct-tcpip channels, with its host key written to the known
+// hosts of home. It returns the bastion's address and a func dropping its
+// connections.
+func fakeSSHJump(t *testing.T, home string) (string, func()) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	line := knownhosts.Line([]string{listener.Addr().String()}, hostSigner.PublicKey())
+	err = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					var target struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+						newChannel.Reject(ssh.ConnectionFailed, "bad request")
+						continue
+					}
+					upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						upstream.Close()
+						continue
+					}
+					go ssh.DiscardRequests(requests)
+					go func() {
+						io.Copy(channel, upstream)
+						channel.Close()
+					}()
+					go func() {
+						io.Copy(upstream, channel)
+						upstream.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		conns = nil
+	}
+}
+
+func TestSSHJumpDialer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	err := os.Mkdir(filepath.Join(home, ".ssh"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jump, drop := fakeSSHJump(t, home)
+
+	dial, err := SSHJumpDialer("jane@"+jump, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() error {
+		conn, err := dial(context.Background(), "tcp", server.Listener.Addr().String())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: kion.test\r\n\r\n")
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(string(response), "ok") {
+			return fmt.Errorf("unexpected response through the jump:\n%v", string(response))
+		}
+		return nil
+	}
+
+	tests := []struct {
+		description string
+		before      func()
+	}{
+		{"First Connection", func() {}},
+		{"Reused Connection", func() {}},
+		{"Reconnects When Dropped", drop},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.before()
+			err := get()
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSSHJumpDialerHandshakeTimeout(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	err := os.Mkdir(filepath.Join(home, ".ssh"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a bastion accepting connections but never answering
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	dial, err := SSHJumpDialer("jane@"+listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dial(ctx, "tcp", "kion.test:443")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, wanted the deadline to be exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("gave up after %v, wanted the request's deadline", elapsed)
+	}
+}
@@ -0,0 +1,38 @@
+package kion
+
+import "time"
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Inventory                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Inventory is a snapshot of the projects and cloud access roles available to
+// the user. It is cached so choices can still be made from it while Kion is
+// unreachable.
+type Inventory struct {
+	Projects []Project
+	CARs     []CAR
+	Updated  time.Time
+
+	// Accounts holds metadata Kion doesn't know about, such as AWS
+	// Organizations tags, keyed by account number.
+	Accounts        map[string]AccountMetadata `json:",omitempty"`
+	AccountsUpdated time.Time
+
+	// Sync records what kion sync fetched, nil for inventories fetched
+	// whole by the pickers.
+	Sync *SyncState `json:",omitempty"`
+}
+
+// AccountMetadata is what is known about an account from outside of Kion.
+type AccountMetadata struct {
+	Tags   map[string]string `json:",omitempty"`
+	OUPath string            `json:",omitempty"`
+}
+
+// Empty reports whether the inventory holds no cloud access roles.
+func (i Inventory) Empty() bool {
+	return len(i.CARs) == 0
+}
@@ -1,66 +1,159 @@
 package kion
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
 )
 
+var (
+	// DryRun prevents requests that create credentials or sessions from being
+	// sent to Kion. All requests are logged to DryRunOutput when set.
+	DryRun bool
+
+	// DryRunOutput is where dry run messages are written.
+	DryRunOutput io.Writer = os.Stderr
+
+	// WarningOutput is where warnings about responses from Kion are written.
+	WarningOutput io.Writer = os.Stderr
+
+	// ErrDryRun is returned by requests that were skipped due to DryRun.
+	ErrDryRun = errors.New("skipped due to dry run")
+
+	// UserAgent is sent as the User-Agent of every request to Kion when set.
+	UserAgent string
+
+	// Invocation names the command being run and is sent in the
+	// X-Kion-CLI-Invocation header of every request to Kion when set.
+	Invocation string
+
+	// DeviceID identifies the machine the CLI runs on and is sent in the
+	// X-Kion-CLI-Device-ID header of requests signing in to Kion when set, so
+	// sessions can be tied to the device that opened them.
+	DeviceID string
+
+	// requestIDs are the ids Kion assigned to the requests made so far
+	requestIDs   []string
+	requestIDsMu sync.Mutex
+)
+
+// requestIDHeader is the response header Kion identifies requests with.
+const requestIDHeader = "X-Request-Id"
+
 ////////////////////////////////////////////////////////////////////////////////
 //                                                                            //
-//  Helpers                                                                   //
+//  Errors                                                                    //
 //                                                                            //
 ////////////////////////////////////////////////////////////////////////////////
 
-// runQuery performs queries against the Kion API.
-func runQuery(method string, url string, token string, query map[string]string, payload interface{}) ([]byte, int, error) {
-	// prepare the request body
-	reqBody, err := json.Marshal(payload)
-	if err != nil {
-		return nil, 0, err
-	}
+// APIError is returned when the Kion API responds with a non 200 status code.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
 
-	// start our request
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, 0, err
-	}
+// Error implements the error interface for APIError.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("received %v\n %v", e.StatusCode, e.Body)
+}
 
-	// append on our parameters to the req.URL.String(), only active milestones
-	q := req.URL.Query()
-	for key, value := range query {
-		q.Add(key, value)
+// IsStatus reports whether err is an APIError with the given status code.
+func IsStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == statusCode
 	}
-	req.URL.RawQuery = q.Encode()
+	return false
+}
 
-	// add authorization header to the req
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
+// IsUnreachable reports whether err means Kion could not be reached, either
+// because the request never got a response or because a gateway in front of
+// Kion reported it unavailable.
+func IsUnreachable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
 	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
 
-	// send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, err
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Helpers                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// annotate identifies the CLI and the command being run on a request to Kion
+// so its traffic can be told apart in server logs.
+func annotate(req *http.Request) {
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	if Invocation != "" {
+		req.Header.Set("X-Kion-CLI-Invocation", Invocation)
 	}
-	defer resp.Body.Close()
+}
 
-	// get the body of the response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, err
+// annotateAuth annotates a request signing in to Kion, also identifying the
+// device signing in.
+func annotateAuth(req *http.Request) {
+	annotate(req)
+	if DeviceID != "" {
+		req.Header.Set("X-Kion-CLI-Device-ID", DeviceID)
 	}
+}
 
-	// handle non 200's
-	if resp.StatusCode != 200 {
-		return nil, resp.StatusCode, fmt.Errorf("received %v\n %v", resp.StatusCode, string(respBody))
+// noteRequestID remembers the id Kion assigned to a request, if any, so it
+// can be quoted when troubleshooting with Kion's server logs.
+func noteRequestID(resp *http.Response) {
+	id := resp.Header.Get(requestIDHeader)
+	if id == "" {
+		return
 	}
+	requestIDsMu.Lock()
+	defer requestIDsMu.Unlock()
+	requestIDs = append(requestIDs, id)
+}
+
+// RequestIDs returns the ids Kion assigned to the requests made so far, in
+// the order they were made.
+func RequestIDs() []string {
+	requestIDsMu.Lock()
+	defer requestIDsMu.Unlock()
+	return slices.Clone(requestIDs)
+}
+
+// runQuery performs queries against the Kion API.
+func runQuery(method string, url string, token string, query map[string]string, payload interface{}) ([]byte, int, error) {
+	return DefaultClient.query(context.Background(), method, url, token, query, payload, annotate)
+}
+
+// runAuthQuery performs queries signing in to the Kion API.
+func runAuthQuery(method string, url string, query map[string]string, payload interface{}) ([]byte, int, error) {
+	return DefaultClient.query(context.Background(), method, url, "", query, payload, annotateAuth)
+}
 
-	// return the response
-	return respBody, resp.StatusCode, nil
+// CloseIdleConnections closes connections kept alive from earlier requests so
+// the next request has to establish a new one.
+func CloseIdleConnections() {
+	transport.CloseIdleConnections()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,171 @@
+package kion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunQueryAnnotation(t *testing.T) {
+	tests := []struct {
+		description    string
+		userAgent      string
+		invocation     string
+		wantUserAgent  string
+		wantInvocation string
+	}{
+		{"Annotated", "kion-cli/0.9.0 (linux; amd64) acme-platform", "favorite", "kion-cli/0.9.0 (linux; amd64) acme-platform", "favorite"},
+		{"Invocation Disabled", "kion-cli/0.9.0 (linux; amd64)", "", "kion-cli/0.9.0 (linux; amd64)", ""},
+		{"Unset", "", "", "Go-http-client/1.1", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var gotUserAgent, gotInvocation string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserAgent = r.UserAgent()
+				gotInvocation = r.Header.Get("X-Kion-CLI-Invocation")
+			}))
+			defer server.Close()
+
+			UserAgent, Invocation = test.userAgent, test.invocation
+			defer func() { UserAgent, Invocation = "", "" }()
+
+			_, _, err := runQuery("GET", server.URL, "", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotUserAgent != test.wantUserAgent || gotInvocation != test.wantInvocation {
+				t.Errorf("got %q and %q, wanted %q and %q", gotUserAgent, gotInvocation, test.wantUserAgent, test.wantInvocation)
+			}
+		})
+	}
+}
+
+func TestDeviceIDHeader(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Path+"="+r.Header.Get("X-Kion-CLI-Device-ID"))
+		fmt.Fprint(w, `{"data":{"access":{"token":"abc"}}}`)
+	}))
+	defer server.Close()
+
+	DeviceID = "4f1d2a3b-0c9e-4b7a-8d6f-112233445566"
+	defer func() { DeviceID = "" }()
+
+	// only requests signing in identify the device
+	_, err := Authenticate(server.URL, 1, "jdoe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = runQuery("GET", server.URL+"/api/v3/me", "abc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/api/v3/token=" + DeviceID, "/api/v3/me="}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, want)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	status := http.StatusOK
+	id := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id != "" {
+			w.Header().Set("X-Request-Id", id)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	requestIDs = nil
+	defer func() { requestIDs = nil }()
+
+	// ids are collected from failed requests too, those lacking one are skipped
+	for _, req := range []struct {
+		id     string
+		status int
+	}{{"req-1", http.StatusOK}, {"", http.StatusOK}, {"req-2", http.StatusForbidden}} {
+		id, status = req.id, req.status
+		_, _, _ = runQuery("GET", server.URL, "", nil, nil)
+	}
+
+	want := []string{"req-1", "req-2"}
+	if got := RequestIDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		want        bool
+	}{
+		{"Nil", nil, false},
+		{"Connection Refused", &url.Error{Op: "Get", URL: "https://kion.example", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"Wrapped", fmt.Errorf("fetching projects: %w", &net.DNSError{Err: "no such host", Name: "kion.example"}), true},
+		{"Gateway", &APIError{StatusCode: 503}, true},
+		{"Unauthorized", &APIError{StatusCode: 401}, false},
+		{"Canceled", &url.Error{Op: "Get", URL: "https://kion.example", Err: context.Canceled}, false},
+		{"Other", errors.New("invalid json"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := IsUnreachable(test.err); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDryRunSkipsCredentialRequests(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	var out strings.Builder
+	DryRun, DryRunOutput = true, &out
+	defer func() { DryRun, DryRunOutput = false, os.Stderr }()
+
+	tests := []struct {
+		description string
+		request     func() error
+	}{
+		{"STAK", func() error {
+			_, err := GetSTAK(server.URL, "token", "Admin", "111111111111")
+			return err
+		}},
+		{"Federation URL", func() error {
+			_, err := GetFederationURL(server.URL, "token", CAR{Name: "Admin", AccountNumber: "111111111111"})
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			out.Reset()
+			err := test.request()
+			if !errors.Is(err, ErrDryRun) {
+				t.Errorf("got error %v, wanted %v", err, ErrDryRun)
+			}
+			if requests != 0 {
+				t.Errorf("sent %v requests, wanted none", requests)
+			}
+			if !strings.Contains(out.String(), "[dry-run] would POST "+server.URL) {
+				t.Errorf("request was not reported, got %q", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package kion
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Labels                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// LabelsResponse maps to the Kion API response.
+type LabelsResponse struct {
+	Status int     `json:"status"`
+	Labels []Label `json:"data"`
+}
+
+// Label maps to the Kion API response for the key value labels admins apply
+// to resources such as accounts.
+type Label struct {
+	ID    uint   `json:"id"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Color string `json:"color"`
+}
+
+// GetAccountLabels queries the Kion API for the labels applied to an account.
+func GetAccountLabels(host string, token string, accountID uint) ([]Label, error) {
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/account/%v/labels", host, accountID)
+	query := map[string]string{}
+	var data interface{}
+	resp, _, err := runQuery("GET", url, token, query, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// unmarshal response body
+	labelResp := LabelsResponse{}
+	err = json.Unmarshal(resp, &labelResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return labelResp.Labels, nil
+}
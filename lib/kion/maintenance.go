@@ -0,0 +1,189 @@
+package kion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Maintenance                                                               //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// MaintenanceError is returned in place of an APIError when Kion responds
+// that it is down for maintenance, usually with a banner page rather than
+// JSON. It unwraps to the APIError, so it counts as Kion being unreachable.
+type MaintenanceError struct {
+	Err *APIError
+
+	// Until is when the maintenance window ends, the zero time when the
+	// response didn't say.
+	Until time.Time
+
+	// Message is the notice Kion gave, if any, as plain text.
+	Message string
+}
+
+// Error implements the error interface for MaintenanceError.
+func (e *MaintenanceError) Error() string {
+	msg := "Kion is in maintenance"
+	if !e.Until.IsZero() {
+		msg += " until " + e.Until.Local().Format("2006-01-02 15:04 MST")
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap returns the APIError behind the maintenance response.
+func (e *MaintenanceError) Unwrap() error {
+	return e.Err
+}
+
+// maxMaintenanceMessage is the longest maintenance notice kept, longer ones
+// are cut short.
+const maxMaintenanceMessage = 200
+
+// maintenanceFields are the JSON fields a maintenance response may give the
+// end of the window in.
+var maintenanceFields = []string{"until", "end", "ends_at", "end_time", "maintenance_end", "window_end", "estimated_end"}
+
+var (
+	// hiddenElements are elements of a banner page that aren't shown.
+	hiddenElements = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+
+	// htmlTags are the tags of a banner page.
+	htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+	// timestamps are the ISO 8601 times a banner may give its window with.
+	timestamps = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z| ?UTC|[+-]\d{2}:?\d{2})?`)
+
+	// sentences splits the text of a banner page into sentences.
+	sentences = regexp.MustCompile(`[^.!?]+[.!?]?`)
+)
+
+// maintenanceFromResponse returns the maintenance error for a 503 response
+// whose body mentions maintenance, or nil for any other response. The end of
+// the window is the latest time given in the body after now, falling back to
+// a Retry-After header.
+func maintenanceFromResponse(err *APIError, header http.Header, now time.Time) *MaintenanceError {
+	if err.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+
+	// JSON responses give the notice in a field, banner pages in their text
+	var text string
+	var until time.Time
+	var fields map[string]any
+	if json.Unmarshal([]byte(err.Body), &fields) == nil {
+		for _, key := range []string{"message", "error", "detail"} {
+			if value, ok := fields[key].(string); ok && text == "" {
+				text = value
+			}
+		}
+		for _, key := range maintenanceFields {
+			if value, ok := fields[key].(string); ok {
+				until = latestTime(value, now, until)
+			}
+		}
+	} else {
+		text = hiddenElements.ReplaceAllString(err.Body, " ")
+		text = html.UnescapeString(htmlTags.ReplaceAllString(text, " "))
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if !strings.Contains(strings.ToLower(text), "maintenance") {
+		return nil
+	}
+	until = latestTime(text, now, until)
+
+	if until.IsZero() {
+		if after := headerInt(header, "Retry-After"); after > 0 {
+			until = now.Add(time.Duration(after) * time.Second)
+		} else if at, parseErr := http.ParseTime(header.Get("Retry-After")); parseErr == nil && at.After(now) {
+			until = at
+		}
+	}
+
+	return &MaintenanceError{Err: err, Until: until, Message: maintenanceMessage(text)}
+}
+
+// latestTime returns the latest of latest and the times in text after now.
+// Times without a zone are taken as UTC.
+func latestTime(text string, now time.Time, latest time.Time) time.Time {
+	for _, match := range timestamps.FindAllString(text, -1) {
+		value := strings.Replace(strings.TrimSpace(strings.TrimSuffix(match, "UTC")), " ", "T", 1)
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05.999999999Z0700", "2006-01-02T15:04Z0700", "2006-01-02T15:04:05.999999999", "2006-01-02T15:04"} {
+			at, err := time.Parse(layout, value)
+			if err != nil {
+				continue
+			}
+			if at.After(now) && at.After(latest) {
+				latest = at
+			}
+			break
+		}
+	}
+	return latest
+}
+
+// maintenanceMessage returns the first sentence of text mentioning
+// maintenance, cut short when long.
+func maintenanceMessage(text string) string {
+	for _, sentence := range sentences.FindAllString(text, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if !strings.Contains(strings.ToLower(sentence), "maintenance") {
+			continue
+		}
+		if len(sentence) > maxMaintenanceMessage {
+			sentence = strings.TrimSpace(sentence[:maxMaintenanceMessage]) + "..."
+		}
+		return sentence
+	}
+	return ""
+}
+
+// underMaintenance reports whether resp is a maintenance response, leaving
+// its body to be read again.
+func underMaintenance(resp *http.Response) bool {
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return maintenanceFromResponse(&APIError{StatusCode: resp.StatusCode, Body: string(body)}, resp.Header, time.Now()) != nil
+}
+
+// MaintenanceWait returns how long to wait before trying Kion again after err,
+// and whether err is a maintenance error at all. The wait runs until the end
+// of the window, or is fallback when it is unknown or already passed.
+func MaintenanceWait(err error, now time.Time, fallback time.Duration) (time.Duration, bool) {
+	maintenance, ok := AsMaintenance(err)
+	if !ok {
+		return 0, false
+	}
+	if maintenance.Until.After(now) {
+		return maintenance.Until.Sub(now), true
+	}
+	return fallback, true
+}
+
+// AsMaintenance returns the maintenance error in err's chain, if any.
+func AsMaintenance(err error) (*MaintenanceError, bool) {
+	var maintenance *MaintenanceError
+	if errors.As(err, &maintenance) {
+		return maintenance, true
+	}
+	return nil, false
+}
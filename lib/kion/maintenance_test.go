@@ -0,0 +1,183 @@
+package kion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceFromResponse(t *testing.T) {
+	now := time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		status      int
+		body        string
+		retryAfter  string
+		wantFound   bool
+		wantUntil   time.Time
+		wantMessage string
+	}{
+		{
+			"Banner With Window",
+			503,
+			`<html><head><title>Down</title><style>h1 { color: red; }</style></head><body><h1>Scheduled Maintenance</h1><p>Kion is undergoing scheduled maintenance from 2026-10-16T19:00:00Z until 2026-10-16T22:30:00Z. We&#39;ll be back soon.</p></body></html>`,
+			"",
+			true,
+			time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC),
+			"Scheduled Maintenance Kion is undergoing scheduled maintenance from 2026-10-16T19:00:00Z until 2026-10-16T22:30:00Z.",
+		},
+		{
+			"Banner Without Window",
+			503,
+			`<html><body><p>Down for maintenance. Please try again later!</p></body></html>`,
+			"",
+			true,
+			time.Time{},
+			"Down for maintenance.",
+		},
+		{
+			"Banner With Retry After Seconds",
+			503,
+			`<p>Maintenance in progress</p>`,
+			"600",
+			true,
+			now.Add(10 * time.Minute),
+			"Maintenance in progress",
+		},
+		{
+			"Banner With Retry After Date",
+			503,
+			`<p>Maintenance in progress</p>`,
+			"Fri, 16 Oct 2026 21:00:00 GMT",
+			true,
+			time.Date(2026, 10, 16, 21, 0, 0, 0, time.UTC),
+			"Maintenance in progress",
+		},
+		{
+			"JSON With Window",
+			503,
+			`{"status":503,"message":"Kion is in maintenance","ends_at":"2026-10-16T23:00:00-04:00"}`,
+			"",
+			true,
+			time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC),
+			"Kion is in maintenance",
+		},
+		{
+			"Window Without Zone",
+			503,
+			`Maintenance until 2026-10-16 21:15 UTC`,
+			"",
+			true,
+			time.Date(2026, 10, 16, 21, 15, 0, 0, time.UTC),
+			"Maintenance until 2026-10-16 21:15 UTC",
+		},
+		{
+			"Window Already Passed",
+			503,
+			`Maintenance ended 2026-10-16T19:00:00Z`,
+			"",
+			true,
+			time.Time{},
+			"Maintenance ended 2026-10-16T19:00:00Z",
+		},
+		{
+			"Unavailable For Another Reason",
+			503,
+			`<html><body>Service Unavailable</body></html>`,
+			"",
+			false,
+			time.Time{},
+			"",
+		},
+		{
+			"Other Status",
+			500,
+			`maintenance`,
+			"",
+			false,
+			time.Time{},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			header := http.Header{}
+			if test.retryAfter != "" {
+				header.Set("Retry-After", test.retryAfter)
+			}
+			got := maintenanceFromResponse(&APIError{StatusCode: test.status, Body: test.body}, header, now)
+			if (got != nil) != test.wantFound {
+				t.Fatalf("got %v, wanted maintenance: %v", got, test.wantFound)
+			}
+			if got == nil {
+				return
+			}
+			if !got.Until.Equal(test.wantUntil) || got.Message != test.wantMessage {
+				t.Errorf("\ngot:\n  %v %q\nwanted:\n  %v %q", got.Until, got.Message, test.wantUntil, test.wantMessage)
+			}
+			if strings.Contains(got.Error(), "<") || !IsUnreachable(got) || !IsStatus(got, 503) {
+				t.Errorf("got error %q, wanted plain text unwrapping to the 503", got.Error())
+			}
+		})
+	}
+}
+
+func TestMaintenanceError(t *testing.T) {
+	until := time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC)
+	err := fmt.Errorf("unable to fetch keys: %w", &MaintenanceError{Err: &APIError{StatusCode: 503}, Until: until, Message: "Upgrading Kion."})
+
+	want := "unable to fetch keys: Kion is in maintenance until " + until.Local().Format("2006-01-02 15:04 MST") + ": Upgrading Kion."
+	if err.Error() != want {
+		t.Errorf("got %q, wanted %q", err.Error(), want)
+	}
+	wait, ok := MaintenanceWait(err, until.Add(-time.Hour), time.Minute)
+	if !ok || wait != time.Hour {
+		t.Errorf("got wait %v %v, wanted an hour", wait, ok)
+	}
+	wait, ok = MaintenanceWait(err, until.Add(time.Hour), time.Minute)
+	if !ok || wait != time.Minute {
+		t.Errorf("got wait %v %v past the window, wanted the fallback", wait, ok)
+	}
+	_, ok = MaintenanceWait(&APIError{StatusCode: 503}, until, time.Minute)
+	if ok {
+		t.Error("got a maintenance wait for a plain 503")
+	}
+}
+
+func TestClientMaintenance(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "<html><body><h1>Kion is down for maintenance</h1></body></html>")
+	}))
+	defer server.Close()
+
+	// maintenance isn't retried, and later queries are held off without being
+	// sent until the hold passes
+	client := NewClient()
+	client.Backoff, client.MaxBackoff, client.MaintenanceHold = time.Millisecond, time.Millisecond, 50*time.Millisecond
+	for i := 0; i < 3; i++ {
+		_, status, err := client.Query(context.Background(), "GET", server.URL, "", nil, nil)
+		maintenance, ok := AsMaintenance(err)
+		if !ok || status != http.StatusServiceUnavailable || maintenance.Message != "Kion is down for maintenance" {
+			t.Fatalf("got %v %v, wanted a maintenance error", status, err)
+		}
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("got %v attempts while held, wanted 1", attempts.Load())
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, _, _ = client.Query(context.Background(), "GET", server.URL, "", nil, nil)
+	if attempts.Load() != 2 {
+		t.Errorf("got %v attempts after the hold, wanted 2", attempts.Load())
+	}
+}
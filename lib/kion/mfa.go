@@ -0,0 +1,117 @@
+package kion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  MFA                                                                       //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Second factors an IDMS can challenge for when signing in with a username
+// and password.
+const (
+	// MFAMethodTOTP is a one-time code from an authenticator app.
+	MFAMethodTOTP = "totp"
+	// MFAMethodPush is a push notification approved on the user's phone,
+	// such as with Duo.
+	MFAMethodPush = "push"
+)
+
+// ErrMFAPending is returned by VerifyMFA while a push notification is yet to
+// be approved.
+var ErrMFAPending = errors.New("the push notification has not been approved yet")
+
+// MFAChallenge is the second factor Kion asks for before issuing a session.
+type MFAChallenge struct {
+	// Token ties the answer to the sign in that was challenged.
+	Token   string
+	Method  string
+	Message string
+}
+
+// MFARequiredError is returned by Authenticate when the IDMS asks for a
+// second factor, answered with VerifyMFA.
+type MFARequiredError struct {
+	Challenge MFAChallenge
+}
+
+// Error implements the error interface for MFARequiredError.
+func (e *MFARequiredError) Error() string {
+	return fmt.Sprintf("authentication requires a second factor (%v)", e.Challenge.Method)
+}
+
+// MFARequest maps to the required post body when answering a second factor
+// challenge with the Kion API.
+type MFARequest struct {
+	Token string `json:"mfa_token"`
+	Code  string `json:"code,omitempty"`
+}
+
+// mfaResponse maps to the parts of a Kion API response about a second factor.
+type mfaResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		MFAType     string `json:"mfa_type"`
+		MFAPending  bool   `json:"mfa_pending"`
+	} `json:"data"`
+}
+
+// parseMFAChallenge returns the second factor an authentication response asks
+// for, if any. A challenge of an unnamed method is taken to want a code.
+func parseMFAChallenge(body string) (MFAChallenge, bool) {
+	var parsed mfaResponse
+	if json.Unmarshal([]byte(body), &parsed) != nil || (!parsed.Data.MFARequired && parsed.Data.MFAToken == "") {
+		return MFAChallenge{}, false
+	}
+	challenge := MFAChallenge{Token: parsed.Data.MFAToken, Method: parsed.Data.MFAType, Message: parsed.Message}
+	if challenge.Method != MFAMethodPush {
+		challenge.Method = MFAMethodTOTP
+	}
+	return challenge, true
+}
+
+// VerifyMFA answers a second factor challenge, with the code given for a
+// one-time code or polling for a push notification's approval, and returns
+// the session Kion issues. ErrMFAPending is returned while a push is yet to
+// be approved, so callers should ask again shortly.
+func VerifyMFA(host string, challenge MFAChallenge, code string) (Session, error) {
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/token/mfa", host)
+	query := map[string]string{}
+	data := MFARequest{Token: challenge.Token, Code: code}
+	resp, _, err := runAuthQuery("POST", url, query, data)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusAccepted {
+		return Session{}, ErrMFAPending
+	}
+	if errors.As(err, &apiErr) {
+		return Session{}, fmt.Errorf("kion rejected the second factor: %v", apiMessage(apiErr.Body))
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	// unmarshal response body
+	var pending mfaResponse
+	if json.Unmarshal(resp, &pending) == nil && pending.Data.MFAPending {
+		return Session{}, ErrMFAPending
+	}
+	authResp := AuthResponse{}
+	err = json.Unmarshal(resp, &authResp)
+	if err != nil {
+		return Session{}, err
+	}
+	if authResp.Session.Access.Token == "" {
+		return Session{}, errors.New("kion returned no token after the second factor")
+	}
+
+	return authResp.Session, nil
+}
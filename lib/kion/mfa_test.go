@@ -0,0 +1,111 @@
+package kion
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticateMFARequired(t *testing.T) {
+	tests := []struct {
+		description string
+		status      int
+		body        string
+		want        *MFAChallenge
+	}{
+		{
+			"TOTP",
+			401,
+			`{"status": 401, "message": "Enter the code from your authenticator app", "data": {"mfa_required": true, "mfa_token": "abc", "mfa_type": "totp"}}`,
+			&MFAChallenge{Token: "abc", Method: MFAMethodTOTP, Message: "Enter the code from your authenticator app"},
+		},
+		{
+			"Push",
+			200,
+			`{"status": 200, "message": "Duo push sent", "data": {"mfa_token": "abc", "mfa_type": "push"}}`,
+			&MFAChallenge{Token: "abc", Method: MFAMethodPush, Message: "Duo push sent"},
+		},
+		{
+			"Unnamed Method",
+			401,
+			`{"status": 401, "data": {"mfa_required": true, "mfa_token": "abc"}}`,
+			&MFAChallenge{Token: "abc", Method: MFAMethodTOTP},
+		},
+		{
+			"Wrong Password",
+			401,
+			`{"status": 401, "message": "Invalid username or password"}`,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			_, err := Authenticate(server.URL, 1, "jane", "secret")
+			var mfaErr *MFARequiredError
+			found := errors.As(err, &mfaErr)
+			if found != (test.want != nil) {
+				t.Fatalf("got error %v, wanted a second factor challenge: %v", err, test.want != nil)
+			}
+			if found && mfaErr.Challenge != *test.want {
+				t.Errorf("got %+v, wanted %+v", mfaErr.Challenge, *test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyMFA(t *testing.T) {
+	tests := []struct {
+		description string
+		code        string
+		status      int
+		body        string
+		wantToken   string
+		wantErr     string
+	}{
+		{"Code Accepted", "123456", 200, `{"status": 200, "data": {"access": {"token": "session"}}}`, "session", ""},
+		{"Code Rejected", "000000", 401, `{"status": 401, "message": "Invalid verification code"}`, "", "Invalid verification code"},
+		{"Push Pending", "", 202, `{"status": 202}`, "", ErrMFAPending.Error()},
+		{"Push Pending In Body", "", 200, `{"status": 200, "data": {"mfa_pending": true}}`, "", ErrMFAPending.Error()},
+		{"Push Denied", "", 403, `{"status": 403, "message": "Push notification denied"}`, "", "Push notification denied"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got MFARequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/token/mfa" {
+					t.Errorf("got request to %v", r.URL.Path)
+				}
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			session, err := VerifyMFA(server.URL, MFAChallenge{Token: "abc", Method: MFAMethodTOTP}, test.code)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, wanted %q", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if session.Access.Token != test.wantToken {
+				t.Errorf("got token %q, wanted %q", session.Access.Token, test.wantToken)
+			}
+			if want := (MFARequest{Token: "abc", Code: test.code}); got != want {
+				t.Errorf("got request %+v, wanted %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package kion
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Proxies                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// proxyFunc picks the proxy each request is sent through, the one set in the
+// environment unless set with SetProxy.
+var proxyFunc = http.ProxyFromEnvironment
+
+// SetProxy sends every request through the HTTP or HTTPS proxy at proxy,
+// given as host:port or a url optionally holding a username and password,
+// except those to hosts matching noProxy. noProxy is a comma separated list
+// of hosts, domains, IPs, and CIDRs as NO_PROXY is, and falls back to
+// NO_PROXY when empty. An empty proxy restores HTTP_PROXY, HTTPS_PROXY, and
+// NO_PROXY from the environment.
+func SetProxy(proxy string, noProxy string) error {
+	if proxy == "" {
+		proxyFunc = http.ProxyFromEnvironment
+		buildTransports()
+		return nil
+	}
+
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid proxy: unsupported scheme %v", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid proxy: no host in %v", proxy)
+	}
+
+	if noProxy == "" {
+		noProxy = os.Getenv("NO_PROXY")
+	}
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	proxyFunc = func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(noProxy, req.URL) {
+			return nil, nil
+		}
+		return u, nil
+	}
+	buildTransports()
+	return nil
+}
+
+// ProxyFor returns the proxy requests to target are sent through, nil when
+// they are sent directly or through a dialer set with SetDialer.
+func ProxyFor(target string) (*url.URL, error) {
+	if dialer != nil {
+		return nil, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return proxyFunc(req)
+}
+
+// bypassProxy reports whether requests to target are sent directly rather
+// than through a proxy, as target is on the loopback interface or matches an
+// entry in noProxy. Entries match as they do in NO_PROXY: * matches every
+// host, an IP or CIDR matches the addresses in it, and a domain matches
+// itself and its subdomains, or only its subdomains with a leading dot. An
+// entry with a port only matches that port.
+func bypassProxy(noProxy string, target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+
+	for _, entry := range strings.Split(strings.ToLower(noProxy), ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		// split off a port, keeping bare IPv6 addresses whole
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		entryHost = strings.Trim(entryHost, "[]")
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost = strings.TrimPrefix(entryHost, "*")
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(host, entryHost) {
+				return true
+			}
+		} else if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
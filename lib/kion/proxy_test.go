@@ -0,0 +1,92 @@
+package kion
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		description string
+		noProxy     string
+		target      string
+		want        bool
+	}{
+		{"Empty", "", "https://kion.example.com", false},
+		{"Localhost", "", "http://localhost:8400/callback", true},
+		{"Loopback", "", "http://127.0.0.1:8400/callback", true},
+		{"Wildcard", "*", "https://kion.example.com", true},
+		{"Exact Host", "kion.example.com", "https://kion.example.com", true},
+		{"Domain Matches Subdomains", "example.com", "https://kion.example.com", true},
+		{"Domain Matches Itself", "example.com", "https://example.com", true},
+		{"Leading Dot", ".example.com", "https://kion.example.com", true},
+		{"Leading Dot Skips Itself", ".example.com", "https://example.com", false},
+		{"Leading Star", "*.example.com", "https://kion.example.com", true},
+		{"Suffix Without Dot", "example.com", "https://notexample.com", false},
+		{"Case Insensitive", "Kion.Example.com", "https://KION.example.com", true},
+		{"List", "idp.example.com, kion.example.com", "https://kion.example.com", true},
+		{"Port Matches", "kion.example.com:443", "https://kion.example.com", true},
+		{"Port Differs", "kion.example.com:8443", "https://kion.example.com", false},
+		{"IP", "10.1.2.3", "https://10.1.2.3", true},
+		{"CIDR", "10.0.0.0/8", "https://10.1.2.3", true},
+		{"CIDR Skips Names", "10.0.0.0/8", "https://kion.example.com", false},
+		{"IPv6", "::1,fd00::/8", "https://[fd00::5]", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bypassProxy(test.noProxy, target); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetProxy(t *testing.T) {
+	// a proxy answers requests for any host itself
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		fmt.Fprint(w, `{"status":200,"data":"3.10.0"}`)
+	}))
+	defer proxy.Close()
+	defer func() {
+		_ = SetProxy("", "")
+	}()
+
+	err := SetProxy(strings.TrimPrefix(proxy.URL, "http://"), "idp.example.invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := GetVersion("http://kion.example.invalid")
+	if err != nil || version != "3.10.0" {
+		t.Errorf("got %q, %v through the proxy", version, err)
+	}
+	if len(proxied) != 1 || !strings.HasPrefix(proxied[0], "http://kion.example.invalid/") {
+		t.Errorf("got proxied requests %v", proxied)
+	}
+
+	// hosts in no_proxy are reached directly
+	got, err := ProxyFor("https://idp.example.invalid/metadata")
+	if err != nil || got != nil {
+		t.Errorf("got proxy %v, %v for a host in no_proxy", got, err)
+	}
+	got, err = ProxyFor("https://kion.example.invalid")
+	if err != nil || got == nil || got.Host != strings.TrimPrefix(proxy.URL, "http://") {
+		t.Errorf("got proxy %v, %v for kion", got, err)
+	}
+
+	for _, invalid := range []string{"socks5://localhost:1080", "http://"} {
+		if err := SetProxy(invalid, ""); err == nil || !strings.Contains(err.Error(), "invalid proxy") {
+			t.Errorf("got %v for %v, wanted an invalid proxy error", err, invalid)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package kion
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Quota                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// quotaReserve is the share of the limit left when pacing starts, so bulk
+	// operations slow down before the limit is hit rather than after.
+	quotaReserve = 0.2
+
+	// epochThreshold tells reset headers holding a unix time apart from those
+	// holding seconds until the reset.
+	epochThreshold = 1_000_000_000
+)
+
+var (
+	// lastQuota is the quota Kion reported in its most recent response that
+	// had one
+	lastQuota   Quota
+	lastQuotaMu sync.Mutex
+)
+
+// Quota is how many requests Kion allows before its rate limit resets, as
+// reported in response headers.
+type Quota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Observed  time.Time `json:"observed"`
+}
+
+// ParseQuota reads the rate limit headers of a response, either the common
+// X-RateLimit-Limit, X-RateLimit-Remaining, and X-RateLimit-Reset or their
+// unprefixed IETF draft names. Resets are accepted as a unix time or seconds
+// from now. A Retry-After header, sent with 429 responses, means nothing
+// remains until it passes. Returns false if Kion reported no quota.
+func ParseQuota(header http.Header, now time.Time) (Quota, bool) {
+	quota := Quota{Observed: now, Limit: -1, Remaining: -1}
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if quota.Limit < 0 {
+			quota.Limit = headerInt(header, prefix+"Limit")
+		}
+		if quota.Remaining < 0 {
+			quota.Remaining = headerInt(header, prefix+"Remaining")
+		}
+		if quota.Reset.IsZero() {
+			if reset := headerInt(header, prefix+"Reset"); reset >= epochThreshold {
+				quota.Reset = time.Unix(int64(reset), 0)
+			} else if reset >= 0 {
+				quota.Reset = now.Add(time.Duration(reset) * time.Second)
+			}
+		}
+	}
+	if retry := headerInt(header, "Retry-After"); retry >= 0 {
+		quota.Remaining = 0
+		quota.Reset = now.Add(time.Duration(retry) * time.Second)
+	}
+
+	if quota.Remaining < 0 {
+		return Quota{}, false
+	}
+	return quota, true
+}
+
+// headerInt returns the first value of a header as a non negative integer,
+// -1 if it is missing or not one. IETF draft headers may carry parameters
+// after a semicolon, which are ignored.
+func headerInt(header http.Header, name string) int {
+	value, _, _ := strings.Cut(header.Get(name), ";")
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// noteQuota remembers the quota Kion reported in a response, if any.
+func noteQuota(resp *http.Response) {
+	quota, found := ParseQuota(resp.Header, time.Now())
+	if !found {
+		return
+	}
+	lastQuotaMu.Lock()
+	defer lastQuotaMu.Unlock()
+	lastQuota = quota
+}
+
+// LastQuota returns the quota Kion reported most recently this run, false if
+// none has been reported.
+func LastQuota() (Quota, bool) {
+	lastQuotaMu.Lock()
+	defer lastQuotaMu.Unlock()
+	return lastQuota, !lastQuota.Observed.IsZero()
+}
+
+// Pace returns how long to wait between requests so the remaining quota lasts
+// until it resets. There is no wait while more than a fifth of the limit
+// remains or once the reset has passed, and the whole time to the reset once
+// nothing remains.
+func (q Quota) Pace(now time.Time) time.Duration {
+	untilReset := q.Reset.Sub(now)
+	if q.Reset.IsZero() || untilReset <= 0 {
+		return 0
+	}
+	if q.Remaining <= 0 {
+		return untilReset
+	}
+	if q.Limit > 0 && float64(q.Remaining) > float64(q.Limit)*quotaReserve {
+		return 0
+	}
+	return untilReset / time.Duration(q.Remaining+1)
+}
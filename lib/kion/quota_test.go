@@ -0,0 +1,92 @@
+package kion
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		header      map[string]string
+		want        Quota
+		wantFound   bool
+	}{
+		{
+			"No Headers",
+			map[string]string{},
+			Quota{},
+			false,
+		},
+		{
+			"Unix Reset",
+			map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "40", "X-RateLimit-Reset": "1792152060"},
+			Quota{Limit: 100, Remaining: 40, Reset: time.Unix(1792152060, 0), Observed: now},
+			true,
+		},
+		{
+			"IETF Draft",
+			map[string]string{"RateLimit-Limit": "100;w=60", "RateLimit-Remaining": "5", "RateLimit-Reset": "30"},
+			Quota{Limit: 100, Remaining: 5, Reset: now.Add(30 * time.Second), Observed: now},
+			true,
+		},
+		{
+			"Retry After",
+			map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "3", "Retry-After": "12"},
+			Quota{Limit: 100, Remaining: 0, Reset: now.Add(12 * time.Second), Observed: now},
+			true,
+		},
+		{
+			"Limit Without Remaining",
+			map[string]string{"X-RateLimit-Limit": "100"},
+			Quota{},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			header := http.Header{}
+			for name, value := range test.header {
+				header.Set(name, value)
+			}
+			got, found := ParseQuota(header, now)
+			if found != test.wantFound {
+				t.Fatalf("got found %v, wanted %v", found, test.wantFound)
+			}
+			if found && (got.Limit != test.want.Limit || got.Remaining != test.want.Remaining || !got.Reset.Equal(test.want.Reset) || !got.Observed.Equal(test.want.Observed)) {
+				t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuotaPace(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	reset := now.Add(time.Minute)
+
+	tests := []struct {
+		description string
+		quota       Quota
+		want        time.Duration
+	}{
+		{"Plenty Remaining", Quota{Limit: 100, Remaining: 50, Reset: reset}, 0},
+		{"Within Reserve", Quota{Limit: 100, Remaining: 11, Reset: reset}, 5 * time.Second},
+		{"Exhausted", Quota{Limit: 100, Remaining: 0, Reset: reset}, time.Minute},
+		{"Reset Passed", Quota{Limit: 100, Remaining: 0, Reset: now.Add(-time.Second)}, 0},
+		{"No Reset", Quota{Limit: 100, Remaining: 0}, 0},
+		{"Unknown Limit", Quota{Limit: -1, Remaining: 3, Reset: reset}, 15 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := test.quota.Pace(now)
+			if got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
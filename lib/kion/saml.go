@@ -2,21 +2,27 @@ package kion
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
-	"os/exec"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	saml2 "github.com/russellhaering/gosaml2"
 	samlTypes "github.com/russellhaering/gosaml2/types"
@@ -26,8 +32,58 @@ import (
 var (
 	// SAMLLocalAuthPort is the port to use to accept back the access token from SAML
 	SAMLLocalAuthPort = "8400"
+
+	// SAMLCallbackAddress is the address the SAML callback listener binds to
+	SAMLCallbackAddress = "127.0.0.1"
+
+	// SAMLCallbackPorts are the ports tried in order for the SAML callback
+	// listener, defaulting to SAMLLocalAuthPort alone
+	SAMLCallbackPorts []int
+
+	// SAMLCallbackHost is the host name in the SAML callback URL in place of
+	// localhost, for identity providers that only post to a registered name
+	// such as kion-cli.local. It has to resolve to the callback listener, see
+	// CheckSAMLCallbackHost.
+	SAMLCallbackHost string
+
+	// ssoCodeLinkRegexp finds the link to the code in the HTML page older
+	// Kion releases reply to an accepted SAML response with
+	ssoCodeLinkRegexp = regexp.MustCompile(`href="([^"]*code=[^"]*)"`)
+
+	// SAMLIdPInitiatedURL is the identity provider's URL for Kion, such as the
+	// link behind its app tile, opened to start an IdP-initiated sign in in
+	// place of sending a sign in request. The identity provider has to post
+	// the assertion to the SAML callback URL.
+	SAMLIdPInitiatedURL string
+
+	// SAMLOpenBrowser opens the identity provider's sign in page. When unset,
+	// or if it fails, the page's URL is printed for the user to visit instead.
+	SAMLOpenBrowser func(authURL string) error
+
+	// SAMLOutput is where the sign in URL and warnings about the sign in are
+	// written, such as a writer that keeps them clear of a spinner.
+	SAMLOutput io.Writer = os.Stderr
 )
 
+// ErrSAMLResponseFormat is returned when Kion's reply to the SAML callback
+// matches none of the formats the SSO code is known to be returned in, which
+// usually means this Kion release is newer than the CLI.
+var ErrSAMLResponseFormat = errors.New("unrecognized response to the SAML callback")
+
+// ErrMetadataInvalid is returned when identity provider metadata can't be
+// parsed or lacks what a sign in needs, such as a single sign on service or
+// readable signing certificates.
+var ErrMetadataInvalid = errors.New("invalid SAML metadata")
+
+// ErrCallbackTimeout is returned when no SAML response is posted to the
+// callback in time.
+var ErrCallbackTimeout = errors.New("timed out waiting for a SAML response")
+
+// ErrIDPRejected is returned when the identity provider posts a SAML response
+// refusing the sign in, such as after a failed MFA challenge or for a user
+// not assigned to Kion.
+var ErrIDPRejected = errors.New("the identity provider rejected the sign in")
+
 type CSRFResponse struct {
 	Data string `json:"data"`
 }
@@ -37,17 +93,22 @@ type SSOAuthResponse struct {
 }
 
 type AccessData struct {
-	Access TokenData `json:"access"`
+	Access  TokenData `json:"access"`
+	Refresh TokenData `json:"refresh"`
 }
 
 type TokenData struct {
-	Token string `json:"token"`
+	Token  string `json:"token"`
+	Expiry string `json:"expiry"`
 }
 
 type AuthData struct {
 	AuthToken string
 	Cookies   []*http.Cookie
 	CSRFToken string
+
+	// Refresh is the refresh token issued with the auth token, if any.
+	Refresh TokenData
 }
 
 type SamlCallbackResult struct {
@@ -55,47 +116,216 @@ type SamlCallbackResult struct {
 	Err  error
 }
 
-func AuthenticateSAML(appUrl string, metadata *samlTypes.EntityDescriptor, serviceProviderIssuer string) (*AuthData, error) {
-	certStore := dsig.MemoryX509CertificateStore{
-		Roots: []*x509.Certificate{},
+// AuthenticateSAML signs in through the identity provider in the browser,
+// forwarding the SAML response posted back to the callback on to Kion and
+// exchanging it for a session. The callback is shut down once ctx is done,
+// returning ErrCallbackTimeout if its deadline passed first.
+func AuthenticateSAML(ctx context.Context, appUrl string, metadata *samlTypes.EntityDescriptor, serviceProviderIssuer string) (*AuthData, error) {
+	callback, err := ListenSAMLCallback(metadata, serviceProviderIssuer)
+	if err != nil {
+		return nil, err
 	}
+	defer callback.Close()
+	Log.Info("saml callback listening", "url", callback.URL)
 
-	for _, kd := range metadata.IDPSSODescriptor.KeyDescriptors {
-		for idx, xcert := range kd.KeyInfo.X509Data.X509Certificates {
-			if xcert.Data == "" {
-				return nil, fmt.Errorf("metadata certificate(%d) must not be empty", idx)
-			}
-			certData, err := base64.StdEncoding.DecodeString(xcert.Data)
-			if err != nil {
-				return nil, err
-			}
+	authURL, err := callback.SignInURL()
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(authURL); err == nil {
+		Log.Info("saml sign in started", "idp", u.Host, "idp_initiated", SAMLIdPInitiatedURL != "")
+	}
+	OpenSAMLSignIn(authURL)
 
-			idpCert, err := x509.ParseCertificate(certData)
-			if err != nil {
-				return nil, err
-			}
+	var authData *AuthData
+	err = callback.ServeContext(ctx, func(form []byte, posted []byte) error {
+		Log.Info("saml response received", "bytes", len(posted))
+		if SAMLDebug != nil {
+			SAMLDebug(posted)
+		}
+		err := CheckSAMLStatus(posted)
+		if err != nil {
+			Log.Info("saml response refused the sign in", "error", err)
+			return err
+		}
+		err = callback.ValidateResponse(form)
+		if err != nil {
+			Log.Info("saml response failed validation", "error", err)
+			return err
+		}
+		authData, err = ExchangeSAMLResponse(appUrl, form)
+		if err != nil {
+			Log.Info("saml response not exchanged for a session", "error", err)
+			return err
+		}
+		Log.Info("saml response exchanged for a session")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return authData, nil
+}
+
+// OpenSAMLSignIn sends the user to the identity provider's sign in page,
+// opening it with SAMLOpenBrowser or else printing its URL to visit.
+func OpenSAMLSignIn(authURL string) {
+	if SAMLOpenBrowser == nil {
+		fmt.Fprintf(SAMLOutput, "Visit this URL to authenticate:\n%v\n", authURL)
+	} else if err := SAMLOpenBrowser(authURL); err != nil {
+		fmt.Fprintf(SAMLOutput, "Unable to open a browser: %v\nVisit this URL to authenticate:\n%v\n", err, authURL)
+	}
+}
+
+// SAMLBindingRedirect is the HTTP-Redirect binding sign in requests are sent
+// with, carried in the query string of the identity provider's URL.
+const SAMLBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
 
-			certStore.Roots = append(certStore.Roots, idpCert)
+// SAMLSignInService returns the identity provider's single sign on service
+// sign in requests are sent to, the one with the HTTP-Redirect binding they
+// are built for, or else the first listed.
+func SAMLSignInService(metadata *samlTypes.EntityDescriptor) (samlTypes.SingleSignOnService, error) {
+	if metadata.IDPSSODescriptor == nil || len(metadata.IDPSSODescriptor.SingleSignOnServices) == 0 {
+		return samlTypes.SingleSignOnService{}, fmt.Errorf("%w: it lists no single sign on service", ErrMetadataInvalid)
+	}
+	services := metadata.IDPSSODescriptor.SingleSignOnServices
+	for _, service := range services {
+		if service.Binding == SAMLBindingRedirect {
+			return service, nil
 		}
 	}
+	return services[0], nil
+}
+
+// SAMLCallback listens for the identity provider to post the SAML response
+// back after signing in.
+type SAMLCallback struct {
+	// URL is where the identity provider is told to post the response.
+	URL string
+
+	sp         *saml2.SAMLServiceProvider
+	listener   net.Listener
+	relayState string
+}
+
+// ListenSAMLCallback binds the callback listener, see SAMLCallbackPorts, and
+// prepares a sign in with the identity provider described by metadata.
+func ListenSAMLCallback(metadata *samlTypes.EntityDescriptor, serviceProviderIssuer string) (*SAMLCallback, error) {
+	service, err := SAMLSignInService(metadata)
+	if err != nil {
+		return nil, err
+	}
+	certStore, err := samlCertStore(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// requests are only signed when a service provider key is configured,
+	// otherwise a throwaway key stands in as the library requires one
+	var keyStore dsig.X509KeyStore = dsig.RandomKeyStoreForTest()
+	if SAMLSigningKeyStore != nil {
+		keyStore = SAMLSigningKeyStore
+	}
+
+	// the relay state ties the assertion posted back to this sign in
+	relayState, err := newRelayState()
+	if err != nil {
+		return nil, err
+	}
+
+	// bind the callback listener first so the identity provider is told to
+	// post back to the port we actually got
+	listener, err := listenSAMLCallback(SAMLCallbackAddress, SAMLCallbackPorts)
+	if err != nil {
+		return nil, err
+	}
+	callbackURL := samlCallbackURL(listener.Addr(), SAMLCallbackTLS != nil)
+	if SAMLCallbackTLS != nil {
+		listener = tls.NewListener(listener, SAMLCallbackTLS)
+	}
 
-	// TODO: Allow importing private key and certificate from Kion application
-	// For now we use a generated key/cert to sign the request, which will work
-	// unless the customer has set up the IDP to verify our SP cert.
-	randomKeyStore := dsig.RandomKeyStoreForTest()
+	return &SAMLCallback{
+		URL: callbackURL,
+		sp: &saml2.SAMLServiceProvider{
+			IdentityProviderSSOURL:      service.Location,
+			IdentityProviderIssuer:      metadata.EntityID,
+			ServiceProviderIssuer:       serviceProviderIssuer,
+			AssertionConsumerServiceURL: callbackURL,
+			SignAuthnRequests:           SAMLSigningKeyStore != nil,
+			IDPCertificateStore:         certStore,
+			SPKeyStore:                  keyStore,
+		},
+		listener:   listener,
+		relayState: relayState,
+	}, nil
+}
+
+// Close stops listening for the callback.
+func (cb *SAMLCallback) Close() error {
+	return cb.listener.Close()
+}
+
+// SignInURL returns the URL the browser is sent to for the sign in, see
+// samlSignInURL.
+func (cb *SAMLCallback) SignInURL() (string, error) {
+	return samlSignInURL(cb.sp, cb.relayState, cb.listener.Addr())
+}
+
+// ValidateResponse checks the SAML response in a form posted to the callback
+// before it is forwarded to Kion, see validateSAMLResponse.
+func (cb *SAMLCallback) ValidateResponse(form []byte) error {
+	return validateSAMLResponse(cb.sp, form, time.Now())
+}
 
-	sp := &saml2.SAMLServiceProvider{
-		IdentityProviderSSOURL:      metadata.IDPSSODescriptor.SingleSignOnServices[0].Location,
-		IdentityProviderIssuer:      metadata.EntityID,
-		ServiceProviderIssuer:       serviceProviderIssuer,
-		AssertionConsumerServiceURL: "http://localhost:" + SAMLLocalAuthPort + "/callback",
-		SignAuthnRequests:           false,
-		IDPCertificateStore:         &certStore,
-		SPKeyStore:                  randomKeyStore,
+// Probe checks the callback can be reached at its URL before the browser is
+// sent to sign in, while nothing is serving it yet. A callback served over
+// TLS is reached without verifying its certificate, the returned warning
+// notes when the system doesn't trust it as the browser would need to.
+func (cb *SAMLCallback) Probe() (string, error) {
+	u, err := url.Parse(cb.URL)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, 5*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("unable to reach the SAML callback at %v: %w", cb.URL, err)
+	}
+	defer conn.Close()
+	if u.Scheme != "https" {
+		return "", nil
 	}
 
-	tokenChan := make(chan SamlCallbackResult, 1)
-	http.HandleFunc("/", func(rw http.ResponseWriter, req *http.Request) {
+	// the listener is not yet accepting, so verify the certificate directly
+	if SAMLCallbackTLS == nil || len(SAMLCallbackTLS.Certificates) == 0 || len(SAMLCallbackTLS.Certificates[0].Certificate) == 0 {
+		return "", nil
+	}
+	cert, err := x509.ParseCertificate(SAMLCallbackTLS.Certificates[0].Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("unable to read the SAML callback certificate: %w", err)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: u.Hostname()})
+	if err != nil {
+		return fmt.Sprintf("the browser may refuse the callback certificate: %v", err), nil
+	}
+	return "", nil
+}
+
+// Serve answers requests to the callback until a SAML response for this sign
+// in is posted, passing it to handle with the relay state removed along with
+// the form as posted. The browser is told it may close the window unless
+// handle fails. Requests lacking a response, or posting one for a different
+// sign in, are turned away and the wait goes on.
+func (cb *SAMLCallback) Serve(handle func(form []byte, posted []byte) error) error {
+	return cb.ServeContext(context.Background(), handle)
+}
+
+// ServeContext serves the callback as Serve does until ctx is done, returning
+// ErrCallbackTimeout if its deadline passes before a response is posted.
+func (cb *SAMLCallback) ServeContext(ctx context.Context, handle func(form []byte, posted []byte) error) error {
+	defer Timings.Time(PhaseSignIn, "waiting for the SAML response")()
+	result := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, req *http.Request) {
 		if strings.Contains(req.URL.String(), "/favicon.ico") {
 			http.NotFound(rw, req)
 			return
@@ -109,81 +339,63 @@ func AuthenticateSAML(appUrl string, metadata *samlTypes.EntityDescriptor, servi
 		b, err := io.ReadAll(req.Body)
 		if err != nil {
 			rw.WriteHeader(http.StatusBadRequest)
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("bad SAML callback request: %w", err)}
+			result <- fmt.Errorf("bad SAML callback request: %w", err)
 			return
 		}
 
-		client := &http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-
-		// get csrf token
-		csrfToken, csrfCookie, err := getCSRFToken(appUrl, client)
+		// responses to other sign ins are turned away and the wait goes on
+		form, err := checkRelayState(b, cb.relayState, SAMLIdPInitiatedURL != "")
 		if err != nil {
-			fmt.Println("error getting csrf token: ", csrfToken)
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("error getting CSRF token: %s", csrfToken)}
+			Log.Info("saml callback turned a request away", "method", req.Method, "path", req.URL.Path, "reason", err)
+			http.Error(rw, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// update the client to use the csrf cookies
-		jar, err := cookiejar.New(nil)
-		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("failed to create an empty cookie jar: %w", err)}
-			return
-		}
-		url, err := url.Parse(appUrl)
-		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("failed to parse ssl url: %w", err)}
-			return
-		}
-		jar.SetCookies(url, csrfCookie)
-		client.Jar = jar
-
-		r, err := http.NewRequest("POST", appUrl+"/api/v1/saml/callback", bytes.NewReader(b))
+		err = handle(form, b)
 		if err != nil {
 			rw.WriteHeader(http.StatusBadRequest)
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("error creating SAML request: %w", err)}
+			result <- err
 			return
 		}
-		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		resp, err := client.Do(r)
-		if err != nil {
-			rw.WriteHeader(http.StatusBadRequest)
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("error posting SAML assertion: %w", err)}
-			return
-		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
+		// send auto-close response before returning token
+		_, err = rw.Write([]byte(samlClosePage))
 		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("error reading SAML response body: %w", err)}
+			result <- fmt.Errorf("failed to send auto-close response: %w", err)
 			return
 		}
 
-		ssoCodeRegexp, err := regexp.Compile(`code=(.+)">`)
-		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("failed to compile access token regular expression: %w", err)}
-			return
+		result <- nil
+	})
+
+	server := &http.Server{Handler: mux}
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		select {
+		case err = <-result:
+		case <-ctx.Done():
+			err = ctx.Err()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("%w at %v", ErrCallbackTimeout, cb.URL)
+			}
 		}
-		groups := ssoCodeRegexp.FindStringSubmatch(string(body))
-		if len(groups) < 2 {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("could not find SSO code in SAML authentication response.  Response: %v", string(body))}
-			return
+		closeErr := server.Close()
+		if err == nil {
+			err = closeErr
 		}
-		// parse the sso code from the groups
-		ssoCode := groups[1]
+		done <- err
+	}()
 
-		// get auth and refresh token
-		authToken, refreshCookie, err := getAuthToken(appUrl, ssoCode, csrfToken, client)
-		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("failed to get auth token: %w", err)}
-			return
-		}
+	err := server.Serve(cb.listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("the SAML callback stopped listening: %w", err)
+	}
+	return <-done
+}
 
-		// send auto-close response before returning token
-		_, err = rw.Write([]byte(`
+// samlClosePage is shown in the browser once the SAML response is accepted.
+const samlClosePage = `
 		<!doctype html>
 		<html lang="en">
 		  <head>
@@ -218,72 +430,297 @@ func AuthenticateSAML(appUrl string, metadata *samlTypes.EntityDescriptor, servi
         </div>
 		  </body>
 		</html>
-		`))
+		`
+
+// newRelayState returns a random value to pass as the RelayState of a sign
+// in, which the identity provider returns with the assertion.
+func newRelayState() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate a relay state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// samlSignInURL returns the URL the browser is sent to for the sign in. With
+// SAMLIdPInitiatedURL set that's the identity provider's URL for Kion with
+// the relay state added, otherwise it's a sign in request for the service
+// provider.
+func samlSignInURL(sp *saml2.SAMLServiceProvider, relayState string, callback net.Addr) (string, error) {
+	if SAMLIdPInitiatedURL == "" {
+		// the redirect binding carries the signature in the query string rather
+		// than the request
+		authRequest, err := sp.BuildAuthRequestDocumentNoSig()
 		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: fmt.Errorf("failed to send auto-close response: %w", err)}
-			return
+			return "", fmt.Errorf("unable to build the SAML sign in request: %w", err)
 		}
+		return sp.BuildAuthURLRedirect(relayState, authRequest)
+	}
 
-		tokenChan <- SamlCallbackResult{Data: &AuthData{
-			AuthToken: authToken,
-			Cookies:   append(refreshCookie, csrfCookie...),
-			CSRFToken: csrfToken,
-		}, Err: nil}
-	})
+	// the identity provider posts to the callback URL it was configured
+	// with, which only matches the first port
+	if addr, ok := callback.(*net.TCPAddr); ok && len(SAMLCallbackPorts) > 1 && addr.Port != SAMLCallbackPorts[0] {
+		fmt.Fprintf(SAMLOutput, "Warning: the SAML callback is listening on %v as port %v is in use, the identity provider may post to the wrong port\n", sp.AssertionConsumerServiceURL, SAMLCallbackPorts[0])
+	}
+	tileURL, err := url.Parse(SAMLIdPInitiatedURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid IdP-initiated sign in URL: %w", err)
+	}
+	query := tileURL.Query()
+	query.Set("RelayState", relayState)
+	tileURL.RawQuery = query.Encode()
+	return tileURL.String(), nil
+}
 
-	authURL, err := sp.BuildAuthURL("")
+// checkRelayState checks the RelayState of a form posted to the SAML
+// callback matches the sign in underway, returning the form without it to
+// forward on to Kion. Unsolicited assertions are accepted without one, as not
+// every identity provider passes it along for IdP-initiated sign ins.
+func checkRelayState(body []byte, relayState string, unsolicited bool) ([]byte, error) {
+	form, err := url.ParseQuery(string(body))
 	if err != nil {
-		log.Fatalf("The login info is invalid.\n %v", err)
+		return nil, fmt.Errorf("bad SAML callback request: %w", err)
 	}
-	var chromeCommand *exec.Cmd
-	switch runtime.GOOS {
-	case "windows":
-		chromeCommand = exec.Command("start", "chrome", authURL)
-	case "darwin":
-		chromeCommand = exec.Command("open", authURL)
-	case "linux":
-		chromeCommand = exec.Command("/usr/bin/google-chrome", "--new-window", authURL)
+	if form.Get("SAMLResponse") == "" {
+		return nil, errors.New("no SAML response was posted")
 	}
-	err = chromeCommand.Run()
-	if chromeCommand == nil || err != nil {
+	got := form.Get("RelayState")
+	if got != relayState && (got != "" || !unsolicited) {
+		return nil, errors.New("the SAML response belongs to a different sign in, start a new one")
+	}
+	form.Del("RelayState")
+	return []byte(form.Encode()), nil
+}
+
+// ParseSAMLCallbackPorts parses a port, such as 8400, or an inclusive range
+// of ports to try in order, such as 8400-8410.
+func ParseSAMLCallbackPorts(value string) ([]int, error) {
+	first, last, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	start, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML callback port %q, expected a port such as 8400 or a range such as 8400-8410", value)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(last))
 		if err != nil {
-			println("Error opening Chrome browser: ", err)
-		} else {
-			println("Could not locate Chrome browser")
+			return nil, fmt.Errorf("invalid SAML callback port %q, expected a port such as 8400 or a range such as 8400-8410", value)
 		}
-		println("Visit this URL To Authenticate:")
-		println(authURL)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return nil, fmt.Errorf("invalid SAML callback port %q, ports must be between 1 and 65535 with the lowest first", value)
 	}
 
-	server := &http.Server{Addr: ":" + SAMLLocalAuthPort}
-
-	go func() {
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
 
-		tempResult := <-tokenChan
-		err = server.Close()
+// listenSAMLCallback listens on the first of ports free on address, so a
+// second sign in or another program holding a port doesn't stop sign in.
+func listenSAMLCallback(address string, ports []int) (net.Listener, error) {
+	if len(ports) == 0 {
+		port, err := strconv.Atoi(SAMLLocalAuthPort)
 		if err != nil {
-			tokenChan <- SamlCallbackResult{Data: nil, Err: err}
-			return
+			return nil, fmt.Errorf("invalid SAML callback port %q", SAMLLocalAuthPort)
 		}
-		tokenChan <- tempResult
-	}()
+		ports = []int{port}
+	}
+
+	var err error
+	for _, port := range ports {
+		var listener net.Listener
+		listener, err = net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+		if err == nil {
+			return listener, nil
+		}
+	}
+	if len(ports) == 1 {
+		return nil, fmt.Errorf("unable to listen for the SAML callback: %w", err)
+	}
+	return nil, fmt.Errorf("unable to listen for the SAML callback on any port from %v to %v: %w", ports[0], ports[len(ports)-1], err)
+}
+
+// CheckSAMLCallbackPorts reports the address the SAML callback would listen
+// on, see SAMLCallbackAddress and SAMLCallbackPorts, by briefly binding it,
+// or why none of the ports is free.
+func CheckSAMLCallbackPorts() (string, error) {
+	listener, err := listenSAMLCallback(SAMLCallbackAddress, SAMLCallbackPorts)
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
+
+// samlCallbackURL returns the URL the identity provider posts the SAML
+// response back to for a listener at addr, https when secure. Loopback and
+// wildcard addresses use localhost, which is what Kion's destination URLs
+// are registered as, unless SAMLCallbackHost names another host.
+func samlCallbackURL(addr net.Addr, secure bool) string {
+	host, port, _ := net.SplitHostPort(addr.String())
+	ip := net.ParseIP(host)
+	switch {
+	case SAMLCallbackHost != "":
+		host = SAMLCallbackHost
+	case ip == nil || ip.IsLoopback() || ip.IsUnspecified():
+		host = "localhost"
+	}
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + "/callback"
+}
+
+// CheckSAMLCallbackHost checks that host, used in the SAML callback URL in
+// place of localhost, resolves to the callback listener bound to address:
+// to a loopback address, or to address itself when the listener is bound to
+// a specific non-loopback one. Otherwise the browser would post the SAML
+// response somewhere else and the sign in would never complete, so the
+// error explains how to map the name in the hosts file.
+func CheckSAMLCallbackHost(ctx context.Context, host string, address string) error {
+	if strings.ContainsAny(host, ":/") {
+		return fmt.Errorf("invalid SAML callback host %q, expected a host name such as kion-cli.local", host)
+	}
+	hint := fmt.Sprintf("add the line '127.0.0.1 %v' to %v", host, hostsFile())
+	ips, err := LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("the SAML callback host %v doesn't resolve, %v: %w", host, hint, err)
+	}
+	bound := net.ParseIP(address)
+	for _, ip := range ips {
+		if ip.IsLoopback() || (bound != nil && !bound.IsUnspecified() && ip.Equal(bound)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the SAML callback host %v resolves to %v rather than this machine, %v", host, ips, hint)
+}
+
+// hostsFile returns the path of the hosts file names are mapped in.
+func hostsFile() string {
+	if runtime.GOOS == "windows" {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+	return "/etc/hosts"
+}
+
+// Steps of exchanging a SAML response for a Kion session, as reported by
+// SAMLExchangeError.
+const (
+	SAMLStepCSRF     = "csrf token"
+	SAMLStepCallback = "saml callback"
+	SAMLStepSSOCode  = "sso code"
+	SAMLStepToken    = "auth token"
+)
+
+// SAMLExchangeSteps are the steps of exchanging a SAML response for a Kion
+// session in the order they are taken.
+var SAMLExchangeSteps = []string{SAMLStepCSRF, SAMLStepCallback, SAMLStepSSOCode, SAMLStepToken}
+
+// SAMLExchangeError is returned when exchanging a SAML response for a Kion
+// session fails, noting the step that failed.
+type SAMLExchangeError struct {
+	Step string
+	Err  error
+}
+
+// Error implements the error interface for SAMLExchangeError.
+func (e *SAMLExchangeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SAMLExchangeError) Unwrap() error {
+	return e.Err
+}
 
-	err = server.ListenAndServe()
-	if err != nil && !strings.Contains(fmt.Sprintf("%v", err), "Server closed") {
-		log.Fatalf("The login info is invalid.\n %v", err)
+// ExchangeSAMLResponse forwards the form body a SAML identity provider posted
+// to the callback on to Kion and exchanges the resulting code for a session.
+func ExchangeSAMLResponse(appUrl string, samlResponse []byte) (*AuthData, error) {
+	fail := func(step string, format string, args ...any) (*AuthData, error) {
+		return nil, &SAMLExchangeError{Step: step, Err: fmt.Errorf(format, args...)}
 	}
 
-	samlResult := <-tokenChan
+	ctx := context.Background()
+	client := *DefaultClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	// get csrf token
+	csrfToken, csrfCookie, err := getCSRFToken(ctx, appUrl, &client)
+	if err != nil {
+		return fail(SAMLStepCSRF, "error getting CSRF token: %w", err)
+	}
+
+	// update the client to use the csrf cookies
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fail(SAMLStepCSRF, "failed to create an empty cookie jar: %w", err)
+	}
+	url, err := url.Parse(appUrl)
+	if err != nil {
+		return fail(SAMLStepCSRF, "failed to parse ssl url: %w", err)
+	}
+	jar.SetCookies(url, csrfCookie)
+	client.Jar = jar
 
-	if samlResult.Err != nil {
-		return nil, samlResult.Err
+	r, err := http.NewRequestWithContext(ctx, "POST", appUrl+"/api/v1/saml/callback", bytes.NewReader(samlResponse))
+	if err != nil {
+		return fail(SAMLStepCallback, "error creating SAML request: %w", err)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	annotateAuth(r)
+	resp, err := client.Do(ctx, r)
+	if err != nil {
+		return fail(SAMLStepCallback, "error posting SAML assertion: %w", err)
 	}
 
-	return samlResult.Data, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fail(SAMLStepCallback, "error reading SAML response body: %w", err)
+	}
+
+	ssoCode, found := extractSSOCode(resp, body)
+	if !found {
+		if resp.StatusCode >= 400 {
+			return fail(SAMLStepSSOCode, "Kion rejected the SAML response (status %v).  Response: %v", resp.StatusCode, string(body))
+		}
+		version, err := GetVersion(appUrl)
+		if err != nil || version == "" {
+			version = "unknown"
+		}
+		return fail(SAMLStepSSOCode, "%w from Kion version %v (status %v, content type %q), found no SSO code in a redirect, JSON, or HTML link.  Response: %v",
+			ErrSAMLResponseFormat, version, resp.StatusCode, resp.Header.Get("Content-Type"), string(body))
+	}
+
+	// get auth and refresh token
+	tokens, refreshCookie, err := getAuthToken(ctx, appUrl, ssoCode, csrfToken, &client)
+	if err != nil {
+		return fail(SAMLStepToken, "failed to get auth token: %w", err)
+	}
+	if tokens.Access.Token == "" {
+		return fail(SAMLStepToken, "Kion returned no auth token for the SSO code")
+	}
+
+	return &AuthData{
+		AuthToken: tokens.Access.Token,
+		Cookies:   append(refreshCookie, csrfCookie...),
+		CSRFToken: csrfToken,
+		Refresh:   tokens.Refresh,
+	}, nil
 }
 
 func DownloadSAMLMetadata(metadataUrl string) (*samlTypes.EntityDescriptor, error) {
-	res, err := http.Get(metadataUrl)
+	req, err := http.NewRequestWithContext(WithTimingPhase(context.Background(), PhaseMetadata), http.MethodGet, metadataUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := idpClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error downloading SAML metadata file from %v: %w", metadataUrl, err)
 	}
@@ -297,7 +734,7 @@ func DownloadSAMLMetadata(metadataUrl string) (*samlTypes.EntityDescriptor, erro
 	metadata := &samlTypes.EntityDescriptor{}
 	err = xml.Unmarshal(rawMetadata, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing SAML metadata file from %v: %w", metadataUrl, err)
+		return nil, fmt.Errorf("%w, unable to parse it from %v: %w", ErrMetadataInvalid, metadataUrl, err)
 	}
 
 	return metadata, nil
@@ -312,22 +749,21 @@ func ReadSAMLMetadataFile(metadataFile string) (*samlTypes.EntityDescriptor, err
 	metadata := &samlTypes.EntityDescriptor{}
 	err = xml.Unmarshal(rawMetadata, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing SAML metadata file %v: %w", metadataFile, err)
+		return nil, fmt.Errorf("%w, unable to parse it from %v: %w", ErrMetadataInvalid, metadataFile, err)
 	}
 
 	return metadata, nil
 }
 
-func getCSRFToken(appUrl string, client *http.Client) (string, []*http.Cookie, error) {
-	csrfReq, err := http.NewRequest("GET", appUrl+"/api/v2/csrf-token", nil)
+func getCSRFToken(ctx context.Context, appUrl string, client *Client) (string, []*http.Cookie, error) {
+	csrfReq, err := http.NewRequestWithContext(ctx, "GET", appUrl+"/api/v2/csrf-token", nil)
 	if err != nil {
 		return "", nil, err
 	}
-	csrfResp, err := client.Do(csrfReq)
+	csrfResp, err := client.Do(ctx, csrfReq)
 	if err != nil {
 		return "", nil, err
 	}
-	defer csrfResp.Body.Close()
 	csrfBody, err := io.ReadAll(csrfResp.Body)
 	csrfCookie := csrfResp.Cookies()
 	if err != nil {
@@ -341,26 +777,92 @@ func getCSRFToken(appUrl string, client *http.Client) (string, []*http.Cookie, e
 	return csrfData.Data, csrfCookie, nil
 }
 
-func getAuthToken(appUrl string, ssoCode string, csrfToken string, client *http.Client) (string, []*http.Cookie, error) {
-	authReq, err := http.NewRequest("GET", appUrl+"/api/v2/login/sso-provider?code="+ssoCode, nil)
-	authReq.Header.Set("X-Csrf-Token", csrfToken)
+// extractSSOCode finds the SSO code in Kion's reply to the SAML callback.
+// Newer releases redirect to the web app with the code in the query or
+// fragment, or reply with JSON, while older ones render an HTML page linking
+// to it.
+func extractSSOCode(resp *http.Response, body []byte) (string, bool) {
+	// a redirect to the web app
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if code := ssoCodeFromURL(resp.Header.Get("Location")); code != "" {
+			return code, true
+		}
+	}
+
+	// a JSON reply, with the code itself or the URL to redirect to
+	var reply struct {
+		Code string          `json:"code"`
+		Data json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(body, &reply) == nil {
+		if reply.Code != "" {
+			return reply.Code, true
+		}
+		var data struct {
+			Code     string `json:"code"`
+			Redirect string `json:"redirect"`
+			URL      string `json:"url"`
+		}
+		if json.Unmarshal(reply.Data, &data) == nil {
+			for _, code := range []string{data.Code, ssoCodeFromURL(data.Redirect), ssoCodeFromURL(data.URL)} {
+				if code != "" {
+					return code, true
+				}
+			}
+		}
+	}
+
+	// an HTML page linking to the web app
+	groups := ssoCodeLinkRegexp.FindSubmatch(body)
+	if len(groups) == 2 {
+		if code := ssoCodeFromURL(html.UnescapeString(string(groups[1]))); code != "" {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// ssoCodeFromURL returns the code query parameter of a URL, looking in the
+// fragment too as the web app routes there.
+func ssoCodeFromURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
-		return "", nil, err
+		return ""
+	}
+	if code := parsed.Query().Get("code"); code != "" {
+		return code
 	}
-	authResp, err := client.Do(authReq)
+	_, fragmentQuery, found := strings.Cut(parsed.Fragment, "?")
+	if !found {
+		return ""
+	}
+	values, err := url.ParseQuery(fragmentQuery)
 	if err != nil {
-		return "", nil, err
+		return ""
+	}
+	return values.Get("code")
+}
+
+func getAuthToken(ctx context.Context, appUrl string, ssoCode string, csrfToken string, client *Client) (AccessData, []*http.Cookie, error) {
+	authReq, err := http.NewRequestWithContext(ctx, "GET", appUrl+"/api/v2/login/sso-provider?code="+url.QueryEscape(ssoCode), nil)
+	if err != nil {
+		return AccessData{}, nil, err
+	}
+	authReq.Header.Set("X-Csrf-Token", csrfToken)
+	annotateAuth(authReq)
+	authResp, err := client.Do(ctx, authReq)
+	if err != nil {
+		return AccessData{}, nil, err
 	}
-	defer authResp.Body.Close()
 	authBody, err := io.ReadAll(authResp.Body)
 	if err != nil {
-		return "", nil, err
+		return AccessData{}, nil, err
 	}
 
 	var authData SSOAuthResponse
 	err = json.Unmarshal(authBody, &authData)
 	if err != nil {
-		return "", nil, err
+		return AccessData{}, nil, err
 	}
-	return authData.Data.Access.Token, authResp.Cookies(), nil
+	return authData.Data, authResp.Cookies(), nil
 }
@@ -0,0 +1,451 @@
+package kion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	samlTypes "github.com/russellhaering/gosaml2/types"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+func TestExchangeSAMLResponse(t *testing.T) {
+	tests := []struct {
+		description string
+		callback    func(w http.ResponseWriter, form url.Values)
+		wantStep    string
+		wantFormat  bool
+	}{
+		{
+			"Accepted",
+			func(w http.ResponseWriter, form url.Values) {
+				fmt.Fprint(w, `<a href="/login?code=abc123">`)
+			},
+			"",
+			false,
+		},
+		{
+			"Accepted With Redirect",
+			func(w http.ResponseWriter, form url.Values) {
+				w.Header().Set("Location", "/portal/#/login?code=abc123")
+				w.WriteHeader(http.StatusFound)
+			},
+			"",
+			false,
+		},
+		{
+			"Rejected",
+			func(w http.ResponseWriter, form url.Values) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message":"assertion expired"}`)
+			},
+			SAMLStepSSOCode,
+			false,
+		},
+		{
+			"Unrecognized Response",
+			func(w http.ResponseWriter, form url.Values) {
+				fmt.Fprint(w, `<html><body>Signing you in...</body></html>`)
+			},
+			SAMLStepSSOCode,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var posted url.Values
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v2/csrf-token", func(w http.ResponseWriter, r *http.Request) {
+				http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "cookie"})
+				fmt.Fprint(w, `{"data":"csrf-token"}`)
+			})
+			mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"status":200,"data":"3.14.0"}`)
+			})
+			mux.HandleFunc("/api/v1/saml/callback", func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				posted, _ = url.ParseQuery(string(body))
+				test.callback(w, posted)
+			})
+			mux.HandleFunc("/api/v2/login/sso-provider", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("code") != "abc123" || r.Header.Get("X-Csrf-Token") != "csrf-token" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, `{"data":{"access":{"token":"session-token"}}}`)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			authData, err := ExchangeSAMLResponse(server.URL, []byte("SAMLResponse=PHJlc3BvbnNlLz4%3D&RelayState=x"))
+			if posted.Get("SAMLResponse") != "PHJlc3BvbnNlLz4=" || posted.Get("RelayState") != "x" {
+				t.Errorf("posted %v", posted)
+			}
+			if test.wantStep == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if authData.AuthToken != "session-token" || authData.CSRFToken != "csrf-token" {
+					t.Errorf("got %+v", authData)
+				}
+				return
+			}
+			var exchangeErr *SAMLExchangeError
+			if !errors.As(err, &exchangeErr) || exchangeErr.Step != test.wantStep {
+				t.Errorf("got %v, wanted a failure at the %v step", err, test.wantStep)
+			}
+			if test.wantFormat && (!errors.Is(err, ErrSAMLResponseFormat) || !strings.Contains(err.Error(), "Kion version 3.14.0")) {
+				t.Errorf("got %v, wanted an unrecognized response error naming the Kion version", err)
+			}
+		})
+	}
+
+	// an unreachable kion fails before anything is posted
+	defer func(retries int) { DefaultClient.Retries = retries }(DefaultClient.Retries)
+	DefaultClient.Retries = 0
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	_, err := ExchangeSAMLResponse(server.URL, []byte("SAMLResponse=x"))
+	var exchangeErr *SAMLExchangeError
+	if !errors.As(err, &exchangeErr) || exchangeErr.Step != SAMLStepCSRF {
+		t.Errorf("got %v, wanted a failure at the %v step", err, SAMLStepCSRF)
+	}
+}
+
+func TestExtractSSOCode(t *testing.T) {
+	tests := []struct {
+		description string
+		status      int
+		location    string
+		body        string
+		want        string
+	}{
+		{"Legacy HTML Link", http.StatusOK, "", `<a href="/login?code=abc123">Continue</a>`, "abc123"},
+		{"Escaped HTML Link", http.StatusOK, "", `<a href="/portal/#/login?code=abc123&amp;next=%2F">`, "abc123"},
+		{"Redirect Query", http.StatusFound, "https://kion.example.com/login?code=abc123", "", "abc123"},
+		{"Redirect Fragment", http.StatusSeeOther, "/portal/#/login?code=abc123", "", "abc123"},
+		{"JSON Code", http.StatusOK, "", `{"status":200,"data":{"code":"abc123"}}`, "abc123"},
+		{"JSON Top Level Code", http.StatusOK, "", `{"code":"abc123"}`, "abc123"},
+		{"JSON Redirect", http.StatusOK, "", `{"status":200,"data":{"redirect":"/portal/#/login?code=abc123"}}`, "abc123"},
+		{"Redirect Without Code", http.StatusFound, "/login?error=denied", "", ""},
+		{"JSON Without Code", http.StatusOK, "", `{"status":200,"data":"ok"}`, ""},
+		{"Unrelated HTML", http.StatusOK, "", `<a href="/help">Help</a>`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			resp := &http.Response{StatusCode: test.status, Header: http.Header{}}
+			if test.location != "" {
+				resp.Header.Set("Location", test.location)
+			}
+			got, found := extractSSOCode(resp, []byte(test.body))
+			if got != test.want || found != (test.want != "") {
+				t.Errorf("got %q, %v, wanted %q", got, found, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSAMLCallbackPorts(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        []int
+		wantErr     bool
+	}{
+		{"Single", "8400", []int{8400}, false},
+		{"Range", "8400-8403", []int{8400, 8401, 8402, 8403}, false},
+		{"Spaced Range", " 8400 - 8401 ", []int{8400, 8401}, false},
+		{"Reversed", "8410-8400", nil, true},
+		{"Out Of Range", "8400-70000", nil, true},
+		{"Not A Port", "http", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseSAMLCallbackPorts(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListenSAMLCallback(t *testing.T) {
+	// hold a port so the listener has to move on to the next one
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	takenPort := taken.Addr().(*net.TCPAddr).Port
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freePort := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	listener, err := listenSAMLCallback("127.0.0.1", []int{takenPort, freePort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	want := fmt.Sprintf("http://localhost:%v/callback", freePort)
+	if got := samlCallbackURL(listener.Addr(), false); got != want {
+		t.Errorf("got callback %v, wanted %v", got, want)
+	}
+	want = fmt.Sprintf("https://localhost:%v/callback", freePort)
+	if got := samlCallbackURL(listener.Addr(), true); got != want {
+		t.Errorf("got secure callback %v, wanted %v", got, want)
+	}
+
+	_, err = listenSAMLCallback("127.0.0.1", []int{takenPort})
+	if err == nil {
+		t.Error("got no error listening on a taken port")
+	}
+}
+
+func TestCheckRelayState(t *testing.T) {
+	tests := []struct {
+		description string
+		body        string
+		unsolicited bool
+		want        string
+		wantErr     bool
+	}{
+		{"Matching", "SAMLResponse=abc&RelayState=state", false, "SAMLResponse=abc", false},
+		{"Different Sign In", "SAMLResponse=abc&RelayState=other", false, "", true},
+		{"Missing", "SAMLResponse=abc", false, "", true},
+		{"Unsolicited Without Relay State", "SAMLResponse=abc", true, "SAMLResponse=abc", false},
+		{"Unsolicited From Different Sign In", "SAMLResponse=abc&RelayState=other", true, "", true},
+		{"No Response", "RelayState=state", false, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := checkRelayState([]byte(test.body), "state", test.unsolicited)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %q, wanted an error", got)
+				}
+				return
+			}
+			if err != nil || string(got) != test.want {
+				t.Errorf("got %q, %v, wanted %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSAMLSignInURL(t *testing.T) {
+	original := SAMLIdPInitiatedURL
+	defer func() { SAMLIdPInitiatedURL = original }()
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8400}
+
+	SAMLIdPInitiatedURL = "https://idp.example.com/home/kion/0oa1?fromHome=true"
+	got, err := samlSignInURL(nil, "state", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://idp.example.com/home/kion/0oa1?RelayState=state&fromHome=true"; got != want {
+		t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, want)
+	}
+
+	SAMLIdPInitiatedURL = "://bad"
+	if _, err := samlSignInURL(nil, "state", addr); err == nil {
+		t.Error("got no error for an invalid URL")
+	}
+}
+
+func TestSAMLSignInService(t *testing.T) {
+	post := samlTypes.SingleSignOnService{Binding: "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST", Location: "https://idp.example/post"}
+	redirect := samlTypes.SingleSignOnService{Binding: SAMLBindingRedirect, Location: "https://idp.example/redirect"}
+
+	tests := []struct {
+		description string
+		descriptor  *samlTypes.IDPSSODescriptor
+		want        string
+		wantErr     bool
+	}{
+		{"Redirect Preferred", &samlTypes.IDPSSODescriptor{SingleSignOnServices: []samlTypes.SingleSignOnService{post, redirect}}, redirect.Location, false},
+		{"First Otherwise", &samlTypes.IDPSSODescriptor{SingleSignOnServices: []samlTypes.SingleSignOnService{post}}, post.Location, false},
+		{"No Services", &samlTypes.IDPSSODescriptor{}, "", true},
+		{"No Descriptor", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := SAMLSignInService(&samlTypes.EntityDescriptor{IDPSSODescriptor: test.descriptor})
+			if test.wantErr {
+				if !errors.Is(err, ErrMetadataInvalid) {
+					t.Errorf("got %v, %v, wanted ErrMetadataInvalid", got.Location, err)
+				}
+				return
+			}
+			if err != nil || got.Location != test.want {
+				t.Errorf("got %v, %v, wanted %v", got.Location, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSAMLCallback(t *testing.T) {
+	originalPorts := SAMLCallbackPorts
+	defer func() { SAMLCallbackPorts = originalPorts }()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SAMLCallbackPorts = []int{free.Addr().(*net.TCPAddr).Port}
+	free.Close()
+
+	metadata := testSAMLMetadata(t, dsig.RandomKeyStoreForTest())
+	metadata.IDPSSODescriptor.SingleSignOnServices = []samlTypes.SingleSignOnService{{Binding: SAMLBindingRedirect, Location: "https://idp.example/sso"}}
+	callback, err := ListenSAMLCallback(metadata, "kion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer callback.Close()
+
+	warning, err := callback.Probe()
+	if err != nil || warning != "" {
+		t.Fatalf("got %q, %v probing the callback", warning, err)
+	}
+	signIn, err := callback.SignInURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayState := u.Query().Get("RelayState")
+	if !strings.HasPrefix(signIn, "https://idp.example/sso?") || relayState == "" {
+		t.Fatalf("got sign in URL %v", signIn)
+	}
+
+	got := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- callback.Serve(func(form []byte, posted []byte) error {
+			got <- string(form)
+			return nil
+		})
+	}()
+
+	// a response for another sign in is turned away and the wait goes on
+	post := func(body string) int {
+		resp, err := http.Post(callback.URL, "application/x-www-form-urlencoded", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post("SAMLResponse=other&RelayState=other"); status != http.StatusBadRequest {
+		t.Errorf("got status %v for another sign in", status)
+	}
+	if status := post("SAMLResponse=abc&RelayState=" + url.QueryEscape(relayState)); status != http.StatusOK {
+		t.Errorf("got status %v for the sign in", status)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if form := <-got; form != "SAMLResponse=abc" {
+		t.Errorf("got form %q", form)
+	}
+}
+
+func TestSAMLCallbackTimeout(t *testing.T) {
+	originalPorts := SAMLCallbackPorts
+	defer func() { SAMLCallbackPorts = originalPorts }()
+	SAMLCallbackPorts = []int{0}
+
+	metadata := testSAMLMetadata(t, dsig.RandomKeyStoreForTest())
+	metadata.IDPSSODescriptor.SingleSignOnServices = []samlTypes.SingleSignOnService{{Binding: SAMLBindingRedirect, Location: "https://idp.example/sso"}}
+	callback, err := ListenSAMLCallback(metadata, "kion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer callback.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = callback.ServeContext(ctx, func(form []byte, posted []byte) error {
+		t.Error("got a SAML response, wanted none")
+		return nil
+	})
+	if !errors.Is(err, ErrCallbackTimeout) {
+		t.Errorf("got %v, wanted ErrCallbackTimeout", err)
+	}
+}
+
+func TestReadSAMLMetadataFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.xml")
+	err := os.WriteFile(path, []byte("<EntityDescriptor"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadSAMLMetadataFile(path)
+	if !errors.Is(err, ErrMetadataInvalid) {
+		t.Errorf("got %v, wanted ErrMetadataInvalid", err)
+	}
+}
+
+func TestCheckSAMLCallbackHost(t *testing.T) {
+	tests := []struct {
+		description string
+		host        string
+		address     string
+		wantErr     string
+	}{
+		{"Loopback", "localhost", "127.0.0.1", ""},
+		{"Loopback Address", "127.0.0.1", "0.0.0.0", ""},
+		{"Bound Address", "192.0.2.10", "192.0.2.10", ""},
+		{"Elsewhere", "192.0.2.10", "127.0.0.1", "resolves to [192.0.2.10] rather than this machine, add the line '127.0.0.1 192.0.2.10'"},
+		{"Elsewhere With Wildcard", "192.0.2.10", "0.0.0.0", "rather than this machine"},
+		{"Unresolved", "kion-cli.invalid", "127.0.0.1", "doesn't resolve, add the line '127.0.0.1 kion-cli.invalid'"},
+		{"URL", "http://kion-cli.local:8400", "127.0.0.1", "invalid SAML callback host"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckSAMLCallbackHost(context.Background(), test.host, test.address)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("got %v, wanted none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got %v, wanted an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+
+	original := SAMLCallbackHost
+	defer func() { SAMLCallbackHost = original }()
+	SAMLCallbackHost = "kion-cli.local"
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8400}
+	if got, want := samlCallbackURL(addr, false), "http://kion-cli.local:8400/callback"; got != want {
+		t.Errorf("got callback %v, wanted %v", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package kion
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	samlTypes "github.com/russellhaering/gosaml2/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SAML Metadata Caching                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultSAMLMetadataMaxAge is how long downloaded identity provider metadata
+// is used before checking for changes when it sets no cacheDuration.
+const DefaultSAMLMetadataMaxAge = 24 * time.Hour
+
+// CachedSAMLMetadata is identity provider metadata kept between runs so
+// signing in doesn't download it every time, along with what is needed to
+// check whether it changed.
+type CachedSAMLMetadata struct {
+	Raw          []byte
+	ETag         string
+	LastModified string
+	Fetched      time.Time
+	// Expires is when the metadata is next checked for changes.
+	Expires time.Time
+	// ValidUntil is when the metadata must no longer be used, zero if never.
+	ValidUntil time.Time
+}
+
+// StaleSAMLMetadataError is returned along with cached metadata used because
+// it couldn't be checked for changes, such as while offline.
+type StaleSAMLMetadataError struct {
+	Fetched time.Time
+	Err     error
+}
+
+func (e *StaleSAMLMetadataError) Error() string {
+	return fmt.Sprintf("using SAML metadata downloaded %v as it couldn't be refreshed: %v", e.Fetched.Local().Format("2006-01-02 15:04"), e.Err)
+}
+
+func (e *StaleSAMLMetadataError) Unwrap() error {
+	return e.Err
+}
+
+// FetchSAMLMetadata returns identity provider metadata from a url, reusing
+// cached metadata until it expires, then asking the server whether it
+// changed with its ETag and Last-Modified. Metadata expires after its
+// cacheDuration or DefaultSAMLMetadataMaxAge and is never used past its
+// validUntil. Refresh forces a download. If it can't be downloaded, cached
+// metadata still valid is returned with a StaleSAMLMetadataError. The
+// metadata to cache for next time is returned as well.
+func FetchSAMLMetadata(metadataUrl string, cached *CachedSAMLMetadata, refresh bool, now time.Time) (*samlTypes.EntityDescriptor, CachedSAMLMetadata, error) {
+	usable := cached != nil && len(cached.Raw) > 0 && (cached.ValidUntil.IsZero() || now.Before(cached.ValidUntil))
+	if usable && !refresh && now.Before(cached.Expires) {
+		metadata, err := parseSAMLMetadata(cached.Raw, metadataUrl)
+		if err == nil {
+			return metadata, *cached, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(WithTimingPhase(context.Background(), PhaseMetadata), http.MethodGet, metadataUrl, nil)
+	if err != nil {
+		return nil, CachedSAMLMetadata{}, err
+	}
+	if usable && !refresh {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	res, err := idpClient().Do(req)
+	var raw []byte
+	if err == nil {
+		defer res.Body.Close()
+		raw, err = io.ReadAll(res.Body)
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("error downloading SAML metadata file from %v: %w", metadataUrl, err)
+	case res.StatusCode == http.StatusNotModified && usable && !refresh:
+		// unchanged, keep using it until it expires again
+		updated := *cached
+		updated.Fetched = now
+		updated.Expires = samlMetadataExpiry(updated.Raw, now)
+		metadata, err := parseSAMLMetadata(updated.Raw, metadataUrl)
+		return metadata, updated, err
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		err = fmt.Errorf("error downloading SAML metadata file from %v: status %v", metadataUrl, res.StatusCode)
+	}
+	if err != nil {
+		if usable {
+			metadata, parseErr := parseSAMLMetadata(cached.Raw, metadataUrl)
+			if parseErr == nil {
+				return metadata, *cached, &StaleSAMLMetadataError{Fetched: cached.Fetched, Err: err}
+			}
+		}
+		return nil, CachedSAMLMetadata{}, err
+	}
+
+	metadata, err := parseSAMLMetadata(raw, metadataUrl)
+	if err != nil {
+		return nil, CachedSAMLMetadata{}, err
+	}
+	return metadata, CachedSAMLMetadata{
+		Raw:          raw,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Fetched:      now,
+		Expires:      samlMetadataExpiry(raw, now),
+		ValidUntil:   metadata.ValidUntil,
+	}, nil
+}
+
+// parseSAMLMetadata unmarshals identity provider metadata from source.
+func parseSAMLMetadata(raw []byte, source string) (*samlTypes.EntityDescriptor, error) {
+	metadata := &samlTypes.EntityDescriptor{}
+	err := xml.Unmarshal(raw, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w, unable to parse it from %v: %w", ErrMetadataInvalid, source, err)
+	}
+	return metadata, nil
+}
+
+// samlMetadataExpiry returns when metadata fetched at now should be checked
+// for changes, after its cacheDuration, DefaultSAMLMetadataMaxAge if it has
+// none, and never after its validUntil.
+func samlMetadataExpiry(raw []byte, now time.Time) time.Time {
+	var attrs struct {
+		CacheDuration string    `xml:"cacheDuration,attr"`
+		ValidUntil    time.Time `xml:"validUntil,attr"`
+	}
+	_ = xml.Unmarshal(raw, &attrs)
+
+	maxAge, ok := parseXSDuration(attrs.CacheDuration)
+	if !ok {
+		maxAge = DefaultSAMLMetadataMaxAge
+	}
+	expires := now.Add(maxAge)
+	if !attrs.ValidUntil.IsZero() && attrs.ValidUntil.Before(expires) {
+		expires = attrs.ValidUntil
+	}
+	return expires
+}
+
+// xsDuration matches the xs:duration values used by cacheDuration, such as
+// PT1H or P1DT12H.
+var xsDuration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseXSDuration parses an xs:duration, counting years as 365 days and
+// months as 30, reporting false if it isn't a positive duration.
+func parseXSDuration(value string) (time.Duration, bool) {
+	match := xsDuration.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return total, total > 0
+}
@@ -0,0 +1,93 @@
+package kion
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseXSDuration(t *testing.T) {
+	tests := []struct {
+		description string
+		value       string
+		want        time.Duration
+		wantOK      bool
+	}{
+		{"Hours", "PT1H", time.Hour, true},
+		{"Days And Hours", "P1DT12H", 36 * time.Hour, true},
+		{"Minutes And Seconds", "PT5M30.5S", 5*time.Minute + 30500*time.Millisecond, true},
+		{"Months", "P1M", 30 * 24 * time.Hour, true},
+		{"Zero", "PT0S", 0, false},
+		{"Empty", "", 0, false},
+		{"Invalid", "1 hour", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, ok := parseXSDuration(test.value)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("got %v %v, wanted %v %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestFetchSAMLMetadata(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	metadata := `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example" cacheDuration="PT1H" validUntil="2024-06-08T12:00:00Z"></EntityDescriptor>`
+	var downloads, revalidations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, metadata)
+	}))
+
+	// downloaded the first time, expiring after its cache duration
+	got, cached, err := FetchSAMLMetadata(server.URL, nil, false, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EntityID != "https://idp.example" || cached.ETag != `"v1"` || !cached.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("got entity %v, etag %v, and expiry %v", got.EntityID, cached.ETag, cached.Expires)
+	}
+
+	// reused while fresh, revalidated once expired, and downloaded if forced
+	_, _, err = FetchSAMLMetadata(server.URL, &cached, false, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, revalidated, err := FetchSAMLMetadata(server.URL, &cached, false, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revalidated.Expires.Equal(now.Add(3 * time.Hour)) {
+		t.Errorf("got expiry %v after revalidating, wanted an hour later", revalidated.Expires)
+	}
+	_, _, err = FetchSAMLMetadata(server.URL, &cached, true, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 2 || revalidations != 1 {
+		t.Errorf("got %v downloads and %v revalidations, wanted 2 and 1", downloads, revalidations)
+	}
+
+	// offline the cached copy is used until it is no longer valid
+	server.Close()
+	got, _, err = FetchSAMLMetadata(server.URL, &cached, false, now.Add(2*time.Hour))
+	var stale *StaleSAMLMetadataError
+	if !errors.As(err, &stale) || got == nil {
+		t.Errorf("got metadata %v and error %v, wanted the cached metadata and a stale error", got, err)
+	}
+	got, _, err = FetchSAMLMetadata(server.URL, &cached, false, now.Add(8*24*time.Hour))
+	if err == nil || errors.As(err, &stale) || got != nil {
+		t.Errorf("got metadata %v and error %v, wanted expired metadata refused", got, err)
+	}
+}
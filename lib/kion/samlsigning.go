@@ -0,0 +1,117 @@
+package kion
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"time"
+
+	saml2 "github.com/russellhaering/gosaml2"
+	samlTypes "github.com/russellhaering/gosaml2/types"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  SAML Request Signing                                                      //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// SAMLSigningKeyStore holds the service provider key and certificate that
+// AuthnRequests are signed with, for identity providers that require signed
+// requests. When unset requests are not signed.
+var SAMLSigningKeyStore dsig.X509KeyStore
+
+// samlKeyBits is the size of generated service provider keys.
+const samlKeyBits = 2048
+
+// LoadSAMLKeyPair reads a service provider private key and certificate from
+// PEM files for signing AuthnRequests.
+func LoadSAMLKeyPair(keyFile string, certFile string) (dsig.X509KeyStore, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the SAML signing key and certificate: %w", err)
+	}
+	store := dsig.TLSCertKeyStore(pair)
+	return &store, nil
+}
+
+// GenerateSAMLKeyPair generates an RSA private key and a self signed
+// certificate valid for the given duration, returned PEM encoded, for
+// signing AuthnRequests.
+func GenerateSAMLKeyPair(commonName string, validFor time.Duration) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, samlKeyBits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate a key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate a serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create a certificate: %w", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	return keyPEM, certPEM, nil
+}
+
+// SAMLServiceProviderMetadata returns the service provider metadata to
+// register with an identity provider, declaring that AuthnRequests are
+// signed with the certificate in keyStore and that responses are posted to
+// any of callbackURLs. The metadata is valid until the certificate expires.
+func SAMLServiceProviderMetadata(issuer string, callbackURLs []string, keyStore dsig.X509KeyStore) ([]byte, error) {
+	sp := &saml2.SAMLServiceProvider{
+		ServiceProviderIssuer: issuer,
+		SignAuthnRequests:     true,
+		SPSigningKeyStore:     keyStore,
+	}
+	metadata, err := sp.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	// allow the identity provider to post back to any of the callback ports
+	metadata.SPSSODescriptor.AssertionConsumerServices = nil
+	for i, callbackURL := range callbackURLs {
+		metadata.SPSSODescriptor.AssertionConsumerServices = append(metadata.SPSSODescriptor.AssertionConsumerServices, samlTypes.IndexedEndpoint{
+			Binding:  saml2.BindingHttpPost,
+			Location: callbackURL,
+			Index:    i + 1,
+		})
+	}
+
+	_, certDER, err := keyStore.GetKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the SAML signing certificate: %w", err)
+	}
+	metadata.ValidUntil = cert.NotAfter.UTC()
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
@@ -0,0 +1,74 @@
+package kion
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	samlTypes "github.com/russellhaering/gosaml2/types"
+)
+
+func TestSAMLServiceProviderMetadata(t *testing.T) {
+	keyPEM, certPEM, err := GenerateSAMLKeyPair("kion-cli", 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyStore, err := LoadSAMLKeyPair(keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callbacks := []string{"http://localhost:8400/callback", "http://localhost:8401/callback"}
+	data, err := SAMLServiceProviderMetadata("https://kion.example/api/v1/saml/auth/1", callbacks, keyStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata samlTypes.EntityDescriptor
+	err = xml.Unmarshal(data, &metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.EntityID != "https://kion.example/api/v1/saml/auth/1" || !metadata.SPSSODescriptor.AuthnRequestsSigned {
+		t.Errorf("got entity %v signing requests %v", metadata.EntityID, metadata.SPSSODescriptor.AuthnRequestsSigned)
+	}
+	if until := time.Until(metadata.ValidUntil); until < 29*24*time.Hour || until > 31*24*time.Hour {
+		t.Errorf("got metadata valid until %v, wanted when the certificate expires", metadata.ValidUntil)
+	}
+
+	var got []string
+	for _, acs := range metadata.SPSSODescriptor.AssertionConsumerServices {
+		got = append(got, acs.Location)
+	}
+	if len(got) != 2 || got[0] != callbacks[0] || got[1] != callbacks[1] {
+		t.Errorf("got callbacks %v, wanted %v", got, callbacks)
+	}
+
+	_, cert, err := keyStore.GetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptors := metadata.SPSSODescriptor.KeyDescriptors
+	if len(descriptors) != 1 || descriptors[0].Use != "signing" ||
+		descriptors[0].KeyInfo.X509Data.X509Certificates[0].Data != base64.StdEncoding.EncodeToString(cert) {
+		t.Errorf("got key descriptors %+v, wanted the signing certificate", descriptors)
+	}
+
+	// a key without its certificate can't be loaded
+	_, err = LoadSAMLKeyPair(keyFile, keyFile)
+	if err == nil {
+		t.Error("got no error loading a key as a certificate")
+	}
+}
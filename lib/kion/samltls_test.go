@@ -0,0 +1,74 @@
+package kion
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalhostCertificate(t *testing.T) {
+	keyPEM, certPEM, err := GenerateLocalhostCertificate(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	for file, data := range map[string][]byte{keyFile: keyPEM, certFile: certPEM} {
+		err = os.WriteFile(file, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := LoadSAMLCallbackTLS(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// serve over tls as the callback does and connect trusting the certificate
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})}
+	go func() { _ = server.Serve(tls.NewListener(listener, config)) }()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		t.Run(host, func(t *testing.T) {
+			url := samlCallbackURL(listener.Addr(), true)
+			if host != "localhost" {
+				url = fmt.Sprintf("https://%v/callback", listener.Addr())
+			}
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "ok" {
+				t.Errorf("got %q, wanted ok", body)
+			}
+		})
+	}
+}
+
+func TestLoadSAMLCallbackTLSMissing(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadSAMLCallbackTLS(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err == nil {
+		t.Error("got no error loading missing files")
+	}
+}
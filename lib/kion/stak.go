@@ -38,6 +38,10 @@ type STAKRequest struct {
 func GetSTAK(host string, token string, carName string, accNum string) (STAK, error) {
 	// build our query and get response
 	url := fmt.Sprintf("%v/api/v3/temporary-credentials/cloud-access-role", host)
+	if DryRun {
+		fmt.Fprintf(DryRunOutput, "[dry-run] would POST %v for %v on account %v\n", url, carName, accNum)
+		return STAK{}, ErrDryRun
+	}
 	query := map[string]string{}
 	data := STAKRequest{
 		AccountNumber: accNum,
@@ -55,7 +59,16 @@ func GetSTAK(host string, token string, carName string, accNum string) (STAK, er
 		return STAK{}, err
 	}
 
-	// set the expiration time, buffer by 30 seconds
+	// set the expiration time, buffer by 30 seconds, preferring the expiry
+	// provided by kion when present and warning if it disagrees with the
+	// duration
+	if drift, found := checkExpiryDrift(stakResp.STAK, time.Now()); found {
+		fmt.Fprintln(WarningOutput, drift)
+	}
+	if !stakResp.STAK.Expiration.IsZero() {
+		stakResp.STAK.Expiration = stakResp.STAK.Expiration.Add(-30 * time.Second)
+		return stakResp.STAK, nil
+	}
 	duration := stakResp.STAK.Duration
 	if duration == 0 {
 		duration = 900
@@ -64,3 +77,46 @@ func GetSTAK(host string, token string, carName string, accNum string) (STAK, er
 
 	return stakResp.STAK, nil
 }
+
+// expiryDriftThreshold is how far the expiry computed from a STAK's duration
+// may be from the expiration reported by Kion before warning about it.
+const expiryDriftThreshold = time.Minute
+
+// ExpiryDrift describes a STAK whose expiry computed locally from its
+// duration disagrees with the expiration reported by Kion, usually because
+// the local clock is off. The expiration reported by Kion is always used.
+type ExpiryDrift struct {
+	LocalExpiry  time.Time
+	ServerExpiry time.Time
+}
+
+// Drift returns how far the locally computed expiry is past the expiration
+// reported by Kion, negative if it is before.
+func (d ExpiryDrift) Drift() time.Duration {
+	return d.LocalExpiry.Sub(d.ServerExpiry)
+}
+
+// String formats the drift as a warning with key=value fields for log
+// parsing.
+func (d ExpiryDrift) String() string {
+	return fmt.Sprintf("Warning: short-term access key expiry computed locally disagrees with Kion, using Kion's: local_expiry=%v server_expiry=%v drift=%v",
+		d.LocalExpiry.UTC().Format(time.RFC3339), d.ServerExpiry.UTC().Format(time.RFC3339), d.Drift().Round(time.Second))
+}
+
+// checkExpiryDrift compares the expiry of a STAK issued at the given time as
+// computed from its duration with the expiration reported by Kion, returning
+// the drift if both are known and they differ by more than
+// expiryDriftThreshold.
+func checkExpiryDrift(stak STAK, issued time.Time) (ExpiryDrift, bool) {
+	if stak.Duration == 0 || stak.Expiration.IsZero() {
+		return ExpiryDrift{}, false
+	}
+	drift := ExpiryDrift{
+		LocalExpiry:  issued.Add(time.Duration(stak.Duration) * time.Second),
+		ServerExpiry: stak.Expiration,
+	}
+	if drift.Drift().Abs() <= expiryDriftThreshold {
+		return ExpiryDrift{}, false
+	}
+	return drift, true
+}
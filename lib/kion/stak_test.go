@@ -0,0 +1,86 @@
+package kion
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckExpiryDrift(t *testing.T) {
+	issued := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		stak        STAK
+		wantFound   bool
+		wantDrift   time.Duration
+	}{
+		{
+			"Agrees",
+			STAK{Duration: 3600, Expiration: issued.Add(time.Hour + 20*time.Second)},
+			false,
+			0,
+		},
+		{
+			"Local Clock Behind",
+			STAK{Duration: 3600, Expiration: issued.Add(time.Hour + 10*time.Minute)},
+			true,
+			-10 * time.Minute,
+		},
+		{
+			"Local Clock Ahead",
+			STAK{Duration: 3600, Expiration: issued.Add(50 * time.Minute)},
+			true,
+			10 * time.Minute,
+		},
+		{
+			"No Duration",
+			STAK{Expiration: issued.Add(time.Minute)},
+			false,
+			0,
+		},
+		{
+			"No Expiration",
+			STAK{Duration: 3600},
+			false,
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			drift, found := checkExpiryDrift(test.stak, issued)
+			if found != test.wantFound || found && drift.Drift() != test.wantDrift {
+				t.Errorf("got %v (%v), wanted %v (%v)", drift.Drift(), found, test.wantDrift, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestGetSTAKTrustsServerExpiry(t *testing.T) {
+	expiration := time.Now().Add(10 * time.Minute).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":200,"data":{"access_key":"AKIA","duration":3600,"expiration":%q}}`, expiration.Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	var warnings bytes.Buffer
+	WarningOutput = &warnings
+	defer func() { WarningOutput = os.Stderr }()
+
+	stak, err := GetSTAK(server.URL, "token", "Admin", "111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := expiration.Add(-30 * time.Second); !stak.Expiration.Equal(want) {
+		t.Errorf("got expiration %v, wanted %v", stak.Expiration, want)
+	}
+	if !strings.Contains(warnings.String(), "drift=50m") {
+		t.Errorf("got warning %q, wanted a drift of 50m", warnings.String())
+	}
+}
@@ -0,0 +1,287 @@
+package kion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Sync                                                                      //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// DefaultSyncPageSize is how many items are asked for per page when syncing.
+const DefaultSyncPageSize = 250
+
+// SyncState records what the last sync of an inventory fetched, so the next
+// one can skip pages Kion reports unchanged.
+type SyncState struct {
+	// Version is the Kion version synced with, recorded page tags are only
+	// trusted while it is unchanged.
+	Version string
+
+	// PageSize is how many items were asked for per page.
+	PageSize int
+
+	// Pages are the pages fetched keyed by collection and page number, such
+	// as "projects/2".
+	Pages map[string]SyncPage `json:",omitempty"`
+}
+
+// SyncPage is a page fetched by a sync.
+type SyncPage struct {
+	// ETag is the entity tag Kion sent with the page, if any.
+	ETag string `json:",omitempty"`
+
+	// Size is how many items the page held, including any not kept.
+	Size int
+
+	// Keys identify the items kept from the page within the inventory.
+	Keys []string `json:",omitempty"`
+}
+
+// SyncOptions controls how an inventory is synced.
+type SyncOptions struct {
+	// Version is the version of the Kion synced with.
+	Version string
+
+	// PageSize is how many items are asked for per page, DefaultSyncPageSize
+	// when zero.
+	PageSize int
+
+	// Concurrency is how many pages are fetched at once, one when zero.
+	Concurrency int
+
+	// Full ignores what the previous sync recorded and fetches every page.
+	Full bool
+}
+
+// SyncStats sums up what a sync fetched.
+type SyncStats struct {
+	Pages     int
+	Unchanged int
+	Projects  int
+	CARs      int
+}
+
+// SyncInventory fetches the projects and cloud access roles available to the
+// user a page at a time, several pages at once, and both collections at the
+// same time. Pages Kion reports unchanged since previous was synced are taken
+// from previous rather than fetched again. Metadata about accounts from
+// outside of Kion is carried over from previous.
+func SyncInventory(ctx context.Context, host string, token string, previous Inventory, opts SyncOptions) (Inventory, SyncStats, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultSyncPageSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	// recorded pages are only reused from a sync of the same kion release
+	// asking for the same page size
+	var recorded map[string]SyncPage
+	if prev := previous.Sync; prev != nil && !opts.Full && prev.Version == opts.Version && prev.PageSize == opts.PageSize {
+		recorded = prev.Pages
+	}
+	state := &SyncState{Version: opts.Version, PageSize: opts.PageSize, Pages: make(map[string]SyncPage)}
+	inventory := Inventory{Sync: state, Accounts: previous.Accounts, AccountsUpdated: previous.AccountsUpdated}
+
+	var mu sync.Mutex
+	var stats SyncStats
+	var projectErr, carErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		collection := syncCollection[Project]{
+			name:   "projects",
+			url:    host + "/api/v3/project",
+			key:    projectKey,
+			cached: projectsByKey(previous.Projects),
+		}
+		inventory.Projects, projectErr = collection.sync(ctx, token, opts, recorded, state, &mu, &stats)
+	}()
+	go func() {
+		defer wg.Done()
+		collection := syncCollection[CAR]{
+			name:   "cars",
+			url:    host + "/api/v3/me/cloud-access-role",
+			key:    carKey,
+			cached: carsByKey(previous.CARs),
+			keep:   func(car CAR) bool { return car.DeletedAt.Time.IsZero() },
+		}
+		inventory.CARs, carErr = collection.sync(ctx, token, opts, recorded, state, &mu, &stats)
+	}()
+	wg.Wait()
+	if projectErr != nil {
+		return previous, stats, projectErr
+	}
+	if carErr != nil {
+		return previous, stats, carErr
+	}
+
+	stats.Projects, stats.CARs = len(inventory.Projects), len(inventory.CARs)
+	inventory.Updated = time.Now()
+	return inventory, stats, nil
+}
+
+// projectKey identifies a project within an inventory.
+func projectKey(project Project) string {
+	return strconv.FormatUint(uint64(project.ID), 10)
+}
+
+// carKey identifies a cloud access role within an inventory, where a role
+// applied to several accounts is listed once for each.
+func carKey(car CAR) string {
+	return fmt.Sprintf("%v/%v", car.ID, car.AccountNumber)
+}
+
+// projectsByKey indexes projects by projectKey.
+func projectsByKey(projects []Project) map[string]Project {
+	indexed := make(map[string]Project, len(projects))
+	for _, project := range projects {
+		indexed[projectKey(project)] = project
+	}
+	return indexed
+}
+
+// carsByKey indexes cloud access roles by carKey.
+func carsByKey(cars []CAR) map[string]CAR {
+	indexed := make(map[string]CAR, len(cars))
+	for _, car := range cars {
+		indexed[carKey(car)] = car
+	}
+	return indexed
+}
+
+// syncCollection is a paginated collection of the Kion API being synced.
+type syncCollection[T any] struct {
+	name   string
+	url    string
+	key    func(T) string
+	cached map[string]T
+
+	// keep filters the items kept, all are kept when nil
+	keep func(T) bool
+}
+
+// syncedPage is a page of a collection as fetched, or its kept items as
+// recorded when Kion reported it unchanged.
+type syncedPage[T any] struct {
+	items     []T
+	size      int
+	etag      string
+	unchanged bool
+	err       error
+}
+
+// sync fetches every page of the collection, recording them in state. The
+// first page is fetched alone, a Kion that ignores paging answers it with
+// everything, and the rest Concurrency at a time until a page comes back
+// short or holds nothing new.
+func (s syncCollection[T]) sync(ctx context.Context, token string, opts SyncOptions, recorded map[string]SyncPage, state *SyncState, mu *sync.Mutex, stats *SyncStats) ([]T, error) {
+	var items []T
+	seen := make(map[string]bool)
+	page, batch := 1, 1
+	for {
+		pages := make([]syncedPage[T], batch)
+		var wg sync.WaitGroup
+		for i := range pages {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				pages[i] = s.fetch(ctx, token, page+i, opts.PageSize, recorded)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, fetched := range pages {
+			if fetched.err != nil {
+				return nil, fetched.err
+			}
+			fresh := 0
+			var keys []string
+			for _, item := range fetched.items {
+				key := s.key(item)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				fresh++
+				if s.keep == nil || s.keep(item) {
+					items = append(items, item)
+					keys = append(keys, key)
+				}
+			}
+
+			// a page of nothing new is kion repeating itself, having
+			// ignored the page asked for
+			repeated := fresh == 0 && !fetched.unchanged
+			mu.Lock()
+			stats.Pages++
+			if fetched.unchanged {
+				stats.Unchanged++
+			}
+			if !repeated {
+				state.Pages[fmt.Sprintf("%v/%v", s.name, page+i)] = SyncPage{ETag: fetched.etag, Size: fetched.size, Keys: keys}
+			}
+			mu.Unlock()
+
+			if repeated || fetched.size != opts.PageSize {
+				return items, nil
+			}
+		}
+		page += batch
+		batch = opts.Concurrency
+	}
+}
+
+// fetch fetches a page of the collection, asking Kion to skip sending it when
+// unchanged since it was recorded.
+func (s syncCollection[T]) fetch(ctx context.Context, token string, page int, size int, recorded map[string]SyncPage) syncedPage[T] {
+	query := map[string]string{"page": strconv.Itoa(page), "count": strconv.Itoa(size)}
+
+	// only ask about pages whose items are all still at hand
+	previous, found := recorded[fmt.Sprintf("%v/%v", s.name, page)]
+	var cached []T
+	if found && previous.ETag != "" {
+		for _, key := range previous.Keys {
+			item, ok := s.cached[key]
+			if !ok {
+				found = false
+				break
+			}
+			cached = append(cached, item)
+		}
+	}
+	annotator := annotate
+	if found && previous.ETag != "" {
+		annotator = func(req *http.Request) {
+			annotate(req)
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+	}
+
+	body, header, status, err := DefaultClient.queryHeader(ctx, http.MethodGet, s.url, token, query, nil, annotator)
+	if status == http.StatusNotModified && found && previous.ETag != "" {
+		return syncedPage[T]{items: cached, size: previous.Size, etag: previous.ETag, unchanged: true}
+	}
+	if err != nil {
+		return syncedPage[T]{err: err}
+	}
+
+	var resp struct {
+		Data []T `json:"data"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return syncedPage[T]{err: fmt.Errorf("unable to read page %v of %v: %w", page, s.name, err)}
+	}
+	return syncedPage[T]{items: resp.Data, size: len(resp.Data), etag: header.Get("ETag")}
+}
@@ -0,0 +1,137 @@
+package kion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// pagedKion serves projects and cloud access roles a page at a time, tagging
+// each page so unchanged ones can be skipped.
+type pagedKion struct {
+	mu       sync.Mutex
+	projects []Project
+	cars     []CAR
+	ignore   bool
+	requests map[string]int
+	skipped  int
+}
+
+func (k *pagedKion) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.requests[r.URL.Path]++
+
+	var all []any
+	switch r.URL.Path {
+	case "/api/v3/project":
+		for _, project := range k.projects {
+			all = append(all, project)
+		}
+	case "/api/v3/me/cloud-access-role":
+		for _, car := range k.cars {
+			all = append(all, car)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	items := all
+	if !k.ignore {
+		start, end := min((page-1)*count, len(all)), min(page*count, len(all))
+		items = all[start:end]
+	}
+	body, _ := json.Marshal(map[string]any{"status": 200, "data": items})
+	etag := fmt.Sprintf(`"%x"`, body)
+	if r.Header.Get("If-None-Match") == etag {
+		k.skipped++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write(body)
+}
+
+func TestSyncInventory(t *testing.T) {
+	var projects []Project
+	for i := 1; i <= 7; i++ {
+		projects = append(projects, Project{ID: uint(i), Name: fmt.Sprintf("project-%v", i)})
+	}
+	var cars []CAR
+	for i := 1; i <= 5; i++ {
+		cars = append(cars, CAR{ID: 1, Name: "Admin", AccountNumber: fmt.Sprintf("11112222333%v", i)})
+	}
+	deleted := CAR{ID: 2, Name: "Gone", AccountNumber: "111122223331"}
+	deleted.DeletedAt.Time = deleted.DeletedAt.Time.AddDate(2020, 0, 0)
+	cars = append(cars, deleted)
+
+	tests := []struct {
+		description  string
+		ignore       bool
+		concurrency  int
+		wantRequests int
+	}{
+		{"Paged", false, 1, 4 + 4},
+		{"Paged Concurrently", false, 3, 1 + 3 + 1 + 3},
+		{"Paging Ignored", true, 3, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			kion := &pagedKion{projects: slices.Clone(projects), cars: cars, ignore: test.ignore, requests: make(map[string]int)}
+			server := httptest.NewServer(kion)
+			defer server.Close()
+
+			opts := SyncOptions{Version: "3.10.0", PageSize: 2, Concurrency: test.concurrency}
+			inventory, stats, err := SyncInventory(context.Background(), server.URL, "token", Inventory{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inventory.Projects) != 7 || len(inventory.CARs) != 5 || stats.Unchanged != 0 {
+				t.Fatalf("got %v projects, %v cars, %v unchanged pages", len(inventory.Projects), len(inventory.CARs), stats.Unchanged)
+			}
+			if got := kion.requests["/api/v3/project"] + kion.requests["/api/v3/me/cloud-access-role"]; got != test.wantRequests {
+				t.Errorf("got %v requests, wanted %v", got, test.wantRequests)
+			}
+
+			// unchanged pages are taken from the last sync
+			resynced, stats, err := SyncInventory(context.Background(), server.URL, "token", inventory, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resynced.Projects) != 7 || len(resynced.CARs) != 5 || kion.skipped != stats.Unchanged || stats.Unchanged == 0 {
+				t.Errorf("got %v projects, %v cars, %v unchanged pages with %v skipped", len(resynced.Projects), len(resynced.CARs), stats.Unchanged, kion.skipped)
+			}
+
+			// a changed page is fetched again
+			kion.mu.Lock()
+			kion.projects[6].Name = "renamed"
+			kion.mu.Unlock()
+			resynced, _, err = SyncInventory(context.Background(), server.URL, "token", resynced, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resynced.Projects[6].Name != "renamed" {
+				t.Errorf("got %v, wanted the renamed project", resynced.Projects[6].Name)
+			}
+
+			// a new kion release or a full sync fetches every page
+			for _, opts := range []SyncOptions{{Version: "3.11.0", PageSize: 2}, {Version: "3.10.0", PageSize: 2, Full: true}} {
+				skipped := kion.skipped
+				_, stats, err = SyncInventory(context.Background(), server.URL, "token", resynced, opts)
+				if err != nil || stats.Unchanged != 0 || kion.skipped != skipped {
+					t.Errorf("got %v unchanged pages and error %v syncing with %+v", stats.Unchanged, err, opts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package kion
+
+import (
+	"fmt"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Time                                                                      //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// timestampLayouts are the layouts Kion timestamps have been seen in, tried in
+// order. Layouts without a zone are interpreted as UTC rather than the local
+// timezone so expiry math doesn't shift with the machine's locale.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+// ParseTimestamp parses a timestamp returned by Kion or stored in the cache.
+func ParseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		t, err := time.ParseInLocation(layout, value, time.UTC)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp: %q", value)
+}
+
+// ExpiresAt returns when the session's access token expires.
+func (s Session) ExpiresAt() (time.Time, error) {
+	return ParseTimestamp(s.Access.Expiry)
+}
+
+// RefreshExpiresAt returns when the session's refresh token expires.
+func (s Session) RefreshExpiresAt() (time.Time, error) {
+	return ParseTimestamp(s.Refresh.Expiry)
+}
+
+// Refreshable reports whether the session has a refresh token still valid at
+// now, so it can be refreshed once its access token expires.
+func (s Session) Refreshable(now time.Time) bool {
+	if s.Refresh.Token == "" {
+		return false
+	}
+	expires, err := s.RefreshExpiresAt()
+	return err == nil && expires.After(now)
+}
+
+// ValidFor reports whether the STAK will remain valid for at least d. STAKs
+// generated by this process compare against the monotonic clock so wall clock
+// changes don't cut them short.
+func (s STAK) ValidFor(d time.Duration) bool {
+	return time.Until(s.Expiration) > d
+}
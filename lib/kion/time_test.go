@@ -0,0 +1,188 @@
+package kion
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	// interpret timestamps from a machine in a timezone that observes DST
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = newYork
+	defer func() { time.Local = local }()
+
+	tests := []struct {
+		description string
+		value       string
+		want        time.Time
+		wantErr     bool
+	}{
+		{
+			"RFC3339 UTC",
+			"2024-03-10T07:00:00Z",
+			time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"RFC3339 Offset",
+			"2024-03-10T03:00:00-04:00",
+			time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"Numeric Offset",
+			"2024-03-10T01:00:00-0500",
+			time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"Fractional Seconds",
+			"2024-11-03T05:30:00.123456Z",
+			time.Date(2024, 11, 3, 5, 30, 0, 123456000, time.UTC),
+			false,
+		},
+		{
+			"No Zone Is UTC",
+			"2024-11-03T01:30:00",
+			time.Date(2024, 11, 3, 1, 30, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"No Zone With Space",
+			"2024-11-03 01:30:00",
+			time.Date(2024, 11, 3, 1, 30, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"Garbage",
+			"tomorrow",
+			time.Time{},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseTimestamp(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestampAcrossDST(t *testing.T) {
+	tests := []struct {
+		description string
+		start       string
+		end         string
+		want        time.Duration
+	}{
+		{
+			"Spring Forward",
+			"2024-03-10T01:55:00-0500",
+			"2024-03-10T03:05:00-0400",
+			10 * time.Minute,
+		},
+		{
+			"Fall Back",
+			"2024-11-03T01:55:00-04:00",
+			"2024-11-03T01:05:00-05:00",
+			10 * time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			start, err := ParseTimestamp(test.start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			end, err := ParseTimestamp(test.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := end.Sub(start); got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSTAKValidFor(t *testing.T) {
+	tests := []struct {
+		description string
+		expiration  time.Time
+		buffer      time.Duration
+		want        bool
+	}{
+		{
+			"Valid Beyond Buffer",
+			time.Now().Add(10 * time.Minute),
+			5 * time.Minute,
+			true,
+		},
+		{
+			"Expires Within Buffer",
+			time.Now().Add(2 * time.Minute),
+			5 * time.Minute,
+			false,
+		},
+		{
+			"Already Expired",
+			time.Now().Add(-time.Minute),
+			5 * time.Second,
+			false,
+		},
+		{
+			"Stored In Another Zone",
+			time.Now().Add(10 * time.Minute).In(time.FixedZone("UTC+14", 14*60*60)).Round(0),
+			5 * time.Minute,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := STAK{Expiration: test.expiration}.ValidFor(test.buffer)
+			if got != test.want {
+				t.Errorf("\ngot:\n  %v\nwanted:\n  %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSessionRefreshable(t *testing.T) {
+	now := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		token       string
+		expiry      string
+		want        bool
+	}{
+		{"Valid", "refresh", "2030-01-02T17:00:00Z", true},
+		{"Expired", "refresh", "2030-01-02T08:00:00Z", false},
+		{"No Token", "", "2030-01-02T17:00:00Z", false},
+		{"No Expiry", "refresh", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var session Session
+			session.Refresh.Token = test.token
+			session.Refresh.Expiry = test.expiry
+			if got := session.Refreshable(now); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package kion
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Timing                                                                    //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Phases of a run timed for --profile-perf.
+const (
+	PhaseMetadata = "SAML metadata"
+	PhaseIdP      = "identity provider"
+	PhaseSignIn   = "browser sign in"
+	PhaseKion     = "Kion API"
+	PhaseExternal = "AWS and other services"
+	PhaseCache    = "cache"
+	PhaseInput    = "waiting on input"
+)
+
+// Timings records how long the phases of a run take, so a slow run can be
+// put down to the identity provider, Kion, or the CLI itself. Nothing is
+// recorded until it is set, such as with --profile-perf.
+var Timings *TimingRecorder
+
+// TimingRecorder collects timed spans of a run. Its methods are safe to call
+// on a nil recorder, which records nothing.
+type TimingRecorder struct {
+	start time.Time
+	mu    sync.Mutex
+	spans []timingSpan
+}
+
+// timingSpan is a stretch of a run spent in a phase.
+type timingSpan struct {
+	phase  string
+	detail string
+	start  time.Time
+	end    time.Time
+}
+
+// NewTimingRecorder returns a recorder for a run started at start.
+func NewTimingRecorder(start time.Time) *TimingRecorder {
+	return &TimingRecorder{start: start}
+}
+
+// Time starts timing a span of phase, described by detail, returning the
+// function that ends it.
+func (t *TimingRecorder) Time(phase string, detail string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.Record(phase, detail, start, time.Now())
+	}
+}
+
+// Record adds a span of phase that ran from start to end.
+func (t *TimingRecorder) Record(phase string, detail string, start time.Time, end time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, timingSpan{phase: phase, detail: detail, start: start, end: end})
+}
+
+// PhaseTiming sums up the spans of a phase.
+type PhaseTiming struct {
+	Phase         string
+	Calls         int
+	Total         time.Duration
+	Slowest       time.Duration
+	SlowestDetail string
+}
+
+// TimingBreakdown sums up a run by phase. Spans can overlap, such as
+// requests sent in parallel, so phase totals may add up to more than the run
+// took. Other is the time no span covers, spent in the CLI itself.
+type TimingBreakdown struct {
+	Total  time.Duration
+	Phases []PhaseTiming
+	Other  time.Duration
+}
+
+// Breakdown sums up the spans recorded for a run ending at end, phases
+// ordered by the time spent in them.
+func (t *TimingRecorder) Breakdown(end time.Time) TimingBreakdown {
+	if t == nil {
+		return TimingBreakdown{}
+	}
+	t.mu.Lock()
+	spans := slices.Clone(t.spans)
+	t.mu.Unlock()
+
+	breakdown := TimingBreakdown{Total: end.Sub(t.start)}
+	phases := make(map[string]*PhaseTiming)
+	for _, span := range spans {
+		phase, found := phases[span.phase]
+		if !found {
+			phase = &PhaseTiming{Phase: span.phase}
+			phases[span.phase] = phase
+		}
+		took := span.end.Sub(span.start)
+		phase.Calls++
+		phase.Total += took
+		if took > phase.Slowest {
+			phase.Slowest = took
+			phase.SlowestDetail = span.detail
+		}
+	}
+	for _, phase := range phases {
+		breakdown.Phases = append(breakdown.Phases, *phase)
+	}
+	sort.Slice(breakdown.Phases, func(i, j int) bool {
+		if breakdown.Phases[i].Total != breakdown.Phases[j].Total {
+			return breakdown.Phases[i].Total > breakdown.Phases[j].Total
+		}
+		return breakdown.Phases[i].Phase < breakdown.Phases[j].Phase
+	})
+
+	// time outside every span, merging overlapping spans within the run
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+	covered := time.Duration(0)
+	cursor := t.start
+	for _, span := range spans {
+		start, stop := span.start, span.end
+		if start.Before(cursor) {
+			start = cursor
+		}
+		if stop.After(end) {
+			stop = end
+		}
+		if stop.After(start) {
+			covered += stop.Sub(start)
+			cursor = stop
+		}
+	}
+	breakdown.Other = max(breakdown.Total-covered, 0)
+	return breakdown
+}
+
+// timingPhaseKey keys the phase a request is timed as in its context.
+type timingPhaseKey struct{}
+
+// WithTimingPhase returns ctx marking requests sent with it as phase, rather
+// than the phase of the client sending them.
+func WithTimingPhase(ctx context.Context, phase string) context.Context {
+	return context.WithValue(ctx, timingPhaseKey{}, phase)
+}
+
+// timed returns next wrapped to time the requests it sends as phase when
+// Timings is set, or next as it is otherwise.
+func timed(phase string, next http.RoundTripper) http.RoundTripper {
+	if Timings == nil {
+		return next
+	}
+	return timingTransport{phase: phase, next: next}
+}
+
+// timingTransport times each request sent until its response body has been
+// read or closed.
+type timingTransport struct {
+	phase string
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	phase := t.phase
+	if marked, ok := req.Context().Value(timingPhaseKey{}).(string); ok {
+		phase = marked
+	}
+	stop := Timings.Time(phase, req.Method+" "+req.URL.Host+req.URL.Path)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	resp.Body = &timedBody{ReadCloser: resp.Body, stop: sync.OnceFunc(stop)}
+	return resp, nil
+}
+
+// timedBody ends the span of a request once its body is read or closed.
+type timedBody struct {
+	io.ReadCloser
+	stop func()
+}
+
+// Read implements io.Reader.
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.stop()
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *timedBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,148 @@
+package kion
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimingBreakdown(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(seconds float64) time.Time {
+		return start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	tests := []struct {
+		description string
+		spans       []timingSpan
+		end         time.Time
+		want        TimingBreakdown
+	}{
+		{
+			"No Spans",
+			nil,
+			at(2),
+			TimingBreakdown{Total: 2 * time.Second, Other: 2 * time.Second},
+		},
+		{
+			"Sequential",
+			[]timingSpan{
+				{PhaseKion, "GET kion/api/v3/me", at(1), at(2)},
+				{PhaseIdP, "POST idp/sso", at(2), at(5)},
+				{PhaseKion, "POST kion/api/v3/temporary-credentials", at(5), at(5.5)},
+			},
+			at(6),
+			TimingBreakdown{
+				Total: 6 * time.Second,
+				Phases: []PhaseTiming{
+					{PhaseIdP, 1, 3 * time.Second, 3 * time.Second, "POST idp/sso"},
+					{PhaseKion, 2, 1500 * time.Millisecond, time.Second, "GET kion/api/v3/me"},
+				},
+				Other: 1500 * time.Millisecond,
+			},
+		},
+		{
+			"Overlapping",
+			[]timingSpan{
+				{PhaseExternal, "GET one", at(1), at(3)},
+				{PhaseExternal, "GET two", at(2), at(4)},
+				{PhaseCache, "get stak", at(2.5), at(2.75)},
+			},
+			at(5),
+			TimingBreakdown{
+				Total: 5 * time.Second,
+				Phases: []PhaseTiming{
+					{PhaseExternal, 2, 4 * time.Second, 2 * time.Second, "GET one"},
+					{PhaseCache, 1, 250 * time.Millisecond, 250 * time.Millisecond, "get stak"},
+				},
+				Other: 2 * time.Second,
+			},
+		},
+		{
+			"Past The End",
+			[]timingSpan{
+				{PhaseSignIn, "waiting", at(1), at(10)},
+			},
+			at(4),
+			TimingBreakdown{
+				Total:  4 * time.Second,
+				Phases: []PhaseTiming{{PhaseSignIn, 1, 9 * time.Second, 9 * time.Second, "waiting"}},
+				Other:  time.Second,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			recorder := NewTimingRecorder(start)
+			for _, span := range test.spans {
+				recorder.Record(span.phase, span.detail, span.start, span.end)
+			}
+			got := recorder.Breakdown(test.end)
+			if got.Total != test.want.Total || got.Other != test.want.Other || len(got.Phases) != len(test.want.Phases) {
+				t.Fatalf("\ngot:\n  %+v\nwanted:\n  %+v", got, test.want)
+			}
+			for i := range got.Phases {
+				if got.Phases[i] != test.want.Phases[i] {
+					t.Errorf("\ngot:\n  %+v\nwanted:\n  %+v", got.Phases[i], test.want.Phases[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTimingNil(t *testing.T) {
+	var recorder *TimingRecorder
+	recorder.Time(PhaseKion, "GET kion/api/v3/me")()
+	recorder.Record(PhaseKion, "GET kion/api/v3/me", time.Now(), time.Now())
+	got := recorder.Breakdown(time.Now())
+	if got.Total != 0 || len(got.Phases) != 0 {
+		t.Errorf("got %+v from a nil recorder, wanted nothing", got)
+	}
+
+	next := http.DefaultTransport
+	if timed(PhaseKion, next) != next {
+		t.Error("wrapped the transport with no recorder set")
+	}
+}
+
+func TestTimingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	Timings = NewTimingRecorder(time.Now())
+	defer func() { Timings = nil }()
+	client := &http.Client{Transport: timed(PhaseIdP, http.DefaultTransport)}
+
+	// one request timed as the client's phase, one marked as metadata
+	for _, ctx := range []context.Context{context.Background(), WithTimingPhase(context.Background(), PhaseMetadata)} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/sso", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	got := Timings.Breakdown(time.Now())
+	if len(got.Phases) != 2 {
+		t.Fatalf("got phases %+v, wanted 2", got.Phases)
+	}
+	for _, phase := range got.Phases {
+		if phase.Phase != PhaseIdP && phase.Phase != PhaseMetadata || phase.Calls != 1 {
+			t.Errorf("got phase %+v, wanted one call each of the client's and the marked phase", phase)
+		}
+		if phase.SlowestDetail != "GET "+server.Listener.Addr().String()+"/sso" {
+			t.Errorf("got detail %q", phase.SlowestDetail)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package kion
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	bundle := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.pem")
+	err = os.WriteFile(empty, []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description  string
+		caBundle     string
+		certFile     string
+		keyFile      string
+		insecure     bool
+		wantNil      bool
+		wantInsecure bool
+		wantErr      string
+	}{
+		{"Defaults", "", "", "", false, true, false, ""},
+		{"CA Bundle", bundle, "", "", false, false, false, ""},
+		{"Insecure", "", "", "", true, false, true, ""},
+		{"Missing Bundle", filepath.Join(dir, "missing.pem"), "", "", false, false, false, "unable to read the CA bundle"},
+		{"Empty Bundle", empty, "", "", false, false, false, "no PEM certificates found"},
+		{"Certificate Without Key", "", bundle, "", false, false, false, "must be set together"},
+		{"Invalid Client Certificate", "", empty, empty, false, false, false, "unable to load the client certificate"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			config, err := LoadTLSConfig(test.caBundle, test.certFile, test.keyFile, test.insecure)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got %v, wanted an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (config == nil) != test.wantNil {
+				t.Fatalf("got %+v", config)
+			}
+			if config != nil && config.InsecureSkipVerify != test.wantInsecure {
+				t.Errorf("got InsecureSkipVerify %v", config.InsecureSkipVerify)
+			}
+		})
+	}
+}
+
+func TestSetTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":200,"data":"3.10.0"}`)
+	}))
+	defer server.Close()
+	defer SetTLSConfig(nil)
+	// an unknown CA is refused, without retrying
+	_, err := GetVersion(server.URL)
+	if !IsCertificateError(err) {
+		t.Errorf("got %v, wanted a certificate error", err)
+	}
+
+	// trusted once in the CA bundle
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadTLSConfig(bundle, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTLSConfig(config)
+	version, err := GetVersion(server.URL)
+	if err != nil || version != "3.10.0" {
+		t.Errorf("got %q, %v with the CA bundle", version, err)
+	}
+	res, err := idpClient().Get(server.URL)
+	if err != nil {
+		t.Errorf("got %v from an identity provider with the CA bundle", err)
+	} else {
+		res.Body.Close()
+	}
+}
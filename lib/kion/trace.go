@@ -0,0 +1,220 @@
+package kion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Tracing                                                                   //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// Log traces what the CLI does for troubleshooting: requests to Kion and
+// identity providers, SAML sign in steps, and cache lookups at info level,
+// with the headers and bodies of requests and responses at debug level.
+// Secrets are redacted before anything is logged. Nothing is logged until it
+// is replaced, such as with --verbose or --debug.
+var Log = slog.New(discardHandler{})
+
+// maxTracedBody is how much of a request or response body is logged, the
+// rest is summarized by its length.
+const maxTracedBody = 4096
+
+// discardHandler is a slog.Handler logging nothing at any level.
+type discardHandler struct{}
+
+// Enabled implements slog.Handler.
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle implements slog.Handler.
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs implements slog.Handler.
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+// WithGroup implements slog.Handler.
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
+
+// traced returns next wrapped to log the requests it sends when Log is
+// enabled, or next as it is otherwise.
+func traced(next http.RoundTripper) http.RoundTripper {
+	if !Log.Enabled(context.Background(), slog.LevelInfo) {
+		return next
+	}
+	return traceTransport{next: next}
+}
+
+// traceTransport logs each request sent and the response to it.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	debug := Log.Enabled(ctx, slog.LevelDebug)
+	target := tracedURL(req.URL)
+	if debug {
+		// read a copy of the body as the request must be left as it is
+		body := "[not shown]"
+		if req.Body == nil || req.Body == http.NoBody {
+			body = ""
+		} else if req.GetBody != nil {
+			if copied, err := req.GetBody(); err == nil {
+				data, _ := io.ReadAll(copied)
+				copied.Close()
+				body = tracedBody(data)
+			}
+		}
+		Log.Debug("sending request", "method", req.Method, "url", target, "headers", redactHeaders(req.Header), "body", body)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		Log.Info("request failed", "method", req.Method, "url", target, "duration", duration, "error", err)
+		return nil, err
+	}
+	Log.Info("request", "method", req.Method, "url", target, "status", resp.StatusCode, "duration", duration)
+
+	if debug {
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		Log.Debug("received response", "method", req.Method, "url", target, "headers", redactHeaders(resp.Header), "body", tracedBody(data))
+	}
+	return resp, nil
+}
+
+// tracedURL returns a URL to log, with secret query parameters redacted.
+func tracedURL(u *url.URL) string {
+	return fmt.Sprintf("%v://%v%v", u.Scheme, u.Host, redactURL(u))
+}
+
+// tracedBody returns a body to log, redacted as recorded bodies are and cut
+// short after maxTracedBody bytes.
+func tracedBody(body []byte) string {
+	redacted := redactBody(body)
+	if len(redacted) > maxTracedBody {
+		return fmt.Sprintf("%v... (%v more bytes)", redacted[:maxTracedBody], len(redacted)-maxTracedBody)
+	}
+	return redacted
+}
+
+// redactHeaders returns headers to log, with those carrying credentials such
+// as Authorization and cookies redacted.
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var parts []string
+	for _, name := range names {
+		value := strings.Join(header.Values(name), ", ")
+		switch {
+		case strings.EqualFold(name, "Authorization"):
+			scheme, _, _ := strings.Cut(value, " ")
+			value = scheme + " " + redactedValue
+		case strings.EqualFold(name, "Cookie"), strings.EqualFold(name, "Set-Cookie"), secretName.MatchString(name):
+			value = redactedValue
+		default:
+			value = secretCodeParam.ReplaceAllString(value, "${1}"+url.QueryEscape(redactedValue))
+		}
+		parts = append(parts, fmt.Sprintf("%v: %v", name, value))
+	}
+	return strings.Join(parts, "; ")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Redaction                                                                 //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// redactedValue replaces secret values in recorded interactions and traces.
+const redactedValue = "[redacted]"
+
+// secretName matches the names of JSON fields, form fields, query parameters,
+// and headers holding secrets, which are redacted when recording or tracing.
+var secretName = regexp.MustCompile(`(?i)token|password|secret|access_key|api_key|samlresponse|assertion|^code$`)
+
+// secretCodeParam matches codes in links, such as the SSO code in the page
+// Kion returns from the SAML callback.
+var secretCodeParam = regexp.MustCompile(`([?&]code=)[^"&'<\s]+`)
+
+// redactURL returns the path and query of a URL with secret query
+// parameters redacted.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	for name := range query {
+		if secretName.MatchString(name) {
+			query[name] = []string{redactedValue}
+		}
+	}
+	redacted := u.EscapedPath()
+	if len(query) > 0 {
+		redacted += "?" + query.Encode()
+	}
+	return redacted
+}
+
+// redactBody redacts secret fields of a JSON or form encoded body.
+// Other bodies are kept as they are.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var parsed interface{}
+	if json.Unmarshal(body, &parsed) == nil {
+		data, err := json.Marshal(redactJSON(parsed))
+		if err == nil {
+			return string(data)
+		}
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil && strings.Contains(string(body), "=") && !strings.ContainsAny(string(body), " <\n") {
+		for name := range form {
+			if secretName.MatchString(name) {
+				form[name] = []string{redactedValue}
+			}
+		}
+		return form.Encode()
+	}
+	return secretCodeParam.ReplaceAllString(string(body), "${1}"+url.QueryEscape(redactedValue))
+}
+
+// redactJSON redacts the values of secret fields in decoded JSON.
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if _, isString := child.(string); isString && secretName.MatchString(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactJSON(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactJSON(child)
+		}
+	}
+	return value
+}
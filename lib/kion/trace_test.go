@@ -0,0 +1,77 @@
+package kion
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-secret"})
+		_, _ = w.Write([]byte(`{"status": 200, "data": {"access_key": "AKIA-secret", "secret_access_key": "key-secret", "duration": 3600}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		level       slog.Level
+		want        []string
+		wantNot     []string
+	}{
+		{
+			"Verbose",
+			slog.LevelInfo,
+			[]string{"msg=request", "method=POST", "status=200", "/api/v3/temporary-credentials?api_key=%5Bredacted%5D"},
+			[]string{"sending request", "received response"},
+		},
+		{
+			"Debug",
+			slog.LevelDebug,
+			[]string{"sending request", "received response", "Authorization: Bearer [redacted]", `\"password\":\"[redacted]\"`, `\"duration\":3600`, "Set-Cookie: [redacted]"},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out bytes.Buffer
+			defer func(log *slog.Logger) { Log = log }(Log)
+			Log = slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: test.level}))
+
+			client := NewClient()
+			_, _, err := client.Query(context.Background(), "POST", server.URL+"/api/v3/temporary-credentials?api_key=app_123", "bearer-secret", nil, map[string]string{"user": "jane", "password": "hunter2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logged := out.String()
+			for _, secret := range []string{"app_123", "bearer-secret", "hunter2", "AKIA-secret", "key-secret", "cookie-secret"} {
+				if strings.Contains(logged, secret) {
+					t.Errorf("logged %q:\n%v", secret, logged)
+				}
+			}
+			for _, want := range test.want {
+				if !strings.Contains(logged, want) {
+					t.Errorf("wanted %q logged:\n%v", want, logged)
+				}
+			}
+			for _, wantNot := range test.wantNot {
+				if strings.Contains(logged, wantNot) {
+					t.Errorf("didn't want %q logged:\n%v", wantNot, logged)
+				}
+			}
+		})
+	}
+}
+
+func TestTraceDisabled(t *testing.T) {
+	next := http.DefaultTransport
+	if got := traced(next); got != next {
+		t.Errorf("got %T, wanted the transport untraced when Log is off", got)
+	}
+}
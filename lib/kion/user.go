@@ -0,0 +1,49 @@
+package kion
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Users                                                                     //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// UserResponse maps to the Kion API response.
+type UserResponse struct {
+	Status int  `json:"status"`
+	User   User `json:"data"`
+}
+
+// User maps to the Kion API response for users.
+type User struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// GetCurrentUser queries the Kion API for the user a token belongs to, which
+// also confirms Kion accepts the token.
+func GetCurrentUser(host string, token string) (User, error) {
+	// build our query and get response
+	url := fmt.Sprintf("%v/api/v3/me", host)
+	query := map[string]string{}
+	var data interface{}
+	resp, _, err := runQuery("GET", url, token, query, data)
+	if err != nil {
+		return User{}, err
+	}
+
+	// unmarshal response body
+	userResp := UserResponse{}
+	err = json.Unmarshal(resp, &userResp)
+	if err != nil {
+		return User{}, err
+	}
+
+	return userResp.User, nil
+}
@@ -0,0 +1,49 @@
+package kion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetCurrentUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/me" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer app_1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status": 401, "message": "invalid token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": 200, "data": {"id": 7, "username": "ci-bot", "email": "ci@example.com"}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		token       string
+		want        User
+		wantStatus  int
+	}{
+		{"Accepted", "app_1", User{ID: 7, Username: "ci-bot", Email: "ci@example.com"}, 0},
+		{"Revoked", "app_2", User{}, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := GetCurrentUser(server.URL, test.token)
+			if test.wantStatus != 0 {
+				if !IsStatus(err, test.wantStatus) {
+					t.Fatalf("got error %v, wanted status %v", err, test.wantStatus)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, wanted %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,37 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/99designs/keyring"
-	"github.com/hashicorp/go-version"
 	"github.com/kionsoftware/kion-cli/lib/cache"
+	"github.com/kionsoftware/kion-cli/lib/export"
+	"github.com/kionsoftware/kion-cli/lib/filesystem"
 	"github.com/kionsoftware/kion-cli/lib/helper"
 	"github.com/kionsoftware/kion-cli/lib/kion"
 	"github.com/kionsoftware/kion-cli/lib/structs"
@@ -30,11 +50,176 @@ import (
 var (
 	config     structs.Configuration
 	configPath string
-	configFile = ".kion.yml"
+
+	// paths are where files are kept, see helper.DefaultPaths
+	paths helper.Paths
+
+	// cassette records or replays requests to Kion when KION_CASSETTE is set
+	cassette *kion.Cassette
+
+	// managedConfig holds the settings locked by the organization, if any
+	managedConfig *helper.ManagedConfig
+
+	// managedFlagKeys are the settings global flags set, checked against the
+	// managed configuration
+	managedFlagKeys = map[string]string{
+		"endpoint":           "kion.url",
+		"user":               "kion.username",
+		"password":           "kion.password",
+		"idms":               "kion.idms_id",
+		"saml-metadata-file": "kion.saml_metadata_file",
+		"saml-sp-issuer":     "kion.saml_sp_issuer",
+		"saml-callback-port": "kion.saml_callback_port",
+		"token":              "kion.api_key",
+		"disable-cache":      "kion.disable_cache",
+		"keyring-backend":    "kion.keyring.backend",
+		"browser":            "kion.browser",
+		"no-browser":         "kion.no_browser",
+		"ca-bundle":          "api.ca_bundle",
+		"client-cert":        "api.client_cert_file",
+		"client-key":         "api.client_key_file",
+		"insecure":           "api.insecure_skip_verify",
+	}
 
 	c cache.Cache
 
-	kionCliVersion string
+	// cacheBackend describes where the cache is kept, such as the keyring
+	// backend opened, shown by whoami
+	cacheBackend string
+
+	// keyLockDir holds the locks concurrent runs take to fetch the same keys
+	// once, within cacheNamespace, unset when the cache isn't written
+	keyLockDir     string
+	cacheNamespace string
+
+	// dryRun reports side effects rather than performing them
+	dryRun bool
+
+	// debugSAML prints the SAML response received when signing in with SAML
+	debugSAML bool
+
+	// refreshMetadata downloads SAML metadata rather than using a cached copy
+	refreshMetadata bool
+
+	// refreshInventory fetches the inventory behind the pickers rather than
+	// reusing a freshly cached one
+	refreshInventory bool
+
+	// outputFormat is the format results are written in, see
+	// helper.OutputFormats
+	outputFormat string
+
+	// stdout is where results and other text meant for the user are written,
+	// restricted to ASCII by --ascii for formats other than json, yaml, and env
+	stdout io.Writer = os.Stdout
+
+	// structuredCommands can write their results in every output format
+	structuredCommands = []string{"stak", "favorite", "favorite list", "whoami", "status", "cache list", "paths", "pin", "bulk", "reconcile", "list projects", "list accounts", "list cars"}
+
+	// machineOutputs are the shapes of the JSON written by machine facing
+	// commands, every structured command and credential-process, described
+	// by their --schema flag
+	machineOutputs = map[string]any{
+		"stak":               helper.STAKOutput{},
+		"favorite":           helper.STAKOutput{},
+		"favorite list":      []helper.FavoriteOutput{},
+		"whoami":             helper.Identity{},
+		"status":             helper.Status{},
+		"cache list":         []helper.CacheEntryOutput{},
+		"paths":              []helper.PathOutput{},
+		"pin":                []helper.PinOutput{},
+		"bulk":               map[string]helper.STAKOutput{},
+		"reconcile":          []helper.Drift{},
+		"list projects":      []helper.ProjectOutput{},
+		"list accounts":      []helper.AccountOutput{},
+		"list cars":          []helper.CAROutput{},
+		"credential-process": helper.CredentialProcessOutput{},
+	}
+
+	// auditPath is the local log of cloud access role usage
+	auditPath string
+
+	// started is when the command began, audit entries note the time since
+	started = time.Now()
+
+	// issuedDuration is how long the short-term access keys issued by Kion
+	// during this run are valid for, checked for unusual access
+	issuedDuration time.Duration
+
+	// elevationReason and elevatedUntil are why elevated access was taken
+	// with kion elevate and when it ends, noted in the audit log
+	elevationReason string
+	elevatedUntil   time.Time
+
+	// browserSessionsPath tracks the account each browser profile was last
+	// federated into
+	browserSessionsPath string
+
+	// supportDir holds support bundles such as federation captures
+	supportDir string
+
+	// quotaPath keeps the request quota each Kion instance last reported, for
+	// the status command
+	quotaPath string
+
+	// stakPacer spaces out requests for short-term access keys once Kion
+	// reports its rate limit is close to being reached
+	stakPacer = helper.NewQuotaPacer(func(wait time.Duration) {
+		fmt.Fprintln(os.Stderr, color.YellowString("Kion's rate limit is nearly reached, waiting %v before requesting more short-term access keys", wait.Round(time.Second)))
+	})
+
+	// migrationOffered is true when outdated configuration was shown to the
+	// user at startup, whether or not they chose to apply the changes
+	migrationOffered bool
+
+	// deprecationWarnings warns once about each deprecated flag or
+	// configuration setting used
+	deprecationWarnings = helper.NewDeprecationWarnings(os.Stderr)
+
+	// sessionToken is true when the api token in use was obtained from a Kion
+	// session rather than provided by the user
+	sessionToken bool
+
+	// apiKeyChecked is true once an api key provided by the user has been
+	// accepted by Kion this run
+	apiKeyChecked bool
+
+	kionCliVersion   string
+	kionCliPublicKey string
+
+	// offlineCommands do not interact with Kion and skip endpoint, version, and
+	// cache setup
+	offlineCommands = []string{"help", "h", "verify", "about", "config", "scrub-history", "shell-init", "paths", "completion", "pin", "unpin", "profiles"}
+
+	// localCommands only need the configuration of the selected profile and
+	// skip endpoint and cache setup
+	localCommands = []string{"aws-config", "try-url", "debug", "saml", "support-bundle", "update", "doctor"}
+
+	// defaultOutageRetry is how long requests for short-term access keys are
+	// retried while Kion is unreachable unless kion.outage_retry is set
+	defaultOutageRetry = 2 * time.Minute
+
+	// outageFallbackValidity is how long cached short-term access keys must
+	// still be valid for to be used in place of new ones while Kion is
+	// unreachable or in maintenance
+	outageFallbackValidity = time.Minute
+
+	// defaultInventoryMaxAge is how long a cached inventory is reused by the
+	// pickers unless kion.inventory_max_age is set
+	defaultInventoryMaxAge = 5 * time.Minute
+
+	// accountRegionMaxAge is how long the default region read from an
+	// account's labels is reused before reading them again
+	accountRegionMaxAge = 24 * time.Hour
+
+	// defaultOrgMetadataMaxAge is how long account tags read from AWS
+	// Organizations are reused unless kion.org_metadata.max_age is set
+	defaultOrgMetadataMaxAge = 24 * time.Hour
+
+	// mfaPushTimeout is how long a push notification sent when signing in
+	// with a password is waited on, checking every mfaPollInterval
+	mfaPushTimeout  = 2 * time.Minute
+	mfaPollInterval = 2 * time.Second
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -57,25 +242,114 @@ func setEndpoint() error {
 	return nil
 }
 
+// authMethods maps the kion.auth_method setting to the authenticator it names.
+var authMethods = map[string]string{
+	"api_key":  "API Key",
+	"password": "Password",
+	"saml":     "SAML",
+}
+
+// registerAuthenticators makes the built in authentication methods available
+// by name, in the order they are offered when prompting.
+func registerAuthenticators() error {
+	builtins := []struct {
+		name string
+		auth kion.AuthenticatorFunc
+	}{
+		{"API Key", AuthAPIKey},
+		{"Password", AuthUNPW},
+		{"SAML", AuthSAML},
+	}
+	for _, builtin := range builtins {
+		err := kion.RegisterAuthenticator(builtin.name, builtin.auth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authenticate runs the named authenticator, caches the resulting session,
+// and sets the context token. Sessions without an expiry, such as user
+// provided API keys, are used as is and not cached.
+func authenticate(name string) error {
+	authenticator, found := kion.LookupAuthenticator(name)
+	if !found {
+		return fmt.Errorf("unknown authentication method: %v", name)
+	}
+
+	// make sure we're on the private network before sending credentials
+	err := checkPrivateLink()
+	if err != nil {
+		return err
+	}
+
+	session, err := authenticator.Authenticate(config.Kion.Url)
+	if err != nil {
+		return err
+	}
+
+	// set our token in the config
+	config.Kion.ApiKey = session.Access.Token
+	if session.Access.Expiry == "" {
+		return nil
+	}
+	session = identifySession(session)
+
+	err = c.SetSession(session)
+	if err != nil {
+		return err
+	}
+	sessionToken = true
+	return nil
+}
+
+// AuthAPIKey prompts for an API key if one was not provided.
+func AuthAPIKey(host string) (kion.Session, error) {
+	var session kion.Session
+	apiKey := config.Kion.ApiKey
+	if apiKey == "" {
+		var err error
+		apiKey, err = helper.PromptPassword("API Key:")
+		if err != nil {
+			return session, err
+		}
+	}
+	_, err := kion.GetCurrentUser(host, apiKey)
+	if kion.IsStatus(err, 401) {
+		return session, fmt.Errorf("kion rejected the api key, it may have expired or been revoked: %w", err)
+	}
+	apiKeyChecked = err == nil
+	session.Access.Token = apiKey
+	return session, nil
+}
+
 // AuthUNPW prompts for any missing credentials then auths the users against
-// Kion, stores the session data, and sets the context token.
-func AuthUNPW(cCtx *cli.Context) error {
-	var err error
+// Kion and returns the session.
+func AuthUNPW(host string) (kion.Session, error) {
+	var session kion.Session
 	un := config.Kion.Username
 	pw := config.Kion.Password
-	idmsID := cCtx.Uint("idms")
 
-	// prompt idms if needed
+	// use the idms if given, else prompt for it
+	var idmsID uint
+	if config.Kion.IDMS != "" {
+		id, err := strconv.ParseUint(config.Kion.IDMS, 10, 0)
+		if err != nil {
+			return session, fmt.Errorf("invalid idms id: %v", config.Kion.IDMS)
+		}
+		idmsID = uint(id)
+	}
 	if idmsID == 0 {
-		idmss, err := kion.GetIDMSs(config.Kion.Url)
+		idmss, err := kion.GetIDMSs(host)
 		if err != nil {
-			return err
+			return session, err
 		}
 		iNames, iMap := helper.MapIDMSs(idmss)
 		if len(iNames) > 1 {
 			idms, err := helper.PromptSelect("Select Login IDMS:", iNames)
 			if err != nil {
-				return err
+				return session, err
 			}
 			idmsID = iMap[idms].ID
 		} else {
@@ -84,10 +358,11 @@ func AuthUNPW(cCtx *cli.Context) error {
 	}
 
 	// prompt username if needed
+	var err error
 	if un == "" {
 		un, err = helper.PromptInput("Username:")
 		if err != nil {
-			return err
+			return session, err
 		}
 	}
 
@@ -95,31 +370,220 @@ func AuthUNPW(cCtx *cli.Context) error {
 	if pw == "" {
 		pw, err = helper.PromptPassword("Password:")
 		if err != nil {
-			return err
+			return session, err
 		}
 	}
 
 	// auth and capture our session
-	session, err := kion.Authenticate(config.Kion.Url, idmsID, un, pw)
+	session, err = kion.Authenticate(host, idmsID, un, pw)
+	var mfaErr *kion.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		session, err = completeMFA(host, mfaErr.Challenge)
+	}
 	if err != nil {
-		return err
+		return session, err
 	}
 	session.IDMSID = idmsID
 	session.UserName = un
-	err = c.SetSession(session)
-	if err != nil {
-		return err
+
+	return session, nil
+}
+
+// completeMFA answers the second factor the IDMS asks for when signing in
+// with a password, prompting for a one-time code, asked for again a few times
+// when rejected, or waiting for a push notification to be approved.
+func completeMFA(host string, challenge kion.MFAChallenge) (kion.Session, error) {
+	if challenge.Method == kion.MFAMethodTOTP && !helper.IsInteractive() {
+		return kion.Session{}, fmt.Errorf("%w, sign in from a terminal to enter the code", &kion.MFARequiredError{Challenge: challenge})
+	}
+	if challenge.Message != "" {
+		fmt.Fprintln(os.Stderr, challenge.Message)
 	}
 
-	// set our token in the config
-	config.Kion.ApiKey = session.Access.Token
-	return nil
+	// push notifications are polled until approved, denied, or given up on
+	if challenge.Method == kion.MFAMethodPush {
+		var session kion.Session
+		err := helper.WithProgress(context.Background(), "Waiting for the push notification to be approved", func(p *helper.Progress) error {
+			deadline := time.Now().Add(mfaPushTimeout)
+			p.SetDeadline(deadline)
+			for {
+				var err error
+				session, err = kion.VerifyMFA(host, challenge, "")
+				if !errors.Is(err, kion.ErrMFAPending) {
+					return err
+				}
+				if time.Now().After(deadline) {
+					return fmt.Errorf("the push notification was not approved within %v", mfaPushTimeout)
+				}
+				select {
+				case <-p.Context().Done():
+					return p.Context().Err()
+				case <-time.After(mfaPollInterval):
+				}
+			}
+		})
+		return session, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := helper.PromptInput("Verification Code:")
+		if err != nil {
+			return kion.Session{}, err
+		}
+		session, err := kion.VerifyMFA(host, challenge, strings.ReplaceAll(code, " ", ""))
+		if err == nil {
+			return session, nil
+		}
+		if attempt == 3 {
+			return kion.Session{}, err
+		}
+		fmt.Fprintf(os.Stderr, "%v, try again.\n", err)
+	}
+}
+
+// readSAMLMetadata loads identity provider metadata from a url or file.
+// Downloaded metadata is cached until it expires, and when it can't be
+// downloaded a cached copy still valid is used with a warning.
+func readSAMLMetadata(source string) (*samlTypes.EntityDescriptor, error) {
+	if !strings.HasPrefix(source, "http") {
+		return kion.ReadSAMLMetadataFile(source)
+	}
+	if c == nil {
+		return kion.DownloadSAMLMetadata(source)
+	}
+
+	var cached *kion.CachedSAMLMetadata
+	found, ok, err := c.GetSAMLMetadata(source)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cached = &found
+	}
+	metadata, updated, err := kion.FetchSAMLMetadata(source, cached, refreshMetadata, time.Now())
+	var stale *kion.StaleSAMLMetadataError
+	switch {
+	case errors.As(err, &stale):
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return metadata, nil
+	case err != nil:
+		return nil, err
+	}
+	if cached == nil || !reflect.DeepEqual(*cached, updated) {
+		err = c.SetSAMLMetadata(source, updated)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
 }
 
 // AuthSAML directs the user to authenticate via SAML in a web browser.
 // The SAML assertion is posted to this app which is forwarded to Kion and
-// exchanged for the context token.
-func AuthSAML() error {
+// exchanged for a session.
+func AuthSAML(host string) (kion.Session, error) {
+	var session kion.Session
+	samlMetadataFile, samlServiceProviderIssuer, err := samlSettings()
+	if err != nil {
+		return session, err
+	}
+	samlMetadata, err := readSAMLMetadata(samlMetadataFile)
+	if err != nil {
+		return session, err
+	}
+
+	// describe the response from the identity provider if asked to
+	if debugSAML {
+		expect := helper.SAMLExpectations{Issuer: samlMetadata.EntityID, Audience: samlServiceProviderIssuer}
+		kion.SAMLDebug = func(samlResponse []byte) {
+			assertion, err := kion.InspectSAMLResponse(samlResponse, samlMetadata)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: unable to inspect the SAML response: %v\n", err)
+				return
+			}
+			fmt.Fprintln(os.Stderr, "SAML response received:")
+			helper.PrintSAMLAssertion(os.Stderr, assertion, expect, time.Now())
+		}
+	}
+
+	err = loadSAMLSigningKey()
+	if err != nil {
+		return session, err
+	}
+	err = configureSAMLCallback()
+	if err != nil {
+		return session, err
+	}
+
+	timeout, err := samlTimeout()
+	if err != nil {
+		return session, err
+	}
+
+	// wait for the sign in until it times out or is interrupted, shutting down
+	// the callback either way
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	p := helper.StartProgress("Waiting for SAML sign in to complete in your browser")
+	if deadline, ok := ctx.Deadline(); ok {
+		p.SetDeadline(deadline)
+	}
+	kion.SAMLOutput = p.Writer()
+	authData, err := kion.AuthenticateSAML(ctx, host, samlMetadata, samlServiceProviderIssuer)
+	p.Stop()
+	kion.SAMLOutput = os.Stderr
+	switch {
+	case errors.Is(err, context.Canceled):
+		return session, helper.ErrCanceled
+	case (errors.Is(err, kion.ErrMetadataInvalid) || errors.Is(err, kion.ErrSAMLSignature)) && strings.HasPrefix(samlMetadataFile, "http") && !refreshMetadata:
+		// cached metadata may predate a change at the identity provider, such
+		// as a new signing certificate
+		fmt.Fprintf(os.Stderr, "Warning: %v, downloading the SAML metadata again\n", err)
+		refreshMetadata = true
+		return AuthSAML(host)
+	case errors.Is(err, kion.ErrCallbackTimeout):
+		return session, fmt.Errorf("%w after %v, sign in again and complete it in the browser, or raise kion.saml_timeout", err, timeout)
+	case errors.Is(err, kion.ErrIDPRejected):
+		return session, fmt.Errorf("%w, check with your identity provider's administrators that you are assigned to Kion", err)
+	case err != nil:
+		return session, err
+	}
+
+	// expire the session after 9.5 minutes, tokens are valid for 10 minutes,
+	// keeping the refresh token to renew it with
+	session.Access.Token = authData.AuthToken
+	session.Access.Expiry = time.Now().Add(570 * time.Second).Format(time.RFC3339)
+	session.Refresh.Token = authData.Refresh.Token
+	session.Refresh.Expiry = authData.Refresh.Expiry
+
+	return session, nil
+}
+
+// defaultSAMLTimeout is how long a SAML sign in is waited on unless
+// kion.saml_timeout is set.
+const defaultSAMLTimeout = 2 * time.Minute
+
+// samlTimeout returns how long to wait for a SAML sign in to complete in the
+// browser, zero to wait indefinitely.
+func samlTimeout() (time.Duration, error) {
+	if config.Kion.SamlTimeout == "" {
+		return defaultSAMLTimeout, nil
+	}
+	timeout, err := time.ParseDuration(config.Kion.SamlTimeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid kion.saml_timeout %q, expected a duration such as 5m", config.Kion.SamlTimeout)
+	}
+	return timeout, nil
+}
+
+// samlSettings returns the SAML metadata source and service provider issuer
+// configured, prompting for those that aren't.
+func samlSettings() (string, string, error) {
 	var err error
 	samlMetadataFile := config.Kion.SamlMetadataFile
 	samlServiceProviderIssuer := config.Kion.SamlIssuer
@@ -128,7 +592,7 @@ func AuthSAML() error {
 	if samlMetadataFile == "" {
 		samlMetadataFile, err = helper.PromptInput("SAML Metadata URL:")
 		if err != nil {
-			return err
+			return "", "", err
 		}
 	}
 
@@ -136,766 +600,7501 @@ func AuthSAML() error {
 	if samlServiceProviderIssuer == "" {
 		samlServiceProviderIssuer, err = helper.PromptInput("SAML Service Provider Issuer:")
 		if err != nil {
-			return err
+			return "", "", err
 		}
 	}
+	return samlMetadataFile, samlServiceProviderIssuer, nil
+}
 
-	var samlMetadata *samlTypes.EntityDescriptor
-	if strings.HasPrefix(samlMetadataFile, "http") {
-		samlMetadata, err = kion.DownloadSAMLMetadata(samlMetadataFile)
-		if err != nil {
-			return err
+// loadSAMLSigningKey loads the key SAML requests are signed with, leaving
+// requests unsigned when none is configured.
+func loadSAMLSigningKey() error {
+	var err error
+
+	// sign requests for identity providers that require it
+	kion.SAMLSigningKeyStore = nil
+	if config.Kion.SamlSPKeyFile != "" || config.Kion.SamlSPCertFile != "" {
+		if config.Kion.SamlSPKeyFile == "" || config.Kion.SamlSPCertFile == "" {
+			return errors.New("kion.saml_sp_key_file and kion.saml_sp_cert_file must be set together")
 		}
-	} else {
-		samlMetadata, err = kion.ReadSAMLMetadataFile(samlMetadataFile)
+		kion.SAMLSigningKeyStore, err = kion.LoadSAMLKeyPair(config.Kion.SamlSPKeyFile, config.Kion.SamlSPCertFile)
 		if err != nil {
 			return err
 		}
 	}
-
-	authData, err := kion.AuthenticateSAML(
-		config.Kion.Url,
-		samlMetadata,
-		samlServiceProviderIssuer)
-	if err != nil {
-		return err
-	}
-
-	// cache the session for 9.5 minutes, tokens are valid for 10 minutes
-	timeFormat := "2006-01-02T15:04:05-0700"
-	session := kion.Session{
-		Access: struct {
-			Expiry string `json:"expiry"`
-			Token  string `json:"token"`
-		}{
-			Token:  authData.AuthToken,
-			Expiry: time.Now().Add(570 * time.Second).Format(timeFormat),
-		},
-	}
-	err = c.SetSession(session)
-	if err != nil {
-		return err
-	}
-
-	// set our token in the config
-	config.Kion.ApiKey = authData.AuthToken
 	return nil
 }
 
-// setAuthToken sets the token to be used for querying the Kion API. If not
-// passed to the tool as an argument, set in the env, or present in the
-// configuration dotfile it will prompt the users to authenticate. Auth methods
-// are prioritized as follows: api/bearer token -> username/password -> saml.
-// If flags are set for multiple methods the highest priority method will be
-// used.
-func setAuthToken(cCtx *cli.Context) error {
-	if config.Kion.ApiKey == "" {
-		// if we still have an active session use it
-		session, found, err := c.GetSession()
+// configureSAMLCallback sets where the SAML callback listens, whether it is
+// served over HTTPS, and how the sign in is started and opened.
+func configureSAMLCallback() error {
+	var err error
+
+	// listen for the response from the identity provider where configured
+	kion.SAMLCallbackAddress = "127.0.0.1"
+	if config.Kion.SamlCallbackAddr != "" {
+		kion.SAMLCallbackAddress = config.Kion.SamlCallbackAddr
+	}
+	kion.SAMLCallbackPorts = nil
+	if config.Kion.SamlCallbackPort != "" {
+		kion.SAMLCallbackPorts, err = kion.ParseSAMLCallbackPorts(config.Kion.SamlCallbackPort)
 		if err != nil {
 			return err
 		}
-		if found && session.Access.Expiry != "" {
-			timeFormat := "2006-01-02T15:04:05-0700"
-			now := time.Now()
-			expiration, err := time.Parse(timeFormat, session.Access.Expiry)
-			if err != nil {
-				return err
-			}
-			if expiration.After(now) {
-				// TODO: test token is good with an endpoint that is accessible to all
-				// user permission levels, if you get a 401 then assume token is bad
-				// due to caching a cred when a users password expired, and flush the
-				// cache instead...
-				config.Kion.ApiKey = session.Access.Token
-				return nil
-			}
-
-			// TODO: uncomment when / if the application supports refresh tokens
-
-			// // see if we can use the refresh token
-			// refreshExp, err := time.Parse(timeFormat, session.Refresh.Expiry)
-			// if err != nil {
-			// 	return err
-			// }
-
-			// if refreshExp.After(now) {
-			// 	un := session.UserName
-			// 	idmsId := session.IDMSID
-			// 	session, err = kion.Authenticate(config.Kion.Url, idmsId, un, session.Refresh.Token)
-			// 	if err != nil {
-			// 		return err
-			// 	}
-			// 	session.UserName = un
-			// 	session.IDMSID = idmsId
-			// 	err = c.SetSession(session)
-			// 	if err != nil {
-			// 		return err
-			// 	}
-
-			//  config.Kion.ApiKey = session.Access.Token
-			// 	return nil
-			// }
-		}
+	}
 
-		// check un / pw were set via flags and infer auth method
-		if config.Kion.Username != "" || config.Kion.Password != "" {
-			err := AuthUNPW(cCtx)
+	// post back to a registered host name in place of localhost, which has to
+	// resolve to this machine or the sign in would never complete
+	kion.SAMLCallbackHost = config.Kion.SamlACSHost
+	if kion.SAMLCallbackHost != "" {
+		err = kion.CheckSAMLCallbackHost(context.Background(), kion.SAMLCallbackHost, kion.SAMLCallbackAddress)
+		if err != nil {
 			return err
 		}
-
-		// check if saml auth flags set and auth with saml if so
-		if config.Kion.SamlMetadataFile != "" && config.Kion.SamlIssuer != "" {
-			err := AuthSAML()
+	}
+	kion.SAMLCallbackTLS = nil
+	if config.Kion.SamlCallbackTLS {
+		certFile, keyFile, err := samlCallbackCertFiles()
+		if err != nil {
 			return err
 		}
-
-		// if no token or session found, prompt for desired auth method
-		methods := []string{
-			"API Key",
-			"Password",
-			"SAML",
-		}
-		authMethod, err := helper.PromptSelect("How would you like to authenticate", methods)
+		kion.SAMLCallbackTLS, err = kion.LoadSAMLCallbackTLS(certFile, keyFile)
 		if err != nil {
 			return err
 		}
+	}
 
-		// handle chosen auth method
-		switch authMethod {
-		case "API Key":
-			apiKey, err := helper.PromptPassword("API Key:")
-			if err != nil {
-				return err
-			}
-			config.Kion.ApiKey = apiKey
-		case "Password":
-			err := AuthUNPW(cCtx)
-			if err != nil {
-				return err
-			}
-		case "SAML":
-			err := AuthSAML()
-			if err != nil {
-				return err
-			}
+	// start the sign in at the identity provider where it only allows that
+	kion.SAMLIdPInitiatedURL = config.Kion.SamlIdPURL
+
+	// open the sign in page in the configured browser unless asked not to
+	kion.SAMLOpenBrowser = nil
+	if !config.Kion.NoBrowser {
+		kion.SAMLOpenBrowser = func(authURL string) error {
+			return helper.OpenSignInURL(authURL, config.Kion.Browser)
 		}
 	}
 	return nil
 }
 
-////////////////////////////////////////////////////////////////////////////////
-//                                                                            //
-//  Commands                                                                  //
-//                                                                            //
-////////////////////////////////////////////////////////////////////////////////
+// explainAccessError adds guidance to access denied errors returned by Kion
+// when using a cloud access role on an account. Other errors are returned
+// unchanged.
+func explainAccessError(err error, carName string, account string, accessType string) error {
+	if !kion.IsStatus(err, 403) {
+		return err
+	}
+	hint := helper.ExplainAccessDenied(config.Kion.Url, config.Kion.ApiKey, carName, account, accessType)
+	if hint == "" {
+		return err
+	}
+	return fmt.Errorf("access denied using %v on account %v\n %v", carName, account, hint)
+}
 
-// beforeCommands run after the context is ready but before any subcommands are
-// executed. Currently used to test feature compatibility with targeted Kion.
-func beforeCommands(cCtx *cli.Context) error {
-	// skip before bits if we don't need them (ie we're just printing help)
-	args := cCtx.Args().Slice()
-	if len(args) == 0 || args[0] == "help" || args[0] == "h" {
-		return nil
+// recordAccess notes the use of a cloud access role in the local audit log.
+func recordAccess(action string, account string, carName string) {
+	recordAttempt(action, account, carName, nil)
+}
+
+// recordAttempt notes an attempt to use a cloud access role in the local
+// audit log along with how long it took and whether it failed. Failures to
+// write only warn as the audit log must never block access.
+func recordAttempt(action string, account string, carName string, attemptErr error) {
+	if dryRun || auditPath == "" {
+		return
+	}
+	level := kion.AccessLevelCLI
+	if action == "web" {
+		level = kion.AccessLevelWeb
+	}
+	result := helper.AuditSuccess
+	var anomalies []string
+	pinOverride := helper.ForcePinned && helper.IsPinned(account)
+	if pinOverride {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: account %v is pinned on this workstation, using it anyway as --force was passed", account))
+	}
+	if attemptErr != nil {
+		result = helper.AuditFailure
+	} else {
+		anomalies = warnUnusualAccess(account, carName)
+	}
+	var until *time.Time
+	if !elevatedUntil.IsZero() {
+		utc := elevatedUntil.UTC()
+		until = &utc
+	}
+	err := helper.AppendAudit(auditPath, helper.AuditEntry{
+		Time:          time.Now().UTC(),
+		Kion:          config.Kion.Url,
+		Action:        action,
+		Account:       account,
+		CAR:           carName,
+		AccessLevel:   level,
+		Result:        result,
+		ErrorClass:    helper.AuditErrorClass(attemptErr),
+		DurationMS:    time.Since(started).Milliseconds(),
+		RequestIDs:    kion.RequestIDs(),
+		DeviceID:      kion.DeviceID,
+		Anomalies:     anomalies,
+		PinOverride:   pinOverride,
+		Reason:        elevationReason,
+		ElevatedUntil: until,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to write to the audit log: %v\n", err)
 	}
+}
 
-	// switch profiles if specified
-	profileName := cCtx.String("profile")
-	if profileName != "" {
+// notifySTAK posts the issuance of stak for a cloud access role on an AWS
+// account to the on_stak webhook, if one is configured.
+func notifySTAK(carName string, account string, stak kion.STAK, downscoped bool) {
+	notifyIssuance(helper.IssuanceEvent{
+		Cloud:       kion.CloudAWS,
+		Account:     account,
+		CAR:         carName,
+		AccessKeyID: stak.AccessKey,
+		Expiration:  expirationOf(stak.Expiration),
+		Downscoped:  downscoped,
+	})
+}
 
-		// grab all manually set global flags so we can honor them over the chosen
-		// profiles values
-		setStrings := make(map[string]string)
-		var disableCacheFlagged bool
-		setGlobalFlags := cCtx.FlagNames()
-		for _, flag := range setGlobalFlags {
-			switch flag {
-			case "endpoint":
-				setStrings["endpoint"] = config.Kion.Url
-			case "user":
-				setStrings["user"] = config.Kion.Username
-			case "password":
-				setStrings["password"] = config.Kion.Password
-			case "idms":
-				setStrings["idms"] = config.Kion.IDMS
-			case "saml-metadata-file":
-				setStrings["saml-metadata-file"] = config.Kion.SamlMetadataFile
-			case "saml-sp-issuer":
-				setStrings["saml-sp-issuer"] = config.Kion.SamlIssuer
-			case "token":
-				setStrings["token"] = config.Kion.ApiKey
-			case "disable-cache":
-				disableCacheFlagged = true
-			}
-		}
+// expirationOf returns expiration for an issuance event, or nil when it is
+// unknown so the event leaves it out rather than sending the zero time.
+func expirationOf(expiration time.Time) *time.Time {
+	if expiration.IsZero() {
+		return nil
+	}
+	return &expiration
+}
 
-		// grab the profile and if found and not empty override the default config
-		profile, found := config.Profiles[profileName]
-		if found {
-			config.Kion = profile.Kion
-			config.Favorites = profile.Favorites
+// notifyIssuance posts an issuance event to the on_stak webhook, if one is
+// configured, filling in who and where the credentials were issued to. Like
+// the audit log it never blocks access, so failures only warn.
+func notifyIssuance(event helper.IssuanceEvent) {
+	settings := config.Webhooks
+	if dryRun || settings.OnSTAK == "" {
+		return
+	}
+	timeout := helper.DefaultWebhookTimeout
+	if settings.Timeout != "" {
+		parsed, err := time.ParseDuration(settings.Timeout)
+		if err != nil || parsed <= 0 {
+			fmt.Fprintf(os.Stderr, "Warning: invalid webhooks.timeout %q, expected a duration such as 10s\n", settings.Timeout)
 		} else {
-			return fmt.Errorf("profile not found: %s", profileName)
+			timeout = parsed
 		}
+	}
+	secret := os.Getenv("KION_WEBHOOK_SECRET")
+	if secret == "" {
+		secret = settings.Secret
+	}
 
-		// honor any global flags that were set to maintain precedence
-		for key, value := range setStrings {
-			err := cCtx.Set(key, value)
-			if err != nil {
-				return err
-			}
-		}
-		if disableCacheFlagged {
-			config.Kion.DisableCache = true
-		}
+	now := time.Now().UTC()
+	event.Event = helper.EventSTAKIssued
+	event.Time = now
+	event.Kion = config.Kion.Url
+	event.DeviceID = kion.DeviceID
+	event.RequestIDs = kion.RequestIDs()
+	event.Version = kionCliVersion
+	if current, err := user.Current(); err == nil {
+		event.User = current.Username
 	}
+	event.Host, _ = os.Hostname()
 
-	// grab the kion url if not already set
-	err := setEndpoint()
+	err := helper.PostWebhook(kion.ExternalClient(timeout), settings.OnSTAK, secret, event, now)
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "Warning: unable to send the issuance event: %v\n", err)
 	}
+}
 
-	// gather the targeted kion version
-	kionVer, err := kion.GetVersion(config.Kion.Url)
-	if err != nil {
-		return err
+// warnUnusualAccess warns about access that differs from the history in the
+// audit log, such as using an account not touched in months, returning the
+// kinds warned about. Like the audit log itself it never blocks access.
+func warnUnusualAccess(account string, carName string) []string {
+	settings := config.Kion.AccessWarnings
+	if settings.Disable {
+		return nil
 	}
-	curVer, err := version.NewSemver(kionVer)
-	if err != nil {
-		return err
+	thresholds := helper.AnomalyThresholds{
+		DormantAfter: helper.DefaultDormantDays * 24 * time.Hour,
+		LongDuration: helper.DefaultLongDuration,
 	}
-
-	// api/v3/me/cloud-access-role fix constraints
-	v3mecarC1, _ := version.NewConstraint(">=3.6.29, < 3.7.0")
-	v3mecarC2, _ := version.NewConstraint(">=3.7.17, < 3.8.0")
-	v3mecarC3, _ := version.NewConstraint(">=3.8.9, < 3.9.0")
-	v3mecarC4, _ := version.NewConstraint(">=3.9.0")
-
-	// check constraints and set bool in metadata
-	if v3mecarC1.Check(curVer) ||
-		v3mecarC2.Check(curVer) ||
-		v3mecarC3.Check(curVer) ||
-		v3mecarC4.Check(curVer) {
-		cCtx.App.Metadata["useUpdatedCloudAccessRoleAPI"] = true
+	if settings.DormantDays != 0 {
+		thresholds.DormantAfter = time.Duration(settings.DormantDays) * 24 * time.Hour
+	}
+	if settings.LongDuration != "" {
+		duration, err := time.ParseDuration(settings.LongDuration)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: invalid kion.access_warnings.long_duration %q, expected a duration such as 8h\n", settings.LongDuration)
+		} else {
+			thresholds.LongDuration = duration
+		}
 	}
 
-	// initialize the keyring
-	name := "kion-cli"
-	ring, err := keyring.Open(keyring.Config{
-		ServiceName: name,
-		KeyCtlScope: "session",
+	entries, err := helper.ReadAudit(auditPath)
+	if err != nil {
+		return nil
+	}
+	var kinds []string
+	for _, anomaly := range helper.AccessAnomalies(entries, config.Kion.Url, account, carName, issuedDuration, thresholds, time.Now()) {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: %v", anomaly.Message))
+		kinds = append(kinds, anomaly.Kind)
+	}
+	return kinds
+}
 
-		// osx
-		KeychainName:             "login",
-		KeychainTrustApplication: true,
-		KeychainSynchronizable:   false,
+// carDefaults returns the configured default cloud access roles unless the
+// user asked to choose one with the choose-car flag.
+func carDefaults(cCtx *cli.Context) []structs.Default {
+	if cCtx.Bool("choose-car") {
+		return nil
+	}
+	return config.Defaults
+}
 
-		// kde wallet
-		KWalletAppID:  name,
-		KWalletFolder: name,
+// withReauth runs fn and if Kion rejects the session mid-operation it
+// refreshes the session, or else discards it and re-authenticates, and
+// resumes fn once. Tokens provided by the user are never replaced as
+// re-authenticating won't fix them.
+func withReauth(cCtx *cli.Context, fn func() error) error {
+	err := fn()
+	if !kion.IsStatus(err, 401) || !sessionToken {
+		return err
+	}
 
-		// windows
-		WinCredPrefix: name,
+	// a refresh token may still be good when the access token isn't
+	session, found, cacheErr := c.GetSession()
+	if cacheErr == nil && found && session.Refreshable(time.Now()) {
+		_, refreshErr := refreshSession(session)
+		if refreshErr == nil {
+			return fn()
+		}
+	}
 
-		// password store
-		PassPrefix: name,
+	// re-authenticating without a terminal only works with stored credentials,
+	// unless kion.reauth has a way
+	if len(config.Kion.Reauth.Strategies) == 0 && !helper.IsInteractive() && config.Kion.Password == "" {
+		return fmt.Errorf("kion session is no longer valid, re-run interactively to authenticate: %w", err)
+	}
 
-		//  encrypted file fallback
-		FileDir:          "~/.kion",
-		FilePasswordFunc: helper.PromptPassword,
-	})
+	// drop the dead session so it isn't picked back up
+	err = c.SetSession(kion.Session{})
 	if err != nil {
 		return err
 	}
+	config.Kion.ApiKey = ""
+	sessionToken = false
 
-	// initialize the cache
-	if config.Kion.DisableCache {
-		c = cache.NewNullCache(ring)
-	} else {
-		c = cache.NewCache(ring)
+	fmt.Fprintln(os.Stderr, color.YellowString("Kion session is no longer valid, re-authenticating..."))
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return fn()
 }
 
-// genStaks generates short term access keys by walking users through an
-// interactive prompt. Short term access keys are either printed to stdout or a
-// sub-shell is created with them set in the environment.
-func genStaks(cCtx *cli.Context) error {
-	// stub out placeholders
-	var car kion.CAR
-	var stak kion.STAK
+// checkSession confirms Kion still accepts the session before requests are
+// made in parallel, re-authenticating once up front if it doesn't as each
+// request can't sign in again on its own.
+func checkSession(cCtx *cli.Context) error {
+	if !sessionToken {
+		return nil
+	}
+	return withReauth(cCtx, func() error {
+		_, err := kion.GetCurrentUser(config.Kion.Url, config.Kion.ApiKey)
+		return err
+	})
+}
 
-	// set vars for easier access
-	endpoint := config.Kion.Url
-	carName := cCtx.String("car")
-	account := cCtx.String("account")
-	cacheKey := fmt.Sprintf("%s-%s", carName, account)
-	region := cCtx.String("region")
+// fetchSTAK requests a new STAK from Kion, re-authenticating if the session
+// dies mid-request and explaining any access denials. The STAK is downscoped
+// with policy, a session policy document, when not empty. While Kion is
+// unreachable or in maintenance cached keys still valid are returned in its
+// place. An empty STAK is returned when dry running.
+func fetchSTAK(cCtx *cli.Context, carName string, account string, policy string) (kion.STAK, error) {
+	window, err := outageRetryWindow()
+	if err != nil {
+		return kion.STAK{}, err
+	}
 
-	// grab the command usage [stak, s, setenv, savecreds, etc]
-	cmdUsed := cCtx.Lineage()[1].Args().Slice()[0]
+	// keys still valid stand in while kion is down rather than queueing
+	cached, found, cacheErr := c.GetStak(stakCacheKey(carName, account, policy))
+	fallback := cacheErr == nil && found && cached.ValidFor(outageFallbackValidity)
+	if fallback {
+		window = 0
+	}
 
-	// determine action and set required cache validity buffer
-	var action string
-	var buffer time.Duration
-	if cCtx.Bool("credential-process") {
-		action = "credential-process"
-		buffer = 5
-	} else if cCtx.Bool("print") || cmdUsed == "setenv" {
-		action = "print"
-		buffer = 300
-	} else if cCtx.Bool("save") || cmdUsed == "savecreds" {
-		action = "save"
-		buffer = 600
-	} else {
-		action = "subshell"
-		buffer = 300
+	// queue the request while kion is unreachable, retrying within the window
+	var stak kion.STAK
+	err = helper.RetryWhileUnreachable(cCtx.Context, window, func() error {
+		return withReauth(cCtx, func() error {
+			return stakPacer.Do(cCtx.Context, func() error {
+				var err error
+				stak, err = kion.GetSTAK(config.Kion.Url, config.Kion.ApiKey, carName, account)
+				return err
+			})
+		})
+	}, func(err error, wait time.Duration) {
+		fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, fmt.Sprintf("retrying the request for short-term access keys in %v", wait))))
+	})
+	if errors.Is(err, kion.ErrDryRun) {
+		return stak, nil
+	}
+	if err != nil && fallback && kion.IsUnreachable(err) {
+		fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, "using the cached short-term access keys valid until "+cached.Expiration.Local().Format("15:04 MST"))))
+		return cached, nil
+	}
+	if err != nil {
+		recordAttempt("stak", account, carName, err)
+		return stak, explainAccessError(err, carName, account, "cli")
 	}
+	stak, err = processSTAK(stak, carName, account, policy)
+	if err != nil {
+		return stak, err
+	}
+	issuedDuration = time.Duration(stak.Duration) * time.Second
+	notifySTAK(carName, account, stak, policy != "")
 
-	// if we have what we need go look stuff up without prompts do it
-	if account != "" && carName != "" {
-		// determine if we have a valid cached entry
-		cachedSTAK, found, err := c.GetStak(cacheKey)
-		if err != nil {
-			return err
-		}
-		getCar := true
-		if found && cachedSTAK.Expiration.After(time.Now().Add(-buffer*time.Second)) {
-			// cached stak found and is still valid
-			stak = cachedSTAK
-			if action != "subshell" {
-				getCar = false
-			}
-		}
+	// keys downscoped on request would stand in for the full ones in the
+	// mirror, so only mirror the keys every run gets
+	if policy == "" {
+		mirrorSTAK(carName, account, stak)
+	}
+	return stak, nil
+}
 
-		// grab the car if needed
-		if getCar {
-			// handle auth
-			err := setAuthToken(cCtx)
-			if err != nil {
-				return err
-			}
+// processSTAK passes a newly issued STAK through the configured processors,
+// so what is cached and output is already transformed, such as downscoped
+// with a session policy. A requested session policy is applied first.
+func processSTAK(stak kion.STAK, carName string, account string, policy string) (kion.STAK, error) {
+	settings := config.Processors
+	if policy != "" {
+		settings = append([]structs.STAKProcessor{{Type: "session_policy", Policy: policy}}, settings...)
+	}
+	if len(settings) == 0 {
+		return stak, nil
+	}
+	processors, err := helper.NewSTAKProcessors(settings)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+	return helper.ProcessSTAK(processors, stak, helper.STAKTarget{Account: account, CAR: carName})
+}
 
-			car, err = kion.GetCARByNameAndAccount(endpoint, config.Kion.ApiKey, carName, account)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// handle auth
-		err := setAuthToken(cCtx)
-		if err != nil {
-			return err
-		}
+// readSessionPolicy reads the session policy document at path, returning an
+// empty policy if no path is given.
+func readSessionPolicy(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	return helper.ReadSessionPolicy(path)
+}
 
-		// run through the car selector to fill any gaps
-		err = helper.CARSelector(cCtx, &car)
-		if err != nil {
-			return err
-		}
+// stakCacheKey returns the key a STAK is cached under, keys downscoped with a
+// session policy kept apart from full ones.
+func stakCacheKey(carName string, account string, policy string) string {
+	if policy == "" {
+		return fmt.Sprintf("%s-%s", carName, account)
+	}
+	return fmt.Sprintf("%s-%s-policy-%s", carName, account, helper.SessionPolicyID(policy))
+}
 
-		// rebuild cache key and determine if we have a valid cached entry
-		cacheKey = fmt.Sprintf("%s-%s", car.Name, car.AccountNumber)
-		cachedSTAK, found, err := c.GetStak(cacheKey)
-		if err != nil {
-			return err
-		}
-		if found && cachedSTAK.Expiration.After(time.Now().Add(-buffer*time.Second)) {
-			// cached stak found and is still valid
-			stak = cachedSTAK
-		}
+// mirrorSTAK writes a newly issued STAK to the AWS CLI cache when configured
+// to, for tools that only look for credentials there. Failures only warn as
+// the mirror must never block access.
+func mirrorSTAK(carName string, account string, stak kion.STAK) {
+	if !config.Kion.MirrorAWSCLICache {
+		return
+	}
+	dir, err := helper.AWSCLICacheDir()
+	if err == nil {
+		err = helper.WriteAWSCLICache(dir, account, carName, stak)
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to mirror credentials to the AWS CLI cache: %v\n", err)
+	}
+}
 
-	// grab a new stak if needed
-	if stak == (kion.STAK{}) {
-		// handle auth
-		err := setAuthToken(cCtx)
-		if err != nil {
-			return err
+// outageRetryWindow returns how long requests for short-term access keys are
+// retried while Kion is unreachable.
+func outageRetryWindow() (time.Duration, error) {
+	if config.Kion.OutageRetry == "" {
+		return defaultOutageRetry, nil
+	}
+	window, err := time.ParseDuration(config.Kion.OutageRetry)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid kion.outage_retry %q, expected a duration such as 5m", config.Kion.OutageRetry)
+	}
+	return window, nil
+}
+
+// selectCAR walks the user through choosing a cloud access role. The
+// inventory of projects and roles behind the prompts is cached so that when
+// Kion can't be reached choices can still be made from the last one, which is
+// clearly labeled as stale. When stale data is used the time it was cached is
+// returned, otherwise the zero time.
+func selectCAR(cCtx *cli.Context, car *kion.CAR) (time.Time, error) {
+	// reuse a freshly cached inventory so the pickers open without waiting
+	if !refreshInventory {
+		cached, found, err := c.GetInventory()
+		if err == nil && found && time.Since(cached.Updated) < inventoryMaxAge() {
+			return time.Time{}, helper.InventorySelector(cCtx, cached, car, carDefaults(cCtx), false)
 		}
+	}
 
-		// generate short term tokens
-		stak, err = kion.GetSTAK(endpoint, config.Kion.ApiKey, car.Name, car.AccountNumber)
-		if err != nil {
+	var inventory kion.Inventory
+	var useUpdated bool
+	err := withReauth(cCtx, func() error {
+		var err error
+		useUpdated, err = helper.UseUpdatedCARAPI(cCtx)
+		if err != nil || !useUpdated {
 			return err
 		}
-
-		// store the stak in the cache
-		err = c.SetStak(cacheKey, stak)
+		inventory, err = helper.FetchInventory(cCtx)
+		return err
+	})
+	switch {
+	case err == nil && !useUpdated:
+		return time.Time{}, withReauth(cCtx, func() error {
+			return helper.CARSelector(cCtx, car, carDefaults(cCtx))
+		})
+	case err == nil:
+		enrichInventory(cCtx, &inventory)
+		err = cacheInventory(inventory)
 		if err != nil {
-			return err
+			return time.Time{}, err
 		}
+		return time.Time{}, helper.InventorySelector(cCtx, inventory, car, carDefaults(cCtx), false)
+	case !kion.IsUnreachable(err):
+		return time.Time{}, err
 	}
 
-	// run the action
-	switch action {
-	case "credential-process":
-		// NOTE: do not use os.Stderr here else credentials can be written to logs
-		return helper.PrintCredentialProcess(os.Stdout, stak)
-	case "print":
-		return helper.PrintSTAK(os.Stdout, stak, region)
-	case "save":
-		return helper.SaveAWSCreds(stak, car)
-	case "subshell":
-		return helper.CreateSubShell(car.AccountNumber, car.AccountName, car.Name, stak, region)
-	default:
-		return nil
+	// fall back to the cached inventory while kion is unreachable
+	cached, found, cacheErr := c.GetInventory()
+	if cacheErr != nil || !found {
+		return time.Time{}, err
 	}
+	fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, "choosing from stale data cached at "+cached.Updated.Local().Format("2006-01-02 15:04"))))
+	return cached.Updated, helper.InventorySelector(cCtx, cached, car, carDefaults(cCtx), true)
 }
 
-// favorites generates short term access keys or launches the web console
-// from stored favorites. If a favorite is found that matches the passed
-// argument it is used, otherwise the user is walked through a wizard to make a
-// selection.
-func favorites(cCtx *cli.Context) error {
-	// map our favorites for ease of use
-	fNames, fMap := helper.MapFavs(config.Favorites)
+// inventoryMaxAge returns how long a cached inventory is reused by the
+// pickers, kion.inventory_max_age or defaultInventoryMaxAge.
+func inventoryMaxAge() time.Duration {
+	value := config.Kion.InventoryMaxAge
+	if value == "" {
+		return defaultInventoryMaxAge
+	}
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge < 0 {
+		fmt.Fprintf(os.Stderr, "Warning: invalid kion.inventory_max_age %q, expected a duration such as 10m\n", value)
+		return defaultInventoryMaxAge
+	}
+	return maxAge
+}
 
-	// if arg passed is a valid favorite use it else prompt
-	var fav string
-	var err error
-	if fMap[cCtx.Args().First()] != (structs.Favorite{}) {
-		fav = cCtx.Args().First()
-	} else {
-		fav, err = helper.PromptSelect("Choose a Favorite:", fNames)
-		if err != nil {
-			return err
-		}
+// cacheInventory caches the inventory behind the pickers and indexes its
+// accounts for describing completions.
+func cacheInventory(inventory kion.Inventory) error {
+	err := c.SetInventory(inventory)
+	if err != nil || dryRun {
+		return err
+	}
+	err = helper.WriteCompletionIndex(completionIndexPath(), helper.NewCompletionIndex(inventory))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to update the completion index: %v\n", err)
 	}
+	return nil
+}
 
-	// grab the favorite object
-	favorite := fMap[fav]
+// completionIndexPath is where account names and projects for describing
+// completions are kept.
+func completionIndexPath() string {
+	return filepath.Join(paths.State, "completion.json")
+}
 
-	// determine favorite action, default to cli unless explicitly set to web
-	if favorite.AccessType == "web" {
-		// handle auth
-		err = setAuthToken(cCtx)
-		if err != nil {
-			return err
-		}
+// pinsPath is where accounts pinned with kion pin are kept.
+func pinsPath() string {
+	return filepath.Join(paths.State, "pinned-accounts.json")
+}
 
-		var car kion.CAR
-		// attempt to find exact match then fallback to first match
-		car, err = kion.GetCARByNameAndAccount(config.Kion.Url, config.Kion.ApiKey, favorite.CAR, favorite.Account)
-		if err != nil {
-			car, err = kion.GetCARByName(config.Kion.Url, config.Kion.ApiKey, favorite.CAR)
-			if err != nil {
-				return err
-			}
-			car.AccountNumber = favorite.Account
-		}
-		url, err := kion.GetFederationURL(config.Kion.Url, config.Kion.ApiKey, car)
-		if err != nil {
-			return err
-		}
-		fmt.Printf("Federating into %s (%s) via %s\n", favorite.Name, favorite.Account, car.AwsIamRoleName)
-		return helper.OpenBrowserRedirect(url, car.AccountTypeID)
-	} else {
-		// placeholder for our stak
-		var stak kion.STAK
-
-		// determine action and set required cache validity buffer
-		var action string
-		var buffer time.Duration
-		if cCtx.Bool("credential-process") {
-			action = "credential-process"
-			buffer = 5
-		} else if cCtx.Bool("print") {
-			action = "print"
-			buffer = 300
+// enrichInventory adds account tags and OU paths from AWS Organizations to a
+// freshly fetched inventory when kion.org_metadata is configured, so the
+// account picker can search them. Those cached with the last inventory are
+// reused until they are kion.org_metadata.max_age old. Failing to read them
+// only warns as they are a convenience.
+func enrichInventory(cCtx *cli.Context, inventory *kion.Inventory) {
+	settings := config.Kion.OrgMetadata
+	if settings.Favorite == "" || dryRun {
+		return
+	}
+	maxAge := defaultOrgMetadataMaxAge
+	if settings.MaxAge != "" {
+		parsed, err := time.ParseDuration(settings.MaxAge)
+		if err != nil || parsed < 0 {
+			fmt.Fprintf(os.Stderr, "Warning: invalid kion.org_metadata.max_age %q, expected a duration such as 12h\n", settings.MaxAge)
 		} else {
-			action = "subshell"
-			buffer = 300
-		}
-
-		// check if we have a valid cached stak else grab a new one
-		cacheKey := fmt.Sprintf("%s-%s", favorite.CAR, favorite.Account)
-		cachedSTAK, found, err := c.GetStak(cacheKey)
-		if err != nil {
-			return err
+			maxAge = parsed
 		}
-		if found && cachedSTAK.Expiration.After(time.Now().Add(-buffer*time.Second)) {
-			stak = cachedSTAK
-		} else {
-			// handle auth
-			err = setAuthToken(cCtx)
-			if err != nil {
-				return err
-			}
-
-			// grab a new stak
-			stak, err = kion.GetSTAK(config.Kion.Url, config.Kion.ApiKey, favorite.CAR, favorite.Account)
-			if err != nil {
-				return err
-			}
+	}
 
-			// store the stak in the cache
-			err = c.SetStak(cacheKey, stak)
-			if err != nil {
-				return err
-			}
+	cached, found, err := c.GetInventory()
+	if err == nil && found && cached.Accounts != nil {
+		inventory.Accounts, inventory.AccountsUpdated = cached.Accounts, cached.AccountsUpdated
+		if time.Since(cached.AccountsUpdated) < maxAge {
+			return
 		}
+	}
 
-		// cred process output, print, or create sub-shell
-		switch action {
-		case "credential-process":
-			// NOTE: do not use os.Stderr here else credentials can be written to logs
-			return helper.PrintCredentialProcess(os.Stdout, stak)
-		case "print":
-			return helper.PrintSTAK(os.Stdout, stak, favorite.Region)
-		case "subshell":
-			return helper.CreateSubShell(favorite.Account, favorite.Name, favorite.CAR, stak, favorite.Region)
-		default:
-			return nil
-		}
+	accounts, err := organizationAccounts(cCtx, settings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read account tags from AWS Organizations with favorite %v: %v\n", settings.Favorite, err)
+		return
 	}
+	inventory.Accounts, inventory.AccountsUpdated = accounts, time.Now()
 }
 
-// fedConsole opens the CSP console for the selected account and cloud access
-// role in the users default browser.
-func fedConsole(cCtx *cli.Context) error {
-	// handle auth
-	err := setAuthToken(cCtx)
+// organizationAccounts reads the tags and OU paths of every account in the
+// AWS Organization managed from the account of the configured favorite.
+func organizationAccounts(cCtx *cli.Context, settings structs.OrgMetadata) (map[string]kion.AccountMetadata, error) {
+	_, fMap := helper.MapFavs(config.Favorites)
+	favorite, found := fMap[settings.Favorite]
+	if !found {
+		return nil, fmt.Errorf("favorite not found: %v", settings.Favorite)
+	}
+	favorite, err := resolveFavorite(cCtx, favorite)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// walk user through the prompt workflow to select a car
-	var car kion.CAR
-	err = helper.CARSelector(cCtx, &car)
+	err = helper.RequireAWS(helper.FavoriteCloud(favorite), favorite.Account, "account tags")
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// grab the csp federation url
-	url, err := kion.GetFederationURL(config.Kion.Url, config.Kion.ApiKey, car)
+	stak, err := favoriteSTAK(cCtx, favorite, 60)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	region := settings.Region
+	if region == "" {
+		region = helper.DefaultOrganizationsRegion
 	}
-	return helper.OpenBrowserRedirect(url, car.AccountTypeID)
+	var accounts map[string]kion.AccountMetadata
+	err = helper.WithProgress(cCtx.Context, "Reading account tags from AWS Organizations", func(p *helper.Progress) error {
+		var err error
+		accounts, err = helper.OrganizationAccounts(stak, region)
+		return err
+	})
+	return accounts, err
 }
 
-// listFavorites prints out the users stored favorites. Extra information is
-// provided if the verbose flag is set.
-func listFavorites(cCtx *cli.Context) error {
-	// map our favorites for ease of use
-	fNames, fMap := helper.MapFavs(config.Favorites)
+// labeledRegion returns the default region of an account from its Kion
+// labels, for commands given no region by a flag or favorite. Labels are read
+// at most once a day and only when already signed in, so cached keys are used
+// without signing in just for a region, and failing to read them leaves the
+// region unset. The account ID is found in the cached inventory if not given.
+func labeledRegion(account string, accountID uint) string {
+	key := config.Kion.RegionLabel
+	if key == "" {
+		key = helper.DefaultRegionLabel
+	}
+	path := filepath.Join(paths.State, "account-regions.json")
+	regions, err := helper.ReadAccountRegions(path)
+	if err != nil {
+		regions = make(map[string]helper.AccountRegion)
+	}
+	cached, found := regions[account]
+	if found && time.Since(cached.Checked) < accountRegionMaxAge {
+		return cached.Region
+	}
+	if config.Kion.ApiKey == "" || dryRun {
+		return cached.Region
+	}
 
-	// print it out
-	if cCtx.Bool("verbose") {
-		for _, f := range fMap {
-			accessType := f.AccessType
-			if accessType == "" {
-				accessType = "cli (Default)"
-			}
-			region := f.Region
-			if region == "" {
-				region = "[unset]"
+	if accountID == 0 {
+		inventory, found, err := c.GetInventory()
+		if err == nil && found {
+			for _, car := range inventory.CARs {
+				if car.AccountNumber == account {
+					accountID = car.AccountID
+					break
+				}
 			}
-			fmt.Printf(" %v:\n   account number: %v\n   cloud access role: %v\n   access type: %v\n   region: %v\n", f.Name, f.Account, f.CAR, accessType, region)
-		}
-	} else {
-		for _, f := range fNames {
-			fmt.Printf(" %v\n", f)
 		}
 	}
-	return nil
-}
-
-// runCommand generates creds for an AWS account then executes the user
-// provided command with said credentials set.
-func runCommand(cCtx *cli.Context) error {
-	// set vars for easier access
-	endpoint := config.Kion.Url
-	favName := cCtx.String("favorite")
-	accNum := cCtx.String("account")
-	carName := cCtx.String("car")
-	region := cCtx.String("region")
+	if accountID == 0 {
+		return cached.Region
+	}
+	labels, err := kion.GetAccountLabels(config.Kion.Url, config.Kion.ApiKey, accountID)
+	if err != nil {
+		return cached.Region
+	}
 
-	// fail fast if we don't have what we need
-	if favName == "" && (accNum == "" || carName == "") {
-		return errors.New("must specify either --fav OR --account and --car parameters")
+	region := helper.RegionFromLabels(labels, key)
+	regions[account] = helper.AccountRegion{Region: region, Checked: time.Now().UTC()}
+	err = helper.WriteAccountRegions(path, regions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to save account regions: %v\n", err)
 	}
+	return region
+}
 
-	// placeholder for our stak
-	var stak kion.STAK
+// outageNotice notes what is done about err, Kion being unreachable, giving
+// the maintenance window rather than the error when that is the reason.
+func outageNotice(err error, action string) string {
+	if maintenance, ok := kion.AsMaintenance(err); ok {
+		return fmt.Sprintf("%v, %v", strings.TrimRight(maintenance.Error(), ".!?"), action)
+	}
+	return fmt.Sprintf("Kion is unreachable, %v: %v", action, err)
+}
 
-	// prefer favorites if specified, else use account and car
-	if favName != "" {
-		// map our favorites for ease of use
-		_, fMap := helper.MapFavs(config.Favorites)
+// describeData notes when a request was chosen from stale cached data rather
+// than data fetched from Kion just now.
+func describeData(staleSince time.Time) string {
+	if staleSince.IsZero() {
+		return ""
+	}
+	return helper.StaleLabel(staleSince) + ", Kion is unreachable"
+}
 
-		// if arg passed is a valid favorite use it else prompt
-		var fav string
+// fetchFederationURL requests a console federation URL from Kion,
+// re-authenticating if the session dies mid-request and explaining any access
+// denials. An empty URL is returned when dry running.
+func fetchFederationURL(cCtx *cli.Context, car kion.CAR) (string, error) {
+	var url string
+	err := withReauth(cCtx, func() error {
 		var err error
-		if fMap[favName] != (structs.Favorite{}) {
-			fav = favName
-		} else {
-			return errors.New("can't find favorite")
-		}
+		url, err = kion.GetFederationURL(config.Kion.Url, config.Kion.ApiKey, car)
+		return err
+	})
+	if errors.Is(err, kion.ErrDryRun) {
+		return url, nil
+	}
+	if err != nil {
+		recordAttempt("web", car.AccountNumber, car.Name, err)
+		return url, explainAccessError(err, car.Name, car.AccountNumber, "web")
+	}
+	return url, nil
+}
 
-		// grab our favorite
-		favorite := fMap[fav]
+// resolveFavoriteCAR finds the cloud access role a favorite refers to. If the
+// favorite is ambiguous, because it doesn't name a cloud access role, several
+// share its name on the account, or its account glob or alias matches several
+// accounts, the user's last answer for
+// the favorite is reused, otherwise they are prompted and the answer is
+// remembered. Found is false if nothing on the account matched.
+func resolveFavoriteCAR(cCtx *cli.Context, favorite structs.Favorite) (kion.CAR, bool, error) {
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return kion.CAR{}, false, err
+	}
 
-		// check if we have a valid cached stak else grab a new one
-		cacheKey := fmt.Sprintf("%s-%s", favorite.CAR, favorite.Account)
-		cachedSTAK, found, err := c.GetStak(cacheKey)
-		if err != nil {
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
 			return err
-		}
-		if found && cachedSTAK.Expiration.After(time.Now().Add(-5*time.Second)) {
-			stak = cachedSTAK
-		} else {
-			// handle auth
-			err := setAuthToken(cCtx)
-			if err != nil {
-				return err
-			}
+		})
+	})
+	if err != nil {
+		return kion.CAR{}, false, err
+	}
 
-			// grab a new stak
-			stak, err = kion.GetSTAK(endpoint, config.Kion.ApiKey, favorite.CAR, favorite.Account)
-			if err != nil {
-				return err
-			}
+	// narrow down to what the favorite could mean
+	var matches []kion.CAR
+	for _, car := range cars {
+		if helper.MatchesAccount(car, favorite.Account, favorite.AccountAlias) && (favorite.CAR == "" || car.Name == favorite.CAR) {
+			matches = append(matches, car)
+		}
+	}
+	// leave out pinned accounts when the favorite could mean others
+	if unpinned := helper.FilterPinnedCARs(matches); len(matches) > 1 && len(unpinned) > 0 {
+		matches = unpinned
+	}
+	switch len(matches) {
+	case 0:
+		return kion.CAR{}, false, nil
+	case 1:
+		return matches[0], true, nil
+	}
 
-			// store the stak in the cache
-			err = c.SetStak(cacheKey, stak)
-			if err != nil {
-				return err
+	// reuse the last answer given for this favorite if it's still valid
+	key := fmt.Sprintf("favorite/%v", favorite.Name)
+	remembered, found, err := c.GetSelection(key)
+	if err != nil {
+		return kion.CAR{}, false, err
+	}
+	if found {
+		for _, car := range matches {
+			if fmt.Sprintf("%v/%v", car.ID, car.AccountNumber) == remembered {
+				fmt.Fprintf(os.Stderr, "Using %v (%v) on account %v for favorite %v as previously selected\n", car.Name, car.ID, car.AccountNumber, favorite.Name)
+				return car, true, nil
 			}
 		}
+	}
 
-		// take the region flag over the favorite region
-		targetRegion := region
-		if targetRegion == "" {
-			targetRegion = favorite.Region
-		}
+	// otherwise ask and remember the answer
+	if !helper.IsInteractive() {
+		return kion.CAR{}, false, fmt.Errorf("favorite %v matches %v cloud access roles, run it interactively once to choose one", favorite.Name, len(matches))
+	}
+	cNames, cMap := helper.MapCARWithAccounts(matches)
+	choice, err := helper.PromptSelect(fmt.Sprintf("Choose a Cloud Access Role for %v:", favorite.Name), cNames)
+	if err != nil {
+		return kion.CAR{}, false, err
+	}
+	car := cMap[choice]
+	err = c.SetSelection(key, fmt.Sprintf("%v/%v", car.ID, car.AccountNumber))
+	if err != nil {
+		return kion.CAR{}, false, err
+	}
+	fmt.Fprintf(os.Stderr, "Your selection will be used for %v next time, run 'kion util flush-cache' to reset it\n", favorite.Name)
 
-		// run the command
-		err = helper.RunCommand(stak, targetRegion, cCtx.Args().First(), cCtx.Args().Tail()...)
-		if err != nil {
-			return err
-		}
-	} else {
-		// check if we have a valid cached stak else grab a new one
-		cacheKey := fmt.Sprintf("%s-%s", carName, accNum)
-		cachedSTAK, found, err := c.GetStak(cacheKey)
-		if err != nil {
-			return err
+	return car, true, nil
+}
+
+// confirmPreflight prints what a request will use when the explain flag is
+// set, then asks the user to continue unless the yes flag is also set.
+func confirmPreflight(cCtx *cli.Context, preflight helper.Preflight) error {
+	if !cCtx.Bool("explain") {
+		return nil
+	}
+	helper.PrintPreflight(os.Stderr, preflight)
+	if cCtx.Bool("yes") {
+		return nil
+	}
+
+	if !helper.IsInteractive() {
+		return errors.New("confirmation required, pass --yes to continue without a terminal")
+	}
+	proceed, err := helper.PromptConfirm("Continue?")
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		return errors.New("aborted")
+	}
+	return nil
+}
+
+// openConsole opens a federated console url in a browser profile. When the
+// profile is still signed in to another account or cloud access role, which
+// opening the console would silently sign out, another configured profile is
+// used if one is free, otherwise the user is warned and asked to confirm. An
+// empty profile selects the first configured profile or the default browser.
+func openConsole(cCtx *cli.Context, car kion.CAR, url string, profile string) error {
+	var alternates []string
+	if profile != "" && config.Kion.Browser == "" {
+		return fmt.Errorf("set kion.browser in %v to open consoles in browser profile %v", configPath, profile)
+	}
+	if profile == "" {
+		profile = helper.DefaultBrowserProfile
+		if config.Kion.Browser != "" && len(config.Kion.BrowserProfiles) > 0 {
+			profile = config.Kion.BrowserProfiles[0]
+			alternates = config.Kion.BrowserProfiles
 		}
-		if found && cachedSTAK.Expiration.After(time.Now().Add(-5*time.Second)) {
-			stak = cachedSTAK
-		} else {
-			// handle auth
-			err := setAuthToken(cCtx)
-			if err != nil {
-				return err
-			}
+	}
 
-			// grab a new stak
-			stak, err = kion.GetSTAK(endpoint, config.Kion.ApiKey, carName, accNum)
+	// find out what the profile is signed in to
+	sessions, err := helper.ReadBrowserSessions(browserSessionsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read browser sessions: %v\n", err)
+		sessions = make(map[string]helper.BrowserSession)
+	}
+	picked, switched, conflict := helper.PickBrowserProfile(sessions, profile, alternates, car.AccountNumber, car.Name, time.Now())
+	if switched {
+		fmt.Fprintf(os.Stderr, "Browser profile %v is signed in to another account, using %v\n", profile, picked)
+	}
+	if conflict != nil {
+		account := conflict.Account
+		if conflict.AccountName != "" {
+			account = fmt.Sprintf("%v (%v)", conflict.AccountName, conflict.Account)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: browser profile %v is signed in to %v as %v since %v, opening the console will sign it out\n",
+			picked, account, conflict.CAR, conflict.Time.Local().Format(time.Kitchen))
+		if helper.IsInteractive() && !cCtx.Bool("yes") {
+			proceed, err := helper.PromptConfirm("Continue?")
 			if err != nil {
 				return err
 			}
-
-			// store the stak in the cache
-			err = c.SetStak(cacheKey, stak)
-			if err != nil {
-				return err
+			if !proceed {
+				return errors.New("aborted")
 			}
 		}
+	}
 
-		err = helper.RunCommand(stak, region, cCtx.Args().First(), cCtx.Args().Tail()...)
-		if err != nil {
-			return err
-		}
+	err = helper.OpenBrowserProfile(url, car.AccountTypeID, config.Kion.Browser, picked)
+	if err != nil {
+		return err
 	}
 
+	// remember the session, failures only warn as the console is already open
+	sessions[picked] = helper.BrowserSession{
+		Account:     car.AccountNumber,
+		AccountName: car.AccountName,
+		CAR:         car.Name,
+		Time:        time.Now().UTC(),
+	}
+	err = helper.WriteBrowserSessions(browserSessionsPath, sessions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to save browser sessions: %v\n", err)
+	}
 	return nil
 }
 
-// flushCache clears the Kion CLI cache.
-func flushCache(cCtx *cli.Context) error {
-	return c.FlushCache()
+// describeAction summarizes how credentials will be delivered for an action.
+func describeAction(action string) string {
+	switch action {
+	case "credential-process":
+		return "short-term access keys, printed as credential process json"
+	case "print":
+		return "short-term access keys, printed to stdout"
+	case "handoff":
+		return "short-term access keys, encrypted for hand-off and printed to stdout"
+	case "export":
+		return "short-term access keys, exported to secret stores"
+	case "save":
+		return "short-term access keys, saved to the AWS credentials file"
+	case "subshell":
+		return "short-term access keys, in a sub-shell"
+	case "web":
+		return "web console"
+	default:
+		return action
+	}
 }
 
-// afterCommands run after any subcommands are executed.
-func afterCommands(cCtx *cli.Context) error {
-	return nil
+// describeDuration summarizes how long a STAK is valid for, if one is already
+// in hand, otherwise that Kion decides when issuing it.
+func describeDuration(stak kion.STAK) string {
+	if stak == (kion.STAK{}) {
+		return "set by the cloud access role when issued"
+	}
+	return fmt.Sprintf("valid for another %v", time.Until(stak.Expiration).Round(time.Second))
 }
 
-////////////////////////////////////////////////////////////////////////////////
-//                                                                            //
-//  Main                                                                      //
-//                                                                            //
-////////////////////////////////////////////////////////////////////////////////
-
-// main defines the command line utilities API. This should probably be broken
-// out into its own function some day.
-func main() {
-	// get home directory
-	home, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
+// describeCache summarizes whether a cached STAK will be used and why.
+func describeCache(found bool, stak kion.STAK, buffer time.Duration) string {
+	switch {
+	case config.Kion.DisableCache || slices.Contains(uncachedCategories(config.Kion.Cache), cache.CategoryStak):
+		return "disabled, a new STAK will be requested"
+	case stak != (kion.STAK{}):
+		return "using a cached STAK"
+	case found:
+		return fmt.Sprintf("cached STAK expires within %v, a new one will be requested", buffer)
+	default:
+		return "no cached STAK, a new one will be requested"
 	}
+}
 
-	// allow config file to be overridden by an env var, else use default
-	userConfigFile := os.Getenv("KION_CONFIG")
-	if userConfigFile != "" {
-		configPath = filepath.Clean(userConfigFile)
-	} else {
-		configPath = filepath.Join(home, configFile)
+// printDryRun reports what an action would have done with a stak or
+// federation URL rather than performing it. The detail is action specific,
+// the profile name when saving credentials or the command when running one.
+func printDryRun(action string, account string, carName string, region string, detail string) error {
+	env := "AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN"
+	if region != "" {
+		env += ", AWS_REGION"
 	}
 
-	// load configuration file
-	err = helper.LoadConfig(configPath, &config)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		color.Red(" Error: %v", err)
-		os.Exit(1)
+	var msg string
+	switch action {
+	case "credential-process":
+		msg = fmt.Sprintf("would print credential process json for %v on account %v to stdout", carName, account)
+	case "print":
+		msg = fmt.Sprintf("would print %v for %v on account %v to stdout", env, carName, account)
+	case "handoff":
+		msg = fmt.Sprintf("would print %v for %v on account %v to stdout encrypted to %v", env, carName, account, detail)
+	case "export":
+		msg = fmt.Sprintf("would export short-term access keys for %v on account %v to %v", carName, account, detail)
+	case "save":
+		msg = fmt.Sprintf("would write profile [%v] to the AWS credentials file", detail)
+	case "subshell":
+		msg = fmt.Sprintf("would start a sub-shell for %v on account %v with %v, KION_ACCOUNT_NUM, KION_ACCOUNT_ALIAS, KION_CAR set", carName, account, env)
+	case "run":
+		msg = fmt.Sprintf("would run %q with %v set", detail, env)
+	case "web":
+		msg = fmt.Sprintf("would open the web console for %v on account %v in the browser", carName, account)
+	case "web-url":
+		msg = fmt.Sprintf("would print a web console sign in link for %v on account %v to stdout", carName, account)
+	case "ssh-cert":
+		msg = fmt.Sprintf("would request an ssh certificate from %v in %v and add it to the ssh agent", detail, region)
+	case "serve-metadata":
+		msg = fmt.Sprintf("would serve short term access keys for %v on account %v at %v", carName, account, detail)
 	}
 
-	// prep default text for password
-	passwordDefaultText := ""
-	if config.Kion.Password != "" {
-		passwordDefaultText = "*****"
-	}
+	fmt.Fprintf(os.Stderr, "[dry-run] %v\n", msg)
+	return nil
+}
 
-	// prep default text for api key
-	apiKeyDefaultText := ""
-	if config.Kion.ApiKey != "" {
-		apiKeyDefaultText = "*****"
+// refreshSession trades the refresh token of a session for a new session,
+// caching it and using it for the rest of the run.
+func refreshSession(session kion.Session) (kion.Session, error) {
+	err := checkPrivateLink()
+	if err != nil {
+		return kion.Session{}, err
 	}
-
-	// convert relative path specified in config file to absolute path
-	samlMetadataFile := config.Kion.SamlMetadataFile
-	if samlMetadataFile != "" && !strings.HasPrefix(samlMetadataFile, "http") {
-		if !filepath.IsAbs(samlMetadataFile) {
-			// resolve the file path relative to the config path, which is the home directory
-			samlMetadataFile = filepath.Join(filepath.Dir(configPath), samlMetadataFile)
-		}
+	session, err = kion.RefreshSession(config.Kion.Url, session)
+	if err != nil {
+		return kion.Session{}, err
 	}
+	session = identifySession(session)
+	err = c.SetSession(session)
+	if err != nil {
+		return kion.Session{}, err
+	}
+	config.Kion.ApiKey = session.Access.Token
+	sessionToken = true
+	return session, nil
+}
 
-	// define app configuration
-	app := &cli.App{
-
-		////////////////
-		//  Metadata  //
-		////////////////
+// identifySession fills in the user a session belongs to when signing in
+// didn't say, such as with SAML, so cached data is kept per user.
+func identifySession(session kion.Session) kion.Session {
+	if session.UserName != "" {
+		return session
+	}
+	user, err := kion.GetCurrentUser(config.Kion.Url, session.Access.Token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to look up the signed in user, short-term access keys won't be cached: %v\n", err)
+		return session
+	}
+	session.UserName = user.Username
+	return session
+}
 
-		Name:                 "Kion CLI",
-		Version:              kionCliVersion,
-		Usage:                "Kion federation on the command line!",
-		EnableBashCompletion: true,
-		Before:               beforeCommands,
-		After:                afterCommands,
-		Metadata: map[string]interface{}{
-			"useUpdatedCloudAccessRoleAPI": false,
-		},
+// apiKeyUser names the user of an app api key in cache namespaces by a
+// digest of the key, keeping the key itself out of keyring item names.
+func apiKeyUser(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "api key " + hex.EncodeToString(sum[:6])
+}
 
-		////////////////////
-		//  Global Flags  //
+// setAuthToken sets the token to be used for querying the Kion API. If not
+// passed to the tool as an argument, set in the env, or present in the
+// configuration dotfile it will prompt the users to authenticate. Auth methods
+// are prioritized as follows: api/bearer token -> username/password -> saml.
+// If flags are set for multiple methods the highest priority method will be
+// used.
+func setAuthToken(cCtx *cli.Context) error {
+	if config.Kion.ApiKey == "" {
+		// if we still have an active session use it
+		session, found, err := c.GetSession()
+		if err != nil {
+			return err
+		}
+		if found && session.Access.Expiry != "" {
+			expiration, err := session.ExpiresAt()
+			if err != nil {
+				return err
+			}
+			if time.Until(expiration) > 0 {
+				// TODO: test token is good with an endpoint that is accessible to all
+				// user permission levels, if you get a 401 then assume token is bad
+				// due to caching a cred when a users password expired, and flush the
+				// cache instead...
+				config.Kion.ApiKey = session.Access.Token
+				sessionToken = true
+
+				// identify sessions cached before sessions named their user
+				if session.UserName == "" {
+					return c.SetSession(identifySession(session))
+				}
+				return nil
+			}
+
+			// see if we can use the refresh token rather than signing in again
+			if session.Refreshable(time.Now()) {
+				_, err = refreshSession(session)
+				if err == nil {
+					return nil
+				}
+				fmt.Fprintln(os.Stderr, color.YellowString("Unable to refresh the Kion session, signing in again: %v", err))
+			}
+		}
+
+		// sign in again the ways kion.reauth lists when set
+		if len(config.Kion.Reauth.Strategies) > 0 {
+			return reauthenticate()
+		}
+
+		// use the configured auth method, such as per profile when instances
+		// sign in through different identity providers
+		if method := config.Kion.AuthMethod; method != "" {
+			name, found := authMethods[method]
+			if !found {
+				return fmt.Errorf("unsupported kion.auth_method %q, expected api_key, password, or saml", method)
+			}
+			return signIn(name)
+		}
+
+		// check un / pw were set via flags and infer auth method
+		if config.Kion.Username != "" || config.Kion.Password != "" {
+			return signIn("Password")
+		}
+
+		// check if saml auth flags set and auth with saml if so
+		if config.Kion.SamlMetadataFile != "" && config.Kion.SamlIssuer != "" {
+			return signIn("SAML")
+		}
+
+		// if no token or session found, prompt for desired auth method
+		if !helper.IsInteractive() {
+			return errors.New("no Kion credentials are available without a terminal, set KION_API_KEY or kion.api_key to use an app api key, or configure a sign in method")
+		}
+		authMethod, err := helper.PromptSelect("How would you like to authenticate", kion.AuthenticatorNames())
+		if err != nil {
+			return err
+		}
+		return authenticate(authMethod)
+	}
+	return checkAPIKey()
+}
+
+// errSignInNeeded is returned when signing in needs a person but
+// --no-interactive is set.
+var errSignInNeeded = errors.New("signing in to Kion needs a browser or terminal but --no-interactive is set, sign in interactively first, set KION_API_KEY, or add api_key to kion.reauth.strategies")
+
+// signIn runs the named authenticator, failing up front with --no-interactive
+// when it signs in through a browser that needs a person.
+func signIn(name string) error {
+	if helper.NoInteractive && name == "SAML" {
+		return errSignInNeeded
+	}
+	return authenticate(name)
+}
+
+// reauthenticate signs in again with the strategies kion.reauth lists, tried
+// in order until one succeeds. Those needing a person are left out when there
+// is no terminal or --no-interactive is set.
+func reauthenticate() error {
+	strategies, err := helper.ReauthStrategies(config.Kion.Reauth.Strategies, helper.IsInteractive(), config.Kion.Password != "")
+	if err != nil {
+		return err
+	}
+	if len(strategies) == 0 {
+		return errSignInNeeded
+	}
+
+	var errs []error
+	for i, strategy := range strategies {
+		err = reauthWith(strategy)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%v: %w", strategy, err))
+		if i < len(strategies)-1 {
+			fmt.Fprintln(os.Stderr, color.YellowString("Unable to sign in with %v, trying %v: %v", strategy, strategies[i+1], err))
+		}
+	}
+	return fmt.Errorf("unable to sign in to Kion: %w", errors.Join(errs...))
+}
+
+// reauthWith signs in with a kion.reauth strategy. The api_key strategy uses
+// the fallback key as is, confirming Kion accepts it.
+func reauthWith(strategy string) error {
+	switch strategy {
+	case helper.ReauthAPIKey:
+		key := os.Getenv("KION_REAUTH_API_KEY")
+		if key == "" {
+			key = config.Kion.Reauth.APIKey
+		}
+		if key == "" {
+			return errors.New("no app api key to fall back to, set KION_REAUTH_API_KEY or kion.reauth.api_key")
+		}
+		_, err := kion.GetCurrentUser(config.Kion.Url, key)
+		if kion.IsStatus(err, 401) {
+			return fmt.Errorf("kion rejected the fallback api key, it may have expired or been revoked: %w", err)
+		}
+		config.Kion.ApiKey = key
+		sessionToken, apiKeyChecked = false, err == nil
+		return nil
+	case helper.ReauthPrompt:
+		authMethod, err := helper.PromptSelect("How would you like to authenticate", kion.AuthenticatorNames())
+		if err != nil {
+			return err
+		}
+		return authenticate(authMethod)
+	}
+	return authenticate(authMethods[strategy])
+}
+
+// checkAPIKey confirms once per run that Kion accepts an api key provided by
+// the user, so an expired or revoked key fails up front naming where it came
+// from rather than partway through a command. Tokens from sessions are not
+// checked, and Kion being unreachable is left to the command to handle.
+func checkAPIKey() error {
+	if sessionToken || apiKeyChecked {
+		return nil
+	}
+	_, err := kion.GetCurrentUser(config.Kion.Url, config.Kion.ApiKey)
+	if kion.IsStatus(err, 401) {
+		return fmt.Errorf("kion rejected the api key from %v, it may have expired or been revoked: %w", apiKeySource(), err)
+	}
+	apiKeyChecked = err == nil
+	return nil
+}
+
+// apiKeySource describes where the api key in use was provided.
+func apiKeySource() string {
+	for _, name := range []string{"KION_API_KEY", "CTKEY_APPAPIKEY"} {
+		if os.Getenv(name) != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("--token or kion.api_key in %v", configPath)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Commands                                                                  //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// readPasswordInput sets the password from stdin or a file descriptor when
+// the password-stdin or password-fd flags are used.
+func readPasswordInput(cCtx *cli.Context) error {
+	fromStdin := cCtx.Bool("password-stdin")
+	fromFD := cCtx.IsSet("password-fd")
+	if !fromStdin && !fromFD {
+		return nil
+	}
+	if fromStdin && fromFD {
+		return errors.New("only one of --password-stdin or --password-fd may be used")
+	}
+
+	input := os.Stdin
+	if fromFD {
+		fd := cCtx.Int("password-fd")
+		if fd < 0 {
+			return fmt.Errorf("invalid file descriptor: %v", fd)
+		}
+		input = os.NewFile(uintptr(fd), fmt.Sprintf("fd%v", fd))
+		defer input.Close()
+	}
+
+	pw, err := helper.ReadPassword(input)
+	if err != nil {
+		return err
+	}
+	config.Kion.Password = pw
+
+	return nil
+}
+
+// warnArgvSecrets warns when a password or token was passed as a global flag,
+// leaving it in shell history and process listings, and suggests safer
+// alternatives.
+func warnArgvSecrets(cCtx *cli.Context) {
+	// global flags are everything before the command
+	if len(os.Args) <= cCtx.Args().Len() {
+		return
+	}
+	globalArgs := os.Args[1 : len(os.Args)-cCtx.Args().Len()]
+
+	for _, flag := range helper.ArgvSecrets(globalArgs, cCtx.App.Flags) {
+		switch helper.SecretKind(flag) {
+		case "password":
+			fmt.Fprintf(os.Stderr, "Warning: passing a password with %v saves it to shell history and exposes it in process listings, use --password-stdin, --password-fd, or KION_PASSWORD instead\n", flag)
+		case "token":
+			fmt.Fprintf(os.Stderr, "Warning: passing a token with %v saves it to shell history and exposes it in process listings, set api_key in %v or use KION_API_KEY instead\n", flag, configPath)
+		}
+	}
+}
+
+// checkPrivateLink verifies Kion is reachable privately when it is configured
+// to be reached over private link, so being off the VPN is reported as such
+// rather than as a TLS or authentication failure. It is skipped when a proxy
+// or bastion is in use as names are then resolved on the far side.
+func checkPrivateLink() error {
+	if !config.API.PrivateLink || viaProxy() {
+		return nil
+	}
+	return kion.CheckPrivateLink(config.Kion.Url, config.API.PrivateCIDRs, config.API.PrivateLinkHint)
+}
+
+// invocation returns the name of the command being run, including its
+// subcommand if any, with aliases resolved. Arguments are never included.
+func invocation(app *cli.App, args []string) string {
+	cmd := app.Command(args[0])
+	if cmd == nil {
+		return ""
+	}
+	name := cmd.Name
+	if len(args) > 1 {
+		for _, sub := range cmd.Subcommands {
+			if sub.HasName(args[1]) {
+				name += " " + sub.Name
+				break
+			}
+		}
+	}
+	return name
+}
+
+// expandAlias replaces a configured alias given as the command with the
+// command line it stands for, before anything is parsed, so the result is
+// handled exactly as if it had been typed out. Global flags before the alias
+// are kept and arguments after it are appended. Built in commands take
+// precedence over aliases and aliases can't expand to other aliases.
+func expandAlias(app *cli.App, args []string, aliases map[string]string) ([]string, error) {
+	if len(aliases) == 0 {
+		return args, nil
+	}
+
+	i := commandIndex(app, args)
+	if i >= len(args) || app.Command(args[i]) != nil {
+		return args, nil
+	}
+	expansion, found := aliases[args[i]]
+	if !found {
+		return args, nil
+	}
+
+	fields, err := helper.SplitCommandLine(expansion)
+	if err != nil {
+		return nil, fmt.Errorf("unable to expand alias %v: %w", args[i], err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("alias %v is empty", args[i])
+	}
+	if _, nested := aliases[fields[0]]; nested && app.Command(fields[0]) == nil {
+		return nil, fmt.Errorf("alias %v expands to another alias, %v, which is not supported", args[i], fields[0])
+	}
+
+	expanded := append(slices.Clone(args[:i]), fields...)
+	return append(expanded, args[i+1:]...), nil
+}
+
+// validatingConfig reports whether a command line runs kion config validate
+// or kion doctor, which report a configuration file that can't be read.
+func validatingConfig(app *cli.App, args []string) bool {
+	i := commandIndex(app, args)
+	if i < len(args) && app.Command(args[i]) == app.Command("doctor") {
+		return true
+	}
+	return i+1 < len(args) && app.Command(args[i]) == app.Command("config") && args[i+1] == "validate"
+}
+
+// commandIndex returns the position of the command in a command line,
+// skipping global flags and their values.
+func commandIndex(app *cli.App, args []string) int {
+	i := 1
+	for i < len(args) && strings.HasPrefix(args[i], "-") && args[i] != "-" && args[i] != "--" {
+		if !strings.Contains(args[i], "=") && flagTakesValue(app.Flags, args[i]) {
+			i++
+		}
+		i++
+	}
+	return i
+}
+
+// rewriteDeprecatedFlags replaces deprecated global and command flags in a
+// command line with their current names, warning once about each, so they
+// keep working until their removal release. Flags of a subcommand are
+// rewritten when it directly follows its parent, as in "favorite add".
+func rewriteDeprecatedFlags(app *cli.App, args []string) []string {
+	i := commandIndex(app, args)
+	global, used := helper.RewriteDeprecatedFlags(args[1:i], helper.Deprecations, "", func(name string) bool {
+		return flagTakesValue(app.Flags, name)
+	})
+	rewritten := append(append([]string{args[0]}, global...), args[i:]...)
+
+	chain := commandChain(app.Commands, rewritten[i:])
+	if len(chain) > 0 {
+		command := chain[len(chain)-1]
+		i += len(chain)
+		flags, commandUsed := helper.RewriteDeprecatedFlags(rewritten[i:], helper.Deprecations, commandPath(chain), func(name string) bool {
+			return flagTakesValue(command.Flags, name)
+		})
+		rewritten = append(rewritten[:i:i], flags...)
+		used = append(used, commandUsed...)
+	}
+
+	for _, deprecation := range used {
+		deprecationWarnings.Warn(deprecation)
+	}
+	return rewritten
+}
+
+// checkOutputFormat rejects an unknown --output format, or a structured one
+// given to a command that only writes text.
+func checkOutputFormat(cCtx *cli.Context) error {
+	err := helper.ValidateOutputFormat(outputFormat)
+	if err != nil || outputFormat == "text" {
+		return err
+	}
+	chain := commandChain(cCtx.App.Commands, cCtx.Args().Slice())
+	if len(chain) == 0 || chain[0].Name == "help" {
+		return nil
+	}
+	if path := commandPath(chain); !slices.Contains(structuredCommands, path) {
+		return fmt.Errorf("kion %v does not support --output %v, supported by: %v", path, outputFormat, strings.Join(structuredCommands, ", "))
+	}
+	return nil
+}
+
+// addSchemaFlags gives machine facing commands a --schema flag, handled by
+// schemaCommand before the app runs.
+func addSchemaFlags(app *cli.App) {
+	var add func(commands []*cli.Command, parent string)
+	add = func(commands []*cli.Command, parent string) {
+		for _, cmd := range commands {
+			path := strings.TrimSpace(parent + " " + cmd.Name)
+			if _, found := machineOutputs[path]; found {
+				cmd.Flags = append(cmd.Flags, &cli.BoolFlag{
+					Name:  "schema",
+					Usage: "print the JSON Schema of this command's JSON output rather than running it",
+				})
+			}
+			add(cmd.Subcommands, path)
+		}
+	}
+	add(app.Commands, "")
+}
+
+// schemaCommand returns the machine facing command a command line asks the
+// output schema of with --schema, or an empty string. It is answered before
+// the app runs so required flags, configuration, and sign in are skipped.
+func schemaCommand(app *cli.App, args []string) string {
+	i := commandIndex(app, args)
+	chain := commandChain(app.Commands, args[i:])
+	path := commandPath(chain)
+	if _, found := machineOutputs[path]; !found {
+		return ""
+	}
+	for _, arg := range args[i+len(chain):] {
+		if arg == "--" {
+			break
+		}
+		if arg == "--schema" || arg == "-schema" {
+			return path
+		}
+	}
+	return ""
+}
+
+// printOutputSchema prints the JSON Schema of a machine facing command's
+// output. Structured output is versioned by schema_version, credential-process
+// by the Version AWS defines.
+func printOutputSchema(path string) error {
+	result := machineOutputs[path]
+	_, aws := result.(helper.CredentialProcessOutput)
+	schema, err := helper.OutputSchema("kion "+path+" output", result, !aws)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
+
+// commandChain returns the command named by the start of args and any
+// subcommands directly following it, such as favorite then add for
+// "fav add prod".
+func commandChain(commands []*cli.Command, args []string) []*cli.Command {
+	var chain []*cli.Command
+	for _, arg := range args {
+		var found *cli.Command
+		for _, cmd := range commands {
+			if cmd.HasName(arg) {
+				found = cmd
+				break
+			}
+		}
+		if found == nil {
+			break
+		}
+		chain = append(chain, found)
+		commands = found.Subcommands
+	}
+	return chain
+}
+
+// commandPath returns the space separated names of a command chain, such as
+// "favorite add", aliases replaced by the commands' names.
+func commandPath(chain []*cli.Command) string {
+	var names []string
+	for _, cmd := range chain {
+		names = append(names, cmd.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// flagTakesValue reports whether a flag such as --profile is followed by a
+// value.
+func flagTakesValue(flags []cli.Flag, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	for _, flag := range flags {
+		if !slices.Contains(flag.Names(), name) {
+			continue
+		}
+		if f, ok := flag.(cli.DocGenerationFlag); ok {
+			return f.TakesValue()
+		}
+		return false
+	}
+	return false
+}
+
+// checkManagedSettings returns an error if the configuration file, a global
+// flag, or an override changes a setting locked by the managed configuration,
+// then sets the locked settings again as a profile may have replaced them.
+func checkManagedSettings(cCtx *cli.Context, setFlags []string, overrides []string) error {
+	if managedConfig == nil {
+		return nil
+	}
+	err := managedConfig.CheckFile(configPath)
+	if err != nil {
+		return err
+	}
+	for _, flag := range setFlags {
+		key, found := managedFlagKeys[flag]
+		if !found {
+			continue
+		}
+		err = managedConfig.Check(key, cCtx.Value(flag), fmt.Sprintf("--%v or its environment variable", flag))
+		if err != nil {
+			return err
+		}
+	}
+	err = managedConfig.CheckOverrides(overrides)
+	if err != nil {
+		return err
+	}
+	return managedConfig.Apply(&config)
+}
+
+// setDialer routes requests to Kion through the SOCKS5 proxy or SSH bastion
+// set in the api configuration, if any.
+func setDialer() error {
+	var dial kion.DialFunc
+	var err error
+	switch {
+	case config.API.Socks5Proxy != "" && config.API.SSHJump != "":
+		return errors.New("only one of api.socks5_proxy and api.ssh_jump may be set")
+	case config.API.Proxy != "" && (config.API.Socks5Proxy != "" || config.API.SSHJump != ""):
+		return errors.New("only one of api.proxy, api.socks5_proxy, and api.ssh_jump may be set")
+	case config.API.Socks5Proxy != "":
+		dial, err = kion.SOCKS5Dialer(config.API.Socks5Proxy)
+	case config.API.SSHJump != "":
+		dial, err = kion.SSHJumpDialer(config.API.SSHJump, config.API.SSHIdentityFile)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	kion.SetDialer(dial)
+	return nil
+}
+
+// setProxy sends requests through the HTTP proxy set in the api
+// configuration, or those set in the environment when there is none.
+func setProxy() error {
+	return kion.SetProxy(config.API.Proxy, config.API.NoProxy)
+}
+
+// viaProxy reports whether requests to Kion are sent through a proxy or
+// bastion, so names are resolved on the far side rather than from here.
+func viaProxy() bool {
+	if config.API.Socks5Proxy != "" || config.API.SSHJump != "" {
+		return true
+	}
+	proxy, err := kion.ProxyFor(config.Kion.Url)
+	return err == nil && proxy != nil
+}
+
+// setTLS applies the CA bundle, client certificate, and certificate
+// verification settings in the api configuration to every request, warning
+// loudly when verification is turned off.
+func setTLS() error {
+	tlsConfig, err := kion.LoadTLSConfig(config.API.CABundle, config.API.ClientCert, config.API.ClientKey, config.API.Insecure)
+	if err != nil {
+		return fmt.Errorf("invalid api tls settings: %w", err)
+	}
+	if config.API.Insecure {
+		fmt.Fprintln(os.Stderr, color.RedString("WARNING: TLS certificate verification is disabled by --insecure or api.insecure_skip_verify. Anyone on the network path can read your credentials and keys. Use api.ca_bundle to trust an internal CA instead."))
+	}
+	kion.SetTLSConfig(tlsConfig)
+	return nil
+}
+
+// setClient applies the api timeout and retry settings to requests to Kion.
+func setClient() error {
+	kion.DefaultClient.Timeout = kion.DefaultTimeout
+	if config.API.Timeout != "" {
+		timeout, err := time.ParseDuration(config.API.Timeout)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid api.timeout %q, expected a duration such as 1m", config.API.Timeout)
+		}
+		kion.DefaultClient.Timeout = timeout
+	}
+	switch {
+	case config.API.Retries < 0:
+		kion.DefaultClient.Retries = 0
+	case config.API.Retries > 0:
+		kion.DefaultClient.Retries = config.API.Retries
+	default:
+		kion.DefaultClient.Retries = kion.DefaultRetries
+	}
+	return nil
+}
+
+// beforeCommands run after the context is ready but before any subcommands are
+// executed. Only inexpensive setup belongs here, anything that reaches out to
+// Kion should wait until a command needs it so cache hits stay fast.
+func beforeCommands(cCtx *cli.Context) error {
+	// warn about secrets passed as flags, even for offline commands
+	warnArgvSecrets(cCtx)
+
+	// trace what is done to stderr if asked to
+	setLogger(cCtx)
+
+	// time where the run is spent if asked to, reported after the command
+	if cCtx.Bool("profile-perf") {
+		kion.Timings = kion.NewTimingRecorder(started)
+	}
+
+	// reject output formats the command can't write before doing anything
+	if err := checkOutputFormat(cCtx); err != nil {
+		return err
+	}
+
+	// keep names from Kion out of the output if the terminal can't show them
+	stdout = helper.OutputWriter(os.Stdout, outputFormat)
+	if helper.ASCIIOutput {
+		color.Output = helper.NewASCIIWriter(color.Output)
+	}
+
+	// skip before bits if we don't need them (ie we're just printing help)
+	args := cCtx.Args().Slice()
+	if len(args) == 0 || slices.Contains(offlineCommands, args[0]) {
+		return nil
+	}
+
+	// grab all manually set global flags so we can honor them over the chosen
+	// profiles values and any overrides
+	setStrings := make(map[string]string)
+	var disableCacheFlagged bool
+	var noBrowserFlagged bool
+	var insecureFlagged bool
+	setGlobalFlags := cCtx.FlagNames()
+	for _, flag := range setGlobalFlags {
+		switch flag {
+		case "endpoint":
+			setStrings["endpoint"] = config.Kion.Url
+		case "user":
+			setStrings["user"] = config.Kion.Username
+		case "password":
+			setStrings["password"] = config.Kion.Password
+		case "idms":
+			setStrings["idms"] = config.Kion.IDMS
+		case "saml-metadata-file":
+			setStrings["saml-metadata-file"] = config.Kion.SamlMetadataFile
+		case "saml-sp-issuer":
+			setStrings["saml-sp-issuer"] = config.Kion.SamlIssuer
+		case "saml-callback-port":
+			setStrings["saml-callback-port"] = config.Kion.SamlCallbackPort
+		case "token":
+			setStrings["token"] = config.Kion.ApiKey
+		case "browser":
+			setStrings["browser"] = config.Kion.Browser
+		case "keyring-backend":
+			setStrings["keyring-backend"] = config.Kion.Keyring.Backend
+		case "disable-cache":
+			disableCacheFlagged = true
+		case "no-browser":
+			noBrowserFlagged = true
+		case "ca-bundle":
+			setStrings["ca-bundle"] = config.API.CABundle
+		case "client-cert":
+			setStrings["client-cert"] = config.API.ClientCert
+		case "client-key":
+			setStrings["client-key"] = config.API.ClientKey
+		case "insecure":
+			insecureFlagged = true
+		}
+	}
+
+	// override profile settings for this run only, before switching to one so
+	// the profile in use picks them up
+	overrides := cCtx.StringSlice("set")
+	profileOverrides, otherOverrides := helper.SplitProfileOverrides(overrides)
+	err := helper.ApplyConfigOverrides(&config, profileOverrides)
+	if err != nil {
+		return err
+	}
+
+	// switch profiles if specified
+	profileName := cCtx.String("profile")
+	if profileName != "" {
+		// grab the profile and if found and not empty override the default config
+		profile, found := config.Profiles[profileName]
+		if found {
+			config.Kion = profile.Kion
+			config.Favorites = profile.Favorites
+			config.Defaults = profile.Defaults
+			config.API = profile.API
+			config.SSHCert = profile.SSHCert
+			config.Processors = profile.Processors
+			config.Workspaces = profile.Workspaces
+		} else {
+			return fmt.Errorf("profile not found: %s", profileName)
+		}
+	}
+
+	// override the rest of the configuration for this run only
+	err = helper.ApplyConfigOverrides(&config, otherOverrides)
+	if err != nil {
+		return err
+	}
+
+	// honor any global flags that were set to maintain precedence
+	if profileName != "" || len(overrides) > 0 {
+		for key, value := range setStrings {
+			err := cCtx.Set(key, value)
+			if err != nil {
+				return err
+			}
+		}
+		if disableCacheFlagged {
+			config.Kion.DisableCache = true
+		}
+		if noBrowserFlagged {
+			config.Kion.NoBrowser = true
+		}
+		if insecureFlagged {
+			config.API.Insecure = true
+		}
+	}
+
+	// settings managed by the organization can't be changed
+	err = checkManagedSettings(cCtx, setGlobalFlags, overrides)
+	if err != nil {
+		return err
+	}
+
+	// expand ~ and, on windows, %USERPROFILE% and the like in file settings
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	helper.ExpandConfigPaths(&config, runtime.GOOS, home, os.Getenv)
+
+	// reach kion through a proxy or bastion if configured
+	err = setDialer()
+	if err != nil {
+		return err
+	}
+	err = setProxy()
+	if err != nil {
+		return err
+	}
+	err = setClient()
+	if err != nil {
+		return err
+	}
+	err = setTLS()
+	if err != nil {
+		return err
+	}
+
+	// identify ourselves and the command being run to kion
+	kion.UserAgent = helper.UserAgent(kionCliVersion, config.Kion.UserAgentSuffix)
+	if !config.Kion.NoInvocation {
+		kion.Invocation = invocation(cCtx.App, args)
+	}
+
+	// nothing more is needed by commands working only with the configuration
+	if slices.Contains(localCommands, args[0]) {
+		return nil
+	}
+
+	// read the password from stdin or a file descriptor if requested, this
+	// keeps it out of argv and in turn process listings
+	err = readPasswordInput(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// grab the kion url if not already set
+	err = setEndpoint()
+	if err != nil {
+		return err
+	}
+
+	// keep state and the encrypted file cache somewhere writable, read-only
+	// home directories are common on managed machines and in containers
+	stateDir, fallback := filesystem.StateDir(paths.State)
+	if fallback {
+		fmt.Fprintf(os.Stderr, "Warning: %v is not writable, using %v for cached data\n", paths.State, stateDir)
+	}
+	cacheDir := stateDir
+	if paths.Cache != paths.State {
+		cacheDir, fallback = filesystem.StateDir(paths.Cache)
+		if fallback {
+			fmt.Fprintf(os.Stderr, "Warning: %v is not writable, using %v for cached data\n", paths.Cache, cacheDir)
+		}
+	}
+	auditPath = filepath.Join(stateDir, "audit.log")
+	browserSessionsPath = filepath.Join(stateDir, "browser-sessions.json")
+	quotaPath = filepath.Join(stateDir, "quota.json")
+	supportDir = filepath.Join(stateDir, "support")
+
+	// keep pinned accounts out of the pickers and favorites
+	helper.PinnedAccounts, err = helper.ReadPins(pinsPath())
+	if err != nil {
+		return fmt.Errorf("unable to read the pinned accounts: %w", err)
+	}
+
+	// identify this device when signing in so sessions can be tied to it
+	if !dryRun {
+		kion.DeviceID, err = helper.DeviceID(filepath.Join(stateDir, "device-id"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to read or create the device id, it won't be sent: %v\n", err)
+		}
+	}
+
+	// initialize the keyring, or the encrypted file standing in for one
+	stop := kion.Timings.Time(kion.PhaseCache, "open keyring")
+	ring, err := openKeyring(cacheDir)
+	stop()
+	if err != nil {
+		return err
+	}
+
+	// initialize the cache, namespaced so changing instances, users, or
+	// profiles never serves cached data from another. App api keys are their
+	// own user, otherwise data is kept per user of the session once signed
+	// in, as SAML and prompted sign ins aren't known by name before then
+	profile := cCtx.String("profile")
+	namespace := cache.Namespace(config.Kion.Url, config.Kion.Username, profile)
+	if config.Kion.ApiKey != "" {
+		namespace = cache.Namespace(config.Kion.Url, apiKeyUser(config.Kion.ApiKey), profile)
+	}
+	if config.Kion.DisableCache {
+		cacheBackend = "disabled"
+		c = cache.NewNullCache(ring, namespace)
+	} else {
+		realCache := cache.NewCache(ring, namespace)
+		if config.Kion.ApiKey == "" {
+			realCache.ScopeToSessionUser(func(user string) string {
+				return cache.Namespace(config.Kion.Url, user, profile)
+			})
+		}
+		if dryRun {
+			realCache.ReadOnly()
+		}
+
+		// refuse a cache written by a newer version rather than corrupt it
+		err = realCache.CheckFormat(kionCliVersion)
+		var newer *cache.NewerFormatError
+		if errors.As(err, &newer) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to check the cache format: %v\n", err)
+		}
+		if !dryRun {
+			err = realCache.MigrateLegacy()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: unable to migrate the existing cache, it will be ignored: %v\n", err)
+			}
+			keyLockDir, cacheNamespace = cacheDir, namespace
+		}
+		c = cache.NewTolerantCache(realCache, os.Stderr)
+	}
+
+	// report rather than perform writes and credential requests if dry running
+	if dryRun {
+		kion.DryRun = true
+		c = cache.NewDryRunCache(c, os.Stderr)
+	}
+
+	// leave out the kinds of data configured not to be cached
+	if disabled := uncachedCategories(config.Kion.Cache); len(disabled) > 0 {
+		cacheBackend = fmt.Sprintf("%v, not caching %v", cacheBackend, strings.Join(disabled, ", "))
+		c = cache.NewSelectiveCache(c, disabled...)
+	}
+
+	// time cache calls if profiling
+	if kion.Timings != nil {
+		c = cache.NewTimedCache(c)
+	}
+
+	return nil
+}
+
+// uncachedCategories returns the cache categories turned off in settings.
+func uncachedCategories(settings structs.CacheControl) []string {
+	var disabled []string
+	for _, setting := range []struct {
+		category string
+		enabled  *bool
+	}{
+		{cache.CategoryStak, settings.Stak},
+		{cache.CategorySession, settings.Session},
+		{cache.CategoryInventory, settings.Inventory},
+	} {
+		if setting.enabled != nil && !*setting.enabled {
+			disabled = append(disabled, setting.category)
+		}
+	}
+	return disabled
+}
+
+// setLogger traces requests, SAML sign in steps, and cache lookups to stderr
+// with --verbose, adding the headers and bodies of requests and responses
+// with --debug.
+func setLogger(cCtx *cli.Context) {
+	var level slog.Level
+	switch {
+	case cCtx.Bool("debug"):
+		level = slog.LevelDebug
+	case cCtx.Bool("verbose"):
+		level = slog.LevelInfo
+	default:
+		return
+	}
+	kion.Log = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// openKeyring opens the keyring the cache is kept in, the keyring backend
+// chosen with kion.keyring.backend or else the first available. The file
+// backend is a single passphrase encrypted file in cacheDir, or
+// kion.keyring.file_dir, rather than keyring's own file per entry. The
+// backend opened is kept in cacheBackend.
+func openKeyring(cacheDir string) (keyring.Keyring, error) {
+	settings := config.Kion.Keyring
+	passphrase := helper.KeyringPassphrase(settings.PassphrasePrompt, os.Getenv("KION_KEYRING_PASSPHRASE"), helper.IsInteractive(), helper.PromptPassword)
+	cfg, err := helper.KeyringConfig(settings, cacheDir, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// a chosen backend is used or fails on its own, never falling back to
+	// another that might prompt
+	if len(cfg.AllowedBackends) == 1 {
+		backend := cfg.AllowedBackends[0]
+		err = helper.UnavailableKeyringBackend(backend, keyring.AvailableBackends())
+		if err != nil {
+			return nil, err
+		}
+		if backend == keyring.FileBackend {
+			return openFileKeyring(cfg), nil
+		}
+		ring, err := keyring.Open(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the %v keyring backend: %w", backend, err)
+		}
+		cacheBackend = fmt.Sprintf("keyring (%v)", backend)
+		return cache.FitKeyring(ring, backend), nil
+	}
+
+	// open the backends in keyring's own order one at a time to learn which
+	// one is used
+	for _, backend := range keyring.AvailableBackends() {
+		if backend == keyring.FileBackend {
+			return openFileKeyring(cfg), nil
+		}
+		cfg.AllowedBackends = []keyring.BackendType{backend}
+		ring, err := keyring.Open(cfg)
+		if err == nil {
+			cacheBackend = fmt.Sprintf("keyring (%v)", backend)
+			return cache.FitKeyring(ring, backend), nil
+		}
+	}
+	return nil, keyring.ErrNoAvailImpl
+}
+
+// openFileKeyring opens the encrypted file backend in the directory and with
+// the passphrase of cfg.
+func openFileKeyring(cfg keyring.Config) keyring.Keyring {
+	path := filepath.Join(cfg.FileDir, cache.FileCacheName)
+	cacheBackend = fmt.Sprintf("keyring (%v, %v)", keyring.FileBackend, path)
+	return cache.NewFileKeyring(path, cfg.FilePasswordFunc, kionCliVersion, os.Stderr)
+}
+
+// genStaks generates short term access keys by walking users through an
+// interactive prompt. Short term access keys are either printed to stdout or a
+// sub-shell is created with them set in the environment.
+func genStaks(cCtx *cli.Context) error {
+	return generateSTAK(cCtx, cCtx.Args().First(), cCtx.String("save-profile"))
+}
+
+// stakSave saves short term access keys to the named profile in the AWS
+// credentials file, for the favorite given after it or else an account and
+// cloud access role.
+func stakSave(cCtx *cli.Context) error {
+	if cCtx.NArg() == 0 || cCtx.NArg() > 2 {
+		return errors.New("expected the name of the profile to save, optionally followed by a favorite")
+	}
+	return generateSTAK(cCtx, cCtx.Args().Get(1), cCtx.Args().First())
+}
+
+// generateSTAK generates short term access keys for the favorite named, or
+// else the account and cloud access role given by flags or chosen with the
+// pickers. When profile is set the keys are saved to that profile in the AWS
+// credentials file.
+func generateSTAK(cCtx *cli.Context, favoriteName string, profile string) error {
+	// stub out placeholders
+	var car kion.CAR
+	var stak kion.STAK
+
+	// set vars for easier access
+	endpoint := config.Kion.Url
+	carName := cCtx.String("car")
+	account := cCtx.String("account")
+	region := cCtx.String("region")
+	policyPath := cCtx.String("session-policy")
+
+	// a favorite named as an argument stands in for --account and --car
+	if name := favoriteName; name != "" {
+		if account != "" || carName != "" {
+			return errors.New("pass either a favorite or --account and --car, not both")
+		}
+		_, fMap := helper.MapFavs(config.Favorites)
+		favorite, found := fMap[name]
+		if !found {
+			return fmt.Errorf("favorite not found: %v", name)
+		}
+		if favorite.AccessType == kion.AccessLevelWeb {
+			return fmt.Errorf("favorite %v uses web access, short term access keys require cli access", name)
+		}
+		favorite, err := resolveFavorite(cCtx, favorite)
+		if err != nil {
+			return err
+		}
+		err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+		if err != nil {
+			return err
+		}
+		account, carName = favorite.Account, favorite.CAR
+		if region == "" {
+			region = favorite.Region
+		}
+		if policyPath == "" {
+			policyPath = favorite.SessionPolicy
+		}
+	}
+	policy, err := readSessionPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+	cacheKey := stakCacheKey(carName, account, policy)
+
+	// grab the command usage [stak, s, setenv, savecreds, etc]
+	cmdUsed := cCtx.Lineage()[1].Args().First()
+
+	// only aws accounts provide short term access keys, so only offer those
+	switch cloud := cCtx.String("cloud"); cloud {
+	case "":
+		err := cCtx.Set("cloud", kion.CloudAWS)
+		if err != nil {
+			return err
+		}
+	case kion.CloudAWS, kion.CloudAzure, kion.CloudGCP:
+	default:
+		return fmt.Errorf("short term credentials are only available for AWS, Azure, and GCP accounts, not %v", helper.CloudName(cloud))
+	}
+
+	// keys handed off are only ever printed, encrypted
+	recipients := cCtx.StringSlice("encrypt-to")
+	if len(recipients) > 0 && (cCtx.Bool("credential-process") || profile != "" || cCtx.Bool("save") || cmdUsed == "savecreds") {
+		return errors.New("--encrypt-to prints the encrypted keys, it can't be used with --credential-process or when saving them")
+	}
+
+	// keys exported to secret stores are neither printed nor saved
+	destinations := cCtx.StringSlice("export")
+	if len(destinations) > 0 && (len(recipients) > 0 || cCtx.Bool("credential-process") || cCtx.Bool("print") || profile != "" || cCtx.Bool("save") || cmdUsed == "savecreds") {
+		return errors.New("--export writes the keys to secret stores, it can't be used with --print, --encrypt-to, --credential-process, or when saving them")
+	}
+	exporters, err := newExporters(destinations)
+	if err != nil {
+		return err
+	}
+
+	// determine action and set required cache validity buffer
+	var action string
+	var buffer time.Duration
+	if len(recipients) > 0 {
+		action = "handoff"
+		buffer = 600
+	} else if len(exporters) > 0 {
+		action = "export"
+		buffer = 600
+	} else if cCtx.Bool("credential-process") {
+		action = "credential-process"
+		buffer = 5
+	} else if profile != "" {
+		action = "save"
+		buffer = 600
+	} else if cCtx.Bool("print") || cmdUsed == "setenv" || outputFormat != "text" {
+		action = "print"
+		buffer = 300
+	} else if cCtx.Bool("save") || cmdUsed == "savecreds" {
+		action = "save"
+		buffer = 600
+	} else {
+		action = "subshell"
+		buffer = 300
+	}
+
+	// if we have what we need go look stuff up without prompts do it
+	var cachedSTAK kion.STAK
+	var found bool
+	var staleSince time.Time
+	if account != "" && carName != "" {
+		// determine if we have a valid cached entry
+		cachedSTAK, found, err = c.GetStak(cacheKey)
+		if err != nil {
+			return err
+		}
+		getCar := true
+		if found && cachedSTAK.ValidFor(buffer*time.Second) {
+			// cached stak found and is still valid
+			stak = cachedSTAK
+			// the role name is needed for the profile keys are saved to when
+			// none is named
+			if action != "subshell" && (action != "save" || profile != "") {
+				getCar = false
+			}
+		}
+
+		// grab the car if needed
+		if getCar {
+			// handle auth
+			err := setAuthToken(cCtx)
+			if err != nil {
+				return err
+			}
+
+			err = withReauth(cCtx, func() error {
+				var err error
+				car, err = kion.GetCARByNameAndAccount(endpoint, config.Kion.ApiKey, carName, account)
+				return err
+			})
+
+			// keys still valid stand in while kion is down
+			if err != nil && kion.IsUnreachable(err) && found && cachedSTAK.ValidFor(outageFallbackValidity) {
+				fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, "using the cached short-term access keys valid until "+cachedSTAK.Expiration.Local().Format("15:04 MST"))))
+				stak = cachedSTAK
+				car = kion.CAR{Name: carName, AccountNumber: account}
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		// handle auth
+		err := setAuthToken(cCtx)
+		if err != nil {
+			return err
+		}
+
+		// run through the car selector to fill any gaps
+		staleSince, err = selectCAR(cCtx, &car)
+		if err != nil {
+			return err
+		}
+
+		// rebuild cache key and determine if we have a valid cached entry
+		cacheKey = stakCacheKey(car.Name, car.AccountNumber, policy)
+		cachedSTAK, found, err = c.GetStak(cacheKey)
+		if err != nil {
+			return err
+		}
+		if found && cachedSTAK.ValidFor(buffer*time.Second) {
+			// cached stak found and is still valid
+			stak = cachedSTAK
+		}
+	}
+
+	// show what will be requested and confirm if asked to
+	if car.Name != "" {
+		carName = car.Name
+		account = car.AccountNumber
+	}
+	err = helper.RequireAccessLevel(car, kion.AccessLevelCLI)
+	if err != nil {
+		return err
+	}
+	if region == "" && action != "credential-process" {
+		region = labeledRegion(account, car.AccountID)
+	}
+
+	// azure and gcp accounts are issued their own credentials
+	cloud := car.Cloud()
+	if cloud == "" {
+		cloud = kion.CloudForAccountNumber(account)
+	}
+	if cloud == kion.CloudAzure || cloud == kion.CloudGCP {
+		return cloudCredentials(cCtx, cloud, action, account, car.AccountName, carName, region, policy)
+	}
+	err = confirmPreflight(cCtx, helper.Preflight{
+		Account:     account,
+		AccountName: car.AccountName,
+		CAR:         carName,
+		Access:      describeAction(action),
+		Duration:    describeDuration(stak),
+		Region:      region,
+		Cache:       describeCache(found, stak, buffer*time.Second),
+		Data:        describeData(staleSince),
+	})
+	if err != nil {
+		return err
+	}
+
+	// grab a new stak if needed, unless a concurrent run just did
+	if stak == (kion.STAK{}) {
+		stak, err = sharedSTAK(cacheKey, buffer, func() (kion.STAK, error) {
+			// handle auth
+			err := setAuthToken(cCtx)
+			if err != nil {
+				return kion.STAK{}, err
+			}
+			return fetchSTAK(cCtx, car.Name, car.AccountNumber, policy)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// keys are saved as ACCOUNT_ROLE unless a profile is named, replacing a
+	// profile of that name as earlier versions did
+	replaceProfile := profile == ""
+	if profile == "" {
+		profile = helper.AWSProfileName(car)
+	}
+
+	// describe the action instead of running it when dry running
+	if dryRun {
+		if action == "handoff" {
+			return printDryRun(action, car.AccountNumber, car.Name, region, strings.Join(recipients, ", "))
+		}
+		if action == "export" {
+			return printDryRun(action, account, carName, region, strings.Join(destinations, ", "))
+		}
+		return printDryRun(action, car.AccountNumber, car.Name, region, profile)
+	}
+
+	// run the action
+	recordAccess(action, account, carName)
+	switch action {
+	case "credential-process":
+		// NOTE: do not use os.Stderr here else credentials can be written to logs
+		return helper.PrintCredentialProcess(os.Stdout, stak)
+	case "print":
+		return printSTAK(stdout, stak, car.AccountNumber, car.Name, region)
+	case "handoff":
+		return handoff(recipients, func(w io.Writer) error {
+			return printSTAK(w, stak, car.AccountNumber, car.Name, region)
+		})
+	case "export":
+		return exportSTAK(exporters, destinations, stak, export.Source{Account: account, CAR: carName, Region: region})
+	case "save":
+		return helper.SaveAWSCreds(stdout, stak, profile, replaceProfile)
+	case "subshell":
+		return helper.CreateSubShell(car.AccountNumber, car.AccountName, car.Name, stak, region)
+	default:
+		return nil
+	}
+}
+
+// newExporters builds the exporters for the secret store destinations given
+// with --export, so mistakes are caught before any keys are requested.
+func newExporters(destinations []string) ([]export.Exporter, error) {
+	var exporters []export.Exporter
+	for _, destination := range destinations {
+		exporter, err := export.New(destination)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
+
+// exportSTAK writes short term access keys to each secret store in turn,
+// noting each on stderr, and stops at the first that fails.
+func exportSTAK(exporters []export.Exporter, destinations []string, stak kion.STAK, source export.Source) error {
+	for i, exporter := range exporters {
+		err := exporter.Export(context.Background(), stak, source)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported short-term access keys for %v on account %v to %v, valid until %v\n", source.CAR, source.Account, destinations[i], stak.Expiration.Local().Format("15:04 MST"))
+	}
+	return nil
+}
+
+// printSTAK prints short term access keys as export statements or, with
+// --output, in a structured format.
+func printSTAK(out io.Writer, stak kion.STAK, account string, carName string, region string) error {
+	output := helper.NewSTAKOutput(stak, account, carName, region)
+	return helper.WriteOutput(out, outputFormat, output, func(w io.Writer) error {
+		return helper.PrintSTAK(w, stak, region)
+	})
+}
+
+// handoff prints what write does encrypted to the recipients, for credentials
+// handed to another person. Nothing is printed unless encryption succeeds.
+func handoff(recipients []string, write func(w io.Writer) error) error {
+	var plaintext bytes.Buffer
+	err := write(&plaintext)
+	if err != nil {
+		return err
+	}
+	sealed, err := helper.EncryptHandoff(recipients, plaintext.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(sealed)
+	return err
+}
+
+// cloudCredentials requests short-lived credentials for a cloud access role
+// on an Azure or GCP account and prints them or starts a sub-shell with them
+// as generateSTAK does with keys. They aren't cached, and credential processes
+// and credential files are AWS concepts so are refused.
+func cloudCredentials(cCtx *cli.Context, cloud string, action string, account string, accountName string, carName string, region string, policy string) error {
+	switch {
+	case action == "credential-process":
+		return fmt.Errorf("account %v is a %v account, credential processes are only available for AWS accounts", account, helper.CloudName(cloud))
+	case action == "save":
+		return fmt.Errorf("account %v is a %v account, credential files are only available for AWS accounts", account, helper.CloudName(cloud))
+	case action == "export":
+		return fmt.Errorf("account %v is a %v account, exporting to secret stores is only available for AWS accounts", account, helper.CloudName(cloud))
+	case policy != "":
+		return fmt.Errorf("account %v is a %v account, session policies are only available for AWS accounts", account, helper.CloudName(cloud))
+	}
+	err := confirmPreflight(cCtx, helper.Preflight{
+		Account:     account,
+		AccountName: accountName,
+		CAR:         carName,
+		Access:      describeCloudAction(cloud, action),
+		Duration:    "set by the cloud access role when issued",
+		Region:      region,
+		Cache:       "not cached for " + helper.CloudName(cloud) + " accounts, new credentials will be requested",
+	})
+	if err != nil {
+		return err
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+	creds, err := fetchCloudCredentials(cCtx, cloud, carName, account)
+	if err != nil {
+		return err
+	}
+	output := helper.NewCloudCredentialsOutput(creds, account, carName, region)
+
+	// describe the action instead of running it when dry running
+	if dryRun {
+		return printCloudDryRun(action, account, carName, output.EnvVars(), strings.Join(cCtx.StringSlice("encrypt-to"), ", "))
+	}
+
+	recordAccess(action, account, carName)
+	printCreds := func(out io.Writer) error {
+		return helper.WriteOutput(out, outputFormat, output, func(w io.Writer) error {
+			exports, err := helper.ShellExports("bash", output.EnvVars())
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, exports)
+			return err
+		})
+	}
+	switch action {
+	case "print":
+		return printCreds(stdout)
+	case "handoff":
+		return handoff(cCtx.StringSlice("encrypt-to"), printCreds)
+	case "subshell":
+		return helper.CreateCloudSubShell(account, accountName, carName, output.EnvVars())
+	default:
+		return nil
+	}
+}
+
+// describeCloudAction explains what will be done with the credentials of an
+// Azure or GCP account.
+func describeCloudAction(cloud string, action string) string {
+	switch action {
+	case "subshell":
+		return helper.CloudName(cloud) + " credentials, in a sub-shell"
+	case "handoff":
+		return helper.CloudName(cloud) + " credentials, encrypted for hand-off and printed to stdout"
+	}
+	return helper.CloudName(cloud) + " credentials, printed to stdout"
+}
+
+// runCloudCommand runs a command with the credentials of a cloud access role
+// on an Azure or GCP account set in its environment, as runCommand does with
+// short term access keys.
+func runCloudCommand(cCtx *cli.Context, cloud string, account string, carName string, region string, policyPath string, args []string) error {
+	switch {
+	case cCtx.Bool("creds-fd"):
+		return fmt.Errorf("account %v is a %v account, --creds-fd passes an AWS credentials file so is only available for AWS accounts", account, helper.CloudName(cloud))
+	case policyPath != "":
+		return fmt.Errorf("account %v is a %v account, session policies are only available for AWS accounts", account, helper.CloudName(cloud))
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+	creds, err := fetchCloudCredentials(cCtx, cloud, carName, account)
+	if err != nil {
+		return err
+	}
+	vars := helper.NewCloudCredentialsOutput(creds, account, carName, region).EnvVars()
+
+	if dryRun {
+		return printCloudDryRun("run", account, carName, vars, strings.Join(args, " "))
+	}
+	recordAccess("run", account, carName)
+	return helper.RunCloudCommand(vars, args[0], args[1:]...)
+}
+
+// palette offers everything Kion CLI can do in one searchable list: favorites,
+// recently used cloud access roles, the roles on each account in the cached
+// inventory, and commands. The one chosen is run as if typed, along with the
+// global flags palette was given.
+func palette(cCtx *cli.Context) error {
+	if !helper.IsInteractive() {
+		return errors.New("palette needs an interactive terminal, run the command directly instead")
+	}
+
+	index, _ := helper.ReadCompletionIndex(completionIndexPath())
+	actions := helper.PaletteFavorites(config.Favorites, index)
+	if auditPath != "" {
+		entries, err := helper.ReadAudit(auditPath)
+		if err == nil {
+			actions = append(actions, helper.PaletteRecent(entries, config.Kion.Url, helper.PaletteRecentLimit, time.Now())...)
+		}
+	}
+	// the cached inventory is offered however old, as fetching it would hold
+	// up the palette opening
+	inventory, found, err := c.GetInventory()
+	if err == nil && found {
+		actions = append(actions, helper.PaletteAccounts(inventory.CARs)...)
+	}
+	actions = append(actions, helper.PaletteCommands(cCtx.App.Commands, "palette", "help", "credential-process", "completion", "shell-init")...)
+
+	action, err := helper.PromptPalette(actions)
+	if err != nil {
+		return err
+	}
+	args := append(slices.Clone(os.Args[:commandIndex(cCtx.App, os.Args)]), action.Args...)
+	line := helper.JoinCommandLine(append([]string{"kion"}, args[1:]...))
+	if cCtx.Bool("print") {
+		fmt.Println(line)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Running %v\n", line)
+	return cCtx.App.RunContext(cCtx.Context, args)
+}
+
+// fetchCloudCredentials requests credentials for a cloud access role on an
+// Azure or GCP account, queueing the request while Kion is unreachable as
+// fetchSTAK does.
+func fetchCloudCredentials(cCtx *cli.Context, cloud string, carName string, account string) (kion.CloudCredentials, error) {
+	window, err := outageRetryWindow()
+	if err != nil {
+		return kion.CloudCredentials{}, err
+	}
+
+	var creds kion.CloudCredentials
+	err = helper.RetryWhileUnreachable(cCtx.Context, window, func() error {
+		return withReauth(cCtx, func() error {
+			return stakPacer.Do(cCtx.Context, func() error {
+				var err error
+				creds, err = kion.GetCloudCredentials(config.Kion.Url, config.Kion.ApiKey, carName, account, cloud)
+				return err
+			})
+		})
+	}, func(err error, wait time.Duration) {
+		fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, fmt.Sprintf("retrying the request for %v credentials in %v", helper.CloudName(cloud), wait))))
+	})
+	if errors.Is(err, kion.ErrDryRun) {
+		return creds, nil
+	}
+	if err != nil {
+		recordAttempt("stak", account, carName, err)
+		return creds, explainAccessError(err, carName, account, "cli")
+	}
+	issuedDuration = time.Duration(creds.Duration) * time.Second
+	notifyIssuance(helper.IssuanceEvent{Cloud: cloud, Account: account, CAR: carName, Expiration: expirationOf(creds.Expiration)})
+	return creds, nil
+}
+
+// printCloudDryRun reports what an action would have done with the
+// credentials of an Azure or GCP account, set as vars, rather than performing
+// it. The detail is the command when running one.
+func printCloudDryRun(action string, account string, carName string, vars []string, detail string) error {
+	var names []string
+	for _, v := range vars {
+		name, _, _ := strings.Cut(v, "=")
+		names = append(names, name)
+	}
+	env := strings.Join(names, ", ")
+
+	var msg string
+	switch action {
+	case "print":
+		msg = fmt.Sprintf("would print %v for %v on account %v to stdout", env, carName, account)
+	case "handoff":
+		msg = fmt.Sprintf("would print %v for %v on account %v to stdout encrypted to %v", env, carName, account, detail)
+	case "subshell":
+		msg = fmt.Sprintf("would start a sub-shell for %v on account %v with %v, KION_ACCOUNT_NUM, KION_ACCOUNT_ALIAS, KION_CAR set", carName, account, env)
+	case "run":
+		msg = fmt.Sprintf("would run %q with %v set", detail, env)
+	}
+
+	fmt.Fprintf(os.Stderr, "[dry-run] %v\n", msg)
+	return nil
+}
+
+// favorites generates short term access keys or launches the web console
+// from stored favorites. If a favorite is found that matches the passed
+// argument it is used, otherwise the user is walked through a wizard to make a
+// selection.
+func favorites(cCtx *cli.Context) error {
+	// map our favorites for ease of use, offering only those in the requested
+	// cloud when prompting
+	err := helper.ValidateCloud(cCtx.String("cloud"))
+	if err != nil {
+		return err
+	}
+	offerRecommended(cCtx)
+	_, fMap := helper.MapFavs(config.Favorites)
+	pNames, _ := helper.MapFavs(helper.FilterPinnedFavorites(helper.FilterFavoritesByCloud(config.Favorites, cCtx.String("cloud"))))
+
+	// if arg passed is a valid favorite use it else prompt
+	var fav string
+	if _, found := fMap[cCtx.Args().First()]; found {
+		fav = cCtx.Args().First()
+	} else {
+		if len(pNames) == 0 {
+			return fmt.Errorf("no favorites found for %v", helper.CloudName(cCtx.String("cloud")))
+		}
+		fav, err = helper.PromptSelect("Choose a Favorite:", pNames)
+		if err != nil {
+			return err
+		}
+	}
+
+	// use the requested access level over the favorite's access type
+	favorite := fMap[fav]
+	switch level := cCtx.String("access-level"); level {
+	case "":
+	case kion.AccessLevelCLI, kion.AccessLevelWeb:
+		favorite.AccessType = level
+	default:
+		return fmt.Errorf("unsupported access level %q, expected cli or web", level)
+	}
+
+	// fill in the favorite's parameters from flags, or prompt for them
+	params, err := favoriteParameters(cCtx, favorite)
+	if err != nil {
+		return err
+	}
+	if params["region"] != "" {
+		favorite.Region = params["region"]
+	}
+	var duration time.Duration
+	if params["duration"] != "" {
+		duration, err = time.ParseDuration(params["duration"])
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid duration %q, expected one such as 2h", params["duration"])
+		}
+	}
+
+	// resolve the favorite to an account and role
+	favorite, err = resolveFavorite(cCtx, favorite)
+	if err != nil {
+		return err
+	}
+	err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+	if err != nil {
+		return err
+	}
+
+	// determine favorite action, default to cli unless explicitly set to web
+	if favorite.AccessType == "web" {
+		if cCtx.String("session-policy") != "" {
+			return fmt.Errorf("favorite %v uses web access, session policies require cli access", favorite.Name)
+		}
+		return favoriteConsole(cCtx, favorite, params["service"])
+	}
+	if path := cCtx.String("session-policy"); path != "" {
+		favorite.SessionPolicy = path
+	}
+
+	// determine action and set required cache validity buffer
+	var action string
+	var buffer time.Duration
+	if cCtx.Bool("credential-process") {
+		action = "credential-process"
+		buffer = 5
+	} else if cCtx.Bool("print") || outputFormat != "text" {
+		action = "print"
+		buffer = 300
+	} else {
+		action = "subshell"
+		buffer = 300
+	}
+
+	// azure and gcp accounts are issued their own credentials
+	if cloud := helper.FavoriteCloud(favorite); cloud == kion.CloudAzure || cloud == kion.CloudGCP {
+		return cloudCredentials(cCtx, cloud, action, favorite.Account, favorite.Name, favorite.CAR, favorite.Region, favorite.SessionPolicy)
+	}
+
+	// keys must stay valid for the duration asked for, if longer
+	if need := duration / time.Second; need > buffer {
+		buffer = need
+	}
+	stak, err := favoriteSTAK(cCtx, favorite, buffer)
+	if err != nil {
+		return err
+	}
+	if duration > 0 && !stak.Expiration.IsZero() && !stak.ValidFor(duration) {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: the short term access keys expire at %v, before the %v asked for", stak.Expiration.Local().Format(time.Kitchen), duration))
+	}
+	if favorite.Region == "" && action != "credential-process" {
+		favorite.Region = labeledRegion(favorite.Account, 0)
+	}
+
+	// describe the action instead of running it when dry running
+	if dryRun {
+		return printDryRun(action, favorite.Account, favorite.CAR, favorite.Region, "")
+	}
+
+	// cred process output, print, or create sub-shell
+	recordAccess(action, favorite.Account, favorite.CAR)
+	switch action {
+	case "credential-process":
+		// NOTE: do not use os.Stderr here else credentials can be written to logs
+		return helper.PrintCredentialProcess(os.Stdout, stak)
+	case "print":
+		return printSTAK(stdout, stak, favorite.Account, favorite.CAR, favorite.Region)
+	case "subshell":
+		return helper.CreateSubShell(favorite.Account, favorite.Name, favorite.CAR, stak, favorite.Region)
+	default:
+		return nil
+	}
+}
+
+// elevate takes time-boxed elevated access with a favorite's cloud access
+// role, for break-glass work such as incident response. Fresh short term
+// access keys are minted and the reason noted in the audit log. The keys are
+// cached only until the deadline, and the sub-shell they are set in is warned
+// shortly before it and closed once it passes.
+func elevate(cCtx *cli.Context) error {
+	reason := strings.TrimSpace(cCtx.String("reason"))
+	if reason == "" {
+		return errors.New("a --reason for elevated access is required, such as an incident number")
+	}
+	duration := cCtx.Duration("for")
+	if duration <= 0 {
+		return errors.New("a --for duration is required, such as 30m")
+	}
+
+	// use the favorite named or prompt for one
+	_, fMap := helper.MapFavs(config.Favorites)
+	name := cCtx.Args().First()
+	if name == "" {
+		pNames, _ := helper.MapFavs(helper.FilterPinnedFavorites(config.Favorites))
+		if len(pNames) == 0 {
+			return errors.New("no favorites found")
+		}
+		var err error
+		name, err = helper.PromptSelect("Choose a Favorite to Elevate:", pNames)
+		if err != nil {
+			return err
+		}
+	}
+	favorite, found := fMap[name]
+	if !found {
+		return fmt.Errorf("favorite not found: %v", name)
+	}
+	if favorite.AccessType == kion.AccessLevelWeb {
+		return fmt.Errorf("favorite %v uses web access, elevated access requires cli access", name)
+	}
+	favorite, err := resolveFavorite(cCtx, favorite)
+	if err != nil {
+		return err
+	}
+	err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+	if err != nil {
+		return err
+	}
+	err = helper.RequireAWS(helper.FavoriteCloud(favorite), favorite.Account, "short term access keys")
+	if err != nil {
+		return err
+	}
+	policy, err := readSessionPolicy(favorite.SessionPolicy)
+	if err != nil {
+		return err
+	}
+
+	// always mint fresh keys so the window starts now
+	elevationReason = reason
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+	stak, err := fetchSTAK(cCtx, favorite.CAR, favorite.Account, policy)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(duration)
+	if !stak.Expiration.IsZero() && stak.Expiration.Before(deadline) {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: the short term access keys expire at %v, before the %v asked for", stak.Expiration.Local().Format(time.Kitchen), duration))
+		deadline = stak.Expiration
+	}
+	elevatedUntil = deadline
+	if favorite.Region == "" {
+		favorite.Region = labeledRegion(favorite.Account, 0)
+	}
+
+	action := "subshell"
+	if cCtx.Bool("print") {
+		action = "print"
+	}
+	if dryRun {
+		return printDryRun(action, favorite.Account, favorite.CAR, favorite.Region, "")
+	}
+
+	// cache the keys only until the deadline, so they are purged with it
+	cached := stak
+	cached.Expiration = deadline
+	err = c.SetStak(stakCacheKey(favorite.CAR, favorite.Account, policy), cached)
+	if err != nil {
+		return err
+	}
+
+	recordAccess("elevate", favorite.Account, favorite.CAR)
+	fmt.Fprintln(os.Stderr, color.YellowString("Elevated access to %v as %v until %v: %v", favorite.Name, favorite.CAR, deadline.Local().Format(time.Kitchen), reason))
+	if action == "print" {
+		return printSTAK(stdout, stak, favorite.Account, favorite.CAR, favorite.Region)
+	}
+	return helper.CreateElevatedSubShell(favorite.Account, favorite.Name, favorite.CAR, stak, favorite.Region, deadline)
+}
+
+// resolveFavorite fills in the account and cloud access role of a favorite
+// that uses globs or omits its cloud access role.
+func resolveFavorite(cCtx *cli.Context, favorite structs.Favorite) (structs.Favorite, error) {
+	if !helper.IsDynamicFavorite(favorite) && (favorite.CAR != "" || favorite.AccessType == "web") {
+		return favorite, nil
+	}
+	car, found, err := resolveFavoriteCAR(cCtx, favorite)
+	if err != nil {
+		return favorite, err
+	}
+	if !found {
+		return favorite, fmt.Errorf("no cloud access roles found for favorite %v", favorite.Name)
+	}
+	err = helper.RequireAccessLevel(car, favoriteAccessLevel(favorite))
+	if err != nil {
+		return favorite, err
+	}
+	favorite.Account = car.AccountNumber
+	favorite.AccountAlias = ""
+	favorite.CAR = car.Name
+	return favorite, nil
+}
+
+// credentialProcess prints short-term access keys as AWS credential process
+// json for a favorite or an account and cloud access role, so profiles in
+// ~/.aws/config can run kion directly. Cached keys are used until seconds
+// before they expire and expired sessions are renewed along the way. Nothing
+// is ever prompted for as the AWS CLI captures the output.
+func credentialProcess(cCtx *cli.Context) error {
+	name := cCtx.Args().First()
+	account := cCtx.String("account")
+	carName := cCtx.String("car")
+	switch {
+	case name != "" && (account != "" || carName != ""):
+		return errors.New("pass either a favorite or --account and --car, not both")
+	case name != "":
+		_, fMap := helper.MapFavs(config.Favorites)
+		favorite, found := fMap[name]
+		if !found {
+			return fmt.Errorf("favorite not found: %v", name)
+		}
+		if favorite.AccessType == kion.AccessLevelWeb {
+			return fmt.Errorf("favorite %v uses web access, short term access keys require cli access", name)
+		}
+		return favorites(cCtx)
+	case account == "" || carName == "":
+		return errors.New("pass a favorite or both --account and --car, a credential process can't prompt for them")
+	default:
+		return genStaks(cCtx)
+	}
+}
+
+// decryptHandoff prints credentials handed off with kion stak --encrypt-to,
+// read from the file given or stdin.
+func decryptHandoff(cCtx *cli.Context) error {
+	if cCtx.NArg() > 1 {
+		return errors.New("expected the file to decrypt, or none or - to read it from stdin")
+	}
+	var data []byte
+	var err error
+	if path := cCtx.Args().First(); path == "" || path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	plaintext, err := helper.DecryptHandoff(data, cCtx.String("identity"))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(plaintext)
+	return err
+}
+
+// decryptKeygen writes a new age identity to the file given, for receiving
+// handed off credentials, and prints the recipient to share with the sender.
+func decryptKeygen(cCtx *cli.Context) error {
+	if cCtx.NArg() != 1 {
+		return errors.New("expected the file to write the new identity to")
+	}
+	path := cCtx.Args().First()
+	identity, recipient, err := helper.NewAgeIdentity()
+	if err != nil {
+		return err
+	}
+	contents := fmt.Sprintf("# created: %v\n# public key: %v\n%v\n", time.Now().Format(time.RFC3339), recipient, identity)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write a new age identity to %v\n", path)
+		return nil
+	}
+
+	// never replace an identity, credentials encrypted to it would be lost
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote a new identity to %v, share this recipient with whoever hands you credentials:\n", path)
+	fmt.Println(recipient)
+	return nil
+}
+
+// favoriteParameters returns the values of a favorite's parameters, passed as
+// flags or prompted for, see helper.FavoriteParameterValues. Nothing is
+// prompted for when printing a credential process or not interactive.
+func favoriteParameters(cCtx *cli.Context, favorite structs.Favorite) (map[string]string, error) {
+	passed := make(map[string]string)
+	for _, name := range helper.FavoriteParameters {
+		passed[name] = cCtx.String(name)
+	}
+	var prompt func(name string, value string) (string, error)
+	if helper.IsInteractive() && !cCtx.Bool("credential-process") {
+		prompt = func(name string, value string) (string, error) {
+			message := fmt.Sprintf("%v%v for %v", strings.ToUpper(name[:1]), name[1:], favorite.Name)
+			if value != "" {
+				message += fmt.Sprintf(" (%v)", value)
+			}
+			return helper.PromptInput(message + ":")
+		}
+	}
+	return helper.FavoriteParameterValues(favorite, passed, prompt)
+}
+
+// favoriteAccessLevel returns the access level a favorite uses, cli unless
+// its access type is web.
+func favoriteAccessLevel(favorite structs.Favorite) string {
+	if favorite.AccessType == kion.AccessLevelWeb {
+		return kion.AccessLevelWeb
+	}
+	return kion.AccessLevelCLI
+}
+
+// favoriteConsole federates into the web console for a resolved favorite,
+// pointed at the console of service if given.
+func favoriteConsole(cCtx *cli.Context, favorite structs.Favorite, service string) error {
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// attempt to find exact match then fallback to first match
+	car, found, err := resolveFavoriteCAR(cCtx, favorite)
+	if err != nil {
+		return err
+	}
+	if !found {
+		car, err = kion.GetCARByName(config.Kion.Url, config.Kion.ApiKey, favorite.CAR)
+		if err != nil {
+			return err
+		}
+		car.AccountNumber = favorite.Account
+	}
+	err = helper.RequireAccessLevel(car, kion.AccessLevelWeb)
+	if err != nil {
+		return err
+	}
+	if service != "" && car.Cloud() != kion.CloudAWS && car.Cloud() != "" {
+		return fmt.Errorf("favorite %v is a %v account, service deep links are only available for AWS consoles", favorite.Name, helper.CloudName(car.Cloud()))
+	}
+	url, err := consoleURL(cCtx, car, service)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return printDryRun("web", car.AccountNumber, car.Name, "", "")
+	}
+	recordAccess("web", car.AccountNumber, car.Name)
+	if cCtx.Bool("capture") {
+		return captureConsole(car, url)
+	}
+	fmt.Fprintf(stdout, "Federating into %s (%s) via %s\n", favorite.Name, favorite.Account, car.AwsIamRoleName)
+	profile := cCtx.String("browser-profile")
+	if profile == "" {
+		profile = favorite.BrowserProfile
+	}
+	return openConsole(cCtx, car, url, profile)
+}
+
+// favoriteSTAK returns a STAK for a resolved favorite, downscoped with its
+// session policy if it has one, reusing a cached one valid for at least
+// buffer seconds.
+func favoriteSTAK(cCtx *cli.Context, favorite structs.Favorite, buffer time.Duration) (kion.STAK, error) {
+	policy, err := readSessionPolicy(favorite.SessionPolicy)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+
+	// check if we have a valid cached stak else grab a new one
+	cacheKey := stakCacheKey(favorite.CAR, favorite.Account, policy)
+	cachedSTAK, found, err := c.GetStak(cacheKey)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+	if found && cachedSTAK.ValidFor(buffer*time.Second) {
+		return cachedSTAK, nil
+	}
+
+	return sharedSTAK(cacheKey, buffer, func() (kion.STAK, error) {
+		// handle auth
+		err := setAuthToken(cCtx)
+		if err != nil {
+			return kion.STAK{}, err
+		}
+		return fetchSTAK(cCtx, favorite.CAR, favorite.Account, policy)
+	})
+}
+
+// sharedSTAK fetches the keys cached under cacheKey with fetch and caches
+// them. Runs started together wanting the same keys, such as the credential
+// processes of a parallel terraform run, wait on the first to fetch them and
+// share them from the cache. The lock is released once the keys are cached,
+// before they are used, so a sub-shell never holds it.
+func sharedSTAK(cacheKey string, buffer time.Duration, fetch func() (kion.STAK, error)) (kion.STAK, error) {
+	release, locked := lockKeys(cacheKey)
+	defer release()
+	if locked {
+		cachedSTAK, found, err := c.GetStak(cacheKey)
+		if err != nil {
+			return kion.STAK{}, err
+		}
+		if found && cachedSTAK.ValidFor(buffer*time.Second) {
+			return cachedSTAK, nil
+		}
+	}
+
+	// grab a new stak, caching nothing when a dry run skipped fetching it
+	stak, err := fetch()
+	if errors.Is(err, kion.ErrDryRun) || err == nil && stak == (kion.STAK{}) {
+		return kion.STAK{}, nil
+	}
+	if err != nil {
+		return kion.STAK{}, err
+	}
+
+	// store the stak in the cache
+	err = c.SetStak(cacheKey, stak)
+	if err != nil {
+		return kion.STAK{}, err
+	}
+	return stak, nil
+}
+
+// Key lock timings, a run waits on another fetching the same keys for up to
+// keyLockWait before fetching them itself, past a sign in or a few retries.
+const (
+	keyLockWait  = time.Minute
+	keyLockStale = 2 * time.Minute
+)
+
+// lockKeys takes the lock on fetching the keys cached under cacheKey,
+// returning its release and whether it is held. Without a written cache, or
+// when waiting times out, the keys are fetched without it.
+func lockKeys(cacheKey string) (func(), bool) {
+	if keyLockDir == "" {
+		return func() {}, false
+	}
+	holder := filesystem.LockHolder{PID: os.Getpid(), Version: kionCliVersion, Acquired: time.Now()}
+	lock, err := filesystem.AcquireLock(filesystem.KeyLockPath(keyLockDir, cacheNamespace, cacheKey), holder, keyLockWait, keyLockStale, nil)
+	if err != nil {
+		return func() {}, false
+	}
+	return func() { lock.Release() }, true
+}
+
+// serveWebUI serves a local web page listing favorites with buttons to open
+// their console or copy shell exports. Actions run through the same code as
+// the favorite command, including the audit log.
+func serveWebUI(cCtx *cli.Context) error {
+	_, fMap := helper.MapFavs(config.Favorites)
+	actions := helper.WebUIActions{
+		Console: func(name string) error {
+			favorite, err := resolveFavorite(cCtx, fMap[name])
+			if err == nil {
+				err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+			}
+			if err != nil {
+				return err
+			}
+			return favoriteConsole(cCtx, favorite, "")
+		},
+		Exports: func(name string) (string, error) {
+			favorite, err := resolveFavorite(cCtx, fMap[name])
+			if err == nil {
+				err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+			}
+			if err != nil {
+				return "", err
+			}
+			stak, err := favoriteSTAK(cCtx, favorite, 300)
+			if err != nil {
+				return "", err
+			}
+			if favorite.Region == "" {
+				favorite.Region = labeledRegion(favorite.Account, 0)
+			}
+			if dryRun {
+				return "", printDryRun("print", favorite.Account, favorite.CAR, favorite.Region, "")
+			}
+			recordAccess("print", favorite.Account, favorite.CAR)
+			var exports strings.Builder
+			err = helper.PrintSTAK(&exports, stak, favorite.Region)
+			return exports.String(), err
+		},
+	}
+
+	launch, err := helper.NewWebUIToken()
+	if err != nil {
+		return err
+	}
+	session, err := helper.NewWebUIToken()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cCtx.Int("port")))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	// the launch token is only ever shared through the url and works once, the
+	// browser opening it is handed the session token in a cookie
+	url := fmt.Sprintf("http://%v/?token=%v", listener.Addr(), launch)
+	fmt.Fprintf(os.Stderr, "Serving favorites at %v, press Ctrl+C to stop\n", url)
+	if !cCtx.Bool("no-browser") {
+		err = helper.OpenURL(url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to open a browser: %v\n", err)
+		}
+	}
+
+	server := &http.Server{
+		Handler:           helper.NewWebUI(helper.FilterPinnedFavorites(config.Favorites), actions, launch, session),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.Serve(listener)
+}
+
+// serveMetadata serves the short term access keys of a favorite, or an
+// account and cloud access role, the way the EC2 instance metadata service
+// and the ECS container credentials endpoint do, for SDKs and tools that only
+// read credentials from those. Keys come from the cache and are replaced
+// before they expire, so clients refreshing them get new ones.
+func serveMetadata(cCtx *cli.Context) error {
+	name := cCtx.Args().First()
+	favorite := structs.Favorite{
+		Account:       cCtx.String("account"),
+		CAR:           cCtx.String("car"),
+		SessionPolicy: cCtx.String("session-policy"),
+	}
+	switch {
+	case name != "" && (favorite.Account != "" || favorite.CAR != ""):
+		return errors.New("pass either a favorite or --account and --car, not both")
+	case name != "":
+		_, fMap := helper.MapFavs(config.Favorites)
+		found, ok := fMap[name]
+		if !ok {
+			return fmt.Errorf("favorite not found: %v", name)
+		}
+		if found.AccessType == kion.AccessLevelWeb {
+			return fmt.Errorf("favorite %v uses web access, short term access keys require cli access", name)
+		}
+		resolved, err := resolveFavorite(cCtx, found)
+		if err != nil {
+			return err
+		}
+		if favorite.SessionPolicy != "" {
+			resolved.SessionPolicy = favorite.SessionPolicy
+		}
+		favorite = resolved
+	case favorite.Account == "" || favorite.CAR == "":
+		return errors.New("pass a favorite or both --account and --car")
+	default:
+		favorite.Name = favorite.Account + "/" + favorite.CAR
+	}
+	err := helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+	if err != nil {
+		return err
+	}
+	region := cCtx.String("region")
+	if region == "" {
+		region = favorite.Region
+	}
+	if region == "" {
+		region = labeledRegion(favorite.Account, 0)
+	}
+
+	// the instance metadata endpoints can't require a secret, so they are
+	// never offered beyond this host
+	host := net.ParseIP(cCtx.String("host"))
+	if host == nil || (!host.IsLoopback() && !host.IsLinkLocalUnicast()) {
+		return fmt.Errorf("unable to listen on %v, the metadata server only listens on loopback or link-local addresses", cCtx.String("host"))
+	}
+	address := net.JoinHostPort(host.String(), strconv.Itoa(cCtx.Int("port")))
+	if dryRun {
+		return printDryRun("serve-metadata", favorite.Account, favorite.CAR, region, address)
+	}
+
+	// fetch keys up front so problems with access show before clients ask
+	credentials := func() (kion.STAK, error) {
+		return favoriteSTAK(cCtx, favorite, 900)
+	}
+	_, err = credentials()
+	if err != nil {
+		return err
+	}
+	recordAccess("serve-metadata", favorite.Account, favorite.CAR)
+
+	token, err := helper.NewWebUIToken()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	endpoint := "http://" + listener.Addr().String()
+	fmt.Fprintf(os.Stderr, "Serving short term access keys for %v on account %v at %v, press Ctrl+C to stop\n", favorite.CAR, favorite.Account, endpoint)
+	fmt.Fprintf(os.Stderr, "Point AWS SDKs and tools at it with:\n\n")
+	fmt.Fprintf(os.Stderr, "  export AWS_CONTAINER_CREDENTIALS_FULL_URI=%v%v\n", endpoint, helper.ContainerCredentialsPath)
+	fmt.Fprintf(os.Stderr, "  export AWS_CONTAINER_AUTHORIZATION_TOKEN=%v\n\n", token)
+	fmt.Fprintf(os.Stderr, "or, for those only reading the instance metadata service:\n\n")
+	fmt.Fprintf(os.Stderr, "  export AWS_EC2_METADATA_SERVICE_ENDPOINT=%v\n\n", endpoint)
+
+	server := &http.Server{
+		Handler: helper.NewMetadataServer(helper.MetadataOptions{
+			Role:        helper.MetadataRoleName(favorite.CAR),
+			Region:      region,
+			Token:       token,
+			AllowIMDSv1: cCtx.Bool("allow-imdsv1"),
+			Credentials: func() (kion.STAK, error) {
+				stak, err := credentials()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, color.RedString("Error: unable to fetch short term access keys: %v", err))
+				}
+				return stak, err
+			},
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.Serve(listener)
+}
+
+// fedConsole opens the CSP console for the selected account and cloud access
+// role in the users default browser. The role is prompted for unless given as
+// ACCOUNT/CAR, where the account is its number or name. Consoles come from
+// Kion's console access, except for AWS roles offering only cli access, or
+// when asked to, which exchange short term access keys for a sign in link.
+func fedConsole(cCtx *cli.Context) error {
+	err := helper.ValidateCloud(cCtx.String("cloud"))
+	if err != nil {
+		return err
+	}
+	if cCtx.Bool("url-only") && cCtx.Bool("capture") {
+		return errors.New("pass either --url-only or --capture, not both")
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// find the car named, or walk user through the prompt workflow to select one
+	var car kion.CAR
+	var staleSince time.Time
+	if cCtx.Args().Present() {
+		car, err = consoleCAR(cCtx, cCtx.Args().First())
+	} else {
+		staleSince, err = selectCAR(cCtx, &car)
+	}
+	if err != nil {
+		return err
+	}
+
+	// federate with short term access keys when kion's console access won't do
+	useSTAK := cCtx.Bool("stak") || cCtx.String("session-policy") != ""
+	if !useSTAK && helper.RequireAccessLevel(car, kion.AccessLevelWeb) != nil && car.Cloud() == kion.CloudAWS {
+		useSTAK = helper.RequireAccessLevel(car, kion.AccessLevelCLI) == nil
+	}
+	level := kion.AccessLevelWeb
+	if useSTAK {
+		level = kion.AccessLevelCLI
+		err = helper.RequireAWS(car.Cloud(), car.AccountNumber, "console sign in links from short term access keys")
+		if err != nil {
+			return err
+		}
+	}
+	err = helper.RequireAccessLevel(car, level)
+	if err != nil {
+		return err
+	}
+	if cCtx.String("service") != "" && car.Cloud() != kion.CloudAWS && car.Cloud() != "" {
+		return fmt.Errorf("account %v is a %v account, --service deep links are only available for AWS consoles", car.AccountNumber, helper.CloudName(car.Cloud()))
+	}
+
+	// show what will be requested and confirm if asked to
+	err = confirmPreflight(cCtx, helper.Preflight{
+		Account:     car.AccountNumber,
+		AccountName: car.AccountName,
+		CAR:         car.Name,
+		Access:      describeAction("web"),
+		Data:        describeData(staleSince),
+	})
+	if err != nil {
+		return err
+	}
+
+	// grab the csp federation url
+	var url string
+	if useSTAK {
+		url, err = stakConsoleURL(cCtx, car)
+	} else {
+		url, err = consoleURL(cCtx, car, cCtx.String("service"))
+	}
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		if cCtx.Bool("url-only") {
+			return printDryRun("web-url", car.AccountNumber, car.Name, "", "")
+		}
+		return printDryRun("web", car.AccountNumber, car.Name, "", "")
+	}
+	recordAccess("web", car.AccountNumber, car.Name)
+	switch {
+	case cCtx.Bool("url-only"):
+		fmt.Println(url)
+		return nil
+	case cCtx.Bool("capture"):
+		return captureConsole(car, url)
+	}
+	return openConsole(cCtx, car, url, cCtx.String("browser-profile"))
+}
+
+// consoleCAR finds the cloud access role named by ACCOUNT/CAR, where the
+// account is its number or name, asking which is meant if several match.
+func consoleCAR(cCtx *cli.Context, name string) (kion.CAR, error) {
+	account, carName, found := strings.Cut(name, "/")
+	if !found || account == "" || carName == "" {
+		return kion.CAR{}, fmt.Errorf("expected ACCOUNT/CAR, got %q", name)
+	}
+	target := structs.Favorite{Name: name, CAR: carName}
+	if kion.CloudForAccountNumber(account) != "" {
+		target.Account = account
+	} else {
+		target.AccountAlias = account
+	}
+	car, found, err := resolveFavoriteCAR(cCtx, target)
+	if err != nil {
+		return kion.CAR{}, err
+	}
+	if !found {
+		return kion.CAR{}, fmt.Errorf("no cloud access role %v found on account %v", carName, account)
+	}
+	return car, nil
+}
+
+// consoleURL requests a console federation url from Kion, pointed at the
+// console of service if given.
+func consoleURL(cCtx *cli.Context, car kion.CAR, service string) (string, error) {
+	url, err := fetchFederationURL(cCtx, car)
+	if err != nil || dryRun || service == "" {
+		return url, err
+	}
+	destination, err := helper.AWSConsoleDestination(car.AccountTypeID, service)
+	if err != nil {
+		return "", err
+	}
+	return helper.SetConsoleDestination(url, destination)
+}
+
+// stakConsoleURL exchanges short term access keys, cached ones when still
+// valid, for an AWS console sign in link pointed at the console of --service
+// if given.
+func stakConsoleURL(cCtx *cli.Context, car kion.CAR) (string, error) {
+	destination, err := helper.AWSConsoleDestination(car.AccountTypeID, cCtx.String("service"))
+	if err != nil {
+		return "", err
+	}
+	stak, err := favoriteSTAK(cCtx, structs.Favorite{Account: car.AccountNumber, CAR: car.Name, SessionPolicy: cCtx.String("session-policy")}, 60)
+	if err != nil || dryRun {
+		return "", err
+	}
+	return helper.AWSConsoleURL(stak, car.AccountTypeID, destination)
+}
+
+// captureConsole fetches a console federation url without a browser and saves
+// a sanitized copy of the page it ends on, along with each request made, to a
+// support bundle for troubleshooting failed federation.
+func captureConsole(car kion.CAR, url string) error {
+	capture := helper.FederationCapture{
+		Captured:    time.Now(),
+		KionCLI:     kionCliVersion,
+		Account:     car.AccountNumber,
+		AccountName: car.AccountName,
+		CAR:         car.Name,
+	}
+	page := helper.CaptureFederation(url, car.AccountTypeID, &capture)
+	bundle, err := helper.WriteCaptureBundle(supportDir, capture, page)
+	if err != nil {
+		return fmt.Errorf("unable to save the federation capture: %w", err)
+	}
+
+	switch {
+	case capture.Error != "":
+		fmt.Fprintf(os.Stderr, "Federation failed: %v\n", capture.Error)
+	case capture.Failed():
+		fmt.Fprintf(os.Stderr, "Federation ended on an error page with status %v\n", capture.Hops[len(capture.Hops)-1].Status)
+	default:
+		fmt.Fprintf(os.Stderr, "Federation ended on a page with status %v, check page.html for an error message\n", capture.Hops[len(capture.Hops)-1].Status)
+	}
+	fmt.Fprintf(os.Stderr, "Saved a sanitized capture to %v, review it before sharing it with support\n", bundle)
+	return nil
+}
+
+// addFavorite adds a favorite to the configuration file, for the account and
+// cloud access role given by flags or else chosen with the pickers.
+func addFavorite(cCtx *cli.Context) error {
+	if cCtx.Args().Len() != 1 {
+		return errors.New("expected the name of the favorite to add")
+	}
+	favorite := structs.Favorite{
+		Name:           cCtx.Args().First(),
+		Account:        cCtx.String("account"),
+		AccountAlias:   cCtx.String("account-alias"),
+		CAR:            cCtx.String("car"),
+		AccessType:     cCtx.String("access-type"),
+		Region:         cCtx.String("region"),
+		BrowserProfile: cCtx.String("browser-profile"),
+		SessionPolicy:  cCtx.String("session-policy"),
+	}
+	if favorite.AccessType != "" && favorite.AccessType != kion.AccessLevelCLI && favorite.AccessType != kion.AccessLevelWeb {
+		return fmt.Errorf("unsupported access type: %v", favorite.AccessType)
+	}
+	_, err := readSessionPolicy(favorite.SessionPolicy)
+	if err != nil {
+		return err
+	}
+	if favorite.AccessType == kion.AccessLevelCLI {
+		favorite.AccessType = ""
+	}
+	_, fMap := helper.MapFavs(config.Favorites)
+	if _, found := fMap[favorite.Name]; found {
+		return fmt.Errorf("favorite %v already exists", favorite.Name)
+	}
+
+	// walk the user through the pickers when no account is given
+	if favorite.Account == "" && favorite.AccountAlias == "" {
+		if !helper.IsInteractive() {
+			return errors.New("pass --account or --account-alias, the account can't be chosen without a terminal")
+		}
+		err := setAuthToken(cCtx)
+		if err != nil {
+			return err
+		}
+		var car kion.CAR
+		_, err = selectCAR(cCtx, &car)
+		if err != nil {
+			return err
+		}
+		favorite.Account = car.AccountNumber
+		favorite.CAR = car.Name
+	}
+
+	favorites, err := helper.AddFavorite(config.Favorites, favorite)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would add favorite %v to %v\n", favorite.Name, configPath)
+		return nil
+	}
+	err = helper.SaveFavorites(configPath, cCtx.String("profile"), favorites)
+	if err != nil {
+		return err
+	}
+	config.Favorites = favorites
+	color.Green("Added favorite %v to %v", favorite.Name, configPath)
+	return nil
+}
+
+// removeFavorites removes favorites from the configuration file, warning
+// about workspaces still listing them.
+func removeFavorites(cCtx *cli.Context) error {
+	names := cCtx.Args().Slice()
+	if len(names) == 0 {
+		return errors.New("expected the names of the favorites to remove")
+	}
+	favorites, err := helper.RemoveFavorites(config.Favorites, names)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would remove %v from %v\n", strings.Join(names, ", "), configPath)
+		return nil
+	}
+	err = helper.SaveFavorites(configPath, cCtx.String("profile"), favorites)
+	if err != nil {
+		return err
+	}
+	config.Favorites = favorites
+	color.Green("Removed %v from %v", strings.Join(names, ", "), configPath)
+	for _, name := range names {
+		if workspaces := helper.FavoriteWorkspaces(config.Workspaces, name); len(workspaces) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: workspaces %v still list %v\n", strings.Join(workspaces, ", "), name)
+		}
+	}
+	return nil
+}
+
+// listFavorites prints out the users stored favorites. Extra information is
+// provided if the verbose flag is set.
+func listFavorites(cCtx *cli.Context) error {
+	if outputFormat != "text" {
+		return helper.WriteOutput(stdout, outputFormat, helper.NewFavoriteOutputs(config.Favorites), nil)
+	}
+
+	// map our favorites for ease of use
+	fNames, fMap := helper.MapFavs(config.Favorites)
+
+	// print it out
+	if cCtx.Bool("verbose") {
+		for _, f := range fMap {
+			accessType := f.AccessType
+			if accessType == "" {
+				accessType = "cli (Default)"
+			}
+			region := f.Region
+			if region == "" {
+				region = "[unset]"
+			}
+			cloud := helper.CloudName(helper.FavoriteCloud(f))
+			if cloud == "" {
+				cloud = "[unknown]"
+			}
+			fmt.Fprintf(stdout, " %v:\n   account number: %v\n   cloud: %v\n   cloud access role: %v\n   access type: %v\n   region: %v\n", f.Name, f.Account, cloud, f.CAR, accessType, region)
+		}
+	} else {
+		for _, f := range fNames {
+			fmt.Fprintf(stdout, " %v\n", f)
+		}
+	}
+	return nil
+}
+
+// checkFavorites verifies that each favorite still maps to an account and
+// cloud access role the user can access. If run interactively the user is
+// offered fixes for any broken favorites which are saved back to the config.
+func checkFavorites(cCtx *cli.Context) error {
+	if len(config.Favorites) == 0 {
+		fmt.Fprintln(stdout, "No favorites configured")
+		return nil
+	}
+	useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return err
+	}
+	if !useUpdated {
+		return errors.New("checking favorites requires a version of Kion that includes account details with cloud access roles")
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// gather everything the user can access
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// report on any problems
+	issues := helper.CheckFavorites(config.Favorites, cars)
+	if len(issues) == 0 {
+		color.Green("All %v favorites are valid", len(config.Favorites))
+		return nil
+	}
+	for _, issue := range issues {
+		color.Yellow(" %v: %v", issue.Favorite.Name, issue.Problem)
+		if len(issue.Suggestions) > 0 {
+			fmt.Fprintf(stdout, "   available roles on account: %v\n", strings.Join(issue.Suggestions, ", "))
+		}
+	}
+	if !helper.IsInteractive() {
+		return fmt.Errorf("%v of %v favorites can not be used", len(issues), len(config.Favorites))
+	}
+
+	// offer fixes for each broken favorite
+	favs := slices.Clone(config.Favorites)
+	var changed bool
+	for _, issue := range issues {
+		// a favorite with several issues may already have been removed
+		idx := slices.IndexFunc(favs, func(f structs.Favorite) bool { return f.Name == issue.Favorite.Name })
+		if idx < 0 {
+			continue
+		}
+
+		keep := "Keep as is"
+		remove := "Remove favorite"
+		var options []string
+		for _, s := range issue.Suggestions {
+			options = append(options, fmt.Sprintf("Use %v", s))
+		}
+		options = append(options, remove, keep)
+
+		choice, err := helper.PromptSelect(fmt.Sprintf("Fix %v:", issue.Favorite.Name), options)
+		if err != nil {
+			return err
+		}
+
+		switch choice {
+		case keep:
+			continue
+		case remove:
+			favs = slices.Delete(favs, idx, idx+1)
+		default:
+			favs[idx].CAR = strings.TrimPrefix(choice, "Use ")
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	// persist the fixes
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write updated favorites to %v\n", configPath)
+		return nil
+	}
+	err = helper.SaveFavorites(configPath, cCtx.String("profile"), favs)
+	if err != nil {
+		return err
+	}
+	color.Green("Favorites updated in %v", configPath)
+	return nil
+}
+
+// generateFavorites walks the accounts of a Kion project and adds a favorite
+// for each one where the given cloud access role can be used.
+func generateFavorites(cCtx *cli.Context) error {
+	projectName := cCtx.String("project")
+	carName := cCtx.String("car")
+	accessType := cCtx.String("access-type")
+	if accessType != "cli" && accessType != "web" {
+		return fmt.Errorf("unsupported access type: %v", accessType)
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// find the project
+	var projects []kion.Project
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching projects", func(p *helper.Progress) error {
+			var err error
+			projects, err = kion.GetProjects(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(projects, func(p kion.Project) bool {
+		return strings.EqualFold(p.Name, projectName)
+	})
+	if idx == -1 {
+		return fmt.Errorf("project not found: %v", projectName)
+	}
+	project := projects[idx]
+
+	// gather the cloud access roles on each of the project's accounts
+	cars, err := projectCARs(cCtx, project)
+	if err != nil {
+		return err
+	}
+
+	generated := helper.GenerateFavorites(cars, carName, accessType, cCtx.String("region"), cCtx.String("prefix"), config.Favorites)
+	if len(generated) == 0 {
+		fmt.Fprintf(stdout, "No new favorites to add, %v is not available on any uncovered accounts in %v\n", carName, project.Name)
+		return nil
+	}
+
+	return addFavorites(cCtx, generated)
+}
+
+// addFavorites lets the user choose which of a set of new favorites to add to
+// the configuration file, adding them all when not interactive or passed
+// --yes.
+func addFavorites(cCtx *cli.Context, generated []structs.Favorite) error {
+	// let the user choose which to add, else list what will be added
+	labels := make([]string, len(generated))
+	for i, fav := range generated {
+		labels[i] = fmt.Sprintf("%v: %v on %v", fav.Name, fav.CAR, fav.Account)
+	}
+	if helper.IsInteractive() && !cCtx.Bool("yes") && !dryRun {
+		chosen, err := helper.PromptMultiSelect(fmt.Sprintf("Choose favorites to add to %v:", configPath), labels, labels)
+		if err != nil {
+			return err
+		}
+		var selected []structs.Favorite
+		for i, label := range labels {
+			if slices.Contains(chosen, label) {
+				selected = append(selected, generated[i])
+			}
+		}
+		if len(selected) == 0 {
+			fmt.Fprintln(stdout, "No favorites added")
+			return nil
+		}
+		generated = selected
+	} else {
+		for _, label := range labels {
+			fmt.Fprintf(stdout, " %v\n", label)
+		}
+	}
+
+	// persist
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would add %v favorites to %v\n", len(generated), configPath)
+		return nil
+	}
+	favorites := append(slices.Clone(config.Favorites), generated...)
+	err := helper.SaveFavorites(configPath, cCtx.String("profile"), favorites)
+	if err != nil {
+		return err
+	}
+	config.Favorites = favorites
+	color.Green("Added %v favorites to %v", len(generated), configPath)
+	return nil
+}
+
+// recommendedFavorites returns the favorites admins recommend through Kion
+// account labels on the accounts the user has cloud access roles on, less
+// those already configured.
+func recommendedFavorites(cCtx *cli.Context) ([]structs.Favorite, error) {
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := config.Kion.RecommendedLabel
+	if key == "" {
+		key = helper.DefaultRecommendedLabel
+	}
+
+	var cars []kion.CAR
+	labels := make(map[uint][]kion.Label)
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching recommended favorites", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			if err != nil {
+				return err
+			}
+			for _, car := range cars {
+				if _, found := labels[car.AccountID]; found {
+					continue
+				}
+				accountLabels, err := kion.GetAccountLabels(config.Kion.Url, config.Kion.ApiKey, car.AccountID)
+				if err != nil {
+					return fmt.Errorf("unable to read the labels of account %v: %w", car.AccountNumber, err)
+				}
+				labels[car.AccountID] = accountLabels
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return helper.RecommendedFavorites(cars, labels, key, config.Favorites), nil
+}
+
+// importRecommended adds the favorites admins recommend through Kion account
+// labels to the configuration file.
+func importRecommended(cCtx *cli.Context) error {
+	recommended, err := recommendedFavorites(cCtx)
+	if err != nil {
+		return err
+	}
+	if len(recommended) == 0 {
+		fmt.Fprintln(stdout, "No new favorites to add, none are recommended for your cloud access roles")
+		return nil
+	}
+	return addFavorites(cCtx, recommended)
+}
+
+// offerRecommended offers to import the favorites admins recommend the first
+// time favorites are used without any configured. The offer is only made
+// once, failures only warn, and kion favorite recommended imports them later.
+func offerRecommended(cCtx *cli.Context) {
+	if len(config.Favorites) > 0 || !helper.IsInteractive() || dryRun {
+		return
+	}
+	marker := filepath.Join(paths.State, "recommended-offered")
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
+	err := os.MkdirAll(paths.State, 0700)
+	if err == nil {
+		err = os.WriteFile(marker, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to record the recommended favorites offer: %v\n", err)
+	}
+
+	recommended, err := recommendedFavorites(cCtx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to check for recommended favorites: %v\n", err)
+		return
+	}
+	if len(recommended) == 0 {
+		return
+	}
+	proceed, err := helper.PromptConfirm(fmt.Sprintf("Your administrators recommend %v favorites, choose some to add?", len(recommended)))
+	if err != nil || !proceed {
+		fmt.Fprintln(stdout, "Run kion favorite recommended to add them later")
+		return
+	}
+	err = addFavorites(cCtx, recommended)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to add recommended favorites: %v\n", err)
+	}
+}
+
+// projectCARs returns the cloud access roles the user has on each account of
+// a project, with account details filled in.
+func projectCARs(cCtx *cli.Context, project kion.Project) ([]kion.CAR, error) {
+	useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		cars = nil
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			if useUpdated {
+				all, err := kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+				if err != nil {
+					return err
+				}
+				for _, car := range all {
+					if car.ProjectID == project.ID {
+						cars = append(cars, car)
+					}
+				}
+				return nil
+			}
+
+			// older versions don't include account details so walk each account
+			accounts, _, err := kion.GetAccountsOnProject(config.Kion.Url, config.Kion.ApiKey, project.ID)
+			if err != nil {
+				return err
+			}
+			p.SetTotal(len(accounts))
+			for _, account := range accounts {
+				accountCARs, err := kion.GetCARSOnProject(config.Kion.Url, config.Kion.ApiKey, project.ID, account.ID)
+				if err != nil {
+					return err
+				}
+				for _, car := range accountCARs {
+					car.AccountName = account.Name
+					car.AccountNumber = account.Number
+					cars = append(cars, car)
+				}
+				p.Increment()
+			}
+			return nil
+		})
+	})
+
+	return cars, err
+}
+
+// runCommand generates creds for an AWS account then executes the user
+// provided command with said credentials set. The target is given by flags or
+// as the first argument, a favorite or ACCOUNT/CAR, before the command.
+func runCommand(cCtx *cli.Context) error {
+	// set vars for easier access
+	favName := cCtx.String("favorite")
+	accNum := cCtx.String("account")
+	carName := cCtx.String("car")
+	region := cCtx.String("region")
+	args := cCtx.Args().Slice()
+
+	// take the target from the first argument when not given by flags
+	if favName == "" && accNum == "" && carName == "" && len(args) > 1 {
+		target := args[0]
+		args = args[1:]
+		_, fMap := helper.MapFavs(config.Favorites)
+		if _, found := fMap[target]; found {
+			favName = target
+		} else {
+			account, car, found := strings.Cut(target, "/")
+			if !found {
+				return fmt.Errorf("favorite not found: %v, pass a favorite or ACCOUNT/CAR", target)
+			}
+			accNum, carName = account, car
+			if kion.CloudForAccountNumber(account) == "" {
+				resolved, err := consoleCAR(cCtx, target)
+				if err != nil {
+					return err
+				}
+				accNum = resolved.AccountNumber
+			}
+		}
+	}
+
+	// flags end at the target, so a separator after it is still in the args
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	// fail fast if we don't have what we need
+	if favName == "" && (accNum == "" || carName == "") {
+		return errors.New("must specify either --fav OR --account and --car parameters, or a favorite or ACCOUNT/CAR before the command")
+	}
+	if len(args) == 0 {
+		return errors.New("no command given to run")
+	}
+
+	// placeholder for our stak
+	var stak kion.STAK
+
+	// prefer favorites if specified, else use account and car
+	if favName != "" {
+		// map our favorites for ease of use
+		_, fMap := helper.MapFavs(config.Favorites)
+
+		// if arg passed is a valid favorite use it else prompt
+		var fav string
+		var err error
+		if _, found := fMap[favName]; found {
+			fav = favName
+		} else {
+			return errors.New("can't find favorite")
+		}
+
+		// grab our favorite
+		favorite := fMap[fav]
+
+		// resolve the account and cloud access role if not given outright
+		if helper.IsDynamicFavorite(favorite) || favorite.CAR == "" {
+			car, found, err := resolveFavoriteCAR(cCtx, favorite)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("no cloud access roles found for favorite %v", favorite.Name)
+			}
+			favorite.Account = car.AccountNumber
+			favorite.AccountAlias = ""
+			favorite.CAR = car.Name
+		}
+		err = helper.CheckPinned(favorite.Account, "favorite "+favorite.Name)
+		if err != nil {
+			return err
+		}
+		if path := cCtx.String("session-policy"); path != "" {
+			favorite.SessionPolicy = path
+		}
+
+		// azure and gcp accounts are issued their own credentials
+		if cloud := helper.FavoriteCloud(favorite); cloud == kion.CloudAzure || cloud == kion.CloudGCP {
+			if region == "" {
+				region = favorite.Region
+			}
+			return runCloudCommand(cCtx, cloud, favorite.Account, favorite.CAR, region, favorite.SessionPolicy, args)
+		}
+		policy, err := readSessionPolicy(favorite.SessionPolicy)
+		if err != nil {
+			return err
+		}
+
+		// check if we have a valid cached stak else grab a new one
+		cacheKey := stakCacheKey(favorite.CAR, favorite.Account, policy)
+		cachedSTAK, found, err := c.GetStak(cacheKey)
+		if err != nil {
+			return err
+		}
+		if found && cachedSTAK.ValidFor(5*time.Second) {
+			stak = cachedSTAK
+		} else {
+			// handle auth
+			err := setAuthToken(cCtx)
+			if err != nil {
+				return err
+			}
+
+			// grab a new stak
+			stak, err = fetchSTAK(cCtx, favorite.CAR, favorite.Account, policy)
+			if err != nil {
+				return err
+			}
+
+			// store the stak in the cache
+			err = c.SetStak(cacheKey, stak)
+			if err != nil {
+				return err
+			}
+		}
+
+		// take the region flag over the favorite region
+		targetRegion := region
+		if targetRegion == "" {
+			targetRegion = favorite.Region
+		}
+		if targetRegion == "" {
+			targetRegion = labeledRegion(favorite.Account, 0)
+		}
+
+		// run the command
+		if dryRun {
+			return printDryRun("run", favorite.Account, favorite.CAR, targetRegion, strings.Join(args, " "))
+		}
+		recordAccess("run", favorite.Account, favorite.CAR)
+		err = helper.RunCommand(stak, targetRegion, cCtx.Bool("creds-fd"), args[0], args[1:]...)
+		if err != nil {
+			return err
+		}
+	} else {
+		// azure and gcp accounts are issued their own credentials
+		if cloud := kion.CloudForAccountNumber(accNum); cloud == kion.CloudAzure || cloud == kion.CloudGCP {
+			return runCloudCommand(cCtx, cloud, accNum, carName, region, cCtx.String("session-policy"), args)
+		}
+		policy, err := readSessionPolicy(cCtx.String("session-policy"))
+		if err != nil {
+			return err
+		}
+
+		// check if we have a valid cached stak else grab a new one
+		cacheKey := stakCacheKey(carName, accNum, policy)
+		cachedSTAK, found, err := c.GetStak(cacheKey)
+		if err != nil {
+			return err
+		}
+		if found && cachedSTAK.ValidFor(5*time.Second) {
+			stak = cachedSTAK
+		} else {
+			// handle auth
+			err := setAuthToken(cCtx)
+			if err != nil {
+				return err
+			}
+
+			// grab a new stak
+			stak, err = fetchSTAK(cCtx, carName, accNum, policy)
+			if err != nil {
+				return err
+			}
+
+			// store the stak in the cache
+			err = c.SetStak(cacheKey, stak)
+			if err != nil {
+				return err
+			}
+		}
+
+		if region == "" {
+			region = labeledRegion(accNum, 0)
+		}
+		if dryRun {
+			return printDryRun("run", accNum, carName, region, strings.Join(args, " "))
+		}
+		recordAccess("run", accNum, carName)
+		err = helper.RunCommand(stak, region, cCtx.Bool("creds-fd"), args[0], args[1:]...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// s3Copy copies an S3 object between the accounts of two favorites or
+// ACCOUNT/CAR targets, minting short-term access keys for both at once. S3
+// copies it server-side when the destination can read the source, otherwise
+// it is streamed through here.
+func s3Copy(cCtx *cli.Context) error {
+	if cCtx.NArg() != 2 {
+		return errors.New("expected a source and destination such as s3://bucket/key s3://bucket/prefix/")
+	}
+	src, err := helper.ParseS3URL(cCtx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	dst, err := helper.ParseS3URL(cCtx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	dst = dst.Into(src)
+	from, err := s3Target(cCtx, cCtx.String("from"))
+	if err != nil {
+		return err
+	}
+	to, err := s3Target(cCtx, cCtx.String("to"))
+	if err != nil {
+		return err
+	}
+
+	// use cached keys where still valid and mint the rest at once
+	targets := []structs.Favorite{from, to}
+	staks := make([]kion.STAK, len(targets))
+	policies := make([]string, len(targets))
+	cacheKeys := make([]string, len(targets))
+	var pending []int
+	for i, target := range targets {
+		policies[i], err = readSessionPolicy(target.SessionPolicy)
+		if err != nil {
+			return err
+		}
+		cacheKeys[i] = stakCacheKey(target.CAR, target.Account, policies[i])
+		cached, found, err := c.GetStak(cacheKeys[i])
+		if err != nil {
+			return err
+		}
+		if found && cached.ValidFor(5*time.Minute) {
+			staks[i] = cached
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) > 0 {
+		// sign in up front so the two don't prompt for it at once
+		err = setAuthToken(cCtx)
+		if err != nil {
+			return err
+		}
+		errs := make([]error, len(targets))
+		helper.RunParallel(len(pending), len(pending), func(n int) {
+			i := pending[n]
+			staks[i], errs[i] = fetchSTAK(cCtx, targets[i].CAR, targets[i].Account, policies[i])
+		})
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+		for _, i := range pending {
+			err = c.SetStak(cacheKeys[i], staks[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	srcSTAK, dstSTAK := staks[0], staks[1]
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would copy %v with %v on account %v to %v with %v on account %v\n", src, from.CAR, from.Account, dst, to.CAR, to.Account)
+		return nil
+	}
+	srcRegion := helper.S3BucketRegion(srcSTAK, cCtx.String("region"), src.Bucket)
+	dstRegion := helper.S3BucketRegion(dstSTAK, cCtx.String("region"), dst.Bucket)
+	recordAccess("s3-cp", from.Account, from.CAR)
+	recordAccess("s3-cp", to.Account, to.CAR)
+	copied, err := helper.CopyS3Object(src, srcSTAK, srcRegion, dst, dstSTAK, dstRegion)
+	if err != nil {
+		return err
+	}
+
+	how := "streamed through this machine as the destination can't read the source"
+	if copied.ServerSide {
+		how = "copied server-side by S3"
+	}
+	color.Green("Copied %v to %v (%v bytes), %v", src, dst, copied.Bytes, how)
+	return nil
+}
+
+// s3Target resolves the favorite or ACCOUNT/CAR given to s3 cp to the
+// account and cloud access role keys are minted for.
+func s3Target(cCtx *cli.Context, name string) (structs.Favorite, error) {
+	_, fMap := helper.MapFavs(config.Favorites)
+	favorite, found := fMap[name]
+	if found {
+		if favorite.AccessType == kion.AccessLevelWeb {
+			return favorite, fmt.Errorf("favorite %v uses web access, short term access keys require cli access", name)
+		}
+		var err error
+		favorite, err = resolveFavorite(cCtx, favorite)
+		if err != nil {
+			return favorite, err
+		}
+	} else {
+		account, carName, found := strings.Cut(name, "/")
+		if !found || account == "" || carName == "" {
+			return favorite, fmt.Errorf("favorite not found: %v, pass a favorite or ACCOUNT/CAR", name)
+		}
+		favorite = structs.Favorite{Name: name, Account: account, CAR: carName}
+		if kion.CloudForAccountNumber(account) == "" {
+			car, err := consoleCAR(cCtx, name)
+			if err != nil {
+				return favorite, err
+			}
+			favorite.Account = car.AccountNumber
+		}
+	}
+
+	err := helper.CheckPinned(favorite.Account, name)
+	if err != nil {
+		return favorite, err
+	}
+	return favorite, helper.RequireAWS(helper.FavoriteCloud(favorite), favorite.Account, "S3 copies")
+}
+
+// listProjects prints the projects in Kion the user may see.
+func listProjects(cCtx *cli.Context) error {
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	projects, err := fetchProjects(cCtx)
+	if err != nil {
+		return err
+	}
+	outputs := helper.NewProjectOutputs(projects)
+	return helper.WriteOutput(stdout, outputFormat, outputs, func(w io.Writer) error {
+		return helper.PrintProjects(w, outputs)
+	})
+}
+
+// listAccounts prints the accounts in Kion the user may see, those in
+// --project when given. Users who may only see their cloud access roles are
+// shown the accounts those are on.
+func listAccounts(cCtx *cli.Context) error {
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	projects, err := fetchProjects(cCtx)
+	if err != nil {
+		return err
+	}
+	var project kion.Project
+	if name := cCtx.String("project"); name != "" {
+		project, err = helper.FindProject(projects, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var accounts []kion.Account
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching accounts", func(p *helper.Progress) error {
+			var err error
+			if project.ID != 0 {
+				accounts, _, err = kion.GetAccountsOnProject(config.Kion.Url, config.Kion.ApiKey, project.ID)
+			} else {
+				accounts, _, err = kion.GetAccounts(config.Kion.Url, config.Kion.ApiKey)
+			}
+			if !kion.IsStatus(err, 403) {
+				return err
+			}
+
+			// fall back to the accounts of the user's cloud access roles
+			useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+			if err != nil {
+				return err
+			}
+			if !useUpdated {
+				return errors.New("listing accounts without permission to view them needs a Kion release listing cloud access roles by account")
+			}
+			cars, err := kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			if err != nil {
+				return err
+			}
+			if project.ID != 0 {
+				cars = slices.DeleteFunc(cars, func(car kion.CAR) bool {
+					return car.ProjectID != project.ID
+				})
+			}
+			accounts = helper.AccountsFromCARs(cars)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	outputs := helper.NewAccountOutputs(accounts, projects)
+	return helper.WriteOutput(stdout, outputFormat, outputs, func(w io.Writer) error {
+		return helper.PrintAccounts(w, outputs)
+	})
+}
+
+// listCARs prints the cloud access roles the user has, those on --account
+// when given by number or name.
+func listCARs(cCtx *cli.Context) error {
+	account := cCtx.String("account")
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	projects, err := fetchProjects(cCtx)
+	if err != nil {
+		return err
+	}
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		if account != "" {
+			useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+			if err != nil {
+				return err
+			}
+			if !useUpdated {
+				return errors.New("listing the cloud access roles on an account needs a Kion release listing cloud access roles by account")
+			}
+		}
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if account != "" {
+		cars = slices.DeleteFunc(cars, func(car kion.CAR) bool {
+			return !helper.MatchesAccount(car, account, "") && !helper.MatchesAccount(car, "", account)
+		})
+	}
+
+	outputs := helper.NewCAROutputs(cars, projects)
+	return helper.WriteOutput(stdout, outputFormat, outputs, func(w io.Writer) error {
+		return helper.PrintCARs(w, outputs)
+	})
+}
+
+// fetchProjects fetches the projects in Kion the user may see.
+func fetchProjects(cCtx *cli.Context) ([]kion.Project, error) {
+	var projects []kion.Project
+	err := withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching projects", func(p *helper.Progress) error {
+			var err error
+			projects, err = kion.GetProjects(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	return projects, err
+}
+
+// watch shows the cached short-term access keys and Kion session with the
+// time each has left, redrawn every --interval, so it can be left running in
+// a terminal pane. Leases expiring within --warn flash, and pressing the key
+// shown beside a lease renews it.
+func watch(cCtx *cli.Context) error {
+	if !helper.IsInteractive() {
+		return errors.New("kion watch needs a terminal, use kion cache list to list cached keys from scripts")
+	}
+	interval, warn := cCtx.Duration("interval"), cCtx.Duration("warn")
+	if interval <= 0 {
+		return fmt.Errorf("invalid --interval %v, expected a positive duration", interval)
+	}
+	labels := watchLabels()
+
+	ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	restore, err := helper.RawTerminal()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		restore()
+		fmt.Fprintln(stdout)
+	}()
+
+	// keys are read one at a time, waiting on each to be handled so stdin is
+	// left alone while a renewal prompts
+	keys, next := make(chan byte), make(chan struct{})
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			_, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+			<-next
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	message := ""
+	for frame := 0; ; frame++ {
+		leases, err := watchLeases(labels)
+		if err != nil {
+			return err
+		}
+		var screen bytes.Buffer
+		err = helper.RenderWatch(&screen, leases, time.Now(), warn, frame%2 == 0 && !helper.AccessibleOutput, message)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(stdout, "\033[H\033[2J"+strings.ReplaceAll(screen.String(), "\n", "\r\n"))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case key, ok := <-keys:
+			// q, Ctrl-C, and Ctrl-D quit
+			if !ok || key == 'q' || key == 3 || key == 4 {
+				return nil
+			}
+			i := strings.IndexByte(helper.WatchKeys, key)
+			if i >= 0 && i < len(leases) && leases[i].Renewable {
+				restore()
+				fmt.Fprint(stdout, "\033[H\033[2J")
+				message = renewLease(cCtx, leases[i], labels)
+				restore, err = helper.RawTerminal()
+				if err != nil {
+					restore = func() {}
+					return err
+				}
+			}
+			next <- struct{}{}
+		}
+	}
+}
+
+// watchLabel names cached keys after the favorite they were minted for, along
+// with its session policy so downscoped keys can be renewed.
+type watchLabel struct {
+	name   string
+	policy string
+}
+
+// watchLabels returns the favorites whose keys may be cached by cache key.
+// Favorites matching accounts by pattern or minting keys for other clouds
+// aren't cached under a key of their own and are left out.
+func watchLabels() map[string]watchLabel {
+	labels := make(map[string]watchLabel)
+	for _, favorite := range config.Favorites {
+		if favorite.AccessType == kion.AccessLevelWeb || helper.IsDynamicFavorite(favorite) {
+			continue
+		}
+		if cloud := helper.FavoriteCloud(favorite); cloud != "" && cloud != kion.CloudAWS {
+			continue
+		}
+		policy, err := readSessionPolicy(favorite.SessionPolicy)
+		if err != nil {
+			continue
+		}
+		labels[stakCacheKey(favorite.CAR, favorite.Account, policy)] = watchLabel{name: favorite.Name, policy: policy}
+	}
+	return labels
+}
+
+// watchLeases returns the cached short-term access keys and Kion session,
+// keys named after their favorites where known.
+func watchLeases(labels map[string]watchLabel) ([]helper.WatchLease, error) {
+	entries, err := c.ListCache()
+	if err != nil {
+		return nil, err
+	}
+	var leases []helper.WatchLease
+	for _, entry := range entries {
+		switch entry.Category {
+		case cache.CategoryStak:
+			lease := helper.WatchLease{Kind: helper.WatchKeysLease, Label: entry.Key, Key: entry.Key, Expires: entry.Expires}
+			if label, found := labels[entry.Key]; found {
+				lease.Label, lease.Renewable = label.name, true
+			} else if car, account, policyID, ok := helper.ParseSTAKCacheKey(entry.Key); ok {
+				lease.Label, lease.Renewable = account+"/"+car, policyID == ""
+				if policyID != "" {
+					lease.Label += " (session policy)"
+				}
+			}
+			leases = append(leases, lease)
+		case cache.CategorySession:
+			session, found, err := c.GetSession()
+			if err != nil {
+				return nil, err
+			}
+			label := "Kion session"
+			if entry.Key != "" {
+				label += " (" + entry.Key + ")"
+			}
+			leases = append(leases, helper.WatchLease{
+				Kind:      helper.WatchSessionLease,
+				Label:     label,
+				Expires:   entry.Expires,
+				Renewable: found && session.Refreshable(time.Now()),
+			})
+		}
+	}
+	return leases, nil
+}
+
+// renewLease mints new keys for a lease shown by kion watch, or refreshes the
+// Kion session, describing the outcome.
+func renewLease(cCtx *cli.Context, lease helper.WatchLease, labels map[string]watchLabel) string {
+	if lease.Kind == helper.WatchSessionLease {
+		session, found, err := c.GetSession()
+		if err == nil && !found {
+			err = errors.New("the session is no longer cached")
+		}
+		if err == nil {
+			session, err = refreshSession(session)
+		}
+		if err != nil {
+			return color.RedString("Unable to refresh the Kion session: %v", err)
+		}
+		expires, _ := session.ExpiresAt()
+		return color.GreenString("Refreshed the Kion session until %v", expires.Local().Format("15:04:05"))
+	}
+
+	car, account, _, _ := helper.ParseSTAKCacheKey(lease.Key)
+	policy := labels[lease.Key].policy
+	err := helper.CheckPinned(account, lease.Label)
+	if err == nil {
+		err = setAuthToken(cCtx)
+	}
+	var stak kion.STAK
+	if err == nil {
+		stak, err = fetchSTAK(cCtx, car, account, policy)
+	}
+	if err == nil && !dryRun {
+		err = c.SetStak(lease.Key, stak)
+	}
+	if err != nil {
+		return color.RedString("Unable to renew %v: %v", lease.Label, err)
+	}
+	if dryRun {
+		return fmt.Sprintf("[dry-run] would renew %v", lease.Label)
+	}
+	recordAccess("watch", account, car)
+	return color.GreenString("Renewed %v until %v", lease.Label, stak.Expiration.Local().Format("15:04:05"))
+}
+
+// warmBuffer is how long a cached STAK must remain valid for warm to leave it
+// be rather than mint a new one.
+const warmBuffer = 10 * time.Minute
+
+// syncInventory pulls every project and cloud access role into the cache
+// behind the pickers and completions, a page at a time with several pages
+// fetched at once, skipping pages Kion reports unchanged since the last sync.
+// With --every it keeps syncing until interrupted, riding out Kion being
+// unreachable, so the pickers always open from a fresh cache.
+func syncInventory(cCtx *cli.Context) error {
+	every := cCtx.Duration("every")
+	if every < 0 {
+		return fmt.Errorf("invalid --every %v, expected a positive duration", every)
+	}
+	opts := kion.SyncOptions{
+		PageSize:    cCtx.Int("page-size"),
+		Concurrency: cCtx.Int("concurrency"),
+		Full:        cCtx.Bool("full"),
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		err = syncOnce(ctx, cCtx, opts)
+		switch {
+		case err == nil:
+		case every == 0 || !kion.IsUnreachable(err):
+			return err
+		default:
+			fmt.Fprintln(os.Stderr, color.YellowString("%v", outageNotice(err, "trying again in "+every.String())))
+		}
+		if every == 0 {
+			return nil
+		}
+
+		// only the first sync of a loop is full, the rest pick up changes
+		opts.Full = false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(every):
+		}
+	}
+}
+
+// syncOnce syncs the cached inventory with Kion once.
+func syncOnce(ctx context.Context, cCtx *cli.Context, opts kion.SyncOptions) error {
+	previous, _, err := c.GetInventory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read the cached inventory, syncing everything: %v\n", err)
+	}
+
+	var inventory kion.Inventory
+	var stats kion.SyncStats
+	err = withReauth(cCtx, func() error {
+		useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+		if err != nil {
+			return err
+		}
+		if !useUpdated {
+			return errors.New("kion sync needs a Kion release listing cloud access roles by account")
+		}
+		opts.Version, err = kion.GetVersion(cCtx.String("endpoint"))
+		if err != nil {
+			return err
+		}
+		return helper.WithProgress(ctx, "Syncing projects and cloud access roles", func(p *helper.Progress) error {
+			var err error
+			inventory, stats, err = kion.SyncInventory(ctx, cCtx.String("endpoint"), cCtx.String("token"), previous, opts)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	enrichInventory(cCtx, &inventory)
+	err = cacheInventory(inventory)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Synced %v projects and %v cloud access roles, %v of %v pages unchanged\n", stats.Projects, stats.CARs, stats.Unchanged, stats.Pages)
+	return nil
+}
+
+// callAPI sends a request to any path of the Kion API authorized with the
+// cached session, printing the JSON response, so endpoints not wrapped by a
+// command can be scripted against without handling sign in.
+func callAPI(cCtx *cli.Context) error {
+	if cCtx.NArg() != 2 {
+		return errors.New("expected a method and a path, such as kion api get v3/project")
+	}
+	method, path := cCtx.Args().Get(0), cCtx.Args().Get(1)
+
+	// the body is given inline, or read from a file or stdin after an @
+	var data []byte
+	if body := cCtx.String("data"); strings.HasPrefix(body, "@") {
+		var err error
+		data, err = readFileOrStdin(strings.TrimPrefix(body, "@"))
+		if err != nil {
+			return err
+		}
+	} else if cCtx.IsSet("data") {
+		data = []byte(body)
+	}
+	if data != nil && !json.Valid(data) {
+		return errors.New("--data isn't valid JSON")
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	err = withReauth(cCtx, func() error {
+		var err error
+		body, _, err = kion.CallAPI(cCtx.Context, method, kion.APIURL(config.Kion.Url, path), config.Kion.ApiKey, data)
+		return err
+	})
+
+	// error responses are printed too, their bodies say what went wrong
+	var apiErr *kion.APIError
+	switch {
+	case errors.Is(err, kion.ErrDryRun):
+		return nil
+	case errors.As(err, &apiErr):
+		body = []byte(apiErr.Body)
+		err = fmt.Errorf("kion responded %v %v", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
+	case err != nil:
+		return err
+	}
+
+	var pretty bytes.Buffer
+	if !cCtx.Bool("raw") && json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	if len(body) > 0 {
+		fmt.Println(strings.TrimRight(string(body), "\n"))
+	}
+	return err
+}
+
+// warm prepares for a working session by caching the inventory behind the
+// pickers and minting short-term access keys for a set of favorites in
+// parallel, so the first commands of the session don't wait on Kion.
+func warm(cCtx *cli.Context) error {
+	// choose the favorites to warm, a workspace, those named, or all, copied
+	// as each is replaced by its resolved account and role
+	favorites := slices.Clone(config.Favorites)
+	switch {
+	case cCtx.String("workspace") != "":
+		var err error
+		favorites, err = helper.WorkspaceFavorites(config.Workspaces, cCtx.String("workspace"), config.Favorites)
+		if err != nil {
+			return err
+		}
+	case cCtx.NArg() > 0:
+		_, fMap := helper.MapFavs(config.Favorites)
+		favorites = nil
+		for _, name := range cCtx.Args().Slice() {
+			fav, found := fMap[name]
+			if !found {
+				return fmt.Errorf("favorite not found: %v", name)
+			}
+			favorites = append(favorites, fav)
+		}
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// cache the inventory used by the pickers
+	err = withReauth(cCtx, func() error {
+		useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+		if err != nil || !useUpdated {
+			return err
+		}
+		inventory, err := helper.FetchInventory(cCtx)
+		if err != nil {
+			return err
+		}
+		enrichInventory(cCtx, &inventory)
+		return cacheInventory(inventory)
+	})
+	if err != nil {
+		return err
+	}
+
+	// resolve each favorite, leaving out those with nothing to mint
+	results := make([]helper.WarmResult, len(favorites))
+	policies := make([]string, len(favorites))
+	var pending []int
+	for i, favorite := range favorites {
+		results[i].Favorite = favorite.Name
+		if favorite.AccessType == kion.AccessLevelWeb {
+			results[i].Status, results[i].Detail = helper.WarmSkipped, "web console favorite"
+			continue
+		}
+		resolved, err := resolveFavorite(cCtx, favorite)
+		if err != nil {
+			results[i].Status, results[i].Detail = helper.WarmFailed, err.Error()
+			continue
+		}
+		if helper.CheckPinned(resolved.Account, "") != nil {
+			results[i].Status, results[i].Detail = helper.WarmSkipped, "pinned account"
+			continue
+		}
+		err = helper.RequireAWS(helper.FavoriteCloud(resolved), resolved.Account, "short term access keys")
+		if err != nil {
+			results[i].Status, results[i].Detail = helper.WarmSkipped, err.Error()
+			continue
+		}
+		favorites[i] = resolved
+		policies[i], err = readSessionPolicy(resolved.SessionPolicy)
+		if err != nil {
+			results[i].Status, results[i].Detail = helper.WarmFailed, err.Error()
+			continue
+		}
+		cached, found, err := c.GetStak(stakCacheKey(resolved.CAR, resolved.Account, policies[i]))
+		if err != nil {
+			return err
+		}
+		if found && cached.ValidFor(warmBuffer) {
+			results[i].Status, results[i].Detail = helper.WarmCached, fmt.Sprintf("valid until %v", cached.Expiration.Local().Format("15:04"))
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	// mint keys in parallel, caching them afterwards as cache writes replace
+	// the whole keyring entry
+	if len(pending) > 0 {
+		err = checkSession(cCtx)
+		if err != nil {
+			return err
+		}
+	}
+	staks := make([]kion.STAK, len(favorites))
+	err = helper.WithProgress(cCtx.Context, fmt.Sprintf("Minting short-term access keys for %v favorites", len(pending)), func(p *helper.Progress) error {
+		helper.RunParallel(len(pending), cCtx.Int("parallel"), func(n int) {
+			i := pending[n]
+			var stak kion.STAK
+			err := stakPacer.Do(cCtx.Context, func() error {
+				var err error
+				stak, err = kion.GetSTAK(config.Kion.Url, config.Kion.ApiKey, favorites[i].CAR, favorites[i].Account)
+				return err
+			})
+			if err == nil {
+				stak, err = processSTAK(stak, favorites[i].CAR, favorites[i].Account, policies[i])
+			}
+			switch {
+			case errors.Is(err, kion.ErrDryRun):
+				results[i].Status, results[i].Detail = helper.WarmSkipped, "dry run"
+			case err != nil:
+				results[i].Status, results[i].Detail = helper.WarmFailed, explainAccessError(err, favorites[i].CAR, favorites[i].Account, "cli").Error()
+			default:
+				staks[i] = stak
+				results[i].Status, results[i].Detail = helper.WarmMinted, fmt.Sprintf("valid until %v", stak.Expiration.Local().Format("15:04"))
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, i := range pending {
+		switch results[i].Status {
+		case helper.WarmFailed:
+			recordAttempt("warm", favorites[i].Account, favorites[i].CAR, errors.New(results[i].Detail))
+			continue
+		case helper.WarmMinted:
+			recordAttempt("warm", favorites[i].Account, favorites[i].CAR, nil)
+		default:
+			continue
+		}
+		notifySTAK(favorites[i].CAR, favorites[i].Account, staks[i], policies[i] != "")
+		err = c.SetStak(stakCacheKey(favorites[i].CAR, favorites[i].Account, policies[i]), staks[i])
+		if err != nil {
+			return err
+		}
+		if policies[i] == "" {
+			mirrorSTAK(favorites[i].CAR, favorites[i].Account, staks[i])
+		}
+	}
+
+	// report the outcome
+	err = helper.PrintWarmResults(stdout, results)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Status == helper.WarmFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v favorites failed to warm", failed, len(results))
+	}
+	return nil
+}
+
+// bulk mints short-term access keys for a cloud access role in every account
+// matching a project, OU, tag, or account alias in parallel, writing them as
+// profiles to ~/.aws/credentials or printing them by account number.
+func bulk(cCtx *cli.Context) error {
+	save := cCtx.Bool("save")
+	structured := outputFormat != "" && outputFormat != "text"
+	if !save && !structured {
+		return errors.New("pass --save to write the keys to ~/.aws/credentials or --output json to print them")
+	}
+	tags, err := helper.ParseBulkTags(cCtx.StringSlice("tag"))
+	if err != nil {
+		return err
+	}
+	filter := helper.BulkFilter{
+		Project:      cCtx.String("project"),
+		OU:           cCtx.String("ou"),
+		Tags:         tags,
+		AccountAlias: cCtx.String("account-alias"),
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// match accounts in a freshly cached inventory, fetching one if needed
+	inventory, found, err := c.GetInventory()
+	if err != nil || !found || refreshInventory || time.Since(inventory.Updated) >= inventoryMaxAge() {
+		err = withReauth(cCtx, func() error {
+			useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+			if err != nil {
+				return err
+			}
+			if !useUpdated {
+				return errors.New("kion bulk needs a Kion release listing cloud access roles by account")
+			}
+			inventory, err = helper.FetchInventory(cCtx)
+			if err != nil {
+				return err
+			}
+			enrichInventory(cCtx, &inventory)
+			return cacheInventory(inventory)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cars, err := helper.BulkTargets(inventory, cCtx.String("car"), filter)
+	if err != nil {
+		return err
+	}
+	if len(cars) == 0 {
+		return fmt.Errorf("no accounts matched with cloud access role %v", cCtx.String("car"))
+	}
+	policy, err := readSessionPolicy(cCtx.String("session-policy"))
+	if err != nil {
+		return err
+	}
+
+	// reuse cached keys, minting the rest in parallel
+	results := make([]helper.BulkResult, len(cars))
+	staks := make([]kion.STAK, len(cars))
+	var pending []int
+	for i, car := range cars {
+		results[i] = helper.BulkResult{Account: car.AccountNumber, AccountName: car.AccountName}
+		cached, found, err := c.GetStak(stakCacheKey(car.Name, car.AccountNumber, policy))
+		if err != nil {
+			return err
+		}
+		if found && cached.ValidFor(warmBuffer) {
+			staks[i] = cached
+			results[i].Status, results[i].Detail = helper.WarmCached, fmt.Sprintf("valid until %v", cached.Expiration.Local().Format("15:04"))
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) > 0 {
+		err = checkSession(cCtx)
+		if err != nil {
+			return err
+		}
+	}
+	err = helper.WithProgress(cCtx.Context, fmt.Sprintf("Minting short-term access keys for %v accounts", len(pending)), func(p *helper.Progress) error {
+		helper.RunParallel(len(pending), cCtx.Int("parallel"), func(n int) {
+			i := pending[n]
+			var stak kion.STAK
+			err := stakPacer.Do(cCtx.Context, func() error {
+				var err error
+				stak, err = kion.GetSTAK(config.Kion.Url, config.Kion.ApiKey, cars[i].Name, cars[i].AccountNumber)
+				return err
+			})
+			if err == nil {
+				stak, err = processSTAK(stak, cars[i].Name, cars[i].AccountNumber, policy)
+			}
+			switch {
+			case errors.Is(err, kion.ErrDryRun):
+				results[i].Status, results[i].Detail = helper.WarmSkipped, "dry run"
+			case err != nil:
+				results[i].Status, results[i].Detail = helper.WarmFailed, explainAccessError(err, cars[i].Name, cars[i].AccountNumber, "cli").Error()
+			default:
+				staks[i] = stak
+				results[i].Status, results[i].Detail = helper.WarmMinted, fmt.Sprintf("valid until %v", stak.Expiration.Local().Format("15:04"))
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// cache, record, and save the keys one at a time as each rewrites a file
+	outputs := make(map[string]helper.STAKOutput)
+	credentialsFile := ""
+	failed := 0
+	for i, car := range cars {
+		var failure error
+		switch results[i].Status {
+		case helper.WarmMinted:
+			notifySTAK(car.Name, car.AccountNumber, staks[i], policy != "")
+			err = c.SetStak(stakCacheKey(car.Name, car.AccountNumber, policy), staks[i])
+			if err != nil {
+				return err
+			}
+			if policy == "" {
+				mirrorSTAK(car.Name, car.AccountNumber, staks[i])
+			}
+		case helper.WarmFailed:
+			failed++
+			failure = errors.New(results[i].Detail)
+		}
+		if results[i].Status == helper.WarmSkipped {
+			continue
+		}
+		recordAttempt("bulk", car.AccountNumber, car.Name, failure)
+		if failure != nil {
+			continue
+		}
+		if save {
+			credentialsFile, err = helper.WriteAWSProfile(staks[i], car)
+			if err != nil {
+				return err
+			}
+		}
+		outputs[car.AccountNumber] = helper.NewSTAKOutput(staks[i], car.AccountNumber, car.Name, "")
+	}
+
+	// report the outcome, keeping it off stdout when printing the keys
+	report := io.Writer(stdout)
+	if structured {
+		report = os.Stderr
+	}
+	err = helper.PrintBulkResults(report, results)
+	if err != nil {
+		return err
+	}
+	if credentialsFile != "" {
+		fmt.Fprintf(report, "\nCredentials for %v accounts written to %v as profiles named ACCOUNT_ROLE\n", len(outputs), credentialsFile)
+	}
+	if structured {
+		err = helper.WriteOutput(stdout, outputFormat, outputs, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v accounts failed", failed, len(results))
+	}
+	return nil
+}
+
+// reconcile compares favorites, workspaces, and defaults against the projects
+// and cloud access roles the user can access now and reports what has
+// drifted. With --fix the safe updates are saved to the configuration file.
+// The last cached inventory tells renames from removals, so it isn't replaced
+// while renames are left to fix.
+func reconcile(cCtx *cli.Context) error {
+	useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return err
+	}
+	if !useUpdated {
+		return errors.New("reconciling favorites requires a version of Kion that includes account details with cloud access roles")
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// fetch projects and cloud access roles at the same time
+	previous, _, err := c.GetInventory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read the cached inventory, renames will be reported as removals: %v\n", err)
+	}
+	var live kion.Inventory
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching projects and cloud access roles", func(p *helper.Progress) error {
+			errs := make([]error, 2)
+			helper.RunParallel(2, 2, func(i int) {
+				if i == 0 {
+					live.Projects, errs[i] = kion.GetProjects(config.Kion.Url, config.Kion.ApiKey)
+				} else {
+					live.CARs, errs[i] = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+				}
+			})
+			return errors.Join(errs...)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	live.Updated = time.Now()
+	live.Accounts, live.AccountsUpdated = previous.Accounts, previous.AccountsUpdated
+
+	// report the drift
+	r := helper.Reconcile(config.Favorites, config.Workspaces, config.Defaults, previous, live)
+	drift := r.Drift
+	if drift == nil {
+		drift = []helper.Drift{}
+	}
+	table := helper.NewTable("KIND", "SUBJECT", "DETAIL", "FIX")
+	for _, d := range drift {
+		fix := d.Fix
+		if fix == "" {
+			fix = "-"
+		}
+		table.AddRow(d.Kind, d.Subject, d.Detail, fix)
+	}
+	err = helper.WriteOutput(stdout, outputFormat, drift, func(w io.Writer) error {
+		if len(drift) == 0 {
+			_, err := fmt.Fprintf(w, "No drift, all %v favorites match your access in Kion\n", len(config.Favorites))
+			return err
+		}
+		return table.Write(w)
+	})
+	if err != nil {
+		return err
+	}
+
+	// apply the safe fixes
+	fixes := r.Fixes()
+	switch {
+	case fixes == 0:
+	case !cCtx.Bool("fix"):
+		fmt.Fprintf(os.Stderr, "Run kion reconcile --fix to apply %v safe fixes\n", fixes)
+	case dryRun:
+		fmt.Fprintf(os.Stderr, "[dry-run] would apply %v fixes to %v\n", fixes, configPath)
+	default:
+		err = helper.SaveReconciliation(configPath, cCtx.String("profile"), r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, color.GreenString("Applied %v fixes to %v", fixes, configPath))
+	}
+	pendingRename := slices.ContainsFunc(r.Drift, func(d helper.Drift) bool {
+		return d.Fix != "" && d.Kind != helper.DriftMissingFavorite
+	})
+	if !pendingRename || cCtx.Bool("fix") && !dryRun {
+		err = cacheInventory(live)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only fail on drift still needing attention, uncovered accounts are
+	// there to pick from
+	var unresolved int
+	for _, d := range r.Drift {
+		if d.Kind != helper.DriftUncoveredAccount && (d.Fix == "" || !cCtx.Bool("fix")) {
+			unresolved++
+		}
+	}
+	if unresolved > 0 {
+		return fmt.Errorf("%v of %v differences need attention", unresolved, len(r.Drift))
+	}
+	return nil
+}
+
+// flushCache clears the Kion CLI cache, or only the categories given, and any
+// credentials mirrored to the AWS CLI cache when STAKs are flushed.
+func flushCache(cCtx *cli.Context) error {
+	categories := cCtx.StringSlice("only")
+	err := c.FlushCache(categories...)
+	if err != nil {
+		return err
+	}
+	if len(categories) > 0 && !slices.Contains(categories, cache.CategoryStak) {
+		return nil
+	}
+
+	// drop credentials mirrored to the aws cli cache along with the cache
+	dir, err := helper.AWSCLICacheDir()
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would remove credentials mirrored to %v\n", dir)
+		return nil
+	}
+	return helper.RemoveAWSCLICache(dir)
+}
+
+// listCache prints the entries of the Kion CLI cache and how long each has
+// left before it expires.
+func listCache(cCtx *cli.Context) error {
+	entries, err := c.ListCache()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && outputFormat == "text" {
+		fmt.Fprintln(os.Stderr, "The cache is empty")
+		return nil
+	}
+
+	now := time.Now()
+	outputs := []helper.CacheEntryOutput{}
+	table := helper.NewTable("CATEGORY", "KEY", "EXPIRES", "REMAINING")
+	for _, entry := range entries {
+		output := helper.CacheEntryOutput{Category: entry.Category, Key: entry.Key, Expired: entry.Expired(now)}
+		expires, remaining := "-", "-"
+		switch {
+		case entry.Expires.IsZero():
+		case entry.Expired(now):
+			expires, remaining = entry.Expires.Local().Format(time.RFC3339), "expired"
+		default:
+			expires, remaining = entry.Expires.Local().Format(time.RFC3339), entry.Expires.Sub(now).Round(time.Second).String()
+		}
+		if !entry.Expires.IsZero() {
+			output.Expires = entry.Expires.UTC().Format(time.RFC3339)
+		}
+		outputs = append(outputs, output)
+		table.AddRow(entry.Category, entry.Key, expires, remaining)
+	}
+	return helper.WriteOutput(stdout, outputFormat, outputs, table.Write)
+}
+
+// purgeCache removes expired entries from the Kion CLI cache, or everything
+// if asked to.
+func purgeCache(cCtx *cli.Context) error {
+	if cCtx.Bool("all") {
+		return flushCache(cCtx)
+	}
+	purged, err := c.PurgeCache()
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		fmt.Fprintf(os.Stderr, "Purged %v expired cache entries\n", len(purged))
+	}
+	return nil
+}
+
+// exportCache writes the cached session and short-term access keys to a
+// bundle encrypted with a passphrase, to carry them to a host without a
+// browser to sign in with, such as a bastion.
+func exportCache(cCtx *cli.Context) error {
+	bundle, err := cache.ExportBundle(c, config.Kion.Url, time.Now())
+	if err != nil {
+		return err
+	}
+	if bundle.Empty() {
+		return errors.New("nothing to export, sign in or mint keys first as the cache holds no unexpired session or keys")
+	}
+
+	passphrase, err := bundlePassphrase(true)
+	if err != nil {
+		return err
+	}
+	sealed, err := cache.SealBundle(bundle, passphrase)
+	if err != nil {
+		return err
+	}
+
+	out := cCtx.String("out")
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write a bundle of %v to %v\n", describeBundle(bundle), out)
+		return nil
+	}
+	err = os.WriteFile(out, sealed, 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote a bundle of %v to %v, import it with kion cache import\n", describeBundle(bundle), out)
+	return nil
+}
+
+// importCache stores the session and short-term access keys of a bundle made
+// with kion cache export in the cache, leaving out any that have expired.
+func importCache(cCtx *cli.Context) error {
+	if cCtx.NArg() != 1 {
+		return errors.New("expected the bundle to import, or - to read it from stdin")
+	}
+	var data []byte
+	var err error
+	if path := cCtx.Args().First(); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	err = cache.CheckBundle(data)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := bundlePassphrase(false)
+	if err != nil {
+		return err
+	}
+	bundle, err := cache.OpenBundle(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if !cache.SameInstance(bundle.KionURL, config.Kion.Url) {
+		return fmt.Errorf("the bundle is for %v but kion.url is %v, its tokens only work with the instance they were issued by", bundle.KionURL, config.Kion.Url)
+	}
+
+	imported, err := cache.ImportBundle(c, bundle, time.Now())
+	if err != nil {
+		return err
+	}
+	if imported.SessionExpired {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: the session in the bundle has expired and was not imported"))
+	}
+	if imported.STAKsExpired > 0 {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: %v of the short-term access keys in the bundle have expired and were not imported", imported.STAKsExpired))
+	}
+	if !imported.Session && imported.STAKs == 0 {
+		return fmt.Errorf("nothing imported, everything in the bundle exported %v has expired", bundle.Exported.Local().Format("2006-01-02 15:04"))
+	}
+	if !dryRun {
+		var parts []string
+		if imported.Session {
+			parts = append(parts, "the session")
+		}
+		if imported.STAKs > 0 {
+			parts = append(parts, fmt.Sprintf("%v short-term access keys", imported.STAKs))
+		}
+		fmt.Fprintf(os.Stderr, "Imported %v\n", strings.Join(parts, " and "))
+	}
+	return nil
+}
+
+// bundlePassphrase returns the passphrase cache bundles are encrypted with,
+// from KION_BUNDLE_PASSPHRASE or else prompted for, twice when confirm is set
+// so a typo doesn't lock the bundle.
+func bundlePassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("KION_BUNDLE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !helper.IsInteractive() {
+		return "", errors.New("a passphrase is required, set KION_BUNDLE_PASSPHRASE or run interactively to be prompted for it")
+	}
+	passphrase, err := helper.PromptPassword("Bundle passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("a passphrase is required to encrypt the bundle")
+	}
+	if confirm {
+		again, err := helper.PromptPassword("Confirm the passphrase:")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("the passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+// describeBundle summarizes what a cache bundle holds and when the last of it
+// expires.
+func describeBundle(bundle cache.Bundle) string {
+	var parts []string
+	var expires time.Time
+	if bundle.Session != (kion.Session{}) {
+		parts = append(parts, "the session")
+		expires, _ = bundle.Session.ExpiresAt()
+		if refresh, err := bundle.Session.RefreshExpiresAt(); err == nil && bundle.Session.Refresh.Token != "" && refresh.After(expires) {
+			expires = refresh
+		}
+	}
+	if len(bundle.STAKs) > 0 {
+		parts = append(parts, fmt.Sprintf("%v short-term access keys", len(bundle.STAKs)))
+	}
+	for _, stak := range bundle.STAKs {
+		if stak.Expiration.After(expires) {
+			expires = stak.Expiration
+		}
+	}
+	description := strings.Join(parts, " and ")
+	if !expires.IsZero() {
+		description += fmt.Sprintf(" usable until %v", expires.Local().Format("2006-01-02 15:04"))
+	}
+	return description
+}
+
+// checkConnectivity diagnoses how the configured Kion URL is reached from
+// here, suggesting the VPN be connected when it appears to be off.
+func checkConnectivity(cCtx *cli.Context) error {
+	if viaProxy() {
+		fmt.Fprintln(os.Stderr, "Note: a proxy or bastion is configured, dns and tls are checked from here rather than through it")
+	}
+	checks := helper.CheckConnectivity(config.Kion.Url, config.API.PrivateCIDRs)
+	err := helper.PrintURLChecks(stdout, checks)
+	if err != nil {
+		return err
+	}
+
+	if failed := helper.FailedChecks(checks); failed > 0 {
+		hint := config.API.PrivateLinkHint
+		if hint == "" {
+			hint = kion.DefaultPrivateLinkHint
+		}
+		return fmt.Errorf("unable to reach %v, %v", config.Kion.Url, hint)
+	}
+	return nil
+}
+
+// updateCheckPath is where the latest release last looked up is kept.
+func updateCheckPath() string {
+	return filepath.Join(paths.State, "update-check.json")
+}
+
+// releasesURL returns where the latest release is looked up, the upstream
+// GitHub releases unless KION_RELEASES_URL points at a mirror.
+func releasesURL() string {
+	if url := os.Getenv("KION_RELEASES_URL"); url != "" {
+		return url
+	}
+	return helper.DefaultReleasesURL
+}
+
+// update replaces the running Kion CLI with the latest release for this
+// platform, once its checksum and the signature over the checksums are
+// verified with the release key.
+func update(cCtx *cli.Context) error {
+	client := kion.ExternalClient(5 * time.Minute)
+	var release helper.Release
+	err := helper.WithProgress(cCtx.Context, "Looking up the latest release", func(p *helper.Progress) error {
+		var err error
+		release, err = helper.LatestRelease(client, releasesURL())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// only move to a newer release unless forced, builds without a version
+	// can't tell
+	newer, err := helper.NewerVersion(kionCliVersion, release.Tag)
+	if err != nil && !cCtx.Bool("force") {
+		return fmt.Errorf("%w, pass --force to install %v anyway", err, release.Tag)
+	}
+	if err == nil && !newer && !cCtx.Bool("force") {
+		fmt.Fprintf(stdout, "Kion CLI %v is the latest release\n", kionCliVersion)
+		return nil
+	}
+	if cCtx.Bool("check") {
+		fmt.Fprintf(stdout, "Kion CLI %v is available, you have %v: %v\n", release.Tag, kionCliVersion, release.URL)
+		return nil
+	}
+
+	// never install a release that can't be verified
+	publicKey := cCtx.String("public-key")
+	if publicKey == "" {
+		publicKey = kionCliPublicKey
+	}
+	if publicKey == "" {
+		return errors.New("no public key to verify the release with, use --public-key to specify one")
+	}
+	assetName := helper.ReleaseAssetName(runtime.GOOS, runtime.GOARCH)
+	var assets []helper.ReleaseAsset
+	for _, name := range []string{assetName, helper.ReleaseChecksums, helper.ReleaseSignature} {
+		asset, found := release.Asset(name)
+		if !found {
+			return fmt.Errorf("release %v has no %v", release.Tag, name)
+		}
+		assets = append(assets, asset)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would replace %v with Kion CLI %v from %v\n", exe, release.Tag, assets[0].URL)
+		return nil
+	}
+
+	// download the binary next to the executable so it can be moved over it
+	// atomically, and the checksums and signature anywhere
+	dir, err := os.MkdirTemp("", "kion-update-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	binary, err := os.CreateTemp(filepath.Dir(exe), ".kion-update-*")
+	if err != nil {
+		return fmt.Errorf("unable to write next to %v, update it with the tool it was installed with: %w", exe, err)
+	}
+	binary.Close()
+	defer os.Remove(binary.Name())
+	files := []string{binary.Name(), filepath.Join(dir, helper.ReleaseChecksums), filepath.Join(dir, helper.ReleaseSignature)}
+	err = helper.WithProgress(cCtx.Context, "Downloading Kion CLI "+release.Tag, func(p *helper.Progress) error {
+		for i, asset := range assets {
+			if p.Context().Err() != nil {
+				return p.Context().Err()
+			}
+			err := helper.DownloadFile(client, asset.URL, files[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = helper.VerifyRelease(helper.ReleaseArtifacts{
+		Binary:    files[0],
+		AssetName: assetName,
+		Checksums: files[1],
+		Signature: files[2],
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return err
+	}
+	err = helper.ReplaceExecutable(exe, files[0], runtime.GOOS)
+	if err != nil {
+		return err
+	}
+
+	color.Green("Updated Kion CLI from %v to %v", kionCliVersion, release.Tag)
+	return nil
+}
+
+// noticeUpdate notes a newer release on stderr, looking up the latest and
+// noting it each at most once a day. It stays quiet for builds without a
+// version, output meant for other programs, and when turned off with
+// kion.disable_update_check or KION_NO_UPDATE_CHECK.
+func noticeUpdate(cCtx *cli.Context) {
+	if kionCliVersion == "" || config.Kion.NoUpdateCheck || os.Getenv("KION_NO_UPDATE_CHECK") != "" ||
+		outputFormat != "text" || dryRun || cassette != nil || !helper.IsInteractive() || cCtx.Args().First() == "update" {
+		return
+	}
+
+	path := updateCheckPath()
+	check := helper.ReadUpdateCheck(path)
+	now := time.Now()
+	changed := false
+	if check.Due(now) {
+		// a failed look up waits for the next check rather than slowing every run
+		release, err := helper.LatestRelease(kion.ExternalClient(2*time.Second), releasesURL())
+		if err == nil {
+			check.Latest = release.Tag
+		}
+		check.Checked, changed = now, true
+	}
+	if notice := check.Notice(kionCliVersion, now); notice != "" {
+		color.New(color.FgYellow).Fprintln(os.Stderr, notice)
+		check.Notified, changed = now, true
+	}
+	if changed {
+		_ = helper.WriteUpdateCheck(path, check)
+	}
+}
+
+// verifyRelease validates a Kion CLI binary against a signed SHA256SUMS file
+// for users that stage release binaries manually.
+func verifyRelease(cCtx *cli.Context) error {
+	path := cCtx.Args().First()
+	if path == "" {
+		return errors.New("must specify the path to a kion binary")
+	}
+
+	// prefer a user provided key over the one embedded at build time
+	publicKey := cCtx.String("public-key")
+	if publicKey == "" {
+		publicKey = kionCliPublicKey
+	}
+	if publicKey == "" {
+		return errors.New("no public key available, use --public-key to specify one")
+	}
+
+	// default signature to sit alongside the checksums file
+	signature := cCtx.String("signature")
+	if signature == "" {
+		signature = cCtx.String("checksums") + ".sig"
+	}
+
+	err := helper.VerifyRelease(helper.ReleaseArtifacts{
+		Binary:    path,
+		AssetName: cCtx.String("asset"),
+		Checksums: cCtx.String("checksums"),
+		Signature: signature,
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	color.Green("%v verified successfully", path)
+	return nil
+}
+
+// offerConfigMigration updates outdated keys and values in the configuration
+// file. The updated configuration is used for the current run either way,
+// rewriting the file is shown as a diff and only done once confirmed.
+func offerConfigMigration() error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	migrated, migrations, err := helper.MigrateConfig(data)
+	if err != nil || len(migrations) == 0 {
+		return err
+	}
+	err = helper.ParseConfig(migrated, &config)
+	if err != nil {
+		return err
+	}
+
+	if !helper.IsInteractive() {
+		for _, migration := range migrations {
+			deprecationWarnings.Warn(migration.Deprecation, fmt.Sprintf("file=%q", configPath), fmt.Sprintf("line=%v", migration.Line))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v uses %v outdated setting(s), run 'kion config migrate' to update it\n", configPath, len(migrations))
+		return nil
+	}
+	migrationOffered = true
+
+	fmt.Fprintf(os.Stderr, "%v uses outdated settings, the following changes are proposed:\n", configPath)
+	helper.PrintConfigDiff(os.Stderr, configPath, data, migrated)
+	apply, err := helper.PromptConfirm("Apply these changes?")
+	if err != nil || !apply {
+		return err
+	}
+	return writeMigratedConfig(migrated)
+}
+
+// writeMigratedConfig replaces the configuration file, keeping its
+// permissions.
+func writeMigratedConfig(migrated []byte) error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(configPath, migrated, info.Mode().Perm())
+	if filesystem.IsReadOnly(err) {
+		return fmt.Errorf("unable to update %v as the location is read-only, make the changes manually: %w", configPath, err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updated %v\n", configPath)
+	return nil
+}
+
+// configMigrate updates outdated keys and values in the configuration file.
+// Without a terminal the changes are printed and only applied with --yes.
+func configMigrate(cCtx *cli.Context) error {
+	// the user already answered when the changes were offered at startup
+	if migrationOffered {
+		return nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	migrated, migrations, err := helper.MigrateConfig(data)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Fprintf(stdout, "%v is up to date\n", configPath)
+		return nil
+	}
+
+	helper.PrintConfigDiff(stdout, configPath, data, migrated)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write %v changes to %v\n", len(migrations), configPath)
+		return nil
+	}
+	if !cCtx.Bool("yes") {
+		return errors.New("re-run with --yes to apply these changes")
+	}
+	return writeMigratedConfig(migrated)
+}
+
+// configInit walks a new user through writing a configuration file: the Kion
+// URL, checked before going on, and how they sign in. Secrets are never
+// asked for so they don't land on disk.
+func configInit(cCtx *cli.Context) error {
+	if !helper.IsInteractive() {
+		return errors.New("config init needs an interactive terminal, use kion config set or kion bootstrap --url instead")
+	}
+	_, err := os.Stat(configPath)
+	if err == nil && !cCtx.Bool("force") {
+		return fmt.Errorf("%v already exists, change it with kion config set or pass --force to replace it", configPath)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// the url, checked before asking anything that depends on it
+	var settings structs.Kion
+	kionURL, err := helper.PromptInput("Kion URL:")
+	if err != nil {
+		return err
+	}
+	settings.Url = strings.TrimRight(kionURL, "/")
+	checks := helper.CheckKionURL(helper.URLCandidate{URL: settings.Url})
+	if failed := helper.FailedChecks(checks); failed > 0 {
+		err = helper.PrintURLChecks(stdout, checks)
+		if err != nil {
+			return err
+		}
+		proceed, err := helper.PromptConfirm(fmt.Sprintf("%v failed %v checks, use it anyway?", settings.Url, failed))
+		if err != nil {
+			return err
+		}
+		if !proceed {
+			return errors.New("no configuration written")
+		}
+	}
+
+	// how to sign in
+	methods := map[string]string{"SAML": "saml", "Password": "password", "API Key": "api_key"}
+	method, err := helper.PromptSelect("How do you sign in to Kion?", []string{"SAML", "Password", "API Key"})
+	if err != nil {
+		return err
+	}
+	settings.AuthMethod = methods[method]
+	ask := func(message string, value *string) {
+		if err == nil {
+			*value, err = helper.PromptInput(message)
+		}
+	}
+	switch settings.AuthMethod {
+	case "password":
+		ask("Username:", &settings.Username)
+		settings.IDMS, err = chooseIDMS(settings.Url)
+	case "saml":
+		ask("Path or URL of your identity provider's SAML metadata:", &settings.SamlMetadataFile)
+		ask("SAML service provider issuer, from the IDMS in Kion:", &settings.SamlIssuer)
+	case "api_key":
+		fmt.Fprintln(stdout, "Set KION_API_KEY to your app API key when running Kion CLI, it isn't saved to the configuration file")
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write a configuration for %v to %v\n", settings.Url, configPath)
+		return nil
+	}
+	err = helper.SaveConfig(configPath, helper.StarterConfig(settings))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Wrote a configuration for %v to %v, check it with kion config validate\n", settings.Url, configPath)
+	return nil
+}
+
+// chooseIDMS asks which IDMS to sign in to with a username and password,
+// from those Kion lists or by ID when they can't be listed.
+func chooseIDMS(kionURL string) (string, error) {
+	idmss, err := kion.GetIDMSs(kionURL)
+	if err != nil || len(idmss) == 0 {
+		return helper.PromptInput("IDMS ID:")
+	}
+	var options []string
+	ids := make(map[string]string)
+	for _, idms := range idmss {
+		option := fmt.Sprintf("%v (%v)", idms.Name, idms.ID)
+		options = append(options, option)
+		ids[option] = fmt.Sprint(idms.ID)
+	}
+	choice, err := helper.PromptSelect("Which IDMS do you sign in with?", options)
+	return ids[choice], err
+}
+
+// configGet prints the value of a setting in the configuration file, given
+// as its dotted path such as kion.url, with sections and lists as yaml.
+func configGet(cCtx *cli.Context) error {
+	if cCtx.Args().Len() != 1 {
+		return errors.New("expected a single setting, such as kion.url")
+	}
+	key := cCtx.Args().First()
+	data, err := os.ReadFile(configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	value, found, err := helper.ConfigValue(data, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%v is not set in %v", key, configPath)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// configSet changes a setting in the configuration file, keeping its
+// comments. Secrets are prompted for, or read from stdin without a terminal,
+// rather than taken as an argument that would be saved to shell history.
+func configSet(cCtx *cli.Context) error {
+	args := cCtx.Args().Slice()
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("expected a setting and its value, such as kion.url https://kion.example.com")
+	}
+	key := args[0]
+	err := helper.CheckConfigKey(key)
+	if err != nil {
+		return err
+	}
+
+	var value string
+	switch {
+	case helper.IsConfigSecret(key) && len(args) == 2:
+		return fmt.Errorf("%v would be saved to shell history, run kion config set %v without a value to be prompted for it", key, key)
+	case helper.IsConfigSecret(key) && helper.IsInteractive():
+		value, err = helper.PromptPassword(key + ":")
+	case helper.IsConfigSecret(key):
+		value, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		value = strings.TrimRight(value, "\r\n")
+	case len(args) == 2:
+		value = args[1]
+	default:
+		return fmt.Errorf("expected a value for %v, pass \"\" to clear it", key)
+	}
+	if err != nil {
+		return err
+	}
+	err = managedConfig.CheckValue(key, value, "kion config set")
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(configPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	updated, err := helper.SetConfigValue(data, key, value)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would set %v in %v\n", key, configPath)
+		return nil
+	}
+	if exists {
+		return writeMigratedConfig(updated)
+	}
+	err = os.MkdirAll(filepath.Dir(configPath), 0700)
+	if err == nil {
+		err = os.WriteFile(configPath, updated, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %v\n", configPath)
+	return nil
+}
+
+// configValidate checks the configuration file and prints what needs fixing:
+// outdated and unknown settings, invalid values, and inconsistent sign in
+// settings. Unless offline the Kion URL of each profile is also checked as
+// try-url does: that it's reachable, its IDMS exists, and its SAML metadata
+// loads.
+func configValidate(cCtx *cli.Context) error {
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v doesn't exist, run kion config init to write one", configPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	checks := helper.ValidateConfig(data)
+	if err := managedConfig.CheckFile(configPath); err != nil {
+		checks = append(checks, helper.URLCheck{Name: "managed", Status: helper.CheckFail, Detail: err.Error()})
+	}
+	if !cCtx.Bool("offline") {
+		var parsed structs.Configuration
+		_ = helper.ParseConfig(data, &parsed)
+		sections := map[string]structs.Kion{"kion": parsed.Kion}
+		names := []string{"kion"}
+		for name, profile := range parsed.Profiles {
+			sections["profiles."+name+".kion"] = profile.Kion
+			names = append(names, "profiles."+name+".kion")
+		}
+		slices.Sort(names[1:])
+		for _, path := range names {
+			settings := sections[path]
+			if settings.Url == "" {
+				continue
+			}
+			for _, check := range helper.CheckKionURL(helper.URLCandidate{URL: settings.Url, IDMS: settings.IDMS, SamlMetadataFile: settings.SamlMetadataFile}) {
+				check.Name = path + " " + check.Name
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	err = helper.PrintURLChecks(stdout, checks)
+	if err != nil {
+		return err
+	}
+	if failed := helper.FailedChecks(checks); failed > 0 {
+		return fmt.Errorf("%v failed %v of %v checks", configPath, failed, len(checks))
+	}
+	fmt.Fprintf(stdout, "\n%v is valid\n", configPath)
+	return nil
+}
+
+// tryURL validates a candidate Kion URL against the current configuration
+// without authenticating or changing anything, so it can be checked before
+// being saved to the config file.
+func tryURL(cCtx *cli.Context) error {
+	candidate := strings.TrimRight(cCtx.Args().First(), "/")
+	if candidate == "" {
+		return errors.New("a url to try is required")
+	}
+
+	checks := helper.CheckKionURL(helper.URLCandidate{
+		URL:              candidate,
+		CurrentURL:       config.Kion.Url,
+		IDMS:             config.Kion.IDMS,
+		SamlMetadataFile: config.Kion.SamlMetadataFile,
+	})
+	err := helper.PrintURLChecks(stdout, checks)
+	if err != nil {
+		return err
+	}
+
+	if failed := helper.FailedChecks(checks); failed > 0 {
+		return fmt.Errorf("%v failed %v of %v checks", candidate, failed, len(checks))
+	}
+	fmt.Fprintf(stdout, "\n%v is compatible, set kion.url in %v to switch\n", candidate, configPath)
+	return nil
+}
+
+// doctor checks what signing in needs, the configuration, keyring, Kion and
+// the identity provider being reachable, the SAML callback port, and the
+// clock, printing how to fix whatever fails.
+func doctor(cCtx *cli.Context) error {
+	var checks []helper.DoctorCheck
+	add := func(name string, status string, detail string, hint string) {
+		checks = append(checks, helper.DoctorCheck{URLCheck: helper.URLCheck{Name: name, Status: status, Detail: detail}, Hint: hint})
+	}
+
+	// the configuration file is optional, but needs to be valid when present
+	data, err := os.ReadFile(configPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		add("config", helper.CheckWarn, configPath+" doesn't exist", "run kion config init to write one")
+	case err != nil:
+		add("config", helper.CheckFail, err.Error(), "check the permissions of "+configPath)
+	default:
+		checks = append(checks, helper.DoctorConfig(configPath, helper.ValidateConfig(data))...)
+	}
+
+	// the keyring the cache is kept in
+	cacheDir, _ := filesystem.StateDir(paths.Cache)
+	ring, err := openKeyring(cacheDir)
+	if err == nil {
+		_, err = ring.Keys()
+	}
+	if err != nil {
+		add("keyring", helper.CheckFail, err.Error(), "choose a keyring with kion.keyring.backend, or the file backend with a passphrase in KION_KEYRING_PASSPHRASE where no keychain is available")
+	} else {
+		add("keyring", helper.CheckOK, cacheBackend, "")
+	}
+
+	// kion itself, and that this clock agrees with it
+	if config.Kion.Url == "" {
+		add("kion url", helper.CheckFail, "kion.url is not set", "set kion.url with kion config set kion.url https://kion.example.com")
+	} else {
+		connectivity := helper.CheckConnectivity(config.Kion.Url, config.API.PrivateCIDRs)
+		checks = append(checks, helper.DoctorConnectivity("kion", connectivity)...)
+		if helper.FailedChecks(connectivity) == 0 {
+			skew, err := kion.ClockSkew(config.Kion.Url)
+			checks = append(checks, helper.DoctorClock("Kion", skew, err))
+		}
+	}
+
+	// the identity provider, from its SAML metadata
+	switch {
+	case config.Kion.SamlMetadataFile != "":
+		var metadata *samlTypes.EntityDescriptor
+		if strings.HasPrefix(config.Kion.SamlMetadataFile, "http") {
+			metadata, err = kion.DownloadSAMLMetadata(config.Kion.SamlMetadataFile)
+		} else {
+			metadata, err = kion.ReadSAMLMetadataFile(config.Kion.SamlMetadataFile)
+		}
+		if err != nil {
+			add("saml metadata", helper.CheckFail, err.Error(), "check kion.saml_metadata_file is the metadata URL or file your identity provider publishes")
+			break
+		}
+		add("saml metadata", helper.CheckOK, "entity id "+metadata.EntityID, "")
+		service, err := kion.SAMLSignInService(metadata)
+		if err != nil {
+			add("idp", helper.CheckFail, err.Error(), "ask your identity provider administrator for metadata with a sign in service")
+			break
+		}
+		skew, err := kion.IdPClockSkew(service.Location)
+		if err != nil {
+			add("idp", helper.CheckFail, fmt.Sprintf("unable to reach %v: %v", service.Location, err), "connect to the network or VPN the identity provider is reached from")
+			break
+		}
+		add("idp", helper.CheckOK, "reached "+service.Location, "")
+		checks = append(checks, helper.DoctorClock("identity provider", skew, nil))
+	default:
+		add("idp", helper.CheckSkip, "no SAML metadata configured, signing in with a password or API key", "")
+	}
+
+	// the port the identity provider posts the SAML response back to
+	if config.Kion.SamlMetadataFile != "" {
+		kion.SAMLCallbackAddress = "127.0.0.1"
+		if config.Kion.SamlCallbackAddr != "" {
+			kion.SAMLCallbackAddress = config.Kion.SamlCallbackAddr
+		}
+		kion.SAMLCallbackPorts, err = nil, nil
+		if config.Kion.SamlCallbackPort != "" {
+			kion.SAMLCallbackPorts, err = kion.ParseSAMLCallbackPorts(config.Kion.SamlCallbackPort)
+		}
+		var addr string
+		if err == nil {
+			addr, err = kion.CheckSAMLCallbackPorts()
+		}
+		if err != nil {
+			add("saml callback", helper.CheckFail, err.Error(), "set kion.saml_callback_port to a range such as 8400-8410, or stop whatever is listening on the port")
+		} else {
+			add("saml callback", helper.CheckOK, "able to listen on "+addr, "")
+		}
+	}
+
+	err = helper.PrintDoctorChecks(stdout, checks)
+	if err != nil {
+		return err
+	}
+	if failed := helper.FailedDoctorChecks(checks); failed > 0 {
+		return fmt.Errorf("failed %v of %v checks", failed, len(checks))
+	}
+	fmt.Fprintln(stdout, "\nNo problems found")
+	return nil
+}
+
+// samlCallbackCertFiles returns the certificate and key the SAML callback is
+// served with over HTTPS, those configured or else a localhost certificate
+// kept in the state directory, generated when missing or about to expire.
+func samlCallbackCertFiles() (string, string, error) {
+	certFile, keyFile := config.Kion.SamlCallbackCert, config.Kion.SamlCallbackKey
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return "", "", errors.New("kion.saml_callback_cert_file and kion.saml_callback_key_file must be set together")
+		}
+		return certFile, keyFile, nil
+	}
+
+	// the certificate is also issued for the callback host when one is set
+	var hosts []string
+	if config.Kion.SamlACSHost != "" {
+		hosts = append(hosts, config.Kion.SamlACSHost)
+	}
+	certFile = filepath.Join(paths.State, "saml-callback-cert.pem")
+	keyFile = filepath.Join(paths.State, "saml-callback-key.pem")
+	if helper.CallbackCertCurrent(certFile, time.Now(), hosts...) {
+		return certFile, keyFile, nil
+	}
+	keyPEM, certPEM, err := kion.GenerateLocalhostCertificate(helper.CallbackCertValidity, hosts...)
+	if err != nil {
+		return "", "", err
+	}
+	err = os.MkdirAll(paths.State, 0700)
+	if err != nil {
+		return "", "", err
+	}
+	err = os.WriteFile(keyFile, keyPEM, 0600)
+	if err != nil {
+		return "", "", err
+	}
+	err = os.WriteFile(certFile, certPEM, 0644)
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Fprintf(os.Stderr, "Generated a localhost certificate for the SAML callback in %v, run 'kion saml trust-cert' to have browsers trust it\n", certFile)
+	return certFile, keyFile, nil
+}
+
+// trustSAMLCallbackCert prints how to have browsers trust the certificate the
+// SAML callback is served with over HTTPS, generating it first if needed.
+func trustSAMLCallbackCert(cCtx *cli.Context) error {
+	certFile, _, err := samlCallbackCertFiles()
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, helper.TrustCertInstructions(runtime.GOOS, certFile))
+	if !config.Kion.SamlCallbackTLS {
+		fmt.Fprintf(os.Stderr, "\nSet kion.saml_callback_tls to true in %v to serve the callback over HTTPS\n", configPath)
+	}
+	return nil
+}
+
+// genSAMLKeyPair generates a service provider key and certificate for
+// signing AuthnRequests, writing them to files, then prints the service
+// provider metadata to register with the identity provider. Existing files
+// are only replaced with --force.
+func genSAMLKeyPair(cCtx *cli.Context) error {
+	issuer := config.Kion.SamlIssuer
+	if issuer == "" {
+		return fmt.Errorf("set kion.saml_sp_issuer in %v, or --saml-sp-issuer, to the SAML service provider issuer value from Kion", configPath)
+	}
+
+	keyFile := cCtx.String("key-file")
+	if keyFile == "" {
+		keyFile = filepath.Join(paths.State, "saml-sp-key.pem")
+	}
+	certFile := cCtx.String("cert-file")
+	if certFile == "" {
+		certFile = filepath.Join(paths.State, "saml-sp-cert.pem")
+	}
+	if !cCtx.Bool("force") {
+		for _, file := range []string{keyFile, certFile} {
+			if _, err := os.Stat(file); err == nil {
+				return fmt.Errorf("%v already exists, pass --force to replace it", file)
+			}
+		}
+	}
+
+	// the callback may be posted to any port the listener falls back to
+	ports := []int{8400}
+	var err error
+	if config.Kion.SamlCallbackPort != "" {
+		ports, err = kion.ParseSAMLCallbackPorts(config.Kion.SamlCallbackPort)
+		if err != nil {
+			return err
+		}
+	}
+	scheme := "http"
+	if config.Kion.SamlCallbackTLS {
+		scheme = "https"
+	}
+	host := "localhost"
+	if config.Kion.SamlACSHost != "" {
+		host = config.Kion.SamlACSHost
+	}
+	var callbackURLs []string
+	for _, port := range ports {
+		callbackURLs = append(callbackURLs, fmt.Sprintf("%v://%v/callback", scheme, net.JoinHostPort(host, strconv.Itoa(port))))
+	}
+
+	keyPEM, certPEM, err := kion.GenerateSAMLKeyPair("kion-cli", time.Duration(cCtx.Int("days"))*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(keyFile, keyPEM, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(certFile), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(certFile, certPEM, 0644)
+	if err != nil {
+		return err
+	}
+
+	keyStore, err := kion.LoadSAMLKeyPair(keyFile, certFile)
+	if err != nil {
+		return err
+	}
+	metadata, err := kion.SAMLServiceProviderMetadata(issuer, callbackURLs, keyStore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote the signing key to %v and its certificate to %v\n", keyFile, certFile)
+	fmt.Fprintf(os.Stderr, "Set kion.saml_sp_key_file and kion.saml_sp_cert_file to these paths in %v, then register this metadata with your identity provider:\n", configPath)
+	_, err = os.Stdout.Write(metadata)
+	return err
+}
+
+// testSAML runs a SAML sign in step by step, reporting each as it completes
+// so identity provider admins can tell exactly where a failing sign in
+// breaks: the metadata, the binding requests are sent with, request signing,
+// the callback listener and whether it can be reached, the response posted
+// back, and each step of exchanging it with Kion. The session Kion issues is
+// discarded, nothing is cached and no short term access keys are requested.
+func testSAML(cCtx *cli.Context) error {
+	if config.Kion.Url == "" {
+		return errors.New("a Kion url is required, set kion.url or pass --endpoint")
+	}
+	samlMetadataFile, samlServiceProviderIssuer, err := samlSettings()
+	if err != nil {
+		return err
+	}
+
+	var checks []helper.URLCheck
+	step := func(name string, status string, format string, args ...any) {
+		check := helper.URLCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)}
+		checks = append(checks, check)
+		fmt.Fprintf(stdout, "%-19v %-5v %v\n", check.Name, check.Status, check.Detail)
+	}
+	fail := func(name string, err error) error {
+		step(name, helper.CheckFail, "%v", err)
+		return fmt.Errorf("SAML sign in failed at the %v step", name)
+	}
+
+	// the metadata describes the identity provider and its certificates
+	samlMetadata, err := readSAMLMetadata(samlMetadataFile)
+	if err != nil {
+		return fail("metadata", err)
+	}
+	certs, err := kion.SAMLCertificates(samlMetadata)
+	if err != nil {
+		return fail("metadata", err)
+	}
+	now := time.Now()
+	expired := 0
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) {
+			expired++
+		}
+	}
+	switch {
+	case len(certs) == 0:
+		return fail("metadata", errors.New("no signing certificates listed, responses can't be verified"))
+	case expired == len(certs):
+		return fail("metadata", fmt.Errorf("every signing certificate has expired, download the metadata again from the identity provider"))
+	case expired > 0:
+		step("metadata", helper.CheckWarn, "entity id %v, %v of %v signing certificate(s) expired", samlMetadata.EntityID, expired, len(certs))
+	default:
+		step("metadata", helper.CheckOK, "entity id %v, %v signing certificate(s)", samlMetadata.EntityID, len(certs))
+	}
+
+	// sign in requests are sent with the redirect binding
+	if config.Kion.SamlIdPURL != "" {
+		step("binding", helper.CheckSkip, "sign in starts at the identity provider, %v", config.Kion.SamlIdPURL)
+	} else {
+		service, err := kion.SAMLSignInService(samlMetadata)
+		if err != nil {
+			return fail("binding", err)
+		}
+		if service.Binding == kion.SAMLBindingRedirect {
+			step("binding", helper.CheckOK, "HTTP-Redirect to %v", service.Location)
+		} else {
+			step("binding", helper.CheckWarn, "no HTTP-Redirect binding, sending the request to %v (%v) anyway", service.Location, service.Binding)
+		}
+	}
+
+	err = loadSAMLSigningKey()
+	if err != nil {
+		return fail("request signing", err)
+	}
+	if kion.SAMLSigningKeyStore == nil {
+		step("request signing", helper.CheckSkip, "requests are unsigned, run kion saml gen-keypair if the identity provider requires signing")
+	} else {
+		step("request signing", helper.CheckOK, "signed with %v", config.Kion.SamlSPCertFile)
+	}
+
+	// the callback must be listening, and reachable, before the browser is
+	// sent to sign in
+	if config.Kion.SamlACSHost != "" {
+		address := config.Kion.SamlCallbackAddr
+		if address == "" {
+			address = "127.0.0.1"
+		}
+		err = kion.CheckSAMLCallbackHost(context.Background(), config.Kion.SamlACSHost, address)
+		if err != nil {
+			return fail("acs host", err)
+		}
+		step("acs host", helper.CheckOK, "%v resolves to this machine", config.Kion.SamlACSHost)
+	}
+	err = configureSAMLCallback()
+	if err != nil {
+		return fail("callback", err)
+	}
+	callback, err := kion.ListenSAMLCallback(samlMetadata, samlServiceProviderIssuer)
+	if err != nil {
+		return fail("callback", err)
+	}
+	defer callback.Close()
+	step("callback", helper.CheckOK, "listening at %v", callback.URL)
+	warning, err := callback.Probe()
+	if err != nil {
+		return fail("callback reachable", err)
+	}
+	if warning != "" {
+		step("callback reachable", helper.CheckWarn, "%v", warning)
+	} else {
+		step("callback reachable", helper.CheckOK, "connected to %v", callback.URL)
+	}
+
+	authURL, err := callback.SignInURL()
+	if err != nil {
+		return fail("sign in", err)
+	}
+	kion.OpenSAMLSignIn(authURL)
+
+	// wait for the response, checking it and exchanging it with Kion as it
+	// arrives so the browser is told whether the sign in worked
+	var posted []byte
+	var assertion kion.SAMLAssertion
+	var inspectErr, validateErr, exchangeErr error
+	err = helper.WithProgress(context.Background(), "Waiting for SAML sign in to complete in your browser", func(p *helper.Progress) error {
+		ctx, cancel := context.WithTimeout(p.Context(), cCtx.Duration("timeout"))
+		defer cancel()
+		return callback.ServeContext(ctx, func(form []byte, raw []byte) error {
+			posted = raw
+			assertion, inspectErr = kion.InspectSAMLResponse(raw, samlMetadata)
+			validateErr = callback.ValidateResponse(form)
+			_, exchangeErr = kion.ExchangeSAMLResponse(config.Kion.Url, form)
+			return exchangeErr
+		})
+	})
+	switch {
+	case errors.Is(err, kion.ErrCallbackTimeout):
+		return fail("sign in", fmt.Errorf("no SAML response was posted to %v within %v, check the identity provider sends responses there", callback.URL, cCtx.Duration("timeout")))
+	case posted == nil:
+		return fail("sign in", err)
+	}
+	step("sign in", helper.CheckOK, "SAML response posted to %v", callback.URL)
+
+	if file := cCtx.String("save-response"); file != "" {
+		err := os.WriteFile(file, posted, 0600)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Saved the SAML response to %v, run kion debug saml-replay %v to send it to Kion again\n", file, file)
+	}
+
+	// local checks of the assertion only fail the sign in when Kion agrees
+	expect := helper.SAMLExpectations{Issuer: samlMetadata.EntityID, Audience: samlServiceProviderIssuer}
+	problemStatus := helper.CheckWarn
+	if exchangeErr != nil {
+		problemStatus = helper.CheckFail
+	}
+	if inspectErr != nil {
+		step("assertion", problemStatus, "unable to inspect the response: %v", inspectErr)
+	} else if problems := helper.SAMLProblems(assertion, expect, time.Now()); len(problems) > 0 {
+		step("assertion", problemStatus, "%v", strings.Join(problems, "; "))
+	} else {
+		step("assertion", helper.CheckOK, "%v signature, issued to %v by %v", assertion.Signature, assertion.Subject, assertion.Issuer)
+	}
+	if validateErr != nil {
+		step("validation", problemStatus, "a sign in would stop here: %v", validateErr)
+	} else {
+		step("validation", helper.CheckOK, "signature, audience, and validity window check out")
+	}
+
+	// report each step of the exchange, up to the one that failed
+	var failedStep string
+	var stepErr *kion.SAMLExchangeError
+	if errors.As(exchangeErr, &stepErr) {
+		failedStep = stepErr.Step
+	} else if exchangeErr != nil {
+		return fail("kion exchange", exchangeErr)
+	}
+	reached := true
+	for _, exchangeStep := range kion.SAMLExchangeSteps {
+		name := "kion " + exchangeStep
+		switch {
+		case !reached:
+			step(name, helper.CheckSkip, "not reached")
+		case exchangeStep == failedStep:
+			step(name, helper.CheckFail, "%v", errors.Unwrap(stepErr))
+			reached = false
+		default:
+			step(name, helper.CheckOK, "done")
+		}
+	}
+
+	if failed := helper.FailedChecks(checks); failed > 0 {
+		if hint := helper.SAMLReplayHint(exchangeErr); hint != "" {
+			fmt.Fprintf(os.Stderr, "\n%v\n", hint)
+		}
+		for _, check := range checks {
+			if check.Status == helper.CheckFail {
+				return fmt.Errorf("SAML sign in failed at the %v step", check.Name)
+			}
+		}
+	}
+	fmt.Fprintln(stdout, "\nSAML sign in works, the session Kion issued was discarded")
+	return nil
+}
+
+// debugSAMLResponse prints a summary of a saved SAML response for
+// troubleshooting identity provider configuration. The signature is verified
+// against the configured SAML metadata when there is one. Nothing is sent to
+// Kion.
+func debugSAMLResponse(cCtx *cli.Context) error {
+	data, err := readFileOrStdin(cCtx.String("dump-assertion"))
+	if err != nil {
+		return err
+	}
+	return printSAMLResponse(os.Stdout, data)
+}
+
+// replaySAMLResponse sends a saved SAML response to Kion as the browser would
+// after signing in, skipping the identity provider, to tell whether a failing
+// sign in is rejected by the identity provider or by Kion. The session Kion
+// issues is discarded.
+func replaySAMLResponse(cCtx *cli.Context) error {
+	if cCtx.Args().Len() != 1 {
+		return errors.New("a file holding the SAML response is required, - for stdin")
+	}
+	if config.Kion.Url == "" {
+		return errors.New("a Kion url is required, set kion.url or pass --endpoint")
+	}
+	data, err := readFileOrStdin(cCtx.Args().First())
+	if err != nil {
+		return err
+	}
+	form, err := kion.SAMLFormPost(data)
+	if err != nil {
+		return err
+	}
+
+	// show what is being replayed so expired responses are obvious
+	err = printSAMLResponse(os.Stderr, data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would POST the SAML response to %v/api/v1/saml/callback\n", config.Kion.Url)
+		return nil
+	}
+
+	_, err = kion.ExchangeSAMLResponse(config.Kion.Url, form)
+	var exchangeErr *kion.SAMLExchangeError
+	if errors.As(err, &exchangeErr) {
+		fmt.Fprintf(os.Stderr, "Replay failed at the %v step.\n", exchangeErr.Step)
+	}
+	if hint := helper.SAMLReplayHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+	return err
+}
+
+// printSAMLResponse writes a summary of a SAML response, verifying its
+// signature against the configured SAML metadata when there is one.
+func printSAMLResponse(w io.Writer, data []byte) error {
+	var metadata *samlTypes.EntityDescriptor
+	var expect helper.SAMLExpectations
+	var err error
+	if config.Kion.SamlMetadataFile != "" {
+		metadata, err = readSAMLMetadata(config.Kion.SamlMetadataFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: the signature can't be verified: %v\n", err)
+		} else {
+			expect.Issuer = metadata.EntityID
+		}
+	}
+	expect.Audience = config.Kion.SamlIssuer
+
+	assertion, err := kion.InspectSAMLResponse(data, metadata)
+	if err != nil {
+		return err
+	}
+	helper.PrintSAMLAssertion(w, assertion, expect, time.Now())
+	return nil
+}
+
+// readFileOrStdin reads the named file, or stdin if the name is -.
+func readFileOrStdin(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// openPage opens a project or account page of the Kion web UI. IDs of
+// resources found by name are remembered in the cache so later lookups skip
+// the API, and the account most recently accessed is opened when no account
+// is given.
+func openPage(cCtx *cli.Context) error {
+	page := cCtx.Args().Get(0)
+	query := cCtx.Args().Get(1)
+	if page == "" {
+		return fmt.Errorf("a page to open is required, one of %v", strings.Join(helper.KionUIPages(), ", "))
+	}
+	resource, err := helper.KionUIResource(page)
+	if err != nil {
+		return err
+	}
+
+	// default to the account last touched
+	if query == "" && resource == "account" {
+		entries, err := helper.ReadAudit(auditPath)
+		if err != nil {
+			return err
+		}
+		query = helper.LastAccount(entries, config.Kion.Url)
+	}
+	if query == "" {
+		return fmt.Errorf("a %v name or ID is required", resource)
+	}
+
+	// look for a remembered id before asking kion
+	var id uint
+	cacheKey := fmt.Sprintf("open/%v/%v", resource, strings.ToLower(query))
+	cached, found, err := c.GetSelection(cacheKey)
+	if err != nil {
+		return err
+	}
+	if parsed, err := strconv.ParseUint(cached, 10, 0); found && err == nil {
+		id = uint(parsed)
+	} else {
+		err := setAuthToken(cCtx)
+		if err != nil {
+			return err
+		}
+		var resources []helper.UIResource
+		err = withReauth(cCtx, func() error {
+			resources = nil
+			if resource == "project" {
+				projects, err := kion.GetProjects(config.Kion.Url, config.Kion.ApiKey)
+				for _, p := range projects {
+					resources = append(resources, helper.UIResource{ID: p.ID, Name: p.Name})
+				}
+				return err
+			}
+			cars, err := kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			seen := make(map[uint]bool)
+			for _, car := range cars {
+				if car.AccountID != 0 && !seen[car.AccountID] {
+					seen[car.AccountID] = true
+					resources = append(resources, helper.UIResource{ID: car.AccountID, Name: car.AccountName, Number: car.AccountNumber})
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		match, err := helper.FindUIResource(resources, query)
+		if err != nil {
+			return fmt.Errorf("%v: %w", resource, err)
+		}
+		id = match.ID
+		err = c.SetSelection(cacheKey, strconv.FormatUint(uint64(id), 10))
+		if err != nil {
+			return err
+		}
+	}
+
+	link, err := helper.KionUIURL(config.Kion.Url, page, id)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would open %v in the browser\n", link)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Opening %v\n", link)
+	return helper.OpenURL(link)
+}
+
+// sshCert requests a short-lived SSH certificate from the signing service in
+// an account using fresh short term access keys, and adds it to the SSH agent
+// along with the key it certifies.
+func sshCert(cCtx *cli.Context) error {
+	accNum := cCtx.String("account")
+	carName := cCtx.String("car")
+	if accNum == "" || carName == "" {
+		return errors.New("must specify --account and --car parameters")
+	}
+	err := helper.RequireAWS(kion.CloudForAccountNumber(accNum), accNum, "ssh certificates")
+	if err != nil {
+		return err
+	}
+
+	// principals default to the local user
+	principals := cCtx.StringSlice("principal")
+	if len(principals) == 0 {
+		principals = config.SSHCert.Principals
+	}
+	if len(principals) == 0 {
+		current, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("unable to determine the local user, set --principal: %w", err)
+		}
+		principals = []string{current.Username}
+	}
+
+	key, err := helper.NewSSHCertKey()
+	if err != nil {
+		return err
+	}
+	vars := helper.SSHCertVars{
+		Account:    accNum,
+		CAR:        carName,
+		Region:     helper.SSHCertRegion(config.SSHCert),
+		Principals: principals,
+		PublicKey:  key.AuthorizedKey(),
+	}
+	if dryRun {
+		target, err := helper.RenderSSHCertTemplate(config.SSHCert.Target, vars)
+		if err != nil {
+			return err
+		}
+		return printDryRun("ssh-cert", accNum, carName, vars.Region, target)
+	}
+
+	// always use a fresh stak, certificates outlive cached keys otherwise
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+	stak, err := fetchSTAK(cCtx, carName, accNum, "")
+	if err != nil {
+		return err
+	}
+	recordAccess("ssh-cert", accNum, carName)
+
+	cert, err := helper.RequestSSHCert(config.SSHCert, stak, vars, key)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("kion-cli %v %v", accNum, carName)
+	err = helper.AddSSHCertToAgent(key, cert, comment, time.Now())
+	if err != nil {
+		return err
+	}
+
+	expires := time.Unix(int64(cert.ValidBefore), 0)
+	fmt.Fprintf(os.Stderr, "Added a certificate for %v to the ssh agent, valid until %v\n", strings.Join(cert.ValidPrincipals, ", "), expires.Format(time.RFC1123))
+	return nil
+}
+
+// awsConfigSync writes an AWS profile for each favorite into a managed block
+// of the AWS config file so AWS tooling can source credentials from Kion CLI.
+// Profiles already defined outside of the block are left alone.
+func awsConfigSync(cCtx *cli.Context) error {
+	path, err := helper.AWSConfigPath()
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// read the current config, it is fine if there isn't one yet
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	contents := string(data)
+
+	// build the managed block
+	profiles, skipped, dynamic := helper.AWSProfiles(config.Favorites, cCtx.String("prefix"), helper.UnmanagedAWSProfiles(contents))
+	for _, name := range skipped {
+		fmt.Fprintf(os.Stderr, "Warning: skipping profile %v as it is already defined in %v\n", name, path)
+	}
+	for _, name := range dynamic {
+		fmt.Fprintf(os.Stderr, "Note: skipping favorite %v as its account is only found when used, which can prompt where AWS tools can't answer\n", name)
+	}
+	block := helper.AWSConfigBlock(profiles, executable, cCtx.String("profile"))
+	updated, err := helper.ReplaceAWSConfigBlock(contents, block)
+	if err != nil {
+		return fmt.Errorf("unable to update %v: %w", path, err)
+	}
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write %v profiles to %v:\n", len(profiles), path)
+		fmt.Fprint(stdout, block)
+		return nil
+	}
+	if updated == contents {
+		fmt.Fprintf(stdout, "%v is up to date\n", path)
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, []byte(updated), 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Wrote %v profiles to %v\n", len(profiles), path)
+	return nil
+}
+
+// configSchema prints a schema describing the configuration file for use by
+// editors and configuration management tooling.
+func configSchema(cCtx *cli.Context) error {
+	format := cCtx.String("format")
+	if format != "jsonschema" {
+		return fmt.Errorf("unsupported schema format: %v", format)
+	}
+
+	schema, err := helper.ConfigSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
+
+// about prints version and build provenance details, optionally including
+// the dependency manifest embedded in the binary.
+func about(cCtx *cli.Context) error {
+	info, _ := debug.ReadBuildInfo()
+	return helper.PrintAbout(stdout, kionCliVersion, info, cCtx.Bool("sbom"))
+}
+
+// supportBundle gathers the version, sanitized configuration, environment,
+// connectivity checks, recent audit log entries, and federation captures
+// into a tarball for attaching to an issue. Nothing is sent anywhere.
+func supportBundle(cCtx *cli.Context) error {
+	var about bytes.Buffer
+	info, _ := debug.ReadBuildInfo()
+	err := helper.PrintAbout(&about, kionCliVersion, info, false)
+	if err != nil {
+		fmt.Fprintf(&about, "\n%v\n", err)
+	}
+	sanitized, err := helper.SanitizeConfig(config)
+	if err != nil {
+		return fmt.Errorf("unable to sanitize the configuration: %w", err)
+	}
+	bundle := helper.SupportBundle{
+		Created:         time.Now(),
+		Version:         kionCliVersion,
+		Platform:        runtime.GOOS + "/" + runtime.GOARCH,
+		About:           about.String(),
+		Config:          sanitized,
+		Environment:     helper.SupportEnvironment(os.Environ()),
+		ManagedSettings: managedConfig.Keys(),
+	}
+
+	if !cCtx.Bool("skip-checks") {
+		bundle.Checks = helper.SupportChecks(helper.URLCandidate{
+			URL:              config.Kion.Url,
+			IDMS:             config.Kion.IDMS,
+			SamlMetadataFile: config.Kion.SamlMetadataFile,
+		}, config.API.PrivateCIDRs)
+	}
+
+	entries, err := helper.ReadAudit(filepath.Join(paths.State, "audit.log"))
+	if err != nil {
+		return fmt.Errorf("unable to read the audit log: %w", err)
+	}
+	if len(entries) > helper.SupportAuditEntries {
+		entries = entries[len(entries)-helper.SupportAuditEntries:]
+	}
+	bundle.Audit = entries
+
+	dir := filepath.Join(paths.State, "support")
+	bundle.Captures, err = helper.RecentCaptures(dir)
+	if err != nil {
+		return fmt.Errorf("unable to list the federation captures: %w", err)
+	}
+
+	path := cCtx.String("file")
+	if path == "" {
+		path = filepath.Join(dir, "kion-support-"+bundle.Created.UTC().Format("20060102T150405Z")+".tar.gz")
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write a support bundle to %v\n", path)
+		return nil
+	}
+	err = helper.WriteSupportBundle(path, bundle)
+	if err != nil {
+		return fmt.Errorf("unable to write the support bundle: %w", err)
+	}
+	if failed := helper.FailedChecks(bundle.Checks); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%v of %v checks failed, see checks.json in the bundle\n", failed, len(bundle.Checks))
+	}
+	color.Green("Saved a support bundle to %v, review it before attaching it to an issue", path)
+	return nil
+}
+
+// shellInit prints a function wrapping kion so stak and favorite set
+// short-term access keys in the current shell rather than a sub-shell.
+func shellInit(cCtx *cli.Context) error {
+	if cCtx.Args().Len() > 1 {
+		return fmt.Errorf("expected a single shell, one of %v", strings.Join(helper.ShellInitShells, ", "))
+	}
+	script, err := helper.ShellInit(cCtx.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// bootstrap sets up Kion CLI on a new machine in one go: writing a starter
+// configuration if there is none, loading completion and the shell-init
+// wrapper from the shell's startup file, and checking Kion can be reached and
+// signed in to. Running it again updates what it set up in place.
+func bootstrap(cCtx *cli.Context) error {
+	// configuration, the url was asked for on the way in if not given
+	fmt.Fprintln(stdout, color.New(color.Bold).Sprint("Configuration"))
+	_, err := os.Stat(configPath)
+	switch {
+	case err == nil:
+		fmt.Fprintf(stdout, "  Using the existing configuration in %v\n", configPath)
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	case dryRun:
+		fmt.Fprintf(os.Stderr, "[dry-run] would write a configuration for %v to %v\n", config.Kion.Url, configPath)
+	default:
+		err = helper.SaveConfig(configPath, helper.StarterConfig(config.Kion))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "  Wrote a configuration for %v to %v\n", config.Kion.Url, configPath)
+	}
+
+	// completion and the shell-init wrapper
+	fmt.Fprintln(stdout, color.New(color.Bold).Sprint("Shell"))
+	if !cCtx.Bool("skip-shell") {
+		err = bootstrapShell(cCtx.String("shell"))
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(stdout, "  Skipped")
+	}
+
+	// make sure kion is reachable and the user can sign in
+	fmt.Fprintln(stdout, color.New(color.Bold).Sprint("Checks"))
+	if cCtx.Bool("skip-checks") {
+		fmt.Fprintln(stdout, "  Skipped")
+		return nil
+	}
+	err = checkConnectivity(cCtx)
+	if err != nil {
+		return err
+	}
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "  Signed in with access to %v cloud access roles\n", len(cars))
+	color.Green("Kion CLI is set up, open a new shell to start using it")
+	return nil
+}
+
+// bootstrapShell loads completion and the shell-init wrapper from the startup
+// file of shell, the login shell if not given.
+func bootstrapShell(shell string) error {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	if !slices.Contains(helper.BootstrapShells, shell) {
+		fmt.Fprintf(stdout, "  Skipped, %q isn't supported, pass --shell %v\n", shell, strings.Join(helper.BootstrapShells, "|"))
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path, err := helper.ShellRCPath(shell, home, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	// run kion by name when it's on the path so upgrades are picked up
+	binary := "kion"
+	if _, err := exec.LookPath(binary); err != nil {
+		binary, err = os.Executable()
+		if err != nil {
+			return err
+		}
+	}
+	lines, err := helper.ShellIntegration(shell, binary)
+	if err != nil {
+		return err
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	updated, changed := helper.SetRCBlock(string(contents), lines)
+	switch {
+	case !changed:
+		fmt.Fprintf(stdout, "  Completion and the kion wrapper are already loaded in %v\n", path)
+	case dryRun:
+		fmt.Fprintf(os.Stderr, "[dry-run] would load completion and the kion wrapper in %v\n", path)
+	default:
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(updated), 0644)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "  Loaded completion and the kion wrapper in %v\n", path)
+	}
+	return nil
+}
+
+// completion prints a script completing kion commands, flags, favorites, and
+// flag values such as accounts for a shell, with favorites described when
+// asked.
+func completion(cCtx *cli.Context) error {
+	if cCtx.Args().Len() != 1 {
+		return fmt.Errorf("expected a single shell, one of %v", strings.Join(helper.CompletionShells, ", "))
+	}
+	shell := cCtx.Args().First()
+	var fishCommands string
+	if shell == "fish" {
+		var err error
+		fishCommands, err = cCtx.App.ToFishCompletion()
+		if err != nil {
+			return err
+		}
+	}
+	script, err := helper.CompletionScript(shell, cCtx.Bool("describe"), fishCommands)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// completeFavorites completes the first argument with favorite names,
+// described by their account and project in shells that ask for it.
+func completeFavorites(cCtx *cli.Context) {
+	// complete flags as usual
+	if strings.HasPrefix(os.Args[len(os.Args)-2], "-") {
+		cli.DefaultCompleteWithFlags(cCtx.Command)(cCtx)
+		return
+	}
+	// complete if no args are passed
+	if cCtx.NArg() > 0 {
+		return
+	}
+	// else pass favorites
+	fNames, fMap := helper.MapFavs(config.Favorites)
+	shell := os.Getenv(helper.CompletionEnv)
+	var index helper.CompletionIndex
+	if shell != "" {
+		// completions go undescribed rather than fail
+		index, _ = helper.ReadCompletionIndex(completionIndexPath())
+	}
+	for _, f := range fNames {
+		var description string
+		if shell != "" {
+			description = helper.FavoriteDescription(fMap[f], index)
+		}
+		fmt.Println(helper.FormatCompletion(shell, f, description))
+	}
+}
+
+// completeFlagValues has the app and each of its commands complete the values
+// of flags naming accounts, cloud access roles, projects, and profiles,
+// falling back to their own completions otherwise.
+func completeFlagValues(app *cli.App) {
+	if app.BashComplete == nil {
+		app.BashComplete = cli.DefaultAppComplete
+	}
+	app.BashComplete = withFlagValues(app.BashComplete)
+	var wrap func(commands []*cli.Command)
+	wrap = func(commands []*cli.Command) {
+		for _, cmd := range commands {
+			if cmd.BashComplete == nil {
+				cmd.BashComplete = cli.DefaultCompleteWithFlags(cmd)
+			}
+			cmd.BashComplete = withFlagValues(cmd.BashComplete)
+			wrap(cmd.Subcommands)
+		}
+	}
+	wrap(app.Commands)
+}
+
+// withFlagValues completes the value of a flag when one is being completed,
+// from the completion index and the configured profiles, and uses complete
+// otherwise.
+func withFlagValues(complete cli.BashCompleteFunc) cli.BashCompleteFunc {
+	return func(cCtx *cli.Context) {
+		// the completion flag comes last, after the words before the cursor
+		flag := helper.CompletionFlag(os.Args[:len(os.Args)-1])
+		if flag == "" {
+			complete(cCtx)
+			return
+		}
+		// completions go empty rather than fail
+		index, _ := helper.ReadCompletionIndex(completionIndexPath())
+		profiles := make([]string, 0, len(config.Profiles))
+		for name := range config.Profiles {
+			profiles = append(profiles, name)
+		}
+		for _, line := range helper.FlagCompletions(flag, os.Getenv(helper.CompletionEnv), index, profiles) {
+			fmt.Println(line)
+		}
+	}
+}
+
+// cleanProfiles removes the profiles Kion CLI saved to the AWS credentials
+// file once their keys have expired, or all of them with --all. Profiles
+// written by anything else are left alone.
+func cleanProfiles(cCtx *cli.Context) error {
+	path, err := helper.AWSCredentialsPath()
+	if err != nil {
+		return err
+	}
+	contents, err := helper.ReadAWSCredentials(path)
+	if err != nil {
+		return err
+	}
+	updated, removed := helper.CleanAWSCredentials(contents, time.Now(), cCtx.Bool("all"))
+	if len(removed) == 0 {
+		fmt.Fprintf(stdout, "No profiles to remove from %v\n", path)
+		return nil
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would remove %v from %v\n", strings.Join(removed, ", "), path)
+		return nil
+	}
+	err = helper.WriteAWSCredentials(path, updated)
+	if err != nil {
+		return err
+	}
+	color.Green("Removed %v from %v", strings.Join(removed, ", "), path)
+	return nil
+}
+
+// printPaths prints where Kion CLI keeps its files, and any legacy locations
+// still in use.
+func printPaths(cCtx *cli.Context) error {
+	files := []helper.PathOutput{
+		{File: "configuration", Path: paths.Config},
+		{File: "managed configuration", Path: helper.ManagedConfigPath(runtime.GOOS, os.Getenv)},
+		{File: "state", Path: paths.State},
+		{File: "audit log", Path: filepath.Join(paths.State, "audit.log")},
+		{File: "device id", Path: filepath.Join(paths.State, "device-id")},
+		{File: "browser sessions", Path: filepath.Join(paths.State, "browser-sessions.json")},
+		{File: "request quota", Path: filepath.Join(paths.State, "quota.json")},
+		{File: "pinned accounts", Path: pinsPath()},
+		{File: "support bundles", Path: filepath.Join(paths.State, "support")},
+		{File: "saml signing key", Path: filepath.Join(paths.State, "saml-sp-key.pem")},
+		{File: "saml callback certificate", Path: filepath.Join(paths.State, "saml-callback-cert.pem")},
+		{File: "completion index", Path: completionIndexPath()},
+		{File: "account regions", Path: filepath.Join(paths.State, "account-regions.json")},
+		{File: "update check", Path: updateCheckPath()},
+		{File: "file cache", Path: paths.Cache},
+	}
+	table := helper.NewTable("FILE", "PATH")
+	for _, file := range files {
+		table.AddRow(file.File, file.Path)
+	}
+	return helper.WriteOutput(stdout, outputFormat, files, table.Write)
+}
+
+// whoami prints the Kion instance, user, and credentials Kion CLI would use,
+// without signing in.
+func whoami(cCtx *cli.Context) error {
+	identity, err := currentIdentity(cCtx)
+	if err != nil {
+		return err
+	}
+	return helper.WriteOutput(stdout, outputFormat, identity, func(w io.Writer) error {
+		return helper.PrintIdentity(w, identity, time.Now())
+	})
+}
+
+// pinAccounts pins accounts on this workstation, leaving them out of the
+// pickers and refusing favorites that use them unless --force is passed, such
+// as for accounts under legal hold. With no accounts given the pinned
+// accounts are listed.
+func pinAccounts(cCtx *cli.Context) error {
+	pins, err := helper.ReadPins(pinsPath())
+	if err != nil {
+		return err
+	}
+	accounts := cCtx.Args().Slice()
+	if len(accounts) == 0 {
+		outputs := helper.NewPinOutputs(pins)
+		return helper.WriteOutput(stdout, outputFormat, outputs, func(w io.Writer) error {
+			return helper.PrintPins(w, outputs)
+		})
+	}
+
+	for _, account := range accounts {
+		pins[account] = helper.PinnedAccount{Reason: cCtx.String("reason"), Pinned: time.Now().UTC()}
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would pin %v in %v\n", strings.Join(accounts, ", "), pinsPath())
+		return nil
+	}
+	err = helper.WritePins(pinsPath(), pins)
+	if err != nil {
+		return err
+	}
+	color.Green("Pinned %v on this workstation, pass --force to select pinned accounts anyway", strings.Join(accounts, ", "))
+	return nil
+}
+
+// unpinAccounts lets pinned accounts be selected again.
+func unpinAccounts(cCtx *cli.Context) error {
+	accounts := cCtx.Args().Slice()
+	if len(accounts) == 0 {
+		return errors.New("expected the accounts to unpin")
+	}
+	pins, err := helper.ReadPins(pinsPath())
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if _, found := pins[account]; !found {
+			return fmt.Errorf("account %v is not pinned", account)
+		}
+		delete(pins, account)
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would unpin %v in %v\n", strings.Join(accounts, ", "), pinsPath())
+		return nil
+	}
+	err = helper.WritePins(pinsPath(), pins)
+	if err != nil {
+		return err
+	}
+	color.Green("Unpinned %v", strings.Join(accounts, ", "))
+	return nil
+}
+
+// status prints what whoami does along with the request quota Kion last
+// reported, so users of bulk operations can tell how close they are to its
+// rate limit. Nothing is sent to Kion.
+func status(cCtx *cli.Context) error {
+	identity, err := currentIdentity(cCtx)
+	if err != nil {
+		return err
+	}
+	status := helper.Status{Identity: identity}
+	quotas, err := helper.ReadQuotas(quotaPath)
+	if err != nil {
+		return fmt.Errorf("unable to read the last request quota: %w", err)
+	}
+	if quota, found := quotas[config.Kion.Url]; found {
+		status.Quota = helper.NewQuotaOutput(quota)
+	}
+	return helper.WriteOutput(stdout, outputFormat, status, func(w io.Writer) error {
+		return helper.PrintStatus(w, status, time.Now())
+	})
+}
+
+// currentIdentity returns who Kion CLI acts as from the configuration and
+// cached session.
+func currentIdentity(cCtx *cli.Context) (helper.Identity, error) {
+	identity := helper.Identity{
+		URL:      config.Kion.Url,
+		Profile:  cCtx.String("profile"),
+		Username: config.Kion.Username,
+		IDMS:     config.Kion.IDMS,
+		Auth:     "none",
+		DeviceID: kion.DeviceID,
+		Cache:    cacheBackend,
+	}
+	if config.Kion.ApiKey != "" {
+		identity.Auth = "api_key"
+	} else {
+		session, found, err := c.GetSession()
+		if err != nil {
+			return identity, err
+		}
+		expires, err := session.ExpiresAt()
+		if found && err == nil {
+			// an expired session is shown as such, it explains requests
+			// being refused until it is refreshed or replaced
+			identity.Auth = "session"
+			if time.Until(expires) <= 0 {
+				identity.Auth = "expired session"
+			}
+			identity.SessionExpires = expires.UTC().Format(time.RFC3339)
+			if refreshExpires, err := session.RefreshExpiresAt(); err == nil && session.Refresh.Token != "" {
+				identity.RefreshExpires = refreshExpires.UTC().Format(time.RFC3339)
+			}
+			if session.UserName != "" {
+				identity.Username = session.UserName
+			}
+			if session.IDMSID != 0 {
+				identity.IDMS = fmt.Sprint(session.IDMSID)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// sessionRefresh refreshes the cached Kion session with its refresh token.
+// With --keepalive it keeps refreshing shortly before each access token
+// expires, until the refresh token runs out or it is interrupted, so a long
+// workday never needs another browser sign in.
+func sessionRefresh(cCtx *cli.Context) error {
+	session, found, err := c.GetSession()
+	if err != nil {
+		return err
+	}
+	if !found || !session.Refreshable(time.Now()) {
+		return errors.New("no refreshable Kion session is cached, sign in with a password or SAML first")
+	}
+
+	ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		refreshed, err := refreshSession(session)
+
+		// keep the session alive through maintenance while the refresh token
+		// lasts past it
+		if wait, ok := kion.MaintenanceWait(err, time.Now(), time.Minute); ok && cCtx.Bool("keepalive") {
+			refreshExpires, expiresErr := session.RefreshExpiresAt()
+			if expiresErr != nil || time.Now().Add(wait).After(refreshExpires) {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, color.YellowString("%v, trying again in %v", err, wait.Round(time.Second)))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		session = refreshed
+		expires, err := session.ExpiresAt()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Refreshed the Kion session, valid until %v\n", expires.Local().Format(time.RFC3339))
+		if !cCtx.Bool("keepalive") {
+			return nil
+		}
+
+		// stop once the refresh token can't carry the session any further
+		refreshExpires, err := session.RefreshExpiresAt()
+		if err != nil {
+			return err
+		}
+		wait, ok := helper.NextSessionRefresh(expires, refreshExpires, time.Now())
+		if !ok {
+			return fmt.Errorf("the Kion refresh token expires at %v, sign in again to keep the session alive", refreshExpires.Local().Format(time.RFC3339))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// scrubHistory reports shell history entries that passed secrets to Kion CLI
+// so users can remove them and rotate the secrets. History files are never
+// modified.
+func scrubHistory(cCtx *cli.Context) error {
+	files := cCtx.Args().Slice()
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		files = helper.HistoryFiles(home)
+	}
+
+	scanned := 0
+	var findings []helper.HistoryFinding
+	for _, file := range files {
+		found, err := helper.ScanHistory(file, cCtx.App.Flags)
+		if errors.Is(err, os.ErrNotExist) && cCtx.Args().Len() == 0 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanned++
+		findings = append(findings, found...)
+	}
+
+	if len(findings) == 0 {
+		color.Green("No risky entries found in %v history file(s)", scanned)
+		return nil
+	}
+
+	for _, finding := range findings {
+		fmt.Fprintf(stdout, "%v:%v: %v exposed in: %v\n", finding.File, finding.Line, finding.Secret, finding.Command)
+	}
+	color.Yellow("\nFound %v risky entries. Kion CLI does not edit history files, remove these entries with an editor and rotate the exposed secrets.", len(findings))
+
+	return nil
+}
+
+// accessReport prints every cloud access role the user can reach along with
+// when each was last used according to the local audit log, for access review
+// attestations.
+func accessReport(cCtx *cli.Context) error {
+	format := cCtx.String("output")
+	if format != "md" && format != "html" {
+		return fmt.Errorf("unsupported report format: %v", format)
+	}
+	useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return err
+	}
+	if !useUpdated {
+		return errors.New("access reports require a version of Kion that includes account details with cloud access roles")
+	}
+
+	// handle auth
+	err = setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// gather everything the user can access
+	var cars []kion.CAR
+	err = withReauth(cCtx, func() error {
+		return helper.WithProgress(cCtx.Context, "Fetching cloud access roles", func(p *helper.Progress) error {
+			var err error
+			cars, err = kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	entries, err := helper.ReadAudit(auditPath)
+	if err != nil {
+		return err
+	}
+
+	user := config.Kion.Username
+	if user == "" {
+		user = "unknown"
+	}
+	report := helper.AccessReport{
+		Generated: time.Now(),
+		Kion:      config.Kion.Url,
+		User:      user,
+		Rows:      helper.BuildAccessReport(cars, helper.LastUsed(entries, config.Kion.Url)),
+	}
+	return helper.WriteAccessReport(stdout, report, format)
+}
+
+// bench measures cold and warm latency of session validation, STAK issuance,
+// and console URL generation against the configured Kion so platform teams
+// can quantify server side regressions. Results are never cached.
+func bench(cCtx *cli.Context) error {
+	if dryRun {
+		return errors.New("bench makes real requests and can't be used with --dry-run")
+	}
+	iterations := cCtx.Int("iterations")
+	if iterations < 1 {
+		return fmt.Errorf("iterations must be at least 1, got %v", iterations)
+	}
+
+	// handle auth
+	err := setAuthToken(cCtx)
+	if err != nil {
+		return err
+	}
+
+	// resolve the cloud access role to benchmark with
+	var car kion.CAR
+	account := cCtx.String("account")
+	carName := cCtx.String("car")
+	if account != "" && carName != "" {
+		car, err = kion.GetCARByNameAndAccount(config.Kion.Url, config.Kion.ApiKey, carName, account)
+	} else {
+		err = helper.CARSelector(cCtx, &car, config.Defaults)
+	}
+	if err != nil {
+		return err
+	}
+
+	// validate the session with an endpoint all users can reach
+	useUpdated, err := helper.UseUpdatedCARAPI(cCtx)
+	if err != nil {
+		return err
+	}
+	validateSession := func() error {
+		if useUpdated {
+			_, err := kion.GetCARS(config.Kion.Url, config.Kion.ApiKey)
+			return err
+		}
+		_, err := kion.GetProjects(config.Kion.Url, config.Kion.ApiKey)
+		return err
+	}
+
+	// keys issued while timing are reported to the webhook afterwards, so
+	// posting them isn't measured
+	var issued []kion.STAK
+	operations := []struct {
+		name string
+		op   func() error
+	}{
+		{"session validation", validateSession},
+		{"stak issuance", func() error {
+			stak, err := kion.GetSTAK(config.Kion.Url, config.Kion.ApiKey, car.Name, car.AccountNumber)
+			if err == nil {
+				issued = append(issued, stak)
+			}
+			return explainAccessError(err, car.Name, car.AccountNumber, "cli")
+		}},
+		{"console url", func() error {
+			_, err := kion.GetFederationURL(config.Kion.Url, config.Kion.ApiKey, car)
+			return explainAccessError(err, car.Name, car.AccountNumber, "web")
+		}},
+	}
+
+	fmt.Fprintf(os.Stderr, "Benchmarking %v with %v on %v, %v iterations...\n", config.Kion.Url, car.Name, car.AccountNumber, iterations)
+	var results []helper.BenchResult
+	for _, operation := range operations {
+		var cold, warm []time.Duration
+		err := helper.WithProgress(cCtx.Context, "Benchmarking "+operation.name, func(p *helper.Progress) error {
+			p.SetTotal(iterations * 2)
+			var err error
+			cold, warm, err = helper.Bench(iterations, kion.CloseIdleConnections, func() error {
+				defer p.Increment()
+				return operation.op()
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %w", operation.name, err)
+		}
+		results = append(results, helper.BenchResult{Name: operation.name, Cold: cold, Warm: warm})
+	}
+	for _, stak := range issued {
+		notifySTAK(car.Name, car.AccountNumber, stak, false)
+	}
+
+	return helper.PrintBench(stdout, results)
+}
+
+// afterCommands run after any subcommands are executed.
+func afterCommands(cCtx *cli.Context) error {
+	saveQuota()
+	noticeUpdate(cCtx)
+	if cassette != nil {
+		err := cassette.Save()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to save the cassette: %v\n", err)
+		}
+	}
+	if kion.Timings != nil {
+		fmt.Fprintln(os.Stderr)
+		err := helper.PrintTimings(os.Stderr, kion.Timings.Breakdown(time.Now()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to print the timing breakdown: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// saveQuota keeps the request quota Kion last reported this run for the
+// status command. Failing to is only worth a warning.
+func saveQuota() {
+	quota, found := kion.LastQuota()
+	if !found || quotaPath == "" {
+		return
+	}
+	quotas, err := helper.ReadQuotas(quotaPath)
+	if err == nil {
+		quotas[config.Kion.Url] = quota
+		err = helper.WriteQuotas(quotaPath, quotas)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to save the request quota: %v\n", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//                                                                            //
+//  Main                                                                      //
+//                                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// main defines the command line utilities API. This should probably be broken
+// out into its own function some day.
+func main() {
+	// get home directory
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// move files from their legacy locations in the home directory to where
+	// the platform expects them, the config file stays put if overridden
+	legacy := helper.LegacyPaths(home)
+	userConfigFile := os.Getenv("KION_CONFIG")
+	if userConfigFile != "" {
+		legacy.Config = ""
+	}
+	defaults := helper.DefaultPaths(runtime.GOOS, home, os.Getenv)
+	moves, err := helper.MigrateLegacyPaths(legacy, defaults)
+	for _, move := range moves {
+		fmt.Fprintf(os.Stderr, "Moved %v to %v\n", move.From, move.To)
+	}
+	if err != nil && !filesystem.IsReadOnly(err) {
+		fmt.Fprintf(os.Stderr, "Warning: %v, using the old location\n", err)
+	}
+	paths = helper.ActivePaths(legacy, defaults)
+
+	// allow config file to be overridden by an env var, else use default
+	if userConfigFile != "" {
+		paths.Config = filepath.Clean(helper.ExpandPath(runtime.GOOS, userConfigFile, home, os.Getenv))
+	}
+	configPath = paths.Config
+
+	// record requests to kion, or replay recorded ones, for testing offline
+	if path := os.Getenv("KION_CASSETTE"); path != "" {
+		mode := os.Getenv("KION_CASSETTE_MODE")
+		if mode == "" {
+			mode = kion.CassetteReplay
+		}
+		cassette, err = kion.LoadCassette(path, mode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kion.UseCassette(cassette)
+	}
+
+	// make the built in authentication methods available
+	err = registerAuthenticators()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// load configuration file, an error in it is reported once the command is
+	// known as kion config validate explains it instead
+	err = helper.LoadConfig(configPath, &config)
+	configErr := err
+	if errors.Is(configErr, os.ErrNotExist) {
+		configErr = nil
+	}
+
+	// bring outdated configuration up to date
+	if err == nil {
+		err = offerConfigMigration()
+		if err != nil {
+			color.Red(" Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// lock the settings managed by the organization
+	managedConfig, err = helper.ReadManagedConfig(helper.ManagedConfigPath(runtime.GOOS, os.Getenv))
+	if err == nil {
+		err = managedConfig.Apply(&config)
+	}
+	if err != nil {
+		color.Red(" Error: %v", err)
+		os.Exit(1)
+	}
+
+	// prep default text for password
+	passwordDefaultText := ""
+	if config.Kion.Password != "" {
+		passwordDefaultText = "*****"
+	}
+
+	// prep default text for api key
+	apiKeyDefaultText := ""
+	if config.Kion.ApiKey != "" {
+		apiKeyDefaultText = "*****"
+	}
+
+	// convert relative path specified in config file to absolute path
+	samlMetadataFile := config.Kion.SamlMetadataFile
+	if samlMetadataFile != "" && !strings.HasPrefix(samlMetadataFile, "http") {
+		if !filepath.IsAbs(samlMetadataFile) {
+			// resolve the file path relative to the config path, which is the home directory
+			samlMetadataFile = filepath.Join(filepath.Dir(configPath), samlMetadataFile)
+		}
+	}
+
+	// define app configuration
+	app := &cli.App{
+
+		////////////////
+		//  Metadata  //
+		////////////////
+
+		Name:                 "Kion CLI",
+		Version:              kionCliVersion,
+		Usage:                "Kion federation on the command line!",
+		EnableBashCompletion: true,
+		// keep commas in --set values such as lists
+		DisableSliceFlagSeparator: true,
+		Before:                    beforeCommands,
+		After:                     afterCommands,
+		Metadata:                  map[string]interface{}{},
+
+		////////////////////
+		//  Global Flags  //
 		////////////////////
 
 		Flags: []cli.Flag{
@@ -907,83 +8106,981 @@ func main() {
 				Usage:       "Kion `URL`",
 				Destination: &config.Kion.Url,
 			},
-			&cli.StringFlag{
-				Name:        "user",
-				Aliases:     []string{"username", "u"},
-				Value:       config.Kion.Username,
-				EnvVars:     []string{"KION_USERNAME", "CTKEY_USERNAME"},
-				Usage:       "`USERNAME` for authentication",
-				Destination: &config.Kion.Username,
+			&cli.StringFlag{
+				Name:        "user",
+				Aliases:     []string{"username", "u"},
+				Value:       config.Kion.Username,
+				EnvVars:     []string{"KION_USERNAME", "CTKEY_USERNAME"},
+				Usage:       "`USERNAME` for authentication",
+				Destination: &config.Kion.Username,
+			},
+			&cli.StringFlag{
+				Name:        "password",
+				Aliases:     []string{"p"},
+				Value:       config.Kion.Password,
+				EnvVars:     []string{"KION_PASSWORD", "CTKEY_PASSWORD"},
+				Usage:       "`PASSWORD` for authentication",
+				Destination: &config.Kion.Password,
+				DefaultText: passwordDefaultText,
+			},
+			&cli.BoolFlag{
+				Name:  "password-stdin",
+				Usage: "read the password for authentication from stdin",
+			},
+			&cli.IntFlag{
+				Name:  "password-fd",
+				Usage: "read the password for authentication from file descriptor `FD`",
+			},
+			&cli.StringFlag{
+				Name:        "idms",
+				Aliases:     []string{"i"},
+				Value:       config.Kion.IDMS,
+				EnvVars:     []string{"KION_IDMS_ID"},
+				Usage:       "`IDMSID` for authentication",
+				Destination: &config.Kion.IDMS,
+			},
+			&cli.StringFlag{
+				Name:        "saml-metadata-file",
+				Value:       samlMetadataFile,
+				EnvVars:     []string{"KION_SAML_METADATA_FILE"},
+				Usage:       "SAML metadata `FILE` or URL",
+				Destination: &config.Kion.SamlMetadataFile,
+			},
+			&cli.StringFlag{
+				Name:        "saml-sp-issuer",
+				Value:       config.Kion.SamlIssuer,
+				EnvVars:     []string{"KION_SAML_SP_ISSUER"},
+				Usage:       "SAML Service Provider `ISSUER`",
+				Destination: &config.Kion.SamlIssuer,
+			},
+			&cli.StringFlag{
+				Name:        "saml-callback-port",
+				Value:       config.Kion.SamlCallbackPort,
+				EnvVars:     []string{"KION_SAML_CALLBACK_PORT"},
+				Usage:       "`PORT` or range of ports such as 8400-8410 to listen on for the SAML callback, the first free port is used",
+				Destination: &config.Kion.SamlCallbackPort,
+			},
+			&cli.StringFlag{
+				Name:        "token",
+				Aliases:     []string{"t"},
+				Value:       config.Kion.ApiKey,
+				EnvVars:     []string{"KION_API_KEY", "CTKEY_APPAPIKEY"},
+				Usage:       "`TOKEN` for authentication",
+				Destination: &config.Kion.ApiKey,
+				DefaultText: apiKeyDefaultText,
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				EnvVars: []string{"KION_PROFILE"},
+				Usage:   "configuration `PROFILE` to use",
+			},
+			&cli.StringSliceFlag{
+				Name:  "set",
+				Usage: "override a configuration setting for this run as `KEY=VALUE`, such as kion.browser=firefox, may be repeated",
+			},
+			&cli.BoolFlag{
+				Name:        "disable-cache",
+				Value:       config.Kion.DisableCache,
+				Usage:       "disable the use of caching",
+				Destination: &config.Kion.DisableCache,
+			},
+			&cli.StringFlag{
+				Name:        "keyring-backend",
+				Value:       config.Kion.Keyring.Backend,
+				EnvVars:     []string{"KION_KEYRING_BACKEND"},
+				Usage:       "keyring `BACKEND` the cache is kept in, one of keychain, secret-service, kwallet, wincred, keyctl, pass, or file, the first available if unset",
+				Destination: &config.Kion.Keyring.Backend,
+			},
+			&cli.StringFlag{
+				Name:        "browser",
+				Value:       config.Kion.Browser,
+				EnvVars:     []string{"KION_BROWSER"},
+				Usage:       "`BROWSER` to sign in with SAML and open web consoles in, one of " + strings.Join(helper.BrowserNames(), ", "),
+				Destination: &config.Kion.Browser,
+			},
+			&cli.BoolFlag{
+				Name:        "no-browser",
+				Value:       config.Kion.NoBrowser,
+				EnvVars:     []string{"KION_NO_BROWSER"},
+				Usage:       "print the SAML sign in URL rather than opening a browser",
+				Destination: &config.Kion.NoBrowser,
+			},
+			&cli.StringFlag{
+				Name:        "ca-bundle",
+				Value:       config.API.CABundle,
+				EnvVars:     []string{"KION_CA_BUNDLE"},
+				Usage:       "PEM `FILE` of CA certificates to trust along with the system roots, for appliances signed by an internal CA",
+				Destination: &config.API.CABundle,
+			},
+			&cli.StringFlag{
+				Name:        "client-cert",
+				Value:       config.API.ClientCert,
+				EnvVars:     []string{"KION_CLIENT_CERT"},
+				Usage:       "PEM client certificate `FILE` for mutual TLS, with --client-key",
+				Destination: &config.API.ClientCert,
+			},
+			&cli.StringFlag{
+				Name:        "client-key",
+				Value:       config.API.ClientKey,
+				EnvVars:     []string{"KION_CLIENT_KEY"},
+				Usage:       "PEM private key `FILE` for --client-cert",
+				Destination: &config.API.ClientKey,
+			},
+			&cli.BoolFlag{
+				Name:        "insecure",
+				Value:       config.API.Insecure,
+				EnvVars:     []string{"KION_INSECURE"},
+				Usage:       "skip TLS certificate verification, for testing only as credentials can be intercepted",
+				Destination: &config.API.Insecure,
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				EnvVars: []string{"KION_VERBOSE"},
+				Usage:   "trace requests, SAML sign in steps, and cache lookups to stderr with secrets redacted",
+			},
+			&cli.BoolFlag{
+				Name:    "debug",
+				EnvVars: []string{"KION_DEBUG"},
+				Usage:   "trace as --verbose does along with the headers and bodies of requests and responses",
+			},
+			&cli.BoolFlag{
+				Name:    "profile-perf",
+				EnvVars: []string{"KION_PROFILE_PERF"},
+				Usage:   "print how long the run spent on SAML metadata, the identity provider, the Kion API, the cache, and the CLI itself to stderr",
+			},
+			&cli.BoolFlag{
+				Name:        "debug-saml",
+				Usage:       "print a summary of the SAML response when signing in with SAML",
+				Destination: &debugSAML,
+			},
+			&cli.BoolFlag{
+				Name:        "refresh-metadata",
+				Usage:       "download SAML metadata rather than using a cached copy",
+				Destination: &refreshMetadata,
+			},
+			&cli.BoolFlag{
+				Name:        "refresh-inventory",
+				Usage:       "fetch the projects, accounts, and roles behind the pickers rather than reusing a freshly cached copy",
+				Destination: &refreshInventory,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Value:       "text",
+				EnvVars:     []string{"KION_OUTPUT"},
+				Usage:       "write results in `FORMAT`, one of " + strings.Join(helper.OutputFormats, ", ") + ", for commands that support it",
+				Destination: &outputFormat,
+			},
+			&cli.BoolFlag{
+				Name:        "force",
+				Usage:       "select accounts pinned with kion pin anyway, noting the override in the audit log",
+				Destination: &helper.ForcePinned,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				EnvVars:     []string{"KION_DRY_RUN"},
+				Usage:       "print api calls and file or environment changes without making them",
+				Destination: &dryRun,
+			},
+			&cli.BoolFlag{
+				Name:        "ascii",
+				EnvVars:     []string{"KION_ASCII"},
+				Usage:       "draw prompts, progress, and text output in plain ASCII for terminals that corrupt UTF-8, such as behind some jump hosts",
+				Destination: &helper.ASCIIOutput,
+			},
+			&cli.BoolFlag{
+				Name:        "accessible",
+				EnvVars:     []string{"KION_ACCESSIBLE"},
+				Usage:       "use numbered plain text menus and a line per progress step, without redrawing or moving the cursor, for screen readers",
+				Destination: &helper.AccessibleOutput,
+			},
+			&cli.BoolFlag{
+				Name:        "no-interactive",
+				EnvVars:     []string{"KION_NO_INTERACTIVE"},
+				Usage:       "never prompt or open a browser, failing instead when the cached session has expired and no unattended kion.reauth strategy applies, for CI",
+				Destination: &helper.NoInteractive,
+			},
+		},
+
+		////////////////
+		//  Commands  //
+		////////////////
+
+		Commands: []*cli.Command{
+			{
+				Name:         "stak",
+				Aliases:      []string{"setenv", "savecreds", "s"},
+				Usage:        "Generate short-term access keys",
+				ArgsUsage:    "[FAVORITE]",
+				Action:       genStaks,
+				BashComplete: completeFavorites,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "print",
+						Aliases: []string{"p"},
+						Usage:   "print stak only",
+					},
+					&cli.StringFlag{
+						Name:    "account",
+						Aliases: []string{"acc", "a"},
+						Usage:   "target account number, must be passed with car",
+					},
+					&cli.StringFlag{
+						Name:    "car",
+						Aliases: []string{"cloud-access-role", "c"},
+						Usage:   "target cloud access role, must be passed with account",
+					},
+					&cli.StringFlag{
+						Name:    "region",
+						Aliases: []string{"r"},
+						Usage:   "target region",
+					},
+					&cli.StringFlag{
+						Name:  "cloud",
+						Usage: "only offer accounts in this cloud, short term access keys require aws",
+					},
+					&cli.BoolFlag{
+						Name:    "save",
+						Aliases: []string{"s"},
+						Usage:   "save short-term keys as aws credentials profile",
+					},
+					&cli.StringFlag{
+						Name:  "save-profile",
+						Usage: "save short-term keys to the aws credentials profile `NAME`, marked with when they expire",
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+					},
+					&cli.BoolFlag{
+						Name:  "credential-process",
+						Usage: "print stak json as AWS credential process",
+					},
+					&cli.StringSliceFlag{
+						Name:  "encrypt-to",
+						Usage: "print the keys encrypted to an age `RECIPIENT` (age1...) or PGP key ID, fingerprint, or email, to hand them to another person, repeat for several",
+					},
+					&cli.StringSliceFlag{
+						Name:  "export",
+						Usage: "write the keys to a secret store rather than printing them, `DESTINATION` being vault:PATH, 1password:VAULT/ITEM, or ssm:NAME, repeat for several",
+					},
+					&cli.BoolFlag{
+						Name:  "choose-car",
+						Usage: "prompt for a cloud access role even if a default is configured",
+					},
+					&cli.BoolFlag{
+						Name:  "explain",
+						Usage: "print the resolved request and confirm before proceeding",
+					},
+					&cli.BoolFlag{
+						Name:    "yes",
+						Aliases: []string{"y"},
+						Usage:   "skip the confirmation when using --explain",
+					},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "save",
+						Usage:     "Save short-term access keys to a named AWS credentials profile",
+						ArgsUsage: "PROFILE [FAVORITE]",
+						Action:    stakSave,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "account",
+								Aliases: []string{"acc", "a"},
+								Usage:   "target account number, must be passed with car",
+							},
+							&cli.StringFlag{
+								Name:    "car",
+								Aliases: []string{"cloud-access-role", "c"},
+								Usage:   "target cloud access role, must be passed with account",
+							},
+							&cli.StringFlag{
+								Name:  "session-policy",
+								Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+							},
+							&cli.StringFlag{
+								Name:  "cloud",
+								Usage: "only offer accounts in this cloud, short term access keys require aws",
+							},
+							&cli.BoolFlag{
+								Name:  "choose-car",
+								Usage: "prompt for a cloud access role even if a default is configured",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "credential-process",
+				Usage:     "Print short-term access keys as AWS credential process json for a favorite or an account and cloud access role",
+				ArgsUsage: "[FAVORITE_NAME]",
+				Action:    credentialProcess,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "account",
+						Aliases: []string{"acc", "a"},
+						Usage:   "target account number, must be passed with car",
+					},
+					&cli.StringFlag{
+						Name:    "car",
+						Aliases: []string{"cloud-access-role", "c"},
+						Usage:   "target cloud access role, must be passed with account",
+					},
+					&cli.BoolFlag{
+						Name:   "credential-process",
+						Value:  true,
+						Hidden: true,
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+					},
+					&cli.StringFlag{
+						Name:   "cloud",
+						Hidden: true,
+					},
+				},
+			},
+			{
+				Name:      "decrypt",
+				Usage:     "Decrypt credentials handed off with kion stak --encrypt-to",
+				ArgsUsage: "[FILE]",
+				Action:    decryptHandoff,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "identity",
+						Aliases: []string{"i"},
+						EnvVars: []string{"KION_AGE_IDENTITY"},
+						Usage:   "age identity `FILE` to decrypt with, PGP messages are decrypted with the keys gpg holds",
+					},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "keygen",
+						Usage:     "Write a new age identity to receive handed off credentials with and print its recipient",
+						ArgsUsage: "FILE",
+						Action:    decryptKeygen,
+					},
+				},
+			},
+			{
+				Name:      "console",
+				Aliases:   []string{"con", "c"},
+				Usage:     "Federate into the web console",
+				ArgsUsage: "[ACCOUNT/CAR]",
+				Action:    fedConsole,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "url-only",
+						Usage: "print the console sign in link rather than opening it",
+					},
+					&cli.StringFlag{
+						Name:  "service",
+						Usage: "open the console of an AWS `SERVICE`, such as ec2 or s3",
+					},
+					&cli.BoolFlag{
+						Name:  "stak",
+						Usage: "sign in to the AWS console with short term access keys rather than Kion's console access, used for roles offering only cli access",
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "sign in with short term access keys downscoped with the IAM policy document in `FILE`, implies --stak",
+					},
+					&cli.StringFlag{
+						Name:  "cloud",
+						Usage: "only offer accounts in this cloud, aws, azure, or gcp",
+					},
+					&cli.StringFlag{
+						Name:  "browser-profile",
+						Usage: "browser profile to open the console in, requires kion.browser",
+					},
+					&cli.BoolFlag{
+						Name:  "capture",
+						Usage: "fetch the console federation link without a browser and save a sanitized copy of the resulting page to a support bundle",
+					},
+					&cli.BoolFlag{
+						Name:  "choose-car",
+						Usage: "prompt for a cloud access role even if a default is configured",
+					},
+					&cli.BoolFlag{
+						Name:  "explain",
+						Usage: "print the resolved request and confirm before proceeding",
+					},
+					&cli.BoolFlag{
+						Name:    "yes",
+						Aliases: []string{"y"},
+						Usage:   "skip confirmations from --explain and before signing out a browser profile",
+					},
+				},
+			},
+			{
+				Name:      "favorite",
+				Aliases:   []string{"fav", "f"},
+				Usage:     "Access favorites via web console or a stak for CLI usage",
+				ArgsUsage: "[FAVORITE_NAME]",
+				Action:    favorites,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "print",
+						Aliases: []string{"p"},
+						Usage:   "print stak only",
+					},
+					&cli.BoolFlag{
+						Name:  "credential-process",
+						Usage: "print stak json as AWS credential process",
+					},
+					&cli.StringFlag{
+						Name:  "browser-profile",
+						Usage: "browser profile to open web favorites in, requires kion.browser",
+					},
+					&cli.BoolFlag{
+						Name:  "capture",
+						Usage: "fetch the console federation link of web favorites without a browser and save a sanitized copy of the resulting page to a support bundle",
+					},
+					&cli.StringFlag{
+						Name:  "access-level",
+						Usage: "access the favorite with cli keys or the web console, overriding its access_type",
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`, overriding its session_policy",
+					},
+					&cli.StringFlag{
+						Name:  "cloud",
+						Usage: "only offer favorites in this cloud, aws, azure, or gcp",
+					},
+					&cli.StringFlag{
+						Name:  "region",
+						Usage: "AWS `REGION` of the keys, overriding the favorite's region rather than prompting for it",
+					},
+					&cli.StringFlag{
+						Name:  "duration",
+						Usage: "how long the keys must stay valid, such as 2h, rather than prompting for it",
+					},
+					&cli.StringFlag{
+						Name:  "service",
+						Usage: "open the console of an AWS `SERVICE` for web favorites, rather than prompting for it",
+					},
+				},
+				BashComplete: completeFavorites,
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "list favorites",
+						Action: listFavorites,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "verbose",
+								Aliases: []string{"v"},
+								Usage:   "show full favorite details",
+							},
+						},
+					},
+					{
+						Name:      "add",
+						Usage:     "add a favorite, choosing its account and role with the pickers unless given",
+						ArgsUsage: "NAME",
+						Action:    addFavorite,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "account",
+								Aliases: []string{"acc", "a"},
+								Usage:   "account number or glob",
+							},
+							&cli.StringFlag{
+								Name:  "account-alias",
+								Usage: "account name or glob",
+							},
+							&cli.StringFlag{
+								Name:    "car",
+								Aliases: []string{"c"},
+								Usage:   "cloud access role name, prompted for once on first use if omitted",
+							},
+							&cli.StringFlag{
+								Name:  "access-type",
+								Usage: "cli or web, defaults to cli",
+							},
+							&cli.StringFlag{
+								Name:    "region",
+								Aliases: []string{"r"},
+								Usage:   "default region",
+							},
+							&cli.StringFlag{
+								Name:  "browser-profile",
+								Usage: "browser profile to open the web console in",
+							},
+							&cli.StringFlag{
+								Name:  "session-policy",
+								Usage: "downscope the favorite's short term access keys with the IAM policy document in `FILE`",
+							},
+						},
+					},
+					{
+						Name:      "rm",
+						Aliases:   []string{"remove"},
+						Usage:     "remove favorites",
+						ArgsUsage: "NAME...",
+						Action:    removeFavorites,
+						BashComplete: func(cCtx *cli.Context) {
+							fNames, _ := helper.MapFavs(config.Favorites)
+							for _, f := range fNames {
+								fmt.Println(f)
+							}
+						},
+					},
+					{
+						Name:   "check",
+						Usage:  "verify favorites map to accounts and roles you can access",
+						Action: checkFavorites,
+					},
+					{
+						Name:   "recommended",
+						Usage:  "Add favorites your administrators recommend through Kion account labels",
+						Action: importRecommended,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "yes",
+								Aliases: []string{"y"},
+								Usage:   "add every recommended favorite without prompting",
+							},
+						},
+					},
+					{
+						Name:   "generate",
+						Usage:  "add a favorite for each account in a project with a cloud access role",
+						Action: generateFavorites,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "project",
+								Usage:    "`NAME` of the project whose accounts to add",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "car",
+								Aliases:  []string{"cloud-access-role", "c"},
+								Usage:    "cloud access role `NAME` to use on each account",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "access-type",
+								Value: "cli",
+								Usage: "access type for the favorites, cli or web",
+							},
+							&cli.StringFlag{
+								Name:    "region",
+								Aliases: []string{"r"},
+								Usage:   "region for the favorites",
+							},
+							&cli.StringFlag{
+								Name:  "prefix",
+								Usage: "`PREFIX` added to each favorite name",
+							},
+							&cli.BoolFlag{
+								Name:    "yes",
+								Aliases: []string{"y"},
+								Usage:   "add the favorites without confirming",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:         "elevate",
+				Usage:        "Take time-boxed elevated access with a favorite, noting the reason in the audit log",
+				ArgsUsage:    "[FAVORITE]",
+				Action:       elevate,
+				BashComplete: completeFavorites,
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:     "for",
+						Usage:    "how long elevated access lasts, such as 30m",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "reason",
+						Usage:    "why elevated access is needed, such as an incident number",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:    "print",
+						Aliases: []string{"p"},
+						Usage:   "print the keys rather than starting a sub-shell that closes at the deadline",
+					},
+				},
 			},
-			&cli.StringFlag{
-				Name:        "password",
-				Aliases:     []string{"p"},
-				Value:       config.Kion.Password,
-				EnvVars:     []string{"KION_PASSWORD", "CTKEY_PASSWORD"},
-				Usage:       "`PASSWORD` for authentication",
-				Destination: &config.Kion.Password,
-				DefaultText: passwordDefaultText,
+			{
+				Name:      "run",
+				Usage:     "Run a command with short-term access keys",
+				ArgsUsage: "[FAVORITE|ACCOUNT/CAR] [--] COMMAND [ARGS...]",
+				Action:    runCommand,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "favorite",
+						Aliases: []string{"fav", "f"},
+						Usage:   "favorite name",
+					},
+					&cli.StringFlag{
+						Name:    "account",
+						Aliases: []string{"acc", "a"},
+						Usage:   "account number",
+					},
+					&cli.StringFlag{
+						Name:    "car",
+						Aliases: []string{"c"},
+						Usage:   "CAR name",
+					},
+					&cli.StringFlag{
+						Name:    "region",
+						Aliases: []string{"r"},
+						Usage:   "target region",
+					},
+					&cli.BoolFlag{
+						Name:  "creds-fd",
+						Usage: "pass credentials on an inherited file descriptor instead of environment variables",
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+					},
+				},
 			},
-			&cli.StringFlag{
-				Name:        "idms",
-				Aliases:     []string{"i"},
-				Value:       config.Kion.IDMS,
-				EnvVars:     []string{"KION_IDMS_ID"},
-				Usage:       "`IDMSID` for authentication",
-				Destination: &config.Kion.IDMS,
+			{
+				Name:   "palette",
+				Usage:  "Search favorites, recently used and available roles, and commands, and run the one chosen",
+				Action: palette,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "print",
+						Usage: "print the chosen command line rather than running it",
+					},
+				},
 			},
-			&cli.StringFlag{
-				Name:        "saml-metadata-file",
-				Value:       samlMetadataFile,
-				EnvVars:     []string{"KION_SAML_METADATA_FILE"},
-				Usage:       "SAML metadata `FILE` or URL",
-				Destination: &config.Kion.SamlMetadataFile,
+			{
+				Name:   "update",
+				Usage:  "Replace Kion CLI with the latest release once its signature and checksum are verified",
+				Action: update,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "only report whether a newer release is available",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "install the latest release even if it isn't newer, or this build has no version",
+					},
+					&cli.StringFlag{
+						Name:    "public-key",
+						Aliases: []string{"key"},
+						Usage:   "cosign or minisign public `KEY` or path to one, defaults to the embedded release key",
+					},
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Verify the signature and checksum of a Kion CLI binary",
+				ArgsUsage: "[PATH]",
+				Action:    verifyRelease,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "checksums",
+						Aliases: []string{"sums"},
+						Value:   "SHA256SUMS",
+						Usage:   "path to the release SHA256SUMS `FILE`",
+					},
+					&cli.StringFlag{
+						Name:    "signature",
+						Aliases: []string{"sig"},
+						Usage:   "path to the checksums signature `FILE` (default: checksums file + .sig)",
+					},
+					&cli.StringFlag{
+						Name:    "public-key",
+						Aliases: []string{"key"},
+						Usage:   "cosign or minisign public `KEY` or path to one, defaults to the embedded release key",
+					},
+					&cli.StringFlag{
+						Name:  "asset",
+						Usage: "release asset `NAME` to look up in the checksums file (default: binary file name)",
+					},
+				},
+			},
+			{
+				Name:   "about",
+				Usage:  "Print version and build provenance",
+				Action: about,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "sbom",
+						Usage: "include the embedded dependency manifest",
+					},
+				},
+			},
+			{
+				Name:   "support-bundle",
+				Usage:  "Gather sanitized diagnostics into a tarball to attach to an issue",
+				Action: supportBundle,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "file",
+						Usage: "write the bundle to `PATH` rather than the state directory",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-checks",
+						Usage: "leave out the checks of how Kion is reached, such as when offline",
+					},
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Configuration file commands",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "init",
+						Usage:  "Write a configuration file by answering a few questions",
+						Action: configInit,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "replace an existing configuration file",
+							},
+						},
+					},
+					{
+						Name:      "get",
+						Usage:     "Print a setting from the configuration file",
+						ArgsUsage: "KEY",
+						Action:    configGet,
+					},
+					{
+						Name:      "set",
+						Usage:     "Change a setting in the configuration file, prompting for secrets",
+						ArgsUsage: "KEY [VALUE]",
+						Action:    configSet,
+					},
+					{
+						Name:   "validate",
+						Usage:  "Check the configuration file and explain what needs fixing",
+						Action: configValidate,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "offline",
+								Usage: "skip checking each Kion URL, its IDMS, and its SAML metadata",
+							},
+						},
+					},
+					{
+						Name:   "migrate",
+						Usage:  "Update outdated settings in the configuration file",
+						Action: configMigrate,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "yes",
+								Aliases: []string{"y"},
+								Usage:   "apply the changes without a terminal to confirm",
+							},
+						},
+					},
+					{
+						Name:   "schema",
+						Usage:  "Print a schema for the configuration file",
+						Action: configSchema,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Value: "jsonschema",
+								Usage: "schema `FORMAT`, only jsonschema is supported",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "scrub-history",
+				Usage:     "Report shell history entries that expose Kion secrets",
+				ArgsUsage: "[HISTORY_FILE...]",
+				Action:    scrubHistory,
+			},
+			{
+				Name:  "report",
+				Usage: "Generate reports",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "access",
+						Usage:  "Report the accounts and cloud access roles you can reach for access reviews",
+						Action: accessReport,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Value:   "md",
+								Usage:   "report `FORMAT`, either md or html",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:   "bench",
+				Usage:  "Measure latency of common Kion operations",
+				Action: bench,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "iterations",
+						Aliases: []string{"n"},
+						Value:   10,
+						Usage:   "number of cold and warm samples per operation",
+					},
+					&cli.StringFlag{
+						Name:    "account",
+						Aliases: []string{"acc", "a"},
+						Usage:   "target account number, must be passed with car",
+					},
+					&cli.StringFlag{
+						Name:    "car",
+						Aliases: []string{"cloud-access-role", "c"},
+						Usage:   "target cloud access role, must be passed with account",
+					},
+				},
+			},
+			{
+				Name:      "open",
+				Usage:     "Open a project, account, compliance, or budget page of the Kion web UI",
+				ArgsUsage: "project|account|compliance|budget [NAME]",
+				Action:    openPage,
+			},
+			{
+				Name:   "ssh-cert",
+				Usage:  "Add a short-lived SSH certificate from an account's signing service to the SSH agent",
+				Action: sshCert,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "account",
+						Aliases: []string{"acc", "a"},
+						Usage:   "account number",
+					},
+					&cli.StringFlag{
+						Name:    "car",
+						Aliases: []string{"c"},
+						Usage:   "CAR name",
+					},
+					&cli.StringSliceFlag{
+						Name:  "principal",
+						Usage: "principal to certify, may be repeated, defaults to ssh_cert.principals or the local username",
+					},
+				},
+			},
+			{
+				Name:  "saml",
+				Usage: "Set up and test SAML sign in",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "test",
+						Usage:  "sign in with SAML step by step, reporting where it fails, without keeping the session",
+						Action: testSAML,
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: 5 * time.Minute,
+								Usage: "how long to wait for the sign in to complete in the browser",
+							},
+							&cli.StringFlag{
+								Name:  "save-response",
+								Usage: "`FILE` to save the SAML response posted back to, for kion debug saml-replay",
+							},
+						},
+					},
+					{
+						Name:   "trust-cert",
+						Usage:  "print how to trust the localhost certificate the SAML callback is served with over HTTPS, generating it if needed",
+						Action: trustSAMLCallbackCert,
+					},
+					{
+						Name:   "gen-keypair",
+						Usage:  "generate a key and certificate to sign SAML requests with and print the service provider metadata",
+						Action: genSAMLKeyPair,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "key-file",
+								Usage: "`FILE` to write the private key to, defaults to saml-sp-key.pem in the state directory shown by kion paths",
+							},
+							&cli.StringFlag{
+								Name:  "cert-file",
+								Usage: "`FILE` to write the certificate to, defaults to saml-sp-cert.pem in the state directory shown by kion paths",
+							},
+							&cli.IntFlag{
+								Name:  "days",
+								Value: 3650,
+								Usage: "number of `DAYS` the certificate is valid for",
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "replace an existing key and certificate",
+							},
+						},
+					},
+				},
 			},
-			&cli.StringFlag{
-				Name:        "saml-sp-issuer",
-				Value:       config.Kion.SamlIssuer,
-				EnvVars:     []string{"KION_SAML_SP_ISSUER"},
-				Usage:       "SAML Service Provider `ISSUER`",
-				Destination: &config.Kion.SamlIssuer,
+			{
+				Name:  "debug",
+				Usage: "Troubleshoot signing in to Kion",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "saml",
+						Usage:  "summarize a saved SAML response with secrets redacted",
+						Action: debugSAMLResponse,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "dump-assertion",
+								Usage:    "`FILE` holding the SAML response as XML, base64, or the form post, - for stdin",
+								Required: true,
+							},
+						},
+					},
+					{
+						Name:      "saml-replay",
+						Usage:     "send a saved SAML response to Kion without the identity provider to see if Kion accepts it",
+						ArgsUsage: "FILE",
+						Action:    replaySAMLResponse,
+					},
+				},
 			},
-			&cli.StringFlag{
-				Name:        "token",
-				Aliases:     []string{"t"},
-				Value:       config.Kion.ApiKey,
-				EnvVars:     []string{"KION_API_KEY", "CTKEY_APPAPIKEY"},
-				Usage:       "`TOKEN` for authentication",
-				Destination: &config.Kion.ApiKey,
-				DefaultText: apiKeyDefaultText,
+			{
+				Name:   "doctor",
+				Usage:  "Diagnose configuration, keyring, network, identity provider, and clock problems",
+				Action: doctor,
 			},
-			&cli.StringFlag{
-				Name:    "profile",
-				EnvVars: []string{"KION_PROFILE"},
-				Usage:   "configuration `PROFILE` to use",
+			{
+				Name:      "try-url",
+				Usage:     "Check a Kion URL is reachable and compatible before switching to it",
+				ArgsUsage: "URL",
+				Action:    tryURL,
 			},
-			&cli.BoolFlag{
-				Name:        "disable-cache",
-				Value:       config.Kion.DisableCache,
-				Usage:       "disable the use of caching",
-				Destination: &config.Kion.DisableCache,
+			{
+				Name:  "serve",
+				Usage: "Serve local interfaces to Kion CLI",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "webui",
+						Usage:  "serve a page listing favorites on localhost (experimental)",
+						Action: serveWebUI,
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  "port",
+								Usage: "port to listen on, a free port is chosen by default",
+							},
+							&cli.BoolFlag{
+								Name:  "no-browser",
+								Usage: "print the address without opening a browser",
+							},
+						},
+					},
+				},
 			},
-		},
-
-		////////////////
-		//  Commands  //
-		////////////////
-
-		Commands: []*cli.Command{
 			{
-				Name:    "stak",
-				Aliases: []string{"setenv", "savecreds", "s"},
-				Usage:   "Generate short-term access keys",
-				Action:  genStaks,
+				Name:      "serve-metadata",
+				Usage:     "Serve short-term access keys as the EC2 instance metadata service and ECS container credentials endpoint",
+				ArgsUsage: "[FAVORITE_NAME]",
+				Action:    serveMetadata,
 				Flags: []cli.Flag{
-					&cli.BoolFlag{
-						Name:    "print",
-						Aliases: []string{"p"},
-						Usage:   "print stak only",
-					},
 					&cli.StringFlag{
 						Name:    "account",
 						Aliases: []string{"acc", "a"},
@@ -994,99 +9091,383 @@ func main() {
 						Aliases: []string{"cloud-access-role", "c"},
 						Usage:   "target cloud access role, must be passed with account",
 					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+					},
 					&cli.StringFlag{
 						Name:    "region",
 						Aliases: []string{"r"},
-						Usage:   "target region",
+						Usage:   "region to answer as the placement of the instance",
+					},
+					&cli.StringFlag{
+						Name:  "host",
+						Value: "127.0.0.1",
+						Usage: "address to listen on, a loopback or link-local address such as 169.254.169.254 once assigned to an interface",
+					},
+					&cli.IntFlag{
+						Name:  "port",
+						Usage: "port to listen on, a free port is chosen by default",
 					},
 					&cli.BoolFlag{
-						Name:    "save",
-						Aliases: []string{"s"},
-						Usage:   "save short-term keys as aws credentials profile",
+						Name:  "allow-imdsv1",
+						Usage: "answer instance metadata requests without an IMDSv2 session token, for tools predating it",
+					},
+				},
+			},
+			{
+				Name:  "aws-config",
+				Usage: "Manage AWS CLI profiles for favorites",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "sync",
+						Usage:  "write a credential process profile for each favorite to the AWS config file",
+						Action: awsConfigSync,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "prefix",
+								Usage: "prefix added to each profile name",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "api",
+				Usage:     "Send a request to any Kion API endpoint with the cached session and print the response",
+				ArgsUsage: "METHOD PATH",
+				Action:    callAPI,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "data",
+						Aliases: []string{"d"},
+						Usage:   "JSON `BODY` to send, or @FILE to read it from a file or @- from stdin",
 					},
 					&cli.BoolFlag{
-						Name:  "credential-process",
-						Usage: "print stak json as AWS credential process",
+						Name:  "raw",
+						Usage: "print the response as received rather than indented",
 					},
 				},
 			},
 			{
-				Name:    "console",
-				Aliases: []string{"con", "c"},
-				Usage:   "Federate into the web console",
-				Action:  fedConsole,
+				Name:   "sync",
+				Usage:  "Sync every project and cloud access role into the cache so pickers and completions open instantly",
+				Action: syncInventory,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 4,
+						Usage: "how many pages to fetch at once",
+					},
+					&cli.IntFlag{
+						Name:  "page-size",
+						Value: kion.DefaultSyncPageSize,
+						Usage: "how many projects or cloud access roles to ask for per page",
+					},
+					&cli.BoolFlag{
+						Name:  "full",
+						Usage: "fetch every page rather than only those changed since the last sync",
+					},
+					&cli.DurationFlag{
+						Name:  "every",
+						Usage: "keep running, syncing again after each `DURATION` until interrupted",
+					},
+				},
 			},
 			{
-				Name:      "favorite",
-				Aliases:   []string{"fav", "f"},
-				Usage:     "Access favorites via web console or a stak for CLI usage",
-				ArgsUsage: "[FAVORITE_NAME]",
-				Action:    favorites,
+				Name:      "warm",
+				Usage:     "Cache the inventory and mint short-term access keys for favorites ahead of a session",
+				ArgsUsage: "[FAVORITE_NAME...]",
+				Action:    warm,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "workspace",
+						Usage: "warm the favorites listed under this `NAME` in workspaces",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Value: 4,
+						Usage: "how many keys to mint at once",
+					},
+				},
+			},
+			{
+				Name:   "watch",
+				Usage:  "Watch the cached short-term access keys and Kion session count down, renewing them with a key press",
+				Action: watch,
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: time.Second,
+						Usage: "how often to redraw the leases",
+					},
+					&cli.DurationFlag{
+						Name:  "warn",
+						Value: 10 * time.Minute,
+						Usage: "flash leases expiring within this long",
+					},
+				},
+			},
+			{
+				Name:   "bulk",
+				Usage:  "Mint short-term access keys for a cloud access role in every account matching a project, OU, tag, or account alias",
+				Action: bulk,
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "car",
+						Aliases:  []string{"cloud-access-role", "c"},
+						Usage:    "cloud access role `NAME` to use in each account",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "project",
+						Usage: "match accounts in the project with this `NAME` or ID",
+					},
+					&cli.StringFlag{
+						Name:  "ou",
+						Usage: "match accounts in this AWS Organizations OU `PATH` and below, such as Root/Workloads, needs kion.org_metadata",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "match accounts with this AWS Organizations tag given as `KEY=VALUE`, repeatable, needs kion.org_metadata",
+					},
+					&cli.StringFlag{
+						Name:  "account-alias",
+						Usage: "match accounts whose name matches this `GLOB`",
+					},
+					&cli.StringFlag{
+						Name:  "session-policy",
+						Usage: "downscope the short term access keys with the IAM policy document in `FILE`",
+					},
 					&cli.BoolFlag{
-						Name:    "print",
-						Aliases: []string{"p"},
-						Usage:   "print stak only",
+						Name:  "save",
+						Usage: "write the keys to ~/.aws/credentials as profiles named ACCOUNT_ROLE",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Value: 8,
+						Usage: "how many keys to mint at once",
+					},
+				},
+			},
+			{
+				Name:  "s3",
+				Usage: "Work with S3 across accounts",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "cp",
+						Usage:     "Copy an S3 object from one account to another, minting short-term access keys for both",
+						ArgsUsage: "s3://BUCKET/KEY s3://BUCKET/[KEY]",
+						Action:    s3Copy,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "from",
+								Usage:    "favorite or `ACCOUNT/CAR` to read the source object with",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "favorite or `ACCOUNT/CAR` to write the destination object with",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "region",
+								Value: "us-east-1",
+								Usage: "`REGION` to ask for the regions of the buckets in",
+							},
+						},
 					},
+				},
+			},
+			{
+				Name:   "reconcile",
+				Usage:  "Compare favorites, workspaces, and defaults against your access in Kion and report what has drifted",
+				Action: reconcile,
+				Flags: []cli.Flag{
 					&cli.BoolFlag{
-						Name:  "credential-process",
-						Usage: "print stak json as AWS credential process",
+						Name:  "fix",
+						Usage: "apply the safe fixes, following renamed accounts, roles, and projects and dropping missing favorites from workspaces",
 					},
 				},
-				BashComplete: func(cCtx *cli.Context) {
-					// complete if no args are passed
-					if cCtx.NArg() > 0 {
-						return
-					}
-					// else pass favorites
-					fNames, _ := helper.MapFavs(config.Favorites)
-					for _, f := range fNames {
-						fmt.Println(f)
-					}
+			},
+			{
+				Name:  "list",
+				Usage: "List the projects, accounts, and cloud access roles in Kion",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "projects",
+						Usage:  "List the projects you may see",
+						Action: listProjects,
+					},
+					{
+						Name:   "accounts",
+						Usage:  "List the accounts you may see",
+						Action: listAccounts,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "project",
+								Usage: "only list accounts in the project with this `NAME` or ID",
+							},
+						},
+					},
+					{
+						Name:    "cars",
+						Aliases: []string{"cloud-access-roles"},
+						Usage:   "List the cloud access roles you have",
+						Action:  listCARs,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "account",
+								Usage: "only list cloud access roles on the account with this `NUMBER` or name, globs allowed",
+							},
+						},
+					},
 				},
+			},
+			{
+				Name:  "profiles",
+				Usage: "Manage the AWS credentials profiles short-term access keys are saved to",
 				Subcommands: []*cli.Command{
 					{
-						Name:   "list",
-						Usage:  "list favorites",
-						Action: listFavorites,
+						Name:   "clean",
+						Usage:  "Remove profiles saved by Kion CLI whose keys have expired",
+						Action: cleanProfiles,
 						Flags: []cli.Flag{
 							&cli.BoolFlag{
-								Name:    "verbose",
-								Aliases: []string{"v"},
-								Usage:   "show full favorite details",
+								Name:  "all",
+								Usage: "remove every profile saved by Kion CLI, expired or not",
 							},
 						},
 					},
 				},
 			},
 			{
-				Name:      "run",
-				Usage:     "Run a command with short-term access keys",
-				ArgsUsage: "[COMMAND]",
-				Action:    runCommand,
+				Name:   "paths",
+				Usage:  "Print where the configuration file, audit log, and other files are kept",
+				Action: printPaths,
+			},
+			{
+				Name:   "whoami",
+				Usage:  "Print the Kion instance, user, session expiry, and cache backend in use, without signing in",
+				Action: whoami,
+			},
+			{
+				Name:      "pin",
+				Usage:     "Keep accounts out of the pickers and favorites on this workstation, or list those pinned",
+				ArgsUsage: "[ACCOUNT...]",
+				Action:    pinAccounts,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:    "favorite",
-						Aliases: []string{"fav", "f"},
-						Usage:   "favorite name",
+						Name:  "reason",
+						Usage: "`REASON` the accounts are pinned, such as a legal hold, shown when they are refused",
 					},
-					&cli.StringFlag{
-						Name:    "account",
-						Aliases: []string{"acc", "a"},
-						Usage:   "account number",
+				},
+			},
+			{
+				Name:      "unpin",
+				Usage:     "Let pinned accounts be selected again",
+				ArgsUsage: "ACCOUNT...",
+				Action:    unpinAccounts,
+			},
+			{
+				Name:   "status",
+				Usage:  "Print what whoami does and the request quota Kion last reported, without signing in",
+				Action: status,
+			},
+			{
+				Name:  "session",
+				Usage: "Manage the cached Kion session",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "refresh",
+						Usage:  "Refresh the cached session without signing in again",
+						Action: sessionRefresh,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "keepalive",
+								Usage: "keep running, refreshing the session before it expires until the refresh token runs out",
+							},
+						},
 					},
-					&cli.StringFlag{
-						Name:    "car",
-						Aliases: []string{"c"},
-						Usage:   "CAR name",
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Inspect and clean up the Kion CLI cache",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List cached entries and how long each has left",
+						Action: listCache,
+					},
+					{
+						Name:   "purge",
+						Usage:  "Remove expired short-term access keys and sessions from the cache",
+						Action: purgeCache,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "remove every entry, as util flush-cache does",
+							},
+						},
+					},
+					{
+						Name:   "export",
+						Usage:  "Write the cached session and short-term access keys to a bundle encrypted with a passphrase, to carry to a host without a browser",
+						Action: exportCache,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "out",
+								Usage:    "write the bundle to `FILE`",
+								Required: true,
+							},
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "Store the session and short-term access keys of a bundle made with cache export, leaving out any that expired",
+						ArgsUsage: "BUNDLE",
+						Action:    importCache,
 					},
+				},
+			},
+			{
+				Name:   "bootstrap",
+				Usage:  "Set up Kion CLI on a new machine: configuration, completion, the kion wrapper, and a sign in check",
+				Action: bootstrap,
+				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:    "region",
-						Aliases: []string{"r"},
-						Usage:   "target region",
+						Name:  "shell",
+						Usage: "set up `SHELL`, one of bash, zsh, or fish, rather than the login shell",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-shell",
+						Usage: "leave the shell startup file alone",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-checks",
+						Usage: "don't check Kion can be reached and signed in to",
+					},
+				},
+			},
+			{
+				Name:      "completion",
+				Usage:     "Print a script completing commands, flags, favorites, and accounts in a shell",
+				ArgsUsage: "bash|zsh|fish",
+				Action:    completion,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "describe",
+						Usage: "describe favorites and accounts by their account and project in zsh and fish",
 					},
 				},
 			},
+			{
+				Name:      "shell-init",
+				Usage:     "Print a shell function that sets short-term access keys in the current shell rather than a sub-shell",
+				ArgsUsage: "[bash|zsh|fish|powershell]",
+				Action:    shellInit,
+			},
 			{
 				Name:  "util",
 				Usage: "Utility commands",
@@ -1095,6 +9476,17 @@ func main() {
 						Name:   "flush-cache",
 						Usage:  "Flush the Kion CLI cache",
 						Action: flushCache,
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "only",
+								Usage: "flush only a `CATEGORY` of the cache: stak, session, selection, inventory, or metadata, may be repeated",
+							},
+						},
+					},
+					{
+						Name:   "connectivity",
+						Usage:  "Check how Kion is reached from here, such as over private link",
+						Action: checkConnectivity,
 					},
 				},
 			},
@@ -1103,6 +9495,36 @@ func main() {
 
 	// TODO: extend help output to include examples
 
+	// complete the values of flags such as --account and --profile
+	completeFlagValues(app)
+
+	// describe the output of machine facing commands with --schema
+	addSchemaFlags(app)
+
+	// stop on a configuration file that can't be read unless validating it
+	if configErr != nil && !validatingConfig(app, os.Args) {
+		color.Red(" Error: %v, run kion config validate for details", configErr)
+		os.Exit(1)
+	}
+
+	// expand configured aliases, replacing os.Args so everything that reads
+	// the command line sees the expansion
+	args, err := expandAlias(app, os.Args, config.Aliases)
+	if err != nil {
+		color.Red(" Error: %v", err)
+		os.Exit(1)
+	}
+	os.Args = rewriteDeprecatedFlags(app, args)
+
+	// print an output schema rather than running the command
+	if path := schemaCommand(app, os.Args); path != "" {
+		if err := printOutputSchema(path); err != nil {
+			color.Red(" Error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// run the app
 	if err := app.Run(os.Args); err != nil {
 		color.Red(" Error: %v", err)
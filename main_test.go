@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/kionsoftware/kion-cli/lib/cache"
+	"github.com/kionsoftware/kion-cli/lib/filesystem"
+	"github.com/kionsoftware/kion-cli/lib/helper"
+	"github.com/kionsoftware/kion-cli/lib/kion"
+	"github.com/kionsoftware/kion-cli/lib/structs"
+	"github.com/urfave/cli/v2"
+)
+
+// initBudget caps the package initialization cost paid on every run. Raise
+// it only with good reason, heavy subsystems should initialize lazily. Init
+// time is budgeted by the allocations made rather than the wall clock, which
+// swings too much on loaded machines to fail a build on.
+var initBudget = struct {
+	allocs int
+	bytes  int
+}{
+	allocs: 8000,
+	bytes:  2 << 20,
+}
+
+// binaryBudget caps the size in bytes of a release build of the CLI, built
+// stripped as releases are. Raise it only with good reason, such as a
+// dependency worth its weight.
+const binaryBudget = 18 << 20
+
+// TestInitBudget fails if package initialization exceeds initBudget. The test
+// binary is re-run with GODEBUG=inittrace=1 which reports the time and memory
+// each package's init takes.
+func TestInitBudget(t *testing.T) {
+	if os.Getenv("KION_INIT_TRACE_CHILD") != "" {
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInitBudget$")
+	cmd.Env = append(os.Environ(), "GODEBUG=inittrace=1", "KION_INIT_TRACE_CHILD=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("unable to trace init: %v\n%v", err, stderr.String())
+	}
+
+	// lines look like: init github.com/fatih/color @1.2 ms, 0.01 ms clock, 1024 bytes, 12 allocs
+	var allocs, allocated int
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[0] != "init" {
+			continue
+		}
+		size, err := strconv.Atoi(fields[7])
+		if err != nil {
+			t.Fatalf("unexpected inittrace line: %v", scanner.Text())
+		}
+		count, err := strconv.Atoi(fields[9])
+		if err != nil {
+			t.Fatalf("unexpected inittrace line: %v", scanner.Text())
+		}
+		allocated += size
+		allocs += count
+	}
+
+	if allocs > initBudget.allocs {
+		t.Errorf("package init made %v allocations, budget is %v", allocs, initBudget.allocs)
+	}
+	if allocated > initBudget.bytes {
+		t.Errorf("package init allocated %v bytes, budget is %v bytes", allocated, initBudget.bytes)
+	}
+}
+
+// TestBinaryBudget fails if a release build of the CLI exceeds binaryBudget.
+func TestBinaryBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	goBin, err := exec.LookPath(filepath.Join(runtime.GOROOT(), "bin", "go"))
+	if err != nil {
+		t.Skipf("go tool not found: %v", err)
+	}
+
+	binary := filepath.Join(t.TempDir(), "kion")
+	cmd := exec.Command(goBin, "build", "-trimpath", "-ldflags=-s -w", "-o", binary, ".")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to build: %v\n%s", err, output)
+	}
+	info, err := os.Stat(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > binaryBudget {
+		t.Errorf("the binary is %v bytes, budget is %v bytes", info.Size(), binaryBudget)
+	}
+}
+
+func TestInvocation(t *testing.T) {
+	app := &cli.App{
+		Commands: []*cli.Command{
+			{Name: "favorite", Aliases: []string{"fav", "f"}},
+			{Name: "aws-config", Subcommands: []*cli.Command{{Name: "sync"}}},
+		},
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		want        string
+	}{
+		{"Alias", []string{"fav", "prod"}, "favorite"},
+		{"Subcommand", []string{"aws-config", "sync", "--prefix", "kion-"}, "aws-config sync"},
+		{"Unknown", []string{"nope"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := invocation(app, test.args); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandAlias(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "profile"},
+			&cli.BoolFlag{Name: "dry-run"},
+		},
+		Commands: []*cli.Command{
+			{Name: "stak", Aliases: []string{"s"}},
+			{Name: "favorite", Aliases: []string{"fav"}},
+		},
+	}
+	aliases := map[string]string{
+		"pa":     "stak --account 111122223333 --car 'Payments Admin'",
+		"s":      "favorite shadowed",
+		"nested": "pa --print",
+		"broken": `stak --car "Admin`,
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			"Expanded",
+			[]string{"kion", "pa", "--print"},
+			[]string{"kion", "stak", "--account", "111122223333", "--car", "Payments Admin", "--print"},
+			false,
+		},
+		{
+			"After Global Flags",
+			[]string{"kion", "--profile", "pa", "--dry-run", "pa"},
+			[]string{"kion", "--profile", "pa", "--dry-run", "stak", "--account", "111122223333", "--car", "Payments Admin"},
+			false,
+		},
+		{
+			"Built In Wins",
+			[]string{"kion", "s", "--print"},
+			[]string{"kion", "s", "--print"},
+			false,
+		},
+		{
+			"Not An Alias",
+			[]string{"kion", "fav", "pa"},
+			[]string{"kion", "fav", "pa"},
+			false,
+		},
+		{
+			"Nested",
+			[]string{"kion", "nested"},
+			nil,
+			true,
+		},
+		{
+			"Unterminated Quote",
+			[]string{"kion", "broken"},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := expandAlias(app, test.args, aliases)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRewriteDeprecatedFlags(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "profile"},
+			&cli.StringFlag{Name: "url"},
+		},
+		Commands: []*cli.Command{
+			{Name: "stak", Aliases: []string{"s"}, Flags: []cli.Flag{&cli.StringFlag{Name: "mode"}}},
+			{Name: "favorite", Aliases: []string{"fav"}, Subcommands: []*cli.Command{
+				{Name: "add", Flags: []cli.Flag{&cli.StringFlag{Name: "cloud-access-role"}}},
+			}},
+		},
+	}
+
+	deprecations := helper.Deprecations
+	warnings := deprecationWarnings
+	t.Cleanup(func() {
+		helper.Deprecations = deprecations
+		deprecationWarnings = warnings
+	})
+	helper.Deprecations = []helper.Deprecation{
+		{Kind: helper.DeprecatedFlag, Old: "endpoint", New: "url", Since: "v0.4.0", Removal: "v1.0.0"},
+		{Kind: helper.DeprecatedFlag, Old: "stak-mode", New: "mode", Command: "stak", Since: "v0.4.0", Removal: "v1.0.0"},
+		{Kind: helper.DeprecatedFlag, Old: "car", New: "cloud-access-role", Command: "favorite add", Since: "v0.4.0", Removal: "v1.0.0"},
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		want        []string
+		wantWarning string
+	}{
+		{
+			"Global Flag",
+			[]string{"kion", "--profile", "dev", "--endpoint", "https://kion.example", "stak"},
+			[]string{"kion", "--profile", "dev", "--url", "https://kion.example", "stak"},
+			"deprecated flag --endpoint, use --url",
+		},
+		{
+			"Command Flag By Alias",
+			[]string{"kion", "s", "--stak-mode=export"},
+			[]string{"kion", "s", "--mode=export"},
+			"deprecated flag --stak-mode, use --mode",
+		},
+		{
+			"Subcommand Flag",
+			[]string{"kion", "fav", "add", "--car", "Admin", "prod"},
+			[]string{"kion", "fav", "add", "--cloud-access-role", "Admin", "prod"},
+			`command="favorite add"`,
+		},
+		{
+			"Other Command",
+			[]string{"kion", "stak", "--car", "Admin"},
+			[]string{"kion", "stak", "--car", "Admin"},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var b bytes.Buffer
+			deprecationWarnings = helper.NewDeprecationWarnings(&b)
+			got := rewriteDeprecatedFlags(app, test.args)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\ngot:\n  %q\nwanted:\n  %q", got, test.want)
+			}
+			if (test.wantWarning == "" && b.Len() > 0) || !strings.Contains(b.String(), test.wantWarning) {
+				t.Errorf("\ngot warning:\n  %v\nwanted:\n  %v", b.String(), test.wantWarning)
+			}
+		})
+	}
+}
+
+func TestSchemaCommand(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{&cli.StringFlag{Name: "profile"}},
+		Commands: []*cli.Command{
+			{Name: "stak", Aliases: []string{"s"}},
+			{Name: "favorite", Aliases: []string{"fav"}, Subcommands: []*cli.Command{{Name: "list"}}},
+			{Name: "run"},
+		},
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		want        string
+	}{
+		{"Command", []string{"kion", "stak", "--schema"}, "stak"},
+		{"Alias After Global Flag", []string{"kion", "--profile", "dev", "s", "--schema"}, "stak"},
+		{"Subcommand", []string{"kion", "fav", "list", "--schema"}, "favorite list"},
+		{"Without Flag", []string{"kion", "stak", "--account", "111122223333"}, ""},
+		{"Text Only Command", []string{"kion", "run", "--schema"}, ""},
+		{"After Separator", []string{"kion", "favorite", "prod", "--", "--schema"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := schemaCommand(app, test.args); got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+
+	// every command writing structured output describes it
+	for _, path := range structuredCommands {
+		if _, found := machineOutputs[path]; !found {
+			t.Errorf("no output schema for %v", path)
+		}
+	}
+}
+
+func TestValidatingConfig(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{&cli.StringFlag{Name: "profile"}},
+		Commands: []*cli.Command{
+			{Name: "config", Subcommands: []*cli.Command{{Name: "validate"}, {Name: "get"}}},
+			{Name: "stak"},
+		},
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		want        bool
+	}{
+		{"Validate", []string{"kion", "config", "validate"}, true},
+		{"After Global Flag", []string{"kion", "--profile", "dev", "config", "validate", "--offline"}, true},
+		{"Other Subcommand", []string{"kion", "config", "get", "kion.url"}, false},
+		{"Other Command", []string{"kion", "stak", "validate"}, false},
+		{"No Command", []string{"kion"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := validatingConfig(app, test.args); got != test.want {
+				t.Errorf("got %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSTAKCacheKey(t *testing.T) {
+	policy := `{"Version":"2012-10-17","Statement":[]}`
+
+	tests := []struct {
+		description string
+		policy      string
+		want        string
+	}{
+		{"No Policy", "", "Admin-111122223333"},
+		{"Session Policy", policy, "Admin-111122223333-policy-" + helper.SessionPolicyID(policy)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := stakCacheKey("Admin", "111122223333", test.policy)
+			if got != test.want {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUncachedCategories(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		description string
+		settings    structs.CacheControl
+		want        []string
+	}{
+		{"Defaults", structs.CacheControl{}, nil},
+		{"Keys Off", structs.CacheControl{Stak: &disabled, Session: &enabled}, []string{"stak"}},
+		{"All Off", structs.CacheControl{Stak: &disabled, Session: &disabled, Inventory: &disabled}, []string{"stak", "session", "inventory"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := uncachedCategories(test.settings)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSharedSTAKReleasesLock(t *testing.T) {
+	valid := kion.STAK{AccessKey: "AKCACHED", SecretAccessKey: "secret", Expiration: time.Now().Add(time.Hour)}
+	fetched := kion.STAK{AccessKey: "AKFETCHED", SecretAccessKey: "secret", Expiration: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		description string
+		cache       func() cache.Cache
+		want        string
+		wantFetch   bool
+	}{
+		{"Fetched", func() cache.Cache { return cache.NewCache(keyring.NewArrayKeyring(nil), "test") }, "AKFETCHED", true},
+		{"Shared", func() cache.Cache {
+			shared := cache.NewCache(keyring.NewArrayKeyring(nil), "test")
+			_ = shared.SetStak("Admin-111122223333", valid)
+			return shared
+		}, "AKCACHED", false},
+		{"Caching Off", func() cache.Cache { return cache.NewNullCache(keyring.NewArrayKeyring(nil), "test") }, "AKFETCHED", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			defer func(dir string, cached cache.Cache) { keyLockDir, c = dir, cached }(keyLockDir, c)
+			keyLockDir, c = t.TempDir(), test.cache()
+			path := filesystem.KeyLockPath(keyLockDir, cacheNamespace, "Admin-111122223333")
+			holder := filesystem.LockHolder{PID: os.Getpid(), Acquired: time.Now()}
+
+			var didFetch bool
+			got, err := sharedSTAK("Admin-111122223333", 300, func() (kion.STAK, error) {
+				didFetch = true
+				if lock, err := filesystem.AcquireLock(path, holder, 0, keyLockStale, nil); err == nil {
+					lock.Release()
+					t.Error("the lock wasn't held while fetching")
+				}
+				return fetched, nil
+			})
+			if err != nil || got.AccessKey != test.want || didFetch != test.wantFetch {
+				t.Fatalf("got %v and %v having fetched %v, wanted %v", got.AccessKey, err, didFetch, test.want)
+			}
+
+			// the keys are used, such as by a sub-shell, with the lock free
+			lock, err := filesystem.AcquireLock(path, holder, 0, keyLockStale, nil)
+			if err != nil {
+				t.Fatalf("the lock is still held once the keys are returned: %v", err)
+			}
+			lock.Release()
+		})
+	}
+}
+
+func TestWithReauth(t *testing.T) {
+	unauthorized := &kion.APIError{StatusCode: 401, Body: "unauthorized"}
+	unavailable := &kion.APIError{StatusCode: 503, Body: "unavailable"}
+
+	tests := []struct {
+		description  string
+		sessionToken bool
+		err          error
+		wantErr      string
+		wantCalls    int
+	}{
+		{"Succeeded", true, nil, "", 1},
+		{"Other Status", true, unavailable, "received 503", 1},
+		{"User Token", false, unauthorized, "received 401", 1},
+		{"No Terminal", true, unauthorized, "re-run interactively to authenticate", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			defer func(token bool, cached cache.Cache, cfg structs.Configuration, noInteractive bool) {
+				sessionToken, c, config, helper.NoInteractive = token, cached, cfg, noInteractive
+			}(sessionToken, c, config, helper.NoInteractive)
+			sessionToken, c = test.sessionToken, cache.NewCache(keyring.NewArrayKeyring(nil), "test")
+			helper.NoInteractive = true
+			config.Kion.Password, config.Kion.Reauth = "", structs.Reauth{}
+
+			var calls int
+			err := withReauth(nil, func() error {
+				calls++
+				return test.err
+			})
+			if calls != test.wantCalls {
+				t.Errorf("ran %v times, wanted %v", calls, test.wantCalls)
+			}
+			if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got %v, wanted %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSharedSTAKSkipsCaching(t *testing.T) {
+	fetched := kion.STAK{AccessKey: "AKFETCHED", SecretAccessKey: "secret", Expiration: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		description string
+		stak        kion.STAK
+		err         error
+		wantCached  bool
+	}{
+		{"Fetched", fetched, nil, true},
+		{"Dry Run", kion.STAK{}, kion.ErrDryRun, false},
+		{"Empty Keys", kion.STAK{}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			defer func(dir string, cached cache.Cache) { keyLockDir, c = dir, cached }(keyLockDir, c)
+			keyLockDir, c = t.TempDir(), cache.NewCache(keyring.NewArrayKeyring(nil), "test")
+
+			got, err := sharedSTAK("Admin-111122223333", 300, func() (kion.STAK, error) {
+				return test.stak, test.err
+			})
+			if err != nil || got != test.stak {
+				t.Fatalf("got %v and %v, wanted %v", got.AccessKey, err, test.stak.AccessKey)
+			}
+			_, found, err := c.GetStak("Admin-111122223333")
+			if err != nil || found != test.wantCached {
+				t.Errorf("cached %v and %v, wanted cached %v", found, err, test.wantCached)
+			}
+		})
+	}
+}
+
+func TestGenStaksDryRunWritesNoCredentials(t *testing.T) {
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			posts++
+			return
+		}
+		fmt.Fprint(w, `{"status":200,"data":[{"name":"Admin","account_number":"111122223333","aws_iam_role_name":"admin"}]}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		args        []string
+	}{
+		{"Save", []string{"--save"}},
+		{"Save Profile", []string{"--save-profile", "kion-test"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			defer func(cfg structs.Configuration, cached cache.Cache, dir string, dry bool, format string) {
+				config, c, keyLockDir, dryRun, outputFormat = cfg, cached, dir, dry, format
+				kion.DryRun, kion.DryRunOutput = false, os.Stderr
+			}(config, c, keyLockDir, dryRun, outputFormat)
+			config.Kion.Url, config.Kion.ApiKey = server.URL, "token"
+			c = cache.NewDryRunCache(cache.NewCache(keyring.NewArrayKeyring(nil), "test"), io.Discard)
+			keyLockDir, outputFormat = t.TempDir(), "text"
+			dryRun, kion.DryRun, kion.DryRunOutput = true, true, io.Discard
+			credentials := filepath.Join(t.TempDir(), "credentials")
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+
+			app := &cli.App{
+				Writer:    io.Discard,
+				ErrWriter: io.Discard,
+				Commands: []*cli.Command{{
+					Name:   "stak",
+					Action: genStaks,
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "account"},
+						&cli.StringFlag{Name: "car"},
+						&cli.StringFlag{Name: "cloud"},
+						&cli.BoolFlag{Name: "save"},
+						&cli.StringFlag{Name: "save-profile"},
+					},
+				}},
+			}
+			args := append([]string{"kion", "stak", "--account", "111122223333", "--car", "Admin"}, test.args...)
+			err := app.Run(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if posts != 0 {
+				t.Errorf("sent %v requests for keys, wanted none", posts)
+			}
+			if _, err := os.Stat(credentials); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("the credentials file was written: %v", err)
+			}
+		})
+	}
+}